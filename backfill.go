@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tendermint/tendermint/state"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/runner"
+)
+
+// backfills index what was indexed before an index was introduced, off what's saved in mantlemint's db
+var backfills = map[string]func(indexerDB tmdb.DB, stateStore state.Store, from, to int64) (int, error){
+	"block-events": block.BackfillEvents,
+	"block-hashes": block.BackfillHashes,
+}
+
+// backfill runs the backfill named in args over every height injected; it can be interrupted and run again.
+// db must read from mantlemint's db at the latest height.
+func backfill(db tmdb.DB, mantlemintConfig *config.Config, args []string) {
+	if len(args) != 1 || backfills[args[0]] == nil {
+		panic(fmt.Errorf("usage: backfill block-events|block-hashes"))
+	}
+
+	stateStore := state.NewStore(db, state.StoreOptions{DiscardABCIResponses: false})
+	lastState, err := stateStore.Load()
+	if err != nil {
+		panic(err)
+	}
+	genesisDoc, err := runner.LoadGenesisDoc(mantlemintConfig.GenesisPath, mantlemintConfig.ChainID)
+	if err != nil {
+		panic(err)
+	}
+
+	indexerInstance, err := indexer.NewIndexer(mantlemintConfig.IndexerDB, mantlemintConfig.Home, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = indexerInstance.Close() }()
+
+	from, to := genesisDoc.InitialHeight, lastState.LastBlockHeight
+	log.Printf("[v0.34.x/backfill] backfilling %s from height %d to %d...", args[0], from, to)
+	backfilled, err := backfills[args[0]](indexerInstance.DB(), stateStore, from, to)
+	if err != nil {
+		panic(fmt.Errorf("backfill failed after %d heights, run it again to complete: %v", backfilled, err))
+	}
+	log.Printf("[v0.34.x/backfill] backfilled %s of %d heights", args[0], backfilled)
+}
@@ -0,0 +1,70 @@
+package block_feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	EndpointGETFeedStatus   = "/admin/feed"
+	EndpointPOSTFeedPin     = "/admin/feed/pin"
+	EndpointPOSTFeedUnpin   = "/admin/feed/unpin"
+	EndpointPOSTFeedExclude = "/admin/feed/exclude"
+	EndpointPOSTFeedInclude = "/admin/feed/include"
+)
+
+var (
+	ErrorMissingFeedEndpoint = "endpoint query parameter is required"
+)
+
+// RegisterAdminRoutes registers routes to inspect the upstream endpoints of the feed,
+// and to pin, exclude or include them back, i.e.
+//
+//	POST /admin/feed/pin?endpoint=http://node-1:26657
+func RegisterAdminRoutes(router *mux.Router, feed *AggregateSubscription) {
+	router.HandleFunc(EndpointGETFeedStatus, func(writer http.ResponseWriter, request *http.Request) {
+		writeFeedStatus(writer, feed)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointPOSTFeedUnpin, func(writer http.ResponseWriter, request *http.Request) {
+		feed.Unpin()
+		writeFeedStatus(writer, feed)
+	}).Methods("POST")
+
+	for path, update := range map[string]func(string) error{
+		EndpointPOSTFeedPin:     feed.Pin,
+		EndpointPOSTFeedExclude: feed.Exclude,
+		EndpointPOSTFeedInclude: feed.Include,
+	} {
+		update := update
+		router.HandleFunc(path, func(writer http.ResponseWriter, request *http.Request) {
+			endpoint := request.URL.Query().Get("endpoint")
+			if endpoint == "" {
+				http.Error(writer, ErrorMissingFeedEndpoint, 400)
+				return
+			}
+
+			if err := update(endpoint); err != nil {
+				http.Error(writer, err.Error(), 400)
+				return
+			}
+
+			writeFeedStatus(writer, feed)
+		}).Methods("POST")
+	}
+}
+
+func writeFeedStatus(writer http.ResponseWriter, feed *AggregateSubscription) {
+	response, err := json.Marshal(feed.Status())
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("failed to marshal feed status: %v", err), 500)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	_, _ = writer.Write(response)
+}
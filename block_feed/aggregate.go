@@ -1,9 +1,16 @@
 package block_feed
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	tendermint "github.com/tendermint/tendermint/types"
 )
 
 var _ BlockFeed = (*AggregateSubscription)(nil)
@@ -11,136 +18,825 @@ var _ BlockFeed = (*AggregateSubscription)(nil)
 type AggregateSubscription struct {
 	ws                    *WSSubscription
 	rpc                   *RPCSubscription
+	grpc                  *GRPCSubscription
+	localSources          []localBlockSource
+	historicalSources     []historicalSource
+	skipGRPCStream        bool
 	lastKnownBlock        int64
-	lastKnownEndpointIdx  int
+	lastKnownBlockID      *tendermint.BlockID
 	aggregateBlockChannel chan *BlockResult
-	wsEndpointsLength     int
-	isSynced              bool
+	errs                  chan error
+	wsPool                *endpointPool
+	quorum                *quorum
+
+	// set once the feed has halted, to the reason why
+	halted atomic.Value
+
+	// the endpoint currently streaming live blocks, and its index if it's a websocket (-1 otherwise)
+	liveEndpoint atomic.Value
+	liveWSIdx    int64
+
+	// local vs upstream height, and the delivery rate
+	syncTracker  *syncTracker
+	pollInterval time.Duration
+
+	// blocks are expected at least this often, see watchStall
+	stallThreshold time.Duration
+	stallCount     uint64
+
+	// closed on Close; every goroutine of the feed is tracked by wg
+	closing          chan struct{}
+	closeOnce        sync.Once
+	closeChannelOnce sync.Once
+	wg               sync.WaitGroup
+
+	// reconnect policy for the websocket feed
+	reconnectBackoff *backoff
+	reconnectCount   uint64
+
+	// gaps in the live feed that were repaired from rpc
+	gapCount          uint64
+	gapBlocksRepaired uint64
+
+	// copies of already delivered blocks, and different blocks at already delivered heights
+	recentBlocks   *dedupWindow
+	duplicateCount uint64
+	conflictCount  uint64
+}
+
+// AggregateFeedConfig holds tunables for the aggregate block feed
+type AggregateFeedConfig struct {
+	// ReconnectBaseDelay is the initial delay before reconnecting a dropped websocket
+	ReconnectBaseDelay time.Duration
+
+	// ReconnectMaxDelay caps the exponential backoff between reconnect attempts
+	ReconnectMaxDelay time.Duration
+
+	// PingInterval is how often the websocket is pinged to keep it alive; 0 disables pings.
+	// The websocket is reconnected if no pong comes back within PongTimeout.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// EndpointCooldown is how long a failed rpc endpoint is skipped before being retried
+	EndpointCooldown time.Duration
+
+	// PrefetchWindow is the number of blocks fetched ahead during catch-up
+	PrefetchWindow int
+
+	// PrefetchWorkers bounds the number of concurrent block requests during catch-up
+	PrefetchWorkers int
+
+	// PollInterval is how often the upstream tip is polled for
+	PollInterval time.Duration
+
+	// StallThreshold is how long the feed may go without a block before the upstream is probed,
+	// to tell a halted chain from a dead live feed (which is then reconnected); 0 disables it
+	StallThreshold time.Duration
+
+	// SyncedThreshold is how many blocks the feed may lag behind the upstream tip, and still be synced
+	SyncedThreshold int64
+
+	// BufferSize is how many blocks may be queued for the consumer; 0 makes the feed unbuffered.
+	// Once the buffer is full, the feed stops reading from its upstreams instead of dropping blocks,
+	// i.e. the websocket is not read from until there's room again (TCP backpressure).
+	BufferSize int
+
+	// RequestTimeout is the timeout of a single rpc or grpc request
+	RequestTimeout time.Duration
+
+	// MaxRetries is how many times a failed rpc request is retried over all endpoints,
+	// with exponential backoff starting from RetryBackoff
+	MaxRetries   int
+	RetryBackoff time.Duration
+
+	// LocalBlockStorePath optionally points to a tendermint blockstore.db;
+	// if set, catch-up reads from it before falling back to rpc
+	LocalBlockStorePath string
+
+	// BlockArchivePath optionally points to a directory of archived blocks (see FileBlockFeed);
+	// if set, catch-up reads from it before falling back to rpc
+	BlockArchivePath string
+
+	// ObjectArchive optionally points to a block archive in S3 or GCS (see ObjectStoreBlockFeed);
+	// if set, catch-up reads from it after BlockArchivePath, and before LocalBlockStorePath
+	ObjectArchive *ObjectStoreConfig
+
+	// GRPCEndpoint optionally points to a grpc block feed; if set, it is preferred
+	// over rpc for historical blocks and over ws for live blocks
+	GRPCEndpoint string
+
+	// GRPCTLS configures transport security of GRPCEndpoint
+	GRPCTLS GRPCTLSConfig
+
+	// GRPCStreamMethod overrides the method subscribed for live blocks, see DefaultGRPCStreamMethod
+	GRPCStreamMethod string
+
+	// Headers are sent to the matching rpc and ws endpoints, i.e. for authentication
+	Headers EndpointHeaders
+
+	// ProxyURL routes rpc and ws connections through a proxy, see NewProxyFunc.
+	// If empty, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored.
+	ProxyURL string
+
+	// Compression of rpc responses, see RPCSubscriptionConfig.Compression
+	Compression string
+
+	// Quorum, if 2 or more, is the number of distinct hosts that must agree on a block before it's delivered;
+	// blocks are cross-checked against rpc endpoints on other hosts than the one they came from.
+	// If not enough hosts answer within QuorumTimeout, the block is delivered anyway, with a warning.
+	// Any disagreement halts the feed.
+	Quorum        int
+	QuorumTimeout time.Duration
 }
 
 var done *BlockResult = nil
 
+// NewAggregateBlockFeed creates a feed that resumes right after the given checkpoint.
 func NewAggregateBlockFeed(
-	currentBlock int64,
+	checkpoint *Checkpoint,
 	rpcEndpoints []string,
 	wsEndpoints []string,
+	feedConfig *AggregateFeedConfig,
 ) *AggregateSubscription {
-	var rpc, rpcErr = NewRpcSubscription(rpcEndpoints)
+	if feedConfig.PollInterval <= 0 {
+		panic(fmt.Errorf("invalid poll interval(%s)", feedConfig.PollInterval))
+	}
+	if feedConfig.StallThreshold < 0 {
+		panic(fmt.Errorf("invalid stall threshold(%s)", feedConfig.StallThreshold))
+	}
+	if feedConfig.BufferSize < 0 {
+		panic(fmt.Errorf("invalid buffer size(%d)", feedConfig.BufferSize))
+	}
+
+	proxy, proxyErr := NewProxyFunc(feedConfig.ProxyURL)
+	if proxyErr != nil {
+		panic(proxyErr)
+	}
+
+	var rpc, rpcErr = NewRpcSubscription(rpcEndpoints, &RPCSubscriptionConfig{
+		Cooldown:        feedConfig.EndpointCooldown,
+		PrefetchWindow:  feedConfig.PrefetchWindow,
+		PrefetchWorkers: feedConfig.PrefetchWorkers,
+		RequestTimeout:  feedConfig.RequestTimeout,
+		MaxRetries:      feedConfig.MaxRetries,
+		RetryBackoff:    feedConfig.RetryBackoff,
+		Headers:         feedConfig.Headers,
+		Proxy:           proxy,
+		Compression:     feedConfig.Compression,
+	})
 	if rpcErr != nil {
 		panic(rpcErr)
 	}
 
 	// ws starts with 1st occurrence of ws endpoints
-	var ws, wsErr = NewWSSubscription(wsEndpoints)
+	var ws, wsErr = NewWSSubscription(wsEndpoints, feedConfig.Headers, proxy, feedConfig.PingInterval, feedConfig.PongTimeout)
 	if wsErr != nil {
 		panic(wsErr)
 	}
 
+	// local sources are read in the order given here
+	var localSources []localBlockSource
+	if feedConfig.BlockArchivePath != "" {
+		if archive, archiveErr := NewFileBlockFeed(feedConfig.BlockArchivePath); archiveErr != nil {
+			panic(archiveErr)
+		} else {
+			localSources = append(localSources, archive)
+		}
+	}
+	if feedConfig.ObjectArchive != nil {
+		if objectArchive, objectArchiveErr := NewObjectStoreBlockFeed(feedConfig.ObjectArchive); objectArchiveErr != nil {
+			panic(objectArchiveErr)
+		} else {
+			localSources = append(localSources, objectArchive)
+		}
+	}
+	if feedConfig.LocalBlockStorePath != "" {
+		if blockStore, blockStoreErr := NewBlockStoreSubscription(feedConfig.LocalBlockStorePath); blockStoreErr != nil {
+			panic(blockStoreErr)
+		} else {
+			localSources = append(localSources, blockStore)
+		}
+	}
+
+	// remote sources are tried in the order given here
+	var grpcFeed *GRPCSubscription
+	var historicalSources []historicalSource
+	if feedConfig.GRPCEndpoint != "" {
+		var grpcErr error
+		if grpcFeed, grpcErr = NewGRPCSubscription(feedConfig.GRPCEndpoint, &feedConfig.GRPCTLS, feedConfig.GRPCStreamMethod, feedConfig.RequestTimeout); grpcErr != nil {
+			panic(grpcErr)
+		}
+		historicalSources = append(historicalSources, grpcFeed)
+	}
+	historicalSources = append(historicalSources, rpc)
+
 	return &AggregateSubscription{
 		ws:                    ws,
 		rpc:                   rpc,
-		lastKnownBlock:        currentBlock,
-		lastKnownEndpointIdx:  0,
-		aggregateBlockChannel: make(chan *BlockResult),
-		wsEndpointsLength:     len(wsEndpoints),
-		isSynced:              false,
-	}
-}
-
-func (ags *AggregateSubscription) Subscribe(rpcIndex int) (chan *BlockResult, error) {
-	// create rpc subscriber
-	cRpc, cRpcErr := ags.rpc.Subscribe(rpcIndex)
-	if cRpcErr != nil {
-		return nil, cRpcErr
-	}
-
-	// create websocket subscriber
-	cWS, cWSErr := ags.ws.Subscribe(rpcIndex)
-	if cWSErr != nil {
-		return nil, cWSErr
-	}
-
-	// start with isSynced flag false
-	ags.setSyncState(false)
-
-	// read the first cWS
-	<-cWS
-
-	// check if the first block received from ws is the right block (currentHeight + 1)
-	// if not, the local blockchain is behind, in such case we would need to sync from Rpc.
-	if firstBlock := <-cWS; firstBlock.Block.Header.Height != ags.lastKnownBlock+1 {
-		log.Printf("[block_feed/aggregate] received the first block(%d), but local blockchain is at (%d)\n", firstBlock.Block.Header.Height, ags.lastKnownBlock)
-		go func() {
-			go ags.rpc.SyncFromUntil(ags.lastKnownBlock+1, firstBlock.Block.Header.Height, rpcIndex)
-			for {
-				r := <-cRpc
-				if r != done {
-					ags.aggregateBlockChannel <- r
-					ags.lastKnownBlock = r.Block.Height
-				} else {
-					break
-				}
+		grpc:                  grpcFeed,
+		localSources:          localSources,
+		historicalSources:     historicalSources,
+		lastKnownBlock:        checkpoint.Height,
+		lastKnownBlockID:      checkpoint.BlockID,
+		aggregateBlockChannel: make(chan *BlockResult, feedConfig.BufferSize),
+		errs:                  make(chan error, 1),
+		quorum:                newQuorum(feedConfig.Quorum, feedConfig.QuorumTimeout, rpc),
+		wsPool:                newEndpointPool(wsEndpoints, feedConfig.EndpointCooldown),
+		liveWSIdx:             -1,
+		syncTracker:           newSyncTracker(checkpoint.Height, feedConfig.SyncedThreshold),
+		pollInterval:          feedConfig.PollInterval,
+		stallThreshold:        feedConfig.StallThreshold,
+		recentBlocks:          newDedupWindow(dedupWindowSize),
+		closing:               make(chan struct{}),
+		reconnectBackoff:      newBackoff(feedConfig.ReconnectBaseDelay, feedConfig.ReconnectMaxDelay),
+		reconnectCount:        0,
+	}
+}
+
+// Subscribe starts feeding blocks from fromHeight onwards.
+// If fromHeight is 0 or less, the feed resumes right after the checkpoint it was created with.
+//
+// Historical blocks are paged through over grpc (if configured) or rpc until the feed is
+// within a block of the upstream tip, and only then the live stream (grpc or websocket) is
+// subscribed; whatever is left between the two (or arrives twice) is reconciled by height.
+func (ags *AggregateSubscription) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	if fromHeight > 0 && fromHeight != ags.lastKnownBlock+1 {
+		ags.lastKnownBlock = fromHeight - 1
+		ags.lastKnownBlockID = nil
+		ags.syncTracker.reset(ags.lastKnownBlock)
+	}
+
+	ags.wg.Add(2)
+	go ags.pollUpstream()
+	go ags.run()
+	if ags.stallThreshold > 0 {
+		ags.wg.Add(1)
+		go ags.watchStall()
+	}
+
+	return ags.aggregateBlockChannel, nil
+}
+
+// run pipes blocks to the aggregate channel, until the feed is closed.
+// Whenever the live stream is dropped, it reconnects with backoff; any heights missed
+// in between are backfilled before live blocks are resumed.
+func (ags *AggregateSubscription) run() {
+	defer ags.wg.Done()
+
+	isReconnect := false
+	for {
+		// nothing more is delivered once halted; wait for Close
+		if ags.isHalted() {
+			<-ags.closing
+			return
+		}
+
+		if isReconnect && !ags.waitBeforeReconnect() {
+			return
+		}
+		isReconnect = true
+
+		// catch up over rpc first; otherwise the websocket would be left unread
+		// for the whole catch-up, and the upstream would eventually drop us
+		if err := ags.catchUp(); err != nil {
+			log.Printf("[block_feed/aggregate] catch-up failed: %v", err)
+			ags.reportError(fmt.Errorf("catch-up failed: %w", err))
+			continue
+		}
+
+		cLive, isGRPC, err := ags.subscribeLive()
+		if err != nil {
+			log.Printf("[block_feed/aggregate] %v", err)
+			ags.reportError(err)
+			continue
+		}
+		ags.reconnectBackoff.reset()
+
+		startedAt := ags.lastKnownBlock
+		pipeErr := ags.pipe(cLive)
+		if pipeErr != nil {
+			log.Printf("[block_feed/aggregate] %v, reconnecting...", pipeErr)
+			ags.reportError(pipeErr)
+		} else {
+			log.Printf("[block_feed/aggregate] live feed done signal received, reconnecting...")
+			pipeErr = fmt.Errorf("live feed dropped")
+		}
+
+		if isGRPC {
+			ags.grpc.CloseStream()
+
+			// the stream did not deliver a single block; give ws a go next time,
+			// so that a broken grpc upstream does not stall the feed for good
+			ags.skipGRPCStream = ags.lastKnownBlock == startedAt
+		} else {
+			_ = ags.ws.Close(context.Background())
+
+			// unless the endpoint was switched on purpose (or the feed halted), move on to the next one
+			if wsIdx := int(atomic.LoadInt64(&ags.liveWSIdx)); ags.wsPool.isPreferred(wsIdx) && !ags.isHalted() {
+				ags.wsPool.reportFailure(wsIdx, pipeErr)
 			}
+		}
+		ags.setLive("", -1)
 
-			log.Printf("[block_feed/aggregate] switching to ws...")
-
-			// patch ws to aggregate
-			for {
-				r := <-cWS
-
-				// gracefully handle done signal; in whatever case received is nil,
-				// handle reconnection here
-				if r == done {
-					log.Printf("[block_feed/aggregate] websocket done signal received, reconnecting...")
-					ags.setSyncState(false)
-					ags.Close()
-					ags.Reconnect()
-					break
-				} else {
-					// if block feeder got upto this point,
-					// it is relatively safe that mantle is synced
-					ags.setSyncState(true)
-					ags.aggregateBlockChannel <- r
-					ags.lastKnownBlock = r.Block.Height
-				}
+		// the reader goroutine may still be blocked on sending to cLive; let it drain out
+		ags.wg.Add(1)
+		go func(c chan *BlockResult) {
+			defer ags.wg.Done()
+			for range c {
 			}
-		}()
+		}(cLive)
+	}
+}
+
+// subscribeLive subscribes to the grpc block stream if there is one, or to the websocket otherwise.
+// Whether the live feed comes from grpc is returned along with the channel.
+func (ags *AggregateSubscription) subscribeLive() (chan *BlockResult, bool, error) {
+	if ags.grpc != nil && !ags.skipGRPCStream {
+		cGRPC, err := ags.grpc.Subscribe(ags.lastKnownBlock + 1)
+		if err == nil {
+			ags.setLive(ags.grpc.Name(), -1)
+			return cGRPC, true, nil
+		}
+		log.Printf("[block_feed/aggregate] %v, falling back to websocket", err)
 	}
+	ags.skipGRPCStream = false
 
-	return ags.aggregateBlockChannel, nil
+	var err error
+	for _, idx := range ags.wsPool.candidates() {
+		endpoint := ags.wsPool.endpoint(idx)
+		tStart := time.Now()
+
+		ags.ws.UseEndpoint(idx)
+		cWS, subscribeErr := ags.ws.Subscribe(0)
+		if subscribeErr != nil {
+			log.Printf("[block_feed/aggregate] websocket subscription to %s failed: %v", RedactEndpoint(endpoint), subscribeErr)
+			ags.wsPool.reportFailure(idx, subscribeErr)
+			err = subscribeErr
+			continue
+		}
+
+		ags.wsPool.reportSuccess(idx, time.Since(tStart))
+		ags.setLive(endpoint, idx)
+		return cWS, false, nil
+	}
+
+	return nil, false, fmt.Errorf("websocket subscription failed: %v", err)
+}
+
+// reportError hands err over to whoever listens on Errors(), replacing an unread one if any.
+// Nobody listening is fine; the feed keeps retrying either way.
+func (ags *AggregateSubscription) reportError(err error) {
+	// failures while closing are expected
+	select {
+	case <-ags.closing:
+		return
+	default:
+	}
+
+	for {
+		select {
+		case ags.errs <- err:
+			return
+		default:
+		}
+
+		select {
+		case <-ags.errs:
+		default:
+		}
+	}
+}
+
+// Errors receives failures the feed could not recover from by retrying, i.e. catch-up failing
+// on every source after all retries. The feed keeps retrying with backoff regardless; use
+// IsPermanent to tell whether waiting is likely to help. Only the latest unread error is kept.
+func (ags *AggregateSubscription) Errors() <-chan error {
+	return ags.errs
+}
+
+func (ags *AggregateSubscription) setLive(endpoint string, wsIdx int) {
+	ags.liveEndpoint.Store(RedactEndpoint(endpoint))
+	atomic.StoreInt64(&ags.liveWSIdx, int64(wsIdx))
+}
+
+// catchUp pages through historical blocks over grpc or rpc, until the feed is within a block of the upstream tip.
+// If local sources are given, blocks are read from them first, as far as they go.
+func (ags *AggregateSubscription) catchUp() error {
+	if err := ags.catchUpFromLocalSources(); err != nil {
+		return err
+	}
+
+	for {
+		latest, err := ags.latestHeight()
+		if err != nil {
+			return err
+		}
+
+		// the last block (if any) is left to the live feed
+		if latest <= ags.lastKnownBlock+1 {
+			return nil
+		}
+
+		log.Printf("[block_feed/aggregate] catching up from %d to %d\n", ags.lastKnownBlock+1, latest)
+		if err := ags.backfill(latest); err != nil {
+			return err
+		}
+	}
+}
+
+// latestHeight asks remote sources for the upstream tip, in order, until one answers
+func (ags *AggregateSubscription) latestHeight() (int64, error) {
+	var err error
+	for _, source := range ags.historicalSources {
+		var latest int64
+		if latest, err = source.LatestHeight(); err == nil {
+			ags.syncTracker.observeUpstream(latest)
+			return latest, nil
+		}
+		log.Printf("[block_feed/aggregate] failed to get latest height from %s: %v\n", source.Name(), err)
+	}
+
+	return 0, err
+}
+
+// pipe forwards blocks from cLive until the live feed is dropped, or the feed is closed.
+func (ags *AggregateSubscription) pipe(cLive chan *BlockResult) error {
+	for {
+		var r *BlockResult
+		select {
+		case r = <-cLive:
+		case <-ags.closing:
+			return ErrFeedClosed
+		}
+
+		// gracefully handle done signal; in whatever case received is nil,
+		// handle reconnection at caller
+		if r == done {
+			return nil
+		}
+
+		height := r.Block.Height
+		ags.syncTracker.observeUpstream(height)
+
+		// already delivered; most likely a resend right after reconnection,
+		// or the live feed overlapping with a backfill
+		if height <= ags.lastKnownBlock {
+			ags.skipDelivered(r)
+			continue
+		}
+
+		// the local blockchain is behind, in such case we would need to sync from rpc
+		// before pushing the live block.
+		if height > ags.lastKnownBlock+1 {
+			if err := ags.repairGap(height); err != nil {
+				return err
+			}
+		}
+
+		if err := ags.emitConfirmed(r); err != nil {
+			return err
+		}
+	}
+}
+
+// emitConfirmed emits a block from the network, once a quorum of upstreams agrees on it (if enabled).
+// Upon disagreement, the feed halts.
+func (ags *AggregateSubscription) emitConfirmed(block *BlockResult) error {
+	if ags.quorum != nil {
+		if err := ags.quorum.confirm(block); errors.Is(err, ErrFeedClosed) {
+			return err
+		} else if err != nil {
+			return ags.halt(err)
+		}
+	}
+
+	return ags.emit(block)
+}
+
+// halt stops delivering blocks for good. The returned error wraps both ErrFeedHalted and reason,
+// and ends up on Errors() like any other failure.
+func (ags *AggregateSubscription) halt(reason error) error {
+	log.Printf("[block_feed/aggregate] HALTED: %v; no more blocks will be delivered until restarted\n", reason)
+	ags.halted.Store(reason)
+
+	return fmt.Errorf("%w: %w", ErrFeedHalted, reason)
+}
+
+func (ags *AggregateSubscription) isHalted() bool {
+	return ags.halted.Load() != nil
+}
+
+// emit pushes a block to the aggregate channel, and records it as the last known block.
+// ErrFeedClosed is returned if the feed is closed while waiting for the block to be received.
+func (ags *AggregateSubscription) emit(block *BlockResult) error {
+	// resuming from a checkpoint on a different fork (or a different chain) would
+	// silently corrupt state; make it loud at least.
+	if ags.lastKnownBlockID != nil && block.Block.Height == ags.lastKnownBlock+1 &&
+		!bytes.Equal(block.Block.LastBlockID.Hash, ags.lastKnownBlockID.Hash) {
+		log.Printf("[block_feed/aggregate] block(%d) does not follow the last known block %X\n", block.Block.Height, ags.lastKnownBlockID.Hash)
+	}
+
+	// tracked ahead of the send, so that the sync status is up to date by the time the block is received
+	ags.syncTracker.observeBlock(block.Block.Height, time.Now())
+
+	// blocks here while the buffer is full; nothing is dropped
+	select {
+	case ags.aggregateBlockChannel <- block:
+	case <-ags.closing:
+		return ErrFeedClosed
+	}
+
+	ags.lastKnownBlock = block.Block.Height
+	ags.lastKnownBlockID = block.BlockID
+	ags.recentBlocks.add(block.Block.Height, blockHash(block))
+
+	return nil
+}
+
+// skipDelivered drops a block at an already delivered height. Only the first block
+// delivered at a height is ever emitted; a different one showing up later is logged.
+func (ags *AggregateSubscription) skipDelivered(block *BlockResult) {
+	height := block.Block.Height
+	if isCopy, known := ags.recentBlocks.isCopy(height, blockHash(block)); known && !isCopy {
+		conflicts := atomic.AddUint64(&ags.conflictCount, 1)
+		log.Printf("[block_feed/aggregate] conflicting block(%d) %X dropped; already delivered a different block at this height (#%d)\n", height, blockHash(block), conflicts)
+		return
+	}
+
+	atomic.AddUint64(&ags.duplicateCount, 1)
+}
+
+// catchUpFromLocalSources reads blocks from local sources, up to their tips.
+// Once the tip of a source is reached, it is not consulted anymore; the rest is up to rpc and ws.
+func (ags *AggregateSubscription) catchUpFromLocalSources() error {
+	for len(ags.localSources) > 0 {
+		source := ags.localSources[0]
+		tip := source.Height()
+		if from := ags.lastKnownBlock + 1; from >= source.Base() && from <= tip {
+			log.Printf("[block_feed/aggregate] catching up from %d to %d over %s\n", from, tip, source.Name())
+			if err := source.FetchBlocks(from, tip, ags.emit); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("[block_feed/aggregate] reached tip of %s(%d), handing off to next feed\n", source.Name(), tip)
+		_ = source.Close(context.Background())
+		ags.localSources = ags.localSources[1:]
+	}
+
+	return nil
+}
+
+// repairGap backfills every height between the last delivered block and the live block at `height`.
+// Gaps are expected on startup and after reconnects; in a steady state they mean the upstream
+// has dropped events (i.e. its event buffer overflowed).
+func (ags *AggregateSubscription) repairGap(height int64) error {
+	from := ags.lastKnownBlock + 1
+	log.Printf("[block_feed/aggregate] received block(%d), but local blockchain is at (%d)\n", height, ags.lastKnownBlock)
+
+	if err := ags.backfill(height - 1); err != nil {
+		return err
+	}
+
+	gapCount := atomic.AddUint64(&ags.gapCount, 1)
+	atomic.AddUint64(&ags.gapBlocksRepaired, uint64(height-from))
+	log.Printf("[block_feed/aggregate] repaired gap #%d of %d blocks (%d..%d), switching to live feed...\n", gapCount, height-from, from, height-1)
+
+	return nil
 }
 
-func (ags *AggregateSubscription) Close() error {
-	rpcCloseErr := ags.rpc.Close()
-	wsCloseErr := ags.ws.Close()
+// backfill fetches blocks from lastKnownBlock+1 up to (and including) `to` from remote sources.
+// If a source fails midway, the next one picks up right after the last block emitted.
+func (ags *AggregateSubscription) backfill(to int64) error {
+	var err error
+	for _, source := range ags.historicalSources {
+		if err = source.FetchBlocks(ags.lastKnownBlock+1, to, ags.emitConfirmed); err == nil {
+			return nil
+		} else if errors.Is(err, ErrFeedClosed) || errors.Is(err, ErrFeedHalted) {
+			return err
+		}
+		log.Printf("[block_feed/aggregate] backfill from %s failed at %d: %v\n", source.Name(), ags.lastKnownBlock+1, err)
+	}
 
-	return fmt.Errorf("error during aggregate subscription close: %s, %s", rpcCloseErr, wsCloseErr)
+	return fmt.Errorf("backfill failed: %w", err)
 }
 
-// Reconnect reestablishes all underlying connections
+// Close stops the feed: the websocket is unsubscribed, in-flight fetches are cancelled, and
+// the output channel is closed once every goroutine of the feed has exited.
+// If ctx is done before that, Close returns with ctx's error and leaves the channel open.
+func (ags *AggregateSubscription) Close(ctx context.Context) error {
+	ags.closeOnce.Do(func() {
+		close(ags.closing)
+	})
+
+	// unblock whatever the goroutines are waiting on
+	var errs []error
+	if err := ags.rpc.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("rpc: %v", err))
+	}
+	if err := ags.ws.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("ws: %v", err))
+	}
+	if ags.grpc != nil {
+		if err := ags.grpc.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("grpc: %v", err))
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		ags.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("aggregate subscription did not stop in time: %v", ctx.Err())
+	}
+
+	// local sources are only ever read by run(), which has exited by now
+	for _, source := range ags.localSources {
+		if err := source.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", source.Name(), err))
+		}
+	}
+	ags.localSources = nil
+
+	ags.closeChannelOnce.Do(func() {
+		close(ags.aggregateBlockChannel)
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("error during aggregate subscription close: %v", errs)
+	}
+	return nil
+}
+
+// waitBeforeReconnect is called before every reconnection attempt.
 // On any reconnection, it is likely that the underlying RPC is having some problem.
-// To mitigate this,
-func (ags *AggregateSubscription) Reconnect() {
-	endpointIndex := ags.nextWSEndpoint()
-	time.Sleep(time.Second)
+// To mitigate this, a dropped ws endpoint is reported as failed, so that the next one is
+// tried first, and attempts are spaced with exponential backoff.
+// Returns false if the feed is closed meanwhile.
+func (ags *AggregateSubscription) waitBeforeReconnect() bool {
+	delay := ags.reconnectBackoff.next()
+	attempt := atomic.AddUint64(&ags.reconnectCount, 1)
 
-	log.Printf("[block_feed/aggregate] reconnecting with rpcIndex of %d\n", endpointIndex)
-	if _, err := ags.Subscribe(endpointIndex); err != nil {
-		ags.Reconnect()
+	log.Printf("[block_feed/aggregate] reconnect attempt #%d in %s\n", attempt, delay)
+	select {
+	case <-time.After(delay):
+		return true
+	case <-ags.closing:
+		return false
 	}
 }
 
-func (ags *AggregateSubscription) IsSynced() bool {
-	return ags.isSynced
+// RPCStatus returns health of rpc endpoints used for backfilling,
+// including which one is currently in use.
+func (ags *AggregateSubscription) RPCStatus() []EndpointStatus {
+	return ags.rpc.Status()
+}
+
+// FeedStatus is a snapshot of the upstream endpoints of the feed
+type FeedStatus struct {
+	RPC  []EndpointStatus `json:"rpc"`
+	WS   []EndpointStatus `json:"ws"`
+	GRPC string           `json:"grpc,omitempty"`
+
+	// Live is the endpoint currently streaming live blocks, if any
+	Live string     `json:"live"`
+	Sync SyncStatus `json:"sync"`
+
+	// Halted is why the feed has stopped delivering blocks for good, if it has
+	Halted string `json:"halted,omitempty"`
+
+	// QuorumFallbacks is the number of blocks delivered without a quorum, when quorum mode is on
+	QuorumFallbacks uint64 `json:"quorum_fallbacks"`
+}
+
+// Status returns health of every upstream endpoint, along with which ones are in use
+func (ags *AggregateSubscription) Status() FeedStatus {
+	status := FeedStatus{
+		RPC:  ags.rpc.Status(),
+		WS:   ags.wsPool.status(),
+		Sync: ags.SyncStatus(),
+	}
+	status.Live, _ = ags.liveEndpoint.Load().(string)
+	if ags.grpc != nil {
+		status.GRPC = ags.grpc.endpoint
+	}
+	if reason, ok := ags.halted.Load().(error); ok {
+		status.Halted = reason.Error()
+	}
+	if ags.quorum != nil {
+		status.QuorumFallbacks = atomic.LoadUint64(&ags.quorum.fallbacks)
+	}
+
+	return status
 }
 
-func (ags *AggregateSubscription) setSyncState(state bool) {
-	ags.isSynced = state
+// Pin makes endpoint the only rpc or ws endpoint used, regardless of its health, until Unpin is called.
+func (ags *AggregateSubscription) Pin(endpoint string) error {
+	return ags.updatePool(endpoint, (*endpointPool).pin)
 }
 
-func (ags *AggregateSubscription) nextWSEndpoint() int {
-	ags.lastKnownEndpointIdx++
-	ags.lastKnownEndpointIdx = ags.lastKnownEndpointIdx % ags.wsEndpointsLength
+// Unpin goes back to choosing rpc and ws endpoints by their health
+func (ags *AggregateSubscription) Unpin() {
+	ags.rpc.pool.unpin()
+	ags.wsPool.unpin()
+	ags.dropUnpreferredWS()
+}
+
+// Exclude stops endpoint from being used until Include is called.
+// The last usable endpoint of a kind cannot be excluded.
+func (ags *AggregateSubscription) Exclude(endpoint string) error {
+	return ags.updatePool(endpoint, (*endpointPool).exclude)
+}
 
-	return ags.lastKnownEndpointIdx
+// Include takes an excluded endpoint back into use
+func (ags *AggregateSubscription) Include(endpoint string) error {
+	return ags.updatePool(endpoint, (*endpointPool).include)
+}
+
+func (ags *AggregateSubscription) updatePool(endpoint string, update func(*endpointPool, string) error) error {
+	switch {
+	case ags.rpc.pool.has(endpoint):
+		return update(ags.rpc.pool, endpoint)
+	case ags.wsPool.has(endpoint):
+		if err := update(ags.wsPool, endpoint); err != nil {
+			return err
+		}
+		ags.dropUnpreferredWS()
+		return nil
+	default:
+		return fmt.Errorf("unknown endpoint %s", endpoint)
+	}
+}
+
+// dropUnpreferredWS closes the live websocket if it's no longer the one to use,
+// so that the feed reconnects to the right one.
+func (ags *AggregateSubscription) dropUnpreferredWS() {
+	wsIdx := int(atomic.LoadInt64(&ags.liveWSIdx))
+	if wsIdx < 0 || ags.wsPool.isPreferred(wsIdx) {
+		return
+	}
+
+	log.Printf("[block_feed/aggregate] switching away from websocket %s\n", RedactEndpoint(ags.wsPool.endpoint(wsIdx)))
+	_ = ags.ws.Close(context.Background())
+}
+
+// GapCount returns the number of gaps repaired so far,
+// and the total number of blocks backfilled for them.
+func (ags *AggregateSubscription) GapCount() (gaps uint64, blocks uint64) {
+	return atomic.LoadUint64(&ags.gapCount), atomic.LoadUint64(&ags.gapBlocksRepaired)
+}
+
+// DedupCount returns the number of copies of already delivered blocks dropped so far,
+// and the number of different blocks dropped at already delivered heights.
+// The latter should always be 0; anything else means an upstream is on a different fork.
+func (ags *AggregateSubscription) DedupCount() (duplicates uint64, conflicts uint64) {
+	return atomic.LoadUint64(&ags.duplicateCount), atomic.LoadUint64(&ags.conflictCount)
+}
+
+// ReconnectCount returns the number of websocket reconnect attempts made so far.
+// A steadily increasing value indicates a flapping upstream.
+func (ags *AggregateSubscription) ReconnectCount() uint64 {
+	return atomic.LoadUint64(&ags.reconnectCount)
+}
+
+// SyncStatus returns how far the feed is behind the upstream, and how fast it is delivering blocks
+func (ags *AggregateSubscription) SyncStatus() SyncStatus {
+	status := ags.syncTracker.status(time.Now())
+	status.Buffered, status.BufferSize = ags.BufferOccupancy()
+
+	return status
+}
+
+// BufferOccupancy returns the number of blocks queued for the consumer, and the capacity of the queue.
+// A buffer that is constantly full means the consumer is the bottleneck, not the upstream.
+func (ags *AggregateSubscription) BufferOccupancy() (buffered int, size int) {
+	return len(ags.aggregateBlockChannel), cap(ags.aggregateBlockChannel)
+}
+
+// IsSynced reports whether the feed is within SyncedThreshold blocks of the upstream tip
+func (ags *AggregateSubscription) IsSynced() bool {
+	return ags.SyncStatus().Synced
+}
+
+// pollUpstream refreshes the upstream height periodically, so that lag is
+// known even when the live feed is down or lagging behind itself.
+func (ags *AggregateSubscription) pollUpstream() {
+	defer ags.wg.Done()
+
+	ticker := time.NewTicker(ags.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, _ = ags.latestHeight()
+		case <-ags.closing:
+			return
+		}
+	}
 }
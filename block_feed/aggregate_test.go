@@ -0,0 +1,273 @@
+package block_feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+func testBlockJSON(t *testing.T, height int64) []byte {
+	blockJSON, err := tmjson.Marshal(&BlockResult{
+		BlockID: &tendermint.BlockID{},
+		Block:   &tendermint.Block{Header: tendermint.Header{Height: height}},
+	})
+	assert.Nil(t, err)
+	return blockJSON
+}
+
+// newTestUpstream serves /status (reporting tip), /block and /websocket;
+// the websocket pushes wsHeights right after the subscription.
+func newTestUpstream(t *testing.T, tip int64, wsHeights []int64) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(fmt.Sprintf(`{"result":{"sync_info":{"latest_block_height":"%d"}}}`, tip)))
+	})
+	mux.HandleFunc("/block", func(writer http.ResponseWriter, request *http.Request) {
+		height, _ := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+		writer.Write([]byte(fmt.Sprintf(`{"result":%s}`, testBlockJSON(t, height))))
+	})
+	mux.HandleFunc("/websocket", func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// subscription request & ack
+		_, _, _ = conn.ReadMessage()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":0,"result":{}}`))
+
+		for _, height := range wsHeights {
+			message := fmt.Sprintf(`{"jsonrpc":"2.0","id":0,"result":{"data":{"type":"tendermint/event/NewBlock","value":%s}}}`, testBlockJSON(t, height))
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(message))
+		}
+
+		// hold the connection open
+		time.Sleep(time.Minute)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestAggregateSubscriptionSwitchover(t *testing.T) {
+	// upstream is at 30 during catch-up, but the live stream has moved on since;
+	// it resends 29 and 30, and skips 32
+	server := newTestUpstream(t, 30, []int64{29, 30, 31, 33})
+	defer server.Close()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{server.URL},
+		[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Second,
+			RequestTimeout:     time.Second,
+		},
+	)
+
+	c, err := feed.Subscribe(11)
+	assert.Nil(t, err)
+
+	for expected := int64(11); expected <= 33; expected++ {
+		select {
+		case block := <-c:
+			assert.Equal(t, expected, block.Block.Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", expected)
+		}
+	}
+
+	gaps, blocks := feed.GapCount()
+	assert.Equal(t, uint64(1), gaps)
+	assert.Equal(t, uint64(1), blocks)
+	assert.True(t, feed.IsSynced())
+
+	// 29 and 30 were resent
+	duplicates, conflicts := feed.DedupCount()
+	assert.Equal(t, uint64(2), duplicates)
+	assert.Equal(t, uint64(0), conflicts)
+}
+
+func TestAggregateSubscriptionClose(t *testing.T) {
+	server := newTestUpstream(t, 30, []int64{31})
+	defer server.Close()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{server.URL},
+		[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Second,
+			RequestTimeout:     time.Second,
+		},
+	)
+
+	c, err := feed.Subscribe(1)
+	assert.Nil(t, err)
+
+	// stop midway through catch-up
+	for expected := int64(1); expected <= 10; expected++ {
+		assert.Equal(t, expected, (<-c).Block.Height)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, feed.Close(ctx))
+
+	_, ok := <-c
+	assert.False(t, ok)
+}
+
+func TestAggregateSubscriptionBuffer(t *testing.T) {
+	server := newTestUpstream(t, 30, nil)
+	defer server.Close()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{server.URL},
+		[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Second,
+			RequestTimeout:     time.Second,
+			BufferSize:         4,
+		},
+	)
+	defer feed.Close(context.Background())
+
+	c, err := feed.Subscribe(1)
+	assert.Nil(t, err)
+
+	// nothing is taken; the feed fills the buffer up and waits
+	assert.Eventually(t, func() bool {
+		buffered, size := feed.BufferOccupancy()
+		return buffered == 4 && size == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, feed.SyncStatus().Buffered)
+
+	// no block was dropped meanwhile
+	for expected := int64(1); expected <= 10; expected++ {
+		assert.Equal(t, expected, (<-c).Block.Height)
+	}
+}
+
+func TestAggregateSubscriptionErrors(t *testing.T) {
+	// every height is pruned on the only upstream
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/status" {
+			writer.Write([]byte(`{"result":{"sync_info":{"latest_block_height":"30"}}}`))
+			return
+		}
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(`{"jsonrpc":"2.0","id":-1,"error":{"code":-32603,"message":"Internal error","data":"height 1 is not available, lowest height is 20"}}`))
+	}))
+	defer server.Close()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{server.URL},
+		[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Second,
+			RequestTimeout:     time.Second,
+		},
+	)
+	defer feed.Close(context.Background())
+
+	_, err := feed.Subscribe(1)
+	assert.Nil(t, err)
+
+	select {
+	case err := <-feed.Errors():
+		assert.True(t, IsPermanent(err), "expected permanent error, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for feed error")
+	}
+}
+
+func TestAggregateSubscriptionStall(t *testing.T) {
+	// the websocket goes silent after 31, and the upstream has nothing newer
+	server := newTestUpstream(t, 30, []int64{31})
+	defer server.Close()
+	ahead := newTestUpstream(t, 40, nil)
+	defer ahead.Close()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{server.URL, ahead.URL},
+		[]string{"ws" + strings.TrimPrefix(server.URL, "http") + "/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Minute,
+			RequestTimeout:     time.Second,
+			StallThreshold:     300 * time.Millisecond,
+		},
+	)
+	defer feed.Close(context.Background())
+
+	assert.Nil(t, feed.Pin(server.URL))
+	c, err := feed.Subscribe(21)
+	assert.Nil(t, err)
+
+	for expected := int64(21); expected <= 31; expected++ {
+		select {
+		case block := <-c:
+			assert.Equal(t, expected, block.Block.Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", expected)
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return feed.SyncStatus().Stalled == StallChainHalted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the upstream moves on; the live feed is dropped and whatever it missed is caught up
+	assert.Nil(t, feed.Pin(ahead.URL))
+	assert.Eventually(t, func() bool {
+		return feed.SyncStatus().Stalled == StallSubscriptionDead
+	}, 5*time.Second, 10*time.Millisecond)
+	for expected := int64(32); expected <= 40; expected++ {
+		select {
+		case block := <-c:
+			assert.Equal(t, expected, block.Block.Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", expected)
+		}
+	}
+	assert.Equal(t, uint64(2), feed.StallCount())
+}
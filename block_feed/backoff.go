@@ -0,0 +1,43 @@
+package block_feed
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff yields exponentially growing delays capped at max.
+// Each delay is jittered into [d/2, d] so that many mantlemint instances
+// behind the same upstream don't reconnect in lockstep.
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff(base, max time.Duration) *backoff {
+	return &backoff{
+		base:    base,
+		max:     max,
+		attempt: 0,
+	}
+}
+
+// next returns the delay to wait before the next attempt
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	// guard against overflow on shifting; anything above 2^32 * base is past max anyway
+	if b.attempt < 32 {
+		if d := b.base << uint(b.attempt); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// reset is called after a successful attempt
+func (b *backoff) reset() {
+	b.attempt = 0
+}
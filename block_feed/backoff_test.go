@@ -0,0 +1,38 @@
+package block_feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second)
+
+	// delays grow, but are always within [d/2, d]
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for _, d := range expected {
+		delay := b.next()
+		assert.GreaterOrEqual(t, delay, d/2)
+		assert.LessOrEqual(t, delay, d)
+	}
+
+	// very large attempt count must not overflow
+	for i := 0; i < 100; i++ {
+		delay := b.next()
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, time.Second)
+	}
+
+	b.reset()
+	delay := b.next()
+	assert.LessOrEqual(t, delay, 100*time.Millisecond)
+}
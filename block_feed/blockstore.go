@@ -0,0 +1,126 @@
+package block_feed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/tendermint/tendermint/store"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var _ BlockFeed = (*BlockStoreSubscription)(nil)
+
+// BlockStoreSubscription reads blocks directly out of a tendermint blockstore.db,
+// i.e. ${TERRA_HOME}/data/blockstore.db of a synced terrad.
+//
+// The db is opened read-only, but goleveldb still takes a file lock on it;
+// terrad owning the directory must be stopped, or point this to a copy of it.
+type BlockStoreSubscription struct {
+	db         tmdb.DB
+	blockStore *store.BlockStore
+	c          chan *BlockResult
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewBlockStoreSubscription(path string) (*BlockStoreSubscription, error) {
+	dir, name := filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ".db")
+	db, err := tmdb.NewGoLevelDBWithOpts(name, dir, &opt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blockstore at %s: %v", path, err)
+	}
+
+	return &BlockStoreSubscription{
+		db:         db,
+		blockStore: store.NewBlockStore(db),
+		c:          make(chan *BlockResult),
+		closing:    make(chan struct{}),
+	}, nil
+}
+
+func (bs *BlockStoreSubscription) Name() string {
+	return "local blockstore"
+}
+
+// Base returns the first height available in the blockstore
+func (bs *BlockStoreSubscription) Base() int64 {
+	return bs.blockStore.Base()
+}
+
+// Height returns the tip of the blockstore
+func (bs *BlockStoreSubscription) Height() int64 {
+	return bs.blockStore.Height()
+}
+
+// LoadBlock reads a single block at the given height
+func (bs *BlockStoreSubscription) LoadBlock(height int64) (*BlockResult, error) {
+	meta := bs.blockStore.LoadBlockMeta(height)
+	block := bs.blockStore.LoadBlock(height)
+	if meta == nil || block == nil {
+		return nil, fmt.Errorf("block %d not found in blockstore (base=%d, height=%d)", height, bs.Base(), bs.Height())
+	}
+
+	return &BlockResult{
+		BlockID: &meta.BlockID,
+		Block:   block,
+	}, nil
+}
+
+// FetchBlocks reads blocks from `from` to `to` (inclusive) in order, and calls emit for each block
+func (bs *BlockStoreSubscription) FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error {
+	for height := from; height <= to; height++ {
+		block, err := bs.LoadBlock(height)
+		if err != nil {
+			return err
+		}
+		if err := emit(block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe feeds blocks from fromHeight up to the tip of the blockstore.
+// The channel receives nil once the tip is reached.
+func (bs *BlockStoreSubscription) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	if fromHeight < bs.Base() {
+		return nil, fmt.Errorf("blockstore starts at %d, cannot feed from %d", bs.Base(), fromHeight)
+	}
+
+	go func() {
+		tip := bs.Height()
+		log.Printf("[block_feed/blockstore] subscription started, from=%d, to=%d\n", fromHeight, tip)
+		if err := bs.FetchBlocks(fromHeight, tip, bs.send); err != nil {
+			log.Printf("[block_feed/blockstore] %v\n", err)
+		}
+
+		_ = bs.send(nil)
+	}()
+
+	return bs.c, nil
+}
+
+func (bs *BlockStoreSubscription) send(block *BlockResult) error {
+	select {
+	case bs.c <- block:
+		return nil
+	case <-bs.closing:
+		return ErrFeedClosed
+	}
+}
+
+func (bs *BlockStoreSubscription) Close(_ context.Context) error {
+	var err error
+	bs.closeOnce.Do(func() {
+		close(bs.closing)
+		err = bs.db.Close()
+	})
+	return err
+}
@@ -0,0 +1,45 @@
+package block_feed
+
+import (
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var checkpointKey = []byte("mantlemint/block_feed/checkpoint")
+
+// Checkpoint records the last block consumed from the feed.
+// It is written in the same batch as the block's state changes,
+// so it is never ahead nor behind the state after an unclean shutdown.
+type Checkpoint struct {
+	Height  int64               `json:"height"`
+	BlockID *tendermint.BlockID `json:"block_id"`
+}
+
+// LoadCheckpoint reads the last checkpoint from db; returns nil if there is none yet.
+func LoadCheckpoint(db tmdb.DB) (*Checkpoint, error) {
+	checkpointJSON, err := db.Get(checkpointKey)
+	if err != nil {
+		return nil, err
+	} else if checkpointJSON == nil {
+		return nil, nil
+	}
+
+	checkpoint := new(Checkpoint)
+	if err := tmjson.Unmarshal(checkpointJSON, checkpoint); err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// SaveCheckpoint writes a checkpoint to db.
+// db is expected to be the batched mantlemint db, opened for the block's height.
+func SaveCheckpoint(db tmdb.DB, checkpoint *Checkpoint) error {
+	checkpointJSON, err := tmjson.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return db.Set(checkpointKey, checkpointJSON)
+}
@@ -0,0 +1,27 @@
+package block_feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func TestCheckpoint(t *testing.T) {
+	db := tmdb.NewMemDB()
+
+	checkpoint, err := LoadCheckpoint(db)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+
+	assert.Nil(t, SaveCheckpoint(db, &Checkpoint{
+		Height:  100,
+		BlockID: &tendermint.BlockID{Hash: []byte{0xab, 0xcd}},
+	}))
+
+	checkpoint, err = LoadCheckpoint(db)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), checkpoint.Height)
+	assert.Equal(t, []byte{0xab, 0xcd}, []byte(checkpoint.BlockID.Hash))
+}
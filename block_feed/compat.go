@@ -0,0 +1,156 @@
+package block_feed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode"
+
+	tmjson "github.com/tendermint/tendermint/libs/json"
+)
+
+// Upstreams on newer tendermint (0.37+, cometbft) or behind gateways don't always speak the exact
+// json of 0.34, which tmjson is strict about. Responses are decoded as 0.34 first, and only
+// normalized into its shape if that fails:
+//   - 64-bit integers (heights, voting powers) are strings in 0.34, but may come as numbers
+//   - smaller integers (rounds, part totals) are numbers in 0.34, but may come as strings
+//   - abci event attributes are base64 in 0.34, but plain strings from 0.37 on
+
+// keys of 64-bit integer fields of blocks, commits and evidence
+var int64JSONKeys = map[string]bool{
+	"height":             true,
+	"common_height":      true,
+	"total_voting_power": true,
+	"validator_power":    true,
+	"voting_power":       true,
+	"proposer_priority":  true,
+	"block":              true, // version.block
+	"app":                true, // version.app
+	"gas_wanted":         true,
+	"gas_used":           true,
+}
+
+// keys of integer fields that tmjson takes as json numbers
+var int32JSONKeys = map[string]bool{
+	"round":           true,
+	"total":           true,
+	"index":           true,
+	"validator_index": true,
+	"block_id_flag":   true,
+	"type":            true,
+	"code":            true,
+}
+
+// unmarshalCompat unmarshals message with tmjson, normalizing it to the 0.34 shape if it does not decode as is.
+// The error of the first attempt is returned if neither works, as it's the one that tells what's off.
+func unmarshalCompat(message []byte, v interface{}) error {
+	err := tmjson.Unmarshal(message, v)
+	if err == nil {
+		return nil
+	}
+
+	normalized, normalizeErr := normalizeJSON(message)
+	if normalizeErr != nil {
+		return err
+	}
+	if retryErr := tmjson.Unmarshal(normalized, v); retryErr != nil {
+		return err
+	}
+
+	return nil
+}
+
+func normalizeJSON(message []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.UseNumber()
+
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	var attributes []map[string]interface{}
+	tree = normalizeValue("", tree, &attributes)
+
+	// attributes are either all base64, or all plain
+	if !areBase64Attributes(attributes) {
+		for _, attribute := range attributes {
+			for _, key := range []string{"key", "value"} {
+				if s, ok := attribute[key].(string); ok {
+					attribute[key] = base64.StdEncoding.EncodeToString([]byte(s))
+				}
+			}
+		}
+	}
+
+	return json.Marshal(tree)
+}
+
+// normalizeValue converts integers to the representation tmjson expects for key, recursively,
+// and collects abci event attributes along the way
+func normalizeValue(key string, value interface{}, attributes *[]map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalizeValue(k, child, attributes)
+		}
+	case []interface{}:
+		for i, child := range v {
+			if attribute, ok := child.(map[string]interface{}); ok && key == "attributes" {
+				*attributes = append(*attributes, attribute)
+			}
+			v[i] = normalizeValue(key, child, attributes)
+		}
+	case json.Number:
+		if int64JSONKeys[key] {
+			return v.String()
+		}
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 32); err == nil && int32JSONKeys[key] {
+			return json.Number(v)
+		}
+	}
+
+	return value
+}
+
+// areBase64Attributes tells whether attributes are encoded as 0.34 does, i.e. every key decodes
+// from base64 into printable text; plain keys such as "sender" or "amount" never do
+func areBase64Attributes(attributes []map[string]interface{}) bool {
+	for _, attribute := range attributes {
+		key, _ := attribute["key"].(string)
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || !isPrintable(decoded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isPrintable(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonInt64 takes a 64-bit integer either as a json string (as tendermint sends it) or as a number
+type jsonInt64 int64
+
+func (i *jsonInt64) UnmarshalJSON(data []byte) error {
+	value, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s: %v", data, err)
+	}
+
+	*i = jsonInt64(value)
+	return nil
+}
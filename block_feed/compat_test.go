@@ -0,0 +1,69 @@
+package block_feed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFixture(t *testing.T, version string, name string) []byte {
+	fixture, err := os.ReadFile(filepath.Join("testdata", version, name))
+	assert.Nil(t, err)
+	return fixture
+}
+
+func TestResponseShapes(t *testing.T) {
+	for _, version := range []string{"v0.34", "v0.37"} {
+		block, err := ExtractBlockFromRPCResponse(readFixture(t, version, "block.json"))
+		assert.Nil(t, err, version)
+		assert.Equal(t, int64(8000000), block.Block.Height, version)
+		assert.Equal(t, "862FE9B032E68193DD2425F836FF5571D0129762DB1BD159F0DCDE70BC44D67A", block.BlockID.Hash.String(), version)
+
+		// the block decodes into the same thing, hash included
+		assert.Equal(t, block.BlockID.Hash, block.Block.Hash(), version)
+
+		event, err := extractBlockFromWSResponse(readFixture(t, version, "new_block_event.json"))
+		assert.Nil(t, err, version)
+		assert.Equal(t, block.Block.Hash(), event.Block.Hash(), version)
+
+		txs, err := ExtractBlockResultFromRPCResponse(readFixture(t, version, "block_results.json"))
+		assert.Nil(t, err, version)
+		assert.Len(t, txs, 1, version)
+		assert.Equal(t, int64(84321), txs[0].GasUsed, version)
+		assert.Equal(t, "action", string(txs[0].Events[0].Attributes[0].Key), version)
+		assert.Equal(t, "/cosmos.bank.v1beta1.MsgSend", string(txs[0].Events[0].Attributes[0].Value), version)
+
+		results, err := ExtractBlockResultsFromRPCResponse(readFixture(t, version, "block_results.json"))
+		assert.Nil(t, err, version)
+		assert.Equal(t, txs, results.TxsResults, version)
+
+		height, err := ExtractLatestHeightFromRPCResponse(readFixture(t, version, "status.json"))
+		assert.Nil(t, err, version)
+		assert.Equal(t, int64(8000000), height, version)
+	}
+}
+
+func TestResponseShapesNumericHeights(t *testing.T) {
+	// i.e. from a gateway re-encoding responses with plain json
+	message := string(readFixture(t, "v0.37", "block.json"))
+	message = strings.ReplaceAll(message, `"height": "8000000"`, `"height": 8000000`)
+	message = strings.ReplaceAll(message, `"height": "7999999"`, `"height": 7999999`)
+	message = strings.ReplaceAll(message, `"round": 0`, `"round": "0"`)
+
+	block, err := ExtractBlockFromRPCResponse([]byte(message))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8000000), block.Block.Height)
+	assert.Equal(t, int64(7999999), block.Block.LastCommit.Height)
+	assert.Equal(t, block.BlockID.Hash, block.Block.Hash())
+
+	height, err := ExtractLatestHeightFromRPCResponse([]byte(`{"result":{"sync_info":{"latest_block_height":42}}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), height)
+
+	// garbage is still an error
+	_, err = ExtractBlockFromRPCResponse([]byte(`{"result":{"block":{"header":{"height":"tall"}}}}`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,124 @@
+package block_feed
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression of rpc responses requested from upstream
+const (
+	// CompressionNone asks for plain responses; for local upstreams where cpu is more precious than bandwidth
+	CompressionNone = "none"
+
+	// CompressionGzip asks for gzip, which tendermint rpc supports out of the box
+	CompressionGzip = "gzip"
+
+	// CompressionZstd asks for zstd, falling back to gzip; useful behind a proxy that speaks zstd
+	CompressionZstd = "zstd"
+)
+
+// TransferStats counts bytes received from upstream, as sent over the wire and once decompressed
+type TransferStats struct {
+	Received     uint64 `json:"received"`
+	Uncompressed uint64 `json:"uncompressed"`
+}
+
+func (ts TransferStats) String() string {
+	if ts.Uncompressed == 0 {
+		return "no bytes received"
+	}
+	return fmt.Sprintf(
+		"%d bytes received, %d uncompressed (%.1f%% saved)",
+		ts.Received, ts.Uncompressed, 100-float64(ts.Received)*100/float64(ts.Uncompressed),
+	)
+}
+
+func (ts TransferStats) since(earlier TransferStats) TransferStats {
+	return TransferStats{
+		Received:     ts.Received - earlier.Received,
+		Uncompressed: ts.Uncompressed - earlier.Uncompressed,
+	}
+}
+
+func acceptEncoding(compression string) (string, error) {
+	switch compression {
+	case CompressionNone:
+		// explicitly, or net/http asks for gzip on its own
+		return "identity", nil
+	case CompressionGzip, "":
+		return "gzip", nil
+	case CompressionZstd:
+		return "zstd, gzip", nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q, expected %s, %s or %s", compression, CompressionNone, CompressionGzip, CompressionZstd)
+	}
+}
+
+// decodeResponse replaces res.Body with a decompressing reader, counting bytes in stats
+func decodeResponse(res *http.Response, stats *TransferStats) error {
+	body := res.Body
+	received := &countingReader{r: body, n: &stats.Received}
+	closers := []io.Closer{body}
+
+	var decoded io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		decoded = received
+	case "gzip":
+		gzipReader, err := gzip.NewReader(received)
+		if err != nil {
+			return fmt.Errorf("invalid gzip response, %v", err)
+		}
+		decoded = gzipReader
+	case "zstd":
+		zstdReader, err := zstd.NewReader(received, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("invalid zstd response, %v", err)
+		}
+		decoded = zstdReader
+		closers = append([]io.Closer{zstdReader.IOReadCloser()}, closers...)
+	default:
+		return fmt.Errorf("unsupported response encoding %q", encoding)
+	}
+
+	res.Body = &decodedBody{
+		Reader:  &countingReader{r: decoded, n: &stats.Uncompressed},
+		closers: closers,
+	}
+	res.Header.Del("Content-Encoding")
+	res.ContentLength = -1
+
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddUint64(cr.n, uint64(n))
+	return n, err
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (db *decodedBody) Close() error {
+	var firstErr error
+	for _, closer := range db.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
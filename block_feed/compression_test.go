@@ -0,0 +1,74 @@
+package block_feed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCSubscriptionCompression(t *testing.T) {
+	var acceptedEncodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		accepted := request.Header.Get("Accept-Encoding")
+		acceptedEncodings = append(acceptedEncodings, accepted)
+		body := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":%s}`, testBlockJSON(t, 5)))
+
+		compressed := new(bytes.Buffer)
+		switch {
+		case strings.HasPrefix(accepted, "zstd"):
+			encoder, _ := zstd.NewWriter(compressed)
+			_, _ = encoder.Write(body)
+			_ = encoder.Close()
+			writer.Header().Set("Content-Encoding", "zstd")
+		case accepted == "gzip":
+			encoder := gzip.NewWriter(compressed)
+			_, _ = encoder.Write(body)
+			_ = encoder.Close()
+			writer.Header().Set("Content-Encoding", "gzip")
+		default:
+			compressed.Write(body)
+		}
+		_, _ = writer.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+
+	for _, compression := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		rpc, err := NewRpcSubscription([]string{server.URL}, &RPCSubscriptionConfig{
+			Cooldown:        time.Millisecond,
+			PrefetchWindow:  1,
+			PrefetchWorkers: 1,
+			RequestTimeout:  time.Second,
+			Compression:     compression,
+		})
+		assert.Nil(t, err)
+
+		block, err := rpc.FetchBlock(5)
+		assert.Nil(t, err, compression)
+		assert.Equal(t, int64(5), block.Block.Height)
+
+		stats := rpc.TransferStats()
+		assert.NotZero(t, stats.Uncompressed)
+		if compression == CompressionNone {
+			assert.Equal(t, stats.Uncompressed, stats.Received)
+		} else {
+			assert.Less(t, stats.Received, stats.Uncompressed, compression)
+		}
+	}
+	assert.Equal(t, []string{"identity", "gzip", "zstd, gzip"}, acceptedEncodings)
+
+	_, err := NewRpcSubscription([]string{server.URL}, &RPCSubscriptionConfig{
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+		RequestTimeout:  time.Second,
+		Compression:     "brotli",
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,49 @@
+package block_feed
+
+import (
+	"bytes"
+)
+
+// size of the dedup window, in heights
+const dedupWindowSize = 64
+
+// dedupWindow remembers hashes of the most recently delivered heights,
+// so that a copy of a block delivered by another source can be told apart
+// from a different block at the same height.
+type dedupWindow struct {
+	size   int64
+	hashes map[int64][]byte
+}
+
+func newDedupWindow(size int64) *dedupWindow {
+	return &dedupWindow{
+		size:   size,
+		hashes: make(map[int64][]byte),
+	}
+}
+
+// add records the hash of a delivered block, and forgets heights that fell out of the window
+func (w *dedupWindow) add(height int64, hash []byte) {
+	w.hashes[height] = hash
+	delete(w.hashes, height-w.size)
+}
+
+// isCopy tells whether a block at an already delivered height is the same block.
+// known is false if the height is out of the window.
+func (w *dedupWindow) isCopy(height int64, hash []byte) (isCopy bool, known bool) {
+	delivered, known := w.hashes[height]
+	if !known {
+		return false, false
+	}
+
+	return bytes.Equal(delivered, hash), true
+}
+
+func blockHash(block *BlockResult) []byte {
+	if block.BlockID != nil && len(block.BlockID.Hash) > 0 {
+		return block.BlockID.Hash
+	}
+
+	// live blocks from the websocket come without a block id
+	return block.Block.Hash()
+}
@@ -0,0 +1,26 @@
+package block_feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupWindow(t *testing.T) {
+	w := newDedupWindow(3)
+	for height := int64(1); height <= 5; height++ {
+		w.add(height, []byte{byte(height)})
+	}
+
+	isCopy, known := w.isCopy(5, []byte{5})
+	assert.True(t, known)
+	assert.True(t, isCopy)
+
+	isCopy, known = w.isCopy(4, []byte{5})
+	assert.True(t, known)
+	assert.False(t, isCopy)
+
+	// out of the window
+	_, known = w.isCopy(2, []byte{2})
+	assert.False(t, known)
+}
@@ -0,0 +1,75 @@
+package block_feed
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// permanentError marks a failure that no amount of retrying fixes,
+// i.e. the upstream has pruned the block being asked for.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent tells whether err is not worth retrying against the same upstreams.
+// Anything else (timeouts, refused connections, 5xx) is considered transient.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// isUnavailableHeight tells whether an upstream error message says the height is
+// below what the node keeps, i.e. "height 100 is not available, lowest height is 5000"
+// from a pruned tendermint node. Heights above the tip are transient on the other hand.
+func isUnavailableHeight(message string) bool {
+	return strings.Contains(message, "is not available")
+}
+
+// classifyHTTPError marks err as permanent if the rpc response says so.
+// 5xx and 429 are transient, unless the body tells the block is pruned;
+// any other 4xx (i.e. 404 from a proxy in front of a pruned node) is permanent.
+func classifyHTTPError(statusCode int, message string, err error) error {
+	switch {
+	case isUnavailableHeight(message):
+		return permanent(err)
+	case statusCode >= 500 || statusCode == http.StatusTooManyRequests:
+		return err
+	case statusCode >= 400:
+		return permanent(err)
+	default:
+		return err
+	}
+}
+
+// classifyGRPCError marks err as permanent if the grpc status says so
+func classifyGRPCError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch {
+	case isUnavailableHeight(s.Message()):
+		return permanent(err)
+	case s.Code() == codes.NotFound || s.Code() == codes.Unimplemented:
+		return permanent(err)
+	default:
+		return err
+	}
+}
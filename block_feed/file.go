@@ -0,0 +1,295 @@
+package block_feed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+var _ BlockFeed = (*FileBlockFeed)(nil)
+
+// FileBlockFeed feeds blocks from an archive directory. Supported file layouts are:
+//   - {height}.json: a single block, json encoded in the same shape as rpc's /block result
+//   - {height}.pb: a single block, protobuf encoded tendermint.types.Block
+//   - {from}-{to}.jsonl: blocks from `from` to `to`, one json encoded block per line
+type FileBlockFeed struct {
+	dir     string
+	entries []archiveEntry
+	c       chan *BlockResult
+	err     error
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+type archiveEntry struct {
+	path string
+	from int64
+	to   int64
+}
+
+func NewFileBlockFeed(dir string) (*FileBlockFeed, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block archive %s: %v", dir, err)
+	}
+
+	var entries []archiveEntry
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		entry, ok, err := parseArchiveEntry(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		} else if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].from < entries[j].from
+	})
+
+	// heights must be contiguous across files
+	for i := 1; i < len(entries); i++ {
+		if entries[i].from != entries[i-1].to+1 {
+			return nil, fmt.Errorf("block archive is not contiguous: %s ends at %d, but %s starts at %d",
+				entries[i-1].path, entries[i-1].to, entries[i].path, entries[i].from)
+		}
+	}
+
+	return &FileBlockFeed{
+		dir:     dir,
+		entries: entries,
+		c:       make(chan *BlockResult),
+		err:     nil,
+		closing: make(chan struct{}),
+	}, nil
+}
+
+func parseArchiveEntry(path string) (archiveEntry, bool, error) {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	switch ext {
+	case ".json", ".pb":
+		height, err := strconv.ParseInt(base, 10, 64)
+		if err != nil {
+			return archiveEntry{}, false, fmt.Errorf("invalid block archive file name %s", path)
+		}
+		return archiveEntry{path: path, from: height, to: height}, true, nil
+	case ".jsonl":
+		bounds := strings.SplitN(base, "-", 2)
+		if len(bounds) != 2 {
+			return archiveEntry{}, false, fmt.Errorf("invalid block archive file name %s", path)
+		}
+		from, fromErr := strconv.ParseInt(bounds[0], 10, 64)
+		to, toErr := strconv.ParseInt(bounds[1], 10, 64)
+		if fromErr != nil || toErr != nil || from > to {
+			return archiveEntry{}, false, fmt.Errorf("invalid block archive file name %s", path)
+		}
+		return archiveEntry{path: path, from: from, to: to}, true, nil
+	default:
+		// not a part of the archive
+		return archiveEntry{}, false, nil
+	}
+}
+
+func (fb *FileBlockFeed) Name() string {
+	return fmt.Sprintf("block archive %s", fb.dir)
+}
+
+// Base returns the first height in the archive, or 0 if the archive is empty
+func (fb *FileBlockFeed) Base() int64 {
+	if len(fb.entries) == 0 {
+		return 0
+	}
+	return fb.entries[0].from
+}
+
+// Height returns the last height in the archive, or 0 if the archive is empty
+func (fb *FileBlockFeed) Height() int64 {
+	if len(fb.entries) == 0 {
+		return 0
+	}
+	return fb.entries[len(fb.entries)-1].to
+}
+
+// FetchBlocks reads blocks from `from` to `to` (inclusive) in order, and calls emit for each block
+func (fb *FileBlockFeed) FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error {
+	expected := from
+	for _, entry := range fb.entries {
+		if entry.to < from || entry.from > to {
+			continue
+		}
+
+		blocks, err := readArchiveEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			height := block.Block.Height
+			if height < expected || height > to {
+				continue
+			}
+			if height != expected {
+				return fmt.Errorf("%s: expected block %d, got %d", entry.path, expected, height)
+			}
+
+			if err := emit(block); err != nil {
+				return err
+			}
+			expected++
+		}
+	}
+
+	if expected <= to {
+		return fmt.Errorf("block %d not found in %s", expected, fb.Name())
+	}
+
+	return nil
+}
+
+func readArchiveEntry(entry archiveEntry) ([]*BlockResult, error) {
+	data, err := ioutil.ReadFile(entry.path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", entry.path, err)
+	}
+
+	switch filepath.Ext(entry.path) {
+	case ".json":
+		block, err := decodeJSONBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: corrupt block %d: %v", entry.path, entry.from, err)
+		}
+		return []*BlockResult{block}, nil
+
+	case ".pb":
+		block, err := decodeProtoBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: corrupt block %d: %v", entry.path, entry.from, err)
+		}
+		return []*BlockResult{block}, nil
+
+	default:
+		var blocks []*BlockResult
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		height := entry.from
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			block, err := decodeJSONBlock(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: corrupt block %d: %v", entry.path, height, err)
+			}
+			blocks = append(blocks, block)
+			height++
+		}
+		if height != entry.to+1 {
+			return nil, fmt.Errorf("%s: truncated, expected blocks up to %d, got up to %d", entry.path, entry.to, height-1)
+		}
+		return blocks, nil
+	}
+}
+
+func decodeJSONBlock(data []byte) (*BlockResult, error) {
+	block := new(BlockResult)
+	if err := tmjson.Unmarshal(data, block); err != nil {
+		return nil, err
+	}
+	if block.Block == nil {
+		return nil, fmt.Errorf("missing block")
+	}
+	if block.BlockID == nil {
+		block.BlockID = makeBlockID(block.Block)
+	}
+
+	return block, nil
+}
+
+func decodeProtoBlock(data []byte) (*BlockResult, error) {
+	pb := new(tmproto.Block)
+	if err := pb.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	block, err := tendermint.BlockFromProto(pb)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockResult{
+		BlockID: makeBlockID(block),
+		Block:   block,
+	}, nil
+}
+
+func makeBlockID(block *tendermint.Block) *tendermint.BlockID {
+	return &tendermint.BlockID{
+		Hash:          block.Hash(),
+		PartSetHeader: block.MakePartSet(tendermint.BlockPartSizeBytes).Header(),
+	}
+}
+
+// Subscribe feeds blocks from fromHeight up to the end of the archive.
+// The channel receives nil once the archive is exhausted, or upon an error; see Err().
+func (fb *FileBlockFeed) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	if len(fb.entries) == 0 {
+		return nil, fmt.Errorf("%s is empty", fb.Name())
+	}
+	if fromHeight < fb.Base() || fromHeight > fb.Height() {
+		return nil, fmt.Errorf("%s covers %d..%d, cannot feed from %d", fb.Name(), fb.Base(), fb.Height(), fromHeight)
+	}
+
+	go func() {
+		log.Printf("[block_feed/file] subscription started, from=%d, to=%d\n", fromHeight, fb.Height())
+		if err := fb.FetchBlocks(fromHeight, fb.Height(), fb.send); err != nil {
+			log.Printf("[block_feed/file] %v\n", err)
+			fb.err = err
+		}
+
+		_ = fb.send(nil)
+	}()
+
+	return fb.c, nil
+}
+
+// Err returns the error that stopped the subscription, if any
+func (fb *FileBlockFeed) Err() error {
+	return fb.err
+}
+
+func (fb *FileBlockFeed) send(block *BlockResult) error {
+	select {
+	case fb.c <- block:
+		return nil
+	case <-fb.closing:
+		return ErrFeedClosed
+	}
+}
+
+func (fb *FileBlockFeed) Close(_ context.Context) error {
+	fb.closeOnce.Do(func() {
+		close(fb.closing)
+	})
+	return nil
+}
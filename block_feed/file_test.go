@@ -0,0 +1,78 @@
+package block_feed
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestArchive(t *testing.T, dir string, from int64, to int64, chunked bool) {
+	if !chunked {
+		for height := from; height <= to; height++ {
+			path := filepath.Join(dir, fmt.Sprintf("%d.json", height))
+			assert.Nil(t, ioutil.WriteFile(path, testBlockJSON(t, height), 0644))
+		}
+		return
+	}
+
+	var lines [][]byte
+	for height := from; height <= to; height++ {
+		lines = append(lines, testBlockJSON(t, height))
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d-%d.jsonl", from, to))
+	assert.Nil(t, ioutil.WriteFile(path, bytes.Join(lines, []byte("\n")), 0644))
+}
+
+func TestFileBlockFeed(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir, 1, 10, true)
+	writeTestArchive(t, dir, 11, 13, false)
+	writeTestArchive(t, dir, 14, 20, true)
+
+	feed, err := NewFileBlockFeed(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), feed.Base())
+	assert.Equal(t, int64(20), feed.Height())
+
+	c, err := feed.Subscribe(5)
+	assert.Nil(t, err)
+	for expected := int64(5); expected <= 20; expected++ {
+		block := <-c
+		assert.Equal(t, expected, block.Block.Height)
+	}
+
+	// exhausted
+	assert.Nil(t, <-c)
+	assert.Nil(t, feed.Err())
+}
+
+func TestFileBlockFeedNotContiguous(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir, 1, 10, true)
+	writeTestArchive(t, dir, 12, 13, false)
+
+	_, err := NewFileBlockFeed(dir)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not contiguous")
+}
+
+func TestFileBlockFeedCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir, 1, 3, false)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "4.json"), []byte(`{"block":`), 0644))
+
+	feed, err := NewFileBlockFeed(dir)
+	assert.Nil(t, err)
+
+	c, err := feed.Subscribe(1)
+	assert.Nil(t, err)
+	for expected := int64(1); expected <= 3; expected++ {
+		assert.Equal(t, expected, (<-c).Block.Height)
+	}
+	assert.Nil(t, <-c)
+	assert.Contains(t, feed.Err().Error(), "4.json: corrupt block 4")
+}
@@ -0,0 +1,266 @@
+package block_feed
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var _ BlockFeed = (*GRPCSubscription)(nil)
+
+// DefaultGRPCStreamMethod is the server-streaming method subscribed for live blocks.
+// It takes a cosmos.base.tendermint.v1beta1.GetBlockByHeightRequest with the first height to stream,
+// and streams cosmos.base.tendermint.v1beta1.GetBlockByHeightResponse for that height onwards.
+const DefaultGRPCStreamMethod = "/mantlemint.blockfeed.v1.BlockFeed/StreamBlocks"
+
+// GRPCTLSConfig configures the transport security of the grpc block feed
+type GRPCTLSConfig struct {
+	// Enabled turns on TLS; the connection is plaintext otherwise
+	Enabled bool
+
+	// CAFile optionally points to a PEM encoded CA bundle to verify the server with,
+	// instead of the system roots
+	CAFile string
+
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool
+}
+
+// GRPCSubscription feeds blocks from a grpc endpoint. Historical blocks are fetched with
+// unary calls to cosmos.base.tendermint.v1beta1.Service/GetBlockByHeight, and live blocks
+// are received over a server-streaming call (see DefaultGRPCStreamMethod).
+type GRPCSubscription struct {
+	endpoint     string
+	conn         *grpc.ClientConn
+	client       tmservice.ServiceClient
+	streamMethod string
+	timeout      time.Duration
+
+	// cancels the running stream, if any
+	cancelStream context.CancelFunc
+
+	// cancelled on Close, aborting in-flight calls
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewGRPCSubscription(endpoint string, tlsConfig *GRPCTLSConfig, streamMethod string, requestTimeout time.Duration) (*GRPCSubscription, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("no grpc endpoint given")
+	}
+	if requestTimeout <= 0 {
+		return nil, fmt.Errorf("invalid request timeout(%s)", requestTimeout)
+	}
+	if streamMethod == "" {
+		streamMethod = DefaultGRPCStreamMethod
+	}
+
+	transportCredentials, err := grpcTransportCredentials(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// tendermint types are gogoproto generated, hence the sdk codec
+	conn, err := grpc.Dial(
+		endpoint,
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithDefaultCallOptions(
+			grpc.ForceCodec(codec.NewProtoCodec(codectypes.NewInterfaceRegistry()).GRPCCodec()),
+			grpc.MaxCallRecvMsgSize(64*1024*1024),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial grpc endpoint %s: %v", endpoint, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &GRPCSubscription{
+		ctx:          ctx,
+		cancel:       cancel,
+		endpoint:     endpoint,
+		conn:         conn,
+		client:       tmservice.NewServiceClient(conn),
+		streamMethod: streamMethod,
+		timeout:      requestTimeout,
+	}, nil
+}
+
+func grpcTransportCredentials(tlsConfig *GRPCTLSConfig) (credentials.TransportCredentials, error) {
+	if tlsConfig == nil || !tlsConfig.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
+	}
+
+	if tlsConfig.CAFile != "" {
+		pem, err := ioutil.ReadFile(tlsConfig.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read grpc CA file %s: %v", tlsConfig.CAFile, err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in grpc CA file %s", tlsConfig.CAFile)
+		}
+	}
+
+	return credentials.NewTLS(config), nil
+}
+
+func (gs *GRPCSubscription) Name() string {
+	return fmt.Sprintf("grpc %s", gs.endpoint)
+}
+
+// LatestHeight returns the height of the latest block of the upstream
+func (gs *GRPCSubscription) LatestHeight() (int64, error) {
+	ctx, cancel := context.WithTimeout(gs.ctx, gs.timeout)
+	defer cancel()
+
+	res, err := gs.client.GetLatestBlock(ctx, &tmservice.GetLatestBlockRequest{})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", gs.Name(), err)
+	}
+
+	block, err := blockResultFromProto(res.BlockId, res.Block)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", gs.Name(), err)
+	}
+
+	return block.Block.Height, nil
+}
+
+// FetchBlock fetches a single block at the given height
+func (gs *GRPCSubscription) FetchBlock(height int64) (*BlockResult, error) {
+	ctx, cancel := context.WithTimeout(gs.ctx, gs.timeout)
+	defer cancel()
+
+	res, err := gs.client.GetBlockByHeight(ctx, &tmservice.GetBlockByHeightRequest{Height: height})
+	if err != nil {
+		return nil, fmt.Errorf("%s: block(%d): %w", gs.Name(), height, classifyGRPCError(err))
+	}
+
+	block, err := blockResultFromProto(res.BlockId, res.Block)
+	if err != nil {
+		return nil, fmt.Errorf("%s: block(%d): %v", gs.Name(), height, err)
+	}
+	if block.Block.Height != height {
+		return nil, fmt.Errorf("%s: expected block %d, got %d", gs.Name(), height, block.Block.Height)
+	}
+
+	block.source = gs.endpoint
+	return block, nil
+}
+
+// FetchBlocks fetches blocks from `from` to `to` (inclusive) in order, and calls emit for each block
+func (gs *GRPCSubscription) FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error {
+	for height := from; height <= to; height++ {
+		block, err := gs.FetchBlock(height)
+		if err != nil {
+			return err
+		}
+		if err := emit(block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe opens the block stream, starting at fromHeight (or wherever the server sees fit, if 0).
+// The channel receives nil once the stream ends for whatever reason, and is closed right after.
+func (gs *GRPCSubscription) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	ctx, cancel := context.WithCancel(gs.ctx)
+	stream, err := gs.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, gs.streamMethod)
+	if err == nil {
+		err = stream.SendMsg(&tmservice.GetBlockByHeightRequest{Height: fromHeight})
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: failed to open block stream: %v", gs.Name(), err)
+	}
+
+	gs.cancelStream = cancel
+	c := make(chan *BlockResult)
+
+	go func() {
+		defer cancel()
+		defer close(c)
+		log.Printf("[block_feed/grpc] subscription started, from=%d\n", fromHeight)
+
+		for {
+			res := new(tmservice.GetBlockByHeightResponse)
+			if err := stream.RecvMsg(res); err != nil {
+				log.Printf("[block_feed/grpc] stream closed: %v\n", err)
+				break
+			}
+
+			block, err := blockResultFromProto(res.BlockId, res.Block)
+			if err != nil {
+				log.Printf("[block_feed/grpc] invalid block received: %v\n", err)
+				break
+			}
+			block.source = gs.endpoint
+
+			c <- block
+		}
+
+		c <- nil
+	}()
+
+	return c, nil
+}
+
+// CloseStream stops the running block stream, leaving the connection open for unary calls
+func (gs *GRPCSubscription) CloseStream() {
+	if gs.cancelStream != nil {
+		gs.cancelStream()
+	}
+}
+
+// Close aborts in-flight calls and the stream; the subscription is not usable afterwards
+func (gs *GRPCSubscription) Close(_ context.Context) error {
+	gs.cancel()
+	return gs.conn.Close()
+}
+
+func blockResultFromProto(pbBlockID *tmproto.BlockID, pbBlock *tmproto.Block) (*BlockResult, error) {
+	if pbBlock == nil {
+		return nil, fmt.Errorf("missing block")
+	}
+
+	block, err := tendermint.BlockFromProto(pbBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	if pbBlockID == nil {
+		return &BlockResult{BlockID: makeBlockID(block), Block: block}, nil
+	}
+
+	blockID, err := tendermint.BlockIDFromProto(pbBlockID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockResult{BlockID: blockID, Block: block}, nil
+}
@@ -0,0 +1,159 @@
+package block_feed
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/client/grpc/tmservice"
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"github.com/stretchr/testify/assert"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	"google.golang.org/grpc"
+)
+
+func testProtoBlock(t *testing.T, height int64) *tmproto.Block {
+	lastCommit := &tendermint.Commit{
+		Height:     height - 1,
+		BlockID:    tendermint.BlockID{Hash: make([]byte, 32)},
+		Signatures: []tendermint.CommitSig{tendermint.NewCommitSigAbsent()},
+	}
+	block := tendermint.MakeBlock(height, nil, lastCommit, nil)
+	block.ProposerAddress = make([]byte, 20)
+
+	pb, err := block.ToProto()
+	assert.Nil(t, err)
+	return pb
+}
+
+type testGRPCUpstream struct {
+	tmservice.UnimplementedServiceServer
+	t      *testing.T
+	tip    int64
+	stream []int64
+}
+
+func (up *testGRPCUpstream) GetLatestBlock(context.Context, *tmservice.GetLatestBlockRequest) (*tmservice.GetLatestBlockResponse, error) {
+	return &tmservice.GetLatestBlockResponse{Block: testProtoBlock(up.t, up.tip)}, nil
+}
+
+func (up *testGRPCUpstream) GetBlockByHeight(_ context.Context, req *tmservice.GetBlockByHeightRequest) (*tmservice.GetBlockByHeightResponse, error) {
+	return &tmservice.GetBlockByHeightResponse{Block: testProtoBlock(up.t, req.Height)}, nil
+}
+
+func (up *testGRPCUpstream) streamBlocks(_ interface{}, stream grpc.ServerStream) error {
+	req := new(tmservice.GetBlockByHeightRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	for _, height := range up.stream {
+		if err := stream.SendMsg(&tmservice.GetBlockByHeightResponse{Block: testProtoBlock(up.t, height)}); err != nil {
+			return err
+		}
+	}
+
+	// hold the stream open
+	<-stream.Context().Done()
+	return nil
+}
+
+// newTestGRPCUpstream serves GetLatestBlock (reporting tip), GetBlockByHeight and
+// a block stream pushing streamHeights
+func newTestGRPCUpstream(t *testing.T, tip int64, streamHeights []int64) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	upstream := &testGRPCUpstream{t: t, tip: tip, stream: streamHeights}
+	server := grpc.NewServer(grpc.ForceServerCodec(codec.NewProtoCodec(codectypes.NewInterfaceRegistry()).GRPCCodec()))
+	tmservice.RegisterServiceServer(server, upstream)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "mantlemint.blockfeed.v1.BlockFeed",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "StreamBlocks",
+			Handler:       upstream.streamBlocks,
+			ServerStreams: true,
+		}},
+	}, upstream)
+
+	go func() { _ = server.Serve(listener) }()
+
+	return listener.Addr().String(), server.Stop
+}
+
+func TestGRPCSubscription(t *testing.T) {
+	endpoint, stop := newTestGRPCUpstream(t, 42, []int64{43, 44})
+	defer stop()
+
+	feed, err := NewGRPCSubscription(endpoint, &GRPCTLSConfig{}, "", time.Second)
+	assert.Nil(t, err)
+	defer feed.Close(context.Background())
+
+	latest, err := feed.LatestHeight()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), latest)
+
+	var heights []int64
+	assert.Nil(t, feed.FetchBlocks(5, 7, func(block *BlockResult) error {
+		assert.NotNil(t, block.BlockID)
+		heights = append(heights, block.Block.Height)
+		return nil
+	}))
+	assert.Equal(t, []int64{5, 6, 7}, heights)
+
+	c, err := feed.Subscribe(43)
+	assert.Nil(t, err)
+	for _, expected := range []int64{43, 44} {
+		select {
+		case block := <-c:
+			assert.Equal(t, expected, block.Block.Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", expected)
+		}
+	}
+
+	// the stream ends with nil once closed
+	feed.CloseStream()
+	assert.Nil(t, <-c)
+}
+
+func TestAggregateSubscriptionGRPC(t *testing.T) {
+	// grpc stream skips 32; rpc/ws are never reached
+	endpoint, stop := newTestGRPCUpstream(t, 30, []int64{30, 31, 33})
+	defer stop()
+
+	feed := NewAggregateBlockFeed(
+		&Checkpoint{Height: 0},
+		[]string{"http://127.0.0.1:1"},
+		[]string{"ws://127.0.0.1:1/websocket"},
+		&AggregateFeedConfig{
+			ReconnectBaseDelay: time.Millisecond,
+			ReconnectMaxDelay:  time.Millisecond,
+			EndpointCooldown:   time.Second,
+			PrefetchWindow:     5,
+			PrefetchWorkers:    2,
+			PollInterval:       time.Second,
+			RequestTimeout:     time.Second,
+			GRPCEndpoint:       endpoint,
+		},
+	)
+
+	c, err := feed.Subscribe(11)
+	assert.Nil(t, err)
+
+	for expected := int64(11); expected <= 33; expected++ {
+		select {
+		case block := <-c:
+			assert.Equal(t, expected, block.Block.Height)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for block %d", expected)
+		}
+	}
+
+	gaps, blocks := feed.GapCount()
+	assert.Equal(t, uint64(1), gaps)
+	assert.Equal(t, uint64(1), blocks)
+}
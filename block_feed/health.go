@@ -0,0 +1,243 @@
+package block_feed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EndpointStatus is a snapshot of an upstream endpoint's health
+type EndpointStatus struct {
+	Endpoint            string        `json:"endpoint"`
+	Healthy             bool          `json:"healthy"`
+	Active              bool          `json:"active"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Latency             time.Duration `json:"latency"`
+	LastSuccess         time.Time     `json:"last_success"`
+	LastError           string        `json:"last_error"`
+	Pinned              bool          `json:"pinned"`
+	Excluded            bool          `json:"excluded"`
+}
+
+type endpointHealth struct {
+	endpoint            string
+	consecutiveFailures int
+	latency             time.Duration
+	lastSuccess         time.Time
+	lastFailure         time.Time
+	lastError           error
+	excluded            bool
+}
+
+// endpointPool tracks health of a list of endpoints, and decides which one to use next.
+// An endpoint is unhealthy right after a failure, and becomes eligible for retry
+// once the cooldown has passed.
+//
+// An operator may pin an endpoint, in which case nothing else is used until unpinned,
+// or exclude endpoints, in which case they are never used until included back.
+type endpointPool struct {
+	mtx       *sync.Mutex
+	endpoints []*endpointHealth
+	active    int
+	pinned    int
+	cooldown  time.Duration
+}
+
+func newEndpointPool(endpoints []string, cooldown time.Duration) *endpointPool {
+	healths := make([]*endpointHealth, len(endpoints))
+	for i, endpoint := range endpoints {
+		healths[i] = &endpointHealth{endpoint: endpoint}
+	}
+
+	return &endpointPool{
+		mtx:       new(sync.Mutex),
+		endpoints: healths,
+		active:    0,
+		pinned:    -1,
+		cooldown:  cooldown,
+	}
+}
+
+func (p *endpointPool) isHealthy(h *endpointHealth, now time.Time) bool {
+	return h.consecutiveFailures == 0 || now.Sub(h.lastFailure) >= p.cooldown
+}
+
+// candidates returns endpoint indices in the order they should be tried:
+// the active endpoint first, followed by healthy ones, followed by the ones cooling down.
+func (p *endpointPool) candidates() []int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.pinned >= 0 {
+		return []int{p.pinned}
+	}
+
+	now := time.Now()
+	healthy := make([]int, 0, len(p.endpoints))
+	cooling := make([]int, 0, len(p.endpoints))
+	for i := 0; i < len(p.endpoints); i++ {
+		idx := (p.active + i) % len(p.endpoints)
+		if p.endpoints[idx].excluded {
+			continue
+		}
+		if p.isHealthy(p.endpoints[idx], now) {
+			healthy = append(healthy, idx)
+		} else {
+			cooling = append(cooling, idx)
+		}
+	}
+
+	return append(healthy, cooling...)
+}
+
+func (p *endpointPool) endpoint(idx int) string {
+	return p.endpoints[idx].endpoint
+}
+
+func (p *endpointPool) reportSuccess(idx int, latency time.Duration) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	h := p.endpoints[idx]
+	h.consecutiveFailures = 0
+	h.latency = latency
+	h.lastSuccess = time.Now()
+	p.active = idx
+}
+
+func (p *endpointPool) reportFailure(idx int, err error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	h := p.endpoints[idx]
+	h.consecutiveFailures++
+	h.lastFailure = time.Now()
+	h.lastError = err
+
+	// rotate away from a failing active endpoint
+	if p.active == idx && p.pinned < 0 {
+		p.active = (idx + 1) % len(p.endpoints)
+	}
+}
+
+// indexOf finds endpoint, given either as configured or as reported by status()
+func (p *endpointPool) indexOf(endpoint string) int {
+	for i, h := range p.endpoints {
+		if h.endpoint == endpoint || RedactEndpoint(h.endpoint) == endpoint {
+			return i
+		}
+	}
+	return -1
+}
+
+// has tells whether the endpoint is a part of the pool
+func (p *endpointPool) has(endpoint string) bool {
+	return p.indexOf(endpoint) >= 0
+}
+
+// pin makes endpoint the only one used, regardless of its health
+func (p *endpointPool) pin(endpoint string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	idx := p.indexOf(endpoint)
+	if idx < 0 {
+		return fmt.Errorf("unknown endpoint %s", endpoint)
+	}
+
+	p.endpoints[idx].excluded = false
+	p.pinned = idx
+	p.active = idx
+	return nil
+}
+
+// unpin goes back to choosing endpoints by health
+func (p *endpointPool) unpin() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.pinned = -1
+}
+
+// exclude stops endpoint from being used; at least one endpoint must be left
+func (p *endpointPool) exclude(endpoint string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	idx := p.indexOf(endpoint)
+	if idx < 0 {
+		return fmt.Errorf("unknown endpoint %s", endpoint)
+	}
+
+	remaining := 0
+	for i, h := range p.endpoints {
+		if i != idx && !h.excluded {
+			remaining++
+		}
+	}
+	if remaining == 0 {
+		return fmt.Errorf("cannot exclude %s, no other endpoint left", endpoint)
+	}
+
+	p.endpoints[idx].excluded = true
+	if p.pinned == idx {
+		p.pinned = -1
+	}
+	if p.active == idx {
+		for i := 1; i < len(p.endpoints); i++ {
+			if next := (idx + i) % len(p.endpoints); !p.endpoints[next].excluded {
+				p.active = next
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// include takes an excluded endpoint back into use
+func (p *endpointPool) include(endpoint string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	idx := p.indexOf(endpoint)
+	if idx < 0 {
+		return fmt.Errorf("unknown endpoint %s", endpoint)
+	}
+
+	p.endpoints[idx].excluded = false
+	return nil
+}
+
+// isPreferred tells whether idx is the endpoint candidates() would start with
+func (p *endpointPool) isPreferred(idx int) bool {
+	candidates := p.candidates()
+	return len(candidates) > 0 && candidates[0] == idx
+}
+
+func (p *endpointPool) status() []EndpointStatus {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := time.Now()
+	statuses := make([]EndpointStatus, len(p.endpoints))
+	for i, h := range p.endpoints {
+		statuses[i] = EndpointStatus{
+			Endpoint:            RedactEndpoint(h.endpoint),
+			Healthy:             p.isHealthy(h, now),
+			Active:              i == p.active,
+			ConsecutiveFailures: h.consecutiveFailures,
+			Latency:             h.latency,
+			LastSuccess:         h.lastSuccess,
+			LastError: func() string {
+				if h.lastError == nil {
+					return ""
+				}
+				return h.lastError.Error()
+			}(),
+			Pinned:   i == p.pinned,
+			Excluded: h.excluded,
+		}
+	}
+
+	return statuses
+}
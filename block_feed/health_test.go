@@ -0,0 +1,58 @@
+package block_feed
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointPool(t *testing.T) {
+	pool := newEndpointPool([]string{"a", "b", "c"}, time.Hour)
+	assert.Equal(t, []int{0, 1, 2}, pool.candidates())
+
+	// failing endpoint is rotated away from, and moved to the back of the line
+	pool.reportFailure(0, errors.New("timeout"))
+	assert.Equal(t, []int{1, 2, 0}, pool.candidates())
+
+	status := pool.status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, "timeout", status[0].LastError)
+	assert.True(t, status[1].Active)
+
+	// success on c makes it active
+	pool.reportSuccess(2, time.Millisecond)
+	assert.Equal(t, []int{2, 1, 0}, pool.candidates())
+
+	// after cooldown, failed endpoint is eligible again
+	pool.cooldown = 0
+	assert.Equal(t, []int{2, 0, 1}, pool.candidates())
+	assert.True(t, pool.status()[0].Healthy)
+}
+
+func TestEndpointPoolPinAndExclude(t *testing.T) {
+	pool := newEndpointPool([]string{"a", "b", "c"}, time.Hour)
+
+	// a pinned endpoint is the only candidate, even when failing
+	assert.Nil(t, pool.pin("b"))
+	pool.reportFailure(1, errors.New("timeout"))
+	assert.Equal(t, []int{1}, pool.candidates())
+	assert.True(t, pool.status()[1].Pinned)
+	assert.True(t, pool.isPreferred(1))
+
+	pool.unpin()
+	assert.Equal(t, []int{2, 0, 1}, pool.candidates())
+
+	// excluded endpoints are never candidates, and the last one can't be excluded
+	assert.Nil(t, pool.exclude("a"))
+	assert.Nil(t, pool.exclude("c"))
+	assert.NotNil(t, pool.exclude("b"))
+	assert.Equal(t, []int{1}, pool.candidates())
+	assert.True(t, pool.status()[0].Excluded)
+
+	assert.Nil(t, pool.include("a"))
+	assert.Equal(t, []int{0, 1}, pool.candidates())
+
+	assert.NotNil(t, pool.pin("unknown"))
+}
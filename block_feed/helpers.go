@@ -1,10 +1,14 @@
 package block_feed
 
 import (
+	"encoding/json"
+	"fmt"
+
 	abci "github.com/tendermint/tendermint/abci/types"
-	tmjson "github.com/tendermint/tendermint/libs/json"
 )
 
+// extractBlockFromWSResponse takes the block out of a NewBlock event; cometbft 0.38 sends
+// the block id along, which ends up in BlockResult.BlockID (nil for older versions)
 func extractBlockFromWSResponse(message []byte) (*BlockResult, error) {
 	data := new(struct {
 		Result struct {
@@ -14,7 +18,7 @@ func extractBlockFromWSResponse(message []byte) (*BlockResult, error) {
 		} `json:"result"`
 	})
 
-	if unmarshalErr := tmjson.Unmarshal(message, data); unmarshalErr != nil {
+	if unmarshalErr := unmarshalCompat(message, data); unmarshalErr != nil {
 		return nil, unmarshalErr
 	}
 
@@ -26,13 +30,34 @@ func ExtractBlockFromRPCResponse(message []byte) (*BlockResult, error) {
 		Result *BlockResult `json:"result"`
 	})
 
-	if err := tmjson.Unmarshal(message, data); err != nil {
+	if err := unmarshalCompat(message, data); err != nil {
 		return nil, err
 	}
 
 	return data.Result, nil
 }
 
+// ExtractErrorFromRPCResponse returns the message (and data, if any) of a json-rpc error response,
+// or an empty string if the response is not an error.
+func ExtractErrorFromRPCResponse(message []byte) string {
+	data := new(struct {
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	})
+
+	if err := json.Unmarshal(message, data); err != nil || data.Error == nil {
+		return ""
+	}
+	if data.Error.Data == "" {
+		return data.Error.Message
+	}
+
+	return fmt.Sprintf("%s: %s", data.Error.Message, data.Error.Data)
+}
+
 func ExtractBlockResultFromRPCResponse(message []byte) ([]abci.ResponseDeliverTx, error) {
 	data := new(struct {
 		Result struct {
@@ -40,9 +65,44 @@ func ExtractBlockResultFromRPCResponse(message []byte) ([]abci.ResponseDeliverTx
 		} `json:"result"`
 	})
 
-	if err := tmjson.Unmarshal(message, data); err != nil {
+	if err := unmarshalCompat(message, data); err != nil {
 		return nil, err
 	}
 
 	return data.Result.TxsResult, nil
 }
+
+// BlockResults are the results of executing a block, as an rpc endpoint reports them on /block_results
+type BlockResults struct {
+	TxsResults       []abci.ResponseDeliverTx `json:"txs_results"`
+	BeginBlockEvents []abci.Event             `json:"begin_block_events"`
+	EndBlockEvents   []abci.Event             `json:"end_block_events"`
+}
+
+func ExtractBlockResultsFromRPCResponse(message []byte) (*BlockResults, error) {
+	data := new(struct {
+		Result *BlockResults `json:"result"`
+	})
+
+	if err := unmarshalCompat(message, data); err != nil {
+		return nil, err
+	}
+
+	return data.Result, nil
+}
+
+func ExtractLatestHeightFromRPCResponse(message []byte) (int64, error) {
+	data := new(struct {
+		Result struct {
+			SyncInfo struct {
+				LatestBlockHeight jsonInt64 `json:"latest_block_height"`
+			} `json:"sync_info"`
+		} `json:"result"`
+	})
+
+	if err := json.Unmarshal(message, data); err != nil {
+		return 0, err
+	}
+
+	return int64(data.Result.SyncInfo.LatestBlockHeight), nil
+}
@@ -0,0 +1,236 @@
+package block_feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var _ BlockFeed = (*ObjectStoreBlockFeed)(nil)
+
+// errObjectNotFound is returned by objectStore.Get for a key that does not exist
+var errObjectNotFound = errors.New("object not found")
+
+// objectStore is the subset of an object storage api the archive feed needs
+type objectStore interface {
+	// List calls fn with every key under prefix
+	List(ctx context.Context, prefix string, fn func(key string)) error
+
+	// Get returns the content of the object at key, or errObjectNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	Close() error
+}
+
+// ObjectStoreConfig points to a block archive in S3 or GCS, where every block is an object
+// named {prefix}{height}.pb holding a protobuf encoded tendermint.types.Block.
+type ObjectStoreConfig struct {
+	// URL of the archive, i.e. s3://bucket/blocks/ or gs://bucket/blocks/
+	URL string
+
+	// Concurrency bounds the number of objects fetched at once
+	Concurrency int
+
+	// S3Region and S3Endpoint (for S3 compatible stores) configure the S3 client.
+	// Credentials are S3AccessKeyID and S3SecretAccessKey if given,
+	// or the default aws chain (environment, shared config, instance role) otherwise.
+	S3Region          string
+	S3Endpoint        string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+
+	// GCSCredentialsFile is a service account key file; application default credentials are used if empty
+	GCSCredentialsFile string
+}
+
+// ObjectStoreBlockFeed feeds blocks from an object store archive, fetching up to Concurrency objects at once.
+// Heights available are listed once on creation; a height missing in between fails the fetch
+// with that exact height. Fetches can start anywhere in the archive, i.e. to resume after a crash.
+type ObjectStoreBlockFeed struct {
+	store       objectStore
+	url         string
+	prefix      string
+	concurrency int
+	base        int64
+	height      int64
+	c           chan *BlockResult
+	err         error
+
+	// cancelled on Close, aborting in-flight requests
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewObjectStoreBlockFeed(config *ObjectStoreConfig) (*ObjectStoreBlockFeed, error) {
+	if config.Concurrency < 1 {
+		return nil, fmt.Errorf("invalid object store concurrency(%d)", config.Concurrency)
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store url %s: %v", config.URL, err)
+	}
+	bucket, prefix := u.Host, strings.TrimPrefix(u.Path, "/")
+
+	var store objectStore
+	switch u.Scheme {
+	case "s3":
+		store, err = newS3ObjectStore(bucket, config)
+	case "gs":
+		store, err = newGCSObjectStore(bucket, config)
+	default:
+		err = fmt.Errorf("unsupported object store url %s, expected s3://bucket/prefix or gs://bucket/prefix", config.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newObjectStoreBlockFeed(store, config.URL, prefix, config.Concurrency)
+}
+
+func newObjectStoreBlockFeed(store objectStore, url string, prefix string, concurrency int) (*ObjectStoreBlockFeed, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	feed := &ObjectStoreBlockFeed{
+		store:       store,
+		url:         url,
+		prefix:      prefix,
+		concurrency: concurrency,
+		c:           make(chan *BlockResult),
+		ctx:         ctx,
+		cancel:      cancel,
+		closing:     make(chan struct{}),
+	}
+
+	// only the bounds are kept; a gap is reported once it's reached
+	count := int64(0)
+	if err := store.List(ctx, prefix, func(key string) {
+		height, ok := feed.parseKey(key)
+		if !ok {
+			return
+		}
+		if count == 0 || height < feed.base {
+			feed.base = height
+		}
+		if height > feed.height {
+			feed.height = height
+		}
+		count++
+	}); err != nil {
+		cancel()
+		_ = store.Close()
+		return nil, fmt.Errorf("failed to list %s: %v", url, err)
+	}
+
+	if count > 0 && count != feed.height-feed.base+1 {
+		log.Printf("[block_feed/objectstore] %s has %d blocks between %d and %d, some are missing\n", url, count, feed.base, feed.height)
+	}
+
+	return feed, nil
+}
+
+func (ob *ObjectStoreBlockFeed) parseKey(key string) (int64, bool) {
+	name := strings.TrimPrefix(key, ob.prefix)
+	if !strings.HasSuffix(name, ".pb") || strings.Contains(name, "/") {
+		return 0, false
+	}
+
+	height, err := strconv.ParseInt(strings.TrimSuffix(name, ".pb"), 10, 64)
+	return height, err == nil && height > 0
+}
+
+func (ob *ObjectStoreBlockFeed) key(height int64) string {
+	return fmt.Sprintf("%s%d.pb", ob.prefix, height)
+}
+
+func (ob *ObjectStoreBlockFeed) Name() string {
+	return fmt.Sprintf("block archive %s", ob.url)
+}
+
+// Base returns the first height in the archive, or 0 if the archive is empty
+func (ob *ObjectStoreBlockFeed) Base() int64 {
+	return ob.base
+}
+
+// Height returns the last height in the archive, or 0 if the archive is empty
+func (ob *ObjectStoreBlockFeed) Height() int64 {
+	return ob.height
+}
+
+// FetchBlock fetches and decodes the block at height
+func (ob *ObjectStoreBlockFeed) FetchBlock(height int64) (*BlockResult, error) {
+	key := ob.key(height)
+	data, err := ob.store.Get(ob.ctx, key)
+	if errors.Is(err, errObjectNotFound) {
+		return nil, fmt.Errorf("block %d is missing from %s (%s)", height, ob.Name(), key)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+
+	block, err := decodeProtoBlock(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: corrupt block %d: %v", key, height, err)
+	}
+
+	return block, nil
+}
+
+// FetchBlocks fetches blocks from `from` to `to` (inclusive) concurrently, and calls emit for each block in order
+func (ob *ObjectStoreBlockFeed) FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error {
+	return prefetchInOrder(from, to, 2*ob.concurrency, ob.concurrency, ob.FetchBlock, emit)
+}
+
+// Subscribe feeds blocks from fromHeight up to the end of the archive.
+// The channel receives nil once the archive is exhausted, or upon an error; see Err().
+func (ob *ObjectStoreBlockFeed) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	if ob.height == 0 {
+		return nil, fmt.Errorf("%s is empty", ob.Name())
+	}
+	if fromHeight < ob.base || fromHeight > ob.height {
+		return nil, fmt.Errorf("%s covers %d..%d, cannot feed from %d", ob.Name(), ob.base, ob.height, fromHeight)
+	}
+
+	go func() {
+		log.Printf("[block_feed/objectstore] subscription started, from=%d, to=%d\n", fromHeight, ob.height)
+		if err := ob.FetchBlocks(fromHeight, ob.height, ob.send); err != nil {
+			log.Printf("[block_feed/objectstore] %v\n", err)
+			ob.err = err
+		}
+
+		_ = ob.send(nil)
+	}()
+
+	return ob.c, nil
+}
+
+// Err returns the error that stopped the subscription, if any
+func (ob *ObjectStoreBlockFeed) Err() error {
+	return ob.err
+}
+
+func (ob *ObjectStoreBlockFeed) send(block *BlockResult) error {
+	select {
+	case ob.c <- block:
+		return nil
+	case <-ob.closing:
+		return ErrFeedClosed
+	}
+}
+
+// Close aborts in-flight requests; the feed is not usable afterwards
+func (ob *ObjectStoreBlockFeed) Close(_ context.Context) error {
+	var err error
+	ob.closeOnce.Do(func() {
+		close(ob.closing)
+		ob.cancel()
+		err = ob.store.Close()
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package block_feed
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+type s3ObjectStore struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3ObjectStore(bucket string, config *ObjectStoreConfig) (objectStore, error) {
+	awsConfig := aws.NewConfig()
+	if config.S3Region != "" {
+		awsConfig = awsConfig.WithRegion(config.S3Region)
+	}
+	if config.S3Endpoint != "" {
+		// S3 compatible stores rarely support virtual hosted buckets
+		awsConfig = awsConfig.WithEndpoint(config.S3Endpoint).WithS3ForcePathStyle(true)
+	}
+	if config.S3AccessKeyID != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.S3AccessKeyID, config.S3SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3ObjectStore{client: s3.New(sess), bucket: bucket}, nil
+}
+
+func (s *s3ObjectStore) List(ctx context.Context, prefix string, fn func(key string)) error {
+	return s.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, object := range page.Contents {
+			fn(aws.StringValue(object.Key))
+		}
+		return true
+	})
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, errObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return ioutil.ReadAll(out.Body)
+}
+
+func (s *s3ObjectStore) Close() error {
+	return nil
+}
+
+type gcsObjectStore struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+}
+
+func newGCSObjectStore(bucket string, config *ObjectStoreConfig) (objectStore, error) {
+	var opts []option.ClientOption
+	if config.GCSCredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(config.GCSCredentialsFile))
+	}
+
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcsObjectStore{client: client, bucket: client.Bucket(bucket)}, nil
+}
+
+func (g *gcsObjectStore) List(ctx context.Context, prefix string, fn func(key string)) error {
+	objects := g.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(attrs.Name)
+	}
+}
+
+func (g *gcsObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	reader, err := g.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, errObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func (g *gcsObjectStore) Close() error {
+	return g.client.Close()
+}
@@ -0,0 +1,85 @@
+package block_feed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testObjectStore struct {
+	mtx     sync.Mutex
+	objects map[string][]byte
+}
+
+func newTestObjectStore(t *testing.T, prefix string, heights ...int64) *testObjectStore {
+	store := &testObjectStore{objects: map[string][]byte{
+		prefix + "README": []byte("not a block"),
+	}}
+	for _, height := range heights {
+		data, err := testProtoBlock(t, height).Marshal()
+		assert.Nil(t, err)
+		store.objects[fmt.Sprintf("%s%d.pb", prefix, height)] = data
+	}
+	return store
+}
+
+func (s *testObjectStore) List(_ context.Context, prefix string, fn func(key string)) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for key := range s.objects {
+		fn(key)
+	}
+	return nil
+}
+
+func (s *testObjectStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if data, ok := s.objects[key]; ok {
+		return data, nil
+	}
+	return nil, errObjectNotFound
+}
+
+func (s *testObjectStore) Close() error {
+	return nil
+}
+
+func TestObjectStoreBlockFeed(t *testing.T) {
+	heights := make([]int64, 0)
+	for height := int64(5); height <= 40; height++ {
+		if height != 30 {
+			heights = append(heights, height)
+		}
+	}
+
+	feed, err := newObjectStoreBlockFeed(newTestObjectStore(t, "blocks/", heights...), "s3://bucket/blocks/", "blocks/", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), feed.Base())
+	assert.Equal(t, int64(40), feed.Height())
+
+	// resuming mid-range, in order
+	var fetched []int64
+	assert.Nil(t, feed.FetchBlocks(12, 29, func(block *BlockResult) error {
+		fetched = append(fetched, block.Block.Height)
+		return nil
+	}))
+	assert.Len(t, fetched, 18)
+	for i, height := range fetched {
+		assert.Equal(t, int64(12+i), height)
+	}
+
+	// the missing height is named, and nothing past it is emitted
+	fetched = nil
+	err = feed.FetchBlocks(25, 40, func(block *BlockResult) error {
+		fetched = append(fetched, block.Block.Height)
+		return nil
+	})
+	assert.Contains(t, err.Error(), "block 30 is missing")
+	assert.Equal(t, []int64{25, 26, 27, 28, 29}, fetched)
+
+	assert.Nil(t, feed.Close(context.Background()))
+}
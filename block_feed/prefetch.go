@@ -0,0 +1,77 @@
+package block_feed
+
+import (
+	"fmt"
+)
+
+type prefetchResult struct {
+	block *BlockResult
+	err   error
+}
+
+// prefetchInOrder fetches blocks from `from` to `to` (inclusive) with fetch, and calls emit for each block
+// strictly in order of height. Up to window blocks ahead of the next emitted height
+// are fetched concurrently by at most workers goroutines.
+//
+// On the first failed height, blocks before it are still emitted in order,
+// and the error is returned; nothing at or after the failed height is emitted.
+// If emit returns an error, fetching stops and the error is returned as is.
+func prefetchInOrder(
+	from int64,
+	to int64,
+	window int,
+	workers int,
+	fetch func(height int64) (*BlockResult, error),
+	emit func(block *BlockResult) error,
+) error {
+	// closed upon return, so that queued fetches are skipped
+	abort := make(chan struct{})
+	defer close(abort)
+
+	slots := make(chan struct{}, workers)
+
+	// every fetch reports to its own buffered channel, so it never blocks
+	// even if nobody is waiting for it anymore
+	prefetch := func(height int64) chan prefetchResult {
+		c := make(chan prefetchResult, 1)
+		go func() {
+			select {
+			case slots <- struct{}{}:
+			case <-abort:
+				c <- prefetchResult{err: fmt.Errorf("aborted")}
+				return
+			}
+			defer func() { <-slots }()
+
+			block, err := fetch(height)
+			c <- prefetchResult{block: block, err: err}
+		}()
+		return c
+	}
+
+	var queue []chan prefetchResult
+	nextFetch := from
+	for nextEmit := from; nextEmit <= to; nextEmit++ {
+		// keep the window full
+		for nextFetch <= to && len(queue) < window {
+			queue = append(queue, prefetch(nextFetch))
+			nextFetch++
+		}
+
+		result := <-queue[0]
+		queue = queue[1:]
+
+		if result.err != nil {
+			return fmt.Errorf("fetching block %d failed: %w", nextEmit, result.err)
+		}
+		if result.block.Block.Height != nextEmit {
+			return fmt.Errorf("expected block %d, got %d", nextEmit, result.block.Block.Height)
+		}
+
+		if err := emit(result.block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package block_feed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+)
+
+// QuorumConflictError is raised when upstreams disagree on the block at a height.
+// Either of them is on a fork, or lying; the feed halts rather than picking one.
+type QuorumConflictError struct {
+	Height int64
+
+	// block hash by endpoint
+	Hashes map[string]tmbytes.HexBytes
+}
+
+func (e *QuorumConflictError) Error() string {
+	var hashes []string
+	for endpoint, hash := range e.Hashes {
+		hashes = append(hashes, fmt.Sprintf("%s=%s", RedactEndpoint(endpoint), hash))
+	}
+	return fmt.Sprintf("upstreams disagree on block %d: %s", e.Height, strings.Join(hashes, ", "))
+}
+
+// quorum cross-checks blocks against rpc endpoints on other hosts than the one the block came from.
+// A block is confirmed once `size` hosts (including its source) agree on its hash; if not enough
+// hosts answer within `timeout`, the block is taken as is, with a warning.
+type quorum struct {
+	size    int
+	timeout time.Duration
+	rpc     *RPCSubscription
+
+	// number of blocks taken without a quorum
+	fallbacks uint64
+}
+
+func newQuorum(size int, timeout time.Duration, rpc *RPCSubscription) *quorum {
+	if size < 2 {
+		return nil
+	}
+
+	hosts := make(map[string]bool)
+	for _, status := range rpc.Status() {
+		hosts[endpointHost(status.Endpoint)] = true
+	}
+	if len(hosts) < size {
+		log.Printf("[block_feed/quorum] only %d distinct rpc hosts for a quorum of %d, blocks will be taken without one\n", len(hosts), size)
+	}
+
+	return &quorum{size: size, timeout: timeout, rpc: rpc}
+}
+
+type quorumVote struct {
+	endpoint string
+	hash     tmbytes.HexBytes
+	err      error
+}
+
+// confirm returns nil once the block is confirmed, or taken as is after the timeout.
+// A *QuorumConflictError is returned if any host disagrees.
+func (q *quorum) confirm(block *BlockResult) error {
+	height := block.Block.Height
+	hash := blockHash(block)
+
+	// one vote per host; the source has voted already
+	sourceHost := endpointHost(block.source)
+	hosts := map[string]bool{sourceHost: true}
+	var voters []string
+	for _, idx := range q.rpc.pool.candidates() {
+		endpoint := q.rpc.pool.endpoint(idx)
+		if host := endpointHost(endpoint); !hosts[host] {
+			hosts[host] = true
+			voters = append(voters, endpoint)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(q.rpc.ctx, q.timeout)
+	defer cancel()
+
+	votes := make(chan quorumVote, len(voters))
+	for _, endpoint := range voters {
+		go func(endpoint string) {
+			confirmation, err := q.rpc.fetchBlockFrom(ctx, endpoint, height)
+			if err != nil {
+				votes <- quorumVote{endpoint: endpoint, err: err}
+				return
+			}
+			votes <- quorumVote{endpoint: endpoint, hash: blockHash(confirmation)}
+		}(endpoint)
+	}
+
+	agreed := 1
+	for received := 0; received < len(voters) && agreed < q.size; received++ {
+		vote := <-votes
+		if vote.err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[block_feed/quorum] %s could not confirm block %d: %v\n", RedactEndpoint(vote.endpoint), height, vote.err)
+			}
+			continue
+		}
+
+		if !bytes.Equal(vote.hash, hash) {
+			return &QuorumConflictError{
+				Height: height,
+				Hashes: map[string]tmbytes.HexBytes{block.source: hash, vote.endpoint: vote.hash},
+			}
+		}
+		agreed++
+	}
+
+	if q.rpc.ctx.Err() != nil {
+		return ErrFeedClosed
+	}
+	if agreed < q.size {
+		atomic.AddUint64(&q.fallbacks, 1)
+		log.Printf("[block_feed/quorum] WARNING: block %d confirmed by %d of %d hosts within %s, taking it from %s alone\n",
+			height, agreed, q.size, q.timeout, RedactEndpoint(block.source))
+	}
+
+	return nil
+}
+
+// endpointHost returns the host name of endpoint, so that rpc, ws and grpc endpoints of a node count as one
+func endpointHost(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		// grpc endpoints come as host:port
+		endpoint = "//" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Hostname()
+}
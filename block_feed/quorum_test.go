@@ -0,0 +1,100 @@
+package block_feed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto/tmhash"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+func testQuorumBlock(height int64, chainID string) *BlockResult {
+	// blocks on a chain share a hash, so that forks tell apart
+	return &BlockResult{
+		BlockID: &tendermint.BlockID{Hash: tmhash.Sum([]byte(chainID))},
+		Block:   &tendermint.Block{Header: tendermint.Header{Height: height, ChainID: chainID}},
+	}
+}
+
+// newTestQuorumServer serves /block for every height, on chain chainID, after delay
+func newTestQuorumServer(t *testing.T, chainID string, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		height, _ := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+		time.Sleep(delay)
+
+		blockJSON, err := tmjson.Marshal(testQuorumBlock(height, chainID))
+		assert.Nil(t, err)
+
+		writer.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":%s}`, blockJSON)))
+	}))
+}
+
+// onOtherHost returns the url of server as seen from another host name
+func onOtherHost(server *httptest.Server) string {
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+}
+
+func newTestQuorum(t *testing.T, size int, timeout time.Duration, endpoints ...string) *quorum {
+	rpc, err := NewRpcSubscription(endpoints, &RPCSubscriptionConfig{
+		Cooldown:        time.Second,
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+		RequestTimeout:  time.Second,
+	})
+	assert.Nil(t, err)
+
+	return newQuorum(size, timeout, rpc)
+}
+
+func TestQuorumConfirm(t *testing.T) {
+	source := newTestQuorumServer(t, "test", 0)
+	defer source.Close()
+	agreeing := newTestQuorumServer(t, "test", 0)
+	defer agreeing.Close()
+	forked := newTestQuorumServer(t, "fork", 0)
+	defer forked.Close()
+
+	assert.Nil(t, newTestQuorum(t, 1, time.Second, source.URL), "quorum of 1 is disabled")
+
+	block := testQuorumBlock(10, "test")
+	block.source = source.URL
+
+	q := newTestQuorum(t, 2, time.Second, source.URL, onOtherHost(agreeing))
+	assert.Nil(t, q.confirm(block))
+	assert.Equal(t, uint64(0), q.fallbacks)
+
+	var conflict *QuorumConflictError
+	q = newTestQuorum(t, 2, time.Second, source.URL, onOtherHost(forked))
+	err := q.confirm(block)
+	assert.True(t, errors.As(err, &conflict), "expected conflict, got %v", err)
+	assert.Equal(t, int64(10), conflict.Height)
+	assert.Len(t, conflict.Hashes, 2)
+}
+
+func TestQuorumFallback(t *testing.T) {
+	source := newTestQuorumServer(t, "test", 0)
+	defer source.Close()
+	slow := newTestQuorumServer(t, "test", 200*time.Millisecond)
+	defer slow.Close()
+
+	block := testQuorumBlock(10, "test")
+	block.source = source.URL
+
+	// the only other host is too slow
+	q := newTestQuorum(t, 2, 20*time.Millisecond, source.URL, onOtherHost(slow))
+	assert.Nil(t, q.confirm(block))
+	assert.Equal(t, uint64(1), q.fallbacks)
+
+	// endpoints on the source's host don't count
+	q = newTestQuorum(t, 2, time.Second, source.URL, slow.URL)
+	assert.Nil(t, q.confirm(block))
+	assert.Equal(t, uint64(1), q.fallbacks)
+}
@@ -0,0 +1,81 @@
+package block_feed
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+var _ BlockFeed = (*ReplayFeed)(nil)
+
+// ReplayFeed feeds blocks stored locally, i.e. by the block indexer or in a blockstore,
+// to re-execute them without any network.
+//
+// Blocks are fed in order up to a height, or up to the first one missing if no height is given;
+// the channel is closed after the last one.
+type ReplayFeed struct {
+	load func(height int64) (*BlockResult, error)
+	to   int64
+	c    chan *BlockResult
+	err  error
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReplayFeed creates a feed of blocks read with load, up to `to` (inclusive), or up to the first block
+// missing if it's 0. load returns a nil block for a height that's not stored.
+func NewReplayFeed(load func(height int64) (*BlockResult, error), to int64) *ReplayFeed {
+	return &ReplayFeed{
+		load:    load,
+		to:      to,
+		c:       make(chan *BlockResult),
+		closing: make(chan struct{}),
+	}
+}
+
+func (rf *ReplayFeed) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	if rf.to != 0 && rf.to < fromHeight {
+		return nil, fmt.Errorf("nothing to replay from %d to %d", fromHeight, rf.to)
+	}
+
+	go func() {
+		defer close(rf.c)
+
+		log.Printf("[block_feed/replay] replay started, from=%d, to=%d\n", fromHeight, rf.to)
+		for height := fromHeight; rf.to == 0 || height <= rf.to; height++ {
+			block, err := rf.load(height)
+			if err != nil {
+				rf.err = fmt.Errorf("failed to load block %d: %v", height, err)
+				return
+			}
+			if block == nil {
+				if rf.to != 0 {
+					rf.err = fmt.Errorf("block %d is not stored", height)
+				}
+				return
+			}
+
+			select {
+			case rf.c <- block:
+			case <-rf.closing:
+				return
+			}
+		}
+	}()
+
+	return rf.c, nil
+}
+
+// Err tells why the feed ended before the last height, once its channel is closed; nil if it did not
+func (rf *ReplayFeed) Err() error {
+	return rf.err
+}
+
+func (rf *ReplayFeed) Close(_ context.Context) error {
+	rf.closeOnce.Do(func() {
+		close(rf.closing)
+	})
+	return nil
+}
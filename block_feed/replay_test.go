@@ -0,0 +1,64 @@
+package block_feed
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+func TestReplayFeed(t *testing.T) {
+	// blocks 1 to 5 are stored
+	load := func(height int64) (*BlockResult, error) {
+		if height > 5 {
+			return nil, nil
+		}
+		return &BlockResult{Block: &tendermint.Block{Header: tendermint.Header{Height: height}}}, nil
+	}
+	replayed := func(feed *ReplayFeed, from int64) []int64 {
+		c, err := feed.Subscribe(from)
+		assert.Nil(t, err)
+
+		var heights []int64
+		for block := range c {
+			heights = append(heights, block.Block.Height)
+		}
+		return heights
+	}
+
+	// up to the last block stored
+	feed := NewReplayFeed(load, 0)
+	assert.Equal(t, []int64{2, 3, 4, 5}, replayed(feed, 2))
+	assert.Nil(t, feed.Err())
+
+	// up to a height
+	feed = NewReplayFeed(load, 3)
+	assert.Equal(t, []int64{2, 3}, replayed(feed, 2))
+	assert.Nil(t, feed.Err())
+
+	// past what's stored
+	feed = NewReplayFeed(load, 7)
+	assert.Equal(t, []int64{4, 5}, replayed(feed, 4))
+	assert.NotNil(t, feed.Err())
+
+	// load failures end it
+	feed = NewReplayFeed(func(height int64) (*BlockResult, error) {
+		return nil, fmt.Errorf("corrupted")
+	}, 0)
+	assert.Empty(t, replayed(feed, 1))
+	assert.NotNil(t, feed.Err())
+
+	_, err := NewReplayFeed(load, 3).Subscribe(4)
+	assert.NotNil(t, err)
+
+	// closing stops it mid-way
+	feed = NewReplayFeed(load, 0)
+	c, err := feed.Subscribe(1)
+	assert.Nil(t, err)
+	<-c
+	assert.Nil(t, feed.Close(context.Background()))
+	for range c {
+	}
+}
@@ -1,59 +1,427 @@
 package block_feed
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 var _ BlockFeed = (*RPCSubscription)(nil)
 
 type RPCSubscription struct {
-	rpcEndpoints []string
-	cSub     chan *BlockResult
+	pool       *endpointPool
+	httpClient *http.Client
+	headers    EndpointHeaders
+
+	// Accept-Encoding sent, and bytes received so far
+	acceptEncoding string
+	transferStats  TransferStats
+	cSub           chan *BlockResult
+
+	// prefetch settings for range fetches
+	prefetchWindow  int
+	prefetchWorkers int
+
+	// retry policy, once every endpoint has failed
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+
+	// cancelled on Close, aborting in-flight requests
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// RPCSubscriptionConfig holds tunables for the rpc feed
+type RPCSubscriptionConfig struct {
+	// Cooldown is how long a failed endpoint is skipped before being retried
+	Cooldown time.Duration
+
+	// PrefetchWindow and PrefetchWorkers bound how far ahead, and how many
+	// concurrent requests are made during range fetches
+	PrefetchWindow  int
+	PrefetchWorkers int
+
+	// RequestTimeout is the timeout of a single http request
+	RequestTimeout time.Duration
+
+	// Headers are sent along with every request to the matching endpoint
+	Headers EndpointHeaders
+
+	// Proxy routes requests through a proxy; nil means no proxy at all
+	Proxy ProxyFunc
+
+	// Compression is one of CompressionNone, CompressionGzip (default if empty) or CompressionZstd
+	Compression string
+
+	// MaxRetries is how many more rounds over all endpoints are made for a request,
+	// waiting for an exponential backoff from RetryBackoff in between
+	MaxRetries   int
+	RetryBackoff time.Duration
 }
 
-func NewRpcSubscription(rpcEndpoints []string) (*RPCSubscription, error) {
+func NewRpcSubscription(rpcEndpoints []string, rpcConfig *RPCSubscriptionConfig) (*RPCSubscription, error) {
+	if len(rpcEndpoints) == 0 {
+		return nil, fmt.Errorf("no rpc endpoints given")
+	}
+	if rpcConfig.PrefetchWindow < 1 || rpcConfig.PrefetchWorkers < 1 {
+		return nil, fmt.Errorf("invalid prefetch window(%d) or workers(%d)", rpcConfig.PrefetchWindow, rpcConfig.PrefetchWorkers)
+	}
+	if rpcConfig.RequestTimeout <= 0 {
+		return nil, fmt.Errorf("invalid request timeout(%s)", rpcConfig.RequestTimeout)
+	}
+	if rpcConfig.MaxRetries < 0 || (rpcConfig.MaxRetries > 0 && rpcConfig.RetryBackoff <= 0) {
+		return nil, fmt.Errorf("invalid max retries(%d) or retry backoff(%s)", rpcConfig.MaxRetries, rpcConfig.RetryBackoff)
+	}
+
+	encoding, err := acceptEncoding(rpcConfig.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	// backoff doubles for every retry, up to a minute
+	retryMaxDelay := rpcConfig.RetryBackoff
+	for i := 0; i < rpcConfig.MaxRetries && retryMaxDelay < time.Minute; i++ {
+		retryMaxDelay *= 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = rpcConfig.Proxy
+
 	return &RPCSubscription{
-		rpcEndpoints: rpcEndpoints,
-		cSub:     make(chan *BlockResult),
+		ctx:             ctx,
+		cancel:          cancel,
+		pool:            newEndpointPool(rpcEndpoints, rpcConfig.Cooldown),
+		httpClient:      &http.Client{Timeout: rpcConfig.RequestTimeout, Transport: transport},
+		headers:         rpcConfig.Headers,
+		acceptEncoding:  encoding,
+		cSub:            make(chan *BlockResult),
+		prefetchWindow:  rpcConfig.PrefetchWindow,
+		prefetchWorkers: rpcConfig.PrefetchWorkers,
+		maxRetries:      rpcConfig.MaxRetries,
+		retryBaseDelay:  rpcConfig.RetryBackoff,
+		retryMaxDelay:   retryMaxDelay,
 	}, nil
 }
 
-func (rpc *RPCSubscription) SyncFromUntil(from int64, to int64, rpcIndex int) {
+func (rpc *RPCSubscription) Name() string {
+	return "rpc"
+}
+
+func (rpc *RPCSubscription) SyncFromUntil(from int64, to int64) {
 	var cSub = rpc.cSub
 
 	log.Printf("[block_feed/rpc] subscription started, from=%d, to=%d\n", from, to)
 
 	// is a blocking operation
-	for i := from; i <= to; i++ {
-		log.Printf("[block_feed/rpc] receiving block %d...\n", i)
-		url := fmt.Sprintf("%s/block?height=%d", rpc.rpcEndpoints[rpcIndex], i)
-		res, err := http.Get(url)
-		if err != nil {
-			log.Fatalf("block request failed, %v", err)
+	if err := rpc.FetchBlocks(from, to, func(block *BlockResult) error {
+		select {
+		case cSub <- block:
+			return nil
+		case <-rpc.ctx.Done():
+			return ErrFeedClosed
+		}
+	}); err != nil {
+		if rpc.ctx.Err() != nil {
+			return
 		}
+		log.Printf("[block_feed/rpc] subscription stopped, %v\n", err)
+	}
+
+	cSub <- nil
+}
+
+// FetchBlocks fetches blocks from `from` to `to` (inclusive), and calls emit for each block
+// strictly in order of height. Up to prefetchWindow blocks ahead of the next emitted height
+// are fetched concurrently by at most prefetchWorkers goroutines.
+//
+// On the first failed height, blocks before it are still emitted in order,
+// and the error is returned; nothing at or after the failed height is emitted.
+// If emit returns an error, fetching stops and the error is returned as is.
+func (rpc *RPCSubscription) FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error {
+	statsBefore := rpc.TransferStats()
+	defer func() {
+		log.Printf("[block_feed/rpc] blocks %d..%d: %s\n", from, to, rpc.TransferStats().since(statsBefore))
+	}()
+
+	return prefetchInOrder(from, to, rpc.prefetchWindow, rpc.prefetchWorkers, rpc.FetchBlock, emit)
+}
+
+// FetchBlock fetches a single block at the given height.
+// Endpoints are tried in order of health, starting from the currently active one;
+// an error is returned only if every endpoint failed, for every retry.
+// If every endpoint failed permanently (i.e. they all have pruned the block), it's not retried,
+// and the error returned satisfies IsPermanent.
+func (rpc *RPCSubscription) FetchBlock(height int64) (*BlockResult, error) {
+	log.Printf("[block_feed/rpc] receiving block %d...\n", height)
+
+	var block *BlockResult
+	err := rpc.withRetries(func() error {
+		var lastErr error
+		candidates := rpc.pool.candidates()
+		unavailable := 0
+		for _, idx := range candidates {
+			endpoint := rpc.pool.endpoint(idx)
+			tStart := time.Now()
+			result, err := rpc.fetchBlockFrom(rpc.ctx, endpoint, height)
+			if err != nil {
+				log.Printf("[block_feed/rpc] fetching block %d from %s failed: %v\n", height, RedactEndpoint(endpoint), err)
+				lastErr = err
+
+				// the endpoint is fine, it just doesn't have the block
+				if IsPermanent(err) {
+					unavailable++
+					continue
+				}
+				rpc.pool.reportFailure(idx, err)
+				continue
+			}
+
+			rpc.pool.reportSuccess(idx, time.Since(tStart))
+			block = result
+			block.source = endpoint
+			return nil
+		}
+
+		if unavailable == len(candidates) {
+			return fmt.Errorf("block %d is unavailable on every rpc endpoint, last error: %w", height, lastErr)
+		}
+		return fmt.Errorf("all rpc endpoints failed, last error: %v", lastErr)
+	})
+
+	return block, err
+}
+
+// withRetries runs request up to maxRetries+1 times until it succeeds, backing off (with jitter) in between.
+// Permanent errors are returned right away.
+func (rpc *RPCSubscription) withRetries(request func() error) error {
+	retryBackoff := newBackoff(rpc.retryBaseDelay, rpc.retryMaxDelay)
+	for retry := 0; ; retry++ {
+		err := request()
+		if err == nil || IsPermanent(err) || retry >= rpc.maxRetries {
+			return err
+		}
+
+		delay := retryBackoff.next()
+		log.Printf("[block_feed/rpc] %v; retry #%d in %s\n", err, retry+1, delay)
+		select {
+		case <-time.After(delay):
+		case <-rpc.ctx.Done():
+			return ErrFeedClosed
+		}
+	}
+}
+
+func (rpc *RPCSubscription) fetchBlockFrom(ctx context.Context, endpoint string, height int64) (*BlockResult, error) {
+	res, err := rpc.get(ctx, endpoint, "/block", url.Values{"height": {strconv.FormatInt(height, 10)}})
+	if err != nil {
+		return nil, fmt.Errorf("block request failed, %v", err)
+	}
+	defer res.Body.Close()
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("block request failed, %v", err)
+	}
 
-		resBytes, err := ioutil.ReadAll(res.Body)
+	if rpcErr := ExtractErrorFromRPCResponse(resBytes); rpcErr != "" || res.StatusCode != http.StatusOK {
+		return nil, classifyHTTPError(res.StatusCode, rpcErr, fmt.Errorf("block request failed, status %d: %s", res.StatusCode, rpcErr))
+	}
+
+	block, err := ExtractBlockFromRPCResponse(resBytes)
+	if err != nil {
+		return nil, fmt.Errorf("block parse failed, %v", err)
+	} else if block == nil || block.Block == nil {
+		return nil, fmt.Errorf("block %d not found", height)
+	}
+
+	return block, nil
+}
+
+// FetchBlockResults fetches the results of the block at height, from the first endpoint that has them,
+// along with that endpoint, redacted. Endpoints are tried as FetchBlock tries them.
+func (rpc *RPCSubscription) FetchBlockResults(height int64) (*BlockResults, string, error) {
+	var results *BlockResults
+	var source string
+	err := rpc.withRetries(func() error {
+		var lastErr error
+		for _, idx := range rpc.pool.candidates() {
+			endpoint := rpc.pool.endpoint(idx)
+			tStart := time.Now()
+			result, err := rpc.fetchBlockResultsFrom(rpc.ctx, endpoint, height)
+			if err != nil {
+				lastErr = err
+				if !IsPermanent(err) {
+					rpc.pool.reportFailure(idx, err)
+				}
+				continue
+			}
+
+			rpc.pool.reportSuccess(idx, time.Since(tStart))
+			results, source = result, RedactEndpoint(endpoint)
+			return nil
+		}
+
+		return fmt.Errorf("all rpc endpoints failed, last error: %w", lastErr)
+	})
+
+	return results, source, err
+}
+
+// FetchBlockResultsFromEach fetches the results of the block at height from every endpoint, once each,
+// by endpoint, redacted; those that failed are left out
+func (rpc *RPCSubscription) FetchBlockResultsFromEach(height int64) map[string]*BlockResults {
+	results := make(map[string]*BlockResults)
+	for idx := range rpc.pool.endpoints {
+		endpoint := rpc.pool.endpoint(idx)
+		result, err := rpc.fetchBlockResultsFrom(rpc.ctx, endpoint, height)
 		if err != nil {
-			log.Fatalf("block request failed, %v", err)
+			log.Printf("[block_feed/rpc] fetching results of block %d from %s failed: %v\n", height, RedactEndpoint(endpoint), err)
+			continue
 		}
+		results[RedactEndpoint(endpoint)] = result
+	}
+	return results
+}
+
+func (rpc *RPCSubscription) fetchBlockResultsFrom(ctx context.Context, endpoint string, height int64) (*BlockResults, error) {
+	res, err := rpc.get(ctx, endpoint, "/block_results", url.Values{"height": {strconv.FormatInt(height, 10)}})
+	if err != nil {
+		return nil, fmt.Errorf("block results request failed, %v", err)
+	}
+	defer res.Body.Close()
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("block results request failed, %v", err)
+	}
+
+	if rpcErr := ExtractErrorFromRPCResponse(resBytes); rpcErr != "" || res.StatusCode != http.StatusOK {
+		return nil, classifyHTTPError(res.StatusCode, rpcErr, fmt.Errorf("block results request failed, status %d: %s", res.StatusCode, rpcErr))
+	}
 
-		if block, blockParseErr := ExtractBlockFromRPCResponse(resBytes); blockParseErr != nil {
-			log.Fatalf("block parse failed, %v", err)
-		} else {
-			cSub <- block
+	results, err := ExtractBlockResultsFromRPCResponse(resBytes)
+	if err != nil {
+		return nil, fmt.Errorf("block results parse failed, %v", err)
+	} else if results == nil {
+		return nil, fmt.Errorf("results of block %d not found", height)
+	}
+
+	return results, nil
+}
+
+// LatestHeight returns the latest block height known to the upstream
+func (rpc *RPCSubscription) LatestHeight() (int64, error) {
+	var latest int64
+	err := rpc.withRetries(func() error {
+		var lastErr error
+		for _, idx := range rpc.pool.candidates() {
+			endpoint := rpc.pool.endpoint(idx)
+			tStart := time.Now()
+			height, err := rpc.latestHeightFrom(endpoint)
+			if err != nil {
+				rpc.pool.reportFailure(idx, err)
+				lastErr = err
+				continue
+			}
+
+			rpc.pool.reportSuccess(idx, time.Since(tStart))
+			latest = height
+			return nil
 		}
+
+		return fmt.Errorf("all rpc endpoints failed, last error: %v", lastErr)
+	})
+
+	return latest, err
+}
+
+func (rpc *RPCSubscription) latestHeightFrom(endpoint string) (int64, error) {
+	res, err := rpc.get(rpc.ctx, endpoint, "/status", nil)
+	if err != nil {
+		return 0, fmt.Errorf("status request failed, %v", err)
 	}
+	defer res.Body.Close()
 
-	cSub <- nil
+	// i.e. 401 from an authenticating proxy
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status request failed, status %d", res.StatusCode)
+	}
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("status request failed, %v", err)
+	}
+
+	return ExtractLatestHeightFromRPCResponse(resBytes)
+}
+
+// get sends a GET request for path on endpoint along with its credentials,
+// which is aborted once ctx is done; ctx should be derived from rpc.ctx, so that Close aborts it too
+func (rpc *RPCSubscription) get(ctx context.Context, endpoint string, path string, query url.Values) (*http.Response, error) {
+	req, err := newEndpointRequest(ctx, endpoint, path, query, rpc.headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// set explicitly, so that responses are decompressed (and counted) here rather than by net/http
+	req.Header.Set("Accept-Encoding", rpc.acceptEncoding)
+
+	res, err := rpc.httpClient.Do(req)
+
+	// errors carry the url, which may carry a token
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = RedactEndpoint(urlErr.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decodeResponse(res, &rpc.transferStats); err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+	return res, nil
 }
 
-func (rpc *RPCSubscription) Subscribe(_ int) (chan *BlockResult, error) {
+// TransferStats returns bytes received from rpc endpoints so far, compressed and uncompressed
+func (rpc *RPCSubscription) TransferStats() TransferStats {
+	return TransferStats{
+		Received:     atomic.LoadUint64(&rpc.transferStats.Received),
+		Uncompressed: atomic.LoadUint64(&rpc.transferStats.Uncompressed),
+	}
+}
+
+// Status returns health of all rpc endpoints
+func (rpc *RPCSubscription) Status() []EndpointStatus {
+	return rpc.pool.status()
+}
+
+// Subscribe feeds blocks from fromHeight up to the upstream's latest height at the time of calling.
+// The channel receives nil once the last block is sent.
+func (rpc *RPCSubscription) Subscribe(fromHeight int64) (chan *BlockResult, error) {
+	latest, err := rpc.LatestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	go rpc.SyncFromUntil(fromHeight, latest)
+
 	return rpc.cSub, nil
 }
 
-func (rpc *RPCSubscription) Close() error {
+// Close aborts in-flight requests; the subscription is not usable afterwards
+func (rpc *RPCSubscription) Close(_ context.Context) error {
+	rpc.cancel()
 	return nil
 }
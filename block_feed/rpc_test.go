@@ -0,0 +1,165 @@
+package block_feed
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+// newTestRPCServer serves /block for every height, except ones in `missing`.
+// Responses are delayed randomly, so that requests complete out of order.
+func newTestRPCServer(t *testing.T, missing map[int64]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		height, _ := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+		time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+
+		if missing[height] {
+			writer.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"error":{"code":-32603,"message":"Internal error","data":"height %d is not available"}}`, height)))
+			return
+		}
+
+		block := &BlockResult{
+			BlockID: &tendermint.BlockID{},
+			Block:   &tendermint.Block{Header: tendermint.Header{Height: height}},
+		}
+		blockJSON, err := tmjson.Marshal(block)
+		assert.Nil(t, err)
+
+		writer.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":%s}`, blockJSON)))
+	}))
+}
+
+func TestFetchBlocksInOrder(t *testing.T) {
+	server := newTestRPCServer(t, nil)
+	defer server.Close()
+
+	rpc, err := NewRpcSubscription([]string{server.URL}, &RPCSubscriptionConfig{
+		Cooldown:        time.Second,
+		PrefetchWindow:  7,
+		PrefetchWorkers: 3,
+		RequestTimeout:  time.Second,
+	})
+	assert.Nil(t, err)
+
+	var heights []int64
+	err = rpc.FetchBlocks(10, 60, func(block *BlockResult) error {
+		heights = append(heights, block.Block.Height)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Len(t, heights, 51)
+	for i, height := range heights {
+		assert.Equal(t, int64(10+i), height)
+	}
+}
+
+func TestFetchBlocksFailureInWindow(t *testing.T) {
+	server := newTestRPCServer(t, map[int64]bool{15: true})
+	defer server.Close()
+
+	rpc, err := NewRpcSubscription([]string{server.URL}, &RPCSubscriptionConfig{
+		Cooldown:        time.Second,
+		PrefetchWindow:  10,
+		PrefetchWorkers: 4,
+		RequestTimeout:  time.Second,
+	})
+	assert.Nil(t, err)
+
+	var heights []int64
+	err = rpc.FetchBlocks(10, 30, func(block *BlockResult) error {
+		heights = append(heights, block.Block.Height)
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []int64{10, 11, 12, 13, 14}, heights)
+}
+
+func TestFetchBlockRetries(t *testing.T) {
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if failures > 0 {
+			failures--
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writer.Write([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":-1,"result":%s}`, testBlockJSON(t, 5))))
+	}))
+	defer server.Close()
+
+	newRPC := func(maxRetries int) *RPCSubscription {
+		rpc, err := NewRpcSubscription([]string{server.URL}, &RPCSubscriptionConfig{
+			Cooldown:        time.Millisecond,
+			PrefetchWindow:  1,
+			PrefetchWorkers: 1,
+			RequestTimeout:  time.Second,
+			MaxRetries:      maxRetries,
+			RetryBackoff:    time.Millisecond,
+		})
+		assert.Nil(t, err)
+		return rpc
+	}
+
+	_, err := newRPC(1).FetchBlock(5)
+	assert.NotNil(t, err)
+
+	failures = 2
+	block, err := newRPC(2).FetchBlock(5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), block.Block.Height)
+}
+
+func TestFetchBlockPermanentFailure(t *testing.T) {
+	requests := 0
+	pruned := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests++
+		writer.WriteHeader(http.StatusInternalServerError)
+		writer.Write([]byte(`{"jsonrpc":"2.0","id":-1,"error":{"code":-32603,"message":"Internal error","data":"height 5 is not available, lowest height is 100"}}`))
+	}))
+	defer pruned.Close()
+
+	rpc, err := NewRpcSubscription([]string{pruned.URL}, &RPCSubscriptionConfig{
+		Cooldown:        time.Millisecond,
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+		RequestTimeout:  time.Second,
+		MaxRetries:      3,
+		RetryBackoff:    time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	// pruned block is not retried
+	_, err = rpc.FetchBlock(5)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, requests)
+
+	// unless another endpoint might have it
+	unavailable, err := NewRpcSubscription([]string{pruned.URL, "http://127.0.0.1:1"}, &RPCSubscriptionConfig{
+		Cooldown:        time.Millisecond,
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+		RequestTimeout:  time.Second,
+		MaxRetries:      1,
+		RetryBackoff:    time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	_, err = unavailable.FetchBlock(5)
+	assert.NotNil(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestNewRpcSubscriptionInvalidConfig(t *testing.T) {
+	_, err := NewRpcSubscription([]string{"http://localhost"}, &RPCSubscriptionConfig{
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+	})
+	assert.Contains(t, err.Error(), "invalid request timeout")
+}
@@ -0,0 +1,97 @@
+package block_feed
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Stall states, as reported in SyncStatus.Stalled
+const (
+	// StallChainHalted means no block was delivered for a while, and the upstream has none either:
+	// data is stale, but correct
+	StallChainHalted = "chain_halted"
+
+	// StallSubscriptionDead means the upstream has moved on, but the live feed did not deliver;
+	// the live feed is reconnected
+	StallSubscriptionDead = "subscription_dead"
+
+	// StallFollowedGone means the mantlemint a standby follows hasn't told the heights it's at for a while:
+	// it's down, or stuck
+	StallFollowedGone = "followed_gone"
+)
+
+// watchStall checks every so often whether blocks have stopped coming for longer than stallThreshold,
+// and if so, probes the upstream to tell a halted chain from a dead subscription.
+func (ags *AggregateSubscription) watchStall() {
+	defer ags.wg.Done()
+
+	ticker := time.NewTicker(ags.stallThreshold / 3)
+	defer ticker.Stop()
+
+	// nothing is expected before the feed starts
+	startedAt := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			ags.checkStall(startedAt, now)
+		case <-ags.closing:
+			return
+		}
+	}
+}
+
+func (ags *AggregateSubscription) checkStall(startedAt time.Time, now time.Time) {
+	status := ags.syncTracker.status(now)
+	lastBlockAt := status.LastBlockAt
+	if lastBlockAt.Before(startedAt) {
+		lastBlockAt = startedAt
+	}
+
+	if now.Sub(lastBlockAt) < ags.stallThreshold {
+		if ags.syncTracker.setStalled("") {
+			log.Printf("[block_feed/stall] blocks are coming again at height %d\n", status.Height)
+		}
+		return
+	}
+
+	// the consumer is not taking blocks (i.e. paused), or the feed halted on purpose; nothing to probe
+	if ags.isHalted() || (status.BufferSize > 0 && status.Buffered == status.BufferSize) {
+		return
+	}
+
+	latest, err := ags.latestHeight()
+	if err != nil {
+		log.Printf("[block_feed/stall] no block for %s, and the upstream can't be probed: %v\n", now.Sub(lastBlockAt), err)
+		return
+	}
+
+	if latest <= status.Height {
+		if ags.syncTracker.setStalled(StallChainHalted) {
+			atomic.AddUint64(&ags.stallCount, 1)
+			log.Printf("[block_feed/stall] no block for %s, the chain seems halted at height %d\n", now.Sub(lastBlockAt), latest)
+		}
+		return
+	}
+
+	if ags.syncTracker.setStalled(StallSubscriptionDead) {
+		atomic.AddUint64(&ags.stallCount, 1)
+	}
+	log.Printf("[block_feed/stall] no block for %s while the upstream is at height %d, dropping the live feed\n", now.Sub(lastBlockAt), latest)
+	ags.dropLive()
+}
+
+// dropLive closes the live stream, if any, so that the feed reconnects
+func (ags *AggregateSubscription) dropLive() {
+	if atomic.LoadInt64(&ags.liveWSIdx) >= 0 {
+		_ = ags.ws.Close(context.Background())
+	} else if live, _ := ags.liveEndpoint.Load().(string); live != "" && ags.grpc != nil {
+		ags.grpc.CloseStream()
+	}
+}
+
+// StallCount returns the number of times blocks stopped coming, for whichever reason
+func (ags *AggregateSubscription) StallCount() uint64 {
+	return atomic.LoadUint64(&ags.stallCount)
+}
@@ -0,0 +1,202 @@
+package block_feed
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// window over which BlocksPerSecond is averaged, in seconds
+const syncRateWindow = 60
+
+// SyncStatus is a snapshot of how far the feed is behind its upstream
+type SyncStatus struct {
+	// Height is the last block delivered by the feed
+	Height int64 `json:"height"`
+
+	// UpstreamHeight is the latest height seen from the upstream, either by polling or by the live feed
+	UpstreamHeight int64 `json:"upstream_height"`
+
+	// Lag is the number of blocks the feed is behind the upstream; the consumer counts it from LatestHeight instead
+	Lag int64 `json:"lag"`
+
+	// BlocksPerSecond is the delivery rate, averaged over the last minute
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+
+	// LastBlockAt is when the last block was delivered, and SinceLastBlock is the seconds elapsed since then
+	LastBlockAt    time.Time `json:"last_block_at"`
+	SinceLastBlock float64   `json:"since_last_block"`
+
+	// Synced is true while Lag is at most SyncedThreshold
+	Synced          bool  `json:"synced"`
+	SyncedThreshold int64 `json:"synced_threshold"`
+
+	// Buffered is the number of blocks delivered by the feed, but not yet taken by the consumer
+	Buffered   int `json:"buffered"`
+	BufferSize int `json:"buffer_size"`
+
+	// Paused is set by the consumer while it has stopped taking blocks on purpose
+	Paused bool `json:"paused"`
+
+	// Quarantined is set by the consumer to the height of a block it won't take, as it keeps failing on it
+	Quarantined int64 `json:"quarantined,omitempty"`
+
+	// Pinned is the height a node serving queries as of a fixed height is pinned at, taking no blocks
+	Pinned int64 `json:"pinned,omitempty"`
+
+	// Following is the home of the mantlemint a standby follows, taking no blocks itself; the rest is of
+	// that mantlemint's feed, but for Height, which is the standby's
+	Following string `json:"following,omitempty"`
+
+	// Diverged is set by the consumer to the height its state was found to differ from upstream at;
+	// Synced is false from then on
+	Diverged int64 `json:"diverged,omitempty"`
+
+	// Stalled tells why no block has been delivered for a while, if so;
+	// see StallChainHalted, StallSubscriptionDead and StallFollowedGone
+	Stalled string `json:"stalled,omitempty"`
+
+	// set by the consumer: ChainID is the chain of its genesis, LatestHeight the last block it flushed, i.e. that
+	// queries are served at, LatestBlockTime the time of that block, and Staleness the seconds elapsed since then
+	ChainID         string    `json:"chain_id,omitempty"`
+	LatestHeight    int64     `json:"latest_height,omitempty"`
+	LatestBlockTime time.Time `json:"latest_block_time"`
+	Staleness       float64   `json:"staleness"`
+
+	// ShuttingDown is set by the consumer once it's stopping, for load balancers to route queries elsewhere
+	ShuttingDown bool `json:"shutting_down,omitempty"`
+
+	// SinceLastFlush is set by the consumer to the seconds elapsed since it last flushed a block, by the wall clock
+	SinceLastFlush float64 `json:"since_last_flush"`
+}
+
+// Healthy tells whether queries are served off an up-to-date state: synced, neither paused nor stuck on a
+// quarantined block. A halted chain is healthy (stale but correct) if allowStale, as it is for /health and /status
+func (s SyncStatus) Healthy(allowStale bool) bool {
+	return s.Unready(allowStale, 0) == ""
+}
+
+// Unready tells why queries shouldn't be routed here, if they shouldn't, as Healthy tells; besides, if
+// maxSinceLastFlush isn't 0, the last block must have been flushed since, unless pinned or the chain halted
+func (s SyncStatus) Unready(allowStale bool, maxSinceLastFlush time.Duration) string {
+	switch {
+	case s.ShuttingDown:
+		return "shutting down"
+	case s.Paused:
+		return "paused"
+	case s.Quarantined != 0:
+		return fmt.Sprintf("quarantined at block %d", s.Quarantined)
+	case s.Diverged != 0:
+		return fmt.Sprintf("diverged at block %d", s.Diverged)
+	case !s.Synced:
+		return fmt.Sprintf("not synced: %d blocks behind, %d allowed", s.Lag, s.SyncedThreshold)
+	case !allowStale && s.Stalled != "":
+		return "stalled: " + s.Stalled
+	case maxSinceLastFlush > 0 && s.Pinned == 0 && s.Stalled == "" && s.SinceLastFlush > maxSinceLastFlush.Seconds():
+		return fmt.Sprintf("last block flushed %.0fs ago, %s allowed", s.SinceLastFlush, maxSinceLastFlush)
+	}
+	return ""
+}
+
+// syncTracker keeps track of the local and upstream heights, and the rate of delivered blocks.
+type syncTracker struct {
+	mtx            sync.Mutex
+	height         int64
+	upstreamHeight int64
+	lastBlockAt    time.Time
+	stalled        string
+
+	// the feed is considered synced while it's at most this many blocks behind the upstream
+	syncedThreshold int64
+
+	// number of blocks delivered per second, indexed by unix second % syncRateWindow
+	buckets [syncRateWindow]struct {
+		second int64
+		count  int
+	}
+}
+
+func newSyncTracker(height int64, syncedThreshold int64) *syncTracker {
+	return &syncTracker{height: height, syncedThreshold: syncedThreshold}
+}
+
+// observeUpstream records a height known to exist upstream
+func (st *syncTracker) observeUpstream(height int64) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	if height > st.upstreamHeight {
+		st.upstreamHeight = height
+	}
+}
+
+// observeBlock records a block delivered at `at`
+func (st *syncTracker) observeBlock(height int64, at time.Time) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.height = height
+	st.lastBlockAt = at
+	if height > st.upstreamHeight {
+		st.upstreamHeight = height
+	}
+
+	second := at.Unix()
+	bucket := &st.buckets[second%syncRateWindow]
+	if bucket.second != second {
+		bucket.second = second
+		bucket.count = 0
+	}
+	bucket.count++
+}
+
+// setStalled records the stall state, and returns whether it has changed
+func (st *syncTracker) setStalled(stalled string) bool {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	changed := st.stalled != stalled
+	st.stalled = stalled
+	return changed
+}
+
+// reset forgets the delivered height, i.e. when the feed is rewound
+func (st *syncTracker) reset(height int64) {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.height = height
+}
+
+func (st *syncTracker) status(now time.Time) SyncStatus {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	var delivered int
+	for _, bucket := range st.buckets {
+		if now.Unix()-bucket.second < syncRateWindow {
+			delivered += bucket.count
+		}
+	}
+
+	status := SyncStatus{
+		Height:          st.height,
+		UpstreamHeight:  st.upstreamHeight,
+		BlocksPerSecond: float64(delivered) / syncRateWindow,
+		LastBlockAt:     st.lastBlockAt,
+		SyncedThreshold: st.syncedThreshold,
+		Stalled:         st.stalled,
+	}
+
+	if st.upstreamHeight > st.height {
+		status.Lag = st.upstreamHeight - st.height
+	}
+	if !st.lastBlockAt.IsZero() {
+		status.SinceLastBlock = now.Sub(st.lastBlockAt).Seconds()
+	}
+
+	// nothing is known of the upstream until it is reached at least once
+	status.Synced = st.upstreamHeight > 0 && status.Lag <= st.syncedThreshold
+
+	return status
+}
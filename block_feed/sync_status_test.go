@@ -0,0 +1,64 @@
+package block_feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncTracker(t *testing.T) {
+	st := newSyncTracker(100, 3)
+	assert.False(t, st.status(time.Now()).Synced)
+
+	st.observeUpstream(200)
+	now := time.Unix(1_000_000, 0)
+	for i := int64(0); i < 120; i++ {
+		st.observeBlock(101+i, now.Add(time.Duration(i)*time.Second/2))
+	}
+
+	status := st.status(now.Add(time.Minute))
+	assert.Equal(t, int64(220), status.Height)
+	assert.Equal(t, int64(220), status.UpstreamHeight)
+	assert.Equal(t, int64(0), status.Lag)
+	assert.True(t, status.Synced)
+
+	// 2 blocks per second, but the first second has fallen out of the window
+	assert.InDelta(t, 2.0, status.BlocksPerSecond, 0.05)
+	assert.InDelta(t, 0.5, status.SinceLastBlock, 0.001)
+
+	// within the threshold
+	st.observeUpstream(223)
+	status = st.status(now.Add(time.Minute))
+	assert.Equal(t, int64(3), status.Lag)
+	assert.True(t, status.Synced)
+
+	st.observeUpstream(230)
+	status = st.status(now.Add(time.Minute))
+	assert.Equal(t, int64(10), status.Lag)
+	assert.False(t, status.Synced)
+}
+
+func TestSyncStatusUnready(t *testing.T) {
+	status := SyncStatus{Synced: true, SyncedThreshold: 3, SinceLastFlush: 90}
+	assert.Empty(t, status.Unready(true, 0))
+	assert.Equal(t, "last block flushed 90s ago, 1m0s allowed", status.Unready(true, time.Minute))
+	assert.True(t, status.Healthy(true))
+
+	// nor a halted chain nor a pinned node flush blocks, which they don't take
+	status.Stalled = "chain_halted"
+	assert.Empty(t, status.Unready(true, time.Minute))
+	assert.Equal(t, "stalled: chain_halted", status.Unready(false, time.Minute))
+	status.Stalled, status.Pinned = "", 100
+	assert.Empty(t, status.Unready(true, time.Minute))
+
+	status = SyncStatus{Synced: false, Lag: 10, SyncedThreshold: 3}
+	assert.Equal(t, "not synced: 10 blocks behind, 3 allowed", status.Unready(true, 0))
+	assert.False(t, status.Healthy(true))
+	status.Quarantined = 12
+	assert.Equal(t, "quarantined at block 12", status.Unready(true, 0))
+	status.Paused = true
+	assert.Equal(t, "paused", status.Unready(true, 0))
+	status.ShuttingDown = true
+	assert.Equal(t, "shutting down", status.Unready(true, 0))
+}
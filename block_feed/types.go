@@ -1,21 +1,54 @@
 package block_feed
 
 import (
+	"context"
+	"errors"
+
 	tendermint "github.com/tendermint/tendermint/types"
 )
 
+// ErrFeedClosed is returned by feeds, and emit callbacks, once the feed is closed
+var ErrFeedClosed = errors.New("block feed closed")
+
+// ErrFeedHalted is returned by feeds that have stopped on purpose, i.e. upon a quorum conflict,
+// and won't deliver any more blocks until restarted
+var ErrFeedHalted = errors.New("block feed halted")
+
 // BlockFeed is a standard interface to provide subscription over blocks
 // There is only one method OnBlockFound and it gives you access to the
 // BlockFeed channel
 type BlockFeed interface {
-	// Close closes underlying subscriber
-	Close() error
+	// Close closes underlying subscriber, and returns once it's fully stopped,
+	// or the context is done
+	Close(ctx context.Context) error
+
+	// Subscribe starts subscription to the block source, starting at fromHeight if the source supports it
+	Subscribe(fromHeight int64) (chan *BlockResult, error)
+}
 
-	// Subscribe starts subscription to the block source
-	Subscribe(rpcIndex int) (chan *BlockResult, error)
+// localBlockSource is a finite source of historical blocks, read through before the network feed
+type localBlockSource interface {
+	Name() string
+
+	// Base and Height return the first and the last height available
+	Base() int64
+	Height() int64
+
+	FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error
+	Close(ctx context.Context) error
+}
+
+// historicalSource serves blocks by height from a remote upstream, for catch-up and gap repair
+type historicalSource interface {
+	Name() string
+	LatestHeight() (int64, error)
+	FetchBlocks(from int64, to int64, emit func(block *BlockResult) error) error
 }
 
 type BlockResult struct {
 	BlockID *tendermint.BlockID `json:"block_id"`
 	Block   *tendermint.Block   `json:"block"`
+
+	// the upstream endpoint the block came from, if it came from the network
+	source string
 }
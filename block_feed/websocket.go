@@ -1,17 +1,35 @@
 package block_feed
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/gorilla/websocket"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 var _ BlockFeed = (*WSSubscription)(nil)
 
 type WSSubscription struct {
 	wsEndpoints []string
+	headers     EndpointHeaders
+	dialer      *websocket.Dialer
+	endpointIdx int
 	ws          *websocket.Conn
 	c           chan *BlockResult
+
+	// the upstream is pinged every pingInterval (if positive), and the connection is
+	// considered dead if nothing, not even a pong, comes back within pingInterval+pongTimeout
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+
+	// guards ws, as Close may be called from another goroutine
+	mtx sync.Mutex
 }
 
 type handshake struct {
@@ -25,22 +43,51 @@ type params struct {
 	Query string `json:"query"`
 }
 
-func NewWSSubscription(wsEndpoints []string) (*WSSubscription, error) {
+// NewWSSubscription creates a websocket feed over wsEndpoints; headers (may be nil) are sent on dial,
+// and the upgrade request goes through proxy (nil means no proxy at all).
+// Connections are kept alive with a ping every pingInterval, unless it's 0.
+func NewWSSubscription(wsEndpoints []string, headers EndpointHeaders, proxy ProxyFunc, pingInterval time.Duration, pongTimeout time.Duration) (*WSSubscription, error) {
+	if len(wsEndpoints) == 0 {
+		return nil, fmt.Errorf("no ws endpoints given")
+	}
+	if pingInterval < 0 || (pingInterval > 0 && pongTimeout <= 0) {
+		return nil, fmt.Errorf("invalid ping interval(%s) or pong timeout(%s)", pingInterval, pongTimeout)
+	}
+
 	return &WSSubscription{
 		wsEndpoints: wsEndpoints,
-		ws:          nil,
+		headers:     headers,
+		dialer: &websocket.Dialer{
+			Proxy:            proxy,
+			HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+		},
+		endpointIdx:  0,
+		ws:           nil,
+		pingInterval: pingInterval,
+		pongTimeout:  pongTimeout,
 	}, nil
 }
 
-func (ws *WSSubscription) Subscribe(rpcIndex int) (chan *BlockResult, error) {
-	socket, _, err := websocket.DefaultDialer.Dial(ws.wsEndpoints[rpcIndex], nil)
+// UseEndpoint sets which of wsEndpoints is connected to on the next Subscribe
+func (ws *WSSubscription) UseEndpoint(endpointIdx int) {
+	ws.endpointIdx = endpointIdx % len(ws.wsEndpoints)
+}
+
+// Subscribe connects to the current ws endpoint.
+// Websocket only carries live blocks, therefore fromHeight is ignored.
+func (ws *WSSubscription) Subscribe(_ int64) (chan *BlockResult, error) {
+	// basic auth embedded in the endpoint is taken care of by the dialer
+	endpoint := ws.wsEndpoints[ws.endpointIdx]
+	socket, _, err := ws.dialer.Dial(endpoint, ws.headers.For(endpoint))
 
 	// return err, handle failures gracefully
 	if err != nil {
 		return nil, err
 	}
 
+	ws.mtx.Lock()
 	ws.ws = socket
+	ws.mtx.Unlock()
 
 	var request = &handshake{
 		JSONRPC: "2.0",
@@ -54,13 +101,13 @@ func (ws *WSSubscription) Subscribe(rpcIndex int) (chan *BlockResult, error) {
 	log.Print("Subscribing to tendermint rpc...")
 
 	// should not fail here
-	if err := ws.ws.WriteJSON(request); err != nil {
+	if err := socket.WriteJSON(request); err != nil {
 		return nil, err
 	}
 
 	// handle initial message
 	// by setting c.initialized to true, we prevent message mishandling
-	if err := handleInitialHandhake(ws.ws); err != nil {
+	if err := handleInitialHandhake(socket); err != nil {
 		return nil, err
 	}
 
@@ -70,14 +117,68 @@ func (ws *WSSubscription) Subscribe(rpcIndex int) (chan *BlockResult, error) {
 	c := make(chan *BlockResult)
 	ws.c = c
 
-	go receiveBlockEvents(ws.ws, c)
+	// pongs are only handled while reading, so the read deadline is what catches missing ones
+	var readTimeout time.Duration
+	done := make(chan struct{})
+	if ws.pingInterval > 0 {
+		readTimeout = ws.pingInterval + ws.pongTimeout
+		socket.SetPongHandler(func(string) error {
+			return socket.SetReadDeadline(time.Now().Add(readTimeout))
+		})
+		go ws.keepalive(socket, done)
+	}
+
+	go func() {
+		defer close(done)
+		receiveBlockEvents(socket, endpoint, readTimeout, c)
+	}()
 
 	// start receiving blocks
 	return c, nil
 }
 
-func (ws *WSSubscription) Close() error {
-	return ws.ws.Close()
+// Close unsubscribes and closes the current websocket, if any.
+// The receiving goroutine sends nil, and closes the channel once it notices.
+func (ws *WSSubscription) Close(ctx context.Context) error {
+	ws.mtx.Lock()
+	socket := ws.ws
+	ws.ws = nil
+	ws.mtx.Unlock()
+
+	if socket == nil {
+		return nil
+	}
+
+	// best effort; the upstream may be long gone already
+	deadline := time.Now().Add(time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = socket.SetWriteDeadline(deadline)
+	_ = socket.WriteJSON(&handshake{JSONRPC: "2.0", Method: "unsubscribe_all", ID: 1})
+	_ = socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+
+	if err := socket.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// keepalive pings socket every pingInterval until done is closed, so that idle connections are
+// neither dropped by load balancers in between, nor left dead unnoticed
+func (ws *WSSubscription) keepalive(socket *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(ws.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a failed ping surfaces as a read error soon enough
+			_ = socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.pongTimeout))
+		case <-done:
+			return
+		}
+	}
 }
 
 // tendermint rpc sends the "subscription ok" for the intiail response
@@ -93,15 +194,27 @@ func handleInitialHandhake(ws *websocket.Conn) error {
 	return nil
 }
 
+// receiveBlockEvents reads one message at a time, and does not read the next one until
+// the block is taken from c; a slow consumer backpressures the upstream rather than losing blocks.
+// If readTimeout is positive, the connection is given up on once nothing is read for that long.
 // TODO: handle errors here
-func receiveBlockEvents(ws *websocket.Conn, c chan *BlockResult) {
+func receiveBlockEvents(ws *websocket.Conn, endpoint string, readTimeout time.Duration, c chan *BlockResult) {
 	defer close(c)
 	for {
+		// the deadline starts over once the consumer has taken the last block, so that it isn't blamed on the upstream
+		if readTimeout > 0 {
+			_ = ws.SetReadDeadline(time.Now().Add(readTimeout))
+		}
 		_, message, err := ws.ReadMessage()
 
 		// if read message failed,
 		// scrap the whole ws thing
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("[block_feed/websocket] nothing received from %s for %s, connection is dead\n", RedactEndpoint(endpoint), readTimeout)
+			}
+
 			closeErr := ws.Close()
 			if closeErr != nil {
 				log.Print("websocket close failed, but it seems the underlying websocket is already closed")
@@ -142,6 +255,9 @@ func receiveBlockEvents(ws *websocket.Conn, c chan *BlockResult) {
 		if block, blockParseErr := extractBlockFromWSResponse(message); blockParseErr != nil {
 			panic(blockParseErr)
 		} else {
+			if block != nil {
+				block.source = endpoint
+			}
 			c <- block
 		}
 	}
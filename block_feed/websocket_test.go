@@ -0,0 +1,61 @@
+package block_feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestWSServer acks the subscription and then stays silent; pings are only answered if answerPings is set
+func newTestWSServer(answerPings bool) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _, _ = conn.ReadMessage()
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":0,"result":{}}`))
+
+		// pongs are sent while reading
+		if answerPings {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}
+		time.Sleep(time.Minute)
+	}))
+}
+
+func TestWSSubscriptionKeepalive(t *testing.T) {
+	for _, answerPings := range []bool{true, false} {
+		server := newTestWSServer(answerPings)
+
+		ws, err := NewWSSubscription([]string{"ws" + strings.TrimPrefix(server.URL, "http")}, nil, nil, 20*time.Millisecond, 20*time.Millisecond)
+		assert.Nil(t, err)
+		c, err := ws.Subscribe(0)
+		assert.Nil(t, err)
+
+		// a dead connection is given up on, a live one is kept however idle
+		select {
+		case block := <-c:
+			assert.False(t, answerPings, "connection answering pings was dropped")
+			assert.Nil(t, block)
+		case <-time.After(300 * time.Millisecond):
+			assert.True(t, answerPings, "connection not answering pings was kept")
+		}
+
+		_ = ws.Close(context.Background())
+		server.Close()
+	}
+}
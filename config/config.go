@@ -1,17 +1,31 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	"github.com/cosmos/cosmos-sdk/x/crisis"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	terra "github.com/terra-money/core/v2/app"
+	wasmconfig "github.com/terra-money/core/v2/app/wasmconfig"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+)
+
+// bounds of the wasm config; beyond them a single query could take the node down
+const (
+	maxContractGasLimit        = uint64(1_000_000_000)
+	maxContractMemoryCacheSize = uint64(1 << 20) // 1TiB, in MiB
 )
 
 type Config struct {
@@ -26,17 +40,203 @@ type Config struct {
 	EnableExportModule bool
 	RichlistLength     int
 	RichlistThreshold  *sdk.Coin
+
+	WSReconnectBaseDelay time.Duration
+	WSReconnectMaxDelay  time.Duration
+	WSPingInterval       time.Duration
+	WSPongTimeout        time.Duration
+	RPCEndpointCooldown  time.Duration
+	RPCPrefetchWindow    int
+	RPCPrefetchWorkers   int
+	RPCPollInterval      time.Duration
+	RPCRequestTimeout    time.Duration
+	RPCMaxRetries        int
+	RPCRetryBackoff      time.Duration
+	SyncedThreshold      int64
+	FeedStallThreshold   time.Duration
+	FeedBufferSize       int
+	LocalBlockStorePath  string
+	BlockArchivePath     string
+
+	ReadyMaxSinceLastFlush time.Duration
+
+	BlockArchiveURL                string
+	BlockArchiveConcurrency        int
+	BlockArchiveS3Region           string
+	BlockArchiveS3Endpoint         string
+	BlockArchiveS3AccessKeyID      string
+	BlockArchiveS3SecretAccessKey  string
+	BlockArchiveGCSCredentialsFile string
+
+	GRPCFeedEndpoint              string
+	GRPCFeedTLS                   bool
+	GRPCFeedTLSCAFile             string
+	GRPCFeedTLSInsecureSkipVerify bool
+	GRPCFeedStreamMethod          string
+
+	VerifyBlocks bool
+
+	MerkleStores bool
+
+	DivergenceCheckBlocks      int64
+	DivergenceCheckMinInterval time.Duration
+	ResultsCheckBlocks         int64
+
+	HaltHeight int64
+
+	UpgradeSkipHeights map[int64]bool
+	UpgradeAllowAt     map[int64]string
+
+	CrashDumpLogLines int
+
+	PoisonBlockRetries int
+
+	EventStreamRetain int
+
+	IndexerQueueSize int
+
+	KeepRecent      int64
+	MinRetainHeight int64
+
+	SlowBlockThreshold time.Duration
+
+	ShutdownTimeout    time.Duration
+	ShutdownDrainDelay time.Duration
+
+	CatchUpLag         int64
+	CatchUpFlushBlocks int
+	CatchUpFlushBytes  int
+
+	StateSyncSnapshotDir string
+	StateSyncHeight      int64
+
+	ExportHeight int64
+	ExportOutput string
+
+	ReplayFrom   int64
+	ReplayTo     int64
+	ReplaySource string
+
+	PinHeight int64
+
+	FollowHome         string
+	FollowPollInterval time.Duration
+
+	NotifyWebhookURL   string
+	NotifyNATSURL      string
+	NotifyNATSSubject  string
+	NotifyQueueSize    int
+	NotifyBudget       time.Duration
+	NotifyTimeout      time.Duration
+	NotifyMaxRetries   int
+	NotifyRetryBackoff time.Duration
+
+	TxBroadcastUpstream    string
+	TxBroadcastLCDUpstream string
+	TxBroadcastTimeout     time.Duration
+	TxBroadcastCommit      bool
+
+	WebsocketMaxClients                int
+	WebsocketBufferSize                int
+	WebsocketMaxSubscriptionsPerClient int
+
+	GRPCAddress string
+
+	MetricsAddress string
+	EnableDebug    bool
+	DebugAddress   string
+	EnableGRPCWeb  bool
+
+	WasmBatchMaxQueries  int
+	WasmBatchConcurrency int
+
+	QueryMaxConcurrent int
+	QueryMaxQueued     int
+	QueryQueueTimeout  time.Duration
+
+	QueryTimeout time.Duration
+
+	QueryClients int
+
+	CacheMaxEntries int
+	CacheMaxBytes   int
+	CachePolicies   string
+
+	CachePersist         bool
+	CachePersistMaxBytes int
+	CachePersistIgnore   bool
+
+	RateLimitGlobal         string
+	RateLimits              string
+	RateLimitTrustedProxies []string
+	RateLimitExempt         []string
+
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSMaxAge         time.Duration
+
+	TLSAddress        string
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSReloadInterval time.Duration
+
+	UnixSocketPath string
+	UnixSocketMode os.FileMode
+
+	EnableCompression       bool
+	CompressionMinSize      int
+	CompressionContentTypes []string
+
+	EnableAccessLog        bool
+	AccessLogSample        int
+	AccessLogSlowThreshold time.Duration
+	AccessLogExclude       []string
+
+	EnableAdmin bool
+	AdminToken  string
+
+	FeedEndpointHeaders map[string]http.Header
+	FeedProxyURL        string
+	RPCCompression      string
+
+	FeedQuorum        int
+	FeedQuorumTimeout time.Duration
+
+	Wasm wasmconfig.Config
 }
 
-var singleton Config
+var (
+	singleton     Config
+	singletonErr  error
+	singletonOnce sync.Once
+)
 
-func init() {
-	singleton = newConfig()
+// Load returns singleton config, read from the environment and flags on first call; an invalid config
+// is returned as a StartupError
+func Load() (*Config, error) {
+	singletonOnce.Do(func() {
+		singleton, singletonErr = loadConfig()
+	})
+	if singletonErr != nil {
+		return nil, singletonErr
+	}
+	return &singleton, nil
 }
 
-// GetConfig returns singleton config
+// GetConfig returns singleton config as Load does, panicking if it's invalid
 func GetConfig() *Config {
-	return &singleton
+	cfg, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func loadConfig() (cfg Config, err error) {
+	defer recoverConfigError(&err)
+	return newConfig(), nil
 }
 
 // newConfig converts envvars into consumable config chunks
@@ -51,17 +251,11 @@ func newConfig() Config {
 		// ChainID sets expected chain id for this mantlemint instance
 		ChainID: getValidEnv("CHAIN_ID"),
 
-		// RPCEndpoints is where to pull txs from when fast-syncing
-		RPCEndpoints: func() []string {
-			endpoints := getValidEnv("RPC_ENDPOINTS")
-			return strings.Split(endpoints, ",")
-		}(),
+		// RPCEndpoints is where to pull txs from when fast-syncing; needed to sync from the network, see runner.Preflight
+		RPCEndpoints: splitList(getEnvWithDefault("RPC_ENDPOINTS", "")),
 
-		// WSEndpoints is where to pull txs from when normal syncing
-		WSEndpoints: func() []string {
-			endpoints := getValidEnv("WS_ENDPOINTS")
-			return strings.Split(endpoints, ",")
-		}(),
+		// WSEndpoints is where to pull txs from when normal syncing; needed along with RPCEndpoints
+		WSEndpoints: splitList(getEnvWithDefault("WS_ENDPOINTS", "")),
 
 		// MantlemintDB is the db name for mantlemint. Defaults to terra.DefaultHome
 		MantlemintDB: func() string {
@@ -115,28 +309,597 @@ func newConfig() Config {
 			}
 			return &thresholdCoin
 		}(),
+
+		// WSPingInterval is how often websocket feed connections are pinged, so that idle ones aren't dropped
+		// by load balancers in between, and dead ones are noticed; they're reconnected after WSPongTimeout without a pong
+		WSPingInterval: getValidDuration("WS_PING_INTERVAL", "20s"),
+		WSPongTimeout:  getValidDuration("WS_PONG_TIMEOUT", "10s"),
+
+		// WSReconnectBaseDelay is the initial delay before reconnecting a dropped websocket feed.
+		// Subsequent attempts back off exponentially, with jitter.
+		WSReconnectBaseDelay: getValidDuration("WS_RECONNECT_BASE_DELAY", "1s"),
+
+		// WSReconnectMaxDelay caps the backoff between websocket reconnect attempts
+		WSReconnectMaxDelay: getValidDuration("WS_RECONNECT_MAX_DELAY", "30s"),
+
+		// RPCEndpointCooldown is how long a failing rpc endpoint is avoided before it is retried
+		RPCEndpointCooldown: getValidDuration("RPC_ENDPOINT_COOLDOWN", "30s"),
+
+		// RPCPrefetchWindow is how many blocks ahead are fetched concurrently while catching up
+		RPCPrefetchWindow: getValidPositiveInt("RPC_PREFETCH_WINDOW", "20"),
+
+		// RPCPrefetchWorkers bounds concurrent block requests while catching up
+		RPCPrefetchWorkers: getValidPositiveInt("RPC_PREFETCH_WORKERS", "8"),
+
+		// RPCPollInterval is how often the upstream tip is polled for
+		RPCPollInterval: getValidDuration("RPC_POLL_INTERVAL", "10s"),
+
+		// RPCRequestTimeout is the timeout of a single request to an rpc (or grpc) endpoint
+		RPCRequestTimeout: getValidDuration("RPC_REQUEST_TIMEOUT", "10s"),
+
+		// RPCMaxRetries is how many times a request is retried after all rpc endpoints failed
+		RPCMaxRetries: getValidNonNegativeInt("RPC_MAX_RETRIES", "3"),
+
+		// RPCRetryBackoff is the initial delay between retries, doubling on each retry
+		RPCRetryBackoff: getValidDuration("RPC_RETRY_BACKOFF", "500ms"),
+
+		// SyncedThreshold is how many blocks mantlemint may lag behind the upstream tip,
+		// and still be considered synced by /health
+		SyncedThreshold: int64(getValidNonNegativeInt("SYNCED_THRESHOLD", "3")),
+
+		// FeedStallThreshold is how long to go without a block before probing the upstream for a halted chain
+		// or a dead subscription; about 3x the block time
+		FeedStallThreshold: getValidDuration("FEED_STALL_THRESHOLD", "20s"),
+
+		// ReadyMaxSinceLastFlush is how long ago the last block may have been flushed for /health/ready to respond
+		// ready, besides being healthy; 0 disables the check
+		ReadyMaxSinceLastFlush: getValidNonNegativeDuration("READY_MAX_SINCE_LAST_FLUSH", "60s"),
+
+		// FeedBufferSize is how many blocks may be queued between the block feed and the injector
+		FeedBufferSize: getValidNonNegativeInt("FEED_BUFFER_SIZE", "64"),
+
+		// LocalBlockStorePath optionally points to a local terrad blockstore.db to catch up from
+		LocalBlockStorePath: getEnvWithDefault("LOCAL_BLOCKSTORE_PATH", ""),
+
+		// BlockArchivePath optionally points to a directory of archived blocks to catch up from
+		BlockArchivePath: getEnvWithDefault("BLOCK_ARCHIVE_PATH", ""),
+
+		// BlockArchiveURL optionally points to a block archive in S3 or GCS to catch up from
+		// (format: s3://bucket/prefix or gs://bucket/prefix), fetching BlockArchiveConcurrency blocks at once
+		BlockArchiveURL:         getEnvWithDefault("BLOCK_ARCHIVE_URL", ""),
+		BlockArchiveConcurrency: getValidPositiveInt("BLOCK_ARCHIVE_CONCURRENCY", "16"),
+
+		// S3 client settings; credentials fall back to the default aws chain if not set
+		BlockArchiveS3Region:          getEnvWithDefault("BLOCK_ARCHIVE_S3_REGION", ""),
+		BlockArchiveS3Endpoint:        getEnvWithDefault("BLOCK_ARCHIVE_S3_ENDPOINT", ""),
+		BlockArchiveS3AccessKeyID:     getEnvWithDefault("BLOCK_ARCHIVE_S3_ACCESS_KEY_ID", ""),
+		BlockArchiveS3SecretAccessKey: getEnvWithDefault("BLOCK_ARCHIVE_S3_SECRET_ACCESS_KEY", ""),
+
+		// GCS service account key; application default credentials are used if not set
+		BlockArchiveGCSCredentialsFile: getEnvWithDefault("BLOCK_ARCHIVE_GCS_CREDENTIALS_FILE", ""),
+
+		// GRPCFeedEndpoint optionally points to a grpc block feed (host:port),
+		// preferred over RPC_ENDPOINTS and WS_ENDPOINTS if set
+		GRPCFeedEndpoint: getEnvWithDefault("GRPC_FEED_ENDPOINT", ""),
+
+		// GRPCFeedTLS enables TLS for GRPCFeedEndpoint
+		GRPCFeedTLS: getEnvWithDefault("GRPC_FEED_TLS", "false") == "true",
+
+		// GRPCFeedTLSCAFile optionally points to a PEM CA bundle to verify GRPCFeedEndpoint with
+		GRPCFeedTLSCAFile: getEnvWithDefault("GRPC_FEED_TLS_CA_FILE", ""),
+
+		// GRPCFeedTLSInsecureSkipVerify disables certificate verification of GRPCFeedEndpoint
+		GRPCFeedTLSInsecureSkipVerify: getEnvWithDefault("GRPC_FEED_TLS_INSECURE_SKIP_VERIFY", "false") == "true",
+
+		// GRPCFeedStreamMethod overrides the server-streaming method subscribed for live blocks
+		GRPCFeedStreamMethod: getEnvWithDefault("GRPC_FEED_STREAM_METHOD", ""),
+
+		// VerifyBlocks enables light-client verification (header chain, validator sets and
+		// LastCommit signatures) of every block before it is injected
+		VerifyBlocks: getEnvWithDefault("VERIFY_BLOCKS", "false") == "true",
+
+		// MerkleStores commits the app's stores as iavl trees, computing the chain's app hashes, rather than in faux
+		// merkle mode; way slower, for debugging divergence. A db is only ever committed to in the mode it started in
+		MerkleStores: getEnvWithDefault("MERKLE_STORES", "false") == "true",
+
+		// DivergenceCheckBlocks is how often, in blocks, the app hash committed at a recent height is checked
+		// against the header of an rpc endpoint, no more than once per DivergenceCheckMinInterval; 0 disables it.
+		// Needs merkle stores (MerkleStores), as faux merkle mode commits placeholder app hashes
+		DivergenceCheckBlocks:      int64(getValidNonNegativeInt("DIVERGENCE_CHECK_BLOCKS", "0")),
+		DivergenceCheckMinInterval: getValidDuration("DIVERGENCE_CHECK_MIN_INTERVAL", "1m"),
+
+		// ResultsCheckBlocks is how often, in blocks, the tx results of a block are checked against the /block_results
+		// of an rpc endpoint, differences being logged; 1 checks every block, 0 disables it. Works in either store mode
+		ResultsCheckBlocks: int64(getValidNonNegativeInt("RESULTS_CHECK_BLOCKS", "0")),
+
+		// HaltHeight is the last height to inject, like terrad's --halt-height; queries are still served once halted.
+		// 0 disables it
+		HaltHeight: int64(getValidNonNegativeInt("HALT_HEIGHT", "0")),
+
+		// UpgradeSkipHeights are heights of x/upgrade plans to skip, like terrad's --unsafe-skip-upgrades
+		// (format: 1234,5678)
+		UpgradeSkipHeights: func() map[int64]bool {
+			skipHeights := make(map[int64]bool)
+			for _, heightStr := range strings.Split(getEnvWithDefault("UPGRADE_SKIP_HEIGHTS", ""), ",") {
+				if heightStr == "" {
+					continue
+				}
+				height, err := strconv.ParseInt(heightStr, 10, 64)
+				if err != nil || height < 1 {
+					panic(fmt.Errorf("UPGRADE_SKIP_HEIGHTS has an invalid height(%s)", heightStr))
+				}
+				skipHeights[height] = true
+			}
+			return skipHeights
+		}(),
+
+		// UpgradeAllowAt are x/upgrade plans whose logic the binary already has, without a handler registered
+		// for them; they're applied as is, instead of halting (format: name:height,...)
+		UpgradeAllowAt: func() map[int64]string {
+			allowAt := make(map[int64]string)
+			for _, upgrade := range strings.Split(getEnvWithDefault("UPGRADE_ALLOW_AT", ""), ",") {
+				if upgrade == "" {
+					continue
+				}
+				separator := strings.LastIndex(upgrade, ":")
+				if separator < 1 {
+					panic(fmt.Errorf("UPGRADE_ALLOW_AT has an invalid upgrade(%s), expected name:height", upgrade))
+				}
+				height, err := strconv.ParseInt(upgrade[separator+1:], 10, 64)
+				if err != nil || height < 1 {
+					panic(fmt.Errorf("UPGRADE_ALLOW_AT has an invalid upgrade(%s), expected name:height", upgrade))
+				}
+				allowAt[height] = upgrade[:separator]
+			}
+			return allowAt
+		}(),
+
+		// CrashDumpLogLines is the number of last log lines kept for the crash report written when a block fails
+		// to inject, along with apphashes, store hashes and tx results, as $HOME/mantlemint-crash-<height>.json
+		CrashDumpLogLines: getValidNonNegativeInt("CRASH_DUMP_LOG_LINES", "200"),
+
+		// PoisonBlockRetries is how many times a block that failed to inject is retried, i.e. across restarts,
+		// before it's quarantined: injection stops short of it, queries are still served, and /health reports it
+		PoisonBlockRetries: getValidNonNegativeInt("POISON_BLOCK_RETRIES", "3"),
+
+		// EventStreamRetain is how many of the last blocks have their events kept for /events
+		EventStreamRetain: getValidPositiveInt("EVENT_STREAM_RETAIN", "100"),
+
+		// IndexerQueueSize is how many blocks may be queued to be indexed in the background before injection waits
+		// on the indexer; 0 indexes every block before moving on to the next
+		IndexerQueueSize: getValidNonNegativeInt("INDEXER_QUEUE_SIZE", "100"),
+
+		// KeepRecent is how many of the last heights stay queryable; the versions of keys only seen below them are
+		// garbage collected in the background. MinRetainHeight is the lowest height to keep instead. 0 keeps everything
+		KeepRecent:      int64(getValidNonNegativeInt("KEEP_RECENT", "0")),
+		MinRetainHeight: int64(getValidNonNegativeInt("MIN_RETAIN_HEIGHT", "0")),
+
+		// SlowBlockThreshold is how long a block may take, all stages included, before its timings are logged
+		SlowBlockThreshold: getValidDuration("SLOW_BLOCK_THRESHOLD", "5s"),
+
+		// ShutdownTimeout is how long to wait on SIGINT/SIGTERM for the block feed to close and rpc requests to drain
+		ShutdownTimeout: getValidDuration("SHUTDOWN_TIMEOUT", "10s"),
+
+		// ShutdownDrainDelay is how long the LCD keeps serving once /health/ready fails on SIGINT/SIGTERM, for load
+		// balancers to notice and route queries elsewhere, before it stops accepting connections
+		ShutdownDrainDelay: getValidNonNegativeDuration("SHUTDOWN_DRAIN_DELAY", "0s"),
+
+		// CatchUpLag is how many blocks behind the upstream tip mantlemint is catching up, flushing blocks to the db
+		// every CatchUpFlushBlocks blocks, or once CATCH_UP_FLUSH_MB megabytes are written, instead of after every block.
+		// 0 disables it
+		CatchUpLag:         int64(getValidNonNegativeInt("CATCH_UP_LAG", "1000")),
+		CatchUpFlushBlocks: getValidPositiveInt("CATCH_UP_FLUSH_BLOCKS", "100"),
+		CatchUpFlushBytes:  getValidPositiveInt("CATCH_UP_FLUSH_MB", "256") << 20,
+
+		// StateSyncSnapshotDir points to a terrad snapshot store (${TERRA_HOME}/data/snapshots) to bootstrap
+		// empty state from, instead of genesis; StateSyncHeight picks the snapshot, the latest one if 0
+		StateSyncSnapshotDir: getEnvWithDefault("STATE_SYNC_SNAPSHOT_DIR", ""),
+		StateSyncHeight:      int64(getValidNonNegativeInt("STATE_SYNC_HEIGHT", "0")),
+
+		// EnableAdmin exposes /admin routes to inspect and switch feed endpoints, and to pause injection
+		EnableAdmin: getEnvWithDefault("ENABLE_ADMIN", "false") == "true",
+
+		// AdminToken, if set, is required as a bearer token by /admin routes; with EnableAdmin, either it or
+		// TLSClientCAFile must be
+		AdminToken: getEnvWithDefault("ADMIN_TOKEN", ""),
+
+		// FeedEndpointHeaders are extra headers sent to rpc/ws endpoints, i.e. for an authenticating proxy
+		// (format: {"https://rpc.example.com": {"Authorization": "Bearer token"}})
+		FeedEndpointHeaders: func() map[string]http.Header {
+			headersJSON := getEnvWithDefault("FEED_ENDPOINT_HEADERS", "")
+			if headersJSON == "" {
+				return nil
+			}
+
+			parsed := make(map[string]map[string]string)
+			if err := json.Unmarshal([]byte(headersJSON), &parsed); err != nil {
+				// the value holds credentials; keep it out of the panic
+				panic(fmt.Errorf("FEED_ENDPOINT_HEADERS is invalid: %v", err))
+			}
+
+			endpointHeaders := make(map[string]http.Header, len(parsed))
+			for endpoint, headers := range parsed {
+				endpointHeaders[endpoint] = make(http.Header, len(headers))
+				for key, value := range headers {
+					endpointHeaders[endpoint].Set(key, value)
+				}
+			}
+			return endpointHeaders
+		}(),
+
+		// FeedProxyURL routes rpc/ws connections through a proxy; HTTP_PROXY/HTTPS_PROXY are honored if not set
+		FeedProxyURL: getEnvWithDefault("FEED_PROXY_URL", ""),
+
+		// RPCCompression is requested for rpc responses; none, gzip or zstd (falling back to gzip)
+		RPCCompression: getEnvWithDefault("RPC_COMPRESSION", "gzip"),
+
+		// FeedQuorum is the number of distinct rpc hosts that must agree on a block before it's injected; 1 disables it
+		FeedQuorum: getValidPositiveInt("FEED_QUORUM", "1"),
+
+		// FeedQuorumTimeout is how long to wait for a quorum on a block before taking it from a single upstream
+		FeedQuorumTimeout: getValidDuration("FEED_QUORUM_TIMEOUT", "5s"),
+
+		// FollowHome is the MANTLEMINT_HOME of another mantlemint to run as a warm standby of: its dbs are read as it
+		// writes them, without syncing, checking every FollowPollInterval for the heights it moved on to
+		FollowHome:         getEnvWithDefault("FOLLOW_HOME", ""),
+		FollowPollInterval: getValidDuration("FOLLOW_POLL_INTERVAL", "200ms"),
+
+		// NotifyWebhookURL is POSTed every block flushed, once indexed, as json; none if empty
+		NotifyWebhookURL: getEnvWithDefault("NOTIFY_WEBHOOK_URL", ""),
+
+		// NotifyNATSURL is the nats server (nats:// or tls://) every block flushed is published to, once indexed,
+		// on NotifyNATSSubject; none if empty
+		NotifyNATSURL:     getEnvWithDefault("NOTIFY_NATS_URL", ""),
+		NotifyNATSSubject: getEnvWithDefault("NOTIFY_NATS_SUBJECT", "mantlemint.commits"),
+
+		// NotifyQueueSize is how many blocks may wait to be notified to a consumer; once full, injection waits
+		// up to NotifyBudget for it, and the block is dropped for that consumer after
+		NotifyQueueSize: getValidNonNegativeInt("NOTIFY_QUEUE_SIZE", "100"),
+		NotifyBudget:    getValidDuration("NOTIFY_BUDGET", "100ms"),
+
+		// NotifyTimeout is how long a consumer may take to be notified of a block; it's retried up to
+		// NotifyMaxRetries times, backing off from NotifyRetryBackoff
+		NotifyTimeout:      getValidDuration("NOTIFY_TIMEOUT", "5s"),
+		NotifyMaxRetries:   getValidNonNegativeInt("NOTIFY_MAX_RETRIES", "5"),
+		NotifyRetryBackoff: getValidDuration("NOTIFY_RETRY_BACKOFF", "500ms"),
+
+		// TxBroadcastUpstream is the rpc of a full node broadcast_tx_* are forwarded to, and TxBroadcastLCDUpstream
+		// its LCD, POST /cosmos/tx/v1beta1/txs is forwarded to; mantlemint being read-only, neither is if empty
+		TxBroadcastUpstream:    getEnvWithDefault("TX_BROADCAST_UPSTREAM", ""),
+		TxBroadcastLCDUpstream: getEnvWithDefault("TX_BROADCAST_LCD_UPSTREAM", ""),
+
+		// TxBroadcastTimeout is how long a forwarded broadcast may take before it fails with a 502
+		TxBroadcastTimeout: getValidDuration("TX_BROADCAST_TIMEOUT", "10s"),
+
+		// TxBroadcastCommit forwards broadcast_tx_commit too, which is rejected otherwise
+		TxBroadcastCommit: getEnvWithDefault("TX_BROADCAST_COMMIT", "false") == "true",
+
+		// WebsocketMaxClients is how many clients may be connected to /websocket at once; 0 disables it
+		WebsocketMaxClients: getValidNonNegativeInt("WEBSOCKET_MAX_CLIENTS", "100"),
+
+		// WebsocketBufferSize is how many events may wait to be written to a websocket client, which is
+		// disconnected once it has more
+		WebsocketBufferSize: getValidPositiveInt("WEBSOCKET_BUFFER_SIZE", "200"),
+
+		// WebsocketMaxSubscriptionsPerClient is how many queries a websocket client may be subscribed to at once
+		WebsocketMaxSubscriptionsPerClient: getValidPositiveInt("WEBSOCKET_MAX_SUBSCRIPTIONS_PER_CLIENT", "5"),
+
+		// MetricsAddress optionally serves /metrics at this address (host:port) rather than on the LCD's port, i.e. for
+		// it not to be exposed along with the LCD
+		MetricsAddress: getEnvWithDefault("METRICS_ADDRESS", ""),
+
+		// EnableDebug serves pprof under /debug/pprof/ and runtime stats at /debug/runtime, at DebugAddress
+		// (host:port), localhost only by default; or on the LCD's port if DebugAddress is empty
+		EnableDebug:  getEnvWithDefault("ENABLE_DEBUG", "false") == "true",
+		DebugAddress: getEnvWithDefault("DEBUG_ADDRESS", "127.0.0.1:6060"),
+
+		// GRPCAddress optionally serves the app's query services over grpc at this address (host:port)
+		GRPCAddress: getEnvWithDefault("GRPC_ADDRESS", ""),
+
+		// EnableGRPCWeb serves the same services over grpc-web, on the LCD's port, whether GRPCAddress is set or not
+		EnableGRPCWeb: getEnvWithDefault("ENABLE_GRPC_WEB", "false") == "true",
+
+		// WasmBatchMaxQueries is how many smart queries may be posted to /wasm/contract/batch at once
+		WasmBatchMaxQueries: getValidPositiveInt("WASM_BATCH_MAX_QUERIES", "100"),
+
+		// WasmBatchConcurrency is how many smart queries of a batch run at once
+		WasmBatchConcurrency: getValidPositiveInt("WASM_BATCH_CONCURRENCY", "8"),
+
+		// QueryMaxConcurrent is how many smart queries may run at once, over any api, for a burst of them not to
+		// starve block injection of cpu; 0 doesn't limit them. QueryMaxQueued more may wait for QueryQueueTimeout,
+		// before they're turned away with 503; 0 turns them away right away
+		QueryMaxConcurrent: getValidNonNegativeInt("QUERY_MAX_CONCURRENT", "0"),
+		QueryMaxQueued:     getValidNonNegativeInt("QUERY_MAX_QUEUED", "100"),
+		QueryQueueTimeout:  getValidNonNegativeDuration("QUERY_QUEUE_TIMEOUT", "2s"),
+
+		// QueryTimeout is how long a query may take, over the LCD, grpc or Tendermint rpc, before it's given up on with
+		// 504; queries are given up on too once their client goes away. 0 doesn't bound them
+		QueryTimeout: getValidNonNegativeDuration("QUERY_TIMEOUT", "30s"),
+
+		// QueryClients is how many query clients queries run over, each running one at a time, the least busy taking
+		// each query; 0 runs queries right away, alongside one another without bound
+		QueryClients: getValidNonNegativeInt("QUERY_CLIENTS", "0"),
+
+		// CacheMaxEntries and CacheMaxBytes bound each of the response caches, of the latest height and of past ones;
+		// the least recently used responses are evicted beyond either
+		CacheMaxEntries: getValidPositiveInt("CACHE_MAX_ENTRIES", "16384"),
+		CacheMaxBytes:   getValidPositiveInt("CACHE_MAX_BYTES", "536870912"),
+
+		// CachePolicies overrides how long the responses of routes are cached for, by path prefix, as a comma
+		// separated list of <prefix>=<no-store|until-next-block|ttl:<duration>|immutable>
+		CachePolicies: getEnvWithDefault("CACHE_POLICIES", ""),
+
+		// CachePersist persists the responses cached at a height, of immutable routes and of routes with a ttl on
+		// shutdown, up to CachePersistMaxBytes, for them to be loaded back on start rather than starting off cold
+		CachePersist:         getEnvWithDefault("CACHE_PERSIST", "false") == "true",
+		CachePersistMaxBytes: getValidPositiveInt("CACHE_PERSIST_MAX_BYTES", "268435456"),
+
+		// CachePersistIgnore drops the responses persisted rather than loading them, i.e. once a fix for a bug that
+		// got bad responses cached is deployed
+		CachePersistIgnore: getEnvWithDefault("CACHE_PERSIST_IGNORE", "false") == "true",
+
+		// RateLimitGlobal optionally bounds the requests to the LCD of all clients together, as <rps>[:<burst>]
+		RateLimitGlobal: getEnvWithDefault("RATE_LIMIT_GLOBAL", ""),
+
+		// RateLimits bounds the requests of each client ip, by path prefix, as a comma separated list of
+		// <prefix>=<rps>[:<burst>]; routes without a prefix aren't
+		RateLimits: getEnvWithDefault("RATE_LIMITS", ""),
+
+		// RateLimitTrustedProxies are the proxies, as ips or cidrs, the client ip is read off X-Forwarded-For behind
+		RateLimitTrustedProxies: splitList(getEnvWithDefault("RATE_LIMIT_TRUSTED_PROXIES", "")),
+
+		// RateLimitExempt are the clients, as ips or cidrs, that aren't rate limited, i.e. internal consumers
+		RateLimitExempt: splitList(getEnvWithDefault("RATE_LIMIT_EXEMPT", "")),
+
+		// CORSAllowedOrigins are the origins browsers may query the LCD from: "*" for any, or with a wildcard, i.e.
+		// https://*.example.com; none, without CORS headers, by default
+		CORSAllowedOrigins: splitList(getEnvWithDefault("CORS_ALLOWED_ORIGINS", "")),
+
+		// CORSAllowedMethods and CORSAllowedHeaders are the methods and request headers ("*" for any) CORS
+		// preflights allow, and CORSMaxAge how long browsers may cache them for
+		CORSAllowedMethods: splitList(getEnvWithDefault("CORS_ALLOWED_METHODS", "GET,POST,OPTIONS")),
+		CORSAllowedHeaders: splitList(getEnvWithDefault("CORS_ALLOWED_HEADERS", "*")),
+		CORSMaxAge:         getValidDuration("CORS_MAX_AGE", "10m"),
+
+		// TLSAddress optionally serves the LCD over TLS at this address (host:port), with the certificate of
+		// TLSCertFile and TLSKeyFile, besides its plain listener of app.toml's api.address
+		TLSAddress:  getEnvWithDefault("TLS_ADDRESS", ""),
+		TLSCertFile: getEnvWithDefault("TLS_CERT_FILE", ""),
+		TLSKeyFile:  getEnvWithDefault("TLS_KEY_FILE", ""),
+
+		// TLSClientCAFile, if set, is the CA admin routes require a client certificate of (mTLS), on either listener
+		TLSClientCAFile: getEnvWithDefault("TLS_CLIENT_CA_FILE", ""),
+
+		// TLSReloadInterval is how often the certificate files are checked for changes, i.e. renewals, to be
+		// reloaded; they're reloaded on SIGHUP too. 0 disables the check
+		TLSReloadInterval: getValidNonNegativeDuration("TLS_RELOAD_INTERVAL", "1m"),
+
+		// UnixSocketPath optionally serves the LCD on a unix socket at this path too, i.e. for a sidecar, with the
+		// permissions of UnixSocketMode, in octal
+		UnixSocketPath: getEnvWithDefault("UNIX_SOCKET_PATH", ""),
+		UnixSocketMode: getValidFileMode("UNIX_SOCKET_MODE", "0660"),
+
+		// EnableCompression compresses LCD responses of at least CompressionMinSize bytes, and of one of
+		// CompressionContentTypes, with gzip or deflate, as clients accept with Accept-Encoding
+		EnableCompression:       getEnvWithDefault("ENABLE_COMPRESSION", "true") == "true",
+		CompressionMinSize:      getValidNonNegativeInt("COMPRESSION_MIN_SIZE", "1024"),
+		CompressionContentTypes: splitList(getEnvWithDefault("COMPRESSION_CONTENT_TYPES", "application/json,text/*")),
+
+		// EnableAccessLog logs LCD requests to stdout, a json line each, one in AccessLogSample of them; those taking
+		// AccessLogSlowThreshold or longer are all logged, at warn level. Requests to AccessLogExclude aren't logged.
+		EnableAccessLog:        getEnvWithDefault("ENABLE_ACCESS_LOG", "false") == "true",
+		AccessLogSample:        getValidPositiveInt("ACCESS_LOG_SAMPLE", "1"),
+		AccessLogSlowThreshold: getValidDuration("ACCESS_LOG_SLOW_THRESHOLD", "1s"),
+		AccessLogExclude:       splitList(getEnvWithDefault("ACCESS_LOG_EXCLUDE", "/health,/health/live,/health/ready,/metrics")),
+	}
+
+	for tag, upstream := range map[string]string{
+		"TX_BROADCAST_UPSTREAM":     cfg.TxBroadcastUpstream,
+		"TX_BROADCAST_LCD_UPSTREAM": cfg.TxBroadcastLCDUpstream,
+	} {
+		if u, err := url.Parse(upstream); upstream != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			panic(fmt.Errorf("%s(%s) must be an http(s) url", tag, blockFeeder.RedactEndpoint(upstream)))
+		}
+	}
+
+	// headers for an endpoint that's not configured are most likely a typo
+	for endpoint := range cfg.FeedEndpointHeaders {
+		if !contains(cfg.RPCEndpoints, endpoint) && !contains(cfg.WSEndpoints, endpoint) {
+			panic(fmt.Errorf("FEED_ENDPOINT_HEADERS has headers for %s, which is neither in RPC_ENDPOINTS nor WS_ENDPOINTS", blockFeeder.RedactEndpoint(endpoint)))
+		}
 	}
 
+	for height, name := range cfg.UpgradeAllowAt {
+		if cfg.UpgradeSkipHeights[height] {
+			panic(fmt.Errorf("upgrade %s at height %d is both in UPGRADE_ALLOW_AT and UPGRADE_SKIP_HEIGHTS", name, height))
+		}
+	}
+
+	if cfg.KeepRecent != 0 && cfg.MinRetainHeight != 0 {
+		panic(fmt.Errorf("KEEP_RECENT(%d) and MIN_RETAIN_HEIGHT(%d) can't both be set", cfg.KeepRecent, cfg.MinRetainHeight))
+	}
+
+	if cfg.WSReconnectMaxDelay < cfg.WSReconnectBaseDelay {
+		panic(fmt.Errorf("WS_RECONNECT_MAX_DELAY(%s) must not be less than WS_RECONNECT_BASE_DELAY(%s)", cfg.WSReconnectMaxDelay, cfg.WSReconnectBaseDelay))
+	}
+
+	checkAdminAuth(cfg)
+
 	viper.SetConfigType("toml")
 	viper.SetConfigName("app")
 	viper.AutomaticEnv()
 	viper.AddConfigPath(filepath.Join(cfg.Home, "config"))
 
 	pflag.Bool(crisis.FlagSkipGenesisInvariants, false, "Skip x/crisis invariants check on startup")
+	replayFrom := pflag.Int64("replay-from", 0, "Re-execute blocks stored locally from this height, instead of syncing from the network")
+	replayTo := pflag.Int64("replay-to", 0, "Last height to replay; defaults to the last block stored")
+	replaySource := pflag.String("replay-source", "", "Blocks to replay or verify: a mantlemint indexer db, or a terrad blockstore.db")
+	exportHeight := pflag.Int64("height", 0, "Height to export app state at with `mantlemint export`; defaults to the latest")
+	exportOutput := pflag.String("output", "", "File to write the export to; defaults to stdout")
+	pinHeight := pflag.Int64("pin-height", 0, "Serve queries as of this height, read-only, without syncing")
 	pflag.Parse()
+
+	cfg.ExportHeight, cfg.ExportOutput = *exportHeight, *exportOutput
+	if cfg.ExportHeight < 0 {
+		panic(fmt.Errorf("--height(%d) must not be negative", cfg.ExportHeight))
+	}
+
+	cfg.ReplayFrom, cfg.ReplayTo, cfg.ReplaySource = *replayFrom, *replayTo, *replaySource
+	if cfg.ReplayFrom < 0 || cfg.ReplayTo < 0 {
+		panic(fmt.Errorf("--replay-from(%d) and --replay-to(%d) must not be negative", cfg.ReplayFrom, cfg.ReplayTo))
+	}
+	if cfg.ReplayFrom > 0 && cfg.ReplaySource == "" {
+		panic(fmt.Errorf("--replay-from needs --replay-source"))
+	}
+	if cfg.ReplayTo != 0 && cfg.ReplayTo < cfg.ReplayFrom {
+		panic(fmt.Errorf("--replay-to(%d) is below --replay-from(%d)", cfg.ReplayTo, cfg.ReplayFrom))
+	}
+
+	// a pinned node never writes, so it can't replay nor restore a snapshot
+	cfg.PinHeight = *pinHeight
+	if cfg.PinHeight < 0 {
+		panic(fmt.Errorf("--pin-height(%d) must not be negative", cfg.PinHeight))
+	}
+	if cfg.PinHeight > 0 && (cfg.ReplayFrom > 0 || cfg.StateSyncSnapshotDir != "") {
+		panic(fmt.Errorf("--pin-height can't be used along with --replay-from or STATE_SYNC_SNAPSHOT_DIR"))
+	}
+
+	// a standby never writes either; its home is its own, as the wasm vm of the followed mantlemint locks its dir
+	if cfg.FollowHome != "" && (cfg.PinHeight > 0 || cfg.ReplayFrom > 0 || cfg.StateSyncSnapshotDir != "") {
+		panic(fmt.Errorf("FOLLOW_HOME can't be used along with --pin-height, --replay-from or STATE_SYNC_SNAPSHOT_DIR"))
+	}
+	if cfg.FollowHome != "" && filepath.Clean(cfg.FollowHome) == filepath.Clean(cfg.Home) {
+		panic(fmt.Errorf("FOLLOW_HOME(%s) must not be MANTLEMINT_HOME, which is the standby's own", cfg.FollowHome))
+	}
 	if bindErr := viper.BindPFlags(pflag.CommandLine); bindErr != nil {
 		panic(bindErr)
 	}
 
 	if err := viper.MergeInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			panic(&StartupError{Code: ExitMissingAppConfig, Err: fmt.Errorf("app.toml not found in %s; copy terrad's config/app.toml there", filepath.Join(cfg.Home, "config"))})
+		}
 		panic(fmt.Errorf("failed to merge configuration: %w", err))
 	}
 
+	// Wasm is read from the [wasm] section of app.toml, with terra core's defaults for what's not there;
+	// WASM_* envvars take precedence over both
+	cfg.Wasm = newWasmConfig()
+
 	return cfg
 }
 
+// Print prints the config, with credentials of feed endpoints and consumers notified redacted
 func (cfg Config) Print() {
-	fmt.Printf("%+v\n", cfg)
+	redacted := cfg
+	redacted.RPCEndpoints = redactURLs(cfg.RPCEndpoints)
+	redacted.WSEndpoints = redactURLs(cfg.WSEndpoints)
+	if cfg.FeedProxyURL != "" {
+		redacted.FeedProxyURL = blockFeeder.RedactEndpoint(cfg.FeedProxyURL)
+	}
+	if cfg.BlockArchiveS3SecretAccessKey != "" {
+		redacted.BlockArchiveS3SecretAccessKey = "xxxxx"
+	}
+	if cfg.NotifyWebhookURL != "" {
+		redacted.NotifyWebhookURL = blockFeeder.RedactEndpoint(cfg.NotifyWebhookURL)
+	}
+	if cfg.TxBroadcastUpstream != "" {
+		redacted.TxBroadcastUpstream = blockFeeder.RedactEndpoint(cfg.TxBroadcastUpstream)
+	}
+	if cfg.TxBroadcastLCDUpstream != "" {
+		redacted.TxBroadcastLCDUpstream = blockFeeder.RedactEndpoint(cfg.TxBroadcastLCDUpstream)
+	}
+	if cfg.AdminToken != "" {
+		redacted.AdminToken = "xxxxx"
+	}
+	if cfg.NotifyNATSURL != "" {
+		redacted.NotifyNATSURL = blockFeeder.RedactEndpoint(cfg.NotifyNATSURL)
+	}
+	redacted.FeedEndpointHeaders = make(map[string]http.Header, len(cfg.FeedEndpointHeaders))
+	for endpoint, headers := range cfg.FeedEndpointHeaders {
+		redactedHeaders := make(http.Header, len(headers))
+		for key := range headers {
+			redactedHeaders.Set(key, "xxxxx")
+		}
+		redacted.FeedEndpointHeaders[blockFeeder.RedactEndpoint(endpoint)] = redactedHeaders
+	}
+
+	fmt.Printf("%+v\n", redacted)
+}
+
+func redactURLs(rawURLs []string) []string {
+	redacted := make([]string, len(rawURLs))
+	for i, rawURL := range rawURLs {
+		redacted[i] = blockFeeder.RedactEndpoint(rawURL)
+	}
+	return redacted
+}
+
+// checkAdminAuth refuses admin routes without auth: they pause, halt and flush mantlemint, on the LCD's port
+func checkAdminAuth(cfg Config) {
+	if cfg.EnableAdmin && cfg.AdminToken == "" && cfg.TLSClientCAFile == "" {
+		panic(fmt.Errorf("ENABLE_ADMIN needs ADMIN_TOKEN or TLS_CLIENT_CA_FILE, admin routes not being served unauthenticated"))
+	}
+}
+
+// splitList splits a comma separated list, leaving blank entries out
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newWasmConfig() wasmconfig.Config {
+	wasm := *wasmconfig.DefaultConfig()
+
+	wasm.ContractQueryGasLimit = getValidUint(
+		"WASM_CONTRACT_QUERY_GAS_LIMIT", "wasm.contract-query-gas-limit", wasm.ContractQueryGasLimit, 1, maxContractGasLimit)
+	wasm.ContractSimulationGasLimit = getValidUint(
+		"WASM_CONTRACT_SIMULATION_GAS_LIMIT", "wasm.contract-simulation-gas-limit", wasm.ContractSimulationGasLimit, 1, maxContractGasLimit)
+	wasm.ContractMemoryCacheSize = uint32(getValidUint(
+		"WASM_CONTRACT_MEMORY_CACHE_SIZE", "wasm.contract-memory-cache-size", uint64(wasm.ContractMemoryCacheSize), 0, maxContractMemoryCacheSize))
+
+	debugMode := getEnvWithDefault("WASM_CONTRACT_DEBUG_MODE", viper.GetString("wasm.contract-debug-mode"))
+	if debugMode != "" {
+		parsed, err := strconv.ParseBool(debugMode)
+		if err != nil {
+			panic(fmt.Errorf("WASM_CONTRACT_DEBUG_MODE or wasm.contract-debug-mode in app.toml (%s) is invalid: %v", debugMode, err))
+		}
+		wasm.ContractDebugMode = parsed
+	}
+
+	return wasm
+}
+
+// getValidUint reads tag, falling back to key of app.toml and then to fallback, within [min, max]
+func getValidUint(tag string, key string, fallback uint64, min uint64, max uint64) uint64 {
+	valueStr := getEnvWithDefault(tag, viper.GetString(key))
+	if valueStr == "" {
+		return fallback
+	}
+
+	value, err := strconv.ParseUint(valueStr, 10, 64)
+	if err != nil {
+		panic(fmt.Errorf("%s or %s in app.toml (%s) is invalid: %v", tag, key, valueStr, err))
+	}
+	if value < min || value > max {
+		panic(fmt.Errorf("%s or %s in app.toml (%s) must be within [%d, %d]", tag, key, valueStr, min, max))
+	}
+	return value
 }
 
 func getValidEnv(tag string) string {
@@ -146,3 +909,73 @@ func getValidEnv(tag string) string {
 		return e
 	}
 }
+
+// getEnvWithDefault returns the value of the envvar, or fallback if it is not set.
+// Use this for optional configs only.
+func getEnvWithDefault(tag string, fallback string) string {
+	if e := os.Getenv(tag); e == "" {
+		return fallback
+	} else {
+		return e
+	}
+}
+
+func getValidDuration(tag string, fallback string) time.Duration {
+	durationStr := getEnvWithDefault(tag, fallback)
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		panic(fmt.Errorf("%s(%s) is invalid: %v", tag, durationStr, err))
+	}
+	if duration <= 0 {
+		panic(fmt.Errorf("%s(%s) must be positive", tag, durationStr))
+	}
+	return duration
+}
+
+func getValidNonNegativeDuration(tag string, fallback string) time.Duration {
+	durationStr := getEnvWithDefault(tag, fallback)
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		panic(fmt.Errorf("%s(%s) is invalid: %v", tag, durationStr, err))
+	}
+	if duration < 0 {
+		panic(fmt.Errorf("%s(%s) must not be negative", tag, durationStr))
+	}
+	return duration
+}
+
+func getValidFileMode(tag string, fallback string) os.FileMode {
+	modeStr := getEnvWithDefault(tag, fallback)
+	mode, err := strconv.ParseUint(modeStr, 8, 32)
+	if err != nil {
+		panic(fmt.Errorf("%s(%s) is invalid: %v", tag, modeStr, err))
+	}
+	if mode > 0o777 {
+		panic(fmt.Errorf("%s(%s) must be permission bits, within [0, 0777]", tag, modeStr))
+	}
+	return os.FileMode(mode)
+}
+
+func getValidNonNegativeInt(tag string, fallback string) int {
+	valueStr := getEnvWithDefault(tag, fallback)
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		panic(fmt.Errorf("%s(%s) is invalid: %v", tag, valueStr, err))
+	}
+	if value < 0 {
+		panic(fmt.Errorf("%s(%s) must not be negative", tag, valueStr))
+	}
+	return value
+}
+
+func getValidPositiveInt(tag string, fallback string) int {
+	valueStr := getEnvWithDefault(tag, fallback)
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		panic(fmt.Errorf("%s(%s) is invalid: %v", tag, valueStr, err))
+	}
+	if value < 1 {
+		panic(fmt.Errorf("%s(%s) must be positive", tag, valueStr))
+	}
+	return value
+}
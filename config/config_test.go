@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	wasmconfig "github.com/terra-money/core/v2/app/wasmconfig"
+)
+
+func TestCheckAdminAuth(t *testing.T) {
+	// admin routes are only served with a token or client certificates to authenticate them
+	assert.Panics(t, func() { checkAdminAuth(Config{EnableAdmin: true}) })
+	assert.NotPanics(t, func() { checkAdminAuth(Config{EnableAdmin: true, AdminToken: "token"}) })
+	assert.NotPanics(t, func() { checkAdminAuth(Config{EnableAdmin: true, TLSClientCAFile: "ca.pem"}) })
+	assert.NotPanics(t, func() { checkAdminAuth(Config{}) })
+}
+
+func TestNewWasmConfig(t *testing.T) {
+	defer viper.Reset()
+
+	// terra core's defaults, for what neither app.toml nor env vars set
+	wasm := newWasmConfig()
+	assert.Equal(t, *wasmconfig.DefaultConfig(), wasm)
+
+	// app.toml, then env vars taking precedence over it
+	viper.Set("wasm.contract-query-gas-limit", "5000000")
+	viper.Set("wasm.contract-memory-cache-size", "512")
+	t.Setenv("WASM_CONTRACT_SIMULATION_GAS_LIMIT", "60000000")
+	t.Setenv("WASM_CONTRACT_MEMORY_CACHE_SIZE", "0")
+	t.Setenv("WASM_CONTRACT_DEBUG_MODE", "true")
+	wasm = newWasmConfig()
+	assert.Equal(t, uint64(5_000_000), wasm.ContractQueryGasLimit)
+	assert.Equal(t, uint64(60_000_000), wasm.ContractSimulationGasLimit)
+	assert.Equal(t, uint32(0), wasm.ContractMemoryCacheSize)
+	assert.True(t, wasm.ContractDebugMode)
+
+	// the bounds are inclusive
+	t.Setenv("WASM_CONTRACT_QUERY_GAS_LIMIT", "1")
+	t.Setenv("WASM_CONTRACT_SIMULATION_GAS_LIMIT", "1000000000")
+	t.Setenv("WASM_CONTRACT_MEMORY_CACHE_SIZE", "1048576")
+	assert.NotPanics(t, func() { newWasmConfig() })
+}
+
+func TestNewWasmConfigRejected(t *testing.T) {
+	defer viper.Reset()
+
+	for _, c := range []struct {
+		tag   string
+		value string
+	}{
+		{"WASM_CONTRACT_QUERY_GAS_LIMIT", "0"},
+		{"WASM_CONTRACT_QUERY_GAS_LIMIT", "1000000001"},
+		{"WASM_CONTRACT_QUERY_GAS_LIMIT", "-1"},
+		{"WASM_CONTRACT_SIMULATION_GAS_LIMIT", "0"},
+		{"WASM_CONTRACT_SIMULATION_GAS_LIMIT", "lots"},
+		{"WASM_CONTRACT_MEMORY_CACHE_SIZE", "1048577"},
+		{"WASM_CONTRACT_DEBUG_MODE", "maybe"},
+	} {
+		t.Run(c.tag+"="+c.value, func(t *testing.T) {
+			t.Setenv(c.tag, c.value)
+			assert.Panics(t, func() { newWasmConfig() })
+		})
+	}
+
+	// out of bounds in app.toml too
+	viper.Set("wasm.contract-query-gas-limit", "0")
+	assert.Panics(t, func() { newWasmConfig() })
+}
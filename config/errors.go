@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// exit codes of startup errors, one per check; apart from 1 (any other error) and 2 (a panic)
+const (
+	ExitInvalidConfig    = 10
+	ExitMissingAppConfig = 11
+	ExitInvalidGenesis   = 12
+	ExitChainIDMismatch  = 13
+	ExitHomeNotWritable  = 14
+	ExitDBLocked         = 15
+	ExitNoEndpoints      = 16
+)
+
+// StartupError is a misconfiguration found on startup, which mantlemint exits on with Code
+// after printing the error on one line
+type StartupError struct {
+	Code int
+	Err  error
+}
+
+func (e *StartupError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StartupError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the code to exit with on err: its own if it's a StartupError, 1 otherwise
+func ExitCode(err error) int {
+	var startupErr *StartupError
+	if errors.As(err, &startupErr) {
+		return startupErr.Code
+	}
+	return 1
+}
+
+// recoverConfigError turns what newConfig panics with on an invalid config into err; bugs still panic
+func recoverConfigError(err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if _, isRuntimeErr := p.(runtime.Error); isRuntimeErr {
+		panic(p)
+	}
+
+	var startupErr *StartupError
+	switch cause := p.(type) {
+	case *StartupError:
+		*err = cause
+	case error:
+		if errors.As(cause, &startupErr) {
+			*err = startupErr
+		} else {
+			*err = &StartupError{Code: ExitInvalidConfig, Err: cause}
+		}
+	default:
+		*err = &StartupError{Code: ExitInvalidConfig, Err: fmt.Errorf("%v", cause)}
+	}
+}
@@ -0,0 +1,240 @@
+package follower
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	leveldbErrors "github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var _ tmdb.DB = (*DB)(nil)
+
+// DB reads a goleveldb another process writes to, as tmdb.NewGoLevelDB would open it, without locking it out:
+// it's read as of when it was opened, or last refreshed, as a warm standby of the writer serving the same data.
+//
+// Every refresh opens the db anew over its files; reads in flight, iterators included, carry on over the files
+// they started on, which are let go of once they're done. A read may find the files it needs compacted away by
+// the writer in the meantime, which is retried over a refresh, except for iterators, which fail.
+type DB struct {
+	dir string
+
+	mtx     sync.RWMutex
+	current *view
+	closed  bool
+}
+
+// view is the db as of when it was opened; it's closed once retired, and every read of it is done
+type view struct {
+	db      *leveldb.DB
+	storage *readOnlyStorage
+	reads   sync.WaitGroup
+}
+
+// Open opens the goleveldb name in dir, i.e. $dir/$name.db, for reads only
+func Open(name, dir string) (*DB, error) {
+	db := &DB{dir: filepath.Join(dir, name+".db")}
+	current, err := db.open()
+	if err != nil {
+		return nil, err
+	}
+	db.current = current
+	return db, nil
+}
+
+func (db *DB) open() (*view, error) {
+	stor, err := openReadOnlyStorage(db.dir)
+	if err != nil {
+		return nil, err
+	}
+	ldb, err := leveldb.Open(stor, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		_ = stor.Close()
+		return nil, fmt.Errorf("failed to open %s read-only: %w", db.dir, err)
+	}
+	return &view{db: ldb, storage: stor}, nil
+}
+
+// Refresh opens the db anew, to read what was written since; the view it replaces is closed once reads of it are done
+func (db *DB) Refresh() error {
+	next, err := db.open()
+	if err != nil {
+		return err
+	}
+
+	db.mtx.Lock()
+	if db.closed {
+		db.mtx.Unlock()
+		db.retire(next)
+		return leveldb.ErrClosed
+	}
+	retired := db.current
+	db.current = next
+	db.mtx.Unlock()
+
+	go db.retire(retired)
+	return nil
+}
+
+func (db *DB) retire(v *view) {
+	v.reads.Wait()
+	_ = v.db.Close()
+	_ = v.storage.Close()
+}
+
+// acquire returns the current view, to be released once read from
+func (db *DB) acquire() (*view, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if db.closed {
+		return nil, leveldb.ErrClosed
+	}
+	db.current.reads.Add(1)
+	return db.current, nil
+}
+
+// isCompactedAway tells whether err is of a file compacted away by the writer while it was read
+func isCompactedAway(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || leveldbErrors.IsCorrupted(err)
+}
+
+// Get implements tmdb.DB.
+func (db *DB) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key cannot be empty")
+	}
+	value, err := db.get(key)
+	if isCompactedAway(err) {
+		if err := db.Refresh(); err != nil {
+			return nil, err
+		}
+		value, err = db.get(key)
+	}
+	return value, err
+}
+
+func (db *DB) get(key []byte) ([]byte, error) {
+	v, err := db.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer v.reads.Done()
+
+	value, err := v.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Has implements tmdb.DB.
+func (db *DB) Has(key []byte) (bool, error) {
+	value, err := db.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// Iterator implements tmdb.DB.
+func (db *DB) Iterator(start, end []byte) (tmdb.Iterator, error) {
+	return db.newIterator(start, end, false)
+}
+
+// ReverseIterator implements tmdb.DB.
+func (db *DB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
+	return db.newIterator(start, end, true)
+}
+
+func (db *DB) newIterator(start, end []byte, isReverse bool) (tmdb.Iterator, error) {
+	if (start != nil && len(start) == 0) || (end != nil && len(end) == 0) {
+		return nil, errors.New("key cannot be empty")
+	}
+	v, err := db.acquire()
+	if err != nil {
+		return nil, err
+	}
+	source := v.db.NewIterator(&util.Range{Start: start, Limit: end}, nil)
+	return newIterator(source, start, end, isReverse, v.reads.Done), nil
+}
+
+// Set implements tmdb.DB; the db is only written to by its writer
+func (db *DB) Set(_, _ []byte) error {
+	return ErrReadOnly
+}
+
+// SetSync implements tmdb.DB; the db is only written to by its writer
+func (db *DB) SetSync(_, _ []byte) error {
+	return ErrReadOnly
+}
+
+// Delete implements tmdb.DB; the db is only written to by its writer
+func (db *DB) Delete(_ []byte) error {
+	return ErrReadOnly
+}
+
+// DeleteSync implements tmdb.DB; the db is only written to by its writer
+func (db *DB) DeleteSync(_ []byte) error {
+	return ErrReadOnly
+}
+
+// NewBatch implements tmdb.DB; writing the batch fails, as the db is only written to by its writer
+func (db *DB) NewBatch() tmdb.Batch {
+	return readOnlyBatch{}
+}
+
+// Close implements tmdb.DB; the last view is closed once reads of it are done, in the background
+func (db *DB) Close() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	go db.retire(db.current)
+	return nil
+}
+
+// Print implements tmdb.DB.
+func (db *DB) Print() error {
+	itr, err := db.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		fmt.Printf("[%X]:\t[%X]\n", itr.Key(), itr.Value())
+	}
+	return itr.Error()
+}
+
+// Stats implements tmdb.DB.
+func (db *DB) Stats() map[string]string {
+	v, err := db.acquire()
+	if err != nil {
+		return nil
+	}
+	defer v.reads.Done()
+
+	stats := make(map[string]string)
+	for _, key := range []string{"leveldb.stats", "leveldb.sstables", "leveldb.openedtables", "leveldb.aliveiters"} {
+		if str, err := v.db.GetProperty(key); err == nil {
+			stats[key] = str
+		}
+	}
+	return stats
+}
+
+type readOnlyBatch struct{}
+
+func (readOnlyBatch) Set(_, _ []byte) error { return ErrReadOnly }
+func (readOnlyBatch) Delete(_ []byte) error { return ErrReadOnly }
+func (readOnlyBatch) Write() error          { return ErrReadOnly }
+func (readOnlyBatch) WriteSync() error      { return ErrReadOnly }
+func (readOnlyBatch) Close() error          { return nil }
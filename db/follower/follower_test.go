@@ -0,0 +1,59 @@
+package follower
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func TestFollow(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := tmdb.NewGoLevelDB("test", dir)
+	assert.Nil(t, err)
+	defer writer.Close()
+	assert.Nil(t, writer.Set([]byte("a"), []byte("1")))
+
+	// the writer's lock doesn't keep the db from being followed
+	follower, err := Open("test", dir)
+	assert.Nil(t, err)
+	defer follower.Close()
+	value, err := follower.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+	assert.ErrorIs(t, follower.Set([]byte("a"), []byte("2")), ErrReadOnly)
+
+	// what's written since is only read once refreshed, while an iterator carries on over what it started on
+	itr, err := follower.Iterator(nil, nil)
+	assert.Nil(t, err)
+	for i := 0; i < 10_000; i++ {
+		assert.Nil(t, writer.Set([]byte(fmt.Sprintf("b%05d", i)), make([]byte, 1024)))
+	}
+	assert.Nil(t, writer.ForceCompact(nil, nil))
+	value, err = follower.Get([]byte("b00000"))
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	assert.Nil(t, follower.Refresh())
+	value, err = follower.Get([]byte("b00000"))
+	assert.Nil(t, err)
+	assert.Len(t, value, 1024)
+
+	var keys int
+	for ; itr.Valid(); itr.Next() {
+		keys++
+	}
+	assert.Nil(t, itr.Error())
+	assert.Equal(t, 1, keys)
+	assert.Nil(t, itr.Close())
+
+	itr, err = follower.ReverseIterator([]byte("b"), []byte("b00002"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b00001"), itr.Key())
+	itr.Next()
+	assert.Equal(t, []byte("b00000"), itr.Key())
+	itr.Next()
+	assert.False(t, itr.Valid())
+	assert.Nil(t, itr.Close())
+}
@@ -0,0 +1,113 @@
+package follower
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var _ tmdb.Iterator = (*Iterator)(nil)
+
+// Iterator iterates over the view of the db it was created on, as tm-db's goleveldb iterator does;
+// the view is released on Close
+type Iterator struct {
+	source    iterator.Iterator
+	start     []byte
+	end       []byte
+	isReverse bool
+	isInvalid bool
+
+	release     func()
+	releaseOnce sync.Once
+}
+
+func newIterator(source iterator.Iterator, start, end []byte, isReverse bool, release func()) *Iterator {
+	if isReverse {
+		if end == nil || !source.Seek(end) {
+			source.Last()
+		} else if bytes.Compare(end, source.Key()) <= 0 {
+			source.Prev()
+		}
+	} else {
+		if start == nil {
+			source.First()
+		} else {
+			source.Seek(start)
+		}
+	}
+	return &Iterator{
+		source:    source,
+		start:     start,
+		end:       end,
+		isReverse: isReverse,
+		release:   release,
+	}
+}
+
+// Domain implements tmdb.Iterator.
+func (itr *Iterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+// Valid implements tmdb.Iterator.
+func (itr *Iterator) Valid() bool {
+	if itr.isInvalid {
+		return false
+	}
+	if itr.Error() != nil || !itr.source.Valid() {
+		itr.isInvalid = true
+		return false
+	}
+
+	key := itr.source.Key()
+	if itr.isReverse && itr.start != nil && bytes.Compare(key, itr.start) < 0 ||
+		!itr.isReverse && itr.end != nil && bytes.Compare(itr.end, key) <= 0 {
+		itr.isInvalid = true
+		return false
+	}
+	return true
+}
+
+// Key implements tmdb.Iterator.
+func (itr *Iterator) Key() []byte {
+	itr.assertIsValid()
+	return append([]byte{}, itr.source.Key()...)
+}
+
+// Value implements tmdb.Iterator.
+func (itr *Iterator) Value() []byte {
+	itr.assertIsValid()
+	return append([]byte{}, itr.source.Value()...)
+}
+
+// Next implements tmdb.Iterator.
+func (itr *Iterator) Next() {
+	itr.assertIsValid()
+	if itr.isReverse {
+		itr.source.Prev()
+	} else {
+		itr.source.Next()
+	}
+}
+
+// Error implements tmdb.Iterator.
+func (itr *Iterator) Error() error {
+	return itr.source.Error()
+}
+
+// Close implements tmdb.Iterator.
+func (itr *Iterator) Close() error {
+	itr.releaseOnce.Do(func() {
+		itr.source.Release()
+		itr.release()
+	})
+	return nil
+}
+
+func (itr *Iterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,186 @@
+package follower
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// ErrReadOnly is returned on writes to a db that's followed; only its writer writes to it
+var ErrReadOnly = errors.New("db is followed read-only")
+
+var _ storage.Storage = (*readOnlyStorage)(nil)
+
+// readOnlyStorage is the storage of a leveldb written by another process, opened read-only without taking its lock.
+// leveldb's own file storage locks the dir even when read-only, which a writer holding it excludes.
+//
+// Once leveldb has read the manifest, it replays the journals that were there before it; a journal rotated out
+// meanwhile would be missing otherwise, while what it holds may not be in the tables the manifest read lists yet.
+// The journals are listed and opened beforehand for that, and the manifest read after; what's read is the db as
+// of some point in between. Tables are opened as they're read from, and may have been compacted away by then.
+type readOnlyStorage struct {
+	dir      string
+	journals map[int64]*os.File
+}
+
+func openReadOnlyStorage(dir string) (*readOnlyStorage, error) {
+	s := &readOnlyStorage{dir: dir, journals: map[int64]*os.File{}}
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		fd, ok := parseName(name)
+		if !ok || fd.Type != storage.TypeJournal {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+		s.journals[fd.Num] = file
+	}
+	return s, nil
+}
+
+// Lock doesn't lock anything; the lock is the writer's
+func (s *readOnlyStorage) Lock() (storage.Locker, error) {
+	return noopLocker{}, nil
+}
+
+func (s *readOnlyStorage) Log(_ string) {}
+
+// GetMeta reads the manifest CURRENT points to; a manifest being switched to is not, as is the writer's to do
+func (s *readOnlyStorage) GetMeta() (storage.FileDesc, error) {
+	current, err := os.ReadFile(filepath.Join(s.dir, "CURRENT"))
+	if err != nil {
+		return storage.FileDesc{}, err
+	}
+	fd, ok := parseName(string(bytes.TrimSuffix(current, []byte("\n"))))
+	if !ok || fd.Type != storage.TypeManifest || !bytes.HasSuffix(current, []byte("\n")) {
+		return storage.FileDesc{}, &storage.ErrCorrupted{Err: fmt.Errorf("corrupted or incomplete CURRENT file: %q", current)}
+	}
+	return fd, nil
+}
+
+func (s *readOnlyStorage) List(ft storage.FileType) ([]storage.FileDesc, error) {
+	var fds []storage.FileDesc
+	if ft&storage.TypeJournal != 0 {
+		for num := range s.journals {
+			fds = append(fds, storage.FileDesc{Type: storage.TypeJournal, Num: num})
+		}
+		if ft &^= storage.TypeJournal; ft == 0 {
+			return fds, nil
+		}
+	}
+
+	names, err := readDirNames(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if fd, ok := parseName(name); ok && fd.Type&ft != 0 {
+			fds = append(fds, fd)
+		}
+	}
+	return fds, nil
+}
+
+func (s *readOnlyStorage) Open(fd storage.FileDesc) (storage.Reader, error) {
+	if fd.Type == storage.TypeJournal {
+		if journal, ok := s.journals[fd.Num]; ok {
+			delete(s.journals, fd.Num)
+			return journal, nil
+		}
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, genName(fd)))
+	if os.IsNotExist(err) && fd.Type == storage.TypeTable {
+		file, err = os.Open(filepath.Join(s.dir, fmt.Sprintf("%06d.sst", fd.Num)))
+	}
+	return file, err
+}
+
+func (s *readOnlyStorage) SetMeta(_ storage.FileDesc) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStorage) Create(_ storage.FileDesc) (storage.Writer, error) {
+	return nil, ErrReadOnly
+}
+
+func (s *readOnlyStorage) Remove(_ storage.FileDesc) error {
+	return ErrReadOnly
+}
+
+func (s *readOnlyStorage) Rename(_, _ storage.FileDesc) error {
+	return ErrReadOnly
+}
+
+// Close closes the journals leveldb didn't replay
+func (s *readOnlyStorage) Close() error {
+	for num, journal := range s.journals {
+		_ = journal.Close()
+		delete(s.journals, num)
+	}
+	return nil
+}
+
+type noopLocker struct{}
+
+func (noopLocker) Unlock() {}
+
+// genName and parseName name files as leveldb's file storage does
+func genName(fd storage.FileDesc) string {
+	switch fd.Type {
+	case storage.TypeManifest:
+		return fmt.Sprintf("MANIFEST-%06d", fd.Num)
+	case storage.TypeJournal:
+		return fmt.Sprintf("%06d.log", fd.Num)
+	case storage.TypeTable:
+		return fmt.Sprintf("%06d.ldb", fd.Num)
+	default:
+		return fmt.Sprintf("%06d.tmp", fd.Num)
+	}
+}
+
+func parseName(name string) (fd storage.FileDesc, ok bool) {
+	var tail string
+	if _, err := fmt.Sscanf(name, "%d.%s", &fd.Num, &tail); err == nil {
+		switch tail {
+		case "log":
+			fd.Type = storage.TypeJournal
+		case "ldb", "sst":
+			fd.Type = storage.TypeTable
+		case "tmp":
+			fd.Type = storage.TypeTemp
+		default:
+			return fd, false
+		}
+		return fd, true
+	}
+	if n, _ := fmt.Sscanf(name, "MANIFEST-%d%s", &fd.Num, &tail); n == 1 {
+		fd.Type = storage.TypeManifest
+		return fd, true
+	}
+	return fd, false
+}
+
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
@@ -4,4 +4,11 @@ type DriverConfig struct {
 	Name string
 	Dir  string
 	Mode int
+
+	// ReadOnly opens the db without taking it over for writes; writing to it fails
+	ReadOnly bool
+
+	// Follow opens the db of a mantlemint running off it, for reads only and without locking it out; the db
+	// is read as of when it was opened, or last refreshed. See Driver.Refresh
+	Follow bool
 }
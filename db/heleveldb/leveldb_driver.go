@@ -3,27 +3,75 @@ package heleveldb
 import (
 	"fmt"
 	"math"
+	"sync/atomic"
 
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/db/follower"
 	"github.com/terra-money/mantlemint/db/hld"
 	"github.com/terra-money/mantlemint/lib"
 )
 
 type Driver struct {
-	session *tmdb.GoLevelDB
+	session tmdb.DB
 	mode    int
+
+	// lowest height reads are served at, see Prune
+	prunedHeight int64
 }
 
 func NewLevelDBDriver(config *DriverConfig) (*Driver, error) {
-	ldb, err := tmdb.NewGoLevelDB(config.Name, config.Dir)
+	var ldb tmdb.DB
+	var err error
+	if config.Follow {
+		ldb, err = follower.Open(config.Name, config.Dir)
+	} else {
+		ldb, err = tmdb.NewGoLevelDBWithOpts(config.Name, config.Dir, &opt.Options{ReadOnly: config.ReadOnly})
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &Driver{
+	driver := &Driver{
 		session: ldb,
 		mode:    config.Mode,
-	}, nil
+	}
+	if err := driver.loadPrunedHeight(); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+func (d *Driver) loadPrunedHeight() error {
+	prunedHeight, err := d.session.Get(cPrunedHeightKey)
+	if err != nil {
+		return err
+	}
+	if len(prunedHeight) == 8 {
+		atomic.StoreInt64(&d.prunedHeight, int64(lib.BigEndianToUint(prunedHeight)))
+	}
+	return nil
+}
+
+// Refresh reads what was written since the db was opened, or last refreshed, by the mantlemint it's followed off;
+// the db must have been opened with DriverConfig.Follow
+func (d *Driver) Refresh() error {
+	followed, ok := d.session.(*follower.DB)
+	if !ok {
+		return fmt.Errorf("db isn't followed, there's nothing to refresh")
+	}
+	if err := followed.Refresh(); err != nil {
+		return err
+	}
+	return d.loadPrunedHeight()
+}
+
+// NewMemDBDriver creates a driver keeping everything in memory, i.e. for tests
+func NewMemDBDriver(mode int) *Driver {
+	return &Driver{
+		session: tmdb.NewMemDB(),
+		mode:    mode,
+	}
 }
 
 func (d *Driver) newInnerIterator(requestHeight int64, pdb *tmdb.PrefixDB) (tmdb.Iterator, error) {
@@ -40,6 +88,9 @@ func (d *Driver) Get(maxHeight int64, key []byte) ([]byte, error) {
 	if maxHeight == 0 {
 		return d.session.Get(prefixCurrentDataKey(key))
 	}
+	if err := d.checkPruned(maxHeight); err != nil {
+		return nil, err
+	}
 	var requestHeight = hld.Height(maxHeight).CurrentOrLatest().ToInt64()
 	var requestHeightMin = hld.Height(0).CurrentOrNever().ToInt64()
 
@@ -74,6 +125,9 @@ func (d *Driver) Has(maxHeight int64, key []byte) (bool, error) {
 	if maxHeight == 0 {
 		return d.session.Has(prefixCurrentDataKey(key))
 	}
+	if err := d.checkPruned(maxHeight); err != nil {
+		return false, err
+	}
 	var requestHeight = hld.Height(maxHeight).CurrentOrLatest().ToInt64()
 	var requestHeightMin = hld.Height(0).CurrentOrNever().ToInt64()
 
@@ -125,6 +179,9 @@ func (d *Driver) Iterator(maxHeight int64, start, end []byte) (hld.HeightLimitEn
 		pdb := tmdb.NewPrefixDB(d.session, cCurrentDataPrefix)
 		return pdb.Iterator(start, end)
 	}
+	if err := d.checkPruned(maxHeight); err != nil {
+		return nil, err
+	}
 	return NewLevelDBIterator(d, maxHeight, start, end)
 }
 
@@ -133,6 +190,9 @@ func (d *Driver) ReverseIterator(maxHeight int64, start, end []byte) (hld.Height
 		pdb := tmdb.NewPrefixDB(d.session, cCurrentDataPrefix)
 		return pdb.ReverseIterator(start, end)
 	}
+	if err := d.checkPruned(maxHeight); err != nil {
+		return nil, err
+	}
 	return NewLevelDBReverseIterator(d, maxHeight, start, end)
 }
 
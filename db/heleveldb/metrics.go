@@ -0,0 +1,79 @@
+package heleveldb
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/syndtr/goleveldb/leveldb"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var (
+	levelDBCompactions = prometheus.NewDesc("mantlemint_leveldb_compactions_total",
+		"Compactions of the leveldb since it was opened, by type: memtable, level0, non_level0 or seek.", []string{"type"}, nil)
+	levelDBCompactionSeconds = prometheus.NewDesc("mantlemint_leveldb_compaction_seconds_total",
+		"Time spent compacting levels of the leveldb since it was opened, by level.", []string{"level"}, nil)
+	levelDBLevelBytes = prometheus.NewDesc("mantlemint_leveldb_level_bytes",
+		"Size of the tables of a level of the leveldb.", []string{"level"}, nil)
+	levelDBLevelTables = prometheus.NewDesc("mantlemint_leveldb_level_tables",
+		"Number of tables of a level of the leveldb.", []string{"level"}, nil)
+	levelDBWriteDelaySeconds = prometheus.NewDesc("mantlemint_leveldb_write_delay_seconds_total",
+		"Time writes were delayed for compactions to catch up since the leveldb was opened.", nil, nil)
+	levelDBWritePaused = prometheus.NewDesc("mantlemint_leveldb_write_paused",
+		"Whether writes are paused for compactions to catch up.", nil, nil)
+	levelDBIOBytes = prometheus.NewDesc("mantlemint_leveldb_io_bytes_total",
+		"Bytes read and written by the leveldb since it was opened, by direction: read or write.", []string{"direction"}, nil)
+)
+
+// LevelDB is the leveldb d runs on, or nil if it runs on another db, i.e. in memory or followed
+func (d *Driver) LevelDB() *leveldb.DB {
+	if goLevelDB, ok := d.session.(*tmdb.GoLevelDB); ok {
+		return goLevelDB.DB()
+	}
+	return nil
+}
+
+// StatsCollector exports the stats of a leveldb to prometheus, as they are when scraped: compactions, the size of
+// levels, write stalls and io
+type StatsCollector struct {
+	db *leveldb.DB
+}
+
+func NewStatsCollector(db *leveldb.DB) *StatsCollector {
+	return &StatsCollector{db: db}
+}
+
+func (c *StatsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{levelDBCompactions, levelDBCompactionSeconds, levelDBLevelBytes, levelDBLevelTables, levelDBWriteDelaySeconds, levelDBWritePaused, levelDBIOBytes} {
+		descs <- desc
+	}
+}
+
+// Collect collects nothing once the db is closed
+func (c *StatsCollector) Collect(metrics chan<- prometheus.Metric) {
+	var stats leveldb.DBStats
+	if err := c.db.Stats(&stats); err != nil {
+		return
+	}
+
+	for compaction, count := range map[string]uint32{"memtable": stats.MemComp, "level0": stats.Level0Comp, "non_level0": stats.NonLevel0Comp, "seek": stats.SeekComp} {
+		metrics <- prometheus.MustNewConstMetric(levelDBCompactions, prometheus.CounterValue, float64(count), compaction)
+	}
+	for level, duration := range stats.LevelDurations {
+		metrics <- prometheus.MustNewConstMetric(levelDBCompactionSeconds, prometheus.CounterValue, duration.Seconds(), strconv.Itoa(level))
+	}
+	for level, size := range stats.LevelSizes {
+		metrics <- prometheus.MustNewConstMetric(levelDBLevelBytes, prometheus.GaugeValue, float64(size), strconv.Itoa(level))
+	}
+	for level, tables := range stats.LevelTablesCounts {
+		metrics <- prometheus.MustNewConstMetric(levelDBLevelTables, prometheus.GaugeValue, float64(tables), strconv.Itoa(level))
+	}
+	metrics <- prometheus.MustNewConstMetric(levelDBWriteDelaySeconds, prometheus.CounterValue, stats.WriteDelayDuration.Seconds())
+	paused := 0.0
+	if stats.WritePaused {
+		paused = 1
+	}
+	metrics <- prometheus.MustNewConstMetric(levelDBWritePaused, prometheus.GaugeValue, paused)
+	metrics <- prometheus.MustNewConstMetric(levelDBIOBytes, prometheus.CounterValue, float64(stats.IORead), "read")
+	metrics <- prometheus.MustNewConstMetric(levelDBIOBytes, prometheus.CounterValue, float64(stats.IOWrite), "write")
+}
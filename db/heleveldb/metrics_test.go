@@ -0,0 +1,28 @@
+package heleveldb
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsCollector(t *testing.T) {
+	driver, err := NewLevelDBDriver(&DriverConfig{Name: "stats", Dir: t.TempDir(), Mode: DriverModeKeySuffixDesc})
+	assert.Nil(t, err)
+	batch := driver.NewBatch(1)
+	assert.Nil(t, batch.Set([]byte("key"), []byte("value")))
+	assert.Nil(t, batch.WriteSync())
+	assert.Nil(t, batch.Close())
+
+	collector := NewStatsCollector(driver.LevelDB())
+	assert.NotZero(t, testutil.CollectAndCount(collector, "mantlemint_leveldb_compactions_total"))
+	assert.NotZero(t, testutil.CollectAndCount(collector, "mantlemint_leveldb_io_bytes_total"))
+
+	// nothing is collected off a closed db
+	assert.Nil(t, driver.Close())
+	assert.Zero(t, testutil.CollectAndCount(collector))
+
+	// nor off dbs that aren't leveldbs
+	assert.Nil(t, NewMemDBDriver(DriverModeKeySuffixDesc).LevelDB())
+}
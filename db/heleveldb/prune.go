@@ -0,0 +1,152 @@
+package heleveldb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/lib"
+)
+
+var _ hld.Prunable = (*Driver)(nil)
+
+// number of keys pruned per batch; batches are small so that blocks written meanwhile are never held up for long
+const pruneBatchKeys = 1000
+
+func (d *Driver) PrunedHeight() int64 {
+	return atomic.LoadInt64(&d.prunedHeight)
+}
+
+// checkPruned fails reads at a height below the one pruned to
+func (d *Driver) checkPruned(height int64) error {
+	if prunedHeight := d.PrunedHeight(); height < prunedHeight {
+		return fmt.Errorf("%w: %d is below the lowest height retained, %d", hld.ErrHeightPruned, height, prunedHeight)
+	}
+	return nil
+}
+
+// Prune deletes the versions of keys no read at or above height sees anymore: for every key, the versions
+// below the last one at or below height, and that one as well if it's a deletion. The height is recorded
+// before anything is deleted, so that reads below it fail with hld.ErrHeightPruned from the start.
+//
+// Keys are pruned a batch at a time, with nothing held in between, until done or stop is closed; a prune
+// that's interrupted is picked up by the next one. It returns how many versions were deleted.
+func (d *Driver) Prune(height int64, stop <-chan struct{}) (int, error) {
+	if height > d.PrunedHeight() {
+		if err := d.session.SetSync(cPrunedHeightKey, lib.UintToBigEndian(uint64(height))); err != nil {
+			return 0, err
+		}
+		atomic.StoreInt64(&d.prunedHeight, height)
+	}
+
+	var deleted, scanned int
+	cursor := cKeysForIteratorPrefix
+	end := []byte{cKeysForIteratorPrefix[0] + 1}
+	for {
+		select {
+		case <-stop:
+			return deleted, nil
+		default:
+		}
+
+		// keys are listed apart from pruning them, for no iterator to be open while writing
+		keys, err := d.listKeys(cursor, end, pruneBatchKeys)
+		if err != nil {
+			return deleted, err
+		}
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+
+		batch := d.session.NewBatch()
+		for _, key := range keys {
+			versions, err := d.pruneKey(batch, bytes.TrimPrefix(key, cKeysForIteratorPrefix), height)
+			if err != nil {
+				_ = batch.Close()
+				return deleted, err
+			}
+			deleted += versions
+		}
+		err = batch.Write()
+		_ = batch.Close()
+		if err != nil {
+			return deleted, err
+		}
+
+		if scanned += len(keys); scanned%1000000 < pruneBatchKeys {
+			log.Printf("[heleveldb/prune] %d keys scanned, %d versions deleted so far\n", scanned, deleted)
+		}
+		cursor = append(append([]byte{}, keys[len(keys)-1]...), 0)
+	}
+}
+
+// listKeys returns up to limit keys within [start, end)
+func (d *Driver) listKeys(start, end []byte, limit int) ([][]byte, error) {
+	iter, err := d.session.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var keys [][]byte
+	for ; iter.Valid() && len(keys) < limit; iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+	}
+	return keys, iter.Error()
+}
+
+// pruneKey queues the deletion of the versions of key no read at or above height sees onto batch,
+// and returns how many were queued
+func (d *Driver) pruneKey(batch tmdb.Batch, key []byte, height int64) (int, error) {
+	versions := prefixDataWithHeightKey(key)
+
+	// versions at or below height, oldest first or last depending on the mode
+	var start, end []byte
+	if d.mode == DriverModeKeySuffixAsc {
+		start = append([]byte{}, versions...)
+		end = append(append([]byte{}, versions...), serializeHeight(d.mode, height+1)...)
+	} else {
+		start = append(append([]byte{}, versions...), serializeHeight(d.mode, height)...)
+		end = append(append([]byte{}, versions...), bytes.Repeat([]byte{0xff}, 9)...)
+	}
+
+	iter, err := d.session.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var below [][]byte
+	var deletions []bool
+	for ; iter.Valid(); iter.Next() {
+		// versions of longer keys sharing the prefix are interleaved here; only take the exact key's
+		if len(iter.Key()) == len(versions)+8 {
+			below = append(below, append([]byte{}, iter.Key()...))
+			deletions = append(deletions, iter.Value()[0] == 1)
+		}
+	}
+	_ = iter.Close()
+
+	if len(below) == 0 {
+		return 0, nil
+	}
+
+	// the last version at or below height is what reads at height see, unless it's a deletion
+	last := 0
+	if d.mode == DriverModeKeySuffixAsc {
+		last = len(below) - 1
+	}
+	var queued int
+	for i, version := range below {
+		if i == last && !deletions[i] {
+			continue
+		}
+		if err := batch.Delete(version); err != nil {
+			return queued, err
+		}
+		queued++
+	}
+	return queued, nil
+}
@@ -0,0 +1,107 @@
+package heleveldb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/hld"
+)
+
+func TestPrune(t *testing.T) {
+	for _, mode := range []int{DriverModeKeySuffixAsc, DriverModeKeySuffixDesc} {
+		dir := t.TempDir()
+		driver, err := NewLevelDBDriver(&DriverConfig{Name: "prune", Dir: dir, Mode: mode})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), driver.PrunedHeight())
+
+		write := func(height int64, writes func(batch *LevelBatch)) {
+			batch := driver.NewBatch(height).(*LevelBatch)
+			writes(batch)
+			assert.Nil(t, batch.Write())
+			assert.Nil(t, batch.Close())
+		}
+		write(1, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a1"))
+			_ = batch.Set([]byte("b"), []byte("b1"))
+			_ = batch.Set([]byte("c"), []byte("c1"))
+		})
+		write(2, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a2"))
+			_ = batch.Delete([]byte("b"))
+			_ = batch.Set([]byte("ab"), []byte("ab2"))
+		})
+		write(3, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a3"))
+			_ = batch.Delete([]byte("c"))
+		})
+
+		// a1 and b's versions go, a2 and ab2 are still what reads at 2 see
+		deleted, err := driver.Prune(2, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, deleted)
+		assert.Equal(t, int64(2), driver.PrunedHeight())
+
+		expectations := map[int64]map[string][]byte{
+			0: {"a": []byte("a3"), "ab": []byte("ab2"), "b": nil, "c": nil},
+			3: {"a": []byte("a3"), "ab": []byte("ab2"), "b": nil, "c": nil},
+			2: {"a": []byte("a2"), "ab": []byte("ab2"), "b": nil, "c": []byte("c1")},
+		}
+		for height, expected := range expectations {
+			for key, value := range expected {
+				actual, err := driver.Get(height, []byte(key))
+				assert.Nil(t, err)
+				assert.Equal(t, value, actual, "%s@%d, mode %d", key, height, mode)
+			}
+		}
+
+		iter, err := driver.Iterator(2, nil, nil)
+		assert.Nil(t, err)
+		var keys []string
+		for ; iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		assert.Nil(t, iter.Close())
+		assert.Equal(t, []string{"a", "ab", "c"}, keys)
+
+		// reads below are refused
+		_, err = driver.Get(1, []byte("a"))
+		assert.True(t, errors.Is(err, hld.ErrHeightPruned))
+		_, err = driver.Has(1, []byte("a"))
+		assert.True(t, errors.Is(err, hld.ErrHeightPruned))
+		_, err = driver.Iterator(1, nil, nil)
+		assert.True(t, errors.Is(err, hld.ErrHeightPruned))
+		_, err = driver.Rollback(1)
+		assert.True(t, errors.Is(err, hld.ErrHeightPruned))
+
+		// once more changes nothing
+		deleted, err = driver.Prune(2, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, deleted)
+
+		// the pruned height outlives the driver
+		assert.Nil(t, driver.Close())
+		driver, err = NewLevelDBDriver(&DriverConfig{Name: "prune", Dir: dir, Mode: mode})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), driver.PrunedHeight())
+
+		// a prune that's stopped records its height all the same
+		stop := make(chan struct{})
+		close(stop)
+		deleted, err = driver.Prune(3, stop)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, deleted)
+		assert.Equal(t, int64(3), driver.PrunedHeight())
+
+		deleted, err = driver.Prune(3, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, deleted)
+		for key, value := range expectations[3] {
+			actual, err := driver.Get(3, []byte(key))
+			assert.Nil(t, err)
+			assert.Equal(t, value, actual, "%s@3, mode %d", key, mode)
+		}
+
+		assert.Nil(t, driver.Close())
+	}
+}
@@ -0,0 +1,128 @@
+package heleveldb
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// number of writes per rollback batch
+const rollbackBatchSize = 10000
+
+// Rollback unwinds every key to its value as of height: versions written above it are deleted,
+// and the current value of the key is set back to its last version at or below height.
+// It returns the number of keys that were unwound.
+//
+// It's idempotent, so a rollback that was interrupted can be run again; it's not atomic though,
+// and the db must not be used until it has completed.
+func (d *Driver) Rollback(height int64) (int, error) {
+	if height <= 0 {
+		return 0, fmt.Errorf("invalid rollback height(%d)", height)
+	}
+	if err := d.checkPruned(height); err != nil {
+		return 0, err
+	}
+
+	// every key that ever existed is listed here
+	keys, err := d.session.Iterator(cKeysForIteratorPrefix, []byte{cKeysForIteratorPrefix[0] + 1})
+	if err != nil {
+		return 0, err
+	}
+	defer keys.Close()
+
+	batch := d.session.NewBatch()
+	defer func() { _ = batch.Close() }()
+
+	var unwound, pending, scanned int
+	for ; keys.Valid(); keys.Next() {
+		key := bytes.TrimPrefix(keys.Key(), cKeysForIteratorPrefix)
+
+		writes, err := d.rollbackKey(batch, key, height)
+		if err != nil {
+			return unwound, err
+		}
+		if writes > 0 {
+			unwound++
+			pending += writes
+		}
+
+		// leveldb iterators read from a snapshot, so writing along the way is fine
+		if pending >= rollbackBatchSize {
+			if err := batch.Write(); err != nil {
+				return unwound, err
+			}
+			_ = batch.Close()
+			batch = d.session.NewBatch()
+			pending = 0
+		}
+
+		if scanned++; scanned%1000000 == 0 {
+			log.Printf("[heleveldb/rollback] %d keys scanned, %d unwound so far\n", scanned, unwound)
+		}
+	}
+	if err := keys.Error(); err != nil {
+		return unwound, err
+	}
+
+	return unwound, batch.WriteSync()
+}
+
+// rollbackKey queues writes unwinding key to height onto batch, and returns how many were queued
+func (d *Driver) rollbackKey(batch tmdb.Batch, key []byte, height int64) (int, error) {
+	versions := prefixDataWithHeightKey(key)
+
+	// versions above height, newest first or last depending on the mode
+	var start, end []byte
+	if d.mode == DriverModeKeySuffixAsc {
+		start = append(append([]byte{}, versions...), serializeHeight(d.mode, height+1)...)
+		end = append(append([]byte{}, versions...), bytes.Repeat([]byte{0xff}, 9)...)
+	} else {
+		start = append([]byte{}, versions...)
+		end = append(append([]byte{}, versions...), serializeHeight(d.mode, height)...)
+	}
+
+	iter, err := d.session.Iterator(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var stale [][]byte
+	for ; iter.Valid(); iter.Next() {
+		// versions of longer keys sharing the prefix are interleaved here; only take the exact key's
+		if len(iter.Key()) == len(versions)+8 {
+			stale = append(stale, append([]byte{}, iter.Key()...))
+		}
+	}
+	_ = iter.Close()
+
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	// the last version as of height; nil if it was deleted by then, or did not exist yet
+	value, err := d.Get(height, key)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, version := range stale {
+		if err := batch.Delete(version); err != nil {
+			return 0, err
+		}
+	}
+	if value != nil {
+		if err := batch.Set(prefixCurrentDataKey(key), value); err != nil {
+			return 0, err
+		}
+		err = batch.Set(prefixKeysForIteratorKey(key), []byte{})
+	} else {
+		if err := batch.Delete(prefixCurrentDataKey(key)); err != nil {
+			return 0, err
+		}
+		err = batch.Set(prefixKeysForIteratorKey(key), []byte{1})
+	}
+
+	return len(stale) + 2, err
+}
@@ -0,0 +1,67 @@
+package heleveldb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollback(t *testing.T) {
+	for _, mode := range []int{DriverModeKeySuffixAsc, DriverModeKeySuffixDesc} {
+		driver, err := NewLevelDBDriver(&DriverConfig{Name: "rollback", Dir: t.TempDir(), Mode: mode})
+		assert.Nil(t, err)
+
+		write := func(height int64, writes func(batch *LevelBatch)) {
+			batch := driver.NewBatch(height).(*LevelBatch)
+			writes(batch)
+			assert.Nil(t, batch.Write())
+			assert.Nil(t, batch.Close())
+		}
+		write(1, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a1"))
+			_ = batch.Set([]byte("b"), []byte("b1"))
+		})
+		write(2, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a2"))
+			_ = batch.Delete([]byte("b"))
+			_ = batch.Set([]byte("ab"), []byte("ab2"))
+		})
+		write(3, func(batch *LevelBatch) {
+			_ = batch.Set([]byte("a"), []byte("a3"))
+			_ = batch.Set([]byte("b"), []byte("b3"))
+			_ = batch.Set([]byte("c"), []byte("c3"))
+		})
+
+		unwound, err := driver.Rollback(2)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, unwound)
+
+		// current values are as of 2, and so is everything older
+		for height, expected := range map[int64]map[string][]byte{
+			0: {"a": []byte("a2"), "ab": []byte("ab2"), "b": nil, "c": nil},
+			3: {"a": []byte("a2"), "ab": []byte("ab2"), "b": nil, "c": nil},
+			1: {"a": []byte("a1"), "ab": nil, "b": []byte("b1"), "c": nil},
+		} {
+			for key, value := range expected {
+				actual, err := driver.Get(height, []byte(key))
+				assert.Nil(t, err)
+				assert.Equal(t, value, actual, "%s@%d, mode %d", key, height, mode)
+			}
+		}
+
+		iter, err := driver.Iterator(3, nil, nil)
+		assert.Nil(t, err)
+		var keys []string
+		for ; iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		assert.Equal(t, []string{"a", "ab"}, keys)
+
+		// once more changes nothing
+		unwound, err = driver.Rollback(2)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, unwound)
+
+		assert.Nil(t, driver.Close())
+	}
+}
@@ -16,6 +16,9 @@ var (
 	cCurrentDataPrefix     = []byte{0}
 	cKeysForIteratorPrefix = []byte{1}
 	cDataWithHeightPrefix  = []byte{2}
+
+	// where the height versions are pruned below is recorded
+	cPrunedHeightKey = []byte{3}
 )
 
 func prefixCurrentDataKey(key []byte) []byte {
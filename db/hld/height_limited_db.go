@@ -57,6 +57,14 @@ func ApplyHeightLimitedDB(db HeightLimitEnabledDB, config *HeightLimitedDBConfig
 	}
 }
 
+// PrunedHeight is the lowest height reads are served at, if the db is pruned; 0 otherwise
+func (hld *HeightLimitedDB) PrunedHeight() int64 {
+	if prunable, ok := hld.odb.(Prunable); ok {
+		return prunable.PrunedHeight()
+	}
+	return 0
+}
+
 func (hld *HeightLimitedDB) BranchHeightLimitedDB(height int64) *HeightLimitedDB {
 	newOne := ApplyHeightLimitedDB(hld.odb, hld.config)
 	newOne.SetReadHeight(height)
@@ -1,6 +1,8 @@
 package hld
 
 import (
+	"errors"
+
 	tmdb "github.com/tendermint/tm-db"
 )
 
@@ -69,3 +71,17 @@ type HeightLimitEnabledIterator interface {
 type HeightLimitEnabledBatch interface {
 	tmdb.Batch
 }
+
+// ErrHeightPruned is returned for reads below the height a db is pruned to
+var ErrHeightPruned = errors.New("height is pruned")
+
+// Prunable is implemented by dbs that can garbage collect the versions of keys that no read at or above
+// a height sees anymore
+type Prunable interface {
+	// PrunedHeight is the lowest height reads are served at; 0 if nothing was ever pruned
+	PrunedHeight() int64
+
+	// Prune deletes the versions no read at or above height sees, in small batches, until done or stop is closed;
+	// reads below height fail with ErrHeightPruned from the start. It returns how many versions were deleted.
+	Prune(height int64, stop <-chan struct{}) (int, error)
+}
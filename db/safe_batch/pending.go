@@ -0,0 +1,182 @@
+package safe_batch
+
+import (
+	"bytes"
+
+	"github.com/google/btree"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// pending holds what's written to batches not flushed yet, for reads to see it;
+// a deleted key is kept with a nil value, as tmdb values can't be nil
+type pending struct {
+	entries *btree.BTreeG[pendingEntry]
+	bytes   int
+}
+
+type pendingEntry struct {
+	key   []byte
+	value []byte
+}
+
+func newPending() *pending {
+	return &pending{
+		entries: btree.NewG(32, func(a, b pendingEntry) bool {
+			return bytes.Compare(a.key, b.key) < 0
+		}),
+	}
+}
+
+func (p *pending) set(key, value []byte) {
+	p.entries.ReplaceOrInsert(pendingEntry{
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+	p.bytes += len(key) + len(value)
+}
+
+func (p *pending) delete(key []byte) {
+	p.entries.ReplaceOrInsert(pendingEntry{key: append([]byte{}, key...)})
+	p.bytes += len(key)
+}
+
+// get returns the pending entry of key, if any
+func (p *pending) get(key []byte) (pendingEntry, bool) {
+	return p.entries.Get(pendingEntry{key: key})
+}
+
+// rangeOf returns the pending entries within [start, end), in ascending order
+func (p *pending) rangeOf(start, end []byte) []pendingEntry {
+	var entries []pendingEntry
+	collect := func(entry pendingEntry) bool {
+		entries = append(entries, entry)
+		return true
+	}
+
+	switch {
+	case start == nil && end == nil:
+		p.entries.Ascend(collect)
+	case start == nil:
+		p.entries.AscendLessThan(pendingEntry{key: end}, collect)
+	case end == nil:
+		p.entries.AscendGreaterOrEqual(pendingEntry{key: start}, collect)
+	default:
+		p.entries.AscendRange(pendingEntry{key: start}, pendingEntry{key: end}, collect)
+	}
+
+	return entries
+}
+
+var _ tmdb.Iterator = (*pendingIterator)(nil)
+
+// pendingIterator merges pending entries over an iterator of the db:
+// a pending entry shadows the db's for the same key, and a deleted one hides it
+type pendingIterator struct {
+	parent     tmdb.Iterator
+	entries    []pendingEntry
+	reverse    bool
+	start, end []byte
+
+	key, value []byte
+	valid      bool
+}
+
+func newPendingIterator(parent tmdb.Iterator, p *pending, start, end []byte, reverse bool) *pendingIterator {
+	entries := p.rangeOf(start, end)
+	if reverse {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	it := &pendingIterator{
+		parent:  parent,
+		entries: entries,
+		reverse: reverse,
+		start:   start,
+		end:     end,
+	}
+	it.advance()
+	return it
+}
+
+// advance moves to the next key either has, skipping deleted ones
+func (it *pendingIterator) advance() {
+	for {
+		parentValid := it.parent.Valid()
+		if !parentValid && len(it.entries) == 0 {
+			it.valid = false
+			return
+		}
+
+		// < 0: the db's key comes first, > 0: the pending one does, 0: the pending one shadows the db's
+		var order int
+		switch {
+		case !parentValid:
+			order = 1
+		case len(it.entries) == 0:
+			order = -1
+		default:
+			order = bytes.Compare(it.parent.Key(), it.entries[0].key)
+			if it.reverse {
+				order = -order
+			}
+		}
+
+		// copied, as the db's iterator is moved past it already
+		if order < 0 {
+			it.key = append([]byte{}, it.parent.Key()...)
+			it.value = append([]byte{}, it.parent.Value()...)
+			it.valid = true
+			it.parent.Next()
+			return
+		}
+
+		entry := it.entries[0]
+		it.entries = it.entries[1:]
+		if order == 0 {
+			it.parent.Next()
+		}
+		if entry.value != nil {
+			it.key, it.value, it.valid = entry.key, entry.value, true
+			return
+		}
+	}
+}
+
+func (it *pendingIterator) Domain() (start []byte, end []byte) {
+	return it.start, it.end
+}
+
+func (it *pendingIterator) Valid() bool {
+	return it.valid
+}
+
+func (it *pendingIterator) Next() {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	it.advance()
+}
+
+func (it *pendingIterator) Key() (key []byte) {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	return it.key
+}
+
+func (it *pendingIterator) Value() (value []byte) {
+	if !it.valid {
+		panic("iterator is invalid")
+	}
+	return it.value
+}
+
+func (it *pendingIterator) Error() error {
+	return it.parent.Error()
+}
+
+func (it *pendingIterator) Close() error {
+	return it.parent.Close()
+}
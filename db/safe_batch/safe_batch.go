@@ -1,7 +1,9 @@
 package safe_batch
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	tmdb "github.com/tendermint/tm-db"
 	"github.com/terra-money/mantlemint/db/rollbackable"
@@ -10,56 +12,147 @@ import (
 var _ tmdb.DB = (*SafeBatchDB)(nil)
 var _ SafeBatchDBCloser = (*SafeBatchDB)(nil)
 
+// written straight to the db, it would be overwritten by held batches on flush
+var errHeldWithoutBatch = errors.New("batches are held; open one to write")
+
 type SafeBatchDBCloser interface {
 	tmdb.DB
 	Open()
+	Hold()
 	Flush() (tmdb.Batch, error)
+	PendingBytes() int
 }
 
 type SafeBatchDB struct {
 	db    tmdb.DB
 	batch tmdb.Batch
+
+	// batches held across blocks, oldest first, and what's written to them and to batch
+	held    []tmdb.Batch
+	mtx     *sync.RWMutex
+	pending *pending
 }
 
 // open batch
 func (s *SafeBatchDB) Open() {
 	s.batch = s.db.NewBatch()
+	if s.pending == nil {
+		s.pending = newPending()
+	}
+}
+
+// Hold sets the open batch aside instead of flushing it, i.e. to flush many blocks at once;
+// it's flushed along with the batches opened after it, on the next Flush. Reads see it meanwhile.
+func (s *SafeBatchDB) Hold() {
+	if s.batch != nil {
+		s.held = append(s.held, s.batch)
+		s.batch = nil
+	}
 }
 
-// flush batch and return rollback batch if rollbackable
+// flush batch, along with the ones held, and return rollback batch if rollbackable
 func (s *SafeBatchDB) Flush() (tmdb.Batch, error) {
+	batches := s.held
+	if s.batch != nil {
+		batches = append(batches, s.batch)
+	}
+
 	defer func() {
-		if s.batch != nil {
-			s.batch.Close()
+		for _, batch := range batches {
+			batch.Close()
 		}
 		s.batch = nil
+		s.held = nil
+
+		s.mtx.Lock()
+		s.pending = nil
+		s.mtx.Unlock()
 	}()
 
-	if batch, ok := s.batch.(rollbackable.HasRollbackBatch); ok {
-		return batch.RollbackBatch(), s.batch.WriteSync()
-	} else {
-		return nil, s.batch.WriteSync()
+	// written in order, so that the db is left at the end of some block should it go down midway;
+	// only the last write is synced
+	var rollbacks rollbackBatches
+	for i, batch := range batches {
+		if rollbackable, ok := batch.(rollbackable.HasRollbackBatch); ok {
+			rollbacks = append(rollbacks, rollbackable.RollbackBatch())
+		}
+
+		var err error
+		if i == len(batches)-1 {
+			err = batch.WriteSync()
+		} else {
+			err = batch.Write()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch len(rollbacks) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rollbacks[0], nil
+	default:
+		return rollbacks, nil
+	}
+}
+
+// PendingBytes returns about how much is written to the open batch and the ones held
+func (s *SafeBatchDB) PendingBytes() int {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.pending == nil {
+		return 0
 	}
+	return s.pending.bytes
 }
 
 func NewSafeBatchDB(db tmdb.DB) tmdb.DB {
 	return &SafeBatchDB{
 		db:    db,
 		batch: nil,
+		mtx:   new(sync.RWMutex),
 	}
 }
 
 func (s *SafeBatchDB) Get(bytes []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.pending != nil {
+		if entry, ok := s.pending.get(bytes); ok {
+			return entry.value, nil
+		}
+	}
 	return s.db.Get(bytes)
 }
 
 func (s *SafeBatchDB) Has(key []byte) (bool, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if s.pending != nil {
+		if entry, ok := s.pending.get(key); ok {
+			return entry.value != nil, nil
+		}
+	}
 	return s.db.Has(key)
 }
 
 func (s *SafeBatchDB) Set(key, value []byte) error {
 	if s.batch != nil {
-		return s.batch.Set(key, value)
+		if err := s.batch.Set(key, value); err != nil {
+			return err
+		}
+
+		s.mtx.Lock()
+		s.pending.set(key, value)
+		s.mtx.Unlock()
+		return nil
+	} else if len(s.held) != 0 {
+		return errHeldWithoutBatch
 	} else {
 		return s.db.Set(key, value)
 	}
@@ -71,7 +164,16 @@ func (s *SafeBatchDB) SetSync(key, value []byte) error {
 
 func (s *SafeBatchDB) Delete(key []byte) error {
 	if s.batch != nil {
-		return s.batch.Delete(key)
+		if err := s.batch.Delete(key); err != nil {
+			return err
+		}
+
+		s.mtx.Lock()
+		s.pending.delete(key)
+		s.mtx.Unlock()
+		return nil
+	} else if len(s.held) != 0 {
+		return errHeldWithoutBatch
 	} else {
 		return s.db.Delete(key)
 	}
@@ -82,11 +184,29 @@ func (s *SafeBatchDB) DeleteSync(key []byte) error {
 }
 
 func (s *SafeBatchDB) Iterator(start, end []byte) (tmdb.Iterator, error) {
-	return s.db.Iterator(start, end)
+	return s.iterator(start, end, false)
 }
 
 func (s *SafeBatchDB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
-	return s.db.ReverseIterator(start, end)
+	return s.iterator(start, end, true)
+}
+
+func (s *SafeBatchDB) iterator(start, end []byte, reverse bool) (tmdb.Iterator, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	var it tmdb.Iterator
+	var err error
+	if reverse {
+		it, err = s.db.ReverseIterator(start, end)
+	} else {
+		it, err = s.db.Iterator(start, end)
+	}
+	if err != nil || s.pending == nil {
+		return it, err
+	}
+
+	return newPendingIterator(it, s.pending, start, end, reverse), nil
 }
 
 func (s *SafeBatchDB) Close() error {
@@ -95,7 +215,8 @@ func (s *SafeBatchDB) Close() error {
 
 func (s *SafeBatchDB) NewBatch() tmdb.Batch {
 	if s.batch != nil {
-		return NewSafeBatchNullify(s.batch)
+		// written through, so that reads see it
+		return NewSafeBatchNullify(s)
 	} else {
 		fmt.Println("=== warn! should never enter here")
 		return s.db.NewBatch()
@@ -109,3 +230,42 @@ func (s *SafeBatchDB) Print() error {
 func (s *SafeBatchDB) Stats() map[string]string {
 	return s.db.Stats()
 }
+
+var _ tmdb.Batch = (rollbackBatches)(nil)
+
+// rollbackBatches reverts batches flushed at once. Each reverts to what was in the db before the flush,
+// so they can be written in any order.
+type rollbackBatches []tmdb.Batch
+
+func (r rollbackBatches) Set(_, _ []byte) error {
+	return fmt.Errorf("rollback batches are write-only")
+}
+
+func (r rollbackBatches) Delete(_ []byte) error {
+	return fmt.Errorf("rollback batches are write-only")
+}
+
+func (r rollbackBatches) Write() error {
+	for _, batch := range r {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r rollbackBatches) WriteSync() error {
+	for _, batch := range r {
+		if err := batch.WriteSync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r rollbackBatches) Close() error {
+	for _, batch := range r {
+		batch.Close()
+	}
+	return nil
+}
@@ -4,11 +4,17 @@ import tmdb "github.com/tendermint/tm-db"
 
 var _ tmdb.Batch = (*SafeBatchNullified)(nil)
 
+// batchWriter is what a nullified batch writes through to
+type batchWriter interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
 type SafeBatchNullified struct {
-	batch tmdb.Batch
+	batch batchWriter
 }
 
-func NewSafeBatchNullify(batch tmdb.Batch) tmdb.Batch {
+func NewSafeBatchNullify(batch batchWriter) tmdb.Batch {
 	return &SafeBatchNullified{
 		batch: batch,
 	}
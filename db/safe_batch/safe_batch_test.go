@@ -0,0 +1,74 @@
+package safe_batch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func collect(t *testing.T, it tmdb.Iterator) []string {
+	var kvs []string
+	for ; it.Valid(); it.Next() {
+		kvs = append(kvs, string(it.Key())+"="+string(it.Value()))
+	}
+	assert.Nil(t, it.Close())
+	return kvs
+}
+
+func TestSafeBatchDBHold(t *testing.T) {
+	db := tmdb.NewMemDB()
+	assert.Nil(t, db.Set([]byte("a"), []byte("1")))
+	assert.Nil(t, db.Set([]byte("c"), []byte("3")))
+	assert.Nil(t, db.Set([]byte("e"), []byte("5")))
+
+	batched := NewSafeBatchDB(db)
+	batchedOrigin := batched.(SafeBatchDBCloser)
+
+	// first block
+	batchedOrigin.Open()
+	assert.Nil(t, batched.Set([]byte("b"), []byte("2")))
+	assert.Nil(t, batched.Delete([]byte("c")))
+	batchedOrigin.Hold()
+
+	// written to neither batch nor db while held
+	assert.Equal(t, errHeldWithoutBatch, batched.Set([]byte("x"), []byte("x")))
+
+	// second block sees the first one's writes
+	batchedOrigin.Open()
+	v, err := batched.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), v)
+	has, err := batched.Has([]byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, has)
+
+	batch := batched.NewBatch()
+	assert.Nil(t, batch.Set([]byte("e"), []byte("50")))
+	assert.Nil(t, batch.Write())
+	assert.Nil(t, batch.Close())
+
+	it, err := batched.Iterator(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a=1", "b=2", "e=50"}, collect(t, it))
+	it, err = batched.ReverseIterator([]byte("b"), []byte("e"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b=2"}, collect(t, it))
+	it, err = batched.ReverseIterator(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e=50", "b=2", "a=1"}, collect(t, it))
+
+	// nothing is in the db until flushed
+	v, err = db.Get([]byte("b"))
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	assert.NotZero(t, batchedOrigin.PendingBytes())
+
+	_, err = batchedOrigin.Flush()
+	assert.Nil(t, err)
+	assert.Zero(t, batchedOrigin.PendingBytes())
+
+	it, err = db.Iterator(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a=1", "b=2", "e=50"}, collect(t, it))
+}
@@ -14,17 +14,15 @@ const (
 )
 
 var (
-	errIteratorNotSupported = errors.New("iterator unsupported")
-	errUnknownData          = errors.New("unknown format")
+	errUnknownData = errors.New("unknown format")
 )
 
 var _ tmdb.DB = (*SnappyDB)(nil)
 
 // SnappyDB implements a tmdb.DB overlay with snappy compression/decompression
-// Iterator is NOT supported -- main purpose of this library is to support indexer.db,
-// which never makes use of iterators anyway
-// NOTE: implement when needed
-// NOTE2: monitor mem pressure, optimize by pre-allocating dst buf when there is bottleneck
+// Iterators decompress values as Get does, see SnappyIterator -- main purpose of this library is to support
+// indexer.db, which only iterates over the keys of its searchable indexes
+// NOTE: monitor mem pressure, optimize by pre-allocating dst buf when there is bottleneck
 type SnappyDB struct {
 	db         tmdb.DB
 	mtx        *sync.Mutex
@@ -91,11 +89,19 @@ func (s *SnappyDB) DeleteSync(key []byte) error {
 }
 
 func (s *SnappyDB) Iterator(start, end []byte) (tmdb.Iterator, error) {
-	return nil, errIteratorNotSupported
+	iterator, err := s.db.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return NewSnappyIterator(iterator, s.compatMode), nil
 }
 
 func (s *SnappyDB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
-	return nil, errIteratorNotSupported
+	iterator, err := s.db.ReverseIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	return NewSnappyIterator(iterator, s.compatMode), nil
 }
 
 func (s *SnappyDB) Close() error {
@@ -32,15 +32,26 @@ func TestSnappyDB(t *testing.T) {
 	assert.Nil(t, v)
 	assert.Nil(t, err)
 
-	// iterator is not supported
-	var it db.Iterator
-	it, err = snappy.Iterator([]byte("start"), []byte("end"))
-	assert.Nil(t, it)
-	assert.Equal(t, errIteratorNotSupported, err)
+	// iterators decompress values
+	assert.Nil(t, snappy.Set([]byte("iter/1"), []byte("first")))
+	assert.Nil(t, snappy.Set([]byte("iter/2"), []byte("second")))
 
-	it, err = snappy.ReverseIterator([]byte("start"), []byte("end"))
-	assert.Nil(t, it)
-	assert.Equal(t, errIteratorNotSupported, err)
+	var it db.Iterator
+	it, err = snappy.Iterator([]byte("iter/"), []byte("iter/3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("iter/1"), it.Key())
+	assert.Equal(t, []byte("first"), it.Value())
+	it.Next()
+	assert.Equal(t, []byte("second"), it.Value())
+	it.Next()
+	assert.False(t, it.Valid())
+	assert.Nil(t, it.Error())
+	assert.Nil(t, it.Close())
+
+	it, err = snappy.ReverseIterator([]byte("iter/"), []byte("iter/3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("second"), it.Value())
+	assert.Nil(t, it.Close())
 
 	// batched store is compressed as well
 	var batch db.Batch
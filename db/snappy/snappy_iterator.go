@@ -0,0 +1,47 @@
+package snappy
+
+import (
+	"encoding/json"
+
+	"github.com/golang/snappy"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var _ tmdb.Iterator = (*SnappyIterator)(nil)
+
+// SnappyIterator decompresses the values of the underlying iterator; keys aren't compressed.
+// Values that aren't snappy blobs are yielded as-is in compat mode if they're valid json,
+// but not replaced as Get does, not to write under an open iterator
+type SnappyIterator struct {
+	tmdb.Iterator
+	compatMode int
+	err        error
+}
+
+func NewSnappyIterator(iterator tmdb.Iterator, compatMode int) *SnappyIterator {
+	return &SnappyIterator{
+		Iterator:   iterator,
+		compatMode: compatMode,
+	}
+}
+
+func (s *SnappyIterator) Value() []byte {
+	item := s.Iterator.Value()
+	decoded, decodeErr := snappy.Decode(nil, item)
+	if decodeErr == nil {
+		return decoded
+	}
+	if s.compatMode == CompatModeEnabled && json.Valid(item) {
+		return item
+	}
+
+	s.err = errUnknownData
+	return nil
+}
+
+func (s *SnappyIterator) Error() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.Iterator.Error()
+}
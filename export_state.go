@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/runner"
+)
+
+// exportAppState writes app state at --height (the latest if not given) as a genesis, like `terrad export`,
+// to --output or stdout (see runner.ExportGenesis).
+func exportAppState(ldb hld.HeightLimitEnabledDB, hldb *hld.HeightLimitedDB, mantlemintConfig *config.Config, appProvider runner.AppProvider, stdout io.Writer) {
+	genesisDoc, err := runner.ExportGenesis(ldb, hldb, mantlemintConfig, appProvider)
+	if err != nil {
+		panic(err)
+	}
+
+	encoded, err := tmjson.Marshal(genesisDoc)
+	if err != nil {
+		panic(err)
+	}
+	encoded = append(sdk.MustSortJSON(encoded), '\n')
+
+	if mantlemintConfig.ExportOutput != "" {
+		err = os.WriteFile(mantlemintConfig.ExportOutput, encoded, 0o644)
+	} else {
+		_, err = stdout.Write(encoded)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	log.Printf("[v0.34.x/export] exported app state at height %d", genesisDoc.InitialHeight-1)
+}
@@ -5,14 +5,17 @@ import (
 
 	tmjson "github.com/tendermint/tendermint/libs/json"
 	tm "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
 	terra "github.com/terra-money/core/v2/app"
 	"github.com/terra-money/mantlemint/db/safe_batch"
 	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/lib"
 	"github.com/terra-money/mantlemint/mantlemint"
 )
 
-var IndexBlock = indexer.CreateIndexer(func(indexerDB safe_batch.SafeBatchDB, block *tm.Block, blockID *tm.BlockID, _ *mantlemint.EventCollector, _ *terra.TerraApp) error {
+var IndexBlock = indexer.CreateIndexer(func(indexerDB safe_batch.SafeBatchDB, block *tm.Block, blockID *tm.BlockID, evc *mantlemint.EventCollector, _ *terra.TerraApp) error {
 	defer fmt.Printf("[indexer/block] indexing done for height %d\n", block.Height)
+	hash := block.Hash()
 	record := BlockRecord{
 		Block:   block,
 		BlockID: blockID,
@@ -23,5 +26,100 @@ var IndexBlock = indexer.CreateIndexer(func(indexerDB safe_batch.SafeBatchDB, bl
 		return recordErr
 	}
 
-	return indexerDB.Set(getKey(uint64(block.Height)), recordJSON)
+	if err := indexerDB.Set(getKey(uint64(block.Height)), recordJSON); err != nil {
+		return err
+	}
+	if len(hash) != 0 {
+		if err := indexerDB.Set(getHashKey(hash), lib.UintToBigEndian(uint64(block.Height))); err != nil {
+			return err
+		}
+	}
+
+	// by the events of begin and end block -- for SearchBlocks
+	if evc == nil || evc.ResponseBeginBlock == nil || evc.ResponseEndBlock == nil {
+		return nil
+	}
+	return indexEvents(&indexerDB, block.Height, BlockEventsRecord{
+		BeginBlockEvents: evc.ResponseBeginBlock.Events,
+		EndBlockEvents:   evc.ResponseEndBlock.Events,
+	})
+})
+
+// RollbackBlock deletes the block of height, and what it's indexed by
+var RollbackBlock = indexer.CreateRollback(func(indexerDB tmdb.DB, batch tmdb.Batch, height int64) error {
+	eventsJSON, err := indexerDB.Get(getEventsKey(uint64(height)))
+	if err != nil {
+		return err
+	}
+	if eventsJSON != nil {
+		var record BlockEventsRecord
+		if err := tmjson.Unmarshal(eventsJSON, &record); err != nil {
+			return err
+		}
+		for _, key := range eventKeys(record, uint64(height)) {
+			if err := batch.Delete(key); err != nil {
+				return err
+			}
+		}
+		if err := batch.Delete(getEventsKey(uint64(height))); err != nil {
+			return err
+		}
+	}
+
+	block, _, err := LoadBlock(indexerDB, height)
+	if err != nil {
+		return err
+	} else if block != nil {
+		if err := batch.Delete(getHashKey(block.Hash())); err != nil {
+			return err
+		}
+	}
+
+	return batch.Delete(getKey(uint64(height)))
 })
+
+// LoadBlock reads back the block indexed at height, i.e. to replay it; nil if it was never indexed
+func LoadBlock(indexerDB tmdb.DB, height int64) (*tm.Block, *tm.BlockID, error) {
+	recordJSON, err := indexerDB.Get(getKey(uint64(height)))
+	if err != nil || recordJSON == nil {
+		return nil, nil, err
+	}
+
+	record := BlockRecord{}
+	if err := tmjson.Unmarshal(recordJSON, &record); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode indexed block %d: %v", height, err)
+	}
+	return record.Block, record.BlockID, nil
+}
+
+// IndexedRange returns the lowest and highest heights of the blocks indexed; 0 and 0 if none was
+func IndexedRange(indexerDB tmdb.DB) (int64, int64, error) {
+	end := append(append([]byte{}, prefix[:len(prefix)-1]...), prefix[len(prefix)-1]+1)
+	bound := func(iterate func(start, end []byte) (tmdb.Iterator, error)) (int64, error) {
+		iterator, err := iterate(prefix, end)
+		if err != nil {
+			return 0, err
+		}
+		defer iterator.Close()
+		if !iterator.Valid() {
+			return 0, iterator.Error()
+		}
+		return int64(lib.BigEndianToUint(iterator.Key()[len(prefix):])), nil
+	}
+
+	lowest, err := bound(indexerDB.Iterator)
+	if err != nil {
+		return 0, 0, err
+	}
+	highest, err := bound(indexerDB.ReverseIterator)
+	return lowest, highest, err
+}
+
+// LoadHeightByHash returns the height of the block indexed of hash; 0 if none was
+func LoadHeightByHash(indexerDB tmdb.DB, hash []byte) (int64, error) {
+	height, err := indexerDB.Get(getHashKey(hash))
+	if err != nil || height == nil {
+		return 0, err
+	}
+	return int64(lib.BigEndianToUint(height)), nil
+}
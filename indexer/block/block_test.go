@@ -31,5 +31,30 @@ func TestIndexBlock(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, block)
 
+	// read back for replays
+	loaded, blockID, err := LoadBlock(db, 4724005)
+	assert.Nil(t, err)
+	assert.Equal(t, record.Block.Hash(), loaded.Hash())
+	assert.Equal(t, record.BlockID, blockID)
+
+	loaded, _, err = LoadBlock(db, 4724006)
+	assert.Nil(t, err)
+	assert.Nil(t, loaded)
+
+	// and by hash
+	height, err := LoadHeightByHash(db, record.Block.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4724005), height)
+	height, err = LoadHeightByHash(db, []byte("unknown"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), height)
+
+	rollback := db.NewBatch()
+	assert.Nil(t, RollbackBlock(db, rollback, 4724005))
+	assert.Nil(t, rollback.WriteSync())
+	height, err = LoadHeightByHash(db, record.Block.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), height)
+
 	fmt.Println(string(block))
 }
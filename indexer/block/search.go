@@ -0,0 +1,149 @@
+package block
+
+import (
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	"github.com/tendermint/tendermint/state"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/lib"
+)
+
+// eventKeys are the keys of a block in the event index: one per attribute of its begin and end block events,
+// as type.key, as Tendermint's block indexer indexes them
+func eventKeys(record BlockEventsRecord, height uint64) [][]byte {
+	var keys [][]byte
+	for _, event := range append(append([]abci.Event{}, record.BeginBlockEvents...), record.EndBlockEvents...) {
+		if event.Type == "" {
+			continue
+		}
+		for _, attribute := range event.Attributes {
+			if len(attribute.Key) == 0 {
+				continue
+			}
+			keys = append(keys, blockEvents.EventKey(event.Type+"."+string(attribute.Key), string(attribute.Value), height, nil))
+		}
+	}
+	return keys
+}
+
+// indexEvents records the events of the block at height, and indexes it by them, onto batch
+func indexEvents(batch interface{ Set(key, value []byte) error }, height int64, record BlockEventsRecord) error {
+	recordJSON, err := tmjson.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := batch.Set(getEventsKey(uint64(height)), recordJSON); err != nil {
+		return err
+	}
+	for _, key := range eventKeys(record, uint64(height)) {
+		if err := batch.Set(key, []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchBlocks returns the heights of the blocks matching q, a Tendermint block query, ascending, up to maxHeight.
+// The subset of the query grammar supported is conditions of equality on the attributes of begin and end block
+// events, and comparisons on block.height; see indexer.EventIndex.
+func SearchBlocks(indexerDB tmdb.DB, q *query.Query, maxHeight int64) ([]int64, error) {
+	matches, err := blockEvents.Search(indexerDB, q, maxHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	heights := make([]int64, len(matches))
+	for i, match := range matches {
+		heights[i] = match.Height
+	}
+	return heights, nil
+}
+
+// BackfillEvents indexes the events of the blocks indexed from and to the heights given that were indexed before
+// their events were, off the results saved in stateStore when they were executed. Heights without results, from
+// before mantlemint's genesis or the snapshot it was bootstrapped from, are skipped. It returns how many were.
+func BackfillEvents(indexerDB tmdb.DB, stateStore state.Store, from, to int64) (int, error) {
+	batch := indexerDB.NewBatch()
+	defer func() { _ = batch.Close() }()
+
+	backfilled := 0
+	for height := from; height <= to; height++ {
+		if indexed, err := indexerDB.Has(getKey(uint64(height))); err != nil {
+			return backfilled, err
+		} else if !indexed {
+			continue
+		}
+		if done, err := indexerDB.Has(getEventsKey(uint64(height))); err != nil {
+			return backfilled, err
+		} else if done {
+			continue
+		}
+
+		responses, err := stateStore.LoadABCIResponses(height)
+		if _, ok := err.(state.ErrNoABCIResponsesForHeight); ok {
+			continue
+		} else if err != nil {
+			return backfilled, err
+		}
+		record := BlockEventsRecord{BeginBlockEvents: responses.BeginBlock.Events, EndBlockEvents: responses.EndBlock.Events}
+		if err := indexEvents(batch, height, record); err != nil {
+			return backfilled, err
+		}
+		backfilled++
+
+		// flushed every so often, so that progress survives an interruption
+		if backfilled%1000 == 0 {
+			if err := batch.WriteSync(); err != nil {
+				return backfilled, err
+			}
+			_ = batch.Close()
+			batch = indexerDB.NewBatch()
+			fmt.Printf("[indexer/block] backfilled events up to height %d\n", height)
+		}
+	}
+
+	return backfilled, batch.WriteSync()
+}
+
+// BackfillHashes indexes the blocks indexed from and to the heights given that were indexed before their hashes
+// were, by hash. It returns how many were.
+func BackfillHashes(indexerDB tmdb.DB, _ state.Store, from, to int64) (int, error) {
+	batch := indexerDB.NewBatch()
+	defer func() { _ = batch.Close() }()
+
+	backfilled := 0
+	for height := from; height <= to; height++ {
+		indexed, _, err := LoadBlock(indexerDB, height)
+		if err != nil {
+			return backfilled, err
+		} else if indexed == nil {
+			continue
+		}
+		hash := indexed.Hash()
+		if done, err := indexerDB.Has(getHashKey(hash)); err != nil {
+			return backfilled, err
+		} else if done {
+			continue
+		}
+
+		if err := batch.Set(getHashKey(hash), lib.UintToBigEndian(uint64(height))); err != nil {
+			return backfilled, err
+		}
+		backfilled++
+
+		// flushed every so often, so that progress survives an interruption
+		if backfilled%1000 == 0 {
+			if err := batch.WriteSync(); err != nil {
+				return backfilled, err
+			}
+			_ = batch.Close()
+			batch = indexerDB.NewBatch()
+			fmt.Printf("[indexer/block] backfilled hashes up to height %d\n", height)
+		}
+	}
+
+	return backfilled, batch.WriteSync()
+}
@@ -0,0 +1,116 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	tmstate "github.com/tendermint/tendermint/proto/tendermint/state"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+// slashEvents are begin block events slashing each of validators
+func slashEvents(validators ...string) []abci.Event {
+	var events []abci.Event
+	for _, validator := range validators {
+		events = append(events, abci.Event{Type: "slash", Attributes: []abci.EventAttribute{{Key: []byte("address"), Value: []byte(validator)}}})
+	}
+	return events
+}
+
+// indexBlock indexes a block at height, with the begin block events given if any
+func indexBlock(t *testing.T, db tmdb.DB, height int64, events []abci.Event) {
+	block := &tendermint.Block{
+		Header:     tendermint.Header{Height: height, ValidatorsHash: []byte("validators")},
+		LastCommit: &tendermint.Commit{},
+	}
+	var evc *mantlemint.EventCollector
+	if events != nil {
+		evc = mantlemint.NewMantlemintEventCollector()
+		evc.ResponseBeginBlock = &abci.ResponseBeginBlock{Events: events}
+		evc.ResponseEndBlock = &abci.ResponseEndBlock{}
+	}
+
+	batch := safe_batch.NewSafeBatchDB(db)
+	batch.(safe_batch.SafeBatchDBCloser).Open()
+	assert.Nil(t, IndexBlock(*batch.(*safe_batch.SafeBatchDB), block, &tendermint.BlockID{}, evc, nil))
+	_, err := batch.(safe_batch.SafeBatchDBCloser).Flush()
+	assert.Nil(t, err)
+}
+
+func TestSearchBlocks(t *testing.T) {
+	db := tmdb.NewMemDB()
+	indexBlock(t, db, 10, slashEvents("terravaloper1a"))
+	indexBlock(t, db, 11, slashEvents("terravaloper1b"))
+	indexBlock(t, db, 12, slashEvents("terravaloper1a", "terravaloper1b"))
+
+	lowest, highest, err := IndexedRange(db)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{10, 12}, []int64{lowest, highest})
+
+	search := func(q string) []int64 {
+		heights, err := SearchBlocks(db, query.MustParse(q), 100)
+		assert.Nil(t, err)
+		return heights
+	}
+	assert.Equal(t, []int64{10, 12}, search("slash.address='terravaloper1a'"))
+	assert.Equal(t, []int64{12}, search("slash.address='terravaloper1a' AND slash.address='terravaloper1b'"))
+	assert.Equal(t, []int64{11, 12}, search("block.height>10"))
+	assert.Empty(t, search("slash.address='terravaloper1c'"))
+
+	// rolling back a height unwinds what was indexed of it
+	batch := db.NewBatch()
+	assert.Nil(t, RollbackBlock(db, batch, 12))
+	assert.Nil(t, batch.WriteSync())
+	assert.Equal(t, []int64{10}, search("slash.address='terravaloper1a'"))
+	assert.Equal(t, []int64{10, 11}, search("block.height>=1"))
+}
+
+func TestBackfillEvents(t *testing.T) {
+	db := tmdb.NewMemDB()
+	indexBlock(t, db, 10, nil)
+	indexBlock(t, db, 11, nil)
+	indexBlock(t, db, 12, slashEvents("terravaloper1a"))
+
+	// heights 10 and 11 were indexed before their events were; 10 has no results saved
+	stateStore := state.NewStore(tmdb.NewMemDB(), state.StoreOptions{DiscardABCIResponses: false})
+	assert.Nil(t, stateStore.SaveABCIResponses(11, &tmstate.ABCIResponses{
+		BeginBlock: &abci.ResponseBeginBlock{Events: slashEvents("terravaloper1a")},
+		EndBlock:   &abci.ResponseEndBlock{},
+	}))
+
+	backfilled, err := BackfillEvents(db, stateStore, 1, 12)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, backfilled)
+	heights, err := SearchBlocks(db, query.MustParse("slash.address='terravaloper1a'"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{11, 12}, heights)
+
+	// and there's nothing left to backfill
+	backfilled, err = BackfillEvents(db, stateStore, 1, 12)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, backfilled)
+}
+
+func TestBackfillHashes(t *testing.T) {
+	db := tmdb.NewMemDB()
+	indexBlock(t, db, 10, nil)
+	indexBlock(t, db, 11, nil)
+
+	// height 10 was indexed before its hash was
+	indexed, _, err := LoadBlock(db, 10)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Delete(getHashKey(indexed.Hash())))
+
+	backfilled, err := BackfillHashes(db, nil, 1, 12)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, backfilled)
+	height, err := LoadHeightByHash(db, indexed.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), height)
+}
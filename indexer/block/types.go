@@ -1,7 +1,9 @@
 package block
 
 import (
+	abci "github.com/tendermint/tendermint/abci/types"
 	tm "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/indexer"
 	"github.com/terra-money/mantlemint/lib"
 )
 
@@ -14,3 +16,27 @@ type BlockRecord struct {
 	BlockID *tm.BlockID `json:"block_id"`
 	Block   *tm.Block   `json:"block"`
 }
+
+// the height of blocks by hash
+var hashPrefix = []byte("block/hash:")
+var getHashKey = func(hash []byte) []byte {
+	return lib.ConcatBytes(hashPrefix, hash)
+}
+
+// the events of begin and end block, by height; what's indexed of them is unwound off it on rollback
+var eventsPrefix = []byte("block/events:")
+var getEventsKey = func(height uint64) []byte {
+	return lib.ConcatBytes(eventsPrefix, lib.UintToBigEndian(height))
+}
+
+// event index: blocks having an event attribute of a value, by height; see SearchBlocks
+var blockEvents = indexer.EventIndex{
+	HeightKey:      "block.height",
+	PositionPrefix: prefix,
+	EventPrefix:    []byte("block/event:"),
+}
+
+type BlockEventsRecord struct {
+	BeginBlockEvents []abci.Event `json:"begin_block_events"`
+	EndBlockEvents   []abci.Event `json:"end_block_events"`
+}
@@ -5,6 +5,7 @@ import (
 
 	tmjson "github.com/tendermint/tendermint/libs/json"
 	tm "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
 	terra "github.com/terra-money/core/v2/app"
 	"github.com/terra-money/mantlemint/db/safe_batch"
 	"github.com/terra-money/mantlemint/indexer"
@@ -23,3 +24,13 @@ var IndexHeight = indexer.CreateIndexer(func(indexerDB safe_batch.SafeBatchDB, b
 
 	return indexerDB.Set(getKey(), recordJSON)
 })
+
+// RollbackHeight moves the last known height back below the height rolled back
+var RollbackHeight = indexer.CreateRollback(func(_ tmdb.DB, batch tmdb.Batch, height int64) error {
+	recordJSON, recordErr := tmjson.Marshal(HeightRecord{Height: uint64(height - 1)})
+	if recordErr != nil {
+		return recordErr
+	}
+
+	return batch.Set(getKey(), recordJSON)
+})
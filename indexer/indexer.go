@@ -1,23 +1,54 @@
 package indexer
 
 import (
+	"encoding/binary"
 	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
 	tm "github.com/tendermint/tendermint/types"
 	tmdb "github.com/tendermint/tm-db"
 	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/mantlemint/db/follower"
 	"github.com/terra-money/mantlemint/db/safe_batch"
 	"github.com/terra-money/mantlemint/db/snappy"
 	"github.com/terra-money/mantlemint/mantlemint"
 )
 
+// watermarkKey is where the last height indexed is recorded, along with what's indexed of it
+var watermarkKey = []byte("indexer/watermark")
+
+// WatermarkHeader is set on the responses of indexer routes to the last height indexed, which
+// lags the height queries are served at while blocks are queued to be indexed
+const WatermarkHeader = "X-Indexer-Watermark"
+
 type Indexer struct {
 	db          tmdb.DB
 	indexerTags []string
 	indexers    []IndexFunc
+	rollbacks   []RollbackFunc
 	app         *terra.TerraApp
+
+	// last height indexed; 0 if none was since the watermark is recorded
+	watermark int64
+
+	// the index of another mantlemint, if followed; see NewFollowingIndexer
+	followed *follower.DB
+
+	// blocks to index in the background, once started; drained is closed once they're all indexed
+	queue   chan indexJob
+	drained chan struct{}
+}
+
+type indexJob struct {
+	block   *tm.Block
+	blockId *tm.BlockID
+	evc     *mantlemint.EventCollector
+	indexed func()
 }
 
 func NewIndexer(dbName, path string, app *terra.TerraApp) (*Indexer, error) {
@@ -26,14 +57,131 @@ func NewIndexer(dbName, path string, app *terra.TerraApp) (*Indexer, error) {
 		return nil, indexerDBError
 	}
 
-	indexerDBCompressed := snappy.NewSnappyDB(indexerDB, snappy.CompatModeEnabled)
+	return newIndexer(indexerDB, app)
+}
+
+// NewFollowingIndexer opens the index of a mantlemint running off it, without locking it out, for its routes
+// to serve what that mantlemint indexed; nothing can be indexed to it. See Refresh
+func NewFollowingIndexer(dbName, path string) (*Indexer, error) {
+	indexerDB, err := follower.Open(dbName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := newIndexer(indexerDB, nil)
+	if err != nil {
+		return nil, err
+	}
+	idx.followed = indexerDB
+	return idx, nil
+}
 
-	return &Indexer{
-		db:          indexerDBCompressed,
+func newIndexer(indexerDB tmdb.DB, app *terra.TerraApp) (*Indexer, error) {
+	idx := &Indexer{
+		db:          snappy.NewSnappyDB(indexerDB, snappy.CompatModeEnabled),
 		indexerTags: []string{},
 		indexers:    []IndexFunc{},
 		app:         app,
-	}, nil
+	}
+	if err := idx.loadWatermark(); err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+func (idx *Indexer) loadWatermark() error {
+	watermark, err := idx.db.Get(watermarkKey)
+	if err != nil {
+		return err
+	}
+	if len(watermark) == 8 {
+		atomic.StoreInt64(&idx.watermark, int64(binary.BigEndian.Uint64(watermark)))
+	}
+	return nil
+}
+
+// Refresh reads what was indexed since the index was opened, or last refreshed, by the mantlemint it's followed off;
+// the index must have been opened with NewFollowingIndexer
+func (idx *Indexer) Refresh() error {
+	if idx.followed == nil {
+		return fmt.Errorf("index isn't followed, there's nothing to refresh")
+	}
+	if err := idx.followed.Refresh(); err != nil {
+		return err
+	}
+	return idx.loadWatermark()
+}
+
+// LoadWatermark reads the last height indexed off the index at path, without keeping it open; see Watermark
+func LoadWatermark(dbName, path string) (int64, error) {
+	idx, err := NewIndexer(dbName, path, nil)
+	if err != nil {
+		return 0, err
+	}
+	watermark := idx.Watermark()
+	return watermark, idx.Close()
+}
+
+// Watermark is the last height indexed, 0 if unknown; i.e. on an index written before it was recorded
+func (idx *Indexer) Watermark() int64 {
+	return atomic.LoadInt64(&idx.watermark)
+}
+
+// Start indexes the blocks enqueued in the background, in order, with up to queueSize of them waiting;
+// until started, or if queueSize is 0, blocks are indexed as they're enqueued
+func (idx *Indexer) Start(queueSize int) {
+	if queueSize == 0 {
+		return
+	}
+
+	idx.queue = make(chan indexJob, queueSize)
+	idx.drained = make(chan struct{})
+	go func() {
+		defer close(idx.drained)
+		for job := range idx.queue {
+			// as when indexed inline, an index that can't be written is not to be served
+			if err := idx.Run(job.block, job.blockId, job.evc); err != nil {
+				debug.PrintStack()
+				panic(fmt.Errorf("failed to index block %d: %w", job.block.Height, err))
+			}
+			if job.indexed != nil {
+				job.indexed()
+			}
+		}
+	}()
+}
+
+// Enqueue queues a block to be indexed, blocking while the queue is full
+func (idx *Indexer) Enqueue(block *tm.Block, blockId *tm.BlockID, evc *mantlemint.EventCollector) error {
+	return idx.EnqueueThen(block, blockId, evc, nil)
+}
+
+// EnqueueThen queues a block to be indexed as Enqueue does, calling indexed once it is, if not nil
+func (idx *Indexer) EnqueueThen(block *tm.Block, blockId *tm.BlockID, evc *mantlemint.EventCollector, indexed func()) error {
+	if idx.queue == nil {
+		if err := idx.Run(block, blockId, evc); err != nil {
+			return err
+		}
+		if indexed != nil {
+			indexed()
+		}
+		return nil
+	}
+
+	idx.queue <- indexJob{block: block, blockId: blockId, evc: evc, indexed: indexed}
+	return nil
+}
+
+// Drain waits for the blocks queued to be indexed; nothing must be enqueued after
+func (idx *Indexer) Drain() {
+	if idx.queue == nil {
+		return
+	}
+
+	close(idx.queue)
+	<-idx.drained
+	idx.queue = nil
 }
 
 func (idx *Indexer) RegisterIndexerService(tag string, indexerFunc IndexFunc) {
@@ -41,6 +189,40 @@ func (idx *Indexer) RegisterIndexerService(tag string, indexerFunc IndexFunc) {
 	idx.indexers = append(idx.indexers, indexerFunc)
 }
 
+// RegisterRollbackService registers how to unwind what an indexer has recorded, see Rollback
+func (idx *Indexer) RegisterRollbackService(rollbackFunc RollbackFunc) {
+	idx.rollbacks = append(idx.rollbacks, rollbackFunc)
+}
+
+// Rollback deletes everything indexed from `from` down to `to` (exclusive), newest first,
+// so that indexing resumes from to+1
+func (idx *Indexer) Rollback(from int64, to int64) error {
+	batch := idx.db.NewBatch()
+	defer batch.Close()
+
+	for height := from; height > to; height-- {
+		for _, rollbackFunc := range idx.rollbacks {
+			if err := rollbackFunc(idx.db, batch, height); err != nil {
+				return fmt.Errorf("failed to roll back index at height %d: %v", height, err)
+			}
+		}
+	}
+
+	watermark := idx.Watermark()
+	if watermark > to {
+		watermark = to
+		if err := batch.Set(watermarkKey, encodeWatermark(watermark)); err != nil {
+			return err
+		}
+	}
+
+	if err := batch.WriteSync(); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&idx.watermark, watermark)
+	return nil
+}
+
 func (idx *Indexer) Run(block *tm.Block, blockId *tm.BlockID, evc *mantlemint.EventCollector) error {
 	//batch := idx.db.NewBatch()
 	batch := safe_batch.NewSafeBatchDB(idx.db)
@@ -56,13 +238,42 @@ func (idx *Indexer) Run(block *tm.Block, blockId *tm.BlockID, evc *mantlemint.Ev
 	tEnd := time.Now()
 	fmt.Printf("[indexer] finished %d indexers, %dms\n", len(idx.indexers), tEnd.Sub(tStart).Milliseconds())
 
+	// the watermark moves along with what's indexed of the block
+	if err := batch.Set(watermarkKey, encodeWatermark(block.Height)); err != nil {
+		return err
+	}
 	if _, err := batchedOrigin.Flush(); err != nil {
 		return err
 	}
+	atomic.StoreInt64(&idx.watermark, block.Height)
 
 	return nil
 }
 
+func encodeWatermark(height int64) []byte {
+	watermark := make([]byte, 8)
+	binary.BigEndian.PutUint64(watermark, uint64(height))
+	return watermark
+}
+
+// DB is the index, to be read off; i.e. by rpc methods searching it
+func (idx *Indexer) DB() tmdb.DB {
+	return idx.db
+}
+
+// Close closes the indexer db; nothing must be indexed after
+func (idx *Indexer) Close() error {
+	return idx.db.Close()
+}
+
+// RegisterRESTRoute registers the routes of an indexer, which report the watermark in WatermarkHeader
 func (idx *Indexer) RegisterRESTRoute(router *mux.Router, registerer RESTRouteRegisterer) {
-	registerer(router, idx.db)
+	subrouter := router.NewRoute().Subrouter()
+	subrouter.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set(WatermarkHeader, strconv.FormatInt(idx.Watermark(), 10))
+			next.ServeHTTP(writer, request)
+		})
+	})
+	registerer(subrouter, idx.db)
 }
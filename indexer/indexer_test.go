@@ -0,0 +1,67 @@
+package indexer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	tm "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+func TestIndexerQueue(t *testing.T) {
+	path := t.TempDir()
+	idx, err := NewIndexer("indexer", path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), idx.Watermark())
+
+	// blocks wait for the one being indexed, while the queue has room
+	release := make(chan struct{})
+	var indexed []int64
+	idx.RegisterIndexerService("test", func(_ safe_batch.SafeBatchDB, block *tm.Block, _ *tm.BlockID, _ *mantlemint.EventCollector, _ *terra.TerraApp) error {
+		<-release
+		indexed = append(indexed, block.Height)
+		return nil
+	})
+	idx.Start(2)
+	for height := int64(1); height <= 3; height++ {
+		assert.Nil(t, idx.Enqueue(&tm.Block{Header: tm.Header{Height: height}}, &tm.BlockID{}, nil))
+	}
+	assert.Equal(t, int64(0), idx.Watermark())
+
+	// draining indexes everything queued
+	close(release)
+	idx.Drain()
+	assert.Equal(t, []int64{1, 2, 3}, indexed)
+	assert.Equal(t, int64(3), idx.Watermark())
+
+	// the watermark is reported by routes
+	router := mux.NewRouter()
+	idx.RegisterRESTRoute(router, func(router *mux.Router, _ tmdb.DB) {
+		router.HandleFunc("/index/test", func(writer http.ResponseWriter, _ *http.Request) {})
+	})
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/index/test", nil))
+	assert.Equal(t, "3", recorder.Header().Get(WatermarkHeader))
+
+	// rolling back moves the watermark down
+	assert.Nil(t, idx.Rollback(3, 2))
+	assert.Equal(t, int64(2), idx.Watermark())
+	assert.Nil(t, idx.Close())
+
+	// and it's persisted
+	idx, err = NewIndexer("indexer", path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), idx.Watermark())
+
+	// without a queue, blocks are indexed as they're enqueued, and whoever waits on it told after
+	var watermark int64
+	assert.Nil(t, idx.EnqueueThen(&tm.Block{Header: tm.Header{Height: 3}}, &tm.BlockID{}, nil, func() { watermark = idx.Watermark() }))
+	assert.Equal(t, int64(3), watermark)
+	assert.Nil(t, idx.Close())
+}
@@ -3,9 +3,11 @@ package richlist
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	abci "github.com/tendermint/tendermint/abci/types"
 	tm "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
 
 	sdk "github.com/cosmos/cosmos-sdk/types"
 	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
@@ -31,13 +33,24 @@ const (
 	attrDelegator          = "delegator"
 )
 
-var cfg = config.GetConfig()
+// config is read on first use, so that the environment isn't needed to import this
+var cfg *config.Config
+var loadConfigOnce sync.Once
 
 // for now, we only handle a richlist for LUNA
-var richlist = NewRichlist(0, cfg.RichlistThreshold)
+var richlist *Richlist
+
+func loadConfig() *config.Config {
+	loadConfigOnce.Do(func() {
+		cfg = config.GetConfig()
+		richlist = NewRichlist(0, cfg.RichlistThreshold)
+	})
+	return cfg
+}
 
 var IndexRichlist = indexer.CreateIndexer(func(indexerDB safe_batch.SafeBatchDB, block *tm.Block, blockID *tm.BlockID, evc *mantlemint.EventCollector, app *terra.TerraApp) (err error) {
 	height := uint64(block.Height)
+	loadConfig()
 
 	// skip if this indexer is disabled or at genesis height. genesis block cannot be parsed here.
 	if cfg.RichlistLength == 0 || height == 1 {
@@ -190,3 +203,20 @@ func extractChange(attrs []abci.EventAttribute, attributeKey string, denom strin
 	}
 	return
 }
+
+// RollbackRichlist deletes the richlist of height, and makes the one before it the latest.
+// The in-memory richlist is regenerated from state on the next block.
+var RollbackRichlist = indexer.CreateRollback(func(indexerDB tmdb.DB, batch tmdb.Batch, height int64) error {
+	if err := batch.Delete(getDefaultKey(uint64(height))); err != nil {
+		return err
+	}
+
+	previous, err := indexerDB.Get(getDefaultKey(uint64(height - 1)))
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return batch.Delete(getDefaultKey(0))
+	}
+	return batch.Set(getDefaultKey(0), previous)
+})
@@ -20,7 +20,7 @@ var (
 		return lib.ConcatBytes(prefix, lib.UintToBigEndian(height), []byte(":"), []byte(denom))
 	}
 	getDefaultKey = func(height uint64) []byte {
-		return getKey(height, cfg.RichlistThreshold.Denom)
+		return getKey(height, loadConfig().RichlistThreshold.Denom)
 	}
 )
 
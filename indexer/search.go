@@ -0,0 +1,157 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/lib"
+)
+
+// EventIndex is an index of entries, txs or blocks, by the attributes of their events, searchable with Tendermint
+// queries; see Search. Entries are keyed by height, then by a suffix of SuffixLength telling those of a height apart.
+type EventIndex struct {
+	// HeightKey is the composite key of conditions on the height, i.e. tx.height
+	HeightKey string
+
+	// every entry is under PositionPrefix, and under EventPrefix for each of its event attributes
+	PositionPrefix []byte
+	EventPrefix    []byte
+	SuffixLength   int
+
+	// ReadValues reads back the values of the entries found, into SearchMatch.Value
+	ReadValues bool
+}
+
+// SearchMatch is an entry found by Search
+type SearchMatch struct {
+	Height int64
+	Suffix []byte
+	Value  []byte
+}
+
+// EventKeyPrefix is where the entries having an event attribute of a value are, by height and suffix
+func (ei EventIndex) EventKeyPrefix(compositeKey string, value string) []byte {
+	return lib.ConcatBytes(ei.EventPrefix, lengthPrefixed(compositeKey), lengthPrefixed(value))
+}
+
+// EventKey is the key of an entry under an event attribute of a value
+func (ei EventIndex) EventKey(compositeKey string, value string, height uint64, suffix []byte) []byte {
+	return lib.ConcatBytes(ei.EventKeyPrefix(compositeKey, value), lib.UintToBigEndian(height), suffix)
+}
+
+// Search returns the entries matching q, a Tendermint query, ordered by height and suffix, up to maxHeight.
+// The subset of the query grammar supported is conditions of equality on event attributes, and comparisons
+// on the height.
+func (ei EventIndex) Search(indexerDB tmdb.DB, q *query.Query, maxHeight int64) ([]SearchMatch, error) {
+	conditions, err := q.Conditions()
+	if err != nil {
+		return nil, err
+	}
+
+	// conditions on the height bound the range scanned, the others are all to be met
+	minHeight := int64(1)
+	var equalities []query.Condition
+	for _, condition := range conditions {
+		if condition.CompositeKey != ei.HeightKey {
+			if condition.Op != query.OpEqual {
+				return nil, fmt.Errorf("only equality is supported on event attributes, but %s isn't", condition.CompositeKey)
+			}
+			equalities = append(equalities, condition)
+			continue
+		}
+
+		height, ok := condition.Operand.(int64)
+		if !ok {
+			return nil, fmt.Errorf("%s must be compared with an integer, got %v", ei.HeightKey, condition.Operand)
+		}
+		switch condition.Op {
+		case query.OpEqual:
+			minHeight, maxHeight = max64(minHeight, height), min64(maxHeight, height)
+		case query.OpGreater:
+			minHeight = max64(minHeight, height+1)
+		case query.OpGreaterEqual:
+			minHeight = max64(minHeight, height)
+		case query.OpLess:
+			maxHeight = min64(maxHeight, height-1)
+		case query.OpLessEqual:
+			maxHeight = min64(maxHeight, height)
+		default:
+			return nil, fmt.Errorf("only =, <, <=, > and >= are supported on %s", ei.HeightKey)
+		}
+	}
+	if minHeight > maxHeight {
+		return []SearchMatch{}, nil
+	}
+
+	// entries are scanned off the first equality, if any, and the others are looked up
+	prefix := ei.PositionPrefix
+	if len(equalities) != 0 {
+		prefix = ei.EventKeyPrefix(equalities[0].CompositeKey, fmt.Sprint(equalities[0].Operand))
+		equalities = equalities[1:]
+	}
+	start := lib.ConcatBytes(prefix, lib.UintToBigEndian(uint64(minHeight)))
+	end := lib.ConcatBytes(prefix, lib.UintToBigEndian(uint64(maxHeight)+1))
+	if maxHeight == math.MaxInt64 {
+		end = nil
+	}
+
+	iterator, err := indexerDB.Iterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer iterator.Close()
+
+	matches := []SearchMatch{}
+	for ; iterator.Valid(); iterator.Next() {
+		key := iterator.Key()[len(prefix):]
+		if len(key) != 8+ei.SuffixLength {
+			continue
+		}
+		height, suffix := binary.BigEndian.Uint64(key[:8]), append([]byte{}, key[8:]...)
+
+		matched := true
+		for _, condition := range equalities {
+			has, err := indexerDB.Has(ei.EventKey(condition.CompositeKey, fmt.Sprint(condition.Operand), height, suffix))
+			if err != nil {
+				return nil, err
+			}
+			if !has {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			match := SearchMatch{Height: int64(height), Suffix: suffix}
+			if ei.ReadValues {
+				match.Value = iterator.Value()
+			}
+			matches = append(matches, match)
+		}
+	}
+
+	return matches, iterator.Error()
+}
+
+// lengthPrefixed prefixes s with its length, for a key made of strings not to be read as another
+func lengthPrefixed(s string) []byte {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(s)))
+	return lib.ConcatBytes(length, []byte(s))
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
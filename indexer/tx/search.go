@@ -0,0 +1,50 @@
+package tx
+
+import (
+	"encoding/binary"
+
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// TxPosition is where a tx is in the chain
+type TxPosition struct {
+	Height int64
+	Index  uint32
+	Hash   string
+}
+
+// eventKeys are the keys of a tx in the event index: one per attribute of its events, as type.key, and its hash
+// as tx.hash, as Tendermint's tx indexer indexes them
+func eventKeys(hash string, events []Event, height uint64, index uint32) [][]byte {
+	suffix := uint32ToBigEndian(index)
+	keys := [][]byte{txEvents.EventKey("tx.hash", hash, height, suffix)}
+	for _, event := range events {
+		if event.Type == "" {
+			continue
+		}
+		for _, attribute := range event.Attributes {
+			if attribute.Key == "" {
+				continue
+			}
+			keys = append(keys, txEvents.EventKey(event.Type+"."+attribute.Key, attribute.Value, height, suffix))
+		}
+	}
+	return keys
+}
+
+// SearchTxs returns the txs matching q, a Tendermint tx query, ordered by height and index, up to maxHeight.
+// The subset of the query grammar supported is conditions of equality on event attributes (tx.hash included),
+// and comparisons on tx.height; see indexer.EventIndex.
+func SearchTxs(indexerDB tmdb.DB, q *query.Query, maxHeight int64) ([]TxPosition, error) {
+	matches, err := txEvents.Search(indexerDB, q, maxHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]TxPosition, len(matches))
+	for i, match := range matches {
+		positions[i] = TxPosition{Height: match.Height, Index: binary.BigEndian.Uint32(match.Suffix), Hash: string(match.Value)}
+	}
+	return positions, nil
+}
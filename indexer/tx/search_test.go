@@ -0,0 +1,92 @@
+package tx
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+// indexTransfers indexes a block at height of a transfer to each recipient
+func indexTransfers(t *testing.T, db tmdb.DB, height int64, recipients ...string) {
+	block := &tendermint.Block{Header: tendermint.Header{Height: height}}
+	evc := mantlemint.NewMantlemintEventCollector()
+	for i, recipient := range recipients {
+		builder := cdc.TxConfig.NewTxBuilder()
+		assert.Nil(t, builder.SetMsgs(banktypes.NewMsgSend(sdk.AccAddress("sender"), sdk.AccAddress(recipient), sdk.NewCoins())))
+		builder.SetMemo(recipient + string(rune(i)))
+		txBytes, err := cdc.TxConfig.TxEncoder()(builder.GetTx())
+		assert.Nil(t, err)
+		block.Txs = append(block.Txs, txBytes)
+
+		_ = evc.PublishEventTx(tendermint.EventDataTx{TxResult: abci.TxResult{Result: abci.ResponseDeliverTx{
+			Log: "[]",
+			Events: []abci.Event{
+				{Type: "message", Attributes: []abci.EventAttribute{{Key: []byte("sender"), Value: []byte("terra1sender")}}},
+				{Type: "transfer", Attributes: []abci.EventAttribute{{Key: []byte("recipient"), Value: []byte(recipient)}}},
+			},
+		}}})
+	}
+
+	batch := safe_batch.NewSafeBatchDB(db)
+	batch.(safe_batch.SafeBatchDBCloser).Open()
+	assert.Nil(t, IndexTx(*batch.(*safe_batch.SafeBatchDB), block, nil, evc, nil))
+	_, err := batch.(safe_batch.SafeBatchDBCloser).Flush()
+	assert.Nil(t, err)
+}
+
+func TestSearchTxs(t *testing.T) {
+	db := tmdb.NewMemDB()
+	indexTransfers(t, db, 10, "terra1a", "terra1b")
+	indexTransfers(t, db, 11, "terra1b")
+	indexTransfers(t, db, 12, "terra1a", "terra1a")
+
+	search := func(q string, maxHeight int64) []TxPosition {
+		positions, err := SearchTxs(db, query.MustParse(q), maxHeight)
+		assert.Nil(t, err)
+		for i := range positions {
+			positions[i].Hash = ""
+		}
+		return positions
+	}
+
+	assert.Equal(t, []TxPosition{{Height: 10, Index: 0}, {Height: 12, Index: 0}, {Height: 12, Index: 1}},
+		search("transfer.recipient='terra1a'", 100))
+	assert.Equal(t, []TxPosition{{Height: 12, Index: 0}, {Height: 12, Index: 1}},
+		search("message.sender='terra1sender' AND transfer.recipient='terra1a' AND tx.height>10", 100))
+	assert.Equal(t, []TxPosition{{Height: 10, Index: 0}, {Height: 10, Index: 1}, {Height: 11, Index: 0}},
+		search("tx.height<=11", 100))
+	assert.Equal(t, []TxPosition{{Height: 10, Index: 0}, {Height: 10, Index: 1}},
+		search("tx.height>=1", 10))
+	assert.Empty(t, search("transfer.recipient='terra1c'", 100))
+
+	// a tx is found by its hash
+	positions, err := SearchTxs(db, query.MustParse("tx.height=11"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, positions, func() []TxPosition {
+		found, err := SearchTxs(db, query.MustParse("tx.hash='"+positions[0].Hash+"'"), 100)
+		assert.Nil(t, err)
+		return found
+	}())
+
+	// beyond the subset supported
+	_, err = SearchTxs(db, query.MustParse("transfer.recipient CONTAINS 'terra'"), 100)
+	assert.NotNil(t, err)
+
+	// rolling back a height unwinds what was indexed of it
+	batch := db.NewBatch()
+	assert.Nil(t, RollbackTx(db, batch, 12))
+	assert.Nil(t, batch.WriteSync())
+	assert.Equal(t, []TxPosition{{Height: 10, Index: 0}}, search("transfer.recipient='terra1a'", 100))
+	iterator, err := db.Iterator(getPositionKey(12, 0), nil)
+	assert.Nil(t, err)
+	assert.False(t, iterator.Valid())
+	assert.Nil(t, iterator.Close())
+}
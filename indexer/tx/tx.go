@@ -6,6 +6,7 @@ import (
 
 	tmjson "github.com/tendermint/tendermint/libs/json"
 	tm "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
 	terra "github.com/terra-money/core/v2/app"
 	"github.com/terra-money/mantlemint/db/safe_batch"
 	"github.com/terra-money/mantlemint/indexer"
@@ -22,6 +23,7 @@ var IndexTx = indexer.CreateIndexer(func(batch safe_batch.SafeBatchDB, block *tm
 	txHashes := make([]string, len(block.Txs))
 	txRecords := make([]TxRecord, len(block.Txs))
 	byHeightPayload := make([]TxByHeightRecord, len(block.Txs))
+	txEventKeys := make([][][]byte, len(block.Txs))
 
 	// by hash
 	for txIndex, txByte := range block.Txs {
@@ -51,6 +53,7 @@ var IndexTx = indexer.CreateIndexer(func(batch safe_batch.SafeBatchDB, block *tm
 
 		txHashes[txIndex] = fmt.Sprintf("%X", hash)
 		txRecords[txIndex] = txRecord
+		txEventKeys[txIndex] = eventKeys(txHashes[txIndex], response.Events, uint64(block.Height), uint32(txIndex))
 
 		// byHeightRecord
 		// handle non-successful case first
@@ -97,5 +100,61 @@ var IndexTx = indexer.CreateIndexer(func(batch safe_batch.SafeBatchDB, block *tm
 		return batchSetErr
 	}
 
+	// 3. byPosition and byEvent -- for SearchTxs
+	for txIndex, txHash := range txHashes {
+		if err := batch.Set(getPositionKey(uint64(block.Height), uint32(txIndex)), []byte(txHash)); err != nil {
+			return err
+		}
+		for _, key := range txEventKeys[txIndex] {
+			if err := batch.Set(key, []byte(txHash)); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 })
+
+// RollbackTx deletes the txs of height, by hash, by height, by position and by event
+var RollbackTx = indexer.CreateRollback(func(indexerDB tmdb.DB, batch tmdb.Batch, height int64) error {
+	byHeightJSON, err := indexerDB.Get(getByHeightKey(uint64(height)))
+	if err != nil || byHeightJSON == nil {
+		return err
+	}
+
+	var byHeight []TxByHeightRecord
+	if err := tmjson.Unmarshal(byHeightJSON, &byHeight); err != nil {
+		return err
+	}
+	for txIndex, record := range byHeight {
+		// the events indexed are those of the response recorded along with the tx
+		txRecordJSON, err := indexerDB.Get(getKey(record.TxHash))
+		if err != nil {
+			return err
+		}
+		if txRecordJSON != nil {
+			var txRecord TxRecord
+			var response ResponseDeliverTx
+			if err := tmjson.Unmarshal(txRecordJSON, &txRecord); err != nil {
+				return err
+			}
+			if err := tmjson.Unmarshal(txRecord.TxResponse, &response); err != nil {
+				return err
+			}
+			for _, key := range eventKeys(record.TxHash, response.Events, uint64(height), uint32(txIndex)) {
+				if err := batch.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := batch.Delete(getPositionKey(uint64(height), uint32(txIndex))); err != nil {
+			return err
+		}
+		if err := batch.Delete(getKey(record.TxHash)); err != nil {
+			return err
+		}
+	}
+
+	return batch.Delete(getByHeightKey(uint64(height)))
+})
@@ -1,10 +1,12 @@
 package tx
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"time"
 
 	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/terra-money/mantlemint/indexer"
 	"github.com/terra-money/mantlemint/lib"
 )
 
@@ -36,6 +38,26 @@ var getByHeightKey = func(height uint64) []byte {
 	return lib.ConcatBytes(byHeightPrefix, lib.UintToBigEndian(height))
 }
 
+var positionPrefix = []byte("tx/position:")
+var getPositionKey = func(height uint64, index uint32) []byte {
+	return lib.ConcatBytes(positionPrefix, lib.UintToBigEndian(height), uint32ToBigEndian(index))
+}
+
+// event index: txs having an event attribute of a value, by height and index; see SearchTxs
+var txEvents = indexer.EventIndex{
+	HeightKey:      "tx.height",
+	PositionPrefix: positionPrefix,
+	EventPrefix:    []byte("tx/event:"),
+	SuffixLength:   4,
+	ReadValues:     true,
+}
+
+func uint32ToBigEndian(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, n)
+	return b
+}
+
 type ResponseDeliverTx struct {
 	Code      uint32  `json:"code"`
 	Data      []byte  `json:"data,omitempty"`
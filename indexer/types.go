@@ -15,12 +15,19 @@ import (
 
 type IndexFunc func(indexerDB safe_batch.SafeBatchDB, block *tm.Block, blockId *tm.BlockID, evc *mantlemint.EventCollector, app *terra.TerraApp) error
 type ClientHandler func(w http.ResponseWriter, r *http.Request) error
+
+// RollbackFunc queues deletion of whatever an indexer has recorded for height onto batch
+type RollbackFunc func(indexerDB tmdb.DB, batch tmdb.Batch, height int64) error
 type RESTRouteRegisterer func(router *mux.Router, indexerDB tmdb.DB)
 
 func CreateIndexer(idf IndexFunc) IndexFunc {
 	return idf
 }
 
+func CreateRollback(rollback RollbackFunc) RollbackFunc {
+	return rollback
+}
+
 func CreateRESTRoute(registerer RESTRouteRegisterer) RESTRouteRegisterer {
 	return registerer
 }
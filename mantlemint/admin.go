@@ -0,0 +1,151 @@
+package mantlemint
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	EndpointGETPause   = "/admin/pause"
+	EndpointPOSTPause  = "/admin/pause"
+	EndpointPOSTResume = "/admin/resume"
+	EndpointGETHalt    = "/admin/halt"
+	EndpointPOSTHalt   = "/admin/halt"
+
+	EndpointGETQuarantine         = "/admin/quarantine"
+	EndpointPOSTQuarantineRelease = "/admin/quarantine/release"
+)
+
+// PauseStatus is the response of pause routes
+type PauseStatus struct {
+	Paused bool  `json:"paused"`
+	Height int64 `json:"height"`
+}
+
+// RegisterPauseRoutes registers routes to pause and resume block injection.
+// Height is the last injected height; while paused, it's where injection resumes from.
+func RegisterPauseRoutes(router *mux.Router, pauser *Pauser, getHeight func() int64) {
+	router.HandleFunc(EndpointGETPause, func(writer http.ResponseWriter, request *http.Request) {
+		writePauseStatus(writer, pauser, getHeight)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointPOSTPause, func(writer http.ResponseWriter, request *http.Request) {
+		pauser.Pause()
+		writePauseStatus(writer, pauser, getHeight)
+	}).Methods("POST")
+
+	router.HandleFunc(EndpointPOSTResume, func(writer http.ResponseWriter, request *http.Request) {
+		pauser.Resume()
+		writePauseStatus(writer, pauser, getHeight)
+	}).Methods("POST")
+}
+
+// HaltStatus is the response of halt routes
+type HaltStatus struct {
+	// HaltHeight is the last height to inject, 0 if unset
+	HaltHeight int64 `json:"halt_height"`
+
+	// Halted is true once Height has reached HaltHeight
+	Halted bool  `json:"halted"`
+	Height int64 `json:"height"`
+}
+
+// RegisterHaltRoutes registers routes to inspect and set the halt height; POST takes ?height=, and 0 clears it.
+// Height is the last injected height.
+func RegisterHaltRoutes(router *mux.Router, halter *Halter, getHeight func() int64) {
+	router.HandleFunc(EndpointGETHalt, func(writer http.ResponseWriter, request *http.Request) {
+		writeHaltStatus(writer, halter, getHeight)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointPOSTHalt, func(writer http.ResponseWriter, request *http.Request) {
+		height, err := strconv.ParseInt(request.URL.Query().Get("height"), 10, 64)
+		if err != nil || height < 0 {
+			http.Error(writer, "height must be a non-negative integer", 400)
+			return
+		}
+
+		halter.SetHaltHeight(height)
+		writeHaltStatus(writer, halter, getHeight)
+	}).Methods("POST")
+}
+
+// QuarantineStatus is the response of quarantine routes
+type QuarantineStatus struct {
+	// Poison is the block quarantined, nil if none
+	Poison *Poison `json:"poison"`
+	Height int64   `json:"height"`
+}
+
+// RegisterQuarantineRoutes registers routes to inspect the block quarantined, and to release it for a retry,
+// i.e. once a fixed binary is deployed. Height is the last injected height.
+func RegisterQuarantineRoutes(router *mux.Router, quarantine *Quarantine, getHeight func() int64) {
+	router.HandleFunc(EndpointGETQuarantine, func(writer http.ResponseWriter, request *http.Request) {
+		writeQuarantineStatus(writer, quarantine, getHeight)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointPOSTQuarantineRelease, func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := quarantine.Release(); err != nil {
+			http.Error(writer, fmt.Sprintf("failed to release quarantine: %v", err), 500)
+			return
+		}
+		writeQuarantineStatus(writer, quarantine, getHeight)
+	}).Methods("POST")
+}
+
+// RequireAdminToken refuses requests to /admin routes that don't carry token as a bearer, with a 401
+func RequireAdminToken(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if strings.HasPrefix(request.URL.Path, "/admin/") {
+				bearer, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+				if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+					writer.Header().Set("WWW-Authenticate", "Bearer")
+					http.Error(writer, "admin routes require ADMIN_TOKEN as a bearer token", 401)
+					return
+				}
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func writeQuarantineStatus(writer http.ResponseWriter, quarantine *Quarantine, getHeight func() int64) {
+	writeJSON(writer, &QuarantineStatus{
+		Poison: quarantine.Poison(),
+		Height: getHeight(),
+	})
+}
+
+func writeHaltStatus(writer http.ResponseWriter, halter *Halter, getHeight func() int64) {
+	height := getHeight()
+	writeJSON(writer, &HaltStatus{
+		HaltHeight: halter.HaltHeight(),
+		Halted:     halter.Halts(height + 1),
+		Height:     height,
+	})
+}
+
+func writePauseStatus(writer http.ResponseWriter, pauser *Pauser, getHeight func() int64) {
+	writeJSON(writer, &PauseStatus{
+		Paused: pauser.IsPaused(),
+		Height: getHeight(),
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, status interface{}) {
+	response, err := json.Marshal(status)
+	if err != nil {
+		http.Error(writer, fmt.Sprintf("failed to marshal status: %v", err), 500)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(200)
+	_, _ = writer.Write(response)
+}
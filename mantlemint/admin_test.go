@@ -0,0 +1,33 @@
+package mantlemint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAdminToken(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RequireAdminToken("secret"))
+	RegisterPauseRoutes(router, NewPauser(), func() int64 { return 10 })
+	router.HandleFunc("/health", func(writer http.ResponseWriter, _ *http.Request) {}).Methods("GET")
+	serve := func(path string, authorization string) int {
+		request := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// admin routes take the token as a bearer; the others don't
+	assert.Equal(t, http.StatusUnauthorized, serve(EndpointGETPause, ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(EndpointGETPause, "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, serve(EndpointGETPause, "secret"))
+	assert.Equal(t, http.StatusOK, serve(EndpointGETPause, "Bearer secret"))
+	assert.Equal(t, http.StatusOK, serve("/health", ""))
+}
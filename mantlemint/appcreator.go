@@ -1,6 +1,8 @@
 package mantlemint
 
 import (
+	"sync"
+
 	abcicli "github.com/tendermint/tendermint/abci/client"
 	"github.com/tendermint/tendermint/abci/types"
 	tmsync "github.com/tendermint/tendermint/libs/sync"
@@ -21,4 +23,16 @@ func NewConcurrentQueryClientCreator(app types.Application) proxy.ClientCreator
 
 func (l *localClientCreator) NewABCIClient() (abcicli.Client, error) {
 	return NewConcurrentQueryClient(l.mtx, l.app), nil
-}
\ No newline at end of file
+}
+
+// Locker locks out the blocks executed over the clients of creator, and anything holding ReadLocker, for changes
+// to the app made from outside of them; creator must come from NewConcurrentQueryClientCreator
+func Locker(creator proxy.ClientCreator) sync.Locker {
+	return creator.(*localClientCreator).mtx
+}
+
+// ReadLocker locks out the blocks executed over the clients of creator, for reads of the app that can't run
+// alongside them, unlike queries; creator must come from NewConcurrentQueryClientCreator
+func ReadLocker(creator proxy.ClientCreator) sync.Locker {
+	return creator.(*localClientCreator).mtx.RLocker()
+}
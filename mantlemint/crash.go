@@ -0,0 +1,153 @@
+package mantlemint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+// CrashReport is what's known of the state when a block fails to inject, i.e. on an apphash mismatch:
+// diffing store hashes against a healthy node tells which module diverged.
+type CrashReport struct {
+	Time    time.Time `json:"time"`
+	Height  int64     `json:"height"`
+	ChainID string    `json:"chain_id"`
+	Error   string    `json:"error"`
+
+	// ExpectedAppHash is the block header's, ComputedAppHash the one committed locally after the prior block
+	ExpectedAppHash string `json:"expected_app_hash"`
+	ComputedAppHash string `json:"computed_app_hash"`
+
+	// StoreHashes are the commit hashes of every store after the prior block, by store name
+	StoreHashes map[string]string `json:"store_hashes"`
+
+	Txs  []CrashReportTx `json:"txs"`
+	Logs []string        `json:"logs"`
+}
+
+// CrashReportTx is a tx of the failing block, along with its result if it was executed
+type CrashReportTx struct {
+	Hash      string `json:"hash"`
+	Executed  bool   `json:"executed"`
+	Code      uint32 `json:"code"`
+	Codespace string `json:"codespace,omitempty"`
+	Log       string `json:"log,omitempty"`
+	GasWanted int64  `json:"gas_wanted,omitempty"`
+	GasUsed   int64  `json:"gas_used,omitempty"`
+}
+
+// NewCrashReport gathers a report on block failing to inject with injectErr, on top of lastState.
+// Tx results are taken from the state store, or from evc, whichever got them; txs are listed
+// without results if execution did not get that far.
+func NewCrashReport(
+	lastState state.State,
+	stateStore state.Store,
+	evc *EventCollector,
+	storeHashes map[string][]byte,
+	block *tendermint.Block,
+	injectErr error,
+) *CrashReport {
+	report := &CrashReport{
+		Time:            time.Now().UTC(),
+		Height:          block.Height,
+		ChainID:         block.ChainID,
+		Error:           injectErr.Error(),
+		ExpectedAppHash: fmt.Sprintf("%X", block.AppHash),
+		ComputedAppHash: fmt.Sprintf("%X", lastState.AppHash),
+		StoreHashes:     make(map[string]string, len(storeHashes)),
+		Txs:             make([]CrashReportTx, len(block.Txs)),
+		Logs:            []string{},
+	}
+
+	for name, hash := range storeHashes {
+		report.StoreHashes[name] = fmt.Sprintf("%X", hash)
+	}
+
+	var results []*abci.ResponseDeliverTx
+	if responses, err := stateStore.LoadABCIResponses(block.Height); err == nil {
+		results = responses.DeliverTxs
+	} else if evc != nil && evc.Height == block.Height {
+		results = evc.ResponseDeliverTxs
+	}
+
+	for i, tx := range block.Txs {
+		report.Txs[i].Hash = fmt.Sprintf("%X", tx.Hash())
+		if i < len(results) && results[i] != nil {
+			report.Txs[i].Executed = true
+			report.Txs[i].Code = results[i].Code
+			report.Txs[i].Codespace = results[i].Codespace
+			report.Txs[i].Log = results[i].Log
+			report.Txs[i].GasWanted = results[i].GasWanted
+			report.Txs[i].GasUsed = results[i].GasUsed
+		}
+	}
+
+	return report
+}
+
+// Write writes the report to dir as mantlemint-crash-<height>.json, and returns its path
+func (r *CrashReport) Write(dir string) (string, error) {
+	report, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("mantlemint-crash-%d.json", r.Height))
+	return path, os.WriteFile(path, report, 0o644)
+}
+
+// LogTail is an io.Writer keeping the last lines written to it, to tee logs into
+type LogTail struct {
+	mtx     sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial strings.Builder
+}
+
+func NewLogTail(size int) *LogTail {
+	return &LogTail{lines: make([]string, size)}
+}
+
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if len(t.lines) == 0 {
+		return len(p), nil
+	}
+
+	for _, b := range p {
+		if b != '\n' {
+			t.partial.WriteByte(b)
+			continue
+		}
+
+		t.lines[t.next] = t.partial.String()
+		t.partial.Reset()
+		if t.next = (t.next + 1) % len(t.lines); t.next == 0 {
+			t.full = true
+		}
+	}
+
+	return len(p), nil
+}
+
+// Lines returns the lines kept, oldest first
+func (t *LogTail) Lines() []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if !t.full {
+		return append([]string{}, t.lines[:t.next]...)
+	}
+	return append(append([]string{}, t.lines[t.next:]...), t.lines[:t.next]...)
+}
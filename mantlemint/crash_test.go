@@ -0,0 +1,75 @@
+package mantlemint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func TestLogTail(t *testing.T) {
+	tail := NewLogTail(3)
+	assert.Empty(t, tail.Lines())
+
+	_, _ = fmt.Fprint(tail, "one\ntwo\nthr")
+	assert.Equal(t, []string{"one", "two"}, tail.Lines())
+
+	_, _ = fmt.Fprint(tail, "ee\nfour\nfive\n")
+	assert.Equal(t, []string{"three", "four", "five"}, tail.Lines())
+
+	// nothing is kept at size 0
+	disabled := NewLogTail(0)
+	_, _ = fmt.Fprint(disabled, "one\n")
+	assert.Empty(t, disabled.Lines())
+}
+
+func TestCrashReport(t *testing.T) {
+	block := &tendermint.Block{
+		Header: tendermint.Header{ChainID: "test", Height: 10, AppHash: []byte{0xaa}},
+		Data:   tendermint.Data{Txs: tendermint.Txs{[]byte("tx1"), []byte("tx2")}},
+	}
+	evc := &EventCollector{
+		Height:             10,
+		ResponseDeliverTxs: []*abci.ResponseDeliverTx{{Code: 0, GasUsed: 100}, {Code: 5, Codespace: "sdk", Log: "insufficient funds"}},
+	}
+	stateStore := state.NewStore(tmdb.NewMemDB(), state.StoreOptions{})
+
+	report := NewCrashReport(
+		state.State{AppHash: []byte{0xbb}},
+		stateStore,
+		evc,
+		map[string][]byte{"bank": {0x01}},
+		block,
+		fmt.Errorf("wrong Block.Header.AppHash"),
+	)
+	report.Logs = []string{"last"}
+
+	assert.Equal(t, "AA", report.ExpectedAppHash)
+	assert.Equal(t, "BB", report.ComputedAppHash)
+	assert.Equal(t, map[string]string{"bank": "01"}, report.StoreHashes)
+	assert.Len(t, report.Txs, 2)
+	assert.Equal(t, fmt.Sprintf("%X", tendermint.Tx("tx1").Hash()), report.Txs[0].Hash)
+	assert.True(t, report.Txs[1].Executed)
+	assert.Equal(t, uint32(5), report.Txs[1].Code)
+
+	// results of another height are not taken
+	evc.Height = 9
+	report = NewCrashReport(state.State{}, stateStore, evc, nil, block, fmt.Errorf("failed"))
+	assert.False(t, report.Txs[0].Executed)
+
+	path, err := report.Write(t.TempDir())
+	assert.Nil(t, err)
+	written, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	var decoded CrashReport
+	assert.Nil(t, json.Unmarshal(written, &decoded))
+	assert.Equal(t, int64(10), decoded.Height)
+	assert.Equal(t, "failed", decoded.Error)
+}
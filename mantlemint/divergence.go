@@ -0,0 +1,186 @@
+package mantlemint
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	tm "github.com/tendermint/tendermint/types"
+)
+
+// maxAppHashesRetained bounds the app hashes kept to bisect a mismatch with, should checks keep failing
+const maxAppHashesRetained = 10000
+
+// HeaderFetcher fetches the header of the block at height from an upstream node
+type HeaderFetcher func(height int64) (*tm.Header, error)
+
+// Divergence is where the app hashes committed locally started to differ from the chain's
+type Divergence struct {
+	// Height is the first height found to differ; the one before matched, unless the upstream failed
+	// in the middle of the search, or checks failed for longer than app hashes are retained
+	Height     int64     `json:"height"`
+	Expected   string    `json:"expected_app_hash"`
+	Computed   string    `json:"computed_app_hash"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// DivergenceChecker compares, every few blocks, the app hash committed locally at a height with the one the
+// next block's header carries upstream, so that state drifting (i.e. on a nondeterministic module) doesn't
+// go unnoticed while queries keep being served. On a mismatch, the heights since the last match are bisected
+// for the first that differs. An upstream that fails only skips a check.
+//
+// It's only meaningful with merkle stores, as faux merkle mode commits placeholder hashes.
+type DivergenceChecker struct {
+	mtx         sync.Mutex
+	fetch       HeaderFetcher
+	every       int64
+	minInterval time.Duration
+
+	// app hashes committed since the last height that matched, by height
+	appHashes map[int64][]byte
+
+	checking    bool
+	lastCheckAt time.Time
+	diverged    *Divergence
+}
+
+// NewDivergenceChecker checks every `every` blocks, but no more often than once per minInterval
+func NewDivergenceChecker(fetch HeaderFetcher, every int64, minInterval time.Duration) *DivergenceChecker {
+	return &DivergenceChecker{
+		fetch:       fetch,
+		every:       every,
+		minInterval: minInterval,
+		appHashes:   make(map[int64][]byte),
+	}
+}
+
+// Observe records the app hash committed for the block at height. Every `every` blocks, the height before
+// is checked in the background, as the upstream has the block at height by then; checks don't overlap
+func (c *DivergenceChecker) Observe(height int64, appHash []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// once diverged, every height after is suspect; there's nothing more to find
+	if c.diverged != nil {
+		return
+	}
+
+	c.appHashes[height] = appHash
+	delete(c.appHashes, height-maxAppHashesRetained)
+
+	_, previous := c.appHashes[height-1]
+	if !previous || height%c.every != 0 || c.checking || time.Since(c.lastCheckAt) < c.minInterval {
+		return
+	}
+
+	c.checking = true
+	c.lastCheckAt = time.Now()
+	go c.check(height - 1)
+}
+
+// Diverged returns where state diverged, nil if it didn't as far as checked
+func (c *DivergenceChecker) Diverged() *Divergence {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.diverged == nil {
+		return nil
+	}
+	diverged := *c.diverged
+	return &diverged
+}
+
+func (c *DivergenceChecker) check(height int64) {
+	defer func() {
+		c.mtx.Lock()
+		c.checking = false
+		c.mtx.Unlock()
+	}()
+
+	expected, err := c.upstreamAppHash(height)
+	if err != nil {
+		log.Printf("[mantlemint/divergence] skipping check of height %d, upstream failed: %v\n", height, err)
+		return
+	}
+	if computed := c.appHash(height); bytes.Equal(computed, expected) {
+		c.markVerified(height)
+		log.Printf("[mantlemint/divergence] app hash at height %d matches upstream\n", height)
+		return
+	}
+
+	// the first height that differs is in (low, high]
+	low, high := c.searchRange(height)
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		midExpected, err := c.upstreamAppHash(mid)
+		if err != nil {
+			log.Printf("[mantlemint/divergence] bisection stopped at heights (%d, %d], upstream failed: %v\n", low, high, err)
+			break
+		}
+		if bytes.Equal(c.appHash(mid), midExpected) {
+			low = mid
+		} else {
+			high, expected = mid, midExpected
+		}
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.diverged = &Divergence{
+		Height:     high,
+		Expected:   fmt.Sprintf("%X", expected),
+		Computed:   fmt.Sprintf("%X", c.appHashes[high]),
+		DetectedAt: time.Now(),
+	}
+	log.Printf("[mantlemint/divergence] ALERT: state diverged from upstream at height %d, app hash %s upstream but %s computed\n",
+		high, c.diverged.Expected, c.diverged.Computed)
+}
+
+// upstreamAppHash returns the app hash of height, as recorded in the header of the next block
+func (c *DivergenceChecker) upstreamAppHash(height int64) ([]byte, error) {
+	header, err := c.fetch(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	if header.Height != height+1 {
+		return nil, fmt.Errorf("asked for the header at height %d, got %d", height+1, header.Height)
+	}
+	return header.AppHash, nil
+}
+
+func (c *DivergenceChecker) appHash(height int64) []byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.appHashes[height]
+}
+
+// markVerified forgets the app hashes up to height, which matched
+func (c *DivergenceChecker) markVerified(height int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for h := range c.appHashes {
+		if h <= height {
+			delete(c.appHashes, h)
+		}
+	}
+}
+
+// searchRange returns the heights to bisect up to height, from the last one that matched
+// or, failing that, the first one retained
+func (c *DivergenceChecker) searchRange(height int64) (low int64, high int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	low = height - 1
+	for {
+		if _, ok := c.appHashes[low]; !ok {
+			return low, height
+		}
+		low--
+	}
+}
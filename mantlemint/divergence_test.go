@@ -0,0 +1,54 @@
+package mantlemint
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+func TestDivergenceChecker(t *testing.T) {
+	var upstreamDown atomic.Bool
+	upstreamDown.Store(true)
+	checker := NewDivergenceChecker(func(height int64) (*tm.Header, error) {
+		if upstreamDown.Load() {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return &tm.Header{Height: height, AppHash: []byte(fmt.Sprintf("apphash-%d", height-1))}, nil
+	}, 10, 0)
+
+	// state drifts from height 24 on
+	observe := func(from int64, to int64) {
+		for height := from; height <= to; height++ {
+			appHash := []byte(fmt.Sprintf("apphash-%d", height))
+			if height >= 24 {
+				appHash = []byte("drifted")
+			}
+			checker.Observe(height, appHash)
+		}
+		assert.Eventually(t, func() bool {
+			checker.mtx.Lock()
+			defer checker.mtx.Unlock()
+			return !checker.checking
+		}, time.Second, time.Millisecond)
+	}
+
+	// a check the upstream fails is skipped
+	observe(1, 10)
+	assert.Nil(t, checker.Diverged())
+
+	upstreamDown.Store(false)
+	observe(11, 20)
+	assert.Nil(t, checker.Diverged())
+
+	// the first height that differs since the last match is found
+	observe(21, 30)
+	diverged := checker.Diverged()
+	assert.NotNil(t, diverged)
+	assert.Equal(t, int64(24), diverged.Height)
+	assert.Equal(t, fmt.Sprintf("%X", "apphash-24"), diverged.Expected)
+	assert.Equal(t, fmt.Sprintf("%X", "drifted"), diverged.Computed)
+}
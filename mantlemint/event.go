@@ -2,6 +2,7 @@ package mantlemint
 
 import (
 	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/state"
 	tm "github.com/tendermint/tendermint/types"
 )
 
@@ -17,6 +18,23 @@ func NewMantlemintEventCollector() *EventCollector {
 	return &EventCollector{}
 }
 
+// LoadEventCollector rebuilds what was collected while block was applied, from the ABCI responses
+// saved for it in the state store; i.e. to index a block again after it's injected
+func LoadEventCollector(stateStore state.Store, block *tm.Block) (*EventCollector, error) {
+	responses, err := stateStore.LoadABCIResponses(block.Height)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventCollector{
+		Height:             block.Height,
+		Block:              block,
+		ResponseBeginBlock: responses.BeginBlock,
+		ResponseEndBlock:   responses.EndBlock,
+		ResponseDeliverTxs: responses.DeliverTxs,
+	}, nil
+}
+
 // PublishEventNewBlock collects block, ResponseBeginBlock, ResponseEndBlock
 func (ev *EventCollector) PublishEventNewBlock(
 	block tm.EventDataNewBlock,
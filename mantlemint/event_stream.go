@@ -0,0 +1,283 @@
+package mantlemint
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+// BlockEvents are the events a block emitted, in a shape that doesn't follow tendermint's
+type BlockEvents struct {
+	Height     int64      `json:"height"`
+	Time       time.Time  `json:"time"`
+	BeginBlock []Event    `json:"begin_block"`
+	Txs        []TxEvents `json:"txs"`
+	EndBlock   []Event    `json:"end_block"`
+}
+
+// TxEvents are the events of a tx, in block order
+type TxEvents struct {
+	Hash   string  `json:"hash"`
+	Code   uint32  `json:"code"`
+	Events []Event `json:"events"`
+}
+
+type Event struct {
+	Type       string           `json:"type"`
+	Attributes []EventAttribute `json:"attributes"`
+}
+
+type EventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Index bool   `json:"index"`
+}
+
+// NewBlockEvents converts what evc collected while block was applied
+func NewBlockEvents(block *tm.Block, evc *EventCollector) *BlockEvents {
+	blockEvents := &BlockEvents{
+		Height:     block.Height,
+		Time:       block.Time,
+		BeginBlock: []Event{},
+		Txs:        make([]TxEvents, len(evc.ResponseDeliverTxs)),
+		EndBlock:   []Event{},
+	}
+	if evc.ResponseBeginBlock != nil {
+		blockEvents.BeginBlock = convertEvents(evc.ResponseBeginBlock.Events)
+	}
+	if evc.ResponseEndBlock != nil {
+		blockEvents.EndBlock = convertEvents(evc.ResponseEndBlock.Events)
+	}
+	for i, result := range evc.ResponseDeliverTxs {
+		blockEvents.Txs[i] = TxEvents{Code: result.Code, Events: convertEvents(result.Events)}
+		if i < len(block.Txs) {
+			blockEvents.Txs[i].Hash = fmt.Sprintf("%X", block.Txs[i].Hash())
+		}
+	}
+
+	return blockEvents
+}
+
+func convertEvents(events []abci.Event) []Event {
+	converted := make([]Event, len(events))
+	for i, event := range events {
+		converted[i] = Event{Type: event.Type, Attributes: make([]EventAttribute, len(event.Attributes))}
+		for j, attribute := range event.Attributes {
+			converted[i].Attributes[j] = EventAttribute{
+				Key:   string(attribute.Key),
+				Value: string(attribute.Value),
+				Index: attribute.Index,
+			}
+		}
+	}
+	return converted
+}
+
+// EventStream keeps the events of the last blocks, and hands them to subscribers as blocks come.
+// Every bundle carries its height, so a consumer that falls behind can tell what it missed, and
+// catch up on the blocks still retained with Since.
+type EventStream struct {
+	mtx    sync.RWMutex
+	retain int
+
+	// last blocks, oldest first
+	blocks []*BlockEvents
+
+	subscribers map[chan *BlockEvents]struct{}
+
+	// closed whenever a block is published
+	published chan struct{}
+
+	// closed once the stream is, for long-polls not to hold shutdown up
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewEventStream keeps the events of the last retain blocks
+func NewEventStream(retain int) *EventStream {
+	return &EventStream{
+		retain:      retain,
+		subscribers: make(map[chan *BlockEvents]struct{}),
+		published:   make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Publish adds the events of the next block. A subscriber with no room left for them is dropped,
+// its channel closed, rather than holding up injection
+func (s *EventStream) Publish(blockEvents *BlockEvents) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.blocks = append(s.blocks, blockEvents)
+	if len(s.blocks) > s.retain {
+		s.blocks = s.blocks[len(s.blocks)-s.retain:]
+	}
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- blockEvents:
+		default:
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	close(s.published)
+	s.published = make(chan struct{})
+}
+
+// Subscribe delivers the events of every block published from now on, buffering up to buffer blocks;
+// the channel is closed on unsubscribe, or once the subscriber falls behind by more than buffer blocks
+func (s *EventStream) Subscribe(buffer int) (<-chan *BlockEvents, func()) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	subscriber := make(chan *BlockEvents, buffer)
+	s.subscribers[subscriber] = struct{}{}
+
+	return subscriber, func() {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		if _, ok := s.subscribers[subscriber]; ok {
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+// Latest returns the events of the last block published, nil if none yet
+func (s *EventStream) Latest() *BlockEvents {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if len(s.blocks) == 0 {
+		return nil
+	}
+	return s.blocks[len(s.blocks)-1]
+}
+
+// Get returns the events of the block at height, nil if it's not retained
+func (s *EventStream) Get(height int64) *BlockEvents {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	for _, blockEvents := range s.blocks {
+		if blockEvents.Height == height {
+			return blockEvents
+		}
+	}
+	return nil
+}
+
+// Since returns the events of the blocks retained after height, oldest first. Complete is false
+// if blocks right after height are not retained anymore
+func (s *EventStream) Since(height int64) (blocks []*BlockEvents, complete bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	blocks = []*BlockEvents{}
+	for _, blockEvents := range s.blocks {
+		if blockEvents.Height > height {
+			blocks = append(blocks, blockEvents)
+		}
+	}
+
+	complete = len(s.blocks) == 0 || s.blocks[0].Height <= height+1
+	return blocks, complete
+}
+
+// Wait blocks until a block after height is published, or timeout passes
+func (s *EventStream) Wait(height int64, timeout time.Duration) {
+	s.mtx.RLock()
+	latest, published := int64(0), s.published
+	if len(s.blocks) != 0 {
+		latest = s.blocks[len(s.blocks)-1].Height
+	}
+	s.mtx.RUnlock()
+
+	if latest > height {
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-published:
+	case <-timer.C:
+	case <-s.closed:
+	}
+}
+
+// Close ends the long-polls waiting for a block, which respond with what they have then
+func (s *EventStream) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+var (
+	EndpointGETEvents       = "/events"
+	EndpointGETEventsLatest = "/events/latest"
+	EndpointGETEventsHeight = "/events/{height:[0-9]+}"
+)
+
+// maxEventsWait bounds how long a long-poll on events is held
+const maxEventsWait = time.Minute
+
+// RegisterEventRoutes registers routes to read the events of the blocks retained:
+// the latest one, one by height, and those after a height, long-polling for the next if there's none yet
+func RegisterEventRoutes(router *mux.Router, stream *EventStream) {
+	router.HandleFunc(EndpointGETEventsLatest, func(writer http.ResponseWriter, request *http.Request) {
+		blockEvents := stream.Latest()
+		if blockEvents == nil {
+			http.Error(writer, "no block injected yet", 404)
+			return
+		}
+		writeJSON(writer, blockEvents)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointGETEventsHeight, func(writer http.ResponseWriter, request *http.Request) {
+		height, _ := strconv.ParseInt(mux.Vars(request)["height"], 10, 64)
+		blockEvents := stream.Get(height)
+		if blockEvents == nil {
+			http.Error(writer, fmt.Sprintf("events of block %d are not retained", height), 404)
+			return
+		}
+		writeJSON(writer, blockEvents)
+	}).Methods("GET")
+
+	// ?after=<height> returns the blocks after height, waiting up to ?wait=<duration> (30s by default) for one;
+	// 410 if some of them are not retained anymore
+	router.HandleFunc(EndpointGETEvents, func(writer http.ResponseWriter, request *http.Request) {
+		after, err := strconv.ParseInt(request.URL.Query().Get("after"), 10, 64)
+		if err != nil || after < 0 {
+			http.Error(writer, "after must be a non-negative integer", 400)
+			return
+		}
+
+		wait := 30 * time.Second
+		if waitStr := request.URL.Query().Get("wait"); waitStr != "" {
+			if wait, err = time.ParseDuration(waitStr); err != nil || wait < 0 || wait > maxEventsWait {
+				http.Error(writer, fmt.Sprintf("wait must be a duration within [0s, %s]", maxEventsWait), 400)
+				return
+			}
+		}
+
+		if blocks, _ := stream.Since(after); len(blocks) == 0 && wait > 0 {
+			stream.Wait(after, wait)
+		}
+
+		blocks, complete := stream.Since(after)
+		if !complete {
+			http.Error(writer, fmt.Sprintf("events after block %d are not retained anymore; resume from block %d", after, blocks[0].Height), 410)
+			return
+		}
+		writeJSON(writer, blocks)
+	}).Methods("GET")
+}
@@ -0,0 +1,111 @@
+package mantlemint
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tm "github.com/tendermint/tendermint/types"
+)
+
+func TestNewBlockEvents(t *testing.T) {
+	block := &tm.Block{Header: tm.Header{Height: 10}, Data: tm.Data{Txs: tm.Txs{tm.Tx("tx")}}}
+	evc := &EventCollector{
+		ResponseBeginBlock: &abci.ResponseBeginBlock{Events: []abci.Event{{
+			Type:       "mint",
+			Attributes: []abci.EventAttribute{{Key: []byte("amount"), Value: []byte("100uluna"), Index: true}},
+		}}},
+		ResponseDeliverTxs: []*abci.ResponseDeliverTx{{Code: 5}},
+	}
+
+	blockEvents := NewBlockEvents(block, evc)
+	assert.Equal(t, int64(10), blockEvents.Height)
+	assert.Equal(t, []Event{{Type: "mint", Attributes: []EventAttribute{{Key: "amount", Value: "100uluna", Index: true}}}}, blockEvents.BeginBlock)
+	assert.Equal(t, []Event{}, blockEvents.EndBlock)
+	assert.Len(t, blockEvents.Txs, 1)
+	assert.Equal(t, uint32(5), blockEvents.Txs[0].Code)
+	assert.Len(t, blockEvents.Txs[0].Hash, 64)
+}
+
+func TestEventStream(t *testing.T) {
+	stream := NewEventStream(3)
+	fast, unsubscribe := stream.Subscribe(10)
+	defer unsubscribe()
+	slow, _ := stream.Subscribe(1)
+
+	for height := int64(1); height <= 5; height++ {
+		stream.Publish(&BlockEvents{Height: height})
+	}
+
+	// every block in order, each with its height
+	for height := int64(1); height <= 5; height++ {
+		assert.Equal(t, height, (<-fast).Height)
+	}
+
+	// a subscriber falling behind is dropped, after what it could take
+	assert.Equal(t, int64(1), (<-slow).Height)
+	_, open := <-slow
+	assert.False(t, open)
+
+	// only the last blocks are retained
+	assert.Equal(t, int64(5), stream.Latest().Height)
+	assert.Nil(t, stream.Get(2))
+	blocks, complete := stream.Since(2)
+	assert.True(t, complete)
+	assert.Len(t, blocks, 3)
+	_, complete = stream.Since(1)
+	assert.False(t, complete)
+}
+
+func TestEventRoutes(t *testing.T) {
+	stream := NewEventStream(3)
+	router := mux.NewRouter()
+	RegisterEventRoutes(router, stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// long-polls until the next block
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stream.Publish(&BlockEvents{Height: 1})
+	}()
+	response, err := http.Get(server.URL + "/events?after=0&wait=5s")
+	assert.Nil(t, err)
+	var blocks []*BlockEvents
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&blocks))
+	_ = response.Body.Close()
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, int64(1), blocks[0].Height)
+
+	response, err = http.Get(server.URL + "/events/1")
+	assert.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, 200, response.StatusCode)
+
+	// blocks dropped out of the window
+	for height := int64(2); height <= 5; height++ {
+		stream.Publish(&BlockEvents{Height: height})
+	}
+	response, err = http.Get(server.URL + "/events?after=0")
+	assert.Nil(t, err)
+	_ = response.Body.Close()
+	assert.Equal(t, 410, response.StatusCode)
+
+	// long-polls respond right away once the stream is closed, i.e. on shutdown
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stream.Close()
+	}()
+	start := time.Now()
+	response, err = http.Get(server.URL + "/events?after=5&wait=1m")
+	assert.Nil(t, err)
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&blocks))
+	_ = response.Body.Close()
+	assert.Empty(t, blocks)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
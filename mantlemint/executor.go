@@ -9,11 +9,17 @@ import (
 	"os"
 )
 
-// NewMantlemintExecutor creates stock tendermint block executor, with stubbed mempool and evidence pool
+// NewMantlemintExecutor creates stock tendermint block executor, with stubbed mempool and evidence pool.
+// Calls to the app are timed by timer, if any
 func NewMantlemintExecutor(
 	db tmdb.DB,
 	conn proxy.AppConnConsensus,
+	timer *ExecutionTimer,
 ) *state.BlockExecutor {
+	if timer != nil {
+		conn = &timedAppConn{AppConnConsensus: conn, timer: timer}
+	}
+
 	return state.NewBlockExecutor(
 		state.NewStore(db, state.StoreOptions{
 			DiscardABCIResponses: false,
@@ -0,0 +1,67 @@
+package mantlemint
+
+import (
+	"log"
+	"sync"
+)
+
+// Halter stops block injection above a height, like terrad's --halt-height, i.e. for coordinated upgrades.
+// Unlike terrad, the process keeps running and serving queries at the halt height, and the halt height
+// can be moved or cleared at runtime for injection to go on.
+type Halter struct {
+	mtx    sync.Mutex
+	height int64
+
+	// closed whenever the halt height changes
+	changed chan struct{}
+}
+
+// NewHalter halts injection above height; 0 disables halting
+func NewHalter(height int64) *Halter {
+	return &Halter{height: height, changed: make(chan struct{})}
+}
+
+// HaltHeight returns the last height to inject, or 0 if halting is disabled
+func (h *Halter) HaltHeight() int64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return h.height
+}
+
+// SetHaltHeight moves the halt height; 0 clears it
+func (h *Halter) SetHaltHeight(height int64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	log.Printf("[mantlemint/halt] halt height set to %d\n", height)
+	h.height = height
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// Halts tells whether a block at height is not to be injected
+func (h *Halter) Halts(height int64) bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return h.halts(height)
+}
+
+func (h *Halter) halts(height int64) bool {
+	return h.height > 0 && height > h.height
+}
+
+// Wait blocks while a block at height is not to be injected
+func (h *Halter) Wait(height int64) {
+	for {
+		h.mtx.Lock()
+		halts, changed := h.halts(height), h.changed
+		h.mtx.Unlock()
+
+		if !halts {
+			return
+		}
+		<-changed
+	}
+}
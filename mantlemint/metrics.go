@@ -0,0 +1,121 @@
+package mantlemint
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	blockStageSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "block_stage_seconds",
+		Help:      "Time spent on a stage of a block: fetch_wait, begin_block, deliver_tx (summed over txs), end_block, commit, flush and indexer.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"stage"})
+
+	blockTxs = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "block_txs",
+		Help:      "Number of txs in a block.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+
+	blockGasUsed = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "block_gas_used",
+		Help:      "Gas used by the txs of a block.",
+		Buckets:   prometheus.ExponentialBuckets(100_000, 2, 12),
+	})
+
+	height = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "height",
+		Help:      "Height of the latest block flushed, which queries are served at.",
+	})
+
+	syncLagBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "sync_lag_blocks",
+		Help:      "Blocks the latest block flushed is behind the latest block known upstream.",
+	})
+
+	syncLagSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "sync_lag_seconds",
+		Help:      "Time between the latest block flushed and its flush.",
+	})
+
+	indexerLagBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "indexer_lag_blocks",
+		Help:      "Blocks flushed that are still queued to be indexed, as of the latest flush.",
+	})
+
+	flushBlocks = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "flush_blocks",
+		Help:      "Number of blocks flushed in a db batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	flushBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "flush_bytes",
+		Help:      "Size of a db batch flushed.",
+		Buckets:   prometheus.ExponentialBuckets(64<<10, 2, 14),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(blockStageSeconds, blockTxs, blockGasUsed, height, syncLagBlocks, syncLagSeconds, indexerLagBlocks, flushBlocks, flushBytes)
+}
+
+// FlushStats is what's known of a db batch flushed
+type FlushStats struct {
+	// Height and BlockTime are those of the latest block flushed
+	Height    int64
+	BlockTime time.Time
+
+	// Blocks and Bytes are how many blocks the batch held, and its size
+	Blocks int
+	Bytes  int
+
+	// UpstreamHeight is the latest height known upstream, and IndexedHeight the latest height indexed, if known
+	UpstreamHeight int64
+	IndexedHeight  int64
+}
+
+// ObserveFlush records a flush, and how far behind the chain, and the index behind the state, are as of it
+func ObserveFlush(stats FlushStats) {
+	height.Set(float64(stats.Height))
+	if stats.UpstreamHeight > stats.Height {
+		syncLagBlocks.Set(float64(stats.UpstreamHeight - stats.Height))
+	} else {
+		syncLagBlocks.Set(0)
+	}
+	syncLagSeconds.Set(time.Since(stats.BlockTime).Seconds())
+	if stats.IndexedHeight != 0 && stats.IndexedHeight < stats.Height {
+		indexerLagBlocks.Set(float64(stats.Height - stats.IndexedHeight))
+	} else {
+		indexerLagBlocks.Set(0)
+	}
+	flushBlocks.Observe(float64(stats.Blocks))
+	flushBytes.Observe(float64(stats.Bytes))
+}
+
+// ObserveBlockTimings records the timings of a block to the prometheus histograms; a flush is only
+// recorded for blocks that were flushed
+func ObserveBlockTimings(timings BlockTimings) {
+	blockStageSeconds.WithLabelValues("fetch_wait").Observe(timings.FetchWait.Seconds())
+	blockStageSeconds.WithLabelValues("begin_block").Observe(timings.BeginBlock.Seconds())
+	blockStageSeconds.WithLabelValues("deliver_tx").Observe(timings.DeliverTxs.Seconds())
+	blockStageSeconds.WithLabelValues("end_block").Observe(timings.EndBlock.Seconds())
+	blockStageSeconds.WithLabelValues("commit").Observe(timings.Commit.Seconds())
+	if timings.Flush > 0 {
+		blockStageSeconds.WithLabelValues("flush").Observe(timings.Flush.Seconds())
+	}
+	blockStageSeconds.WithLabelValues("indexer").Observe(timings.Indexer.Seconds())
+	blockTxs.Observe(float64(timings.Txs))
+	blockGasUsed.Observe(float64(timings.GasUsed))
+}
@@ -0,0 +1,66 @@
+package mantlemint
+
+import (
+	"log"
+	"sync"
+)
+
+// Pauser freezes block injection at the current height, without stopping the process.
+// The injection loop calls Wait before taking the next block; a block being injected
+// when Pause is called is injected, flushed and indexed as usual before the loop stops.
+type Pauser struct {
+	mtx     sync.Mutex
+	resumed chan struct{}
+}
+
+func NewPauser() *Pauser {
+	return &Pauser{}
+}
+
+// Pause stops injection after the current block, if any; returns false if already paused
+func (p *Pauser) Pause() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.resumed != nil {
+		return false
+	}
+
+	log.Printf("[mantlemint/pause] pausing block injection\n")
+	p.resumed = make(chan struct{})
+	return true
+}
+
+// Resume continues injection right where it stopped; returns false if not paused
+func (p *Pauser) Resume() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.resumed == nil {
+		return false
+	}
+
+	log.Printf("[mantlemint/pause] resuming block injection\n")
+	close(p.resumed)
+	p.resumed = nil
+	return true
+}
+
+// IsPaused tells whether injection is paused
+func (p *Pauser) IsPaused() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.resumed != nil
+}
+
+// Wait blocks while injection is paused
+func (p *Pauser) Wait() {
+	p.mtx.Lock()
+	resumed := p.resumed
+	p.mtx.Unlock()
+
+	if resumed != nil {
+		<-resumed
+	}
+}
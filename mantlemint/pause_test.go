@@ -0,0 +1,70 @@
+package mantlemint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauser(t *testing.T) {
+	pauser := NewPauser()
+
+	// not paused; Wait returns right away
+	pauser.Wait()
+	assert.False(t, pauser.Resume())
+
+	assert.True(t, pauser.Pause())
+	assert.False(t, pauser.Pause())
+	assert.True(t, pauser.IsPaused())
+
+	waited := make(chan struct{})
+	go func() {
+		pauser.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.True(t, pauser.Resume())
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after Resume")
+	}
+	assert.False(t, pauser.IsPaused())
+}
+
+func TestHalter(t *testing.T) {
+	halter := NewHalter(0)
+	assert.False(t, halter.Halts(100))
+
+	halter.SetHaltHeight(10)
+	assert.False(t, halter.Halts(10))
+	assert.True(t, halter.Halts(11))
+
+	waited := make(chan struct{})
+	go func() {
+		halter.Wait(11)
+		close(waited)
+	}()
+
+	// still above the halt height
+	halter.SetHaltHeight(10)
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while halted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	halter.SetHaltHeight(0)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after the halt height was cleared")
+	}
+}
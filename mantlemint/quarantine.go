@@ -0,0 +1,157 @@
+package mantlemint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/terra-money/mantlemint/db/hld"
+)
+
+var poisonKey = []byte("mantlemint/quarantine/poison")
+
+// Poison records the last block that failed to inject, and how many times in a row it failed the same way
+type Poison struct {
+	Height    int64     `json:"height"`
+	Error     string    `json:"error"`
+	ErrorHash string    `json:"error_hash"`
+	Failures  int       `json:"failures"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// Quarantine keeps a block that keeps failing from being injected over and over, i.e. on a panic of the app
+// that only a fixed binary gets past. Failures are recorded in the db, at the height of the block, before
+// going down; once a block has failed the same way more than maxFailures times, it's quarantined.
+// Release lets it be retried.
+type Quarantine struct {
+	mtx         sync.Mutex
+	db          hld.HeightLimitEnabledDB
+	maxFailures int
+	poison      *Poison
+
+	// closed whenever the poison is released
+	released chan struct{}
+}
+
+// NewQuarantine loads the last failure recorded in db, if any
+func NewQuarantine(db hld.HeightLimitEnabledDB, maxFailures int) (*Quarantine, error) {
+	q := &Quarantine{db: db, maxFailures: maxFailures, released: make(chan struct{})}
+
+	poisonJSON, err := db.Get(0, poisonKey)
+	if err != nil {
+		return nil, err
+	}
+	if poisonJSON != nil {
+		q.poison = new(Poison)
+		if err := json.Unmarshal(poisonJSON, q.poison); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// RecordFailure records that the block at height failed to inject with failure, synced to disk
+func (q *Quarantine) RecordFailure(height int64, failure string) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	hash := sha256.Sum256([]byte(failure))
+	poison := &Poison{
+		Height:    height,
+		Error:     failure,
+		ErrorHash: hex.EncodeToString(hash[:]),
+		Failures:  1,
+		FailedAt:  time.Now(),
+	}
+	if q.poison != nil && q.poison.Height == height && q.poison.ErrorHash == poison.ErrorHash {
+		poison.Failures = q.poison.Failures + 1
+	}
+
+	poisonJSON, err := json.Marshal(poison)
+	if err != nil {
+		return err
+	}
+
+	batch := q.db.NewBatch(height)
+	defer batch.Close()
+	if err := batch.Set(poisonKey, poisonJSON); err != nil {
+		return err
+	}
+	if err := batch.WriteSync(); err != nil {
+		return err
+	}
+
+	log.Printf("[mantlemint/quarantine] block %d failed %d time(s) (error %s)\n", height, poison.Failures, poison.ErrorHash)
+	q.poison = poison
+	return nil
+}
+
+// Poison returns the block quarantined, if any
+func (q *Quarantine) Poison() *Poison {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if !q.quarantines(0) {
+		return nil
+	}
+	poison := *q.poison
+	return &poison
+}
+
+// Quarantines tells whether the block at height is not to be injected
+func (q *Quarantine) Quarantines(height int64) bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.quarantines(height)
+}
+
+// quarantines tells whether the block at height is quarantined, or whether any is if height is 0
+func (q *Quarantine) quarantines(height int64) bool {
+	return q.poison != nil &&
+		(height == 0 || q.poison.Height == height) &&
+		q.poison.Failures > q.maxFailures
+}
+
+// Release deletes the failures recorded, for the block to be retried; returns false if none is quarantined
+func (q *Quarantine) Release() (bool, error) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if !q.quarantines(0) {
+		return false, nil
+	}
+
+	batch := q.db.NewBatch(q.poison.Height)
+	defer batch.Close()
+	if err := batch.Delete(poisonKey); err != nil {
+		return false, err
+	}
+	if err := batch.WriteSync(); err != nil {
+		return false, err
+	}
+
+	log.Printf("[mantlemint/quarantine] releasing block %d\n", q.poison.Height)
+	q.poison = nil
+	close(q.released)
+	q.released = make(chan struct{})
+	return true, nil
+}
+
+// Wait blocks while the block at height is quarantined
+func (q *Quarantine) Wait(height int64) {
+	for {
+		q.mtx.Lock()
+		quarantines, released := q.quarantines(height), q.released
+		q.mtx.Unlock()
+
+		if !quarantines {
+			return
+		}
+		<-released
+	}
+}
@@ -0,0 +1,47 @@
+package mantlemint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestQuarantine(t *testing.T) {
+	db := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	quarantine, err := NewQuarantine(db, 1)
+	assert.Nil(t, err)
+
+	// failing another way starts over
+	assert.Nil(t, quarantine.RecordFailure(100, "wasm vm panicked"))
+	assert.Nil(t, quarantine.RecordFailure(100, "out of memory"))
+	assert.False(t, quarantine.Quarantines(100))
+
+	// failures survive restarts
+	quarantine, err = NewQuarantine(db, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, quarantine.RecordFailure(100, "out of memory"))
+	assert.True(t, quarantine.Quarantines(100))
+	assert.False(t, quarantine.Quarantines(101))
+	assert.Equal(t, 2, quarantine.Poison().Failures)
+
+	released := make(chan struct{})
+	go func() {
+		quarantine.Wait(100)
+		close(released)
+	}()
+
+	ok, err := quarantine.Release()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	<-released
+	assert.Nil(t, quarantine.Poison())
+
+	// released for good
+	quarantine, err = NewQuarantine(db, 1)
+	assert.Nil(t, err)
+	assert.False(t, quarantine.Quarantines(100))
+	ok, err = quarantine.Release()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
@@ -1,7 +1,12 @@
 package mantlemint
 
 import (
-	// "fmt"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
 	// abcicli "github.com/tendermint/tendermint/abci/client"
 	// abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/consensus"
@@ -10,9 +15,6 @@ import (
 	"github.com/tendermint/tendermint/state"
 	"github.com/tendermint/tendermint/store"
 
-	"log"
-	"sync"
-
 	tendermint "github.com/tendermint/tendermint/types"
 	tmdb "github.com/tendermint/tm-db"
 )
@@ -38,9 +40,12 @@ type Instance struct {
 
 	evc *EventCollector
 
-	// before and after callback
-	runBefore MantlemintCallbackBefore
-	runAfter  MantlemintCallbackAfter
+	// optional verification of blocks before they are applied
+	verifier BlockVerifier
+
+	// before and after callbacks, run in order of registration
+	runBefore []MantlemintCallbackBefore
+	runAfter  []MantlemintCallbackAfter
 }
 
 func NewMantlemint(
@@ -60,7 +65,7 @@ func NewMantlemint(
 		panic(err)
 	}
 
-	return &Instance{
+	mm := &Instance{
 		// subsystem
 		executor:   executor,
 		db:         db,
@@ -74,11 +79,17 @@ func NewMantlemint(
 		lastState:  lastState,
 		lastHeight: lastState.LastBlockHeight,
 		evc:        nil,
+	}
 
-		// mantlemint lifecycle hooks
-		runBefore: runBefore,
-		runAfter:  runAfter,
+	// mantlemint lifecycle hooks
+	if runBefore != nil {
+		mm.AddRunBefore(runBefore)
+	}
+	if runAfter != nil {
+		mm.AddRunAfter(runAfter)
 	}
+
+	return mm
 }
 
 // Init is port of ReplayBlocks() from tendermint,
@@ -89,6 +100,11 @@ func (mm *Instance) Init(genesis *tendermint.GenesisDoc) error {
 	// run genesis
 	log.Printf("genesisTime=%v, chainId=%v", genesis.GenesisTime, genesis.ChainID)
 
+	// state from an existing db must be of the same chain
+	if mm.lastHeight != 0 && mm.lastState.ChainID != genesis.ChainID {
+		return fmt.Errorf("db has state of chain %s, but genesis is for chain %s", mm.lastState.ChainID, genesis.ChainID)
+	}
+
 	if mm.lastHeight == 0 {
 		if genstate, err := state.MakeGenesisState(genesis); err != nil {
 			return err
@@ -124,6 +140,18 @@ func (mm *Instance) LoadInitialState() error {
 
 func (mm *Instance) Inject(block *tendermint.Block) error {
 	var currentState = mm.lastState
+
+	// a block of another chain would only blow up several heights later, at apphash
+	if block.ChainID != currentState.ChainID {
+		return fmt.Errorf("block(%d) is of chain %s, but mantlemint is running chain %s", block.Height, block.ChainID, currentState.ChainID)
+	}
+
+	if mm.verifier != nil {
+		if err := mm.verifier(currentState, block); err != nil {
+			return err
+		}
+	}
+
 	var blockID = tendermint.BlockID{
 		Hash:          block.Hash(),
 		PartSetHeader: block.MakePartSet(tendermint.BlockPartSizeBytes).Header(),
@@ -149,7 +177,7 @@ func (mm *Instance) Inject(block *tendermint.Block) error {
 	}
 
 	// process blocks
-	if nextState, retainHeight, err = mm.executor.ApplyBlock(currentState, blockID, block); err != nil {
+	if nextState, retainHeight, err = mm.applyBlock(currentState, blockID, block); err != nil {
 		return err
 	}
 
@@ -160,14 +188,31 @@ func (mm *Instance) Inject(block *tendermint.Block) error {
 	mm.lastState = nextState
 	mm.lastHeight = retainHeight
 
+	// the block is applied by now; RunAfter failures are reported, but don't undo it
 	if runAfterErr := mm.safeRunAfter(block, mm.evc); runAfterErr != nil {
-		return runAfterErr
+		return &RunAfterError{Height: block.Height, Err: runAfterErr}
 	}
 
 	// read events, form blockState and return it
 	return nil
 }
 
+// applyBlock applies block, turning the panic of x/upgrade at a plan the app has no handler for into
+// an UpgradeNeededError; any other panic is let through
+func (mm *Instance) applyBlock(currentState state.State, blockID tendermint.BlockID, block *tendermint.Block) (nextState state.State, retainHeight int64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if msg, ok := r.(string); ok && strings.HasPrefix(msg, "UPGRADE \"") && strings.Contains(msg, "\" NEEDED at ") {
+				err = &UpgradeNeededError{Height: block.Height, Msg: msg}
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	return mm.executor.ApplyBlock(currentState, blockID, block)
+}
+
 func (mm *Instance) GetCurrentHeight() int64 {
 	if mm.lastState.LastBlockHeight != 0 {
 		return mm.lastState.LastBlockHeight
@@ -184,26 +229,56 @@ func (mm *Instance) GetCurrentState() state.State {
 	return mm.lastState
 }
 
+// GetCurrentBlockEvents returns the events of the last block injected, nil if none yet
+func (mm *Instance) GetCurrentBlockEvents() *BlockEvents {
+	if mm.lastBlock == nil || mm.evc == nil {
+		return nil
+	}
+	return NewBlockEvents(mm.lastBlock, mm.evc)
+}
+
 func (mm *Instance) SetBlockExecutor(nextBlockExecutor Executor) {
 	mm.executor = nextBlockExecutor
 }
 
+// SetBlockVerifier sets a verifier to run on every block before it is applied; nil disables verification.
+func (mm *Instance) SetBlockVerifier(verifier BlockVerifier) {
+	mm.verifier = verifier
+}
+
 func (mm *Instance) GetCurrentEventCollector() *EventCollector {
 	return mm.evc
 }
 
+// AddRunBefore registers a hook to run before every block is applied, while its height is being written;
+// an error aborts the injection of the block
+func (mm *Instance) AddRunBefore(runBefore MantlemintCallbackBefore) {
+	mm.runBefore = append(mm.runBefore, runBefore)
+}
+
+// AddRunAfter registers a hook to run after every block is applied, with the events it emitted, while its
+// height is being written; an error is returned from Inject as a RunAfterError, the block being applied still
+func (mm *Instance) AddRunAfter(runAfter MantlemintCallbackAfter) {
+	mm.runAfter = append(mm.runAfter, runAfter)
+}
+
+// safeRunBefore runs hooks until one fails
 func (mm *Instance) safeRunBefore(block *tendermint.Block) error {
-	if mm.runBefore != nil {
-		return mm.runBefore(block)
-	} else {
-		return nil
+	for _, runBefore := range mm.runBefore {
+		if err := runBefore(block); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
+// safeRunAfter runs every hook, as the block is applied regardless; failures are joined
 func (mm *Instance) safeRunAfter(block *tendermint.Block, events *EventCollector) error {
-	if mm.runBefore != nil {
-		return mm.runAfter(block, events)
-	} else {
-		return nil
+	var errs []error
+	for _, runAfter := range mm.runAfter {
+		if err := runAfter(block, events); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,102 @@
+package mantlemint
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+func TestInjectRejectsForeignChain(t *testing.T) {
+	mm := &Instance{lastState: state.State{ChainID: "columbus-5"}}
+	block := &tendermint.Block{Header: tendermint.Header{ChainID: "bombay-12", Height: 10}}
+
+	err := mm.Inject(block)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "columbus-5")
+	assert.Contains(t, err.Error(), "bombay-12")
+}
+
+// stubExecutor applies every block, moving the state to its height
+type stubExecutor struct{}
+
+func (stubExecutor) ApplyBlock(lastState state.State, _ tendermint.BlockID, block *tendermint.Block) (state.State, int64, error) {
+	lastState.LastBlockHeight = block.Height
+	return lastState, block.Height, nil
+}
+
+func (stubExecutor) SetEventBus(_ tendermint.BlockEventPublisher) {}
+
+func TestInjectHooks(t *testing.T) {
+	var calls []string
+	mm := &Instance{executor: stubExecutor{}, lastState: state.State{ChainID: "columbus-5"}}
+	mm.AddRunBefore(func(block *tendermint.Block) error {
+		calls = append(calls, "before 1")
+		return nil
+	})
+	mm.AddRunBefore(func(block *tendermint.Block) error {
+		calls = append(calls, "before 2")
+		return nil
+	})
+	mm.AddRunAfter(func(block *tendermint.Block, events *EventCollector) error {
+		calls = append(calls, "after 1")
+		assert.NotNil(t, events)
+		return fmt.Errorf("bus is down")
+	})
+	mm.AddRunAfter(func(block *tendermint.Block, events *EventCollector) error {
+		calls = append(calls, "after 2")
+		return nil
+	})
+
+	// after hooks all run, and their failure doesn't undo the block
+	err := mm.Inject(&tendermint.Block{Header: tendermint.Header{ChainID: "columbus-5", Height: 10}})
+	var runAfterErr *RunAfterError
+	assert.True(t, errors.As(err, &runAfterErr))
+	assert.Equal(t, int64(10), runAfterErr.Height)
+	assert.Contains(t, err.Error(), "bus is down")
+	assert.Equal(t, []string{"before 1", "before 2", "after 1", "after 2"}, calls)
+	assert.Equal(t, int64(10), mm.GetCurrentHeight())
+
+	// a failing before hook aborts the block
+	calls = nil
+	mm.AddRunBefore(func(block *tendermint.Block) error {
+		return fmt.Errorf("not now")
+	})
+	err = mm.Inject(&tendermint.Block{Header: tendermint.Header{ChainID: "columbus-5", Height: 11}})
+	assert.False(t, errors.As(err, &runAfterErr))
+	assert.Equal(t, []string{"before 1", "before 2"}, calls)
+	assert.Equal(t, int64(10), mm.GetCurrentHeight())
+}
+
+// panicExecutor panics like the app would on applying a block
+type panicExecutor struct {
+	msg interface{}
+}
+
+func (e panicExecutor) ApplyBlock(_ state.State, _ tendermint.BlockID, _ *tendermint.Block) (state.State, int64, error) {
+	panic(e.msg)
+}
+
+func (panicExecutor) SetEventBus(_ tendermint.BlockEventPublisher) {}
+
+func TestInjectUpgradeNeeded(t *testing.T) {
+	mm := &Instance{
+		executor:  panicExecutor{msg: `UPGRADE "v2.5" NEEDED at height: 100: {}`},
+		lastState: state.State{ChainID: "columbus-5", LastBlockHeight: 99},
+	}
+
+	err := mm.Inject(&tendermint.Block{Header: tendermint.Header{ChainID: "columbus-5", Height: 100}})
+	var upgradeErr *UpgradeNeededError
+	assert.True(t, errors.As(err, &upgradeErr))
+	assert.Equal(t, int64(100), upgradeErr.Height)
+	assert.Equal(t, int64(99), mm.GetCurrentHeight())
+
+	// anything else still goes down
+	mm.executor = panicExecutor{msg: "out of gas"}
+	assert.PanicsWithValue(t, "out of gas", func() {
+		_ = mm.Inject(&tendermint.Block{Header: tendermint.Header{ChainID: "columbus-5", Height: 100}})
+	})
+}
@@ -0,0 +1,246 @@
+package mantlemint
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmstate "github.com/tendermint/tendermint/proto/tendermint/state"
+)
+
+// maxEventsListed bounds the events listed for a set of events that differ, for a log line to stay readable
+const maxEventsListed = 5
+
+// ResultsFetcher fetches the results of the block at height from an upstream node, along with which node it was
+type ResultsFetcher func(height int64) (results *tmstate.ABCIResponses, source string, err error)
+
+// ResultsFetcherFromEach fetches the results of the block at height from every upstream node, by node;
+// those that failed are left out
+type ResultsFetcherFromEach func(height int64) map[string]*tmstate.ABCIResponses
+
+// ResultDifference is a difference between the results of a block executed locally and upstream
+type ResultDifference struct {
+	// TxIndex is the index of the tx in the block; -1 for the events of begin and end block
+	TxIndex int
+	Detail  string
+}
+
+func (d ResultDifference) String() string {
+	if d.TxIndex < 0 {
+		return d.Detail
+	}
+	return fmt.Sprintf("tx %d: %s", d.TxIndex, d.Detail)
+}
+
+// ResultsChecker compares, every few blocks, the results of the txs executed locally with those an upstream
+// node reports on /block_results: result codes, gas, and events, so that nondeterminism shows up early, before
+// app hashes would tell (if syncing with merkle stores at all). Upon differences, the results of every upstream
+// node are compared too, for nodes that disagree among themselves to be told apart from local nondeterminism.
+// Differences are only logged; an upstream that fails only skips a check.
+type ResultsChecker struct {
+	mtx       sync.Mutex
+	fetch     ResultsFetcher
+	fetchEach ResultsFetcherFromEach
+	every     int64
+	checking  bool
+}
+
+// NewResultsChecker checks every `every` blocks; 1 checks every block
+func NewResultsChecker(fetch ResultsFetcher, fetchEach ResultsFetcherFromEach, every int64) *ResultsChecker {
+	return &ResultsChecker{
+		fetch:     fetch,
+		fetchEach: fetchEach,
+		every:     every,
+	}
+}
+
+// Observe checks the results collected by evc for its block in the background, every `every` blocks;
+// checks don't overlap, a block coming while one is running isn't checked
+func (c *ResultsChecker) Observe(evc *EventCollector) {
+	if evc == nil || evc.Height%c.every != 0 {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.checking {
+		return
+	}
+	c.checking = true
+
+	// a collector is only ever filled for one block, it's safe to read on the side
+	go c.check(evc.Height, &tmstate.ABCIResponses{
+		DeliverTxs: evc.ResponseDeliverTxs,
+		BeginBlock: evc.ResponseBeginBlock,
+		EndBlock:   evc.ResponseEndBlock,
+	})
+}
+
+func (c *ResultsChecker) check(height int64, local *tmstate.ABCIResponses) {
+	defer func() {
+		c.mtx.Lock()
+		c.checking = false
+		c.mtx.Unlock()
+	}()
+
+	upstream, source, err := c.fetch(height)
+	if err != nil {
+		log.Printf("[mantlemint/results] skipping check of height %d, upstream failed: %v\n", height, err)
+		return
+	}
+
+	differences := DiffResults(local, upstream)
+	if len(differences) == 0 {
+		log.Printf("[mantlemint/results] results at height %d match %s\n", height, source)
+		return
+	}
+	for _, difference := range differences {
+		log.Printf("[mantlemint/results] height %d, %s: %s\n", height, source, difference)
+	}
+
+	// tell whether the node checked against is the odd one out
+	others := c.fetchEach(height)
+	sources := make([]string, 0, len(others))
+	for other := range others {
+		sources = append(sources, other)
+	}
+	sort.Strings(sources)
+	for _, other := range sources {
+		log.Printf("[mantlemint/results] height %d, %s: %d differences from local results, %d from %s\n",
+			height, other, len(DiffResults(local, others[other])), len(DiffResults(upstream, others[other])), source)
+	}
+}
+
+// DiffResults returns how the results of a block executed locally differ from upstream's: per tx, the result code,
+// gas wanted and used, and events; and the events of begin and end block. Events are compared as sets, as the
+// index flag of attributes depends on the node's config; events and attributes that only differ in order are
+// told apart, as they're usually what differs.
+func DiffResults(local *tmstate.ABCIResponses, upstream *tmstate.ABCIResponses) []ResultDifference {
+	var differences []ResultDifference
+	if len(local.DeliverTxs) != len(upstream.DeliverTxs) {
+		differences = append(differences, ResultDifference{
+			TxIndex: -1,
+			Detail:  fmt.Sprintf("%d txs locally but %d upstream", len(local.DeliverTxs), len(upstream.DeliverTxs)),
+		})
+	}
+
+	for i := 0; i < len(local.DeliverTxs) && i < len(upstream.DeliverTxs); i++ {
+		l, u := local.DeliverTxs[i], upstream.DeliverTxs[i]
+		if l.Code != u.Code || l.Codespace != u.Codespace {
+			differences = append(differences, ResultDifference{TxIndex: i, Detail: fmt.Sprintf("code %s/%d locally but %s/%d upstream", l.Codespace, l.Code, u.Codespace, u.Code)})
+		}
+		if l.GasWanted != u.GasWanted {
+			differences = append(differences, ResultDifference{TxIndex: i, Detail: fmt.Sprintf("gas wanted %d locally but %d upstream", l.GasWanted, u.GasWanted)})
+		}
+		if l.GasUsed != u.GasUsed {
+			differences = append(differences, ResultDifference{TxIndex: i, Detail: fmt.Sprintf("gas used %d locally but %d upstream", l.GasUsed, u.GasUsed)})
+		}
+		if detail := diffEvents(l.Events, u.Events); detail != "" {
+			differences = append(differences, ResultDifference{TxIndex: i, Detail: detail})
+		}
+	}
+
+	if detail := diffEvents(beginBlockEvents(local), beginBlockEvents(upstream)); detail != "" {
+		differences = append(differences, ResultDifference{TxIndex: -1, Detail: "begin block " + detail})
+	}
+	if detail := diffEvents(endBlockEvents(local), endBlockEvents(upstream)); detail != "" {
+		differences = append(differences, ResultDifference{TxIndex: -1, Detail: "end block " + detail})
+	}
+
+	return differences
+}
+
+func beginBlockEvents(responses *tmstate.ABCIResponses) []abci.Event {
+	if responses.BeginBlock == nil {
+		return nil
+	}
+	return responses.BeginBlock.Events
+}
+
+func endBlockEvents(responses *tmstate.ABCIResponses) []abci.Event {
+	if responses.EndBlock == nil {
+		return nil
+	}
+	return responses.EndBlock.Events
+}
+
+// diffEvents describes how local events differ from upstream's, empty if they don't
+func diffEvents(local []abci.Event, upstream []abci.Event) string {
+	localKeys, upstreamKeys := eventKeys(local, false), eventKeys(upstream, false)
+	if equalStrings(localKeys, upstreamKeys) {
+		return ""
+	}
+	if equalStrings(sortedStrings(localKeys), sortedStrings(upstreamKeys)) {
+		return "events in another order"
+	}
+	if equalStrings(sortedStrings(eventKeys(local, true)), sortedStrings(eventKeys(upstream, true))) {
+		return "event attributes in another order"
+	}
+
+	missing, extra := setDifference(upstreamKeys, localKeys), setDifference(localKeys, upstreamKeys)
+	return fmt.Sprintf("events differ, missing locally: %s; only local: %s", listEvents(missing), listEvents(extra))
+}
+
+// eventKeys renders each event as a string, with attributes sorted if sortAttributes
+func eventKeys(events []abci.Event, sortAttributes bool) []string {
+	keys := make([]string, len(events))
+	for i, event := range events {
+		attributes := make([]string, len(event.Attributes))
+		for j, attribute := range event.Attributes {
+			attributes[j] = fmt.Sprintf("%s=%s", attribute.Key, attribute.Value)
+		}
+		if sortAttributes {
+			sort.Strings(attributes)
+		}
+		keys[i] = fmt.Sprintf("%s{%s}", event.Type, strings.Join(attributes, ","))
+	}
+	return keys
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedStrings(a []string) []string {
+	sorted := append([]string(nil), a...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// setDifference returns the elements of a that aren't in b, counting duplicates
+func setDifference(a []string, b []string) []string {
+	counts := make(map[string]int, len(b))
+	for _, key := range b {
+		counts[key]++
+	}
+	var difference []string
+	for _, key := range a {
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		difference = append(difference, key)
+	}
+	return difference
+}
+
+func listEvents(keys []string) string {
+	if len(keys) == 0 {
+		return "none"
+	}
+	if len(keys) > maxEventsListed {
+		return fmt.Sprintf("%s and %d more", strings.Join(keys[:maxEventsListed], " "), len(keys)-maxEventsListed)
+	}
+	return strings.Join(keys, " ")
+}
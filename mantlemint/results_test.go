@@ -0,0 +1,102 @@
+package mantlemint
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmstate "github.com/tendermint/tendermint/proto/tendermint/state"
+)
+
+func event(eventType string, attributes ...string) abci.Event {
+	event := abci.Event{Type: eventType}
+	for i := 0; i < len(attributes); i += 2 {
+		event.Attributes = append(event.Attributes, abci.EventAttribute{Key: []byte(attributes[i]), Value: []byte(attributes[i+1])})
+	}
+	return event
+}
+
+func TestDiffResults(t *testing.T) {
+	transfer := event("transfer", "recipient", "terra1a", "amount", "1uluna")
+	swapped := event("transfer", "amount", "1uluna", "recipient", "terra1a")
+	message := event("message", "action", "send")
+	responses := func(code uint32, gasUsed int64, events ...abci.Event) *tmstate.ABCIResponses {
+		return &tmstate.ABCIResponses{
+			DeliverTxs: []*abci.ResponseDeliverTx{{GasWanted: 100}, {Code: code, GasWanted: 100, GasUsed: gasUsed, Events: events}},
+			BeginBlock: &abci.ResponseBeginBlock{Events: []abci.Event{message}},
+		}
+	}
+	local := responses(0, 50, message, transfer)
+
+	// the index flag of attributes is up to the node
+	indexed := responses(0, 50, message, transfer)
+	indexed.DeliverTxs[1].Events[1].Attributes[0].Index = true
+	assert.Empty(t, DiffResults(local, indexed))
+
+	assert.Equal(t, []ResultDifference{
+		{TxIndex: 1, Detail: "code /5 locally but /0 upstream"},
+		{TxIndex: 1, Detail: "gas used 50 locally but 60 upstream"},
+	}, DiffResults(responses(5, 50, message, transfer), responses(0, 60, message, transfer)))
+
+	// differences in order only are told apart
+	assert.Equal(t, []ResultDifference{{TxIndex: 1, Detail: "events in another order"}}, DiffResults(local, responses(0, 50, transfer, message)))
+	assert.Equal(t, []ResultDifference{{TxIndex: 1, Detail: "event attributes in another order"}}, DiffResults(local, responses(0, 50, message, swapped)))
+	assert.Equal(t, []ResultDifference{{TxIndex: 1, Detail: "events differ, missing locally: none; only local: transfer{recipient=terra1a,amount=1uluna}"}},
+		DiffResults(local, responses(0, 50, message)))
+
+	// as are txs missing, and events of begin and end block
+	upstream := responses(0, 50, message, transfer)
+	upstream.DeliverTxs = upstream.DeliverTxs[:1]
+	upstream.BeginBlock = nil
+	upstream.EndBlock = &abci.ResponseEndBlock{Events: []abci.Event{message}}
+	assert.Equal(t, []ResultDifference{
+		{TxIndex: -1, Detail: "2 txs locally but 1 upstream"},
+		{TxIndex: -1, Detail: "begin block events differ, missing locally: none; only local: message{action=send}"},
+		{TxIndex: -1, Detail: "end block events differ, missing locally: message{action=send}; only local: none"},
+	}, DiffResults(local, upstream))
+}
+
+func TestResultsChecker(t *testing.T) {
+	var fetched, fetchedFromEach atomic.Int64
+	checker := NewResultsChecker(func(height int64) (*tmstate.ABCIResponses, string, error) {
+		fetched.Add(1)
+		if height == 20 {
+			return &tmstate.ABCIResponses{DeliverTxs: []*abci.ResponseDeliverTx{{Code: 5}}}, "upstream", nil
+		}
+		if height == 30 {
+			return nil, "", fmt.Errorf("connection refused")
+		}
+		return &tmstate.ABCIResponses{DeliverTxs: []*abci.ResponseDeliverTx{{}}}, "upstream", nil
+	}, func(height int64) map[string]*tmstate.ABCIResponses {
+		fetchedFromEach.Add(1)
+		return nil
+	}, 10)
+
+	observe := func(from int64, to int64) {
+		for height := from; height <= to; height++ {
+			checker.Observe(&EventCollector{Height: height, ResponseDeliverTxs: []*abci.ResponseDeliverTx{{}}})
+		}
+		assert.Eventually(t, func() bool {
+			checker.mtx.Lock()
+			defer checker.mtx.Unlock()
+			return !checker.checking
+		}, time.Second, time.Millisecond)
+	}
+
+	// blocks are sampled, and upstream nodes are only all asked upon differences
+	observe(1, 10)
+	assert.Equal(t, int64(1), fetched.Load())
+	assert.Equal(t, int64(0), fetchedFromEach.Load())
+
+	observe(11, 20)
+	assert.Equal(t, int64(2), fetched.Load())
+	assert.Equal(t, int64(1), fetchedFromEach.Load())
+
+	// a check the upstream fails is skipped
+	observe(21, 30)
+	assert.Equal(t, int64(3), fetched.Load())
+	assert.Equal(t, int64(1), fetchedFromEach.Load())
+}
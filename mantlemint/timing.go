@@ -0,0 +1,99 @@
+package mantlemint
+
+import (
+	"sync"
+	"time"
+
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/proxy"
+)
+
+// BlockTimings are how long the stages of a block took, along with what it weighed
+type BlockTimings struct {
+	Height int64
+
+	// FetchWait is how long the block was waited for from the feed
+	FetchWait time.Duration
+
+	// BeginBlock, DeliverTxs (summed over txs), EndBlock and Commit are timed on the app connection
+	BeginBlock time.Duration
+	DeliverTxs time.Duration
+	EndBlock   time.Duration
+	Commit     time.Duration
+
+	// Flush is 0 unless the block was flushed along with it, i.e. while catching up; Indexer is how long
+	// the blocks flushed waited to be queued to be indexed, or took to be indexed without a queue
+	Flush   time.Duration
+	Indexer time.Duration
+
+	Txs     int
+	GasUsed int64
+}
+
+// Total is the sum of all stages
+func (t BlockTimings) Total() time.Duration {
+	return t.FetchWait + t.BeginBlock + t.DeliverTxs + t.EndBlock + t.Commit + t.Flush + t.Indexer
+}
+
+// ExecutionTimer times the ABCI calls of the executor to the app, block by block
+type ExecutionTimer struct {
+	mtx     sync.Mutex
+	timings BlockTimings
+}
+
+func NewExecutionTimer() *ExecutionTimer {
+	return &ExecutionTimer{}
+}
+
+// Reset starts timing the next block
+func (t *ExecutionTimer) Reset() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.timings = BlockTimings{}
+}
+
+// Timings returns what's timed since the last Reset
+func (t *ExecutionTimer) Timings() BlockTimings {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.timings
+}
+
+func (t *ExecutionTimer) add(stage *time.Duration, since time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	*stage += time.Since(since)
+}
+
+var _ proxy.AppConnConsensus = (*timedAppConn)(nil)
+
+// timedAppConn times the calls the executor makes to the app on conn; DeliverTxAsync is timed
+// as a whole, as it's run right away by the local client
+type timedAppConn struct {
+	proxy.AppConnConsensus
+	timer *ExecutionTimer
+}
+
+func (c *timedAppConn) BeginBlockSync(req abci.RequestBeginBlock) (*abci.ResponseBeginBlock, error) {
+	defer c.timer.add(&c.timer.timings.BeginBlock, time.Now())
+	return c.AppConnConsensus.BeginBlockSync(req)
+}
+
+func (c *timedAppConn) DeliverTxAsync(req abci.RequestDeliverTx) *abcicli.ReqRes {
+	defer c.timer.add(&c.timer.timings.DeliverTxs, time.Now())
+	return c.AppConnConsensus.DeliverTxAsync(req)
+}
+
+func (c *timedAppConn) EndBlockSync(req abci.RequestEndBlock) (*abci.ResponseEndBlock, error) {
+	defer c.timer.add(&c.timer.timings.EndBlock, time.Now())
+	return c.AppConnConsensus.EndBlockSync(req)
+}
+
+func (c *timedAppConn) CommitSync() (*abci.ResponseCommit, error) {
+	defer c.timer.add(&c.timer.timings.Commit, time.Now())
+	return c.AppConnConsensus.CommitSync()
+}
@@ -1,6 +1,8 @@
 package mantlemint
 
 import (
+	"fmt"
+
 	"github.com/tendermint/tendermint/state"
 	tendermint "github.com/tendermint/tendermint/types"
 )
@@ -13,7 +15,11 @@ type Mantlemint interface {
 	GetCurrentBlock() *tendermint.Block
 	GetCurrentState() state.State
 	GetCurrentEventCollector() *EventCollector
+	GetCurrentBlockEvents() *BlockEvents
 	SetBlockExecutor(executor Executor)
+	SetBlockVerifier(verifier BlockVerifier)
+	AddRunBefore(runBefore MantlemintCallbackBefore)
+	AddRunAfter(runAfter MantlemintCallbackAfter)
 }
 
 type Executor interface {
@@ -24,4 +30,30 @@ type Executor interface {
 type MantlemintCallbackBefore func(block *tendermint.Block) error
 type MantlemintCallbackAfter func(block *tendermint.Block, events *EventCollector) error
 
+// RunAfterError is returned from Inject when RunAfter hooks fail; the block is applied nonetheless,
+// and is to be flushed as usual
+type RunAfterError struct {
+	Height int64
+	Err    error
+}
+
+func (e *RunAfterError) Error() string {
+	return fmt.Sprintf("run after hooks failed at height %d: %v", e.Height, e.Err)
+}
+
+func (e *RunAfterError) Unwrap() error {
+	return e.Err
+}
+
+// UpgradeNeededError is returned from Inject when the app stops at an x/upgrade plan it has no handler for;
+// the block is not applied, and won't be until the binary is swapped for one that has it
+type UpgradeNeededError struct {
+	Height int64
+	Msg    string
+}
+
+func (e *UpgradeNeededError) Error() string {
+	return fmt.Sprintf("upgrade needed at height %d: %s", e.Height, e.Msg)
+}
+
 // --- internal types
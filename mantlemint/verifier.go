@@ -0,0 +1,112 @@
+package mantlemint
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+// BlockVerifier checks a block against the state it is about to be applied on.
+// A non-nil error rejects the block before anything is written.
+type BlockVerifier func(lastState state.State, block *tendermint.Block) error
+
+// BlockVerificationError tells which check a block has failed
+type BlockVerificationError struct {
+	Height int64
+	Check  string
+	Err    error
+}
+
+func (e *BlockVerificationError) Error() string {
+	return fmt.Sprintf("block(%d) failed %s verification: %v", e.Height, e.Check, e.Err)
+}
+
+func (e *BlockVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyBlock verifies a block the way a light client would, against the last state:
+//   - the block is internally consistent, and its header links to the last block
+//   - the validator sets in the header are the ones the state is tracking
+//   - LastCommit carries +2/3 of the last validator set's signatures for the last block
+//
+// Validator set changes from EndBlock are carried over by the state itself
+// (LastValidators <- Validators <- NextValidators), so no extra bookkeeping is needed here.
+func VerifyBlock(lastState state.State, block *tendermint.Block) error {
+	fail := func(check string, err error) error {
+		return &BlockVerificationError{Height: block.Height, Check: check, Err: err}
+	}
+
+	if err := block.ValidateBasic(); err != nil {
+		return fail("basic", err)
+	}
+
+	if block.ChainID != lastState.ChainID {
+		return fail("chain id", fmt.Errorf("expected %s, got %s", lastState.ChainID, block.ChainID))
+	}
+
+	// header hash chain
+	if lastState.LastBlockHeight > 0 && block.Height != lastState.LastBlockHeight+1 {
+		return fail("height", fmt.Errorf("expected %d, got %d", lastState.LastBlockHeight+1, block.Height))
+	}
+	if !block.LastBlockID.Equals(lastState.LastBlockID) {
+		return fail("header chain", fmt.Errorf("last block id expected %v, got %v", lastState.LastBlockID, block.LastBlockID))
+	}
+
+	// validator sets
+	if !bytes.Equal(block.ValidatorsHash, lastState.Validators.Hash()) {
+		return fail("validators hash", fmt.Errorf("expected %X, got %X", lastState.Validators.Hash(), block.ValidatorsHash))
+	}
+	if !bytes.Equal(block.NextValidatorsHash, lastState.NextValidators.Hash()) {
+		return fail("next validators hash", fmt.Errorf("expected %X, got %X", lastState.NextValidators.Hash(), block.NextValidatorsHash))
+	}
+	if !lastState.Validators.HasAddress(block.ProposerAddress) {
+		return fail("proposer", fmt.Errorf("%X is not a validator", block.ProposerAddress))
+	}
+
+	// signatures
+	if block.Height == lastState.InitialHeight {
+		if len(block.LastCommit.Signatures) != 0 {
+			return fail("last commit", fmt.Errorf("initial block can't have LastCommit signatures"))
+		}
+	} else if err := lastState.LastValidators.VerifyCommitLight(
+		lastState.ChainID, lastState.LastBlockID, block.Height-1, block.LastCommit,
+	); err != nil {
+		return fail("last commit signatures", err)
+	}
+
+	return nil
+}
+
+// VerifyAppHash checks that the app hash committed locally for the last block is the one the chain recorded
+// in this block's header. It's only meaningful with merkle stores, as faux merkle mode commits placeholder hashes.
+func VerifyAppHash(lastState state.State, block *tendermint.Block) error {
+	// nothing committed yet to compare against
+	if lastState.LastBlockHeight == 0 {
+		return nil
+	}
+
+	if !bytes.Equal(block.AppHash, lastState.AppHash) {
+		return &BlockVerificationError{
+			Height: block.Height,
+			Check:  "app hash",
+			Err:    fmt.Errorf("block %d was recorded with %X, but computed %X", lastState.LastBlockHeight, block.AppHash, lastState.AppHash),
+		}
+	}
+
+	return nil
+}
+
+// VerifyAll runs verifiers in order, failing on the first error
+func VerifyAll(verifiers ...BlockVerifier) BlockVerifier {
+	return func(lastState state.State, block *tendermint.Block) error {
+		for _, verifier := range verifiers {
+			if err := verifier(lastState, block); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package mantlemint
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+const testChainID = "verifier-test"
+
+// makeTestState returns a state right after the block at height 9, signed by a fresh validator set
+func makeTestState(t *testing.T) (state.State, []tendermint.PrivValidator, *tendermint.Commit) {
+	valSet, privVals := tendermint.RandValidatorSet(4, 10)
+	lastBlockID := tendermint.BlockID{
+		Hash:          make([]byte, 32),
+		PartSetHeader: tendermint.PartSetHeader{Total: 1, Hash: make([]byte, 32)},
+	}
+	lastBlockID.Hash[0] = 1
+
+	voteSet := tendermint.NewVoteSet(testChainID, 9, 0, tmproto.PrecommitType, valSet)
+	commit, err := tendermint.MakeCommit(lastBlockID, 9, 0, voteSet, privVals, time.Now())
+	assert.Nil(t, err)
+
+	return state.State{
+		ChainID:         testChainID,
+		InitialHeight:   1,
+		LastBlockHeight: 9,
+		LastBlockID:     lastBlockID,
+		LastValidators:  valSet,
+		Validators:      valSet,
+		NextValidators:  valSet,
+	}, privVals, commit
+}
+
+func makeTestBlock(lastState state.State, commit *tendermint.Commit) *tendermint.Block {
+	block := tendermint.MakeBlock(lastState.LastBlockHeight+1, nil, commit, nil)
+	block.ChainID = lastState.ChainID
+	block.LastBlockID = lastState.LastBlockID
+	block.ValidatorsHash = lastState.Validators.Hash()
+	block.NextValidatorsHash = lastState.NextValidators.Hash()
+	block.ProposerAddress = lastState.Validators.Validators[0].Address
+	return block
+}
+
+func assertVerificationFailure(t *testing.T, err error, check string) {
+	var verificationErr *BlockVerificationError
+	assert.True(t, errors.As(err, &verificationErr), "expected verification error, got %v", err)
+	if verificationErr != nil {
+		assert.Equal(t, check, verificationErr.Check)
+	}
+}
+
+func TestVerifyBlock(t *testing.T) {
+	lastState, _, commit := makeTestState(t)
+	assert.Nil(t, VerifyBlock(lastState, makeTestBlock(lastState, commit)))
+
+	// forked header chain
+	block := makeTestBlock(lastState, commit)
+	block.LastBlockID.Hash = make([]byte, 32)
+	assertVerificationFailure(t, VerifyBlock(lastState, block), "header chain")
+
+	// validator set the state doesn't know of
+	otherValSet, otherPrivVals := tendermint.RandValidatorSet(4, 10)
+	block = makeTestBlock(lastState, commit)
+	block.NextValidatorsHash = otherValSet.Hash()
+	assertVerificationFailure(t, VerifyBlock(lastState, block), "next validators hash")
+
+	// commit signed by somebody else
+	voteSet := tendermint.NewVoteSet(testChainID, 9, 0, tmproto.PrecommitType, otherValSet)
+	forgedCommit, err := tendermint.MakeCommit(lastState.LastBlockID, 9, 0, voteSet, otherPrivVals, time.Now())
+	assert.Nil(t, err)
+	assertVerificationFailure(t, VerifyBlock(lastState, makeTestBlock(lastState, forgedCommit)), "last commit signatures")
+}
+
+func TestVerifyAppHash(t *testing.T) {
+	lastState, _, commit := makeTestState(t)
+	lastState.AppHash = []byte{1, 2, 3}
+
+	block := makeTestBlock(lastState, commit)
+	block.AppHash = []byte{1, 2, 3}
+	assert.Nil(t, VerifyAppHash(lastState, block))
+	assert.Nil(t, VerifyAll(VerifyBlock, VerifyAppHash)(lastState, block))
+
+	block.AppHash = []byte{3, 2, 1}
+	assertVerificationFailure(t, VerifyAppHash(lastState, block), "app hash")
+	assertVerificationFailure(t, VerifyAll(VerifyBlock, VerifyAppHash)(lastState, block), "app hash")
+
+	// nothing was committed before the initial block
+	lastState.LastBlockHeight = 0
+	assert.Nil(t, VerifyAppHash(lastState, block))
+}
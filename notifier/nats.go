@@ -0,0 +1,198 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var _ Publisher = (*NATS)(nil)
+
+// NATS publishes over the core NATS protocol, to the server at a nats:// url, or tls:// for tls to be required;
+// credentials are taken from the url, a user without a password being a token. Every publish is acknowledged
+// by a ping, for a message the server never got not to pass as published. The connection is made on the first
+// publish, and again on the next one after it fails.
+type NATS struct {
+	url *url.URL
+
+	mtx    sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	info   natsInfo
+}
+
+// natsInfo is what the server tells about itself when connected to
+type natsInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// natsConnect is what's told to the server when connecting
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+func NewNATS(rawURL string) (*NATS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("nats url %s must be nats:// or tls://", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATS{url: u}, nil
+}
+
+// Host is the server published to, without credentials, for it to be logged
+func (n *NATS) Host() string {
+	return n.url.Host
+}
+
+func (n *NATS) Publish(ctx context.Context, subject string, msg []byte) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return fmt.Errorf("failed to connect to nats %s: %w", n.url.Host, err)
+		}
+	}
+	if n.info.MaxPayload > 0 && int64(len(msg)) > n.info.MaxPayload {
+		return fmt.Errorf("message of %d bytes is over the %d nats takes", len(msg), n.info.MaxPayload)
+	}
+
+	deadline, _ := ctx.Deadline()
+	err := n.conn.SetDeadline(deadline)
+	if err == nil {
+		_, err = fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(msg), msg)
+	}
+	if err == nil {
+		err = n.awaitPong()
+	}
+	if err != nil {
+		n.disconnect()
+		return fmt.Errorf("failed to publish to nats %s: %w", n.url.Host, err)
+	}
+	return nil
+}
+
+func (n *NATS) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.url.Host)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	n.conn, n.reader = conn, bufio.NewReader(conn)
+
+	err = func() error {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "INFO ") {
+			return fmt.Errorf("expected INFO, got %q", line)
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &n.info); err != nil {
+			return err
+		}
+
+		tlsRequired := n.url.Scheme == "tls" || n.info.TLSRequired
+		if tlsRequired {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: n.url.Hostname()})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				return err
+			}
+			n.conn, n.reader = tlsConn, bufio.NewReader(tlsConn)
+		}
+
+		connect := natsConnect{TLSRequired: tlsRequired, Name: "mantlemint", Lang: "go", Version: "0.0.0", Protocol: 1}
+		if user := n.url.User; user != nil {
+			if pass, ok := user.Password(); ok {
+				connect.User, connect.Pass = user.Username(), pass
+			} else {
+				connect.AuthToken = user.Username()
+			}
+		}
+		connectJSON, err := json.Marshal(connect)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(n.conn, "CONNECT %s\r\nPING\r\n", connectJSON); err != nil {
+			return err
+		}
+		return n.awaitPong()
+	}()
+	if err != nil {
+		n.disconnect()
+	}
+	return err
+}
+
+// awaitPong reads what the server sends until the pong to the last ping
+func (n *NATS) awaitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK, and INFO sent on cluster changes, are of no concern
+	}
+}
+
+func (n *NATS) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (n *NATS) disconnect() {
+	if n.conn != nil {
+		_ = n.conn.Close()
+	}
+	n.conn, n.reader = nil, nil
+}
+
+func (n *NATS) Close() error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	// every publish was acknowledged already, nothing is left to flush
+	n.disconnect()
+	return nil
+}
@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNATS speaks enough of the core nats protocol to take publishes, which are sent on published; messages
+// published on the subject "denied" are answered with an error
+func fakeNATS(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	published := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1024}\r\n")
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+					switch {
+					case strings.HasPrefix(line, "CONNECT "):
+						assert.Contains(t, line, `"auth_token":"secret"`)
+					case line == "PING":
+						_, _ = conn.Write([]byte("PONG\r\n"))
+					case strings.HasPrefix(line, "PUB "):
+						var subject string
+						var size int
+						_, err := fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+						assert.Nil(t, err)
+						msg := make([]byte, size+2)
+						if _, err := io.ReadFull(reader, msg); err != nil {
+							return
+						}
+						if subject == "denied" {
+							_, _ = conn.Write([]byte("-ERR 'Permissions Violation for Publish to denied'\r\n"))
+							return
+						}
+						published <- subject + " " + string(msg[:size])
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), published
+}
+
+func TestNATS(t *testing.T) {
+	addr, published := fakeNATS(t)
+	nats, err := NewNATS("nats://secret@" + addr)
+	assert.Nil(t, err)
+	defer nats.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	backend := NewPublisherBackend("nats", nats, "commits")
+	assert.Nil(t, backend.Deliver(ctx, Commit{Height: 1}))
+	assert.Contains(t, <-published, `commits {"height":1,`)
+
+	// errors fail the publish, and the next one connects again
+	assert.ErrorContains(t, nats.Publish(ctx, "denied", []byte("{}")), "Permissions Violation")
+	assert.Nil(t, nats.Publish(ctx, "commits", []byte("{}")))
+	assert.Equal(t, "commits {}", <-published)
+
+	// so do messages over the max payload of the server
+	assert.ErrorContains(t, nats.Publish(ctx, "commits", make([]byte, 2048)), "over the 1024")
+
+	_, err = NewNATS("http://" + addr)
+	assert.NotNil(t, err)
+}
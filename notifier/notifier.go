@@ -0,0 +1,157 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Commit is what consumers are notified of every block once it's committed, flushed and indexed
+type Commit struct {
+	Height    int64     `json:"height"`
+	Time      time.Time `json:"time"`
+	BlockHash string    `json:"block_hash"`
+	TxCount   int       `json:"tx_count"`
+
+	// AppHash is the app hash committed by the block, i.e. in the header of the next block
+	AppHash string `json:"app_hash"`
+}
+
+// Backend delivers commits to consumers
+type Backend interface {
+	// Name tells the backend apart in logs
+	Name() string
+
+	Deliver(ctx context.Context, commit Commit) error
+
+	Close() error
+}
+
+type Config struct {
+	// QueueSize is how many commits may wait to be delivered to a backend
+	QueueSize int
+
+	// Budget is how long Notify may wait on a backend whose queue is full; the commit is dropped for it after
+	Budget time.Duration
+
+	// Timeout is how long a delivery may take
+	Timeout time.Duration
+
+	// a delivery that failed is retried up to MaxRetries times, with jittered backoff starting from RetryBackoff
+	// and doubling each time
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+// Notifier delivers commits to every backend in the background, in order; a slow backend only holds up
+// whoever notifies for Config.Budget. Commits a backend failed to be delivered, or dropped, are logged
+// with their height, to be replayed by hand.
+type Notifier struct {
+	config *Config
+	sinks  []*sink
+}
+
+// sink is a backend, with the commits waiting to be delivered to it
+type sink struct {
+	backend Backend
+	queue   chan Commit
+	done    chan struct{}
+	closing chan struct{}
+}
+
+func New(config *Config, backends ...Backend) *Notifier {
+	n := &Notifier{config: config}
+	for _, backend := range backends {
+		s := &sink{
+			backend: backend,
+			queue:   make(chan Commit, config.QueueSize),
+			done:    make(chan struct{}),
+			closing: make(chan struct{}),
+		}
+		n.sinks = append(n.sinks, s)
+		go n.deliver(s)
+	}
+	return n
+}
+
+// Notify queues commit to be delivered to every backend, waiting up to Config.Budget in all for backends
+// whose queue is full; nil notifies nothing
+func (n *Notifier) Notify(commit Commit) {
+	if n == nil {
+		return
+	}
+
+	budget := time.NewTimer(n.config.Budget)
+	defer budget.Stop()
+	for _, s := range n.sinks {
+		select {
+		case s.queue <- commit:
+			continue
+		default:
+		}
+		select {
+		case s.queue <- commit:
+		case <-budget.C:
+			log.Printf("[notifier] %s is too slow, dropped the commit of height %d; replay it by hand", s.backend.Name(), commit.Height)
+		}
+	}
+}
+
+func (n *Notifier) deliver(s *sink) {
+	defer close(s.done)
+	for commit := range s.queue {
+		if err := n.deliverWithRetries(s, commit); err != nil {
+			log.Printf("[notifier] failed to notify %s of the commit of height %d, replay it by hand: %v", s.backend.Name(), commit.Height, err)
+		}
+	}
+}
+
+func (n *Notifier) deliverWithRetries(s *sink, commit Commit) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), n.config.Timeout)
+			defer cancel()
+			return s.backend.Deliver(ctx, commit)
+		}()
+		if err == nil || attempt >= n.config.MaxRetries {
+			return err
+		}
+
+		// jittered into [d/2, d], for consumers coming back not to be hit by every mantlemint at once
+		delay := n.config.RetryBackoff << uint(attempt)
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-time.After(delay):
+		case <-s.closing:
+			return fmt.Errorf("closed while retrying: %w", err)
+		}
+	}
+}
+
+// Close delivers the commits queued, giving up on retries once ctx is done, then closes the backends;
+// nothing must be notified after
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+
+	for _, s := range n.sinks {
+		close(s.queue)
+	}
+	var closeErr error
+	for _, s := range n.sinks {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			close(s.closing)
+			<-s.done
+		}
+		if err := s.backend.Close(); err != nil {
+			closeErr = fmt.Errorf("failed to close %s: %w", s.backend.Name(), err)
+		}
+	}
+	return closeErr
+}
@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = Config{
+	QueueSize:    1,
+	Budget:       10 * time.Millisecond,
+	Timeout:      time.Second,
+	MaxRetries:   2,
+	RetryBackoff: time.Millisecond,
+}
+
+func TestNotifierWebhook(t *testing.T) {
+	// the webhook fails twice before taking the commit
+	var mtx sync.Mutex
+	var attempts int
+	var received []Commit
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		attempts++
+		if attempts <= 2 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var commit Commit
+		assert.Nil(t, json.NewDecoder(request.Body).Decode(&commit))
+		received = append(received, commit)
+	}))
+	defer server.Close()
+
+	n := New(&testConfig, NewWebhook(server.URL))
+	n.Notify(Commit{Height: 1, BlockHash: "AA"})
+	assert.Nil(t, n.Close(context.Background()))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []Commit{{Height: 1, BlockHash: "AA"}}, received)
+
+	// one that keeps failing is given up on
+	attempts = -10
+	n = New(&testConfig, NewWebhook(server.URL))
+	n.Notify(Commit{Height: 2})
+	assert.Nil(t, n.Close(context.Background()))
+	assert.Equal(t, -7, attempts)
+	assert.Len(t, received, 1)
+}
+
+// blockingBackend takes a commit whenever told to
+type blockingBackend struct {
+	release   chan struct{}
+	delivered []int64
+}
+
+func (b *blockingBackend) Name() string {
+	return "blocking"
+}
+
+func (b *blockingBackend) Deliver(_ context.Context, commit Commit) error {
+	<-b.release
+	b.delivered = append(b.delivered, commit.Height)
+	return nil
+}
+
+func (b *blockingBackend) Close() error {
+	return nil
+}
+
+func TestNotifierBudget(t *testing.T) {
+	backend := &blockingBackend{release: make(chan struct{})}
+	n := New(&testConfig, backend)
+
+	// one commit is being delivered, one waits in the queue; the next is dropped once the budget is spent
+	n.Notify(Commit{Height: 1})
+	n.Notify(Commit{Height: 2})
+	start := time.Now()
+	n.Notify(Commit{Height: 3})
+	assert.GreaterOrEqual(t, time.Since(start), testConfig.Budget)
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(backend.release)
+	assert.Nil(t, n.Close(context.Background()))
+	assert.Equal(t, []int64{1, 2}, backend.delivered)
+
+	// nil notifies nothing
+	var none *Notifier
+	none.Notify(Commit{Height: 4})
+	assert.Nil(t, none.Close(context.Background()))
+}
@@ -0,0 +1,42 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Publisher publishes messages on the subjects of a broker, as NATS does, or Kafka on its topics
+type Publisher interface {
+	Publish(ctx context.Context, subject string, msg []byte) error
+	Close() error
+}
+
+var _ Backend = (*publisherBackend)(nil)
+
+// publisherBackend publishes every commit as json on a subject
+type publisherBackend struct {
+	name      string
+	publisher Publisher
+	subject   string
+}
+
+// NewPublisherBackend delivers commits by publishing them as json on subject; name tells it apart in logs
+func NewPublisherBackend(name string, publisher Publisher, subject string) Backend {
+	return &publisherBackend{name: name, publisher: publisher, subject: subject}
+}
+
+func (b *publisherBackend) Name() string {
+	return b.name
+}
+
+func (b *publisherBackend) Deliver(ctx context.Context, commit Commit) error {
+	commitJSON, err := json.Marshal(commit)
+	if err != nil {
+		return err
+	}
+	return b.publisher.Publish(ctx, b.subject, commitJSON)
+}
+
+func (b *publisherBackend) Close() error {
+	return b.publisher.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/tendermint/tendermint/state"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/indexer/richlist"
+	"github.com/terra-money/mantlemint/indexer/tx"
+	"github.com/terra-money/mantlemint/runner"
+)
+
+// rollback unwinds mantlemint state by the number of blocks given in args, and the index along with it;
+// syncing resumes right after on the next start. db must read from ldb at the latest height.
+func rollback(ldb *heleveldb.Driver, db tmdb.DB, mantlemintConfig *config.Config, args []string) {
+	if len(args) != 1 {
+		panic(fmt.Errorf("usage: rollback <number of blocks>"))
+	}
+	blocks, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || blocks <= 0 {
+		panic(fmt.Errorf("rollback takes a positive number of blocks, got %s", args[0]))
+	}
+
+	stateStore := state.NewStore(db, state.StoreOptions{DiscardABCIResponses: false})
+	lastState, err := stateStore.Load()
+	if err != nil {
+		panic(err)
+	}
+	if lastState.LastBlockHeight == 0 {
+		panic(fmt.Errorf("no block was ever injected, nothing to roll back"))
+	}
+
+	// genesis is written at the initial height along with the first block, or right before it if exported off
+	// a chain; either way the state store only has a height from the first block on
+	genesisDoc, err := runner.LoadGenesisDoc(mantlemintConfig.GenesisPath, mantlemintConfig.ChainID)
+	if err != nil {
+		panic(err)
+	}
+	from, to := lastState.LastBlockHeight, lastState.LastBlockHeight-blocks
+	if to < genesisDoc.InitialHeight {
+		panic(fmt.Errorf("can't roll back %d blocks from height %d, past the initial height %d", blocks, from, genesisDoc.InitialHeight))
+	}
+
+	log.Printf("[v0.34.x/rollback] rolling back from height %d to %d...", from, to)
+	unwound, err := ldb.Rollback(to)
+	if err != nil {
+		panic(fmt.Errorf("rollback failed, run it again to complete: %v", err))
+	}
+
+	if lastState, err = stateStore.Load(); err != nil {
+		panic(err)
+	} else if lastState.LastBlockHeight != to {
+		panic(fmt.Errorf("state is at height %d after rolling back to %d", lastState.LastBlockHeight, to))
+	}
+
+	// the index may be a block ahead, if mantlemint stopped between flushing it and the state
+	indexerInstance, err := indexer.NewIndexer(mantlemintConfig.IndexerDB, mantlemintConfig.Home, nil)
+	if err != nil {
+		panic(err)
+	}
+	indexerInstance.RegisterRollbackService(tx.RollbackTx)
+	indexerInstance.RegisterRollbackService(block.RollbackBlock)
+	indexerInstance.RegisterRollbackService(richlist.RollbackRichlist)
+	if err := indexerInstance.Rollback(from+1, to); err != nil {
+		panic(err)
+	}
+
+	log.Printf("[v0.34.x/rollback] rolled back to height %d, %d keys unwound; syncing resumes from %d", to, unwound, to+1)
+}
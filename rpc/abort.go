@@ -0,0 +1,190 @@
+package rpc
+
+import (
+	"context"
+
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// pathBroadcastTx is refused by the app as a query, and left for it to refuse
+const pathBroadcastTx = "/cosmos.tx.v1beta1.Service/BroadcastTx"
+
+// QueryableApp is an app whose grpc queries can be run in process, off its multistore
+type QueryableApp interface {
+	GRPCQueryRouter() *baseapp.GRPCQueryRouter
+	Logger() tmlog.Logger
+}
+
+// abortingClient runs the grpc queries of app itself, as BaseApp does, rather than over the client, for them to be
+// aborted once their context is done: the stores they read off panic on the next access, smart queries included,
+// whose contracts read their store through them. Other queries, i.e. of /store or /custom paths, go over the client,
+// as do queries made without a context.
+type abortingClient struct {
+	abcicli.Client
+	app    QueryableApp
+	cms    storetypes.MultiStore
+	header func() tmproto.Header
+}
+
+// NewAbortingClient runs the grpc queries of app made with a context off cms, at the height asked for, with the
+// header of the last block committed as BaseApp does; others go over client
+func NewAbortingClient(client abcicli.Client, app QueryableApp, cms storetypes.MultiStore, header func() tmproto.Header) abcicli.Client {
+	return &abortingClient{Client: client, app: app, cms: cms, header: header}
+}
+
+func (c *abortingClient) querySyncContext(ctx context.Context, request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	handler := c.app.GRPCQueryRouter().Route(request.Path)
+	if handler == nil || request.Path == pathBroadcastTx {
+		return c.Client.QuerySync(request)
+	}
+	return c.queryGRPC(ctx, handler, request)
+}
+
+// queryGRPC runs request with handler as BaseApp's Query does, on stores aborting it once ctx is done. Queries BaseApp
+// refuses, i.e. with proofs or of heights it doesn't have, go over the client for it to refuse them in its own words.
+func (c *abortingClient) queryGRPC(ctx context.Context, handler baseapp.GRPCQueryHandler, request abci.RequestQuery) (res *abci.ResponseQuery, err error) {
+	height := request.Height
+	if height == 0 {
+		height = c.cms.LatestVersion()
+	}
+	if request.Prove || height < 0 || height > c.cms.LatestVersion() {
+		return c.Client.QuerySync(request)
+	}
+	cache, err := c.cms.CacheMultiStoreWithVersion(height)
+	if err != nil {
+		return c.Client.QuerySync(request)
+	}
+
+	// an aborted store panics with out of gas, for the wasm vm to abort contracts reading it as it does out of gas,
+	// rather than logging the panic along with its stack; its error is the context's
+	defer func() {
+		if r := recover(); r != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				res, err = nil, contextError(ctxErr)
+				return
+			}
+			result := sdkerrors.QueryResult(sdkerrors.Wrapf(sdkerrors.ErrPanic, "%v", r), false)
+			res, err = &result, nil
+		}
+	}()
+	sdkCtx := sdk.NewContext(newAbortingMultiStore(ctx, cache), c.header(), true, c.app.Logger()).WithBlockHeight(height)
+
+	result, err := handler(sdkCtx, request)
+	// a contract aborted fails with an error of its own, the vm recovering the panic
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, contextError(ctxErr)
+	}
+	if err != nil {
+		result = sdkerrors.QueryResult(grpcErrorToSDKError(err), false)
+		result.Height = request.Height
+	}
+	return &result, nil
+}
+
+// grpcErrorToSDKError is the error of a failed grpc query, as BaseApp tells it
+func grpcErrorToSDKError(err error) error {
+	status, ok := grpcstatus.FromError(err)
+	if !ok {
+		return sdkerrors.Wrap(sdkerrors.ErrInvalidRequest, err.Error())
+	}
+
+	switch status.Code() {
+	case codes.NotFound:
+		return sdkerrors.Wrap(sdkerrors.ErrKeyNotFound, err.Error())
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return sdkerrors.Wrap(sdkerrors.ErrInvalidRequest, err.Error())
+	case codes.Unauthenticated:
+		return sdkerrors.Wrap(sdkerrors.ErrUnauthorized, err.Error())
+	default:
+		return sdkerrors.Wrap(sdkerrors.ErrUnknownRequest, err.Error())
+	}
+}
+
+// errAborted is what a store panics with once the context of its query is done
+var errAborted = storetypes.ErrorOutOfGas{Descriptor: "query aborted"}
+
+func checkAborted(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		panic(errAborted)
+	default:
+	}
+}
+
+// abortingMultiStore is a branch of the multistore for a query, whose stores abort it once ctx is done
+type abortingMultiStore struct {
+	storetypes.MultiStore
+	cache storetypes.CacheMultiStore
+	ctx   context.Context
+}
+
+func newAbortingMultiStore(ctx context.Context, cache storetypes.CacheMultiStore) abortingMultiStore {
+	return abortingMultiStore{MultiStore: cache, cache: cache, ctx: ctx}
+}
+
+func (s abortingMultiStore) GetKVStore(key storetypes.StoreKey) storetypes.KVStore {
+	return abortingKVStore{KVStore: s.cache.GetKVStore(key), ctx: s.ctx}
+}
+
+func (s abortingMultiStore) CacheMultiStore() storetypes.CacheMultiStore {
+	return newAbortingMultiStore(s.ctx, s.cache.CacheMultiStore())
+}
+
+func (s abortingMultiStore) Write() {
+	s.cache.Write()
+}
+
+// abortingKVStore aborts the query it's read by on any access once ctx is done, iterating included
+type abortingKVStore struct {
+	storetypes.KVStore
+	ctx context.Context
+}
+
+func (s abortingKVStore) Get(key []byte) []byte {
+	checkAborted(s.ctx)
+	return s.KVStore.Get(key)
+}
+
+func (s abortingKVStore) Has(key []byte) bool {
+	checkAborted(s.ctx)
+	return s.KVStore.Has(key)
+}
+
+func (s abortingKVStore) Set(key, value []byte) {
+	checkAborted(s.ctx)
+	s.KVStore.Set(key, value)
+}
+
+func (s abortingKVStore) Delete(key []byte) {
+	checkAborted(s.ctx)
+	s.KVStore.Delete(key)
+}
+
+func (s abortingKVStore) Iterator(start, end []byte) storetypes.Iterator {
+	checkAborted(s.ctx)
+	return abortingIterator{Iterator: s.KVStore.Iterator(start, end), ctx: s.ctx}
+}
+
+func (s abortingKVStore) ReverseIterator(start, end []byte) storetypes.Iterator {
+	checkAborted(s.ctx)
+	return abortingIterator{Iterator: s.KVStore.ReverseIterator(start, end), ctx: s.ctx}
+}
+
+type abortingIterator struct {
+	storetypes.Iterator
+	ctx context.Context
+}
+
+func (it abortingIterator) Next() {
+	checkAborted(it.ctx)
+	it.Iterator.Next()
+}
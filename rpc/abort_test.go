@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	"github.com/cosmos/cosmos-sdk/store/rootmulti"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+type queryableApp struct {
+	router *baseapp.GRPCQueryRouter
+}
+
+func (app queryableApp) GRPCQueryRouter() *baseapp.GRPCQueryRouter {
+	return app.router
+}
+
+func (app queryableApp) Logger() tmlog.Logger {
+	return tmlog.NewNopLogger()
+}
+
+func TestAbortingClient(t *testing.T) {
+	key := storetypes.NewKVStoreKey("test")
+	cms := rootmulti.NewStore(tmdb.NewMemDB(), tmlog.NewNopLogger())
+	cms.MountStoreWithDB(key, storetypes.StoreTypeIAVL, nil)
+	assert.Nil(t, cms.LoadLatestVersion())
+	cms.GetKVStore(key).Set([]byte("key"), []byte("value"))
+	cms.Commit()
+
+	backend := &blockingClient{release: make(chan struct{})}
+	client := NewAbortingClient(backend, queryableApp{baseapp.NewGRPCQueryRouter()}, cms, func() tmproto.Header {
+		return tmproto.Header{Height: 1}
+	}).(*abortingClient)
+
+	// reads the store, then again once proceeding
+	started, proceed := make(chan struct{}, 1), make(chan struct{})
+	handler := func(ctx sdk.Context, request abci.RequestQuery) (abci.ResponseQuery, error) {
+		store := ctx.KVStore(key)
+		value := store.Get([]byte("key"))
+		started <- struct{}{}
+		<-proceed
+		iterator := store.Iterator(nil, nil)
+		defer iterator.Close()
+		return abci.ResponseQuery{Value: value, Height: ctx.BlockHeight()}, nil
+	}
+
+	// run to completion, at the latest height
+	close(proceed)
+	res, err := client.queryGRPC(context.Background(), handler, abci.RequestQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), res.Value)
+	assert.Equal(t, int64(1), res.Height)
+	<-started
+
+	// aborted at its next read once its context is done
+	proceed = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := client.queryGRPC(ctx, handler, abci.RequestQuery{})
+		errs <- err
+	}()
+	<-started
+	cancel()
+	close(proceed)
+	assert.Equal(t, ErrQueryCanceled, <-errs)
+
+	// other panics fail the query, as BaseApp does
+	res, err = client.queryGRPC(context.Background(), func(sdk.Context, abci.RequestQuery) (abci.ResponseQuery, error) {
+		panic("oops")
+	}, abci.RequestQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, sdkerrors.ErrPanic.ABCICode(), res.Code)
+
+	// queries BaseApp refuses go over the client, for it to refuse them
+	res, err = client.queryGRPC(context.Background(), handler, abci.RequestQuery{Height: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, &abci.ResponseQuery{}, res)
+	res, err = client.queryGRPC(context.Background(), handler, abci.RequestQuery{Prove: true})
+	assert.Nil(t, err)
+	assert.Equal(t, &abci.ResponseQuery{}, res)
+
+	// queries the router doesn't take go over the client
+	res, err = client.querySyncContext(context.Background(), abci.RequestQuery{Path: "/store/test/key"})
+	assert.Nil(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestAbortingKVStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	cms := rootmulti.NewStore(tmdb.NewMemDB(), tmlog.NewNopLogger())
+	key := storetypes.NewKVStoreKey("test")
+	cms.MountStoreWithDB(key, storetypes.StoreTypeIAVL, nil)
+	assert.Nil(t, cms.LoadLatestVersion())
+
+	// the stores of branches abort too, panicking as out of gas; the query's error tells how it was given up on
+	store := newAbortingMultiStore(ctx, cms.CacheMultiStore()).CacheMultiStore().GetKVStore(key)
+	assert.PanicsWithValue(t, storetypes.ErrorOutOfGas{Descriptor: "query aborted"}, func() { store.Get([]byte("key")) })
+	assert.Equal(t, ErrQueryTimeout, contextError(context.DeadlineExceeded))
+}
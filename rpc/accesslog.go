@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+)
+
+// AccessLogConfig configures the access log middleware
+type AccessLogConfig struct {
+	// Sample logs one request in Sample, slow ones aside, which are all logged
+	Sample int
+
+	// SlowThreshold is how long a request may take before it's logged at warn level, with its query string
+	SlowThreshold time.Duration
+
+	// Exclude are the paths that aren't logged, i.e. health checks
+	Exclude []string
+
+	// TrustedProxies are the proxies the client ip is read off X-Forwarded-For behind
+	TrustedProxies []*net.IPNet
+}
+
+// AccessLogEntry is a line of the access log
+type AccessLogEntry struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Query    string    `json:"query,omitempty"`
+	Height   string    `json:"height,omitempty"`
+	Status   int       `json:"status"`
+	Bytes    int64     `json:"bytes"`
+	Duration float64   `json:"duration_ms"`
+	Cache    string    `json:"cache,omitempty"`
+	ClientIP string    `json:"client_ip"`
+}
+
+// AccessLogger writes an access log of requests, a json line per request
+type AccessLogger struct {
+	cfg AccessLogConfig
+
+	mtx     sync.Mutex
+	encoder *json.Encoder
+
+	// requests counts the requests that may be sampled
+	requests uint64
+}
+
+func NewAccessLogger(out io.Writer, cfg AccessLogConfig) *AccessLogger {
+	if cfg.Sample < 1 {
+		cfg.Sample = 1
+	}
+	return &AccessLogger{cfg: cfg, encoder: json.NewEncoder(out)}
+}
+
+// Middleware logs requests once served, with the height they were answered at and how they were served off the
+// cache, if they were; as sent back to the client, compressed or not
+func (l *AccessLogger) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for _, excluded := range l.cfg.Exclude {
+			if request.URL.Path == excluded {
+				next.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+		duration := time.Since(start)
+
+		slow := l.cfg.SlowThreshold > 0 && duration >= l.cfg.SlowThreshold
+		if !slow && atomic.AddUint64(&l.requests, 1)%uint64(l.cfg.Sample) != 0 {
+			return
+		}
+
+		entry := AccessLogEntry{
+			Time:     start,
+			Level:    "info",
+			Method:   request.Method,
+			Path:     request.URL.Path,
+			Height:   writer.Header().Get(grpctypes.GRPCBlockHeightHeader),
+			Status:   recorder.status,
+			Bytes:    recorder.bytes,
+			Duration: float64(duration.Microseconds()) / 1000,
+			Cache:    writer.Header().Get(CacheHeader),
+		}
+		if ip := clientIP(request, l.cfg.TrustedProxies); ip != nil {
+			entry.ClientIP = ip.String()
+		}
+		if slow {
+			entry.Level, entry.Query = "warn", request.URL.RawQuery
+		}
+		l.log(entry)
+	})
+}
+
+func (l *AccessLogger) log(entry AccessLogEntry) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	_ = l.encoder.Encode(entry)
+}
+
+// statusWriter records the status and the size of a response, for access logs and metrics
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over, i.e. to websocket; the request is logged as switching protocols
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer can't be hijacked")
+	}
+	w.status, w.wroteHeader = http.StatusSwitchingProtocols, true
+	return hijacker.Hijack()
+}
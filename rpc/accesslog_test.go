@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogger(t *testing.T) {
+	out := new(bytes.Buffer)
+	trusted, err := ParseCIDRs([]string{"10.0.0.1"})
+	assert.Nil(t, err)
+	logger := NewAccessLogger(out, AccessLogConfig{Sample: 2, SlowThreshold: 20 * time.Millisecond, Exclude: []string{"/health"}, TrustedProxies: trusted})
+	resolveHeight := func(int64) (int64, error) { return 100, nil }
+	handler := logger.Middleware(cacheMiddleware(NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival"), CachePolicies{}, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/slow" {
+				time.Sleep(25 * time.Millisecond)
+			}
+			_, _ = writer.Write([]byte(`{"balances":[]}`))
+		}),
+	))
+	serve := func(path string) {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = "10.0.0.1:1234"
+		request.Header.Set("X-Forwarded-For", "1.2.3.4")
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	entries := func() []AccessLogEntry {
+		var entries []AccessLogEntry
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var entry AccessLogEntry
+			if line != "" {
+				assert.Nil(t, json.Unmarshal([]byte(line), &entry))
+				entries = append(entries, entry)
+			}
+		}
+		out.Reset()
+		return entries
+	}
+
+	// one request in two is logged, health checks aside, with how it was answered
+	serve("/cosmos/bank/v1beta1/balances/terra1a")
+	serve("/cosmos/bank/v1beta1/balances/terra1a?pagination.limit=10")
+	serve("/health")
+	logged := entries()
+	if assert.Len(t, logged, 1) {
+		assert.Equal(t, "info", logged[0].Level)
+		assert.Equal(t, "GET", logged[0].Method)
+		assert.Equal(t, "/cosmos/bank/v1beta1/balances/terra1a", logged[0].Path)
+		assert.Empty(t, logged[0].Query)
+		assert.Equal(t, "100", logged[0].Height)
+		assert.Equal(t, 200, logged[0].Status)
+		assert.Equal(t, int64(len(`{"balances":[]}`)), logged[0].Bytes)
+		assert.Equal(t, CacheMiss, logged[0].Cache)
+		assert.Equal(t, "1.2.3.4", logged[0].ClientIP)
+	}
+
+	// slow requests are all logged, at warn level, with their query string
+	serve("/slow?msg=heavy")
+	logged = entries()
+	if assert.Len(t, logged, 1) {
+		assert.Equal(t, "warn", logged[0].Level)
+		assert.Equal(t, "msg=heavy", logged[0].Query)
+		assert.GreaterOrEqual(t, logged[0].Duration, float64(20))
+	}
+}
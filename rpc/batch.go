@@ -0,0 +1,148 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/gorilla/mux"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+var EndpointPOSTBatchSmartQuery = "/wasm/contract/batch"
+
+// querySmartContractStatePath is the path smart queries are made at, as the LCD makes them
+const querySmartContractStatePath = "/cosmwasm.wasm.v1.Query/SmartContractState"
+
+// BatchQueryConfig configures the batch smart query route
+type BatchQueryConfig struct {
+	// MaxQueries is how many queries a batch may hold
+	MaxQueries int
+
+	// Concurrency is how many queries of a batch run at once
+	Concurrency int
+}
+
+// BatchQuery is a smart query of a batch; Height, if set, overrides the batch's
+type BatchQuery struct {
+	ContractAddress string          `json:"contract_address"`
+	QueryMsg        json.RawMessage `json:"query_msg"`
+	Height          int64           `json:"height,omitempty"`
+}
+
+// BatchQueryResult is the result of a query of a batch, or its error
+type BatchQueryResult struct {
+	Height int64           `json:"height"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// BatchQueryResponse is the response of the batch smart query route, its results in the order queries were posted
+type BatchQueryResponse struct {
+	Height  int64              `json:"height"`
+	Results []BatchQueryResult `json:"results"`
+}
+
+// RegisterBatchQueryRoute registers a route running the smart queries it's posted, a json array of
+// {"contract_address", "query_msg", "height"}, through client at once. Queries without a height all run at the
+// batch's, asked for as the LCD's are and resolved once, so that a block flushed in between doesn't split the batch.
+// Each query is bounded by the app's contract query gas limit, as single smart queries are, and one failing, i.e.
+// running out of gas, fails alone.
+func RegisterBatchQueryRoute(router *mux.Router, client abcicli.Client, resolveHeight ResolveHeightFunc, cfg BatchQueryConfig) {
+	router.HandleFunc(EndpointPOSTBatchSmartQuery, func(writer http.ResponseWriter, request *http.Request) {
+		var queries []BatchQuery
+		if err := json.NewDecoder(request.Body).Decode(&queries); err != nil {
+			http.Error(writer, "invalid batch: "+err.Error(), 400)
+			return
+		}
+		if len(queries) == 0 {
+			http.Error(writer, "batch is empty", 400)
+			return
+		} else if len(queries) > cfg.MaxQueries {
+			http.Error(writer, fmt.Sprintf("batch of %d queries exceeds the maximum of %d", len(queries), cfg.MaxQueries), 400)
+			return
+		}
+
+		heightParam := request.URL.Query().Get("height")
+		if heightParam == "" {
+			heightParam = request.Header.Get(grpctypes.GRPCBlockHeightHeader)
+		}
+		var height int64
+		if heightParam != "" {
+			var err error
+			if height, err = strconv.ParseInt(heightParam, 10, 64); err != nil {
+				http.Error(writer, fmt.Sprintf("invalid height %q: %v", heightParam, err), 400)
+				return
+			}
+		}
+		height, err := resolveHeight(height)
+		if err != nil {
+			http.Error(writer, err.Error(), 400)
+			return
+		}
+
+		response := BatchQueryResponse{Height: height, Results: make([]BatchQueryResult, len(queries))}
+		slots := make(chan struct{}, cfg.Concurrency)
+		var wg sync.WaitGroup
+		for i, query := range queries {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int, query BatchQuery) {
+				defer func() { <-slots; wg.Done() }()
+				response.Results[i] = runSmartQuery(request.Context(), client, resolveHeight, height, query)
+			}(i, query)
+		}
+		wg.Wait()
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set(grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10))
+		_ = json.NewEncoder(writer).Encode(response)
+	}).Methods("POST")
+}
+
+// runSmartQuery runs query through client, at its height or else at the batch's, until ctx is done
+func runSmartQuery(ctx context.Context, client abcicli.Client, resolveHeight ResolveHeightFunc, batchHeight int64, query BatchQuery) BatchQueryResult {
+	result := BatchQueryResult{Height: batchHeight}
+	if query.Height != 0 {
+		height, err := resolveHeight(query.Height)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Height = height
+	}
+
+	request := wasmtypes.QuerySmartContractStateRequest{Address: query.ContractAddress, QueryData: wasmtypes.RawContractMessage(query.QueryMsg)}
+	if err := request.QueryData.ValidateBasic(); err != nil {
+		result.Error = "invalid query_msg: " + err.Error()
+		return result
+	}
+	data, err := request.Marshal()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	res, err := QuerySyncContext(ctx, client, abci.RequestQuery{Path: querySmartContractStatePath, Data: data, Height: result.Height})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	} else if !res.IsOK() {
+		result.Error = res.Log
+		return result
+	}
+
+	var smart wasmtypes.QuerySmartContractStateResponse
+	if err := smart.Unmarshal(res.Value); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Result = json.RawMessage(smart.Data)
+	return result
+}
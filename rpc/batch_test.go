@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmsync "github.com/tendermint/tendermint/libs/sync"
+)
+
+// smartQueryApp answers smart queries with the height and the msg they're made with, but for terra1missing's
+type smartQueryApp struct {
+	abci.BaseApplication
+}
+
+func (smartQueryApp) Query(req abci.RequestQuery) abci.ResponseQuery {
+	var request wasmtypes.QuerySmartContractStateRequest
+	if req.Path != querySmartContractStatePath || request.Unmarshal(req.Data) != nil {
+		return abci.ResponseQuery{Code: 1, Log: "unknown query"}
+	}
+	if request.Address == "terra1missing" {
+		return abci.ResponseQuery{Code: 1, Log: "no such contract"}
+	}
+	value, _ := (&wasmtypes.QuerySmartContractStateResponse{
+		Data: []byte(fmt.Sprintf(`{"height":%d,"msg":%s}`, req.Height, request.QueryData)),
+	}).Marshal()
+	return abci.ResponseQuery{Value: value}
+}
+
+func TestBatchQueryRoute(t *testing.T) {
+	router := mux.NewRouter()
+	client := abcicli.NewLocalClient(new(tmsync.Mutex), smartQueryApp{})
+	resolveHeight := func(height int64) (int64, error) {
+		if height == 0 {
+			return 10, nil
+		} else if height > 10 {
+			return 0, fmt.Errorf("height %d is above the latest height 10", height)
+		}
+		return height, nil
+	}
+	RegisterBatchQueryRoute(router, client, resolveHeight, BatchQueryConfig{MaxQueries: 4, Concurrency: 2})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(path, body string) (*http.Response, BatchQueryResponse) {
+		res, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		var response BatchQueryResponse
+		if res.StatusCode == http.StatusOK {
+			assert.Nil(t, json.NewDecoder(res.Body).Decode(&response))
+		}
+		return res, response
+	}
+
+	// results come in the order queries were posted, failures alongside, at the batch's height unless overridden
+	res, response := post(EndpointPOSTBatchSmartQuery, `[
+		{"contract_address": "terra1a", "query_msg": {"config": {}}},
+		{"contract_address": "terra1missing", "query_msg": {"config": {}}},
+		{"contract_address": "terra1b"},
+		{"contract_address": "terra1c", "query_msg": {"state": {}}, "height": 7}
+	]`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "10", res.Header.Get(grpctypes.GRPCBlockHeightHeader))
+	assert.Equal(t, int64(10), response.Height)
+	if assert.Len(t, response.Results, 4) {
+		assert.JSONEq(t, `{"height":10,"msg":{"config":{}}}`, string(response.Results[0].Result))
+		assert.Equal(t, "no such contract", response.Results[1].Error)
+		assert.Contains(t, response.Results[2].Error, "invalid query_msg")
+		assert.JSONEq(t, `{"height":7,"msg":{"state":{}}}`, string(response.Results[3].Result))
+		assert.Equal(t, int64(7), response.Results[3].Height)
+	}
+
+	// the batch's height is asked for as the LCD's is, and an item's height that isn't served fails that item alone
+	res, response = post(EndpointPOSTBatchSmartQuery+"?height=5", `[
+		{"contract_address": "terra1a", "query_msg": {}},
+		{"contract_address": "terra1a", "query_msg": {}, "height": 11}
+	]`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	if assert.Len(t, response.Results, 2) {
+		assert.JSONEq(t, `{"height":5,"msg":{}}`, string(response.Results[0].Result))
+		assert.Contains(t, response.Results[1].Error, "above the latest height")
+	}
+
+	// batches that are empty, malformed, too large or at a height that isn't served are refused as a whole
+	res, _ = post(EndpointPOSTBatchSmartQuery, `[]`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = post(EndpointPOSTBatchSmartQuery, `{"contract_address": "terra1a", "query_msg": {}}`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = post(EndpointPOSTBatchSmartQuery, "["+strings.TrimSuffix(strings.Repeat(`{"contract_address": "terra1a", "query_msg": {}},`, 5), ",")+"]")
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = post(EndpointPOSTBatchSmartQuery+"?height=11", `[{"contract_address": "terra1a", "query_msg": {}}]`)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
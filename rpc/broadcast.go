@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	rpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+)
+
+// EndpointPOSTBroadcastTx is the LCD route broadcasting txs, served by the app's tx service unless forwarded
+var EndpointPOSTBroadcastTx = "/cosmos/tx/v1beta1/txs"
+
+// broadcastMethods are the Tendermint rpc methods broadcasting txs
+var broadcastMethods = map[string]bool{
+	"broadcast_tx_sync":   true,
+	"broadcast_tx_async":  true,
+	"broadcast_tx_commit": true,
+}
+
+// ErrReadOnly is returned when broadcasting txs without an upstream to forward them to
+var ErrReadOnly = errors.New("mantlemint is read-only and doesn't broadcast txs; set TX_BROADCAST_UPSTREAM to forward them to a full node")
+
+// BroadcastConfig tells where txs broadcast to mantlemint are forwarded, mantlemint having no mempool
+type BroadcastConfig struct {
+	// Upstream is the Tendermint rpc of a full node broadcast_tx_* are forwarded to, and LCDUpstream its LCD,
+	// POST /cosmos/tx/v1beta1/txs is forwarded to; neither is if nil
+	Upstream    *url.URL
+	LCDUpstream *url.URL
+
+	// Timeout bounds a forwarded request, after which it fails with a 502
+	Timeout time.Duration
+
+	// Commit forwards broadcast_tx_commit, which holds a connection to the upstream until the tx is committed;
+	// it's rejected otherwise
+	Commit bool
+}
+
+// RegisterBroadcastRoutes serves the Tendermint rpc methods broadcasting txs, over uri and json-rpc, and the LCD
+// route doing so, by forwarding them to the upstreams of cfg, responding with what they respond verbatim; a
+// failing upstream is responded with a 502. Without an upstream, they're responded with an error telling so.
+// It must be registered before RegisterTendermintRoutes, for json-rpc posted to / to be routed here first.
+func RegisterBroadcastRoutes(router *mux.Router, cfg BroadcastConfig) {
+	rpcHandler := http.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writeRPCError(writer, request, http.StatusNotImplemented, ErrReadOnly)
+	}))
+	if cfg.Upstream != nil {
+		rpcHandler = newBroadcastProxy(cfg.Upstream, cfg.Timeout, func(writer http.ResponseWriter, request *http.Request, err error) {
+			writeRPCError(writer, request, http.StatusBadGateway, fmt.Errorf("upstream failed to broadcast: %w", err))
+		})
+	}
+
+	// broadcast_tx_commit is only forwarded if enabled
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if cfg.Upstream != nil && !cfg.Commit && broadcastMethod(request) == "broadcast_tx_commit" {
+			writeRPCError(writer, request, http.StatusNotImplemented, errors.New("broadcast_tx_commit is not supported; "+
+				"use broadcast_tx_sync, or set TX_BROADCAST_COMMIT=true to forward it"))
+			return
+		}
+		rpcHandler.ServeHTTP(writer, request)
+	})
+	for method := range broadcastMethods {
+		router.Handle("/"+method, handler).Methods("GET").Name(tendermintRoutePrefix + method)
+	}
+	router.Handle("/", handler).Methods("POST").Name(tendermintRoutePrefix + "broadcast").
+		MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool {
+			return broadcastMethods[broadcastMethod(request)]
+		})
+
+	// the LCD route is left to the app's tx service without an upstream, which tells it can't broadcast
+	if cfg.LCDUpstream != nil {
+		proxy := newBroadcastProxy(cfg.LCDUpstream, cfg.Timeout, func(writer http.ResponseWriter, _ *http.Request, err error) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusBadGateway)
+			_ = json.NewEncoder(writer).Encode(map[string]interface{}{
+				"code":    14, // grpc's unavailable, as the grpc gateway responds
+				"message": fmt.Sprintf("upstream failed to broadcast: %v", err),
+				"details": []interface{}{},
+			})
+		})
+		router.Handle(EndpointPOSTBroadcastTx, proxy).Methods("POST")
+	}
+}
+
+// newBroadcastProxy forwards requests to upstream, under its path, within timeout; failures are handled by onError
+func newBroadcastProxy(upstream *url.URL, timeout time.Duration, onError func(http.ResponseWriter, *http.Request, error)) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	director := proxy.Director
+	proxy.Director = func(request *http.Request) {
+		director(request)
+		// the upstream checks the host it's served as, if behind a proxy of its own
+		request.Host = upstream.Host
+	}
+	proxy.ErrorHandler = onError
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		proxy.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// broadcastMethod is the method of a request over uri, or of the json-rpc request posted, which is read ahead
+// and left to be read again
+func broadcastMethod(request *http.Request) string {
+	if request.Method != "POST" {
+		return strings.TrimPrefix(request.URL.Path, "/")
+	}
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return ""
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var rpcRequest struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &rpcRequest); err != nil {
+		return ""
+	}
+	return rpcRequest.Method
+}
+
+// writeRPCError responds to request with err in a json-rpc envelope, with the id of the json-rpc request if
+// posted, as Tendermint does with -1 over uri
+func writeRPCError(writer http.ResponseWriter, request *http.Request, status int, err error) {
+	rpcRequest := rpctypes.RPCRequest{ID: rpctypes.JSONRPCIntID(-1)}
+	if request.Method == "POST" {
+		if body, readErr := io.ReadAll(request.Body); readErr == nil {
+			_ = json.Unmarshal(body, &rpcRequest)
+		}
+	}
+	_ = rpcserver.WriteRPCResponseHTTPError(writer, status, rpctypes.RPCInternalError(rpcRequest.ID, err))
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+)
+
+// broadcastServer serves RegisterBroadcastRoutes of cfg, along with a Tendermint rpc method of its own
+func broadcastServer(cfg BroadcastConfig) *httptest.Server {
+	router := mux.NewRouter()
+	RegisterBroadcastRoutes(router, cfg)
+	router.HandleFunc("/", func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = writer.Write([]byte("mantlemint"))
+	}).Methods("POST")
+	return httptest.NewServer(router)
+}
+
+func TestBroadcastRoutes(t *testing.T) {
+	// the upstream echoes what it's sent
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("tx") == "0xslow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		body, _ := io.ReadAll(request.Body)
+		writer.WriteHeader(http.StatusAccepted)
+		_, _ = writer.Write([]byte(request.Method + " " + request.URL.RequestURI() + " " + string(body)))
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+
+	call := func(server *httptest.Server, method, path, body string) (int, string) {
+		request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		assert.Nil(t, err)
+		res, err := http.DefaultClient.Do(request)
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(resBody)
+	}
+	rpcError := func(body string) (rpctypes.RPCResponse, string) {
+		var response rpctypes.RPCResponse
+		assert.Nil(t, json.Unmarshal([]byte(body), &response))
+		if assert.NotNil(t, response.Error) {
+			return response, response.Error.Data
+		}
+		return response, ""
+	}
+
+	server := broadcastServer(BroadcastConfig{Upstream: upstreamURL, LCDUpstream: upstreamURL, Timeout: 100 * time.Millisecond})
+	defer server.Close()
+
+	// the request is forwarded as is, and the upstream's response returned verbatim
+	status, body := call(server, "GET", "/broadcast_tx_sync?tx=0x01", "")
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, "GET /broadcast_tx_sync?tx=0x01 ", body)
+
+	jsonrpc := `{"jsonrpc":"2.0","id":7,"method":"broadcast_tx_async","params":{"tx":"AQ=="}}`
+	status, body = call(server, "POST", "/", jsonrpc)
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, "POST / "+jsonrpc, body)
+
+	status, body = call(server, "POST", EndpointPOSTBroadcastTx, `{"tx_bytes":"AQ==","mode":"BROADCAST_MODE_SYNC"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, `POST /cosmos/tx/v1beta1/txs {"tx_bytes":"AQ==","mode":"BROADCAST_MODE_SYNC"}`, body)
+
+	// other json-rpc methods are left to mantlemint
+	_, body = call(server, "POST", "/", `{"jsonrpc":"2.0","id":1,"method":"status"}`)
+	assert.Equal(t, "mantlemint", body)
+
+	// broadcast_tx_commit isn't forwarded unless enabled
+	status, body = call(server, "POST", "/", `{"jsonrpc":"2.0","id":"commit","method":"broadcast_tx_commit","params":{"tx":"AQ=="}}`)
+	assert.Equal(t, http.StatusNotImplemented, status)
+	response, data := rpcError(body)
+	assert.Equal(t, rpctypes.JSONRPCStringID("commit"), response.ID)
+	assert.Contains(t, data, "broadcast_tx_commit is not supported")
+
+	// an upstream that's too slow is a bad gateway
+	status, body = call(server, "GET", "/broadcast_tx_sync?tx=0xslow", "")
+	assert.Equal(t, http.StatusBadGateway, status)
+	_, data = rpcError(body)
+	assert.Contains(t, data, "upstream failed to broadcast")
+
+	committing := broadcastServer(BroadcastConfig{Upstream: upstreamURL, Timeout: time.Second, Commit: true})
+	defer committing.Close()
+	status, body = call(committing, "GET", "/broadcast_tx_commit?tx=0x01", "")
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, "GET /broadcast_tx_commit?tx=0x01 ", body)
+
+	// without an upstream, broadcasting is refused with why
+	readOnly := broadcastServer(BroadcastConfig{Timeout: time.Second})
+	defer readOnly.Close()
+	status, body = call(readOnly, "GET", "/broadcast_tx_sync?tx=0x01", "")
+	assert.Equal(t, http.StatusNotImplemented, status)
+	_, data = rpcError(body)
+	assert.Equal(t, ErrReadOnly.Error(), data)
+}
@@ -1,77 +1,200 @@
 package rpc
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
-	lru "github.com/hashicorp/golang-lru"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+const (
+	// CacheHeader tells whether a response came from the cache, one of CacheHit, CacheMiss or CacheBypass; set to
+	// CacheBypass on a request, it's processed regardless of the cache
+	CacheHeader = "X-Mantlemint-Cache"
+
+	// CacheHeightHeader is the height a response was generated at, older than the height queried at for responses
+	// kept across blocks
+	CacheHeightHeader = "X-Mantlemint-Cache-Height"
+
+	CacheHit    = "HIT"
+	CacheMiss   = "MISS"
+	CacheBypass = "BYPASS"
+)
+
+// removal is why an entry leaves the cache
+type removal int
+
+const (
+	removalEviction removal = iota
+	removalReplacement
+	removalInvalidation
+)
+
+var (
+	EndpointGETCache       = "/admin/cache"
+	EndpointPOSTCacheFlush = "/admin/cache/flush"
 )
 
 type ResponseCache struct {
 	status int
 	body   []byte
+
+	// size is what the response is accounted for against maxBytes: its body and its key
+	size int64
+
+	// expires is when the response is no longer served, if ever
+	expires time.Time
+
+	// height and created are the height the response was generated at, if known, and when
+	height  int64
+	created time.Time
+
+	// etag is the strong ETag of a successful response, telling its body at its height apart
+	etag string
+
+	// policy is the policy the response was cached under, for it to be told still valid once persisted
+	policy CachePolicy
 }
 
+// CacheBackend caches responses by request URI, up to maxEntries of them and maxBytes in total, evicting the least
+// recently used ones beyond either
 type CacheBackend struct {
-	lru             *lru.Cache
+	lru             *simplelru.LRU
+	maxBytes        int64
+	bytes           int64
 	evictionCount   uint64
 	cacheServeCount uint64
 	serveCount      uint64
 	cacheType       string
-	mtx             *sync.RWMutex
 
-	// subscribe to cache for same request URI
-	resultChan     map[string]chan *ResponseCache
-	subscribeCount map[string]int
+	// guards lru, which isn't safe for concurrent use, bytes and removing
+	mtx *sync.RWMutex
+
+	// removing is why entries are leaving the lru, for metrics
+	removing removal
+
+	// queries in flight, by cache key, for identical requests to share rather than run again
+	flights map[string]*cacheFlight
 }
 
-func NewCacheBackend(cacheSize int, cacheType string) *CacheBackend {
-	// lru.New
-	cache, err := lru.New(cacheSize)
-	if err != nil {
-		panic(err)
-	}
+// cacheFlight is a query in flight; response is set once done is closed, nil if the query panicked
+type cacheFlight struct {
+	done     chan struct{}
+	response *ResponseCache
+}
 
-	return &CacheBackend{
-		lru:             cache,
+func NewCacheBackend(maxEntries int, maxBytes int64, cacheType string) *CacheBackend {
+	cb := &CacheBackend{
+		maxBytes:        maxBytes,
 		evictionCount:   0,
 		cacheServeCount: 0,
 		serveCount:      0,
 		cacheType:       cacheType,
 		mtx:             new(sync.RWMutex),
-		resultChan:      make(map[string]chan *ResponseCache),
-		subscribeCount:  make(map[string]int),
+		flights:         make(map[string]*cacheFlight),
 	}
+
+	// entries leaving the lru, whether evicted, expired, replaced or purged, give their bytes back
+	cache, err := simplelru.NewLRU(maxEntries, func(key interface{}, value interface{}) {
+		cb.bytes -= value.(*ResponseCache).size
+		switch cb.removing {
+		case removalEviction:
+			cacheEvictions.WithLabelValues(cb.cacheType, metricPrefix(key.(string))).Inc()
+		case removalInvalidation:
+			cacheInvalidations.WithLabelValues(cb.cacheType, metricPrefix(key.(string))).Inc()
+		}
+	})
+	if err != nil {
+		panic(err)
+	}
+	cb.lru = cache
+	cb.observe()
+
+	return cb
 }
 
+// Set caches a response for cacheKey; a response larger than maxBytes on its own is returned, but not cached
 func (cb *CacheBackend) Set(cacheKey string, status int, body []byte) *ResponseCache {
-	response := &ResponseCache{
-		status: status,
-		body:   body,
+	return cb.set(cacheKey, &ResponseCache{status: status, body: body, created: time.Now()})
+}
+
+func (cb *CacheBackend) set(cacheKey string, response *ResponseCache) *ResponseCache {
+	if response.status >= 200 && response.status < 300 {
+		response.etag = responseETag(response.height, response.body)
+	}
+	response.size = int64(len(cacheKey) + len(response.body))
+	if response.size > cb.maxBytes {
+		return response
 	}
-	if evicted := cb.lru.Add(cacheKey, response); evicted != false {
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	// the lru replaces values in place, without them going through eviction
+	cb.removing = removalReplacement
+	cb.lru.Remove(cacheKey)
+	cb.removing = removalEviction
+	cacheStores.WithLabelValues(cb.cacheType, metricPrefix(cacheKey)).Inc()
+	if evicted := cb.lru.Add(cacheKey, response); evicted {
 		cb.evictionCount++
 	}
+	cb.bytes += response.size
+	for cb.bytes > cb.maxBytes {
+		cb.lru.RemoveOldest()
+		cb.evictionCount++
+	}
+	cb.observe()
 
 	return response
 }
 
 func (cb *CacheBackend) Get(cacheKey string) *ResponseCache {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
 	cached, ok := cb.lru.Get(cacheKey)
 	if !ok {
 		return nil
 	}
 
 	data, _ := cached.(*ResponseCache)
+	if !data.expires.IsZero() && time.Now().After(data.expires) {
+		cb.lru.Remove(cacheKey)
+		cb.observe()
+		return nil
+	}
 	return data
 }
 
+// Len is how many responses are cached
+func (cb *CacheBackend) Len() int {
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+	return cb.lru.Len()
+}
+
+// Size is how many bytes the responses cached account for
+func (cb *CacheBackend) Size() int64 {
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+	return cb.bytes
+}
+
 func (cb *CacheBackend) Metric() {
-	fmt.Printf("[rpc/%s] cache length %d, eviction count %d, serveCount %d, cacheServeCount %d\n",
+	fmt.Printf("[rpc/%s] cache length %d, size %d bytes, eviction count %d, serveCount %d, cacheServeCount %d\n",
 		cb.cacheType,
-		cb.lru.Len(),
+		cb.Len(),
+		cb.Size(),
 		cb.evictionCount,
 		cb.serveCount,
 		cb.cacheServeCount,
@@ -80,97 +203,232 @@ func (cb *CacheBackend) Metric() {
 
 func (cb *CacheBackend) Purge() {
 	cb.mtx.Lock()
+	cb.removing = removalInvalidation
 	cb.lru.Purge()
+	cb.removing = removalEviction
+	cb.evictionCount = 0
+	cb.cacheServeCount = 0
+	cb.serveCount = 0
+	cb.observe()
+	cb.mtx.Unlock()
+}
+
+// Invalidate drops the responses generated below height, as it's flushed; those at height, i.e. queried as the block
+// was flushed, are kept
+func (cb *CacheBackend) Invalidate(height int64) {
+	cb.mtx.Lock()
+	cb.removing = removalInvalidation
+	for _, key := range cb.lru.Keys() {
+		if cached, ok := cb.lru.Peek(key); ok && cached.(*ResponseCache).height < height {
+			cb.lru.Remove(key)
+		}
+	}
+	cb.removing = removalEviction
 	cb.evictionCount = 0
 	cb.cacheServeCount = 0
 	cb.serveCount = 0
+	cb.observe()
 	cb.mtx.Unlock()
 }
 
+// snapshot is the responses cached, by key, the most recently used first
+func (cb *CacheBackend) snapshot() ([]string, []*ResponseCache) {
+	cb.mtx.RLock()
+	defer cb.mtx.RUnlock()
+	keys := cb.lru.Keys()
+	snapshotKeys := make([]string, 0, len(keys))
+	responses := make([]*ResponseCache, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		if cached, ok := cb.lru.Peek(keys[i]); ok {
+			snapshotKeys = append(snapshotKeys, keys[i].(string))
+			responses = append(responses, cached.(*ResponseCache))
+		}
+	}
+	return snapshotKeys, responses
+}
+
+// observe exports the size of the cache to prometheus; cb.mtx is held
+func (cb *CacheBackend) observe() {
+	cacheEntries.WithLabelValues(cb.cacheType).Set(float64(cb.lru.Len()))
+	cacheBytes.WithLabelValues(cb.cacheType).Set(float64(cb.bytes))
+}
+
 func (cb *CacheBackend) HandleCachedHTTP(writer http.ResponseWriter, request *http.Request, handler http.Handler) {
+	cb.HandleCachedHTTPWithPolicy(writer, request, handler, CachePolicy{Kind: CachePolicyUntilNextBlock}, 0)
+}
+
+// HandleCachedHTTPWithPolicy is HandleCachedHTTP, keeping responses as policy tells: for policy.TTL if any, and
+// only successful ones for immutable routes. Responses are told to come from the cache or not with the
+// X-Mantlemint-Cache header, along with the height they were generated at, and how old they are; requests with
+// X-Mantlemint-Cache: bypass are processed regardless of the cache, which they refresh. The headers are set on each
+// response, never cached.
+//
+// Responses of routes cached until the next block are keyed by height as well, the one queried at being the
+// latest for a request without one, so that a response to a query in flight as a block is flushed isn't served for
+// the next block; those kept across blocks, for a while or for good, are keyed by request URI alone.
+func (cb *CacheBackend) HandleCachedHTTPWithPolicy(writer http.ResponseWriter, request *http.Request, handler http.Handler, policy CachePolicy, height int64) {
 	cb.mtx.Lock()
 	cb.serveCount++
 	cb.mtx.Unlock()
 
 	uri := request.URL.String()
+	if policy.Kind == CachePolicyUntilNextBlock && height != 0 {
+		uri = heightCacheKey(request.URL, height)
+	}
+	bypass := strings.EqualFold(request.Header.Get(CacheHeader), CacheBypass)
 
-	// see if this request is already made, and in transit
 	// set response type as json
 	writer.Header().Set("Content-Type", "application/json")
 	writer.Header().Set("Connection", "close")
 
-	cached := cb.Get(request.URL.String())
 	// if cached, return as is
-	if cached != nil {
-		writer.WriteHeader(cached.status)
-		writer.Write(cached.body)
+	if !bypass {
+		if cached := cb.Get(uri); cached != nil {
+			writeCachedResponse(writer, request, cached, CacheHit)
+			cacheHits.WithLabelValues(cb.cacheType, metricPrefix(uri)).Inc()
 
-		cb.mtx.Lock()
-		cb.cacheServeCount++
-		cb.mtx.Unlock()
-		return
+			cb.mtx.Lock()
+			cb.cacheServeCount++
+			cb.mtx.Unlock()
+			return
+		}
 	}
 
+	// the same query is in flight but not cached yet: share its response, errors and responses too large to be
+	// cached included. Bypasses always run the query, without others sharing it.
 	cb.mtx.Lock()
-	resChan, isInTransit := cb.resultChan[uri]
-
-	// if isInTransit is false, this is the first time we're processing this query
-	// run actual querier
-	if !isInTransit {
-		c := make(chan *ResponseCache)
-		cb.resultChan[uri] = c
-		cb.subscribeCount[uri] = 0
+	if inFlight, ok := cb.flights[uri]; ok && !bypass {
 		cb.mtx.Unlock()
+		cacheMisses.WithLabelValues(cb.cacheType, metricPrefix(uri)).Inc()
+
+		<-inFlight.done
+		if inFlight.response != nil {
+			writeCachedResponse(writer, request, inFlight.response, CacheMiss)
+		} else {
+			writer.WriteHeader(503)
+			writer.Write([]byte("Service Unavailable"))
+		}
+		return
+	}
+	flight := &cacheFlight{done: make(chan struct{})}
+	if bypass {
+		cacheBypasses.WithLabelValues(cb.cacheType, metricPrefix(uri)).Inc()
+	} else {
+		cb.flights[uri] = flight
+		cacheMisses.WithLabelValues(cb.cacheType, metricPrefix(uri)).Inc()
+	}
+	cb.mtx.Unlock()
 
-		recorder := httptest.NewRecorder()
-		var cache *ResponseCache
-
-		go func() {
-			<-request.Context().Done()
-
-			// feed all subscriptions
-			cb.mtx.RLock()
-			subscribeCount := cb.subscribeCount[uri]
-			cb.mtx.RUnlock()
-
-			if cache != nil {
-				for i := 0; i < subscribeCount; i++ {
-					c <- cache
-				}
-			}
-			close(c)
-
+	// once cached, the query is no longer in flight; those sharing it are let go, and those made later go through
+	// the cache
+	defer func() {
+		if !bypass {
 			cb.mtx.Lock()
-			delete(cb.subscribeCount, uri)
-			delete(cb.resultChan, uri)
+			delete(cb.flights, uri)
 			cb.mtx.Unlock()
-		}()
-
-		// process request
-		handler.ServeHTTP(recorder, request)
+		}
+		close(flight.done)
+	}()
+
+	// process request
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	// set in cache
+	response := &ResponseCache{status: recorder.Code, body: recorder.Body.Bytes(), height: height, created: time.Now(), policy: policy}
+	if policy.Kind == CachePolicyTTL {
+		response.expires = response.created.Add(policy.TTL)
+	}
+	if policy.cacheable(recorder.Code) {
+		cb.set(uri, response)
+	}
+	flight.response = response
 
-		// set in cache
-		cache = cb.Set(request.URL.String(), recorder.Code, recorder.Body.Bytes())
+	// write
+	if bypass {
+		writeCachedResponse(writer, request, response, CacheBypass)
+	} else {
+		writeCachedResponse(writer, request, response, CacheMiss)
+	}
+}
 
-		// write
-		writer.WriteHeader(recorder.Code)
-		writer.Write(recorder.Body.Bytes())
+// heightCacheKey is u with ?height set to height, as the cache middleware sets it on requests asked at a height
+func heightCacheKey(u *url.URL, height int64) string {
+	keyed := *u
+	query := keyed.Query()
+	query.Set("height", strconv.FormatInt(height, 10))
+	keyed.RawQuery = query.Encode()
+	return keyed.String()
+}
 
-		return
+// writeCachedResponse writes response, telling how it was served with the cache headers; a client that has it
+// already, asking with If-None-Match, gets 304 without the body
+func writeCachedResponse(writer http.ResponseWriter, request *http.Request, response *ResponseCache, cacheStatus string) {
+	writer.Header().Set(CacheHeader, cacheStatus)
+	if response.height != 0 {
+		writer.Header().Set(CacheHeightHeader, strconv.FormatInt(response.height, 10))
 	}
+	writer.Header().Set("Age", strconv.Itoa(int(time.Since(response.created).Seconds())))
+	if response.etag != "" {
+		writer.Header().Set("ETag", response.etag)
+		if etagMatches(request.Header.Get("If-None-Match"), response.etag) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writer.WriteHeader(response.status)
+	writer.Write(response.body)
+}
 
-	// same query is processing but not cached yet.
-	// subscribe for cache result here.
-	cb.subscribeCount[uri]++
-	cb.mtx.Unlock()
+// responseETag is the strong ETag of body at height: a response of the latest height gets another one each block,
+// and one of a height pinned keeps it
+func responseETag(height int64, body []byte) string {
+	hash := sha256.New()
+	_ = binary.Write(hash, binary.BigEndian, height)
+	hash.Write(body)
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches tells whether the If-None-Match header ifNoneMatch matches etag; the comparison is weak, as it is for
+// If-None-Match, an ETag weakened by compression matching the strong one
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
 
-	response, ok := <-resChan
+// CacheStatus is the status of a response cache, as admin routes respond with
+type CacheStatus struct {
+	Cache   string `json:"cache"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
 
-	if ok {
-		writer.WriteHeader(response.status)
-		writer.Write(response.body)
-	} else {
-		writer.WriteHeader(503)
-		writer.Write([]byte("Service Unavailable"))
+// RegisterCacheAdminRoutes registers routes to inspect caches, and to flush them all, i.e. once a fix for a bug that
+// got bad responses cached is deployed
+func RegisterCacheAdminRoutes(router *mux.Router, caches ...*CacheBackend) {
+	writeStatus := func(writer http.ResponseWriter) {
+		statuses := make([]CacheStatus, len(caches))
+		for i, cb := range caches {
+			statuses[i] = CacheStatus{Cache: cb.cacheType, Entries: cb.Len(), Bytes: cb.Size()}
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(statuses)
 	}
+
+	router.HandleFunc(EndpointGETCache, func(writer http.ResponseWriter, request *http.Request) {
+		writeStatus(writer)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointPOSTCacheFlush, func(writer http.ResponseWriter, request *http.Request) {
+		for _, cb := range caches {
+			fmt.Printf("[rpc/%s] flushing cache of %d responses\n", cb.cacheType, cb.Len())
+			cb.Purge()
+		}
+		writeStatus(writer)
+	}).Methods("POST")
 }
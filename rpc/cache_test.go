@@ -1,16 +1,23 @@
 package rpc
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/hld"
 )
 
 func TestCacheBackend(t *testing.T) {
-	cb := NewCacheBackend(1, "test")
+	cb := NewCacheBackend(1, 1<<20, "test")
 
 	cb.Set("key", 200, []byte("hello world"))
 	cached := cb.Get("key")
@@ -61,3 +68,421 @@ func TestCacheBackend(t *testing.T) {
 	assert.Equal(t, callCount, 1)
 
 }
+
+func TestCacheBackendBounds(t *testing.T) {
+	cb := NewCacheBackend(3, 40, "test")
+
+	// entries account for their key and body
+	cb.Set("a", 200, []byte("0123456789"))
+	cb.Set("b", 200, []byte("0123456789"))
+	assert.Equal(t, 2, cb.Len())
+	assert.Equal(t, int64(22), cb.Size())
+
+	// replacing an entry doesn't count it twice
+	cb.Set("a", 200, []byte("01234"))
+	assert.Equal(t, int64(17), cb.Size())
+
+	// the least recently used entries are evicted beyond the bytes bound, as beyond the entries one
+	assert.NotNil(t, cb.Get("b"))
+	cb.Set("c", 200, make([]byte, 25))
+	assert.Nil(t, cb.Get("a"))
+	assert.NotNil(t, cb.Get("b"))
+	assert.Equal(t, int64(37), cb.Size())
+	cb.Set("d", 200, nil)
+	cb.Set("e", 200, nil)
+	assert.Equal(t, 3, cb.Len())
+	assert.Nil(t, cb.Get("c"))
+
+	// a response larger than the whole cache isn't kept, nor evicts anything
+	cb.Set("f", 200, make([]byte, 40))
+	assert.Nil(t, cb.Get("f"))
+	assert.Equal(t, 3, cb.Len())
+
+	cb.Purge()
+	assert.Zero(t, cb.Len())
+	assert.Zero(t, cb.Size())
+}
+
+func TestCacheMiddleware(t *testing.T) {
+	resolveHeight := func(height int64) (int64, error) {
+		switch {
+		case height == 0:
+			return 100, nil
+		case height > 100:
+			return 0, fmt.Errorf("height %d must be less than or equal to the current blockchain height 100", height)
+		case height < 50:
+			return 0, fmt.Errorf("%w: %d is below the lowest height retained, 50", hld.ErrHeightPruned, height)
+		}
+		return height, nil
+	}
+	var queried []string
+	handler := cacheMiddleware(NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival"), CachePolicies{}, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			queried = append(queried, request.Header.Get(grpctypes.GRPCBlockHeightHeader))
+			_, _ = writer.Write([]byte("{}"))
+		}),
+	)
+	serve := func(path string, header string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if header != "" {
+			request.Header.Set(grpctypes.GRPCBlockHeightHeader, header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// the height is sent back, the latest one if none is asked for
+	res := serve("/cosmos/bank/v1beta1/balances/terra1a", "")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "100", res.Header().Get(grpctypes.GRPCBlockHeightHeader))
+
+	// a height asked for with the header or with ?height is queried at, and cached alike
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a", "60")
+	assert.Equal(t, "60", res.Header().Get(grpctypes.GRPCBlockHeightHeader))
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a?height=60", "")
+	assert.Equal(t, "60", res.Header().Get(grpctypes.GRPCBlockHeightHeader))
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a", "70")
+	assert.Equal(t, "70", res.Header().Get(grpctypes.GRPCBlockHeightHeader))
+	assert.Equal(t, []string{"", "60", "70"}, queried)
+
+	// heights that aren't served are refused, rather than answered at another
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a", "101")
+	assert.Equal(t, 400, res.Code)
+	assert.Contains(t, res.Body.String(), "current blockchain height 100")
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a?height=10", "")
+	assert.Equal(t, 400, res.Code)
+	assert.Contains(t, res.Body.String(), "height is pruned")
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a?height=latest", "")
+	assert.Equal(t, 400, res.Code)
+	assert.Len(t, queried, 3)
+}
+
+func TestCachePolicies(t *testing.T) {
+	policies, err := ParseCachePolicies("/health=no-store, /cosmos/tx/v1beta1/txs/=immutable,/terra/=ttl:30s,/terra/oracle/=until-next-block")
+	assert.Nil(t, err)
+	assert.Equal(t, CachePolicy{Kind: CachePolicyImmutable}, policies.For("/cosmos/tx/v1beta1/txs/AB12"))
+	assert.Equal(t, CachePolicy{Kind: CachePolicyUntilNextBlock}, policies.For("/cosmos/tx/v1beta1/txs"))
+	assert.Equal(t, CachePolicy{Kind: CachePolicyTTL, TTL: 30 * time.Second}, policies.For("/terra/treasury/v1beta1/tax_rate"))
+
+	// the longest prefix wins
+	assert.Equal(t, CachePolicy{Kind: CachePolicyUntilNextBlock}, policies.For("/terra/oracle/v1beta1/denoms/exchange_rates"))
+
+	for _, invalid := range []string{"health=no-store", "/health", "/health=forever", "/terra/=ttl:", "/terra/=ttl:-1s"} {
+		_, err := ParseCachePolicies(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestCacheMiddlewarePolicies(t *testing.T) {
+	latest := int64(100)
+	resolveHeight := func(height int64) (int64, error) {
+		if height == 0 {
+			return latest, nil
+		}
+		return height, nil
+	}
+	policies, err := ParseCachePolicies("/status=no-store,/aggregate=ttl:50ms,/code/=immutable")
+	assert.Nil(t, err)
+	cache, ttlCache, archivalCache := NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival")
+	queried := map[string]int{}
+	handler := cacheMiddleware(cache, ttlCache, archivalCache, policies, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			queried[request.URL.Path]++
+			if request.URL.Path == "/code/2" && queried[request.URL.Path] == 1 {
+				writer.WriteHeader(404)
+			}
+			_, _ = writer.Write([]byte(fmt.Sprintf("%d", latest)))
+		}),
+	)
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder
+	}
+	newBlock := func() {
+		latest++
+		cache.Purge()
+	}
+
+	for _, path := range []string{"/status", "/aggregate", "/code/1", "/code/2", "/balances"} {
+		serve(path)
+		if path != "/code/2" {
+			serve(path)
+		}
+	}
+	newBlock()
+	for _, path := range []string{"/status", "/aggregate", "/code/1", "/balances"} {
+		serve(path)
+	}
+
+	// no-store routes are always queried; until-next-block ones once a block
+	assert.Equal(t, 3, queried["/status"])
+	assert.Equal(t, 2, queried["/balances"])
+
+	// ttl ones outlive the block, until they expire
+	assert.Equal(t, 1, queried["/aggregate"])
+	assert.Equal(t, "100", serve("/aggregate").Body.String())
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, "101", serve("/aggregate").Body.String())
+
+	// immutable ones are kept for good, once found
+	assert.Equal(t, 1, queried["/code/1"])
+	assert.Equal(t, 200, serve("/code/2").Code)
+	assert.Equal(t, 200, serve("/code/2").Code)
+	assert.Equal(t, 2, queried["/code/2"])
+}
+
+func TestCacheHeaders(t *testing.T) {
+	latest := int64(100)
+	resolveHeight := func(height int64) (int64, error) {
+		if height == 0 {
+			return latest, nil
+		}
+		return height, nil
+	}
+	policies, err := ParseCachePolicies("/aggregate=ttl:1m,/status=no-store")
+	assert.Nil(t, err)
+	queried := 0
+	handler := cacheMiddleware(NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival"), policies, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			queried++
+			_, _ = writer.Write([]byte(fmt.Sprintf("%d", queried)))
+		}),
+	)
+	serve := func(path string, bypass bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if bypass {
+			request.Header.Set(CacheHeader, "bypass")
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// responses tell whether they came from the cache, and the height they were generated at
+	res := serve("/aggregate", false)
+	assert.Equal(t, CacheMiss, res.Header().Get(CacheHeader))
+	assert.Equal(t, "100", res.Header().Get(CacheHeightHeader))
+	latest = 101
+	res = serve("/aggregate", false)
+	assert.Equal(t, CacheHit, res.Header().Get(CacheHeader))
+	assert.Equal(t, "100", res.Header().Get(CacheHeightHeader))
+	assert.Equal(t, "101", res.Header().Get(grpctypes.GRPCBlockHeightHeader))
+	assert.Equal(t, "0", res.Header().Get("Age"))
+	assert.Equal(t, "1", res.Body.String())
+
+	// bypasses are processed regardless of the cache, and refresh it
+	res = serve("/aggregate", true)
+	assert.Equal(t, CacheBypass, res.Header().Get(CacheHeader))
+	assert.Equal(t, "101", res.Header().Get(CacheHeightHeader))
+	assert.Equal(t, "2", res.Body.String())
+	res = serve("/aggregate", false)
+	assert.Equal(t, CacheHit, res.Header().Get(CacheHeader))
+	assert.Equal(t, "2", res.Body.String())
+
+	// routes that aren't cached tell nothing
+	res = serve("/status", false)
+	assert.Empty(t, res.Header().Get(CacheHeader))
+}
+
+func TestCacheETags(t *testing.T) {
+	latest := int64(100)
+	resolveHeight := func(height int64) (int64, error) {
+		if height == 0 {
+			return latest, nil
+		}
+		return height, nil
+	}
+	handler := cacheMiddleware(NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival"), CachePolicies{}, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/missing" {
+				writer.WriteHeader(404)
+			}
+			_, _ = writer.Write([]byte(`{"balance":"1"}`))
+		}),
+	)
+	serve := func(path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// a client that has the response already gets 304 without the body, weak ETags matching too
+	res := serve("/balance", "")
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	res = serve("/balance", etag)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+	assert.Equal(t, etag, res.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, serve("/balance", `"other", W/`+etag).Code)
+	assert.Equal(t, 200, serve("/balance", `"other"`).Code)
+
+	// at the latest height, the ETag changes each block, the body alike
+	latest = 101
+	res = serve("/balance", etag)
+	assert.Equal(t, 200, res.Code)
+	assert.NotEqual(t, etag, res.Header().Get("ETag"))
+
+	// at a height pinned, it never does
+	pinned := serve("/balance?height=100", "").Header().Get("ETag")
+	assert.Equal(t, etag, pinned)
+	latest = 102
+	assert.Equal(t, http.StatusNotModified, serve("/balance?height=100", pinned).Code)
+
+	// errors have none
+	assert.Empty(t, serve("/missing", "").Header().Get("ETag"))
+}
+
+func TestCacheMetrics(t *testing.T) {
+	cb := NewCacheBackend(2, 1<<20, "metrics")
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("{}"))
+	})
+	serve := func(uri string) {
+		cb.HandleCachedHTTPWithPolicy(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil), handler, CachePolicy{}, 0)
+	}
+	count := func(counter *prometheus.CounterVec, prefix string) float64 {
+		return testutil.ToFloat64(counter.WithLabelValues("metrics", prefix))
+	}
+
+	// requests are counted by the prefix of their path
+	serve("/cosmos/bank/v1beta1/balances/terra1a")
+	serve("/cosmos/bank/v1beta1/balances/terra1a")
+	serve("/cosmos/bank/v1beta1/balances/terra1b")
+	serve("/blocks/5000000")
+	assert.Equal(t, float64(1), count(cacheHits, "/cosmos/bank/v1beta1"))
+	assert.Equal(t, float64(2), count(cacheMisses, "/cosmos/bank/v1beta1"))
+	assert.Equal(t, float64(2), count(cacheStores, "/cosmos/bank/v1beta1"))
+	assert.Equal(t, float64(1), count(cacheEvictions, "/cosmos/bank/v1beta1"))
+	assert.Equal(t, float64(1), count(cacheStores, "/blocks"))
+
+	// as are responses dropped as blocks are flushed
+	cb.Purge()
+	assert.Equal(t, float64(1), count(cacheInvalidations, "/cosmos/bank/v1beta1"))
+	assert.Equal(t, float64(1), count(cacheInvalidations, "/blocks"))
+}
+
+func TestCacheAdminRoutes(t *testing.T) {
+	latest, archival := NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "archival")
+	latest.Set("/a", 200, []byte("{}"))
+	archival.Set("/a?height=1", 200, []byte("{}"))
+	router := mux.NewRouter()
+	RegisterCacheAdminRoutes(router, latest, archival)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", EndpointGETCache, nil))
+	var statuses []CacheStatus
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &statuses))
+	assert.Equal(t, []CacheStatus{{Cache: "latest", Entries: 1, Bytes: 4}, {Cache: "archival", Entries: 1, Bytes: 13}}, statuses)
+
+	// every cache is flushed, those of past heights included
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", EndpointPOSTCacheFlush, nil))
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &statuses))
+	assert.Equal(t, []CacheStatus{{Cache: "latest"}, {Cache: "archival"}}, statuses)
+	assert.Nil(t, archival.Get("/a?height=1"))
+}
+
+func TestCacheHeightKeys(t *testing.T) {
+	latest := int64(100)
+	resolveHeight := func(height int64) (int64, error) {
+		if height == 0 {
+			return latest, nil
+		}
+		return height, nil
+	}
+	cache, archivalCache := NewCacheBackend(16, 1<<20, "latest"), NewCacheBackend(16, 1<<20, "archival")
+	queried := 0
+	handler := cacheMiddleware(cache, NewCacheBackend(16, 1<<20, "ttl"), archivalCache, CachePolicies{}, resolveHeight)(
+		http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			queried++
+			_, _ = writer.Write([]byte(fmt.Sprintf("%d", latest)))
+		}),
+	)
+	serve := func(path string) string {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder.Body.String()
+	}
+
+	// a response at the latest height isn't served once another height is, even before the cache is invalidated
+	assert.Equal(t, "100", serve("/balances"))
+	latest = 101
+	assert.Equal(t, "101", serve("/balances"))
+	assert.Equal(t, 2, queried)
+
+	// invalidation drops the responses below the height flushed, but not those at it
+	cache.Invalidate(101)
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, "101", serve("/balances"))
+	assert.Equal(t, 2, queried)
+
+	// responses at a height are kept apart, never invalidated
+	assert.Equal(t, "101", serve("/balances?height=90"))
+	cache.Invalidate(102)
+	assert.Zero(t, cache.Len())
+	assert.Equal(t, 1, archivalCache.Len())
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	cb := NewCacheBackend(16, 1<<20, "coalescing")
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	queried := 0
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		queried++
+		started <- struct{}{}
+		<-release
+		writer.WriteHeader(500)
+		_, _ = writer.Write([]byte("failed"))
+	})
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		cb.HandleCachedHTTPWithPolicy(recorder, httptest.NewRequest("GET", "/contract/smart", nil), handler, CachePolicy{}, 100)
+		return recorder
+	}
+
+	// identical requests made while a query is in flight share it, its errors included
+	responses := make(chan *httptest.ResponseRecorder, 5)
+	go func() { responses <- serve() }()
+	<-started
+	for i := 0; i < 4; i++ {
+		go func() { responses <- serve() }()
+	}
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(cacheMisses.WithLabelValues("coalescing", "/contract/smart")) == 5
+	}, time.Second, time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		res := <-responses
+		assert.Equal(t, 500, res.Code)
+		assert.Equal(t, "failed", res.Body.String())
+	}
+	assert.Equal(t, 1, queried)
+
+	// but errors aren't cached
+	assert.Equal(t, 500, serve().Code)
+	<-started
+	assert.Equal(t, 2, queried)
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(httpMetricsMiddleware)
+	router.HandleFunc("/index/tx/by_height/{height}", func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+	router.PathPrefix("/").HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
+
+	// requests are counted by the template of their route, or the prefix of their path for routes of all paths
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/index/tx/by_height/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/index/tx/by_height/2", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/cosmos/auth/v1beta1/accounts/terra1a", nil))
+	assert.Equal(t, float64(2), testutil.ToFloat64(httpRequests.WithLabelValues("/index/tx/by_height/{height}", "GET", "404")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("/cosmos/auth/v1beta1", "GET", "200")))
+}
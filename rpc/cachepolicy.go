@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CachePolicyKind is how long responses of a route are cached for
+type CachePolicyKind int
+
+const (
+	// CachePolicyUntilNextBlock caches responses at the latest height until the next block is flushed, and those at
+	// a height for good
+	CachePolicyUntilNextBlock CachePolicyKind = iota
+
+	// CachePolicyNoStore never caches responses
+	CachePolicyNoStore
+
+	// CachePolicyTTL caches responses at the latest height for a while, across blocks, and those at a height for good
+	CachePolicyTTL
+
+	// CachePolicyImmutable caches successful responses for good, at whichever height
+	CachePolicyImmutable
+)
+
+// CachePolicy is how responses of a route are cached
+type CachePolicy struct {
+	Kind CachePolicyKind
+
+	// TTL is how long responses are kept for, with CachePolicyTTL
+	TTL time.Duration
+}
+
+// cacheable tells whether a response of status is to be kept under the policy: errors never are, and immutable
+// routes only keep successful responses, those telling something isn't there yet being bound to change
+func (p CachePolicy) cacheable(status int) bool {
+	if p.Kind == CachePolicyImmutable {
+		return status >= 200 && status < 300
+	}
+	return status < 400
+}
+
+func (p CachePolicy) String() string {
+	switch p.Kind {
+	case CachePolicyNoStore:
+		return "no-store"
+	case CachePolicyTTL:
+		return "ttl:" + p.TTL.String()
+	case CachePolicyImmutable:
+		return "immutable"
+	default:
+		return "until-next-block"
+	}
+}
+
+// ParseCachePolicy parses no-store, until-next-block, ttl:<duration> or immutable
+func ParseCachePolicy(policy string) (CachePolicy, error) {
+	switch {
+	case policy == "no-store":
+		return CachePolicy{Kind: CachePolicyNoStore}, nil
+	case policy == "until-next-block":
+		return CachePolicy{Kind: CachePolicyUntilNextBlock}, nil
+	case policy == "immutable":
+		return CachePolicy{Kind: CachePolicyImmutable}, nil
+	case strings.HasPrefix(policy, "ttl:"):
+		ttl, err := time.ParseDuration(strings.TrimPrefix(policy, "ttl:"))
+		if err != nil {
+			return CachePolicy{}, fmt.Errorf("invalid ttl of cache policy %q: %v", policy, err)
+		} else if ttl <= 0 {
+			return CachePolicy{}, fmt.Errorf("ttl of cache policy %q must be positive", policy)
+		}
+		return CachePolicy{Kind: CachePolicyTTL, TTL: ttl}, nil
+	default:
+		return CachePolicy{}, fmt.Errorf("unknown cache policy %q: must be no-store, until-next-block, ttl:<duration> or immutable", policy)
+	}
+}
+
+// CachePolicies are the cache policies of routes, by path prefix
+type CachePolicies map[string]CachePolicy
+
+// ParseCachePolicies parses a comma separated list of <path prefix>=<policy>, i.e.
+// "/cosmos/tx/v1beta1/txs/=immutable,/terra/oracle/=ttl:30s"
+func ParseCachePolicies(list string) (CachePolicies, error) {
+	policies := CachePolicies{}
+	for _, rule := range strings.Split(list, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		prefix, policy, ok := strings.Cut(rule, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid cache policy %q: must be <path prefix>=<policy>, the prefix starting with /", rule)
+		}
+		parsed, err := ParseCachePolicy(policy)
+		if err != nil {
+			return nil, err
+		}
+		policies[prefix] = parsed
+	}
+	return policies, nil
+}
+
+// For is the policy of the longest prefix of path, or CachePolicyUntilNextBlock if none
+func (p CachePolicies) For(path string) CachePolicy {
+	var longest string
+	policy := CachePolicy{Kind: CachePolicyUntilNextBlock}
+	for prefix, prefixPolicy := range p {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(longest) {
+			longest, policy = prefix, prefixPolicy
+		}
+	}
+	return policy
+}
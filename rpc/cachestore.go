@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var cacheStorePrefix = []byte("mantlemint/cache/")
+
+// persistedResponse is a cached response as it's persisted
+type persistedResponse struct {
+	Key     string    `json:"key"`
+	Status  int       `json:"status"`
+	Body    []byte    `json:"body"`
+	Height  int64     `json:"height"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires,omitempty"`
+	Policy  string    `json:"policy"`
+}
+
+// CacheStore persists response caches to a db, for them to survive restarts rather than every restart starting
+// off cold. Only responses that don't go stale as blocks are flushed are worth persisting: those at a height, of
+// immutable routes, and of routes with a ttl until they expire; see Save and Load.
+type CacheStore struct {
+	db tmdb.DB
+
+	// maxBytes bounds what's persisted of all caches
+	maxBytes int64
+}
+
+func NewCacheStore(db tmdb.DB, maxBytes int64) *CacheStore {
+	return &CacheStore{db: db, maxBytes: maxBytes}
+}
+
+// Save replaces what's persisted of caches with the responses they hold, the most recently used first, up to
+// maxBytes in all; the rest are let go. Synced to disk.
+func (s *CacheStore) Save(caches ...*CacheBackend) (int, error) {
+	if err := s.Clear(); err != nil {
+		return 0, err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	var saved int
+	var bytes int64
+	for _, cb := range caches {
+		keys, responses := cb.snapshot()
+		for i, response := range responses {
+			if bytes+response.size > s.maxBytes {
+				break
+			}
+			bytes += response.size
+			persisted, err := json.Marshal(persistedResponse{
+				Key:     keys[i],
+				Status:  response.status,
+				Body:    response.body,
+				Height:  response.height,
+				Created: response.created,
+				Expires: response.expires,
+				Policy:  response.policy.String(),
+			})
+			if err != nil {
+				return 0, err
+			}
+			if err := batch.Set(cacheStoreKey(cb.cacheType, i), persisted); err != nil {
+				return 0, err
+			}
+			saved++
+		}
+	}
+
+	return saved, batch.WriteSync()
+}
+
+// Load loads the responses persisted of caches back into them, those still valid under policies, as they may have
+// changed since; the least recently used first, for them to be evicted first still
+func (s *CacheStore) Load(policies CachePolicies, caches ...*CacheBackend) (int, error) {
+	var loaded int
+	for _, cb := range caches {
+		prefix := append(append([]byte{}, cacheStorePrefix...), cb.cacheType+"/"...)
+		iter, err := s.db.ReverseIterator(prefix, prefixEnd(prefix))
+		if err != nil {
+			return loaded, err
+		}
+
+		for ; iter.Valid(); iter.Next() {
+			var persisted persistedResponse
+			if err := json.Unmarshal(iter.Value(), &persisted); err != nil {
+				iter.Close()
+				return loaded, err
+			}
+			response, ok := persisted.response(policies)
+			if !ok {
+				continue
+			}
+			cb.set(persisted.Key, response)
+			loaded++
+		}
+		if err := iter.Close(); err != nil {
+			return loaded, err
+		}
+	}
+	return loaded, nil
+}
+
+// Clear drops all that's persisted, i.e. for a restart to ignore it
+func (s *CacheStore) Clear() error {
+	iter, err := s.db.Iterator(cacheStorePrefix, prefixEnd(cacheStorePrefix))
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	for ; iter.Valid(); iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return err
+		}
+	}
+	return batch.WriteSync()
+}
+
+func (s *CacheStore) Close() error {
+	return s.db.Close()
+}
+
+// response is the persisted response as cached, if it's still valid under policies: responses of immutable routes
+// as long as they still are, those at a height as long as their route is cached, and those of routes with a ttl as
+// long as they haven't expired
+func (p persistedResponse) response(policies CachePolicies) (*ResponseCache, bool) {
+	policy, err := ParseCachePolicy(p.Policy)
+	if err != nil {
+		return nil, false
+	}
+	u, err := url.Parse(p.Key)
+	if err != nil {
+		return nil, false
+	}
+	if !p.Expires.IsZero() && time.Now().After(p.Expires) {
+		return nil, false
+	}
+
+	current := policies.For(u.Path)
+	switch policy.Kind {
+	case CachePolicyImmutable:
+		if current.Kind != CachePolicyImmutable {
+			return nil, false
+		}
+	case CachePolicyTTL:
+		if current.Kind != CachePolicyTTL {
+			return nil, false
+		}
+	default:
+		if p.Height == 0 || current.Kind == CachePolicyNoStore {
+			return nil, false
+		}
+	}
+
+	return &ResponseCache{
+		status:  p.Status,
+		body:    p.Body,
+		expires: p.Expires,
+		height:  p.Height,
+		created: p.Created,
+		policy:  policy,
+	}, true
+}
+
+// cacheStoreKey is the key of the i-th most recently used response of cacheType
+func cacheStoreKey(cacheType string, i int) []byte {
+	key := append(append([]byte{}, cacheStorePrefix...), cacheType+"/"...)
+	return binary.BigEndian.AppendUint64(key, uint64(i))
+}
+
+// prefixEnd is the end of the domain of keys starting with prefix
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func TestCacheStore(t *testing.T) {
+	db := tmdb.NewMemDB()
+	store := NewCacheStore(db, 1<<20)
+	policies, err := ParseCachePolicies("/cosmos/tx/v1beta1/txs/=immutable,/terra/treasury/=ttl:1h,/terra/oracle/=ttl:1ms")
+	assert.Nil(t, err)
+
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.URL.String()))
+	})
+	serve := func(cb *CacheBackend, uri string, policy CachePolicy, height int64) {
+		cb.HandleCachedHTTPWithPolicy(httptest.NewRecorder(), httptest.NewRequest("GET", uri, nil), handler, policy, height)
+	}
+	ttlCache, archivalCache := NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival")
+	serve(archivalCache, "/cosmos/tx/v1beta1/txs/AB12", policies.For("/cosmos/tx/v1beta1/txs/"), 10)
+	serve(archivalCache, "/cosmos/bank/v1beta1/balances/terra1a?height=8", CachePolicy{}, 8)
+	serve(ttlCache, "/terra/treasury/v1beta1/tax_rate", policies.For("/terra/treasury/"), 10)
+	serve(ttlCache, "/terra/oracle/v1beta1/denoms/exchange_rates", policies.For("/terra/oracle/"), 10)
+
+	saved, err := store.Save(ttlCache, archivalCache)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, saved)
+	time.Sleep(5 * time.Millisecond)
+
+	// responses still valid are loaded back, with the height they were generated at; expired ones aren't
+	ttlCache, archivalCache = NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival")
+	loaded, err := store.Load(policies, ttlCache, archivalCache)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, loaded)
+	if cached := archivalCache.Get("/cosmos/tx/v1beta1/txs/AB12"); assert.NotNil(t, cached) {
+		assert.Equal(t, []byte("/cosmos/tx/v1beta1/txs/AB12"), cached.body)
+		assert.Equal(t, int64(10), cached.height)
+	}
+	assert.NotNil(t, archivalCache.Get("/cosmos/bank/v1beta1/balances/terra1a?height=8"))
+	assert.NotNil(t, ttlCache.Get("/terra/treasury/v1beta1/tax_rate"))
+	assert.Nil(t, ttlCache.Get("/terra/oracle/v1beta1/denoms/exchange_rates"))
+
+	// nor are those whose routes are no longer cached the same way
+	policies, err = ParseCachePolicies("/cosmos/bank/=no-store,/terra/treasury/=until-next-block")
+	assert.Nil(t, err)
+	ttlCache, archivalCache = NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival")
+	loaded, err = store.Load(policies, ttlCache, archivalCache)
+	assert.Nil(t, err)
+	assert.Zero(t, loaded)
+
+	// what's persisted is bounded, the most recently used responses making it
+	archivalCache = NewCacheBackend(16, 1<<20, "archival")
+	serve(archivalCache, "/cosmos/bank/v1beta1/supply?height=1", CachePolicy{}, 1)
+	serve(archivalCache, "/cosmos/bank/v1beta1/supply?height=2", CachePolicy{}, 2)
+	store = NewCacheStore(db, archivalCache.Size()-1)
+	saved, err = store.Save(archivalCache)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, saved)
+	archivalCache = NewCacheBackend(16, 1<<20, "archival")
+	loaded, err = store.Load(CachePolicies{}, NewCacheBackend(16, 1<<20, "ttl"), archivalCache)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, loaded)
+	assert.NotNil(t, archivalCache.Get("/cosmos/bank/v1beta1/supply?height=2"))
+
+	// and dropped to be ignored
+	assert.Nil(t, store.Clear())
+	loaded, err = store.Load(CachePolicies{}, archivalCache)
+	assert.Nil(t, err)
+	assert.Zero(t, loaded)
+}
@@ -2,12 +2,13 @@ package rpc
 
 import (
 	"context"
-	"fmt"
+	"errors"
 
 	abcicli "github.com/tendermint/tendermint/abci/client"
 	abci "github.com/tendermint/tendermint/abci/types"
 	"github.com/tendermint/tendermint/libs/bytes"
 	tmlog "github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/proxy"
 	rpcclient "github.com/tendermint/tendermint/rpc/client"
 	"github.com/tendermint/tendermint/rpc/core"
 	coretypes "github.com/tendermint/tendermint/rpc/core/types"
@@ -16,20 +17,42 @@ import (
 
 var _ rpcclient.Client = (*MantlemintRPCClient)(nil)
 
+// ErrTxIndexUnavailable fails reads of txs by a client without a TxIndex
+var ErrTxIndexUnavailable = errors.New("txs can't be read without the tx index")
+
 type MantlemintRPCClient struct {
-	client abcicli.Client
+	client  abcicli.Client
+	txIndex TxIndex
+}
+
+// TxIndex serves txs, and the blocks they're in, off mantlemint's index, for the tx service to read them from
+type TxIndex interface {
+	Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error)
+	Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error)
+	TxSearch(ctx context.Context, query string, prove bool, page, perPage *int, orderBy string) (*coretypes.ResultTxSearch, error)
 }
 
 func NewRpcClient(client abcicli.Client) rpcclient.Client {
 	return &MantlemintRPCClient{client: client}
 }
 
+// NewIndexedRpcClient is NewRpcClient, serving blocks and txs off txIndex
+func NewIndexedRpcClient(client abcicli.Client, txIndex TxIndex) rpcclient.Client {
+	return &MantlemintRPCClient{client: client, txIndex: txIndex}
+}
+
 func (m *MantlemintRPCClient) ABCIInfo(ctx context.Context) (*coretypes.ResultABCIInfo, error) {
-	panic("implement me")
+	if resp, err := m.client.InfoSync(proxy.RequestInfo); err != nil {
+		return nil, err
+	} else {
+		return &coretypes.ResultABCIInfo{
+			Response: *resp,
+		}, nil
+	}
 }
 
 func (m *MantlemintRPCClient) ABCIQuery(ctx context.Context, path string, data bytes.HexBytes) (*coretypes.ResultABCIQuery, error) {
-	if resp, err := m.client.QuerySync(abci.RequestQuery{
+	if resp, err := QuerySyncContext(ctx, m.client, abci.RequestQuery{
 		Data:   data,
 		Path:   path,
 		Height: 0,
@@ -98,16 +121,17 @@ func (m *MantlemintRPCClient) SetLogger(logger tmlog.Logger) {
 	panic("implement me")
 }
 
+// BroadcastTx* fail, as there's no mempool to broadcast tx to; see RegisterBroadcastRoutes for forwarding them
 func (m *MantlemintRPCClient) BroadcastTxCommit(ctx context.Context, tx tendermint.Tx) (*coretypes.ResultBroadcastTxCommit, error) {
-	panic("implement me")
+	return nil, ErrReadOnly
 }
 
 func (m *MantlemintRPCClient) BroadcastTxAsync(ctx context.Context, tx tendermint.Tx) (*coretypes.ResultBroadcastTx, error) {
-	panic("implement me")
+	return nil, ErrReadOnly
 }
 
 func (m *MantlemintRPCClient) BroadcastTxSync(ctx context.Context, tx tendermint.Tx) (*coretypes.ResultBroadcastTx, error) {
-	panic("implement me")
+	return nil, ErrReadOnly
 }
 
 func (m *MantlemintRPCClient) Subscribe(ctx context.Context, subscriber, query string, outCapacity ...int) (out <-chan coretypes.ResultEvent, err error) {
@@ -155,10 +179,10 @@ func (m *MantlemintRPCClient) Health(ctx context.Context) (*coretypes.ResultHeal
 }
 
 func (m *MantlemintRPCClient) Block(ctx context.Context, height *int64) (*coretypes.ResultBlock, error) {
+	if m.txIndex != nil {
+		return m.txIndex.Block(ctx, height)
+	}
 	return core.Block(nil, height)
-	fmt.Println("is it you")
-
-	panic("implement me")
 }
 
 func (m *MantlemintRPCClient) BlockByHash(ctx context.Context, hash []byte) (*coretypes.ResultBlock, error) {
@@ -178,11 +202,17 @@ func (m *MantlemintRPCClient) Validators(ctx context.Context, height *int64, pag
 }
 
 func (m *MantlemintRPCClient) Tx(ctx context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
-	panic("implement me")
+	if m.txIndex == nil {
+		return nil, ErrTxIndexUnavailable
+	}
+	return m.txIndex.Tx(ctx, hash, prove)
 }
 
 func (m *MantlemintRPCClient) TxSearch(ctx context.Context, query string, prove bool, page, perPage *int, orderBy string) (*coretypes.ResultTxSearch, error) {
-	panic("implement me")
+	if m.txIndex == nil {
+		return nil, ErrTxIndexUnavailable
+	}
+	return m.txIndex.TxSearch(ctx, query, prove, page, perPage, orderBy)
 }
 
 func (m *MantlemintRPCClient) BlockSearch(ctx context.Context, query string, page, perPage *int, orderBy string) (*coretypes.ResultBlockSearch, error) {
@@ -0,0 +1,197 @@
+package rpc
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CompressionConfig configures the compression middleware
+type CompressionConfig struct {
+	// MinSize is how large a response must be to be compressed, smaller ones not being worth it
+	MinSize int
+
+	// ContentTypes are the media types of responses that are compressed, i.e. application/json, or text/* for any
+	// subtype
+	ContentTypes []string
+}
+
+func (c CompressionConfig) compresses(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.ContentTypes {
+		if strings.EqualFold(allowed, mediaType) || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressionMiddleware compresses responses with gzip or deflate, as the client accepts with Accept-Encoding, if
+// they're at least cfg.MinSize and of the content types of cfg. Responses are compressed as they're written, the
+// cache only ever holding them uncompressed, so that a response cached is served to clients whichever encoding they
+// accept. Websocket upgrades are passed through as they are.
+func compressionMiddleware(cfg CompressionConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if strings.EqualFold(request.Header.Get("Upgrade"), "websocket") {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			writer.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(request.Header.Get("Accept-Encoding"))
+			if encoding == "" || request.Method == "HEAD" {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			compressor := &compressWriter{ResponseWriter: writer, cfg: cfg, encoding: encoding, status: http.StatusOK}
+			defer compressor.close()
+			next.ServeHTTP(compressor, request)
+		})
+	}
+}
+
+// negotiateEncoding is the encoding a response is compressed with for a client accepting acceptEncoding: gzip,
+// deflate, or none. gzip is preferred unless deflate is weighed higher.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := map[string]float64{}
+	for _, accepted := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				weight = parsed
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(coding))] = weight
+	}
+
+	best, bestWeight := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		weight, ok := weights[coding]
+		if !ok {
+			weight, ok = weights["*"]
+		}
+		if ok && weight > bestWeight {
+			best, bestWeight = coding, weight
+		}
+	}
+	return best
+}
+
+// compressWriter holds back what's written until it's at least cfg.MinSize, to tell whether the response is worth
+// compressing, then writes it on compressed or not
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+
+	// compressor is what's written goes through, if compressed
+	compressor io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.cfg.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.compressor != nil {
+		return w.compressor.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide compresses the response if it's large enough and of a content type to, then writes what's held back
+func (w *compressWriter) decide() error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	compress := len(w.buf) >= w.cfg.MinSize && len(w.buf) > 0 && header.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified && w.cfg.compresses(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// a strong ETag is of the bytes sent, which differ by encoding; weakened, it still matches on If-None-Match
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == "gzip" {
+			w.compressor = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.compressor, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.compressor != nil {
+		_, err := w.compressor.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush writes what's held back, compressed if it's large enough already, for streamed responses
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide()
+	}
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer can't be hijacked")
+}
+
+// close writes what's still held back, and the end of the compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		_ = w.decide()
+	}
+	if w.compressor != nil {
+		_ = w.compressor.Close()
+	}
+}
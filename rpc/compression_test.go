@@ -0,0 +1,92 @@
+package rpc
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompression(t *testing.T) {
+	large := `{"balances":[` + strings.Repeat(`{"denom":"uluna","amount":"1000000"},`, 100) + `{}]}`
+	queried := 0
+	cache := NewCacheBackend(16, 1<<20, "latest")
+	resolveHeight := func(int64) (int64, error) { return 100, nil }
+	handler := compressionMiddleware(CompressionConfig{MinSize: 1024, ContentTypes: []string{"application/json"}})(
+		cacheMiddleware(cache, NewCacheBackend(16, 1<<20, "ttl"), NewCacheBackend(16, 1<<20, "archival"), CachePolicies{"/binary": {Kind: CachePolicyNoStore}}, resolveHeight)(
+			http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				queried++
+				switch request.URL.Path {
+				case "/small":
+					_, _ = writer.Write([]byte("{}"))
+				case "/binary":
+					writer.Header().Set("Content-Type", "application/octet-stream")
+					_, _ = writer.Write([]byte(large))
+				default:
+					_, _ = writer.Write([]byte(large[:512]))
+					_, _ = writer.Write([]byte(large[512:]))
+				}
+			}),
+		),
+	)
+	serve := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			request.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// responses large enough are compressed as the client accepts, with their headers and status as they are
+	res := serve("/cosmos/bank/v1beta1/balances/terra1a", "gzip, deflate")
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, CacheMiss, res.Header().Get(CacheHeader))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	reader, err := gzip.NewReader(res.Body)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+
+	// the cache holds them uncompressed, to be served compressed or not, as each client accepts
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a", "")
+	assert.Equal(t, CacheHit, res.Header().Get(CacheHeader))
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, res.Body.String())
+	res = serve("/cosmos/bank/v1beta1/balances/terra1a", "gzip;q=0.5, deflate")
+	assert.Equal(t, CacheHit, res.Header().Get(CacheHeader))
+	assert.Equal(t, "deflate", res.Header().Get("Content-Encoding"))
+	body, err = io.ReadAll(flate.NewReader(res.Body))
+	assert.Nil(t, err)
+	assert.Equal(t, large, string(body))
+	assert.Equal(t, 1, queried)
+
+	// compressed, their ETag is weakened, the bytes sent differing by encoding
+	etag := serve("/cosmos/bank/v1beta1/balances/terra1a", "").Header().Get("ETag")
+	assert.Equal(t, "W/"+etag, res.Header().Get("ETag"))
+
+	// small responses, and those of other content types, aren't
+	res = serve("/small", "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "{}", res.Body.String())
+	res = serve("/binary", "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, res.Body.String())
+
+	// nor are responses to clients refusing all encodings
+	res = serve("/cosmos/bank/v1beta1/balances/terra1b", "gzip;q=0, identity")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, res.Body.String())
+
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "deflate", negotiateEncoding("*;q=0.1, deflate"))
+	assert.Empty(t, negotiateEncoding("br"))
+}
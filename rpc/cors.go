@@ -0,0 +1,128 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/gorilla/mux"
+)
+
+// corsExposedHeaders are the response headers browsers let dapps read
+var corsExposedHeaders = strings.Join([]string{grpctypes.GRPCBlockHeightHeader, CacheHeader, CacheHeightHeader, "ETag", "Retry-After"}, ", ")
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed, "*" for any, or "https://*.example.com" for any subdomain
+	AllowedOrigins []string
+
+	// AllowedMethods are the methods allowed
+	AllowedMethods []string
+
+	// AllowedHeaders are the request headers allowed, "*" for any
+	AllowedHeaders []string
+
+	// MaxAge is how long browsers may cache a preflight response for
+	MaxAge time.Duration
+}
+
+// allowsOrigin tells whether origin is allowed, and the Access-Control-Allow-Origin it's answered with
+func (c CORSConfig) allowsOrigin(origin string) (string, bool) {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return origin, true
+			}
+		} else if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+func (c CORSConfig) allowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header == "" {
+			continue
+		}
+		allowed := false
+		for _, allowedHeader := range c.AllowedHeaders {
+			if allowedHeader == "*" || strings.EqualFold(allowedHeader, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func (c CORSConfig) allowsMethod(method string) bool {
+	for _, allowed := range c.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterCORS answers CORS preflights on router, of any path, and tells browsers which origins may read the
+// responses of any route, those registered later included, i.e. indexers'. Preflights are answered as they come in,
+// without going through the middlewares registered after, rate limiting and the cache among them; it's to be
+// registered before the other routes and middlewares for that.
+func RegisterCORS(router *mux.Router, cfg CORSConfig) {
+	// preflights of routes registered for other methods would be refused otherwise, the middleware never running
+	router.Methods("OPTIONS").HeadersRegexp("Access-Control-Request-Method", ".+").HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {})
+	router.Use(corsMiddleware(cfg))
+}
+
+func corsMiddleware(cfg CORSConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			origin := request.Header.Get("Origin")
+			preflight := request.Method == "OPTIONS" && request.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			allowOrigin, ok := cfg.allowsOrigin(origin)
+			if allowOrigin != "*" {
+				writer.Header().Add("Vary", "Origin")
+			}
+			if !ok {
+				// refused preflights are answered all the same, without the headers that would let the browser go on
+				if preflight {
+					writer.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(writer, request)
+				return
+			}
+			writer.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+
+			if !preflight {
+				writer.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			method, headers := request.Header.Get("Access-Control-Request-Method"), request.Header.Get("Access-Control-Request-Headers")
+			if cfg.allowsMethod(method) && cfg.allowsHeaders(headers) {
+				writer.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+				if headers != "" {
+					writer.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				writer.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
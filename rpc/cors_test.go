@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	router := mux.NewRouter()
+	RegisterCORS(router, CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.dapps.io"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "x-cosmos-block-height"},
+		MaxAge:         10 * time.Minute,
+	})
+	served := 0
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			served++
+			next.ServeHTTP(writer, request)
+		})
+	})
+
+	// routes registered after, i.e. indexers', are covered all the same
+	router.HandleFunc("/index/tx/by_height/{height}", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("{}"))
+	}).Methods("GET")
+
+	do := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/index/tx/by_height/1", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		for header, value := range headers {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// preflights are answered without going through the middlewares registered after
+	res := do("OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-cosmos-block-height"})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, "https://app.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", res.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "x-cosmos-block-height", res.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", res.Header().Get("Access-Control-Max-Age"))
+	assert.Zero(t, served)
+
+	// those of methods or headers that aren't allowed don't let the browser go on
+	res = do("OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Methods"))
+	res = do("OPTIONS", "https://app.example.com", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "authorization"})
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Headers"))
+
+	// responses tell allowed origins, wildcards included, that they may read them, and others nothing
+	res = do("GET", "https://swap.dapps.io", nil)
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "https://swap.dapps.io", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, res.Header().Get("Access-Control-Expose-Headers"), "x-cosmos-block-height")
+	res = do("GET", "https://evil.com", nil)
+	assert.Equal(t, 200, res.Code)
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Origin"))
+	res = do("OPTIONS", "https://dapps.io.evil.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Empty(t, res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 2, served)
+
+	// any origin, and any header
+	router = mux.NewRouter()
+	RegisterCORS(router, CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowedHeaders: []string{"*"}})
+	router.HandleFunc("/index/tx/by_height/{height}", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	res = do("OPTIONS", "https://anywhere.org", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-grpc-web"})
+	assert.Equal(t, "*", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "x-grpc-web", res.Header().Get("Access-Control-Allow-Headers"))
+}
@@ -0,0 +1,124 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	EndpointGETDebugPprof   = "/debug/pprof/"
+	EndpointGETDebugRuntime = "/debug/runtime"
+)
+
+// RuntimeStats is the response of /debug/runtime
+type RuntimeStats struct {
+	Goroutines int              `json:"goroutines"`
+	Memory     RuntimeMemory    `json:"memory"`
+	GC         RuntimeGC        `json:"gc"`
+	Wasm       RuntimeWasmCache `json:"wasm"`
+}
+
+type RuntimeMemory struct {
+	HeapAlloc   uint64 `json:"heap_alloc_bytes"`
+	HeapInuse   uint64 `json:"heap_inuse_bytes"`
+	HeapObjects uint64 `json:"heap_objects"`
+	StackInuse  uint64 `json:"stack_inuse_bytes"`
+	Sys         uint64 `json:"sys_bytes"`
+}
+
+type RuntimeGC struct {
+	NumGC      uint32    `json:"num_gc"`
+	LastGC     time.Time `json:"last_gc"`
+	PauseTotal float64   `json:"pause_total_ms"`
+	LastPause  float64   `json:"last_pause_ms"`
+	NextGC     uint64    `json:"next_gc_bytes"`
+	CPUFrac    float64   `json:"cpu_fraction"`
+}
+
+// RuntimeWasmCache is the contract cache of the wasm vm. Its actual size is only known if the app reports it, i.e.
+// terra's with telemetry.enabled in app.toml, else only its limit is.
+type RuntimeWasmCache struct {
+	MemoryCacheLimit uint64  `json:"memory_cache_limit_bytes"`
+	MemoryCacheSize  *uint64 `json:"memory_cache_bytes,omitempty"`
+	PinnedCacheSize  *uint64 `json:"pinned_cache_bytes,omitempty"`
+	MemoryCacheItems *uint64 `json:"memory_cache_elements,omitempty"`
+	PinnedCacheItems *uint64 `json:"pinned_cache_elements,omitempty"`
+}
+
+// RegisterDebugRoutes registers the pprof handlers under /debug/pprof/ (heap, goroutine, profile, trace, ...) and
+// /debug/runtime, reporting the go runtime's memory and gc stats, and the wasm cache, which is limited to
+// wasmCacheLimit bytes. These aren't meant to be public: profiling takes cpu, and tells a lot about the process.
+func RegisterDebugRoutes(router *mux.Router, wasmCacheLimit uint64) {
+	router.HandleFunc(EndpointGETDebugPprof+"cmdline", pprof.Cmdline).Methods("GET")
+	router.HandleFunc(EndpointGETDebugPprof+"profile", pprof.Profile).Methods("GET")
+	router.HandleFunc(EndpointGETDebugPprof+"symbol", pprof.Symbol).Methods("GET", "POST")
+	router.HandleFunc(EndpointGETDebugPprof+"trace", pprof.Trace).Methods("GET")
+	router.PathPrefix(EndpointGETDebugPprof).HandlerFunc(pprof.Index).Methods("GET")
+
+	router.HandleFunc(EndpointGETDebugRuntime, func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(readRuntimeStats(prometheus.DefaultGatherer, wasmCacheLimit))
+	}).Methods("GET")
+}
+
+func readRuntimeStats(gatherer prometheus.Gatherer, wasmCacheLimit uint64) RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := RuntimeStats{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: RuntimeMemory{
+			HeapAlloc:   mem.HeapAlloc,
+			HeapInuse:   mem.HeapInuse,
+			HeapObjects: mem.HeapObjects,
+			StackInuse:  mem.StackInuse,
+			Sys:         mem.Sys,
+		},
+		GC: RuntimeGC{
+			NumGC:      mem.NumGC,
+			PauseTotal: float64(mem.PauseTotalNs) / 1e6,
+			NextGC:     mem.NextGC,
+			CPUFrac:    mem.GCCPUFraction,
+		},
+		Wasm: RuntimeWasmCache{MemoryCacheLimit: wasmCacheLimit},
+	}
+	if mem.NumGC > 0 {
+		stats.GC.LastGC = time.Unix(0, int64(mem.LastGC)).UTC()
+		stats.GC.LastPause = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+	}
+
+	// the wasm vm is the app's own, and only reports its cache through the metrics it registers
+	families, _ := gatherer.Gather()
+	for _, family := range families {
+		var memory, pinned **uint64
+		switch family.GetName() {
+		case "wasmvm_cache_size_bytes":
+			memory, pinned = &stats.Wasm.MemoryCacheSize, &stats.Wasm.PinnedCacheSize
+		case "wasmvm_cache_elements_total":
+			memory, pinned = &stats.Wasm.MemoryCacheItems, &stats.Wasm.PinnedCacheItems
+		default:
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			value := uint64(metric.GetGauge().GetValue())
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "type" {
+					continue
+				}
+				switch label.GetValue() {
+				case "memory":
+					*memory = &value
+				case "pinned":
+					*pinned = &value
+				}
+			}
+		}
+	}
+	return stats
+}
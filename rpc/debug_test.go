@@ -0,0 +1,52 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	RegisterDebugRoutes(router, 100<<20)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	assert.Equal(t, 200, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "goroutine profile")
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/runtime", nil))
+	assert.Equal(t, 200, recorder.Code)
+	var stats RuntimeStats
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+	assert.Greater(t, stats.Goroutines, 0)
+	assert.Greater(t, stats.Memory.Sys, uint64(0))
+	assert.Equal(t, uint64(100<<20), stats.Wasm.MemoryCacheLimit)
+}
+
+func TestRuntimeStatsWasmCache(t *testing.T) {
+	// no metrics registered by the app, only the limit is known
+	stats := readRuntimeStats(prometheus.NewRegistry(), 100<<20)
+	assert.Nil(t, stats.Wasm.MemoryCacheSize)
+
+	registry := prometheus.NewRegistry()
+	size := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "wasmvm_cache_size_bytes"}, []string{"type"})
+	size.WithLabelValues("memory").Set(5 << 20)
+	size.WithLabelValues("pinned").Set(1 << 20)
+	elements := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "wasmvm_cache_elements_total"}, []string{"type"})
+	elements.WithLabelValues("memory").Set(12)
+	registry.MustRegister(size, elements)
+
+	stats = readRuntimeStats(registry, 100<<20)
+	if assert.NotNil(t, stats.Wasm.MemoryCacheSize) && assert.NotNil(t, stats.Wasm.PinnedCacheSize) && assert.NotNil(t, stats.Wasm.MemoryCacheItems) {
+		assert.Equal(t, uint64(5<<20), *stats.Wasm.MemoryCacheSize)
+		assert.Equal(t, uint64(1<<20), *stats.Wasm.PinnedCacheSize)
+		assert.Equal(t, uint64(12), *stats.Wasm.MemoryCacheItems)
+	}
+	assert.Nil(t, stats.Wasm.PinnedCacheItems)
+}
@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	sdkcodec "github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/server/config"
+	"github.com/cosmos/cosmos-sdk/server/grpc/gogoreflection"
+	reflection "github.com/cosmos/cosmos-sdk/server/grpc/reflection/v2alpha1"
+	"github.com/cosmos/cosmos-sdk/server/types"
+	simappparams "github.com/cosmos/cosmos-sdk/simapp/params"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"github.com/gorilla/mux"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/terra-money/mantlemint/db/hld"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ResolveHeightFunc resolves the height a query is to be served at, 0 being the latest; it fails for heights
+// above the latest, and with hld.ErrHeightPruned for those below the lowest retained
+type ResolveHeightFunc func(height int64) (int64, error)
+
+// GRPCConfig configures the grpc query server
+type GRPCConfig struct {
+	// Address is the address listened on, i.e. 0.0.0.0:9090
+	Address string
+}
+
+// NewGRPCServer serves the query services of app's GRPCQueryRouter over grpc, along with reflection. Queries are
+// relayed to client as abci queries, at the height of their x-cosmos-block-height metadata, as nodes serve them.
+// They're given up on past queryTimeout, unless 0, or the deadline of their client if sooner, and once their client
+// goes away.
+func NewGRPCServer(app App, client abcicli.Client, chainID string, codec simappparams.EncodingConfig, resolveHeight ResolveHeightFunc, queryTimeout time.Duration) (*grpc.Server, error) {
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(relayCodec{sdkcodec.NewProtoCodec(codec.InterfaceRegistry).GRPCCodec()}),
+		grpc.MaxSendMsgSize(config.DefaultGRPCMaxSendMsgSize),
+		grpc.MaxRecvMsgSize(config.DefaultGRPCMaxRecvMsgSize),
+	)
+
+	// the services registered on the router are collected, to be served by relaying rather than by the app
+	services := &serviceCollector{}
+	app.RegisterGRPCServer(services)
+	for _, desc := range services.descs {
+		server.RegisterService(relayServiceDesc(desc, client, resolveHeight, queryTimeout), nil)
+	}
+
+	err := reflection.Register(server, reflection.Config{
+		SigningModes: func() map[string]int32 {
+			modes := make(map[string]int32, len(codec.TxConfig.SignModeHandler().Modes()))
+			for _, m := range codec.TxConfig.SignModeHandler().Modes() {
+				modes[m.String()] = (int32)(m)
+			}
+			return modes
+		}(),
+		ChainID:           chainID,
+		SdkConfig:         sdk.GetConfig(),
+		InterfaceRegistry: codec.InterfaceRegistry,
+	})
+	if err != nil {
+		return nil, err
+	}
+	gogoreflection.Register(server)
+
+	return server, nil
+}
+
+// StartGRPC serves server at cfg.Address
+func StartGRPC(server *grpc.Server, cfg GRPCConfig) error {
+	listener, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return err
+	}
+
+	errCh := make(chan error)
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			errCh <- fmt.Errorf("[grpc] failed to serve: %w", err)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(types.ServerStartTime): // assume server started successfully
+		return nil
+	}
+}
+
+// RegisterGRPCWebRoute serves server over grpc-web, for browsers, along with the CORS preflights of grpc-web
+// requests; any origin and any header, i.e. x-cosmos-block-height, is allowed, as to the rest of the api
+func RegisterGRPCWebRoute(router *mux.Router, server *grpc.Server) {
+	wrapped := grpcweb.WrapServer(server, grpcweb.WithOriginFunc(func(string) bool { return true }))
+	router.MatcherFunc(func(request *http.Request, _ *mux.RouteMatch) bool {
+		return wrapped.IsGrpcWebRequest(request) || wrapped.IsAcceptableGrpcCorsRequest(request)
+	}).Handler(wrapped)
+}
+
+// serviceCollector collects the services registered on it, as a grpc server
+type serviceCollector struct {
+	descs []*grpc.ServiceDesc
+}
+
+func (c *serviceCollector) RegisterService(desc *grpc.ServiceDesc, _ interface{}) {
+	c.descs = append(c.descs, desc)
+}
+
+// relayedMessage is a request or a response relayed as is, encoded
+type relayedMessage []byte
+
+// relayCodec passes relayed messages through, encoding the others, i.e. those of reflection, with Codec
+type relayCodec struct {
+	encoding.Codec
+}
+
+func (c relayCodec) Marshal(v interface{}) ([]byte, error) {
+	if message, ok := v.(*relayedMessage); ok {
+		return *message, nil
+	}
+	return c.Codec.Marshal(v)
+}
+
+func (c relayCodec) Unmarshal(data []byte, v interface{}) error {
+	if message, ok := v.(*relayedMessage); ok {
+		*message = append(relayedMessage{}, data...)
+		return nil
+	}
+	return c.Codec.Unmarshal(data, v)
+}
+
+// relayServiceDesc is desc, its methods relaying requests to client
+func relayServiceDesc(desc *grpc.ServiceDesc, client abcicli.Client, resolveHeight ResolveHeightFunc, queryTimeout time.Duration) *grpc.ServiceDesc {
+	methods := make([]grpc.MethodDesc, len(desc.Methods))
+	for i, method := range desc.Methods {
+		fullMethod := fmt.Sprintf("/%s/%s", desc.ServiceName, method.MethodName)
+		methods[i] = grpc.MethodDesc{
+			MethodName: method.MethodName,
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var request relayedMessage
+				if err := dec(&request); err != nil {
+					return nil, err
+				}
+				if queryTimeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+					defer cancel()
+				}
+				return relayQuery(ctx, client, resolveHeight, fullMethod, request)
+			},
+		}
+	}
+
+	return &grpc.ServiceDesc{
+		ServiceName: desc.ServiceName,
+		HandlerType: (*interface{})(nil),
+		Methods:     methods,
+		Metadata:    desc.Metadata,
+	}
+}
+
+// relayQuery queries method with request through client, at the height asked for, which is sent back in the
+// response's metadata
+func relayQuery(ctx context.Context, client abcicli.Client, resolveHeight ResolveHeightFunc, method string, request relayedMessage) (*relayedMessage, error) {
+	var height int64
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if heights := md.Get(grpctypes.GRPCBlockHeightHeader); len(heights) == 1 {
+			var err error
+			if height, err = strconv.ParseInt(heights[0], 10, 64); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid height header %q: %v", grpctypes.GRPCBlockHeightHeader, err)
+			}
+		}
+	}
+	height, err := resolveHeight(height)
+	if errors.Is(err, hld.ErrHeightPruned) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	res, err := QuerySyncContext(ctx, client, abci.RequestQuery{Path: method, Data: request, Height: height})
+	if err != nil {
+		// queries turned away, or given up on, fail with their status
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !res.IsOK() {
+		return nil, queryStatus(*res)
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10)))
+	response := relayedMessage(res.Value)
+	return &response, nil
+}
+
+// queryStatus is the grpc status of a failed query, as the sdk's client tells it
+func queryStatus(res abci.ResponseQuery) error {
+	if res.Codespace != sdkerrors.RootCodespace {
+		return status.Error(codes.Unknown, res.Log)
+	}
+	switch res.Code {
+	case sdkerrors.ErrInvalidRequest.ABCICode():
+		return status.Error(codes.InvalidArgument, res.Log)
+	case sdkerrors.ErrUnauthorized.ABCICode():
+		return status.Error(codes.Unauthenticated, res.Log)
+	case sdkerrors.ErrKeyNotFound.ABCICode():
+		return status.Error(codes.NotFound, res.Log)
+	default:
+		return status.Error(codes.Unknown, res.Log)
+	}
+}
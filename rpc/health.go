@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+)
+
+var (
+	EndpointGETHealth      = "/health"
+	EndpointGETHealthLive  = "/health/live"
+	EndpointGETHealthReady = "/health/ready"
+)
+
+// ProbeResponse is the response of the liveness and readiness probes, with why they fail if they do
+type ProbeResponse struct {
+	OK     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RegisterHealthRoutes registers the health check, responding with the sync status, and the probes of orchestrators:
+// liveness, failing once checkLive does, i.e. the db can't be read anymore, and readiness, failing while queries
+// shouldn't be routed here, as the health check does, or once the last block was flushed more than
+// readyMaxSinceLastFlush ago. A halted chain is healthy and ready (stale but correct), unless ?allow_stale=false is given.
+func RegisterHealthRoutes(router *mux.Router, getSyncStatus func() blockFeeder.SyncStatus, checkLive func() error, readyMaxSinceLastFlush time.Duration) {
+	router.HandleFunc(EndpointGETHealth, func(writer http.ResponseWriter, request *http.Request) {
+		syncStatus := getSyncStatus()
+		writer.Header().Set("Content-Type", "application/json")
+		if syncStatus.Healthy(request.URL.Query().Get("allow_stale") != "false") {
+			writer.WriteHeader(http.StatusOK)
+		} else {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(writer).Encode(syncStatus)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointGETHealthLive, func(writer http.ResponseWriter, request *http.Request) {
+		var reason string
+		if err := checkLive(); err != nil {
+			reason = err.Error()
+		}
+		writeProbe(writer, reason)
+	}).Methods("GET")
+
+	router.HandleFunc(EndpointGETHealthReady, func(writer http.ResponseWriter, request *http.Request) {
+		writeProbe(writer, getSyncStatus().Unready(request.URL.Query().Get("allow_stale") != "false", readyMaxSinceLastFlush))
+	}).Methods("GET")
+}
+
+// isHealthRoute tells whether request is to a health route, which is never cached nor limited
+func isHealthRoute(request *http.Request) bool {
+	return request.URL.Path == EndpointGETHealth || strings.HasPrefix(request.URL.Path, EndpointGETHealth+"/")
+}
+
+func writeProbe(writer http.ResponseWriter, reason string) {
+	writer.Header().Set("Content-Type", "application/json")
+	if reason == "" {
+		writer.WriteHeader(http.StatusOK)
+	} else {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(writer).Encode(ProbeResponse{OK: reason == "", Reason: reason})
+}
@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	status := blockFeeder.SyncStatus{Synced: true, SyncedThreshold: 3, SinceLastFlush: 5}
+	var liveErr error
+	router := mux.NewRouter()
+	RegisterHealthRoutes(router, func() blockFeeder.SyncStatus { return status }, func() error { return liveErr }, time.Minute)
+	probe := func(path string) (int, ProbeResponse) {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		var res ProbeResponse
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+		return recorder.Code, res
+	}
+
+	code, res := probe("/health/live")
+	assert.Equal(t, 200, code)
+	assert.True(t, res.OK)
+	code, res = probe("/health/ready")
+	assert.Equal(t, 200, code)
+	assert.Empty(t, res.Reason)
+
+	// a node syncing is alive, not ready, and unhealthy all the same
+	status.Synced, status.Lag = false, 100
+	code, _ = probe("/health/live")
+	assert.Equal(t, 200, code)
+	code, res = probe("/health/ready")
+	assert.Equal(t, 503, code)
+	assert.False(t, res.OK)
+	assert.Equal(t, "not synced: 100 blocks behind, 3 allowed", res.Reason)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, 503, recorder.Code)
+
+	// one synced that hasn't flushed a block for too long isn't ready either
+	status.Synced, status.Lag, status.SinceLastFlush = true, 0, 120
+	code, res = probe("/health/ready")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, "last block flushed 120s ago, 1m0s allowed", res.Reason)
+
+	// one that can't read its db isn't alive
+	liveErr = errors.New("leveldb: closed")
+	code, res = probe("/health/live")
+	assert.Equal(t, 503, code)
+	assert.Equal(t, ProbeResponse{OK: false, Reason: "leveldb: closed"}, res)
+}
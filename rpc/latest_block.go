@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var EndpointGETLatestBlock = "/latest_block"
+
+// LatestBlock is the last block flushed, i.e. that queries at the latest height are served at, along with the
+// chain id of the genesis, for clients to tell which network they hit
+type LatestBlock struct {
+	ChainID string    `json:"chain_id"`
+	Height  int64     `json:"height"`
+	Time    time.Time `json:"time"`
+
+	// FlushedAt is when the block was flushed
+	FlushedAt time.Time `json:"-"`
+}
+
+// Staleness is how old the data served is by the wall clock, i.e. the time elapsed since the block's
+func (b LatestBlock) Staleness() time.Duration {
+	return time.Since(b.Time)
+}
+
+// LatestBlockResponse is the response of the latest block route, with the staleness in seconds
+type LatestBlockResponse struct {
+	LatestBlock
+	Staleness float64 `json:"staleness"`
+}
+
+// RegisterLatestBlockRoute registers a route responding with the latest block; it's never cached
+func RegisterLatestBlockRoute(router *mux.Router, getLatestBlock func() LatestBlock) {
+	router.HandleFunc(EndpointGETLatestBlock, func(writer http.ResponseWriter, request *http.Request) {
+		latest := getLatestBlock()
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(writer).Encode(LatestBlockResponse{LatestBlock: latest, Staleness: latest.Staleness().Seconds()})
+	}).Methods("GET")
+}
@@ -0,0 +1,158 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxMetricPrefixes bounds the prefixes cache metrics are labeled with, paths being chosen by clients
+const maxMetricPrefixes = 128
+
+var (
+	cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "cache_entries",
+		Help:      "Number of responses in a response cache: latest, ttl or archival.",
+	}, []string{"cache"})
+
+	cacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "cache_bytes",
+		Help:      "Bytes accounted for by the responses in a response cache (bodies and keys): latest, ttl or archival.",
+	}, []string{"cache"})
+
+	cacheHits = newCacheCounter("cache_hits_total", "Responses served off a response cache.")
+
+	cacheMisses = newCacheCounter("cache_misses_total", "Responses queried for lack of a cached one, including those shared with an identical query in flight.")
+
+	cacheBypasses = newCacheCounter("cache_bypasses_total", "Responses queried regardless of the cache, as asked for with X-Mantlemint-Cache: bypass.")
+
+	cacheStores = newCacheCounter("cache_stores_total", "Responses stored in a response cache.")
+
+	cacheEvictions = newCacheCounter("cache_evictions_total", "Responses evicted from a response cache, least recently used beyond its bounds, or expired.")
+
+	cacheInvalidations = newCacheCounter("cache_invalidations_total", "Responses dropped from a response cache as a block is flushed, or as the cache is flushed over /admin/cache/flush.")
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      "rate_limited_total",
+		Help:      "Requests turned away with 429 for being over a rate limit: client or global.",
+	}, []string{"limit", "prefix"})
+
+	queriesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "expensive_queries_in_flight",
+		Help:      "Weight of the expensive queries, i.e. smart queries, running at once, out of QUERY_MAX_CONCURRENT.",
+	})
+
+	queriesQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "expensive_queries_queued",
+		Help:      "Expensive queries waiting for others to complete.",
+	})
+
+	queriesRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      "expensive_queries_rejected_total",
+		Help:      "Expensive queries turned away, the queue being full or for having waited too long: full or timeout.",
+	}, []string{"reason"})
+
+	queryClientQueries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "mantlemint",
+		Name:      "query_client_queries",
+		Help:      "Queries a client of the query pool is running or holding, by client.",
+	}, []string{"client"})
+
+	queryClientBusySeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      "query_client_busy_seconds_total",
+		Help:      "Time a client of the query pool spent running queries, by client; its rate is the client's utilization.",
+	}, []string{"client"})
+
+	requestsAbandoned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      "requests_abandoned_total",
+		Help:      "Requests given up on before their query completed, past QUERY_TIMEOUT or their client gone: timeout or canceled.",
+	}, []string{"reason"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      "http_requests_total",
+		Help:      "Requests answered by the api server, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "mantlemint",
+		Name:      "http_request_seconds",
+		Help:      "Time taken to answer requests, by route.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route"})
+)
+
+func init() {
+	prometheus.MustRegister(cacheEntries, cacheBytes, cacheHits, cacheMisses, cacheBypasses, cacheStores, cacheEvictions, cacheInvalidations, rateLimited, queriesInFlight, queriesQueued, queriesRejected, queryClientQueries, queryClientBusySeconds, requestsAbandoned, httpRequests, httpRequestSeconds)
+}
+
+func newCacheCounter(name string, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "mantlemint",
+		Name:      name,
+		Help:      help,
+	}, []string{"cache", "prefix"})
+}
+
+var (
+	metricPrefixesMtx = new(sync.Mutex)
+	metricPrefixes    = map[string]struct{}{}
+)
+
+// metricPrefix is the prefix a request URI is labeled with: its first 3 path segments, i.e. /cosmos/bank/v1beta1,
+// short of those that look like parameters, numbers or addresses. Past maxMetricPrefixes of them, others are labeled
+// "other".
+func metricPrefix(uri string) string {
+	path, _, _ := strings.Cut(uri, "?")
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if len(segments) == 3 || segment == "" || len(segment) > 16 || strings.Trim(segment, "0123456789") == "" {
+			break
+		}
+		segments = append(segments, segment)
+	}
+	prefix := "/" + strings.Join(segments, "/")
+
+	metricPrefixesMtx.Lock()
+	defer metricPrefixesMtx.Unlock()
+	if _, ok := metricPrefixes[prefix]; !ok {
+		if len(metricPrefixes) >= maxMetricPrefixes {
+			return "other"
+		}
+		metricPrefixes[prefix] = struct{}{}
+	}
+	return prefix
+}
+
+// httpMetricsMiddleware counts requests and times them, by the route they matched: its path template, i.e.
+// /index/tx/by_height/{height}, or for routes matching all paths under a prefix, i.e. the grpc gateway's, the prefix of
+// the path as cache metrics are labeled with. Websocket connections are counted once closed.
+func httpMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route := metricPrefix(request.URL.Path)
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil && template != "" && template != "/" {
+				route = template
+			}
+		}
+
+		start := time.Now()
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+		httpRequests.WithLabelValues(route, request.Method, strconv.Itoa(recorder.status)).Inc()
+		httpRequestSeconds.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,222 @@
+package rpc
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrQueryOverloaded is the error of an expensive query turned away, the app being busy with others; as a grpc
+// status, the LCD responds it with 503
+var ErrQueryOverloaded = status.Error(codes.Unavailable, "too many expensive queries in flight, retry later")
+
+// expensiveQueries are the weights of the queries that go through a QueryLimiter, by abci query path: smart
+// queries, running contracts, and dumps of a contract's store, iterating all of it. Others, reading a key or a
+// page of the store, don't.
+var expensiveQueries = map[string]int64{
+	querySmartContractStatePath:                1,
+	"/cosmwasm.wasm.v1.Query/AllContractState": 1,
+}
+
+// QueryLimitConfig configures a QueryLimiter
+type QueryLimitConfig struct {
+	// MaxWeight is the weight of the expensive queries that may run at once, i.e. how many smart queries
+	MaxWeight int64
+
+	// MaxQueued is how many queries may wait for others to complete; more are turned away
+	MaxQueued int
+
+	// QueueTimeout is how long a query may wait before it's turned away; 0 turns away those that would wait
+	QueueTimeout time.Duration
+}
+
+// QueryLimiter bounds the expensive queries running at once with a weighted semaphore, for a burst of them not to
+// starve block injection of cpu. Queries beyond it wait their turn, first come first served, up to a timeout.
+type QueryLimiter struct {
+	cfg QueryLimitConfig
+
+	mtx     sync.Mutex
+	weight  int64
+	waiters list.List
+}
+
+type queryWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+func NewQueryLimiter(cfg QueryLimitConfig) *QueryLimiter {
+	return &QueryLimiter{cfg: cfg}
+}
+
+// acquire takes weight for a query, waiting for it up to cfg.QueueTimeout, or until ctx is done, the query given up on
+func (l *QueryLimiter) acquire(ctx context.Context, weight int64) error {
+	if weight > l.cfg.MaxWeight {
+		weight = l.cfg.MaxWeight
+	}
+
+	l.mtx.Lock()
+	if l.weight+weight <= l.cfg.MaxWeight && l.waiters.Len() == 0 {
+		l.weight += weight
+		l.mtx.Unlock()
+		queriesInFlight.Add(float64(weight))
+		return nil
+	}
+	if l.cfg.QueueTimeout == 0 || l.waiters.Len() >= l.cfg.MaxQueued {
+		l.mtx.Unlock()
+		queriesRejected.WithLabelValues("full").Inc()
+		return ErrQueryOverloaded
+	}
+	waiter := &queryWaiter{weight: weight, ready: make(chan struct{})}
+	elem := l.waiters.PushBack(waiter)
+	l.mtx.Unlock()
+	queriesQueued.Inc()
+	defer queriesQueued.Dec()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	err := ErrQueryOverloaded
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+		err = contextError(ctx.Err())
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	select {
+	case <-waiter.ready:
+		// its turn came as it timed out
+		if err != ErrQueryOverloaded {
+			// nobody is waiting for it any longer
+			l.weight -= waiter.weight
+			queriesInFlight.Sub(float64(waiter.weight))
+			l.notifyWaiters()
+			return err
+		}
+		return nil
+	default:
+	}
+	l.waiters.Remove(elem)
+	// the first waiting may have held up smaller ones behind it
+	l.notifyWaiters()
+	if err == ErrQueryOverloaded {
+		queriesRejected.WithLabelValues("timeout").Inc()
+	}
+	return err
+}
+
+// release gives back weight once a query completes, letting those waiting run
+func (l *QueryLimiter) release(weight int64) {
+	if weight > l.cfg.MaxWeight {
+		weight = l.cfg.MaxWeight
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.weight -= weight
+	queriesInFlight.Sub(float64(weight))
+	l.notifyWaiters()
+}
+
+// notifyWaiters lets the queries waiting run in order while they fit; l.mtx is held
+func (l *QueryLimiter) notifyWaiters() {
+	for {
+		front := l.waiters.Front()
+		if front == nil {
+			return
+		}
+		waiter := front.Value.(*queryWaiter)
+		if l.weight+waiter.weight > l.cfg.MaxWeight {
+			return
+		}
+		l.weight += waiter.weight
+		queriesInFlight.Add(float64(waiter.weight))
+		l.waiters.Remove(front)
+		close(waiter.ready)
+	}
+}
+
+// Client limits the expensive queries of client, others going through as they are
+func (l *QueryLimiter) Client(client abcicli.Client) abcicli.Client {
+	if l == nil {
+		return client
+	}
+	return &limitedClient{Client: client, limiter: l}
+}
+
+// Middleware tells LCD clients turned away when to retry; the 503s of LCD routes are those of ErrQueryOverloaded,
+// health checks aside
+func (l *QueryLimiter) Middleware(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(l.cfg.QueueTimeout.Seconds()) + 1)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if isHealthRoute(request) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		next.ServeHTTP(&retryAfterWriter{ResponseWriter: writer, retryAfter: retryAfter}, request)
+	})
+}
+
+type retryAfterWriter struct {
+	http.ResponseWriter
+	retryAfter string
+}
+
+func (w *retryAfterWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", w.retryAfter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *retryAfterWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *retryAfterWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer can't be hijacked")
+}
+
+type limitedClient struct {
+	abcicli.Client
+	limiter *QueryLimiter
+}
+
+func (c *limitedClient) QuerySync(request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	return c.querySyncContext(context.Background(), request)
+}
+
+// querySyncContext is QuerySync, a query waiting its turn dropping out once ctx is done, and passing ctx on to
+// the client otherwise
+func (c *limitedClient) querySyncContext(ctx context.Context, request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	weight := expensiveQueries[request.Path]
+	if weight != 0 {
+		if err := c.limiter.acquire(ctx, weight); err != nil {
+			return nil, err
+		}
+		defer c.limiter.release(weight)
+	}
+	if querier, ok := c.Client.(contextQuerier); ok {
+		return querier.querySyncContext(ctx, request)
+	}
+	return c.Client.QuerySync(request)
+}
@@ -0,0 +1,98 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// blockingClient holds smart queries until released, answering others right away
+type blockingClient struct {
+	abcicli.Client
+	release chan struct{}
+}
+
+func (c *blockingClient) QuerySync(request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	if request.Path == querySmartContractStatePath {
+		<-c.release
+	}
+	return &abci.ResponseQuery{}, nil
+}
+
+func TestQueryLimiter(t *testing.T) {
+	backend := &blockingClient{release: make(chan struct{})}
+	limiter := NewQueryLimiter(QueryLimitConfig{MaxWeight: 2, MaxQueued: 1, QueueTimeout: 100 * time.Millisecond})
+	client := limiter.Client(backend)
+	smart := abci.RequestQuery{Path: querySmartContractStatePath}
+
+	// two smart queries run at once
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.QuerySync(smart)
+			errs <- err
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		limiter.mtx.Lock()
+		defer limiter.mtx.Unlock()
+		return limiter.weight == 2 && limiter.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+
+	// cheap queries don't wait on them, while smart ones are turned away once the queue is full
+	_, err := client.QuerySync(abci.RequestQuery{Path: "/cosmos.bank.v1beta1.Query/Balance"})
+	assert.Nil(t, err)
+	_, err = client.QuerySync(smart)
+	assert.Equal(t, ErrQueryOverloaded, err)
+
+	// the one queued runs as soon as one completes
+	backend.release <- struct{}{}
+	backend.release <- struct{}{}
+	backend.release <- struct{}{}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Zero(t, limiter.weight)
+
+	// those queued too long are turned away
+	go func() { _, _ = client.QuerySync(smart) }()
+	go func() { _, _ = client.QuerySync(smart) }()
+	assert.Eventually(t, func() bool {
+		limiter.mtx.Lock()
+		defer limiter.mtx.Unlock()
+		return limiter.weight == 2
+	}, time.Second, time.Millisecond)
+	start := time.Now()
+	_, err = client.QuerySync(smart)
+	assert.Equal(t, ErrQueryOverloaded, err)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Zero(t, limiter.waiters.Len())
+	close(backend.release)
+}
+
+func TestQueryLimiterMiddleware(t *testing.T) {
+	limiter := NewQueryLimiter(QueryLimitConfig{MaxWeight: 1, QueueTimeout: 2 * time.Second})
+	handler := limiter.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", nil))
+	assert.Equal(t, "3", recorder.Header().Get("Retry-After"))
+
+	// health checks failing aren't to be retried
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health/ready", nil))
+	assert.Empty(t, recorder.Header().Get("Retry-After"))
+}
@@ -0,0 +1,102 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// QueryPool runs queries over a pool of query clients, each running one at a time, dispatching each query to the
+// client least busy, in turn among those as busy. Queries are read-only, branching off the committed multistore at
+// their height, so that clients share the app as the clients of a creator do.
+type QueryPool struct {
+	mtx     sync.Mutex
+	clients []*pooledClient
+	next    int
+}
+
+// pooledClient is a client of a QueryPool; busy, guarded by the pool's mutex, is how many queries it's running or
+// holding, and running is taken by the one it's running
+type pooledClient struct {
+	abcicli.Client
+	label   string
+	busy    int
+	running chan struct{}
+}
+
+// NewQueryPool runs queries over clients, labelled by their index in the pool's metrics
+func NewQueryPool(clients []abcicli.Client) *QueryPool {
+	pool := &QueryPool{clients: make([]*pooledClient, len(clients))}
+	for i, client := range clients {
+		pool.clients[i] = &pooledClient{Client: client, label: strconv.Itoa(i), running: make(chan struct{}, 1)}
+	}
+	return pool
+}
+
+// leastBusy takes the client least busy, the first after the one taken last among those as busy; p.mtx is held
+func (p *QueryPool) leastBusy() *pooledClient {
+	var chosen int
+	for i := 0; i < len(p.clients); i++ {
+		index := (p.next + i) % len(p.clients)
+		if i == 0 || p.clients[index].busy < p.clients[chosen].busy {
+			chosen = index
+		}
+	}
+	p.next = (chosen + 1) % len(p.clients)
+	return p.clients[chosen]
+}
+
+// query runs request over the client least busy, waiting for the query it's running if any, or giving up on it once
+// ctx is done
+func (p *QueryPool) query(ctx context.Context, request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	p.mtx.Lock()
+	client := p.leastBusy()
+	client.busy++
+	p.mtx.Unlock()
+	queryClientQueries.WithLabelValues(client.label).Inc()
+	defer func() {
+		p.mtx.Lock()
+		client.busy--
+		p.mtx.Unlock()
+		queryClientQueries.WithLabelValues(client.label).Dec()
+	}()
+
+	select {
+	case client.running <- struct{}{}:
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+	defer func() { <-client.running }()
+	start := time.Now()
+	defer func() { queryClientBusySeconds.WithLabelValues(client.label).Add(time.Since(start).Seconds()) }()
+	if querier, ok := client.Client.(contextQuerier); ok {
+		return querier.querySyncContext(ctx, request)
+	}
+	return client.Client.QuerySync(request)
+}
+
+// Client runs the queries made over client over the pool, the rest going over client
+func (p *QueryPool) Client(client abcicli.Client) abcicli.Client {
+	if p == nil {
+		return client
+	}
+	return &pooledQueryClient{Client: client, pool: p}
+}
+
+type pooledQueryClient struct {
+	abcicli.Client
+	pool *QueryPool
+}
+
+func (c *pooledQueryClient) QuerySync(request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	return c.pool.query(context.Background(), request)
+}
+
+// querySyncContext is QuerySync, a query waiting for a client dropping out once ctx is done
+func (c *pooledQueryClient) querySyncContext(ctx context.Context, request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	return c.pool.query(ctx, request)
+}
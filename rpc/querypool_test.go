@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+// countingClient holds queries until released, counting those running
+type countingClient struct {
+	abcicli.Client
+	release chan struct{}
+	running *int32
+}
+
+func (c countingClient) QuerySync(abci.RequestQuery) (*abci.ResponseQuery, error) {
+	atomic.AddInt32(c.running, 1)
+	defer atomic.AddInt32(c.running, -1)
+	<-c.release
+	return &abci.ResponseQuery{}, nil
+}
+
+func TestQueryPool(t *testing.T) {
+	release := make(chan struct{})
+	var running int32
+	pool := NewQueryPool([]abcicli.Client{
+		countingClient{release: release, running: &running},
+		countingClient{release: release, running: &running},
+	})
+	busy := func() []int {
+		pool.mtx.Lock()
+		defer pool.mtx.Unlock()
+		return []int{pool.clients[0].busy, pool.clients[1].busy}
+	}
+
+	// queries over any client of the pool are spread over it, each of its clients running one at a time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		client := pool.Client(&blockingClient{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.QuerySync(abci.RequestQuery{})
+		}()
+		assert.Eventually(t, func() bool {
+			b := busy()
+			return b[0]+b[1] == i+1
+		}, time.Second, time.Millisecond)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&running))
+	assert.ElementsMatch(t, []int{1, 2}, busy())
+	assert.Equal(t, float64(3), testutil.ToFloat64(queryClientQueries.WithLabelValues("0"))+testutil.ToFloat64(queryClientQueries.WithLabelValues("1")))
+
+	// the next goes to the client least busy
+	pool.mtx.Lock()
+	least := pool.leastBusy()
+	pool.mtx.Unlock()
+	assert.Equal(t, 1, least.busy)
+
+	// one waiting for a client drops out once given up on
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := QuerySyncContext(ctx, pool.Client(&blockingClient{}), abci.RequestQuery{})
+	assert.Equal(t, ErrQueryTimeout, err)
+
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+	}
+	wg.Wait()
+	assert.Equal(t, []int{0, 0}, busy())
+	assert.Greater(t, testutil.ToFloat64(queryClientBusySeconds.WithLabelValues("0")), float64(0))
+	assert.Greater(t, testutil.ToFloat64(queryClientBusySeconds.WithLabelValues("1")), float64(0))
+
+	// those as busy take queries in turn
+	pool.mtx.Lock()
+	first, second := pool.leastBusy(), pool.leastBusy()
+	pool.mtx.Unlock()
+	assert.NotEqual(t, first, second)
+}
+
+func TestQueryWithoutPool(t *testing.T) {
+	release := make(chan struct{})
+	var running int32
+	var pool *QueryPool
+	client := pool.Client(countingClient{release: release, running: &running})
+
+	// queries run right away, alongside one another
+	for i := 0; i < 3; i++ {
+		go func() { _, _ = client.QuerySync(abci.RequestQuery{}) }()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 3 }, time.Second, time.Millisecond)
+	close(release)
+}
@@ -0,0 +1,262 @@
+package rpc
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often buckets of clients that have been idle long enough to be full again are dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimit is a token bucket: RPS requests a second, with bursts of up to Burst
+type RateLimit struct {
+	RPS   float64
+	Burst int
+}
+
+// ParseRateLimit parses <rps>[:<burst>], the burst defaulting to rps rounded up
+func ParseRateLimit(limit string) (RateLimit, error) {
+	rpsParam, burstParam, hasBurst := strings.Cut(limit, ":")
+	rps, err := strconv.ParseFloat(rpsParam, 64)
+	if err != nil || rps <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: must be <requests per second>[:<burst>], both positive", limit)
+	}
+	burst := int(math.Ceil(rps))
+	if hasBurst {
+		if burst, err = strconv.Atoi(burstParam); err != nil || burst <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q: must be <requests per second>[:<burst>], both positive", limit)
+		}
+	}
+	return RateLimit{RPS: rps, Burst: burst}, nil
+}
+
+// RateLimits are the per client rate limits of routes, by path prefix
+type RateLimits map[string]RateLimit
+
+// ParseRateLimits parses a comma separated list of <path prefix>=<rps>[:<burst>], i.e.
+// "/cosmwasm/=5:10,/=50:100"
+func ParseRateLimits(list string) (RateLimits, error) {
+	limits := RateLimits{}
+	for _, rule := range strings.Split(list, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		prefix, limit, ok := strings.Cut(rule, "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid rate limit %q: must be <path prefix>=<rps>[:<burst>], the prefix starting with /", rule)
+		}
+		parsed, err := ParseRateLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[prefix] = parsed
+	}
+	return limits, nil
+}
+
+// For is the limit of the longest prefix of path, and that prefix, or false if none
+func (l RateLimits) For(path string) (string, RateLimit, bool) {
+	var longest string
+	var limit RateLimit
+	var found bool
+	for prefix, prefixLimit := range l {
+		if strings.HasPrefix(path, prefix) && (!found || len(prefix) > len(longest)) {
+			longest, limit, found = prefix, prefixLimit, true
+		}
+	}
+	return longest, limit, found
+}
+
+// ParseCIDRs parses CIDRs, or single IPs
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", cidr)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %v", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// RateLimitConfig configures the rate limiting middleware
+type RateLimitConfig struct {
+	// Global, if set, bounds the requests of all clients together
+	Global *RateLimit
+
+	// PerClient bounds the requests of each client ip, by path prefix; routes without a prefix aren't
+	PerClient RateLimits
+
+	// TrustedProxies are the proxies the client ip is read off X-Forwarded-For behind
+	TrustedProxies []*net.IPNet
+
+	// Exempt are the clients that aren't limited at all, i.e. internal consumers
+	Exempt []*net.IPNet
+}
+
+// tokenBucket holds up to limit.Burst tokens, refilled at limit.RPS a second
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{limit: limit, tokens: float64(limit.Burst)}
+}
+
+// take takes a token if there's one; otherwise tells how long until there is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.limit.RPS * float64(time.Second))
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.RPS)
+	b.last = now
+}
+
+// RateLimiter limits requests with token buckets, globally and per client ip and path prefix
+type RateLimiter struct {
+	cfg RateLimitConfig
+	now func() time.Time
+
+	mtx       sync.Mutex
+	global    *tokenBucket
+	clients   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{cfg: cfg, now: time.Now, clients: make(map[string]*tokenBucket)}
+	if cfg.Global != nil {
+		rl.global = newTokenBucket(*cfg.Global)
+	}
+	return rl
+}
+
+// Middleware responds 429 to requests over the limits, with Retry-After telling in how many seconds to retry.
+// Health and metrics routes, probes included, are never limited, for probes and scrapers not to be turned away.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if isHealthRoute(request) || request.URL.Path == "/metrics" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		if ok, retryAfter, limit := rl.allow(clientIP(request, rl.cfg.TrustedProxies), request.URL.Path); !ok {
+			rateLimited.WithLabelValues(limit, metricPrefix(request.URL.Path)).Inc()
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(writer, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// allow takes a token of the client's bucket for the path, if any, then of the global one; otherwise tells how long
+// until there is one, and which limit was hit, "client" or "global"
+func (rl *RateLimiter) allow(clientIP net.IP, path string) (bool, time.Duration, string) {
+	if clientIP != nil && containsIP(rl.cfg.Exempt, clientIP) {
+		return true, 0, ""
+	}
+
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	now := rl.now()
+	rl.sweep(now)
+
+	if prefix, limit, ok := rl.cfg.PerClient.For(path); ok {
+		key := clientIP.String() + " " + prefix
+		bucket, ok := rl.clients[key]
+		if !ok {
+			bucket = newTokenBucket(limit)
+			rl.clients[key] = bucket
+		}
+		if ok, retryAfter := bucket.take(now); !ok {
+			return false, retryAfter, "client"
+		}
+	}
+
+	if rl.global != nil {
+		if ok, retryAfter := rl.global.take(now); !ok {
+			return false, retryAfter, "global"
+		}
+	}
+	return true, 0, ""
+}
+
+// sweep drops the buckets that are full again, as good as new, for those of clients gone not to pile up; rl.mtx is
+// held
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+	for key, bucket := range rl.clients {
+		if bucket.refill(now); bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(rl.clients, key)
+		}
+	}
+}
+
+// clientIP is the ip the request comes from: its remote address, or behind trustedProxies, the last address of
+// X-Forwarded-For that isn't one of theirs
+func clientIP(request *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	// peers of the unix socket have no address; they're local, i.e. a sidecar, and trusted as proxies are
+	local := ip == nil && (host == "" || host == "@")
+	if !local && (ip == nil || !containsIP(trustedProxies, ip)) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		forwardedIP := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if forwardedIP == nil {
+			break
+		}
+		ip = forwardedIP
+		if !containsIP(trustedProxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	perClient, err := ParseRateLimits("/cosmwasm/=1:2,/=10")
+	assert.Nil(t, err)
+	trusted, err := ParseCIDRs([]string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	exempt, err := ParseCIDRs([]string{"192.168.1.7"})
+	assert.Nil(t, err)
+	global, err := ParseRateLimit("6")
+	assert.Nil(t, err)
+
+	now := time.Unix(0, 0)
+	rl := NewRateLimiter(RateLimitConfig{Global: &global, PerClient: perClient, TrustedProxies: trusted, Exempt: exempt})
+	rl.now = func() time.Time { return now }
+	handler := rl.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	get := func(path, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			request.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// clients get their burst of the longest prefix, then are told when to retry
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "1.2.3.4:1000", "").Code)
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "1.2.3.4:1000", "").Code)
+	limited := get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "1.2.3.4:1000", "")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+
+	// other prefixes and clients have their own budget; behind trusted proxies, the client is the one forwarded for
+	assert.Equal(t, 200, get("/cosmos/bank/v1beta1/supply", "1.2.3.4:1000", "").Code)
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "10.0.0.1:1000", "5.6.7.8, 10.0.0.2").Code)
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "10.0.0.1:1000", "5.6.7.8").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "10.0.0.1:1000", "5.6.7.8").Code)
+
+	// which untrusted clients can't pretend to be
+	assert.Equal(t, 200, get("/cosmos/bank/v1beta1/supply", "9.9.9.9:1000", "1.2.3.4").Code)
+
+	// all clients share the global budget, exempt clients and health checks aside
+	limited = get("/cosmos/bank/v1beta1/supply", "9.9.9.9:1000", "")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "192.168.1.7:1000", "").Code)
+	assert.Equal(t, 200, get("/health", "9.9.9.9:1000", "").Code)
+
+	// buckets refill over time, and those full again are dropped
+	now = now.Add(time.Second)
+	assert.Equal(t, 200, get("/cosmwasm/wasm/v1/contract/terra1a/smart/e30=", "1.2.3.4:1000", "").Code)
+	now = now.Add(time.Hour)
+	get("/cosmos/bank/v1beta1/supply", "1.2.3.4:1000", "")
+	assert.Len(t, rl.clients, 1)
+
+	// limits are validated
+	_, err = ParseRateLimits("/cosmwasm/=0")
+	assert.NotNil(t, err)
+	_, err = ParseRateLimits("cosmwasm=1")
+	assert.NotNil(t, err)
+	_, err = ParseCIDRs([]string{"10.0.0.0/33"})
+	assert.NotNil(t, err)
+}
@@ -1,38 +1,57 @@
 package rpc
 
 import (
+	gocontext "context"
+	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/cosmos/cosmos-sdk/baseapp"
 	"github.com/cosmos/cosmos-sdk/client"
 	"github.com/cosmos/cosmos-sdk/server/api"
 	"github.com/cosmos/cosmos-sdk/server/config"
 
 	"github.com/cosmos/cosmos-sdk/server/types"
+	simappparams "github.com/cosmos/cosmos-sdk/simapp/params"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	authtx "github.com/cosmos/cosmos-sdk/x/auth/tx"
 	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
 	tmlog "github.com/tendermint/tendermint/libs/log"
 	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	tmdb "github.com/tendermint/tm-db"
 	terra "github.com/terra-money/core/v2/app"
-	"github.com/terra-money/core/v2/app/params"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
 	mconfig "github.com/terra-money/mantlemint/config"
 	"github.com/terra-money/mantlemint/export"
 )
 
+// App is the app the api server serves
+type App interface {
+	types.Application
+	GRPCQueryRouter() *baseapp.GRPCQueryRouter
+}
+
 func StartRPC(
-	app *terra.TerraApp,
+	app App,
 	rpcclient rpcclient.Client,
 	chainId string,
-	codec params.EncodingConfig,
+	codec simappparams.EncodingConfig,
+	simulate SimulateFunc,
 	invalidateTrigger chan int64,
 	registerCustomRoutes func(router *mux.Router),
-	getIsSynced func() bool,
+	getSyncStatus func() blockFeeder.SyncStatus,
+	checkLive func() error,
+	resolveHeight ResolveHeightFunc,
 	mantlemintConfig *mconfig.Config,
-) error {
+) (*Server, error) {
 	vp := viper.GetViper()
 	cfg, _ := config.GetConfig(vp)
 
@@ -40,7 +59,7 @@ func StartRPC(
 	context := client.
 		Context{}.
 		WithClient(rpcclient).
-		WithCodec(codec.Marshaler).
+		WithCodec(codec.Codec).
 		WithInterfaceRegistry(codec.InterfaceRegistry).
 		WithTxConfig(codec.TxConfig).
 		WithAccountRetriever(authtypes.AccountRetriever{}).
@@ -50,73 +69,133 @@ func StartRPC(
 
 	// create backends for response cache
 	// - cache: used for latest states without `height` parameter
-	// - archivalCache: used for historical states with `height` parameter; never flushed
-	cache := NewCacheBackend(16384, "latest")
-	archivalCache := NewCacheBackend(16384, "archival")
+	// - ttlCache: used for latest states of routes with a ttl policy; expiring rather than flushed
+	// - archivalCache: used for historical states with `height` parameter, and immutable routes; never flushed
+	// all are bounded in entries and in bytes, evicting the least recently used responses
+	policies, err := ParseCachePolicies(mantlemintConfig.CachePolicies)
+	if err != nil {
+		return nil, err
+	}
+	cache := NewCacheBackend(mantlemintConfig.CacheMaxEntries, int64(mantlemintConfig.CacheMaxBytes), "latest")
+	ttlCache := NewCacheBackend(mantlemintConfig.CacheMaxEntries, int64(mantlemintConfig.CacheMaxBytes), "ttl")
+	archivalCache := NewCacheBackend(mantlemintConfig.CacheMaxEntries, int64(mantlemintConfig.CacheMaxBytes), "archival")
+
+	rateLimiter, err := newRateLimiter(mantlemintConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// a certificate or client CA that can't be loaded fails the start, rather than leaving the LCD unreachable
+	certs, clientCAs, err := loadTLS(mantlemintConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// responses that don't go stale as blocks are flushed survive restarts, persisted on shutdown
+	var cacheStore *CacheStore
+	if mantlemintConfig.CachePersist {
+		cacheStore, err = openCacheStore(mantlemintConfig, policies, ttlCache, archivalCache)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// register cache invalidator
 	go func() {
 		for {
 			height := <-invalidateTrigger
-			fmt.Printf("[cache-middleware] purging cache at height %d\n", height)
+			fmt.Printf("[cache-middleware] invalidating cache below height %d\n", height)
 
 			cache.Metric()
 			archivalCache.Metric()
 
-			// only purge latest cache
-			cache.Purge()
+			// only invalidate latest cache; responses at a height are keyed by it, and never go stale
+			cache.Invalidate(height)
 		}
 	}()
 
 	// start new api server
 	apiSrv := api.New(context, tmlog.NewTMLogger(ioutil.Discard))
+	server := &Server{apiSrv: apiSrv, cacheStore: cacheStore, persistedCaches: []*CacheBackend{ttlCache, archivalCache}}
+
+	// requests in flight are drained on shutdown, and all requests are counted and timed
+	apiSrv.Router.Use(server.track, httpMetricsMiddleware)
+
+	// requests are logged as they're sent back, whichever way they're answered
+	if mantlemintConfig.EnableAccessLog {
+		trustedProxies, err := ParseCIDRs(mantlemintConfig.RateLimitTrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		apiSrv.Router.Use(NewAccessLogger(os.Stdout, AccessLogConfig{
+			Sample:         mantlemintConfig.AccessLogSample,
+			SlowThreshold:  mantlemintConfig.AccessLogSlowThreshold,
+			Exclude:        mantlemintConfig.AccessLogExclude,
+			TrustedProxies: trustedProxies,
+		}).Middleware)
+	}
+
+	// with a client CA, admin routes are only served to clients with a certificate of it
+	if clientCAs != nil {
+		apiSrv.Router.Use(requireClientCertMiddleware)
+	}
+
+	// CORS preflights are answered before anything else, rate limits included
+	if len(mantlemintConfig.CORSAllowedOrigins) != 0 {
+		RegisterCORS(apiSrv.Router, CORSConfig{
+			AllowedOrigins: mantlemintConfig.CORSAllowedOrigins,
+			AllowedMethods: mantlemintConfig.CORSAllowedMethods,
+			AllowedHeaders: mantlemintConfig.CORSAllowedHeaders,
+			MaxAge:         mantlemintConfig.CORSMaxAge,
+		})
+	}
+
+	// requests over the rate limits are turned away before they're served
+	if rateLimiter != nil {
+		apiSrv.Router.Use(rateLimiter.Middleware)
+	}
+
+	// responses are compressed as they're served, off the cache or not
+	if mantlemintConfig.EnableCompression {
+		apiSrv.Router.Use(compressionMiddleware(CompressionConfig{
+			MinSize:      mantlemintConfig.CompressionMinSize,
+			ContentTypes: mantlemintConfig.CompressionContentTypes,
+		}))
+	}
 
 	// register custom routes to default api server
 	registerCustomRoutes(apiSrv.Router)
 
-	// custom healthcheck endpoint
-	apiSrv.Router.Handle("/health", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		isSynced := getIsSynced()
-		if isSynced {
-			writer.WriteHeader(http.StatusOK)
-			writer.Write([]byte("OK"))
-		} else {
-			writer.WriteHeader(http.StatusServiceUnavailable)
-			writer.Write([]byte("NOK"))
-		}
-	})).Methods("GET")
+	// health check, and the liveness and readiness probes of orchestrators
+	RegisterHealthRoutes(apiSrv.Router, getSyncStatus, checkLive, mantlemintConfig.ReadyMaxSinceLastFlush)
+
+	// the caches can be inspected and flushed along with the other admin routes
+	if mantlemintConfig.EnableAdmin {
+		RegisterCacheAdminRoutes(apiSrv.Router, cache, ttlCache, archivalCache)
+	}
 
-	// register export routes
-	if mantlemintConfig.EnableExportModule {
-		export.RegisterRESTRoutes(apiSrv.Router, app)
+	// register export routes; they read terra's app state
+	if terraApp, ok := app.(*terra.TerraApp); ok && mantlemintConfig.EnableExportModule {
+		export.RegisterRESTRoutes(apiSrv.Router, terraApp)
 	}
 
 	// register all default GET routers...
 	app.RegisterAPIRoutes(apiSrv, cfg.API)
 	app.RegisterTendermintService(context)
-	errCh := make(chan error)
 
-	// caching middleware
-	apiSrv.Router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-			if request.URL.Path == "/health" {
-				next.ServeHTTP(writer, request)
-				return
-			}
+	// txs are simulated by simulate rather than by the app as is, for simulations not to see blocks half committed
+	authtx.RegisterTxService(app.GRPCQueryRouter(), context, (func([]byte) (sdk.GasInfo, *sdk.Result, error))(simulate), codec.InterfaceRegistry)
+	RegisterSimulateRoute(apiSrv.Router, codec.Codec, simulate)
+	errCh := make(chan error)
 
-			heightQuery := request.URL.Query().Get("height")
-			height, err := strconv.ParseInt(heightQuery, 10, 64)
+	// requests are given up on past QUERY_TIMEOUT, or once their client goes away; those waiting on an identical
+	// query in flight, sharing its response, are bounded too
+	if mantlemintConfig.QueryTimeout > 0 {
+		apiSrv.Router.Use(timeoutMiddleware(mantlemintConfig.QueryTimeout))
+	}
 
-			// don't use archival cache if height is 0 or error
-			if err == nil && height > 0 {
-				// GRPC query parses height from header
-				request.Header.Add("x-cosmos-block-height", heightQuery)
-				archivalCache.HandleCachedHTTP(writer, request, next)
-			} else {
-				cache.HandleCachedHTTP(writer, request, next)
-			}
-		})
-	})
+	// caching middleware
+	apiSrv.Router.Use(cacheMiddleware(cache, ttlCache, archivalCache, policies, resolveHeight))
 
 	// start api server in goroutine
 	go func() {
@@ -127,9 +206,163 @@ func StartRPC(
 
 	select {
 	case err := <-errCh:
-		return err
+		if cacheStore != nil {
+			_ = cacheStore.Close()
+		}
+		return nil, err
 	case <-time.After(types.ServerStartTime): // assume server started successfully
 	}
 
-	return nil
+	if certs != nil {
+		if err := server.serveTLS(cfg, mantlemintConfig.TLSAddress, certs, clientCAs, mantlemintConfig.TLSReloadInterval); err != nil {
+			_ = server.Shutdown(gocontext.Background())
+			return nil, err
+		}
+		fmt.Printf("[rpc/tls] serving the api server over tls at %s\n", mantlemintConfig.TLSAddress)
+	}
+	if mantlemintConfig.UnixSocketPath != "" {
+		if err := server.serveUnix(cfg, mantlemintConfig.UnixSocketPath, mantlemintConfig.UnixSocketMode); err != nil {
+			_ = server.Shutdown(gocontext.Background())
+			return nil, err
+		}
+		fmt.Printf("[rpc/unix] serving the api server at %s\n", mantlemintConfig.UnixSocketPath)
+	}
+
+	return server, nil
+}
+
+// loadTLS loads the certificate of the TLS listener, and its client CA if any; none without a TLS listener
+func loadTLS(mantlemintConfig *mconfig.Config) (*CertReloader, *x509.CertPool, error) {
+	if mantlemintConfig.TLSAddress == "" {
+		if mantlemintConfig.TLSClientCAFile != "" {
+			return nil, nil, fmt.Errorf("TLS_CLIENT_CA_FILE is set without TLS_ADDRESS")
+		}
+		return nil, nil, nil
+	}
+	if mantlemintConfig.TLSCertFile == "" || mantlemintConfig.TLSKeyFile == "" {
+		return nil, nil, fmt.Errorf("TLS_ADDRESS is set without TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	certs, err := NewCertReloader(mantlemintConfig.TLSCertFile, mantlemintConfig.TLSKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var clientCAs *x509.CertPool
+	if mantlemintConfig.TLSClientCAFile != "" {
+		if clientCAs, err = loadClientCAs(mantlemintConfig.TLSClientCAFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return certs, clientCAs, nil
+}
+
+// newRateLimiter is the rate limiter of the config, or nil if there are no limits
+func newRateLimiter(mantlemintConfig *mconfig.Config) (*RateLimiter, error) {
+	var cfg RateLimitConfig
+	if mantlemintConfig.RateLimitGlobal != "" {
+		global, err := ParseRateLimit(mantlemintConfig.RateLimitGlobal)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Global = &global
+	}
+	perClient, err := ParseRateLimits(mantlemintConfig.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+	cfg.PerClient = perClient
+	if cfg.Global == nil && len(cfg.PerClient) == 0 {
+		return nil, nil
+	}
+	if cfg.TrustedProxies, err = ParseCIDRs(mantlemintConfig.RateLimitTrustedProxies); err != nil {
+		return nil, err
+	}
+	if cfg.Exempt, err = ParseCIDRs(mantlemintConfig.RateLimitExempt); err != nil {
+		return nil, err
+	}
+	return NewRateLimiter(cfg), nil
+}
+
+// openCacheStore opens the db response caches are persisted to, in mantlemint's home, loading what's persisted into
+// caches unless it's to be ignored
+func openCacheStore(mantlemintConfig *mconfig.Config, policies CachePolicies, caches ...*CacheBackend) (*CacheStore, error) {
+	db, err := tmdb.NewGoLevelDB("response-cache", mantlemintConfig.Home)
+	if err != nil {
+		return nil, err
+	}
+	cacheStore := NewCacheStore(db, int64(mantlemintConfig.CachePersistMaxBytes))
+
+	if mantlemintConfig.CachePersistIgnore {
+		fmt.Println("[rpc] ignoring persisted cached responses")
+		err = cacheStore.Clear()
+	} else {
+		var loaded int
+		loaded, err = cacheStore.Load(policies, caches...)
+		fmt.Printf("[rpc] loaded %d persisted cached responses\n", loaded)
+	}
+	if err != nil {
+		_ = cacheStore.Close()
+		return nil, err
+	}
+	return cacheStore, nil
+}
+
+// cacheMiddleware serves queries off cache, or off archivalCache for those at a height, asked for with ?height or
+// the x-cosmos-block-height header as the gateway reads it. The height is resolved, responding 400 for heights that
+// aren't served, and sent back in the x-cosmos-block-height header, as nodes do. Routes are cached as policies tell:
+// not at all, in ttlCache for a while across blocks, or in archivalCache for good for immutable ones.
+func cacheMiddleware(cache, ttlCache, archivalCache *CacheBackend, policies CachePolicies, resolveHeight ResolveHeightFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			// health, latest block, metrics, admin, event and Tendermint rpc routes are never cached, nor are posts,
+			// i.e. simulations, whose responses depend on the body
+			if request.Method != "GET" || isHealthRoute(request) || request.URL.Path == EndpointGETLatestBlock || request.URL.Path == "/metrics" || strings.HasPrefix(request.URL.Path, "/admin/") || strings.HasPrefix(request.URL.Path, "/debug/") || strings.HasPrefix(request.URL.Path, "/events") || isTendermintRoute(request) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			heightParam := request.URL.Query().Get("height")
+			if heightParam == "" {
+				heightParam = request.Header.Get(grpctypes.GRPCBlockHeightHeader)
+			}
+			var height int64
+			if heightParam != "" {
+				var err error
+				if height, err = strconv.ParseInt(heightParam, 10, 64); err != nil {
+					http.Error(writer, fmt.Sprintf("invalid height %q: %v", heightParam, err), 400)
+					return
+				}
+			}
+			resolved, err := resolveHeight(height)
+			if err != nil {
+				http.Error(writer, err.Error(), 400)
+				return
+			}
+			writer.Header().Set(grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(resolved, 10))
+
+			// the latest height isn't pinned, its cache being purged as it moves on; the gateway reads the height
+			// off the header, and the cache off the url, whichever it was given with
+			if height == 0 {
+				request.Header.Del(grpctypes.GRPCBlockHeightHeader)
+			} else {
+				request.Header.Set(grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10))
+				query := request.URL.Query()
+				query.Set("height", strconv.FormatInt(height, 10))
+				request.URL.RawQuery = query.Encode()
+			}
+
+			policy := policies.For(request.URL.Path)
+			switch {
+			case policy.Kind == CachePolicyNoStore:
+				next.ServeHTTP(writer, request)
+			case policy.Kind == CachePolicyImmutable:
+				archivalCache.HandleCachedHTTPWithPolicy(writer, request, next, policy, resolved)
+			case height != 0:
+				archivalCache.HandleCachedHTTPWithPolicy(writer, request, next, CachePolicy{Kind: CachePolicyUntilNextBlock}, resolved)
+			case policy.Kind == CachePolicyTTL:
+				ttlCache.HandleCachedHTTPWithPolicy(writer, request, next, policy, resolved)
+			default:
+				cache.HandleCachedHTTPWithPolicy(writer, request, next, policy, resolved)
+			}
+		})
+	}
 }
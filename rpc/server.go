@@ -0,0 +1,119 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/server/api"
+	"github.com/cosmos/cosmos-sdk/server/config"
+	"github.com/gorilla/mux"
+	tmrpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+)
+
+// Server is the running api server, tracking requests in flight to drain them on shutdown
+type Server struct {
+	apiSrv   *api.Server
+	inFlight int64
+
+	// draining is set once shutting down, for clients to reconnect elsewhere rather than on connections kept alive
+	draining int32
+
+	// tlsListener, if any, serves the api server over TLS, with the certificate of certs
+	tlsListener net.Listener
+	certs       *CertReloader
+
+	// unixListener, if any, serves the api server on a unix socket
+	unixListener net.Listener
+
+	// cacheStore, if any, persists persistedCaches on shutdown
+	cacheStore      *CacheStore
+	persistedCaches []*CacheBackend
+}
+
+// newServeConfig is how listeners besides the plain one are served, as app.toml configures the plain one
+func newServeConfig(cfg config.Config) *tmrpcserver.Config {
+	tmCfg := tmrpcserver.DefaultConfig()
+	tmCfg.MaxOpenConnections = int(cfg.API.MaxOpenConnections)
+	tmCfg.ReadTimeout = time.Duration(cfg.API.RPCReadTimeout) * time.Second
+	tmCfg.WriteTimeout = time.Duration(cfg.API.RPCWriteTimeout) * time.Second
+	tmCfg.MaxBodyBytes = int64(cfg.API.RPCMaxBodyBytes)
+	return tmCfg
+}
+
+// track counts requests in flight
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+		if atomic.LoadInt32(&s.draining) == 1 {
+			writer.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Router is the router of the api server; routes may still be registered on it once started
+func (s *Server) Router() *mux.Router {
+	return s.apiSrv.Router
+}
+
+// Drain closes connections kept alive once their request is answered, ahead of Shutdown, while load balancers
+// stop routing requests here
+func (s *Server) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// Shutdown stops accepting connections, then waits for requests in flight to complete, or ctx to be done; the
+// response caches are persisted then, if they are to be
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.apiSrv.Close(); err != nil {
+		return err
+	}
+	if s.tlsListener != nil {
+		s.certs.Close()
+		if err := s.tlsListener.Close(); err != nil {
+			return err
+		}
+	}
+	// closing it removes the socket file as well
+	if s.unixListener != nil {
+		if err := s.unixListener.Close(); err != nil {
+			return err
+		}
+	}
+
+	drainErr := s.drain(ctx)
+	if s.cacheStore == nil {
+		return drainErr
+	}
+	saved, err := s.cacheStore.Save(s.persistedCaches...)
+	if err != nil {
+		err = fmt.Errorf("failed to persist response caches: %w", err)
+	} else {
+		fmt.Printf("[rpc] persisted %d cached responses\n", saved)
+	}
+	return errors.Join(drainErr, err, s.cacheStore.Close())
+}
+
+// drain waits for requests in flight to complete, or ctx to be done
+func (s *Server) drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		inFlight := atomic.LoadInt64(&s.inFlight)
+		if inFlight == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %w", inFlight, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/server/api"
+	"github.com/stretchr/testify/assert"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+)
+
+func TestServerDrain(t *testing.T) {
+	server := &Server{apiSrv: api.New(client.Context{}, tmlog.NewNopLogger())}
+	server.Router().Use(server.track)
+	server.Router().HandleFunc("/cosmos/base/tendermint/v1beta1/node_info", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("{}"))
+	})
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.Router().ServeHTTP(recorder, httptest.NewRequest("GET", "/cosmos/base/tendermint/v1beta1/node_info", nil))
+		return recorder
+	}
+
+	// connections are kept alive, until draining
+	assert.Empty(t, serve().Header().Get("Connection"))
+	server.Drain()
+	res := serve()
+	assert.Equal(t, 200, res.Code)
+	assert.Equal(t, "close", res.Header().Get("Connection"))
+}
@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+var EndpointPOSTSimulate = "/simulate"
+
+// SimulateFunc runs a tx without writing anything, as BaseApp.Simulate does
+type SimulateFunc func(txBytes []byte) (sdk.GasInfo, *sdk.Result, error)
+
+// SimulateResponse is the response of the simulate route: unlike cosmos.tx.v1beta1.Service/Simulate,
+// gas used is reported for txs that fail as well
+type SimulateResponse struct {
+	GasInfo sdk.GasInfo     `json:"gas_info"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// RegisterSimulateRoute registers a route simulating the tx it's posted, as a cosmos.tx.v1beta1.SimulateRequest:
+// {"tx_bytes": "<base64>"}, or {"tx": {...}}. A tx with signer infos but no signatures can be simulated.
+func RegisterSimulateRoute(router *mux.Router, cdc codec.Codec, simulate SimulateFunc) {
+	router.HandleFunc(EndpointPOSTSimulate, func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			http.Error(writer, err.Error(), 400)
+			return
+		}
+
+		var req txtypes.SimulateRequest
+		if err := cdc.UnmarshalJSON(body, &req); err != nil {
+			http.Error(writer, "invalid simulate request: "+err.Error(), 400)
+			return
+		}
+		txBytes := req.TxBytes
+		if txBytes == nil && req.Tx != nil {
+			if txBytes, err = proto.Marshal(req.Tx); err != nil {
+				http.Error(writer, "invalid tx: "+err.Error(), 400)
+				return
+			}
+		}
+		if txBytes == nil {
+			http.Error(writer, "tx_bytes or tx is required", 400)
+			return
+		}
+
+		gasInfo, result, simulateErr := simulate(txBytes)
+		response := SimulateResponse{GasInfo: gasInfo}
+		if simulateErr != nil {
+			response.Error = simulateErr.Error()
+		} else if response.Result, err = cdc.MarshalJSON(result); err != nil {
+			http.Error(writer, err.Error(), 500)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		if simulateErr != nil {
+			writer.WriteHeader(400)
+		}
+		_ = json.NewEncoder(writer).Encode(response)
+	}).Methods("POST")
+}
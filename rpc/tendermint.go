@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	rpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+)
+
+// tendermintRoutePrefix names the routes of Tendermint rpc methods, for the cache middleware to tell them apart
+const tendermintRoutePrefix = "tendermint/"
+
+// RegisterTendermintRoutes serves routes, Tendermint rpc methods by name, as a Tendermint node's rpc does, with its
+// json-rpc envelope: over uri at /<name>, arguments as query parameters, and over json-rpc posted to /.
+//
+// They're not cached by the cache middleware: they're cheap reads, and errors for heights not reached yet
+// mustn't outlive the height. Those given a height tell clients to cache their response, see rpcserver.Cacheable.
+func RegisterTendermintRoutes(router *mux.Router, routes map[string]*rpcserver.RPCFunc) {
+	serveMux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(serveMux, routes, tmlog.NewNopLogger())
+
+	for name := range routes {
+		router.Handle("/"+name, bareHexHashes(serveMux)).Methods("GET").Name(tendermintRoutePrefix + name)
+	}
+	router.Handle("/", serveMux).Methods("POST").Name(tendermintRoutePrefix + "jsonrpc")
+}
+
+// bareHexHashes takes hash arguments over uri in bare hex as if 0x-prefixed, Tendermint only telling hex apart
+// from the prefix, for hashes to be given either way
+func bareHexHashes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+		if hash := query.Get("hash"); hash != "" && !strings.HasPrefix(strings.ToLower(hash), "0x") {
+			if _, err := hex.DecodeString(hash); err == nil {
+				query.Set("hash", "0x"+hash)
+				request.URL.RawQuery = query.Encode()
+			}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// isTendermintRoute tells whether request is routed to a Tendermint rpc method
+func isTendermintRoute(request *http.Request) bool {
+	route := mux.CurrentRoute(request)
+	return route != nil && strings.HasPrefix(route.GetName(), tendermintRoutePrefix)
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is the status requests whose client went away are logged with, as nginx does; it's
+// never sent, there being nobody to send it to
+const StatusClientClosedRequest = 499
+
+var (
+	// ErrQueryTimeout is the error of a query given up on past its deadline; as a grpc status, the LCD responds it
+	// with 504
+	ErrQueryTimeout = status.Error(codes.DeadlineExceeded, "query timed out")
+
+	// ErrQueryCanceled is the error of a query given up on, its client gone
+	ErrQueryCanceled = status.Error(codes.Canceled, "query canceled, the client went away")
+)
+
+// contextError is the error of a query given up on as ctx is done with err
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+	return ErrQueryCanceled
+}
+
+// contextQuerier is a client that can give up on a query once ctx is done, i.e. one waiting its turn on a
+// QueryLimiter, or one running on stores aborting it; see NewAbortingClient
+type contextQuerier interface {
+	querySyncContext(ctx context.Context, request abci.RequestQuery) (*abci.ResponseQuery, error)
+}
+
+// QuerySyncContext queries client with request until ctx is done, then returning ErrQueryTimeout or
+// ErrQueryCanceled. A query that hasn't started by then never runs; a grpc query running over a client from
+// NewAbortingClient is aborted at its next store access. Others, which abci has no way to interrupt, complete in the
+// background, bounded by the app's gas limits, their response dropped.
+func QuerySyncContext(ctx context.Context, client abcicli.Client, request abci.RequestQuery) (*abci.ResponseQuery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, contextError(err)
+	}
+
+	type result struct {
+		res *abci.ResponseQuery
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		if querier, ok := client.(contextQuerier); ok {
+			res.res, res.err = querier.querySyncContext(ctx, request)
+		} else {
+			res.res, res.err = client.QuerySync(request)
+		}
+		done <- res
+	}()
+
+	select {
+	case res := <-done:
+		return res.res, res.err
+	case <-ctx.Done():
+		return nil, contextError(ctx.Err())
+	}
+}
+
+// timeoutMiddleware gives requests timeout to be answered, responding 504 past it, and gives up on those whose
+// client went away. Their context is done either way, for the queries they make with it to be given up on too; see
+// QuerySyncContext. Streams, i.e. websockets and events, and admin, debug, health and metrics routes aren't bounded,
+// nor is grpc-web, whose queries are bounded as those over grpc are.
+func timeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !isBoundedRoute(request) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(request.Context(), timeout)
+			defer cancel()
+
+			// the response is written once served in time, the handler being left to complete in the background
+			// otherwise, writing to a buffer nobody reads
+			buffered := &bufferedWriter{header: make(http.Header)}
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() { panicked <- recover() }()
+				next.ServeHTTP(buffered, request.WithContext(ctx))
+			}()
+
+			select {
+			case p := <-panicked:
+				if p != nil {
+					panic(p)
+				}
+				buffered.writeTo(writer)
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					requestsAbandoned.WithLabelValues("timeout").Inc()
+					writer.Header().Set("Content-Type", "application/json")
+					writer.WriteHeader(http.StatusGatewayTimeout)
+					_, _ = fmt.Fprintf(writer, `{"code":%d,"message":"query timed out after %s","details":[]}`, codes.DeadlineExceeded, timeout)
+				} else {
+					requestsAbandoned.WithLabelValues("canceled").Inc()
+					writer.WriteHeader(StatusClientClosedRequest)
+				}
+			}
+		})
+	}
+}
+
+// isBoundedRoute tells whether request is bounded by a timeout, i.e. isn't a stream or an operational route
+func isBoundedRoute(request *http.Request) bool {
+	path := request.URL.Path
+	return request.Header.Get("Upgrade") == "" &&
+		!strings.HasPrefix(request.Header.Get("Content-Type"), "application/grpc-web") &&
+		path != EndpointWebsocket &&
+		path != "/metrics" &&
+		!isHealthRoute(request) &&
+		!strings.HasPrefix(path, "/events") &&
+		!strings.HasPrefix(path, "/admin/") &&
+		!strings.HasPrefix(path, "/debug/")
+}
+
+// bufferedWriter holds a response until it's written to the client
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) writeTo(writer http.ResponseWriter) {
+	for key, values := range w.header {
+		writer.Header()[key] = values
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	writer.WriteHeader(w.status)
+	_, _ = writer.Write(w.body.Bytes())
+}
@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+)
+
+func TestQuerySyncContext(t *testing.T) {
+	backend := &blockingClient{release: make(chan struct{})}
+	limiter := NewQueryLimiter(QueryLimitConfig{MaxWeight: 1, MaxQueued: 1, QueueTimeout: time.Minute})
+	client := limiter.Client(backend)
+	smart := abci.RequestQuery{Path: querySmartContractStatePath}
+
+	// a query running is given up on past its deadline, completing in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := QuerySyncContext(ctx, client, smart)
+	assert.Equal(t, ErrQueryTimeout, err)
+	limiter.mtx.Lock()
+	assert.Equal(t, int64(1), limiter.weight)
+	limiter.mtx.Unlock()
+
+	// one waiting its turn drops out once its client goes away, never to run
+	ctx, cancel = context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := QuerySyncContext(ctx, client, smart)
+		errs <- err
+	}()
+	assert.Eventually(t, func() bool {
+		limiter.mtx.Lock()
+		defer limiter.mtx.Unlock()
+		return limiter.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, ErrQueryCanceled, <-errs)
+	assert.Eventually(t, func() bool {
+		limiter.mtx.Lock()
+		defer limiter.mtx.Unlock()
+		return limiter.waiters.Len() == 0
+	}, time.Second, time.Millisecond)
+
+	// the query in the background completes, giving its turn back
+	backend.release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		limiter.mtx.Lock()
+		defer limiter.mtx.Unlock()
+		return limiter.weight == 0
+	}, time.Second, time.Millisecond)
+
+	// given up on already, it isn't even sent
+	_, err = QuerySyncContext(ctx, client, abci.RequestQuery{Path: "/cosmos.bank.v1beta1.Query/Balance"})
+	assert.Equal(t, ErrQueryCanceled, err)
+	close(backend.release)
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := timeoutMiddleware(50 * time.Millisecond)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("slow") != "" {
+			<-request.Context().Done()
+			time.Sleep(100 * time.Millisecond)
+		}
+		writer.Header().Set("X-Served", "yes")
+		writer.WriteHeader(201)
+		_, _ = writer.Write([]byte("{}"))
+	}))
+
+	// served in time, the response is written as it was
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cosmos/bank/v1beta1/balances/terra1a", nil))
+	assert.Equal(t, 201, recorder.Code)
+	assert.Equal(t, "yes", recorder.Header().Get("X-Served"))
+	assert.Equal(t, "{}", recorder.Body.String())
+
+	// past the timeout, 504 without waiting for the handler
+	recorder = httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cosmos/bank/v1beta1/balances/terra1a?slow=1", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("X-Served"))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// given up on once the client goes away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/cosmos/bank/v1beta1/balances/terra1a?slow=1", nil).WithContext(ctx))
+	assert.Equal(t, StatusClientClosedRequest, recorder.Code)
+
+	// health checks aren't bounded
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health?slow=1", nil).WithContext(ctx))
+	assert.Equal(t, 201, recorder.Code)
+}
@@ -0,0 +1,185 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/server/config"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmrpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+)
+
+// CertReloader holds the certificate of the TLS listener, reloading it off its files as they change, for renewals
+// to be taken without a restart. Handshakes in progress keep the certificate they started with.
+type CertReloader struct {
+	certFile, keyFile string
+
+	mtx      sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+
+	stop chan struct{}
+}
+
+// NewCertReloader loads the certificate of certFile and keyFile, failing if it can't be
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, stop: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate off its files; the previous one is kept if they're invalid, i.e. half written
+func (r *CertReloader) Reload() error {
+	modTimes, err := r.readModTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert, r.modTimes = &cert, modTimes
+	return nil
+}
+
+// GetCertificate is the certificate of the latest handshake, for tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate on SIGHUP, and every interval if its files changed since it was loaded, until
+// Close is called
+func (r *CertReloader) Watch(interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(hup)
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-hup:
+				r.reload("SIGHUP received")
+			case <-tick:
+				if r.changed() {
+					r.reload("certificate files changed")
+				}
+			}
+		}
+	}()
+}
+
+func (r *CertReloader) reload(reason string) {
+	if err := r.Reload(); err != nil {
+		fmt.Printf("[rpc/tls] %s, but keeping the current certificate: %v\n", reason, err)
+		return
+	}
+	fmt.Printf("[rpc/tls] %s, certificate reloaded\n", reason)
+}
+
+// changed tells whether either file was modified since the certificate was loaded
+func (r *CertReloader) changed() bool {
+	modTimes, err := r.readModTimes()
+	if err != nil {
+		return false
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return modTimes != r.modTimes
+}
+
+// readModTimes are the modification times of the files, symlinks followed, as certbot renews through them
+func (r *CertReloader) readModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTimes, fmt.Errorf("failed to read tls certificate: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *CertReloader) Close() {
+	close(r.stop)
+}
+
+// serveTLS serves the api server over TLS at address, as its plain listener is, with the certificate of certs,
+// reloaded as it changes
+func (s *Server) serveTLS(cfg config.Config, address string, certs *CertReloader, clientCAs *x509.CertPool, reloadInterval time.Duration) error {
+	tmCfg := newServeConfig(cfg)
+	listener, err := tmrpcserver.Listen("tcp://"+address, tmCfg)
+	if err != nil {
+		return err
+	}
+	s.tlsListener, s.certs = tls.NewListener(listener, newTLSConfig(certs, clientCAs)), certs
+	certs.Watch(reloadInterval)
+
+	go func() {
+		if err := tmrpcserver.Serve(s.tlsListener, s.apiSrv.Router, tmlog.NewNopLogger(), tmCfg); err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Printf("[rpc/tls] failed to serve: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// newTLSConfig is the config of the TLS listener, asking for client certificates of clientCAs if any, for admin
+// routes to require them
+func newTLSConfig(certs *CertReloader, clientCAs *x509.CertPool) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	if clientCAs != nil {
+		cfg.ClientCAs, cfg.ClientAuth = clientCAs, tls.VerifyClientCertIfGiven
+	}
+	return cfg
+}
+
+// loadClientCAs reads the CA certificates of file, in PEM
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in tls client CA %s", file)
+	}
+	return pool, nil
+}
+
+// requireClientCertMiddleware refuses requests to admin routes but over TLS with a client certificate verified,
+// i.e. of the client CA; on the plain listener, they're refused altogether
+func requireClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if strings.HasPrefix(request.URL.Path, "/admin/") && (request.TLS == nil || len(request.TLS.VerifiedChains) == 0) {
+			http.Error(writer, "client certificate required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// issue writes a certificate for name, signed by parent (self-signed if nil), and its key to dir
+func issue(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid, template.KeyUsage = true, true, x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return cert, key
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	first, _ := issue(t, dir, "server", nil, nil)
+
+	certs, err := NewCertReloader(certFile, keyFile)
+	assert.Nil(t, err)
+	cert, _ := certs.GetCertificate(nil)
+	assert.Equal(t, first.Raw, cert.Certificate[0])
+	assert.False(t, certs.changed())
+
+	// renewed, it's reloaded once the files changed
+	renewed, _ := issue(t, dir, "server", nil, nil)
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, later, later))
+	assert.True(t, certs.changed())
+	assert.Nil(t, certs.Reload())
+	cert, _ = certs.GetCertificate(nil)
+	assert.Equal(t, renewed.Raw, cert.Certificate[0])
+	assert.False(t, certs.changed())
+
+	// half written, the current certificate is kept
+	assert.Nil(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	assert.NotNil(t, certs.Reload())
+	cert, _ = certs.GetCertificate(nil)
+	assert.Equal(t, renewed.Raw, cert.Certificate[0])
+}
+
+func TestTLSClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issue(t, dir, "ca", nil, nil)
+	issue(t, dir, "server", ca, caKey)
+	issue(t, dir, "client", ca, caKey)
+	issue(t, dir, "stranger", nil, nil)
+
+	certs, err := NewCertReloader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	assert.Nil(t, err)
+	clientCAs, err := loadClientCAs(filepath.Join(dir, "ca.crt"))
+	assert.Nil(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", newTLSConfig(certs, clientCAs))
+	assert.Nil(t, err)
+	server := &http.Server{Handler: requireClientCertMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("{}"))
+	}))}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	get := func(path, clientName string) int {
+		cfg := &tls.Config{RootCAs: roots}
+		if clientName != "" {
+			clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, clientName+".crt"), filepath.Join(dir, clientName+".key"))
+			assert.Nil(t, err)
+			cfg.Certificates = []tls.Certificate{clientCert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		res, err := client.Get("https://" + listener.Addr().String() + path)
+		if !assert.Nil(t, err) {
+			return 0
+		}
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	// queries are served to any client, admin routes only to those with a certificate of the CA
+	assert.Equal(t, 200, get("/cosmos/bank/v1beta1/balances/terra1a", ""))
+	assert.Equal(t, 403, get("/admin/cache", ""))
+	assert.Equal(t, 200, get("/admin/cache", "client"))
+
+	// a certificate of another CA isn't even sent, as the server only asks for those of its CA
+	assert.Equal(t, 403, get("/admin/cache", "stranger"))
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/server/config"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmrpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+)
+
+// serveUnix serves the api server on a unix socket at path, as its plain listener is, i.e. for a sidecar; the
+// socket file is given mode
+func (s *Server) serveUnix(cfg config.Config, path string, mode os.FileMode) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+
+	tmCfg := newServeConfig(cfg)
+	listener, err := tmrpcserver.Listen("unix://"+path, tmCfg)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to set the mode of unix socket %s: %w", path, err)
+	}
+	s.unixListener = listener
+
+	go func() {
+		if err := tmrpcserver.Serve(listener, s.apiSrv.Router, tmlog.NewNopLogger(), tmCfg); err != nil && !errors.Is(err, net.ErrClosed) {
+			fmt.Printf("[rpc/unix] failed to serve: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// removeStaleSocket removes the socket file a previous process left at path, i.e. killed before it could remove it.
+// A socket still listened on, or a file that isn't a socket, is left as it is, and fails the start.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a unix socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %s is in use", path)
+	}
+	fmt.Printf("[rpc/unix] removing stale unix socket %s\n", path)
+	return os.Remove(path)
+}
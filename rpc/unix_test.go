@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/server/api"
+	"github.com/cosmos/cosmos-sdk/server/config"
+	"github.com/stretchr/testify/assert"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+)
+
+func TestServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mantlemint.sock")
+	server := &Server{apiSrv: api.New(client.Context{}, tmlog.NewNopLogger())}
+	server.Router().HandleFunc("/client_ip", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(clientIP(request, nil).String()))
+	})
+
+	// a socket left by a process gone is removed, to be listened on again
+	stale, err := net.Listen("unix", path)
+	assert.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.Nil(t, stale.Close())
+
+	assert.Nil(t, server.serveUnix(*config.DefaultConfig(), path, 0o600))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// routes are served as on the plain listener, the client ip read off X-Forwarded-For of the local peer
+	httpClient := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}}}
+	request, _ := http.NewRequest("GET", "http://mantlemint/client_ip", nil)
+	request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	res, err := httpClient.Do(request)
+	if assert.Nil(t, err) {
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		assert.Equal(t, "1.2.3.4", string(body))
+	}
+
+	// one in use isn't taken over, nor is a file that isn't a socket
+	assert.NotNil(t, removeStaleSocket(path))
+	notSocket := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(notSocket, nil, 0o600))
+	assert.NotNil(t, removeStaleSocket(notSocket))
+
+	// closed, the socket file is removed
+	httpClient.CloseIdleConnections()
+	assert.Nil(t, server.unixListener.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,404 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+var EndpointWebsocket = "/websocket"
+
+const (
+	// clients are pinged every websocketPingPeriod, and dropped if nothing comes back within websocketReadWait,
+	// as Tendermint does
+	websocketPingPeriod = 27 * time.Second
+	websocketReadWait   = 30 * time.Second
+	websocketWriteWait  = 10 * time.Second
+
+	// maxWebsocketMessage bounds requests, as Tendermint's max_body_bytes does
+	maxWebsocketMessage = 1_000_000
+)
+
+// subscribableEvents are the values of tm.event published; see WebsocketHub.Publish
+var subscribableEvents = map[string]bool{
+	tendermint.EventNewBlock:       true,
+	tendermint.EventNewBlockHeader: true,
+	tendermint.EventTx:             true,
+}
+
+// ErrSlowClient closes the connection of a client that doesn't read events as fast as they're published
+var ErrSlowClient = errors.New("subscription was cancelled (reason: client is not pulling messages fast enough)")
+
+// WebsocketEvent is an event published to the subscriptions whose query matches Events, as Tendermint's event bus
+// publishes them: tm.event is the type of Data, along with the attributes of the events emitted
+type WebsocketEvent struct {
+	Data   tendermint.TMEventData
+	Events map[string][]string
+}
+
+// WebsocketConfig bounds the clients of a WebsocketHub
+type WebsocketConfig struct {
+	// MaxClients is how many clients may be connected at once
+	MaxClients int
+
+	// BufferSize is how many events may wait to be written to a client; a client having more is disconnected
+	BufferSize int
+
+	// MaxSubscriptionsPerClient is how many queries a client may be subscribed to at once
+	MaxSubscriptionsPerClient int
+}
+
+// WebsocketHub serves Tendermint's websocket: clients subscribe to events with Tendermint queries, over json-rpc,
+// and are pushed the events published matching them. Other json-rpc methods are served as if posted to /.
+type WebsocketHub struct {
+	config WebsocketConfig
+
+	mtx     sync.Mutex
+	clients map[*websocketClient]struct{}
+	closed  bool
+}
+
+// websocketClient is a connection, with its subscriptions by query; they're dropped along with it
+type websocketClient struct {
+	conn          *websocket.Conn
+	subscriptions map[string]*websocketSubscription
+
+	// responses waiting to be written; closing is closed along with closeErr set, for the connection to be closed
+	send      chan rpctypes.RPCResponse
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeErr  *rpctypes.RPCResponse
+}
+
+type websocketSubscription struct {
+	query   *query.Query
+	request rpctypes.RPCRequest
+}
+
+func NewWebsocketHub(config WebsocketConfig) *WebsocketHub {
+	return &WebsocketHub{
+		config:  config,
+		clients: make(map[*websocketClient]struct{}),
+	}
+}
+
+// RegisterWebsocketRoute serves hub's websocket; json-rpc methods other than subscriptions are served by router
+func RegisterWebsocketRoute(router *mux.Router, hub *WebsocketHub) {
+	upgrader := websocket.Upgrader{
+		// browsers are allowed in, as to the rest of the api
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+
+	router.HandleFunc(EndpointWebsocket, func(writer http.ResponseWriter, request *http.Request) {
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			return
+		}
+		client := &websocketClient{
+			conn:          conn,
+			subscriptions: make(map[string]*websocketSubscription),
+			send:          make(chan rpctypes.RPCResponse, hub.config.BufferSize),
+			closing:       make(chan struct{}),
+		}
+		if err := hub.add(client); err != nil {
+			_ = client.write(websocket.TextMessage, rpctypes.RPCServerError(rpctypes.JSONRPCIntID(-1), err))
+			_ = conn.Close()
+			return
+		}
+		defer hub.remove(client)
+
+		go client.readRoutine(request.Context(), hub, router)
+		client.writeRoutine()
+	}).Methods("GET").Name(tendermintRoutePrefix + "websocket")
+}
+
+func (hub *WebsocketHub) add(client *websocketClient) error {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	if hub.closed {
+		return errors.New("mantlemint is stopping")
+	}
+	if len(hub.clients) >= hub.config.MaxClients {
+		return fmt.Errorf("max clients %d reached", hub.config.MaxClients)
+	}
+	hub.clients[client] = struct{}{}
+	return nil
+}
+
+// remove drops client along with its subscriptions, once its connection is closed
+func (hub *WebsocketHub) remove(client *websocketClient) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	delete(hub.clients, client)
+}
+
+// Publish pushes events to the subscriptions matching them. Clients are never waited on: one whose buffer is
+// full is disconnected with an error, as Tendermint cancels the subscriptions of slow clients.
+func (hub *WebsocketHub) Publish(events ...WebsocketEvent) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	for client := range hub.clients {
+	events:
+		for _, event := range events {
+			for q, subscription := range client.subscriptions {
+				if matches, err := subscription.query.Matches(event.Events); err != nil || !matches {
+					continue
+				}
+				response := rpctypes.NewRPCSuccessResponse(subscription.request.ID, &coretypes.ResultEvent{
+					Query:  q,
+					Data:   event.Data,
+					Events: event.Events,
+				})
+				select {
+				case client.send <- response:
+				default:
+					client.close(rpctypes.RPCServerError(subscription.request.ID, ErrSlowClient))
+					break events
+				}
+			}
+		}
+	}
+}
+
+// Close disconnects all clients, and refuses new ones
+func (hub *WebsocketHub) Close() {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	hub.closed = true
+	for client := range hub.clients {
+		client.close(rpctypes.RPCServerError(rpctypes.JSONRPCIntID(-1), errors.New("mantlemint is stopping")))
+	}
+}
+
+// subscribe adds a subscription of client to the events matching the query of request
+func (hub *WebsocketHub) subscribe(client *websocketClient, request rpctypes.RPCRequest) (interface{}, error) {
+	q, err := parseSubscriptionQuery(request.Params)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := query.New(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+	if err := validateSubscriptionQuery(parsed); err != nil {
+		return nil, err
+	}
+
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	if _, ok := client.subscriptions[q]; ok {
+		return nil, errors.New("already subscribed")
+	}
+	if len(client.subscriptions) >= hub.config.MaxSubscriptionsPerClient {
+		return nil, fmt.Errorf("max subscriptions per client %d reached", hub.config.MaxSubscriptionsPerClient)
+	}
+	client.subscriptions[q] = &websocketSubscription{query: parsed, request: request}
+	return &coretypes.ResultSubscribe{}, nil
+}
+
+func (hub *WebsocketHub) unsubscribe(client *websocketClient, request rpctypes.RPCRequest) (interface{}, error) {
+	q, err := parseSubscriptionQuery(request.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	if _, ok := client.subscriptions[q]; !ok {
+		return nil, errors.New("subscription not found")
+	}
+	delete(client.subscriptions, q)
+	return &coretypes.ResultUnsubscribe{}, nil
+}
+
+func (hub *WebsocketHub) unsubscribeAll(client *websocketClient) (interface{}, error) {
+	hub.mtx.Lock()
+	defer hub.mtx.Unlock()
+
+	if len(client.subscriptions) == 0 {
+		return nil, errors.New("subscription not found")
+	}
+	client.subscriptions = make(map[string]*websocketSubscription)
+	return &coretypes.ResultUnsubscribe{}, nil
+}
+
+// parseSubscriptionQuery reads the query of (un)subscribe, given by name or by position
+func parseSubscriptionQuery(params json.RawMessage) (string, error) {
+	var byName struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(params, &byName); err == nil && byName.Query != "" {
+		return byName.Query, nil
+	}
+	var byPosition []string
+	if err := json.Unmarshal(params, &byPosition); err == nil && len(byPosition) == 1 && byPosition[0] != "" {
+		return byPosition[0], nil
+	}
+	return "", errors.New("query is required")
+}
+
+// validateSubscriptionQuery rejects queries for events that are never published, and those out of the subset of
+// Tendermint's grammar supported: conditions are equalities on event attributes, but for comparisons on tx.height
+func validateSubscriptionQuery(q *query.Query) error {
+	conditions, err := q.Conditions()
+	if err != nil {
+		return err
+	}
+	subscribable := false
+	for _, condition := range conditions {
+		switch {
+		case condition.CompositeKey == tendermint.TxHeightKey && condition.Op != query.OpContains && condition.Op != query.OpExists:
+		case condition.Op != query.OpEqual:
+			return fmt.Errorf("unsupported condition on %s: only equalities are, but for comparisons on %s", condition.CompositeKey, tendermint.TxHeightKey)
+		case condition.CompositeKey == tendermint.EventTypeKey && subscribableEvents[fmt.Sprint(condition.Operand)]:
+			subscribable = true
+		}
+	}
+	if !subscribable {
+		return fmt.Errorf("query must be on tm.event='%s', tm.event='%s' or tm.event='%s'", tendermint.EventNewBlock, tendermint.EventNewBlockHeader, tendermint.EventTx)
+	}
+	return nil
+}
+
+// close has the connection closed once response is written, if any; only the first call does
+func (client *websocketClient) close(response rpctypes.RPCResponse) {
+	client.closeOnce.Do(func() {
+		client.closeErr = &response
+		close(client.closing)
+	})
+}
+
+// readRoutine serves the requests of the client until the connection is closed. Requests are served one by one,
+// as Tendermint does, those not on subscriptions by router.
+func (client *websocketClient) readRoutine(ctx context.Context, hub *WebsocketHub, router http.Handler) {
+	defer client.close(rpctypes.RPCResponse{})
+
+	client.conn.SetReadLimit(maxWebsocketMessage)
+	_ = client.conn.SetReadDeadline(time.Now().Add(websocketReadWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(websocketReadWait))
+	})
+
+	for {
+		_, message, err := client.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = client.conn.SetReadDeadline(time.Now().Add(websocketReadWait))
+
+		var request rpctypes.RPCRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			client.respond(rpctypes.RPCParseError(fmt.Errorf("error unmarshaling request: %w", err)))
+			continue
+		}
+		// notifications aren't responded to
+		if request.ID == nil {
+			continue
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "subscribe":
+			result, err = hub.subscribe(client, request)
+		case "unsubscribe":
+			result, err = hub.unsubscribe(client, request)
+		case "unsubscribe_all":
+			result, err = hub.unsubscribeAll(client)
+		default:
+			client.respond(serveOverHTTP(ctx, router, request, message))
+			continue
+		}
+		if err != nil {
+			client.respond(rpctypes.RPCInternalError(request.ID, err))
+			continue
+		}
+		client.respond(rpctypes.NewRPCSuccessResponse(request.ID, result))
+	}
+}
+
+// serveOverHTTP serves a json-rpc request as if it was posted to /
+func serveOverHTTP(ctx context.Context, router http.Handler, request rpctypes.RPCRequest, message []byte) rpctypes.RPCResponse {
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", "/", bytes.NewReader(message))
+	if err != nil {
+		return rpctypes.RPCInternalError(request.ID, err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httpRequest)
+
+	var response rpctypes.RPCResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		return rpctypes.RPCInternalError(request.ID, fmt.Errorf("%d %s", recorder.Code, bytes.TrimSpace(recorder.Body.Bytes())))
+	}
+	return response
+}
+
+// respond queues response, waiting for room for it unless the connection is being closed
+func (client *websocketClient) respond(response rpctypes.RPCResponse) {
+	select {
+	case client.send <- response:
+	case <-client.closing:
+	}
+}
+
+// writeRoutine writes responses, and pings, until the connection is to be closed, which it closes
+func (client *websocketClient) writeRoutine() {
+	pingTicker := time.NewTicker(websocketPingPeriod)
+	defer pingTicker.Stop()
+	defer client.conn.Close()
+	// responses are given up on once the connection is lost
+	defer client.close(rpctypes.RPCResponse{})
+
+	for {
+		select {
+		case <-client.closing:
+			if client.closeErr.Error != nil {
+				_ = client.write(websocket.TextMessage, *client.closeErr)
+			}
+			_ = client.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case response := <-client.send:
+			if err := client.write(websocket.TextMessage, response); err != nil {
+				return
+			}
+		case <-pingTicker.C:
+			if err := client.write(websocket.PingMessage, []byte{}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// write writes message, a response or a control message's data, within websocketWriteWait
+func (client *websocketClient) write(messageType int, message interface{}) error {
+	if err := client.conn.SetWriteDeadline(time.Now().Add(websocketWriteWait)); err != nil {
+		return err
+	}
+	if data, ok := message.([]byte); ok {
+		return client.conn.WriteMessage(messageType, data)
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return client.conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+// websocketServer serves hub, along with a json-rpc method of its own posted to /
+func websocketServer(hub *WebsocketHub) *httptest.Server {
+	router := mux.NewRouter()
+	RegisterWebsocketRoute(router, hub)
+	router.HandleFunc("/", func(writer http.ResponseWriter, _ *http.Request) {
+		_, _ = writer.Write([]byte(`{"jsonrpc":"2.0","id":3,"result":{"node_info":{}}}`))
+	}).Methods("POST")
+	return httptest.NewServer(router)
+}
+
+// dialWebsocket connects to the websocket of server
+func dialWebsocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+EndpointWebsocket, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	return conn
+}
+
+// call sends a json-rpc request over conn, returning the next response
+func call(t *testing.T, conn *websocket.Conn, request string) rpctypes.RPCResponse {
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(request)))
+	var response rpctypes.RPCResponse
+	assert.Nil(t, conn.ReadJSON(&response))
+	return response
+}
+
+func newBlockEvent(height int64) WebsocketEvent {
+	return WebsocketEvent{
+		Data: tendermint.EventDataNewBlock{Block: &tendermint.Block{Header: tendermint.Header{Height: height}}},
+		Events: map[string][]string{
+			tendermint.EventTypeKey: {tendermint.EventNewBlock},
+			"transfer.recipient":    {"terra1a"},
+		},
+	}
+}
+
+func TestWebsocketSubscriptions(t *testing.T) {
+	hub := NewWebsocketHub(WebsocketConfig{MaxClients: 1, BufferSize: 10, MaxSubscriptionsPerClient: 5})
+	server := websocketServer(hub)
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+
+	response := call(t, conn, `{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"query":"tm.event='NewBlock'"}}`)
+	assert.Nil(t, response.Error)
+	assert.Equal(t, rpctypes.JSONRPCIntID(1), response.ID)
+
+	// events are pushed to the subscriptions matching them, with the id they subscribed with
+	hub.Publish(newBlockEvent(10), WebsocketEvent{
+		Data:   tendermint.EventDataNewBlockHeader{Header: tendermint.Header{Height: 10}},
+		Events: map[string][]string{tendermint.EventTypeKey: {tendermint.EventNewBlockHeader}},
+	})
+	var event rpctypes.RPCResponse
+	assert.Nil(t, conn.ReadJSON(&event))
+	assert.Equal(t, rpctypes.JSONRPCIntID(1), event.ID)
+	var result coretypes.ResultEvent
+	assert.Nil(t, tmjson.Unmarshal(event.Result, &result))
+	assert.Equal(t, "tm.event='NewBlock'", result.Query)
+	assert.Equal(t, int64(10), result.Data.(tendermint.EventDataNewBlock).Block.Height)
+	assert.Equal(t, []string{"terra1a"}, result.Events["transfer.recipient"])
+
+	// subscribing twice, or to events never published, fails
+	response = call(t, conn, `{"jsonrpc":"2.0","id":2,"method":"subscribe","params":["tm.event='NewBlock'"]}`)
+	assert.Contains(t, response.Error.Data, "already subscribed")
+	response = call(t, conn, `{"jsonrpc":"2.0","id":2,"method":"subscribe","params":{"query":"tm.event='Vote'"}}`)
+	assert.Contains(t, response.Error.Data, "query must be on tm.event='NewBlock'")
+	response = call(t, conn, `{"jsonrpc":"2.0","id":2,"method":"subscribe","params":{"query":"tm.event='Tx' AND transfer.recipient CONTAINS 'terra'"}}`)
+	assert.Contains(t, response.Error.Data, "unsupported condition on transfer.recipient")
+
+	// other methods are served as if posted
+	response = call(t, conn, `{"jsonrpc":"2.0","id":3,"method":"status"}`)
+	assert.Nil(t, response.Error)
+	assert.JSONEq(t, `{"node_info":{}}`, string(response.Result))
+
+	// only one client is allowed in
+	refused := dialWebsocket(t, server)
+	var refusal rpctypes.RPCResponse
+	assert.Nil(t, refused.ReadJSON(&refusal))
+	assert.Contains(t, refusal.Error.Data, "max clients 1 reached")
+	_ = refused.Close()
+
+	response = call(t, conn, `{"jsonrpc":"2.0","id":4,"method":"unsubscribe","params":{"query":"tm.event='NewBlock'"}}`)
+	assert.Nil(t, response.Error)
+	response = call(t, conn, `{"jsonrpc":"2.0","id":5,"method":"unsubscribe_all"}`)
+	assert.Contains(t, response.Error.Data, "subscription not found")
+}
+
+func TestWebsocketTxSubscriptions(t *testing.T) {
+	hub := NewWebsocketHub(WebsocketConfig{MaxClients: 1, BufferSize: 10, MaxSubscriptionsPerClient: 2})
+	server := websocketServer(hub)
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+
+	response := call(t, conn, `{"jsonrpc":"2.0","id":1,"method":"subscribe","params":{"query":"tm.event='Tx' AND transfer.recipient='terra1a' AND tx.height > 10"}}`)
+	assert.Nil(t, response.Error)
+	response = call(t, conn, `{"jsonrpc":"2.0","id":2,"method":"subscribe","params":{"query":"tm.event='Tx' AND tx.hash='AB'"}}`)
+	assert.Nil(t, response.Error)
+	response = call(t, conn, `{"jsonrpc":"2.0","id":3,"method":"subscribe","params":{"query":"tm.event='NewBlock'"}}`)
+	assert.Contains(t, response.Error.Data, "max subscriptions per client 2 reached")
+
+	// txs are pushed to the subscriptions whose every condition they match
+	txEvent := func(height int64, hash string, recipient string) WebsocketEvent {
+		return WebsocketEvent{
+			Data: tendermint.EventDataTx{TxResult: abci.TxResult{Height: height}},
+			Events: map[string][]string{
+				tendermint.EventTypeKey: {tendermint.EventTx},
+				tendermint.TxHashKey:    {hash},
+				tendermint.TxHeightKey:  {fmt.Sprint(height)},
+				"transfer.recipient":    {recipient},
+			},
+		}
+	}
+	hub.Publish(txEvent(10, "CD", "terra1a"), txEvent(11, "CD", "terra1b"), txEvent(11, "CD", "terra1a"), txEvent(12, "AB", "terra1b"))
+	for _, expected := range []struct {
+		id     rpctypes.JSONRPCIntID
+		height int64
+	}{{1, 11}, {2, 12}} {
+		var event rpctypes.RPCResponse
+		assert.Nil(t, conn.ReadJSON(&event))
+		assert.Equal(t, expected.id, event.ID)
+		var result coretypes.ResultEvent
+		assert.Nil(t, tmjson.Unmarshal(event.Result, &result))
+		assert.Equal(t, expected.height, result.Data.(tendermint.EventDataTx).Height)
+	}
+
+	// unsubscribing leaves room for another subscription
+	response = call(t, conn, `{"jsonrpc":"2.0","id":4,"method":"unsubscribe","params":["tm.event='Tx' AND tx.hash='AB'"]}`)
+	assert.Nil(t, response.Error)
+	response = call(t, conn, `{"jsonrpc":"2.0","id":5,"method":"subscribe","params":{"query":"tm.event='NewBlock'"}}`)
+	assert.Nil(t, response.Error)
+
+	// subscriptions are dropped along with their client
+	_ = conn.Close()
+	assert.Eventually(t, func() bool {
+		hub.mtx.Lock()
+		defer hub.mtx.Unlock()
+		return len(hub.clients) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWebsocketSlowClient(t *testing.T) {
+	hub := NewWebsocketHub(WebsocketConfig{MaxClients: 1, BufferSize: 2, MaxSubscriptionsPerClient: 5})
+	server := websocketServer(hub)
+	defer server.Close()
+	conn := dialWebsocket(t, server)
+	defer conn.Close()
+	response := call(t, conn, `{"jsonrpc":"2.0","id":"blocks","method":"subscribe","params":{"query":"tm.event='NewBlock'"}}`)
+	assert.Nil(t, response.Error)
+
+	// a client falling behind by more than its buffer is disconnected, with an error on its subscription; events
+	// are large enough for the socket's buffers to fill up while it's not reading
+	for height := int64(1); height <= 200; height++ {
+		event := newBlockEvent(height)
+		event.Events["transfer.recipient"] = []string{strings.Repeat("a", 100_000)}
+		hub.Publish(event)
+	}
+	var last rpctypes.RPCResponse
+	for {
+		var response rpctypes.RPCResponse
+		if err := conn.ReadJSON(&response); err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+			break
+		}
+		last = response
+	}
+	assert.Equal(t, rpctypes.JSONRPCStringID("blocks"), last.ID)
+	if assert.NotNil(t, last.Error) {
+		assert.Equal(t, ErrSlowClient.Error(), last.Error.Data)
+	}
+
+	// the client is dropped, leaving room for another
+	assert.Eventually(t, func() bool {
+		hub.mtx.Lock()
+		defer hub.mtx.Unlock()
+		return len(hub.clients) == 0
+	}, time.Second, 10*time.Millisecond)
+}
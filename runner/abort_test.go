@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	wasmkeeper "github.com/CosmWasm/wasmd/x/wasm/keeper"
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withHackatom instantiates hackatom, from wasmd's testdata, at genesis; its recurse query hashes work times, then
+// queries itself, depth times over
+func withHackatom(t *testing.T, genesisPath string) sdk.AccAddress {
+	code, err := os.ReadFile("testdata/hackatom.wasm.gzip")
+	assert.Nil(t, err)
+	genesisDoc, err := tendermint.GenesisDocFromFile(genesisPath)
+	assert.Nil(t, err)
+	var appState map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(genesisDoc.AppState, &appState))
+
+	codec := terra.MakeEncodingConfig().Marshaler
+	var wasmGenesis wasmtypes.GenesisState
+	codec.MustUnmarshalJSON(appState[wasmtypes.ModuleName], &wasmGenesis)
+	creator := sdk.AccAddress(accountKey.PubKey().Address()).String()
+	wasmGenesis.GenMsgs = []wasmtypes.GenesisState_GenMsgs{
+		{Sum: &wasmtypes.GenesisState_GenMsgs_StoreCode{StoreCode: &wasmtypes.MsgStoreCode{Sender: creator, WASMByteCode: code}}},
+		{Sum: &wasmtypes.GenesisState_GenMsgs_InstantiateContract{InstantiateContract: &wasmtypes.MsgInstantiateContract{
+			Sender: creator,
+			CodeID: 1,
+			Label:  "hackatom",
+			Msg:    []byte(`{"verifier":"` + creator + `","beneficiary":"` + creator + `"}`),
+		}}},
+	}
+	appState[wasmtypes.ModuleName] = codec.MustMarshalJSON(&wasmGenesis)
+	genesisDoc.AppState, err = json.Marshal(appState)
+	assert.Nil(t, err)
+	assert.Nil(t, genesisDoc.SaveAs(genesisPath))
+	return wasmkeeper.BuildContractAddressClassic(1, 1)
+}
+
+// captureLogs collects what's logged, and printed to stderr, until the returned func is called
+func captureLogs(t *testing.T) func() string {
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	stderr := os.Stderr
+	os.Stderr = writer
+	log.SetOutput(writer)
+
+	var captured bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(&captured, reader)
+	}()
+	return func() string {
+		os.Stderr = stderr
+		log.SetOutput(stderr)
+		_ = writer.Close()
+		wg.Wait()
+		return captured.String()
+	}
+}
+
+func TestRunnerSmartQueryAborted(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	contract := withHackatom(t, cfg.GenesisPath)
+	cfg.Wasm.ContractQueryGasLimit = 1 << 50
+	// over the query pool, whose clients abort queries as well
+	cfg.QueryClients = 2
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	client, err := r.newQueryClient()
+	assert.Nil(t, err)
+
+	smartQuery := func(ctx context.Context, depth, work int) error {
+		data, err := (&wasmtypes.QuerySmartContractStateRequest{
+			Address:   contract.String(),
+			QueryData: []byte(`{"recurse":{"depth":` + strconv.Itoa(depth) + `,"work":` + strconv.Itoa(work) + `}}`),
+		}).Marshal()
+		assert.Nil(t, err)
+		res, err := rpc.QuerySyncContext(ctx, client, abci.RequestQuery{Path: "/cosmwasm.wasm.v1.Query/SmartContractState", Data: data})
+		if err == nil && res.Code != 0 {
+			t.Fatalf("smart query failed: %s", res.Log)
+		}
+		return err
+	}
+
+	// a level of the query, worked through in full
+	const work = 200_000
+	started := time.Now()
+	assert.Nil(t, smartQuery(context.Background(), 0, work))
+	level := time.Since(started)
+
+	// given up on halfway through the first of many levels, the next one querying the contract is aborted, out of
+	// gas as far as the vm is concerned, which then neither logs a panic nor its stack
+	logs := captureLogs(t)
+	ctx, cancel := context.WithTimeout(context.Background(), level/2)
+	defer cancel()
+	err = smartQuery(ctx, 8, work)
+	// timed out, i.e. 504 on the LCD
+	assert.Equal(t, rpc.ErrQueryTimeout, err)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	time.Sleep(3 * level)
+	captured := logs()
+	assert.NotContains(t, captured, "Panic in Go callback")
+	assert.NotContains(t, captured, "goroutine ")
+	assert.Nil(t, r.indexer.Close())
+}
@@ -0,0 +1,191 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	servertypes "github.com/cosmos/cosmos-sdk/server/types"
+	simappparams "github.com/cosmos/cosmos-sdk/simapp/params"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	cosmosante "github.com/cosmos/cosmos-sdk/x/auth/ante"
+	upgradekeeper "github.com/cosmos/cosmos-sdk/x/upgrade/keeper"
+	"github.com/spf13/viper"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/core/v2/app/ante"
+	coreconfig "github.com/terra-money/core/v2/app/config"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+)
+
+// App is what mantlemint needs of the app it runs: serving abci and the api routes, as the chain's node does
+type App interface {
+	servertypes.Application
+
+	LastBlockHeight() int64
+	GRPCQueryRouter() *baseapp.GRPCQueryRouter
+	Logger() tmlog.Logger
+
+	// Simulate runs a tx on a branch of the check state, i.e. the last state committed, as BaseApp does
+	Simulate(txBytes []byte) (sdk.GasInfo, *sdk.Result, error)
+
+	// NewContext is a context on the check state if isCheckTx, and GetConsensusParams the consensus params of ctx
+	NewContext(isCheckTx bool, header tmproto.Header) sdk.Context
+	GetConsensusParams(ctx sdk.Context) *abci.ConsensusParams
+	ExportAppStateAndValidators(forZeroHeight bool, jailAllowedAddrs []string) (servertypes.ExportedApp, error)
+}
+
+// AppProvider creates the app of a chain for mantlemint to run, and sets up what goes along with it
+type AppProvider interface {
+	// NewApp creates the app on db. Options must be applied to the app's BaseApp, i.e. passed on to
+	// baseapp.NewBaseApp: that's how mantlemint mounts the app's stores on its own, with SetCMSOpt, and
+	// how syncing does without merkle trees, with FauxMerkleModeOpt
+	NewApp(logger tmlog.Logger, db tmdb.DB, traceStore io.Writer, options ...func(*baseapp.BaseApp)) App
+
+	// EncodingConfig is how the chain's txs and queries are encoded
+	EncodingConfig() simappparams.EncodingConfig
+
+	// ConfigureSDK sets up sdkConfig for the chain: bech32 prefixes, coin type, denoms, ...; it's sealed after
+	ConfigureSDK(sdkConfig *sdk.Config) error
+}
+
+// UpgradeKeeperProvider is implemented by providers of apps with x/upgrade, for UPGRADE_ALLOW_AT
+type UpgradeKeeperProvider interface {
+	UpgradeKeeper(app App) *upgradekeeper.Keeper
+}
+
+// AnteHandlerProvider is implemented by providers of apps with an ante handler, for txs to be checked as CheckTx
+// does, but on a branch of the check state rather than on the check state itself
+type AnteHandlerProvider interface {
+	AnteHandler(app App) (sdk.AnteHandler, error)
+}
+
+// SetCMSOpt mounts the app's stores on cms rather than on a store of its own
+func SetCMSOpt(cms *rootmulti.Store) func(*baseapp.BaseApp) {
+	return func(ba *baseapp.BaseApp) {
+		ba.SetCMS(cms)
+	}
+}
+
+// FauxMerkleModeOpt is passed in as an option to use a dbStoreAdapter instead of an IAVLStore for simulation speed.
+func FauxMerkleModeOpt(app *baseapp.BaseApp) {
+	app.SetFauxMerkleMode()
+}
+
+// appProviders are the providers a binary can run, by name; see RegisterAppProvider
+var appProviders = map[string]func(mantlemintConfig *config.Config) AppProvider{}
+
+// RegisterAppProvider makes the provider created by newProvider selectable as name, i.e. from an init() of the
+// binary of another chain; terra is always there
+func RegisterAppProvider(name string, newProvider func(mantlemintConfig *config.Config) AppProvider) {
+	if _, ok := appProviders[name]; ok {
+		panic(fmt.Errorf("app provider %s is registered twice", name))
+	}
+	appProviders[name] = newProvider
+}
+
+// LookupAppProvider creates the provider registered as name
+func LookupAppProvider(name string, mantlemintConfig *config.Config) (AppProvider, error) {
+	newProvider, ok := appProviders[name]
+	if !ok {
+		names := make([]string, 0, len(appProviders))
+		for registered := range appProviders {
+			names = append(names, registered)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no app provider %s, there's only %v", name, names)
+	}
+	return newProvider(mantlemintConfig), nil
+}
+
+func init() {
+	RegisterAppProvider("terra", func(mantlemintConfig *config.Config) AppProvider {
+		return NewTerraAppProvider(mantlemintConfig)
+	})
+}
+
+var (
+	_ UpgradeKeeperProvider = (*TerraAppProvider)(nil)
+	_ AnteHandlerProvider   = (*TerraAppProvider)(nil)
+)
+
+// TerraAppProvider provides terra core's app, configured by app.toml in MANTLEMINT_HOME/config,
+// and the wasm and upgrade settings of mantlemintConfig
+type TerraAppProvider struct {
+	config *config.Config
+}
+
+func NewTerraAppProvider(mantlemintConfig *config.Config) *TerraAppProvider {
+	return &TerraAppProvider{config: mantlemintConfig}
+}
+
+func (p *TerraAppProvider) NewApp(logger tmlog.Logger, db tmdb.DB, traceStore io.Writer, options ...func(*baseapp.BaseApp)) App {
+	vpr := viper.GetViper()
+	wasm := p.config.Wasm
+	return terra.NewTerraApp(
+		logger,
+		db,
+		traceStore,
+		true, // need this so KVStores are set
+		p.config.UpgradeSkipHeights,
+		p.config.Home,
+		0,
+		terra.MakeEncodingConfig(),
+		vpr,
+		&wasm,
+		options...,
+	)
+}
+
+func (p *TerraAppProvider) EncodingConfig() simappparams.EncodingConfig {
+	encodingConfig := terra.MakeEncodingConfig()
+	return simappparams.EncodingConfig{
+		InterfaceRegistry: encodingConfig.InterfaceRegistry,
+		Codec:             encodingConfig.Marshaler,
+		TxConfig:          encodingConfig.TxConfig,
+		Amino:             encodingConfig.Amino,
+	}
+}
+
+func (p *TerraAppProvider) ConfigureSDK(sdkConfig *sdk.Config) error {
+	sdkConfig.SetCoinType(coreconfig.CoinType)
+	accountPubKeyPrefix := coreconfig.AccountAddressPrefix + "pub"
+	validatorAddressPrefix := coreconfig.AccountAddressPrefix + "valoper"
+	validatorPubKeyPrefix := coreconfig.AccountAddressPrefix + "valoperpub"
+	consNodeAddressPrefix := coreconfig.AccountAddressPrefix + "valcons"
+	consNodePubKeyPrefix := coreconfig.AccountAddressPrefix + "valconspub"
+
+	sdkConfig.SetBech32PrefixForAccount(coreconfig.AccountAddressPrefix, accountPubKeyPrefix)
+	sdkConfig.SetBech32PrefixForValidator(validatorAddressPrefix, validatorPubKeyPrefix)
+	sdkConfig.SetBech32PrefixForConsensusNode(consNodeAddressPrefix, consNodePubKeyPrefix)
+	sdkConfig.SetAddressVerifier(wasmtypes.VerifyAddressLen())
+
+	return sdk.RegisterDenom(coreconfig.BondDenom, sdk.NewDecWithPrec(1, 6))
+}
+
+func (p *TerraAppProvider) UpgradeKeeper(app App) *upgradekeeper.Keeper {
+	return &app.(*terra.TerraApp).UpgradeKeeper
+}
+
+// AnteHandler is terra core's ante handler, as the app sets it up
+func (p *TerraAppProvider) AnteHandler(app App) (sdk.AnteHandler, error) {
+	terraApp := app.(*terra.TerraApp)
+	return ante.NewAnteHandler(ante.HandlerOptions{
+		HandlerOptions: cosmosante.HandlerOptions{
+			AccountKeeper:   terraApp.AccountKeeper,
+			BankKeeper:      terraApp.BankKeeper,
+			FeegrantKeeper:  terraApp.FeeGrantKeeper,
+			SignModeHandler: p.EncodingConfig().TxConfig.SignModeHandler(),
+			SigGasConsumer:  cosmosante.DefaultSigVerificationGasConsumer,
+		},
+		IBCkeeper:         terraApp.IBCKeeper,
+		TxCounterStoreKey: terraApp.GetKey(wasmtypes.StoreKey),
+		WasmConfig:        p.config.Wasm.ToWasmConfig(),
+	})
+}
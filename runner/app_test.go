@@ -0,0 +1,24 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/config"
+)
+
+func TestLookupAppProvider(t *testing.T) {
+	cfg := &config.Config{}
+	appProvider, err := LookupAppProvider("terra", cfg)
+	assert.Nil(t, err)
+	assert.IsType(t, &TerraAppProvider{}, appProvider)
+
+	_, err = LookupAppProvider("osmosis", cfg)
+	assert.EqualError(t, err, "no app provider osmosis, there's only [terra]")
+
+	assert.Panics(t, func() {
+		RegisterAppProvider("terra", func(mantlemintConfig *config.Config) AppProvider {
+			return NewTerraAppProvider(mantlemintConfig)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"encoding/hex"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/stretchr/testify/assert"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestRunnerCheckTx(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+
+	address := sdk.AccAddress(accountKey.PubKey().Address())
+	setWithdrawAddress := distrtypes.NewMsgSetWithdrawAddress(address, address)
+
+	// checking a tx writes nothing, so it's the same every time
+	for i := 0; i < 2; i++ {
+		res, err := r.CheckTx(signTx(t, r, 0, setWithdrawAddress))
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(0), res.Code, res.Log)
+		assert.Equal(t, int64(200_000), res.GasWanted)
+		assert.NotZero(t, res.GasUsed)
+	}
+	app := r.app.(*terra.TerraApp)
+	account := app.AccountKeeper.GetAccount(app.NewContext(true, tmproto.Header{}), address)
+	assert.Equal(t, uint64(0), account.GetSequence())
+
+	// signatures are verified against the account's sequence
+	res, err := r.CheckTx(signTx(t, r, 1, setWithdrawAddress))
+	assert.Nil(t, err)
+	assert.Equal(t, sdkerrors.ErrWrongSequence.ABCICode(), res.Code)
+
+	// msgs are validated, but not run
+	res, err = r.CheckTx(signTx(t, r, 0, distrtypes.NewMsgSetWithdrawAddress(address, nil)))
+	assert.Nil(t, err)
+	assert.Equal(t, sdkerrors.ErrInvalidAddress.ABCICode(), res.Code)
+
+	res, err = r.CheckTx([]byte("not a tx"))
+	assert.Nil(t, err)
+	assert.Equal(t, sdkerrors.ErrTxDecode.ABCICode(), res.Code)
+
+	// over rpc, as Tendermint serves it
+	server := tendermintServer(r)
+	defer server.Close()
+	var result coretypes.ResultCheckTx
+	assert.Nil(t, callTendermint(t, server, "/check_tx?tx=0x"+hex.EncodeToString(signTx(t, r, 0, setWithdrawAddress)), &result))
+	assert.Equal(t, uint32(0), result.Code, result.Log)
+	assert.NotZero(t, result.GasUsed)
+	assert.Nil(t, r.indexer.Close())
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/tendermint/tendermint/state"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+)
+
+// HeightsMismatchError is returned by New when the heights mantlemint's data is at disagree in a way that can't
+// be reconciled on startup
+type HeightsMismatchError struct {
+	// AppHeight is the last version the app committed, StateHeight the last block mantlemint recorded,
+	// and IndexHeight the last block indexed, 0 if unknown
+	AppHeight   int64
+	StateHeight int64
+	IndexHeight int64
+
+	// Recovery is how to recover
+	Recovery string
+}
+
+func (e *HeightsMismatchError) Error() string {
+	return fmt.Sprintf("app state is at height %d, mantlemint's last block at height %d, and the index at height %d; %s",
+		e.AppHeight, e.StateHeight, e.IndexHeight, e.Recovery)
+}
+
+// rollbackableDB can be unwound to a height, as heleveldb.Driver is
+type rollbackableDB interface {
+	Rollback(height int64) (int, error)
+}
+
+// reconcileHeights checks the last version the app committed against the last block mantlemint recorded, before
+// the app loads it. A version ahead of the block, i.e. left by a crash between the app committing a block and
+// mantlemint recording it, is unwound from ldb; a block ahead of the version is not to be fixed up blindly.
+func reconcileHeights(ldb hld.HeightLimitEnabledDB, db tmdb.DB, mantlemintConfig *config.Config) error {
+	appHeight := rootmulti.GetLatestVersion(db)
+	lastState, err := state.NewStore(db, state.StoreOptions{DiscardABCIResponses: false}).Load()
+	if err != nil {
+		return err
+	}
+	stateHeight := lastState.LastBlockHeight
+	if appHeight == stateHeight {
+		return nil
+	}
+
+	if rollbackable, ok := ldb.(rollbackableDB); ok && appHeight > stateHeight && stateHeight != 0 {
+		log.Printf("[v0.34.x/sync] app state is at height %d, ahead of mantlemint's last block at height %d; unwinding it, every key of the db is scanned...", appHeight, stateHeight)
+		unwound, err := rollbackable.Rollback(stateHeight)
+		if err != nil {
+			return fmt.Errorf("failed to unwind app state to height %d, start again to complete: %w", stateHeight, err)
+		}
+		log.Printf("[v0.34.x/sync] app state unwound to height %d, %d keys unwound", stateHeight, unwound)
+		return nil
+	}
+
+	mismatch := &HeightsMismatchError{AppHeight: appHeight, StateHeight: stateHeight}
+	mismatch.IndexHeight, _ = indexer.LoadWatermark(mantlemintConfig.IndexerDB, mantlemintConfig.Home)
+	if stateHeight > appHeight && appHeight != 0 {
+		mismatch.Recovery = fmt.Sprintf("run `mantlemint rollback %d` to roll back to height %d, then start again", stateHeight-appHeight, appHeight)
+	} else {
+		mismatch.Recovery = "the db can't be recovered from; sync again from scratch, or from a snapshot"
+	}
+	return mismatch
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/state"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+)
+
+func TestRunnerReconcileHeights(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	lastState := r.mm.GetCurrentState()
+	injectNextBlock(t, r, privKey)
+	assert.Nil(t, r.indexer.Close())
+
+	// writes mantlemint's state at height, as if it was the last block recorded
+	saveStateAt := func(height int64, lastState state.State) {
+		hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+		hldb.SetWriteHeight(height)
+		batched := safe_batch.NewSafeBatchDB(hldb)
+		batched.(safe_batch.SafeBatchDBCloser).Open()
+		assert.Nil(t, state.NewStore(batched, state.StoreOptions{}).Save(lastState))
+		_, err := batched.(safe_batch.SafeBatchDBCloser).Flush()
+		assert.Nil(t, err)
+		hldb.ClearWriteHeight()
+	}
+
+	// a crash right after the app committed a block, before mantlemint recorded it
+	saveStateAt(5_000_003, lastState)
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), r.Height())
+	assert.Equal(t, int64(5_000_002), r.app.LastBlockHeight())
+
+	// and the block is injected again from there
+	injectNextBlock(t, r, privKey)
+	assert.Equal(t, int64(5_000_003), r.app.LastBlockHeight())
+	lastState = r.mm.GetCurrentState()
+	assert.Nil(t, r.indexer.Close())
+
+	// mantlemint ahead of the app is refused, with how to recover
+	lastState.LastBlockHeight = 5_000_004
+	saveStateAt(5_000_004, lastState)
+	_, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	var mismatch *HeightsMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, int64(5_000_003), mismatch.AppHeight)
+	assert.Equal(t, int64(5_000_004), mismatch.StateHeight)
+	assert.Equal(t, int64(5_000_003), mismatch.IndexHeight)
+	assert.Contains(t, err.Error(), "mantlemint rollback 1")
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"fmt"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmstate "github.com/tendermint/tendermint/proto/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+// newDivergenceChecker checks app hashes against the headers of the rpc endpoints, fetched apart from the feed,
+// so that they're checked against a node even if blocks come from elsewhere. The subscription returned is
+// only used to fetch headers, and is to be closed along with the runner
+func newDivergenceChecker(mantlemintConfig *config.Config) (*mantlemint.DivergenceChecker, *blockFeeder.RPCSubscription, error) {
+	if ConfiguredStoreMode(mantlemintConfig) != StoreModeMerkle {
+		return nil, nil, fmt.Errorf("DIVERGENCE_CHECK_BLOCKS needs merkle stores, but syncing runs in faux merkle mode, which commits placeholder app hashes; set MERKLE_STORES")
+	}
+
+	upstream, err := newRpcFetcher(mantlemintConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checker := mantlemint.NewDivergenceChecker(
+		func(height int64) (*tendermint.Header, error) {
+			block, err := upstream.FetchBlock(height)
+			if err != nil {
+				return nil, err
+			}
+			return &block.Block.Header, nil
+		},
+		mantlemintConfig.DivergenceCheckBlocks,
+		mantlemintConfig.DivergenceCheckMinInterval,
+	)
+	return checker, upstream, nil
+}
+
+// newResultsChecker checks tx results against the /block_results of the rpc endpoints, fetched apart from the feed
+// as for newDivergenceChecker; the subscription returned is to be closed along with the runner
+func newResultsChecker(mantlemintConfig *config.Config) (*mantlemint.ResultsChecker, *blockFeeder.RPCSubscription, error) {
+	upstream, err := newRpcFetcher(mantlemintConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	checker := mantlemint.NewResultsChecker(
+		func(height int64) (*tmstate.ABCIResponses, string, error) {
+			results, source, err := upstream.FetchBlockResults(height)
+			if err != nil {
+				return nil, "", err
+			}
+			return toABCIResponses(results), source, nil
+		},
+		func(height int64) map[string]*tmstate.ABCIResponses {
+			responses := make(map[string]*tmstate.ABCIResponses)
+			for source, results := range upstream.FetchBlockResultsFromEach(height) {
+				responses[source] = toABCIResponses(results)
+			}
+			return responses
+		},
+		mantlemintConfig.ResultsCheckBlocks,
+	)
+	return checker, upstream, nil
+}
+
+func toABCIResponses(results *blockFeeder.BlockResults) *tmstate.ABCIResponses {
+	deliverTxs := make([]*abci.ResponseDeliverTx, len(results.TxsResults))
+	for i := range results.TxsResults {
+		deliverTxs[i] = &results.TxsResults[i]
+	}
+	return &tmstate.ABCIResponses{
+		DeliverTxs: deliverTxs,
+		BeginBlock: &abci.ResponseBeginBlock{Events: results.BeginBlockEvents},
+		EndBlock:   &abci.ResponseEndBlock{Events: results.EndBlockEvents},
+	}
+}
+
+// newRpcFetcher connects to the rpc endpoints to fetch blocks one at a time with FetchBlock, rather than subscribing
+func newRpcFetcher(mantlemintConfig *config.Config) (*blockFeeder.RPCSubscription, error) {
+	proxy, err := blockFeeder.NewProxyFunc(mantlemintConfig.FeedProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	return blockFeeder.NewRpcSubscription(mantlemintConfig.RPCEndpoints, &blockFeeder.RPCSubscriptionConfig{
+		Cooldown:        mantlemintConfig.RPCEndpointCooldown,
+		PrefetchWindow:  1,
+		PrefetchWorkers: 1,
+		RequestTimeout:  mantlemintConfig.RPCRequestTimeout,
+		MaxRetries:      mantlemintConfig.RPCMaxRetries,
+		RetryBackoff:    mantlemintConfig.RPCRetryBackoff,
+		Headers:         mantlemintConfig.FeedEndpointHeaders,
+		Proxy:           proxy,
+		Compression:     mantlemintConfig.RPCCompression,
+	})
+}
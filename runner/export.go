@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+)
+
+// ExportGenesis exports app state at EXPORT_HEIGHT (the latest if not set) as a genesis, like `terrad export`.
+// The app is built on a view of the db pinned at that height, so any height state is retained for can be exported,
+// in the store mode the db was committed to in; heights below the lowest retained fail with hld.ErrHeightPruned.
+func ExportGenesis(ldb hld.HeightLimitEnabledDB, hldb *hld.HeightLimitedDB, mantlemintConfig *config.Config, appProvider AppProvider) (*tendermint.GenesisDoc, error) {
+	if mantlemintConfig.ExportHeight != 0 {
+		if prunedHeight := hldb.PrunedHeight(); mantlemintConfig.ExportHeight < prunedHeight {
+			return nil, fmt.Errorf("%w: can't export height %d, the lowest height retained is %d", hld.ErrHeightPruned, mantlemintConfig.ExportHeight, prunedHeight)
+		}
+		hldb.SetReadHeight(mantlemintConfig.ExportHeight)
+	}
+
+	// a db committed to before the mode was recorded was in faux merkle mode
+	storeMode, err := LoadStoreMode(ldb)
+	if err != nil {
+		return nil, err
+	} else if storeMode == "" {
+		storeMode = StoreModeFauxMerkle
+	}
+
+	logger := tmlog.NewTMLogger(os.Stderr)
+	cms := rootmulti.NewStore(hldb, hldb, logger)
+	app := appProvider.NewApp(logger, hldb, nil, append(storeMode.Options(), SetCMSOpt(cms))...)
+
+	// state of a height is only there if the block at that height was committed
+	height := app.LastBlockHeight()
+	if height == 0 {
+		return nil, fmt.Errorf("no state to export, nothing was synced yet")
+	} else if mantlemintConfig.ExportHeight != 0 && height != mantlemintConfig.ExportHeight {
+		return nil, fmt.Errorf("no state at height %d; it's either before the first height synced, or not synced yet", mantlemintConfig.ExportHeight)
+	}
+
+	log.Printf("[v0.34.x/export] exporting app state at height %d...", height)
+	exported, err := app.ExportAppStateAndValidators(false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	genesisDoc, err := LoadGenesisDoc(mantlemintConfig.GenesisPath, mantlemintConfig.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	genesisDoc.AppState = exported.AppState
+	genesisDoc.Validators = exported.Validators
+	genesisDoc.InitialHeight = exported.Height
+	genesisDoc.ConsensusParams = &tmproto.ConsensusParams{
+		Block: tmproto.BlockParams{
+			MaxBytes:   exported.ConsensusParams.Block.MaxBytes,
+			MaxGas:     exported.ConsensusParams.Block.MaxGas,
+			TimeIotaMs: genesisDoc.ConsensusParams.Block.TimeIotaMs,
+		},
+		Evidence: tmproto.EvidenceParams{
+			MaxAgeNumBlocks: exported.ConsensusParams.Evidence.MaxAgeNumBlocks,
+			MaxAgeDuration:  exported.ConsensusParams.Evidence.MaxAgeDuration,
+			MaxBytes:        exported.ConsensusParams.Evidence.MaxBytes,
+		},
+		Validator: tmproto.ValidatorParams{
+			PubKeyTypes: exported.ConsensusParams.Validator.PubKeyTypes,
+		},
+	}
+	return genesisDoc, nil
+}
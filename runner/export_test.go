@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+)
+
+func TestExportGenesis(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		injectNextBlock(t, r, privKey)
+	}
+	assert.Equal(t, int64(5_000_004), r.Height())
+	assert.Nil(t, r.indexer.Close())
+	newHLDB := func() *hld.HeightLimitedDB {
+		return hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+	}
+
+	// a height before the latest is exported as the genesis of the block after it
+	cfg.ExportHeight = 5_000_002
+	genesisDoc, err := ExportGenesis(ldb, newHLDB(), cfg, NewTerraAppProvider(cfg))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_003), genesisDoc.InitialHeight)
+	assert.Equal(t, cfg.ChainID, genesisDoc.ChainID)
+	assert.Len(t, genesisDoc.Validators, 1)
+	assert.NotEmpty(t, genesisDoc.AppState)
+
+	// as is the latest, if no height is given
+	cfg.ExportHeight = 0
+	genesisDoc, err = ExportGenesis(ldb, newHLDB(), cfg, NewTerraAppProvider(cfg))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_005), genesisDoc.InitialHeight)
+
+	// heights not synced yet have no state
+	cfg.ExportHeight = 5_000_005
+	_, err = ExportGenesis(ldb, newHLDB(), cfg, NewTerraAppProvider(cfg))
+	assert.EqualError(t, err, "no state at height 5000005; it's either before the first height synced, or not synced yet")
+
+	// nor do those pruned
+	_, err = ldb.Prune(5_000_003, nil)
+	assert.Nil(t, err)
+	cfg.ExportHeight = 5_000_002
+	_, err = ExportGenesis(ldb, newHLDB(), cfg, NewTerraAppProvider(cfg))
+	assert.True(t, errors.Is(err, hld.ErrHeightPruned), err)
+	assert.EqualError(t, err, "height is pruned: can't export height 5000002, the lowest height retained is 5000003")
+}
@@ -0,0 +1,193 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clienttx "github.com/cosmos/cosmos-sdk/client/tx"
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	authsigning "github.com/cosmos/cosmos-sdk/x/auth/signing"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	slashingtypes "github.com/cosmos/cosmos-sdk/x/slashing/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/crypto"
+	"github.com/tendermint/tendermint/crypto/ed25519"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/core/v2/app/wasmconfig"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+// accountKey signs txs for an account at genesis, as the validator's key can't
+var accountKey = secp256k1.GenPrivKeyFromSecret([]byte("mantlemint"))
+
+// newExportedGenesisConfig configures a runner on a temporary home, with the genesis of a network forked off
+// an export at height, with a single validator whose key is returned, and the account of accountKey
+func newExportedGenesisConfig(t *testing.T, height int64) (*config.Config, crypto.PrivKey) {
+	home := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(home, "config"), 0o755))
+	cfg := &config.Config{
+		GenesisPath:        filepath.Join(home, "config", "genesis.json"),
+		Home:               home,
+		ChainID:            "mantlemint-fork-1",
+		IndexerDB:          "indexer",
+		Wasm:               *wasmconfig.DefaultConfig(),
+		EventStreamRetain:  10,
+		SlowBlockThreshold: time.Hour,
+	}
+
+	app := NewTerraAppProvider(cfg).NewApp(tmlog.NewNopLogger(), tmdb.NewMemDB(), nil).(*terra.TerraApp)
+	encodingConfig := terra.MakeEncodingConfig()
+
+	privKey := ed25519.GenPrivKey()
+	validator := tendermint.NewValidator(privKey.PubKey(), 1)
+	delegator := authtypes.NewBaseAccount(sdk.AccAddress(privKey.PubKey().Address()), nil, 0, 0)
+	appState := terra.SetupGenesisValSet(
+		tendermint.NewValidatorSet([]*tendermint.Validator{validator}),
+		[]authtypes.GenesisAccount{delegator, authtypes.NewBaseAccount(sdk.AccAddress(accountKey.PubKey().Address()), nil, 1, 0)},
+		nil,
+		app,
+		encodingConfig,
+	)
+
+	// the validator is bonded from genesis on, without the hook that starts its signing info
+	consAddress := sdk.ConsAddress(privKey.PubKey().Address())
+	slashingGenesis := slashingtypes.DefaultGenesisState()
+	slashingGenesis.SigningInfos = []slashingtypes.SigningInfo{{
+		Address:              consAddress.String(),
+		ValidatorSigningInfo: slashingtypes.NewValidatorSigningInfo(consAddress, height+1, 0, time.Unix(0, 0), false, 0),
+	}}
+	appState[slashingtypes.ModuleName] = app.AppCodec().MustMarshalJSON(slashingGenesis)
+	appStateJSON, err := json.Marshal(appState)
+	assert.Nil(t, err)
+
+	genesisDoc := &tendermint.GenesisDoc{
+		GenesisTime:     time.Now().UTC().Truncate(time.Second),
+		ChainID:         cfg.ChainID,
+		InitialHeight:   height + 1,
+		ConsensusParams: tendermint.DefaultConsensusParams(),
+		AppState:        appStateJSON,
+	}
+	assert.Nil(t, genesisDoc.SaveAs(cfg.GenesisPath))
+
+	return cfg, privKey
+}
+
+// injectNextBlock injects a block of txs, if any, after the last one, with the last one committed by the validator of
+// privKey
+func injectNextBlock(t *testing.T, r *Runner, privKey crypto.PrivKey, txs ...tendermint.Tx) {
+	lastState := r.mm.GetCurrentState()
+	height, lastCommit := lastState.InitialHeight, &tendermint.Commit{}
+	if lastState.LastBlockHeight != 0 {
+		height = lastState.LastBlockHeight + 1
+		vote := &tendermint.Vote{
+			Type:             tmproto.PrecommitType,
+			Height:           lastState.LastBlockHeight,
+			BlockID:          lastState.LastBlockID,
+			Timestamp:        lastState.LastBlockTime.Add(time.Second),
+			ValidatorAddress: privKey.PubKey().Address(),
+		}
+		voteProto := vote.ToProto()
+		assert.Nil(t, tendermint.NewMockPVWithParams(privKey, false, false).SignVote(lastState.ChainID, voteProto))
+		vote.Signature = voteProto.Signature
+		lastCommit = tendermint.NewCommit(vote.Height, 0, vote.BlockID, []tendermint.CommitSig{vote.CommitSig()})
+	}
+
+	block, _ := lastState.MakeBlock(height, txs, lastCommit, nil, lastState.Validators.Proposer.Address)
+	blocks := make(chan *blockFeeder.BlockResult, 1)
+	blocks <- &blockFeeder.BlockResult{
+		Block:   block,
+		BlockID: &tendermint.BlockID{Hash: block.Hash()},
+	}
+	close(blocks)
+
+	invalidated := make(chan int64, 1)
+	go func() {
+		invalidated <- <-r.cacheInvalidate
+	}()
+	r.inject(blocks)
+	assert.Equal(t, block.Height, <-invalidated)
+}
+
+// signTx signs a tx of msgs with accountKey, at sequence
+func signTx(t *testing.T, r *Runner, sequence uint64, msgs ...sdk.Msg) []byte {
+	txBuilder := r.codec.TxConfig.NewTxBuilder()
+	assert.Nil(t, txBuilder.SetMsgs(msgs...))
+	txBuilder.SetGasLimit(200_000)
+	signMode := r.codec.TxConfig.SignModeHandler().DefaultMode()
+	assert.Nil(t, txBuilder.SetSignatures(signing.SignatureV2{
+		PubKey:   accountKey.PubKey(),
+		Data:     &signing.SingleSignatureData{SignMode: signMode},
+		Sequence: sequence,
+	}))
+	signature, err := clienttx.SignWithPrivKey(signMode, authsigning.SignerData{
+		ChainID:       r.config.ChainID,
+		AccountNumber: 1,
+		Sequence:      sequence,
+	}, txBuilder, accountKey, r.codec.TxConfig, sequence)
+	assert.Nil(t, err)
+	assert.Nil(t, txBuilder.SetSignatures(signature))
+	txBytes, err := r.codec.TxConfig.TxEncoder()(txBuilder.GetTx())
+	assert.Nil(t, err)
+	return txBytes
+}
+
+func TestRunnerExportedGenesis(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+
+	// state of the export is the state at the height exported
+	assert.Equal(t, int64(5_000_000), r.Height())
+	assert.Equal(t, int64(5_000_000), r.mm.GetCurrentHeight())
+	genesisState, err := r.ldb.Get(5_000_000, []byte("stateKey"))
+	assert.Nil(t, err)
+	assert.NotNil(t, genesisState)
+
+	// the first block is at the initial height, as is the first version of the app
+	injectNextBlock(t, r, privKey)
+	assert.Equal(t, int64(5_000_001), r.Height())
+	assert.Equal(t, int64(5_000_001), r.app.LastBlockHeight())
+	checkpoint, err := blockFeeder.LoadCheckpoint(r.batched)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_001), checkpoint.Height)
+
+	// restarting resumes after the block, rather than from the export
+	assert.Nil(t, r.indexer.Close())
+	lastBlockTime := r.mm.GetCurrentState().LastBlockTime
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_001), r.Height())
+	assert.Equal(t, int64(5_000_001), r.app.LastBlockHeight())
+	latest := r.LatestBlock()
+	assert.False(t, latest.FlushedAt.IsZero())
+	assert.Equal(t, rpc.LatestBlock{ChainID: cfg.ChainID, Height: 5_000_001, Time: lastBlockTime, FlushedAt: latest.FlushedAt}, latest)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerExportedGenesisRestart(t *testing.T) {
+	cfg, _ := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Nil(t, r.indexer.Close())
+
+	// restarting before the first block is in still starts at the initial height
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_000), r.Height())
+	assert.Equal(t, int64(5_000_000), r.mm.GetCurrentHeight())
+	assert.Nil(t, r.indexer.Close())
+}
@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newGRPCServer(t *testing.T, r *Runner) *grpc.Server {
+	abcicli, err := r.appCreator.NewABCIClient()
+	assert.Nil(t, err)
+	server, err := rpc.NewGRPCServer(r.app, abcicli, r.config.ChainID, r.codec, r.resolveQueryHeight, r.config.QueryTimeout)
+	assert.Nil(t, err)
+	return server
+}
+
+func TestRunnerGRPC(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+
+	server := newGRPCServer(t, r)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec.NewProtoCodec(r.codec.InterfaceRegistry).GRPCCodec())),
+	)
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := authtypes.NewQueryClient(conn)
+	request := &authtypes.QueryAccountRequest{Address: sdk.AccAddress(accountKey.PubKey().Address()).String()}
+	atHeight := func(height string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), grpctypes.GRPCBlockHeightHeader, height)
+	}
+
+	// queries are served at the latest height, which is sent back, or at the one asked for
+	var header metadata.MD
+	res, err := client.Account(context.Background(), request, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.NotNil(t, res.Account)
+	assert.Equal(t, []string{"5000002"}, header.Get(grpctypes.GRPCBlockHeightHeader))
+	_, err = client.Account(atHeight("5000001"), request, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"5000001"}, header.Get(grpctypes.GRPCBlockHeightHeader))
+
+	// errors of the app are told apart, as nodes do
+	_, err = client.Account(context.Background(), &authtypes.QueryAccountRequest{Address: "terra1invalid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// heights that aren't served are refused
+	_, err = client.Account(atHeight("5000003"), request)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = ldb.Prune(5_000_002, nil)
+	assert.Nil(t, err)
+	_, err = client.Account(atHeight("5000001"), request)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "height is pruned")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerGRPCWeb(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+
+	router := mux.NewRouter()
+	rpc.RegisterGRPCWebRoute(router, newGRPCServer(t, r))
+	server := httptest.NewServer(router)
+	defer server.Close()
+	path := server.URL + "/cosmos.auth.v1beta1.Query/Account"
+
+	// browsers are let in by the preflight
+	preflight, err := http.NewRequest("OPTIONS", path, nil)
+	assert.Nil(t, err)
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", "POST")
+	preflight.Header.Set("Access-Control-Request-Headers", "x-grpc-web,content-type,x-cosmos-block-height")
+	res, err := http.DefaultClient.Do(preflight)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+
+	// a message is framed by a flag and its length, then followed by a frame of trailers
+	message, err := (&authtypes.QueryAccountRequest{Address: sdk.AccAddress(accountKey.PubKey().Address()).String()}).Marshal()
+	assert.Nil(t, err)
+	frame := append([]byte{0, 0, 0, 0, byte(len(message))}, message...)
+	request, err := http.NewRequest("POST", path, bytes.NewReader(frame))
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/grpc-web+proto")
+	request.Header.Set("X-Grpc-Web", "1")
+	request.Header.Set(grpctypes.GRPCBlockHeightHeader, "5000001")
+	res, err = http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	_ = res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "5000001", res.Header.Get(grpctypes.GRPCBlockHeightHeader))
+	if assert.Greater(t, len(body), 5) {
+		length := binary.BigEndian.Uint32(body[1:5])
+		var response authtypes.QueryAccountResponse
+		assert.Nil(t, response.Unmarshal(body[5:5+length]))
+		assert.NotNil(t, response.Account)
+		assert.Contains(t, string(body[5+length:]), "grpc-status: 0")
+	}
+	assert.Nil(t, r.indexer.Close())
+}
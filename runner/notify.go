@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"fmt"
+
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/notifier"
+)
+
+// newNotifier notifies backends, along with the webhook and nats server of the config, of every block flushed;
+// nil if there are none to notify
+func newNotifier(mantlemintConfig *config.Config, backends []notifier.Backend) (*notifier.Notifier, error) {
+	if mantlemintConfig.NotifyWebhookURL != "" {
+		backends = append(backends, notifier.NewWebhook(mantlemintConfig.NotifyWebhookURL))
+	}
+	if mantlemintConfig.NotifyNATSURL != "" {
+		nats, err := notifier.NewNATS(mantlemintConfig.NotifyNATSURL)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("nats %s on %s", nats.Host(), mantlemintConfig.NotifyNATSSubject)
+		backends = append(backends, notifier.NewPublisherBackend(name, nats, mantlemintConfig.NotifyNATSSubject))
+	}
+	if len(backends) == 0 {
+		return nil, nil
+	}
+
+	return notifier.New(&notifier.Config{
+		QueueSize:    mantlemintConfig.NotifyQueueSize,
+		Budget:       mantlemintConfig.NotifyBudget,
+		Timeout:      mantlemintConfig.NotifyTimeout,
+		MaxRetries:   mantlemintConfig.NotifyMaxRetries,
+		RetryBackoff: mantlemintConfig.NotifyRetryBackoff,
+	}, backends...), nil
+}
+
+// notifyOnceIndexed is to be called once block is indexed, for consumers notified to query the index of it
+// right away; nil if there's no one to notify
+func (r *Runner) notifyOnceIndexed(block *tendermint.Block, blockID *tendermint.BlockID, appHash tmbytes.HexBytes) func() {
+	if r.notifier == nil {
+		return nil
+	}
+
+	commit := notifier.Commit{
+		Height:    block.Height,
+		Time:      block.Time,
+		BlockHash: blockID.Hash.String(),
+		TxCount:   len(block.Txs),
+		AppHash:   appHash.String(),
+	}
+	return func() {
+		r.notifier.Notify(commit)
+	}
+}
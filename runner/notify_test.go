@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/notifier"
+)
+
+// recordingBackend records the commits delivered to it, along with the index watermark as of then
+type recordingBackend struct {
+	r          *Runner
+	commits    []notifier.Commit
+	watermarks []int64
+}
+
+func (b *recordingBackend) Name() string {
+	return "recording"
+}
+
+func (b *recordingBackend) Deliver(_ context.Context, commit notifier.Commit) error {
+	b.commits = append(b.commits, commit)
+	b.watermarks = append(b.watermarks, b.r.indexer.Watermark())
+	return nil
+}
+
+func (b *recordingBackend) Close() error {
+	return nil
+}
+
+func TestRunnerNotify(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	cfg.NotifyQueueSize, cfg.NotifyBudget, cfg.NotifyTimeout = 10, time.Second, time.Second
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	backend := &recordingBackend{}
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}), WithNotifierBackends(backend))
+	assert.Nil(t, err)
+	backend.r = r
+
+	// consumers are notified of the block once it's indexed
+	injectNextBlock(t, r, privKey)
+	state := r.mm.GetCurrentState()
+	assert.Nil(t, r.notifier.Close(context.Background()))
+	assert.Equal(t, []notifier.Commit{{
+		Height:    5_000_001,
+		Time:      state.LastBlockTime,
+		BlockHash: state.LastBlockID.Hash.String(),
+		AppHash:   tmbytes.HexBytes(state.AppHash).String(),
+	}}, backend.commits)
+	assert.Equal(t, []int64{5_000_001}, backend.watermarks)
+}
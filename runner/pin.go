@@ -0,0 +1,37 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+)
+
+var _ Feed = pinnedFeed{}
+
+// pinnedFeed stands in for the block feed of a runner pinned at a height (--pin-height), which takes no blocks;
+// it's reported as synced at that height, as that's all it's meant to serve
+type pinnedFeed struct {
+	height int64
+}
+
+func (f pinnedFeed) Subscribe(_ int64) (chan *blockFeeder.BlockResult, error) {
+	return nil, fmt.Errorf("pinned at height %d, no blocks are taken", f.height)
+}
+
+func (f pinnedFeed) Close(_ context.Context) error {
+	return nil
+}
+
+func (f pinnedFeed) Errors() <-chan error {
+	return nil
+}
+
+func (f pinnedFeed) SyncStatus() blockFeeder.SyncStatus {
+	return blockFeeder.SyncStatus{
+		Height:         f.height,
+		UpstreamHeight: f.height,
+		Synced:         true,
+		Pinned:         f.height,
+	}
+}
@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestRunnerPinHeight(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	assert.Equal(t, int64(5_000_002), r.Height())
+	assert.Nil(t, r.indexer.Close())
+
+	// pinned at the first block, before the last one synced
+	cfg.PinHeight = 5_000_001
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_001), r.Height())
+	assert.Equal(t, int64(5_000_001), r.app.LastBlockHeight())
+	assert.Equal(t, int64(5_000_001), r.feed.SyncStatus().Height)
+	assert.True(t, r.feed.SyncStatus().Synced)
+
+	// heights after the one pinned are in the future, even though they're synced
+	res := r.app.Query(abci.RequestQuery{Path: "/cosmos.auth.v1beta1.Query/Params"})
+	assert.Equal(t, uint32(0), res.Code, res.Log)
+	assert.Equal(t, int64(5_000_001), res.Height)
+	res = r.app.Query(abci.RequestQuery{Path: "/cosmos.auth.v1beta1.Query/Params", Height: 5_000_002})
+	assert.NotEqual(t, uint32(0), res.Code)
+	assert.Contains(t, res.Log, "height in the future")
+	assert.Nil(t, r.indexer.Close())
+
+	// nothing was written while pinned
+	cfg.PinHeight = 0
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), r.Height())
+	assert.Nil(t, r.indexer.Close())
+
+	// only heights blocks were injected at can be pinned
+	for _, height := range []int64{5_000_000, 5_000_003} {
+		cfg.PinHeight = height
+		_, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb))
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/terra-money/mantlemint/config"
+)
+
+// Preflight checks what's commonly misconfigured before New opens anything, for mantlemint to exit with a line
+// saying what's wrong rather than fail halfway through starting up: the genesis is there and of CHAIN_ID,
+// MANTLEMINT_HOME is writable, its dbs aren't held by another process, and there are endpoints to sync from.
+// Errors are StartupErrors, with an exit code per check.
+func Preflight(mantlemintConfig *config.Config) error {
+	if _, err := LoadGenesisDoc(mantlemintConfig.GenesisPath, mantlemintConfig.ChainID); err != nil {
+		return err
+	}
+
+	if err := checkWritable(mantlemintConfig.Home); err != nil {
+		return &config.StartupError{Code: config.ExitHomeNotWritable, Err: fmt.Errorf("MANTLEMINT_HOME(%s) is not writable: %w", mantlemintConfig.Home, err)}
+	}
+
+	// a standby reads the dbs of the mantlemint it follows without locking them
+	if mantlemintConfig.FollowHome == "" {
+		for _, name := range []string{mantlemintConfig.MantlemintDB, mantlemintConfig.IndexerDB} {
+			dir := filepath.Join(mantlemintConfig.Home, name+".db")
+			locked, err := isDBLocked(dir)
+			if err != nil {
+				return &config.StartupError{Code: config.ExitDBLocked, Err: fmt.Errorf("db %s can't be checked for a lock: %w", dir, err)}
+			}
+			if locked {
+				return &config.StartupError{Code: config.ExitDBLocked, Err: fmt.Errorf("db %s is locked by another process, i.e. another mantlemint on the same MANTLEMINT_HOME", dir)}
+			}
+		}
+	}
+
+	// the feed catches up from rpc endpoints and follows new blocks over ws; checks against upstream fetch from rpc
+	syncing := mantlemintConfig.PinHeight == 0 && mantlemintConfig.FollowHome == "" && mantlemintConfig.ReplayFrom == 0
+	if syncing && (len(mantlemintConfig.RPCEndpoints) == 0 || len(mantlemintConfig.WSEndpoints) == 0) {
+		return &config.StartupError{Code: config.ExitNoEndpoints, Err: fmt.Errorf("syncing needs RPC_ENDPOINTS and WS_ENDPOINTS, with at least one endpoint each")}
+	}
+	needsRPC := mantlemintConfig.DivergenceCheckBlocks != 0 || mantlemintConfig.ResultsCheckBlocks != 0 || mantlemintConfig.StateSyncSnapshotDir != ""
+	if needsRPC && len(mantlemintConfig.RPCEndpoints) == 0 {
+		return &config.StartupError{Code: config.ExitNoEndpoints, Err: fmt.Errorf("DIVERGENCE_CHECK_BLOCKS, RESULTS_CHECK_BLOCKS and STATE_SYNC_SNAPSHOT_DIR need RPC_ENDPOINTS")}
+	}
+
+	return nil
+}
+
+// checkWritable creates home if it doesn't exist yet, and a file in it
+func checkWritable(home string) error {
+	if err := os.MkdirAll(home, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(home, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/config"
+)
+
+func TestPreflight(t *testing.T) {
+	cfg, _ := newExportedGenesisConfig(t, 5_000_000)
+	cfg.MantlemintDB = "mantlemint"
+	cfg.RPCEndpoints, cfg.WSEndpoints = []string{"http://rpc:26657"}, []string{"ws://rpc:26657/websocket"}
+	assert.Nil(t, Preflight(cfg))
+
+	// every misconfiguration exits with its own code
+	exitCode := func(cfg config.Config) int {
+		err := Preflight(&cfg)
+		assert.NotNil(t, err)
+		return config.ExitCode(err)
+	}
+
+	missingGenesis := *cfg
+	missingGenesis.GenesisPath = filepath.Join(cfg.Home, "missing.json")
+	assert.Equal(t, config.ExitInvalidGenesis, exitCode(missingGenesis))
+
+	otherChain := *cfg
+	otherChain.ChainID = "columbus-5"
+	assert.Equal(t, config.ExitChainIDMismatch, exitCode(otherChain))
+
+	notWritable := *cfg
+	notWritable.Home = cfg.GenesisPath
+	assert.Equal(t, config.ExitHomeNotWritable, exitCode(notWritable))
+
+	noEndpoints := *cfg
+	noEndpoints.WSEndpoints = nil
+	assert.Equal(t, config.ExitNoEndpoints, exitCode(noEndpoints))
+
+	// which a standby doesn't need
+	noEndpoints.FollowHome = t.TempDir()
+	assert.Nil(t, Preflight(&noEndpoints))
+
+	// a db held by another mantlemint is locked
+	db, err := tmdb.NewGoLevelDB(cfg.IndexerDB, cfg.Home)
+	assert.Nil(t, err)
+	assert.Equal(t, config.ExitDBLocked, exitCode(*cfg))
+	assert.Nil(t, db.Close())
+	assert.Nil(t, Preflight(cfg))
+
+	// nothing is left behind
+	entries, err := os.ReadDir(cfg.Home)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "preflight")
+	}
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	tmdb "github.com/tendermint/tm-db"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/db/snappy"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+// Replay re-executes blocks stored locally, from --replay-from on, checking the app hash recomputed for
+// every block against the one the chain recorded in the next block's header, instead of Start. It runs
+// with merkle stores rather than faux merkle, so state must be fresh or left by an earlier replay.
+func (r *Runner) Replay() {
+	mm, hldb, batched, batchedOrigin := r.mm, r.hldb, r.batched, r.batchedOrigin
+	mantlemintConfig := r.config
+	from, to := mantlemintConfig.ReplayFrom, mantlemintConfig.ReplayTo
+	if from != mm.GetCurrentHeight()+1 {
+		panic(fmt.Errorf("replaying from %d needs state at height %d, but it's at %d; "+
+			"point MANTLEMINT_HOME to a fresh directory to replay from genesis", from, from-1, mm.GetCurrentHeight()))
+	}
+
+	load, tip, closeSource := openReplaySource(mantlemintConfig.ReplaySource)
+	defer closeSource()
+	if to == 0 {
+		to = tip
+	}
+
+	if mantlemintConfig.VerifyBlocks {
+		mm.SetBlockVerifier(mantlemint.VerifyAll(mantlemint.VerifyBlock, mantlemint.VerifyAppHash))
+	} else {
+		mm.SetBlockVerifier(mantlemint.VerifyAppHash)
+	}
+
+	replayFeed := blockFeeder.NewReplayFeed(load, to)
+	cReplayFeed, replayErr := replayFeed.Subscribe(from)
+	if replayErr != nil {
+		panic(replayErr)
+	}
+
+	for feed := range cReplayFeed {
+		hldb.SetWriteHeight(feed.Block.Height)
+		batchedOrigin.Open()
+		if injectErr := mm.Inject(feed.Block); injectErr != nil {
+			r.writeCrashReport(feed.Block, injectErr)
+			debug.PrintStack()
+			panic(injectErr)
+		}
+
+		if indexerErr := r.indexer.Run(feed.Block, feed.BlockID, mm.GetCurrentEventCollector()); indexerErr != nil {
+			panic(indexerErr)
+		}
+		if checkpointErr := blockFeeder.SaveCheckpoint(batched, &blockFeeder.Checkpoint{
+			Height:  feed.Block.Height,
+			BlockID: feed.BlockID,
+		}); checkpointErr != nil {
+			panic(checkpointErr)
+		}
+
+		// nothing to revert to here; a failed replay is started over
+		if rollback, flushErr := batchedOrigin.Flush(); flushErr != nil {
+			panic(flushErr)
+		} else if rollback != nil {
+			rollback.Close()
+		}
+		hldb.ClearWriteHeight()
+
+		// diff these between runs to find non-determinism
+		log.Printf("[v0.34.x/replay] height=%d, apphash=%X", feed.Block.Height, mm.GetCurrentState().AppHash)
+	}
+
+	if err := replayFeed.Err(); err != nil {
+		panic(err)
+	}
+
+	log.Printf("[v0.34.x/replay] replayed blocks %d to %d; the app hash of the last one was not checked, "+
+		"as that takes the header of the block after it", from, mm.GetCurrentHeight())
+}
+
+// openReplaySource opens blocks to replay, either a terrad blockstore.db or a mantlemint indexer db,
+// and returns how to load them, the last height stored if it's known (0 otherwise), and how to close it
+func openReplaySource(path string) (func(height int64) (*blockFeeder.BlockResult, error), int64, func()) {
+	if strings.HasPrefix(filepath.Base(path), "blockstore") {
+		blockStore, err := blockFeeder.NewBlockStoreSubscription(path)
+		if err != nil {
+			panic(err)
+		}
+
+		load := func(height int64) (*blockFeeder.BlockResult, error) {
+			if height > blockStore.Height() {
+				return nil, nil
+			}
+			return blockStore.LoadBlock(height)
+		}
+		return load, blockStore.Height(), func() { _ = blockStore.Close(context.Background()) }
+	}
+
+	// goleveldb still locks the directory read-only; the mantlemint owning it must be stopped
+	dir, name := filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ".db")
+	db, err := tmdb.NewGoLevelDBWithOpts(name, dir, &opt.Options{ReadOnly: true})
+	if err != nil {
+		panic(fmt.Errorf("failed to open indexer db at %s: %v", path, err))
+	}
+	indexerDB := snappy.NewSnappyDB(db, snappy.CompatModeEnabled)
+
+	load := func(height int64) (*blockFeeder.BlockResult, error) {
+		indexedBlock, blockID, err := block.LoadBlock(indexerDB, height)
+		if err != nil || indexedBlock == nil {
+			return nil, err
+		}
+		return &blockFeeder.BlockResult{Block: indexedBlock, BlockID: blockID}, nil
+	}
+	return load, 0, func() { _ = db.Close() }
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"log"
+
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+)
+
+// the floor moves at least this many blocks before keys are scanned again for KEEP_RECENT, rather than every block
+const pruneEvery = 100
+
+// pruner garbage collects the versions of keys below the retention floor in the background, as blocks are flushed;
+// injection only ever waits on the few milliseconds a batch of deletes takes to be written
+type pruner struct {
+	db              hld.Prunable
+	keepRecent      int64
+	minRetainHeight int64
+
+	// only the latest height scheduled is pruned to, once the prune in progress is done
+	heights chan int64
+	stop    chan struct{}
+	done    chan struct{} // nil until started
+}
+
+// newPruner returns nil if everything's retained, or if db can't be pruned
+func newPruner(db hld.HeightLimitEnabledDB, mantlemintConfig *config.Config) *pruner {
+	prunable, ok := db.(hld.Prunable)
+	if !ok || (mantlemintConfig.KeepRecent == 0 && mantlemintConfig.MinRetainHeight == 0) {
+		return nil
+	}
+	return &pruner{
+		db:              prunable,
+		keepRecent:      mantlemintConfig.KeepRecent,
+		minRetainHeight: mantlemintConfig.MinRetainHeight,
+		heights:         make(chan int64, 1),
+		stop:            make(chan struct{}),
+	}
+}
+
+// floor is the lowest height retained once height is synced
+func (p *pruner) floor(height int64) int64 {
+	if p.minRetainHeight != 0 {
+		if p.minRetainHeight > height {
+			return height
+		}
+		return p.minRetainHeight
+	}
+	return height - p.keepRecent + 1
+}
+
+// start prunes to the floor of height, the height synced, then to the floor of every height scheduled
+func (p *pruner) start(height int64) {
+	if p == nil {
+		return
+	}
+	p.schedule(height)
+
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+
+		// the first prune goes through every key regardless, to finish off one that was stopped
+		var pruned int64
+		for {
+			select {
+			case <-p.stop:
+				return
+			case height := <-p.heights:
+				floor := p.floor(height)
+				if floor <= pruned || (pruned != 0 && p.minRetainHeight == 0 && floor-pruned < pruneEvery) {
+					continue
+				}
+
+				deleted, err := p.db.Prune(floor, p.stop)
+				if err != nil {
+					log.Printf("[v0.34.x/prune] failed to prune below height %d, retrying with the next block: %v", floor, err)
+					continue
+				}
+				select {
+				case <-p.stop:
+					log.Printf("[v0.34.x/prune] stopped pruning below height %d after %d versions deleted", floor, deleted)
+					return
+				default:
+				}
+				log.Printf("[v0.34.x/prune] pruned below height %d, %d versions deleted", floor, deleted)
+				pruned = floor
+			}
+		}
+	}()
+}
+
+// schedule has the floor move up to that of height; it never blocks
+func (p *pruner) schedule(height int64) {
+	if p == nil {
+		return
+	}
+	select {
+	case p.heights <- height:
+	default:
+		// replace the height that's not picked up yet; schedule is only called from one goroutine
+		select {
+		case <-p.heights:
+		default:
+		}
+		p.heights <- height
+	}
+}
+
+// close stops the prune in progress after the batch in flight, and waits for it
+func (p *pruner) close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	if p.done != nil {
+		<-p.done
+	}
+}
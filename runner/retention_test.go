@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestPruner(t *testing.T) {
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	assert.Nil(t, newPruner(ldb, &config.Config{}))
+
+	for height := int64(1); height <= 300; height++ {
+		batch := ldb.NewBatch(height)
+		assert.Nil(t, batch.Set([]byte("key"), []byte{byte(height)}))
+		assert.Nil(t, batch.Write())
+		assert.Nil(t, batch.Close())
+	}
+
+	// the last heights are kept, and the floor only moves once it's far enough
+	p := newPruner(ldb, &config.Config{KeepRecent: 10})
+	assert.Equal(t, int64(91), p.floor(100))
+	p.start(100)
+	assert.Eventually(t, func() bool { return ldb.PrunedHeight() == 91 }, time.Second, time.Millisecond)
+	p.schedule(150)
+	p.schedule(250)
+	assert.Eventually(t, func() bool { return ldb.PrunedHeight() == 241 }, time.Second, time.Millisecond)
+	p.close()
+
+	value, err := ldb.Get(241, []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{241}, value)
+	_, err = ldb.Get(240, []byte("key"))
+	assert.NotNil(t, err)
+
+	// a minimum height is kept until it's reached
+	p = newPruner(ldb, &config.Config{MinRetainHeight: 280})
+	assert.Equal(t, int64(260), p.floor(260))
+	assert.Equal(t, int64(280), p.floor(300))
+}
@@ -0,0 +1,1411 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	simappparams "github.com/cosmos/cosmos-sdk/simapp/params"
+	snapshottypes "github.com/cosmos/cosmos-sdk/snapshots/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	"github.com/tendermint/tendermint/proxy"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	tmdb "github.com/tendermint/tm-db"
+	terra "github.com/terra-money/core/v2/app"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/indexer/richlist"
+	"github.com/terra-money/mantlemint/indexer/tx"
+	"github.com/terra-money/mantlemint/mantlemint"
+	"github.com/terra-money/mantlemint/notifier"
+	"github.com/terra-money/mantlemint/rpc"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+	"google.golang.org/grpc"
+)
+
+// Feed is what blocks are injected from; see blockFeeder.AggregateSubscription
+type Feed interface {
+	blockFeeder.BlockFeed
+
+	// Errors reports failures the feed recovers from on its own
+	Errors() <-chan error
+
+	SyncStatus() blockFeeder.SyncStatus
+}
+
+// Runner syncs an app from a block feed and serves queries on it, i.e. for mantlemint to be embedded
+// in another binary: create one with New, register indexers and routes, then Start and Stop it.
+type Runner struct {
+	config *config.Config
+
+	ldb           hld.HeightLimitEnabledDB
+	hldb          *hld.HeightLimitedDB
+	batched       tmdb.DB
+	batchedOrigin safe_batch.SafeBatchDBCloser
+	cms           *rootmulti.Store
+	appProvider   AppProvider
+	app           App
+	appCreator    proxy.ClientCreator
+	anteHandler   sdk.AnteHandler
+	storeMode     StoreMode
+	chainID       string
+	codec         simappparams.EncodingConfig
+	mm            mantlemint.Mantlemint
+	feed          Feed
+	indexer       *indexer.Indexer
+	pruner        *pruner
+	notifier      *notifier.Notifier
+	logTail       *mantlemint.LogTail
+
+	// dbStats exports the stats of the leveldb, if it runs on one
+	dbStats *heleveldb.StatsCollector
+
+	// metricsServer serves /metrics on its own, at METRICS_ADDRESS
+	metricsServer *http.Server
+
+	// debugServer serves pprof and runtime stats on their own, at DEBUG_ADDRESS
+	debugServer *http.Server
+
+	// the genesis file, as /genesis_chunked serves it, and as /genesis does if it fits a chunk
+	genesisDoc    *tendermint.GenesisDoc
+	genesisChunks []string
+
+	// injection can be paused over admin routes, and halts at the halt height
+	pauser     *mantlemint.Pauser
+	halter     *mantlemint.Halter
+	quarantine *mantlemint.Quarantine
+	events     *mantlemint.EventStream
+	timer      *mantlemint.ExecutionTimer
+
+	// app hashes are checked against the headers of an rpc endpoint every few blocks, if enabled
+	divergence         *mantlemint.DivergenceChecker
+	divergenceUpstream *blockFeeder.RPCSubscription
+	results            *mantlemint.ResultsChecker
+	resultsUpstream    *blockFeeder.RPCSubscription
+
+	// consumers notified of every block flushed, once indexed, besides those of the config
+	notifierBackends []notifier.Backend
+
+	// queryLimiter bounds the smart queries running at once, if they're to be
+	queryLimiter *rpc.QueryLimiter
+
+	// queryPool runs queries over QUERY_CLIENTS clients, each running one at a time, if set
+	queryPool *rpc.QueryPool
+
+	routes          []func(router *mux.Router)
+	rpcServer       *rpc.Server
+	grpcServer      *grpc.Server
+	cacheInvalidate chan int64
+	websocket       *rpc.WebsocketHub
+
+	// the last block flushed, swapped as a whole for its height and time to always go along
+	latest atomic.Pointer[rpc.LatestBlock]
+
+	// signals every flush, for the heights file standbys follow to be written
+	flushed chan struct{}
+
+	// shuttingDown is set as soon as Stop is called, failing readiness
+	shuttingDown atomic.Bool
+
+	// stopping is closed to stop injecting after the block in flight, and done once injection has stopped
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Option overrides what New would create from the config
+type Option func(r *Runner)
+
+// WithDB runs on db instead of the leveldb of MANTLEMINT_HOME, i.e. heleveldb.NewMemDBDriver for tests
+func WithDB(db hld.HeightLimitEnabledDB) Option {
+	return func(r *Runner) {
+		r.ldb = db
+	}
+}
+
+// WithFeed injects blocks from feed instead of the rpc/ws endpoints of the config
+func WithFeed(feed Feed) Option {
+	return func(r *Runner) {
+		r.feed = feed
+	}
+}
+
+// WithNotifierBackends notifies backends of every block flushed, once indexed, besides the consumers of the config;
+// i.e. to publish to a broker mantlemint has no client of, over notifier.NewPublisherBackend
+func WithNotifierBackends(backends ...notifier.Backend) Option {
+	return func(r *Runner) {
+		r.notifierBackends = append(r.notifierBackends, backends...)
+	}
+}
+
+// New sets up everything to sync: the db, the app created by appProvider, state from genesis (or from
+// a snapshot), the block feed and the indexers. Nothing runs until Start.
+func New(mantlemintConfig *config.Config, appProvider AppProvider, options ...Option) (*Runner, error) {
+	r := &Runner{
+		config:          mantlemintConfig,
+		appProvider:     appProvider,
+		codec:           appProvider.EncodingConfig(),
+		pauser:          mantlemint.NewPauser(),
+		halter:          mantlemint.NewHalter(mantlemintConfig.HaltHeight),
+		events:          mantlemint.NewEventStream(mantlemintConfig.EventStreamRetain),
+		timer:           mantlemint.NewExecutionTimer(),
+		cacheInvalidate: make(chan int64),
+		websocket: rpc.NewWebsocketHub(rpc.WebsocketConfig{
+			MaxClients:                mantlemintConfig.WebsocketMaxClients,
+			BufferSize:                mantlemintConfig.WebsocketBufferSize,
+			MaxSubscriptionsPerClient: mantlemintConfig.WebsocketMaxSubscriptionsPerClient,
+		}),
+		stopping: make(chan struct{}),
+	}
+	if mantlemintConfig.QueryMaxConcurrent != 0 {
+		r.queryLimiter = rpc.NewQueryLimiter(rpc.QueryLimitConfig{
+			MaxWeight:    int64(mantlemintConfig.QueryMaxConcurrent),
+			MaxQueued:    mantlemintConfig.QueryMaxQueued,
+			QueueTimeout: mantlemintConfig.QueryQueueTimeout,
+		})
+	}
+	for _, option := range options {
+		option(r)
+	}
+
+	// a standby reads the dbs of the mantlemint it follows, as that one writes them
+	standby := mantlemintConfig.FollowHome != ""
+	if r.ldb == nil {
+		open := OpenDB
+		if standby {
+			open = OpenFollowedDB
+		}
+		ldb, err := open(mantlemintConfig)
+		if err != nil {
+			return nil, err
+		}
+		r.ldb = ldb
+	}
+	if driver, ok := r.ldb.(*heleveldb.Driver); ok && driver.LevelDB() != nil {
+		r.dbStats = heleveldb.NewStatsCollector(driver.LevelDB())
+		if err := prometheus.Register(r.dbStats); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := r.ldb.(refreshable); standby && !ok {
+		return nil, fmt.Errorf("FOLLOW_HOME needs a db that can be refreshed to follow")
+	}
+	quarantine, err := mantlemint.NewQuarantine(r.ldb, mantlemintConfig.PoisonBlockRetries)
+	if err != nil {
+		return nil, err
+	}
+	r.quarantine = quarantine
+
+	r.hldb = hld.ApplyHeightLimitedDB(
+		r.ldb,
+		&hld.HeightLimitedDBConfig{
+			Debug: true,
+		},
+	)
+
+	// a pinned node sees the db as of the height pinned, and everything is loaded as of then:
+	// the app's latest version, mantlemint's state, and what queries at the latest height read
+	if mantlemintConfig.PinHeight != 0 {
+		if prunedHeight := r.hldb.PrunedHeight(); mantlemintConfig.PinHeight < prunedHeight {
+			return nil, fmt.Errorf("%w: can't pin height %d, the lowest height retained is %d", hld.ErrHeightPruned, mantlemintConfig.PinHeight, prunedHeight)
+		}
+		r.hldb.SetReadHeight(mantlemintConfig.PinHeight)
+	}
+
+	// the last log lines go into the crash report, should a block fail to inject
+	r.logTail = mantlemint.NewLogTail(mantlemintConfig.CrashDumpLogLines)
+	log.SetOutput(io.MultiWriter(os.Stderr, r.logTail))
+
+	r.batched = safe_batch.NewSafeBatchDB(r.hldb)
+	r.batchedOrigin = r.batched.(safe_batch.SafeBatchDBCloser)
+
+	// the app and mantlemint must agree on the last block before the app loads its state; a pinned node has
+	// nothing to agree on past the height pinned, and a standby leaves it to the mantlemint it follows
+	if mantlemintConfig.PinHeight == 0 && !standby {
+		if err := reconcileHeights(r.ldb, r.batched, mantlemintConfig); err != nil {
+			return nil, err
+		}
+	}
+	logger := tmlog.NewTMLogger(io.MultiWriter(os.Stdout, r.logTail))
+
+	// the app commits in the mode the db started in, see StoreMode
+	storeMode, err := resolveStoreMode(r.ldb, r.batched, mantlemintConfig, mantlemintConfig.PinHeight != 0 || standby)
+	if err != nil {
+		return nil, err
+	}
+	r.storeMode = storeMode
+
+	// customize CMS to limit kv store's read height on query
+	r.cms = rootmulti.NewStore(r.batched, r.hldb, logger)
+
+	// replays compute real app hashes to check them against the chain's, as syncing does with MERKLE_STORES;
+	// syncing does without by default, way faster
+	baseAppOptions := append(storeMode.Options(), SetCMSOpt(r.cms))
+
+	// snapshots are restored through the app's snapshot manager, which must be set up after the cms;
+	// it never takes snapshots of its own
+	if mantlemintConfig.StateSyncSnapshotDir != "" {
+		baseAppOptions = append(baseAppOptions, baseapp.SetSnapshot(
+			openStateSyncScratch(mantlemintConfig.Home),
+			snapshottypes.NewSnapshotOptions(0, 0),
+		))
+	}
+
+	r.app = appProvider.NewApp(logger, r.batched, nil, baseAppOptions...)
+	if anteHandlerProvider, ok := appProvider.(AnteHandlerProvider); ok {
+		if r.anteHandler, err = anteHandlerProvider.AnteHandler(r.app); err != nil {
+			return nil, err
+		}
+	}
+
+	// create app...
+	r.appCreator = mantlemint.NewConcurrentQueryClientCreator(r.app)
+	appConns := proxy.NewAppConns(r.appCreator)
+	appConns.SetLogger(logger)
+	if startErr := appConns.OnStart(); startErr != nil {
+		return nil, startErr
+	}
+
+	go func() {
+		a := <-appConns.Quit()
+		fmt.Println(a)
+	}()
+
+	// queries run over a pool of clients of their own, if so configured
+	if r.config.QueryClients > 0 {
+		clients := make([]abcicli.Client, r.config.QueryClients)
+		for i := range clients {
+			client, err := r.appCreator.NewABCIClient()
+			if err != nil {
+				return nil, err
+			}
+			clients[i] = rpc.NewAbortingClient(client, r.app, r.cms, r.queryHeader)
+		}
+		r.queryPool = rpc.NewQueryPool(clients)
+	}
+
+	// initialize using provided genesis
+	genesisDoc, err := LoadGenesisDoc(mantlemintConfig.GenesisPath, mantlemintConfig.ChainID)
+	if err != nil {
+		return nil, err
+	}
+	initialHeight := genesisDoc.InitialHeight
+	r.chainID = genesisDoc.ChainID
+	if r.genesisChunks, err = chunkGenesis(mantlemintConfig.GenesisPath); err != nil {
+		return nil, err
+	} else if len(r.genesisChunks) == 1 {
+		r.genesisDoc = genesisDoc
+	}
+
+	// state restored from a snapshot, if any, is loaded in place of genesis below
+	if mantlemintConfig.StateSyncSnapshotDir != "" {
+		stateSync(appConns.Snapshot(), r.hldb, r.batchedOrigin, genesisDoc, mantlemintConfig)
+	} else {
+		assertNoPartialStateSync(mantlemintConfig.Home)
+	}
+
+	var executor = mantlemint.NewMantlemintExecutor(r.batched, appConns.Consensus(), r.timer)
+	r.mm = mantlemint.NewMantlemint(
+		r.batched,
+		appConns,
+		executor,
+
+		// run before
+		nil,
+
+		// RunAfter Inject callback
+		nil,
+	)
+
+	if mantlemintConfig.VerifyBlocks {
+		r.mm.SetBlockVerifier(mantlemint.VerifyBlock)
+	}
+
+	// a pinned node only reads what's there, which must be the state of a block injected at the height pinned
+	if mantlemintConfig.PinHeight != 0 {
+		if lastHeight := r.mm.GetCurrentState().LastBlockHeight; lastHeight != mantlemintConfig.PinHeight {
+			return nil, fmt.Errorf("no block injected at height %d to pin; the last one up to there is at %d", mantlemintConfig.PinHeight, lastHeight)
+		}
+	} else if standby {
+		// nor does a standby, which serves what the mantlemint it follows synced
+		if rootmulti.GetLatestVersion(r.batched) == 0 {
+			return nil, fmt.Errorf("nothing is synced at FOLLOW_HOME(%s) yet to follow", mantlemintConfig.FollowHome)
+		}
+	} else {
+		// set target initial write height to genesis.initialHeight;
+		// this is safe as upon Inject it will be set with block.Height.
+		// genesis exported off a chain is the state at the height exported, right before the initial height,
+		// so that it can be queried at that height
+		if initialHeight > 1 {
+			r.hldb.SetWriteHeight(initialHeight - 1)
+		} else {
+			r.hldb.SetWriteHeight(initialHeight)
+		}
+		r.batchedOrigin.Open()
+
+		// initialize state machine with genesis
+		if initErr := r.mm.Init(genesisDoc); initErr != nil {
+			return nil, initErr
+		}
+
+		// flush to db; can't proceed otherwise
+		if rollback, flushErr := r.batchedOrigin.Flush(); flushErr != nil {
+			return nil, flushErr
+		} else if rollback != nil {
+			rollback.Close()
+		}
+	}
+
+	// load initial state to mantlemint
+	if loadErr := r.mm.LoadInitialState(); loadErr != nil {
+		return nil, loadErr
+	}
+
+	// initialization is done; clear write height
+	r.hldb.ClearWriteHeight()
+	r.setLatest(r.mm.GetCurrentHeight(), r.mm.GetCurrentState().LastBlockTime)
+	if err := r.allowUpgrades(); err != nil {
+		return nil, err
+	}
+
+	// resume from the last checkpoint; state is the source of truth for the height,
+	// checkpoint is only trusted if it agrees with it
+	checkpoint, checkpointErr := blockFeeder.LoadCheckpoint(r.batched)
+	if checkpointErr != nil {
+		return nil, checkpointErr
+	}
+	if checkpoint == nil || checkpoint.Height != r.mm.GetCurrentHeight() {
+		if checkpoint != nil {
+			log.Printf("[v0.34.x/sync] checkpoint height(%d) differs from state height(%d), ignoring checkpoint", checkpoint.Height, r.mm.GetCurrentHeight())
+		}
+		checkpoint = &blockFeeder.Checkpoint{Height: r.mm.GetCurrentHeight()}
+	}
+
+	// get blocks over some sort of transport, inject to mantlemint
+	if mantlemintConfig.PinHeight != 0 {
+		r.feed = pinnedFeed{height: mantlemintConfig.PinHeight}
+	} else if standby {
+		r.feed = &standbyFeed{home: mantlemintConfig.FollowHome, height: r.Height}
+	} else if r.feed == nil {
+		r.feed = newAggregateFeed(checkpoint, mantlemintConfig)
+	}
+
+	// create indexer service
+	// indexers are given terra's app to read its state; other chains' have none of its keepers
+	terraApp, _ := r.app.(*terra.TerraApp)
+	if terraApp == nil && (mantlemintConfig.RichlistLength != 0 || mantlemintConfig.EnableExportModule) {
+		return nil, fmt.Errorf("RICHLIST_LENGTH and ENABLE_EXPORT_MODULE read terra's app state, but the app isn't terra's")
+	}
+	if standby {
+		r.indexer, err = indexer.NewFollowingIndexer(mantlemintConfig.IndexerDB, mantlemintConfig.FollowHome)
+	} else {
+		r.indexer, err = indexer.NewIndexer(mantlemintConfig.IndexerDB, mantlemintConfig.Home, terraApp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.indexer.RegisterIndexerService("tx", tx.IndexTx)
+	r.indexer.RegisterIndexerService("block", block.IndexBlock)
+	r.indexer.RegisterRollbackService(tx.RollbackTx)
+	r.indexer.RegisterRollbackService(block.RollbackBlock)
+	if mantlemintConfig.RichlistLength != 0 {
+		r.indexer.RegisterIndexerService("richlist", richlist.IndexRichlist)
+		r.indexer.RegisterRollbackService(richlist.RollbackRichlist)
+	}
+
+	// an index ahead of the state, i.e. of blocks whose state was unwound, is unwound along;
+	// one behind is caught up on Start
+	if watermark, stateHeight := r.indexer.Watermark(), r.mm.GetCurrentHeight(); mantlemintConfig.PinHeight == 0 && !standby && watermark > stateHeight {
+		log.Printf("[v0.34.x/sync] index is at height %d, ahead of mantlemint's last block at height %d; unwinding it", watermark, stateHeight)
+		if err := r.indexer.Rollback(watermark, stateHeight); err != nil {
+			return nil, err
+		}
+	}
+
+	// a pinned node and a standby flush nothing to notify of
+	if mantlemintConfig.PinHeight == 0 && !standby {
+		if r.notifier, err = newNotifier(mantlemintConfig, r.notifierBackends); err != nil {
+			return nil, err
+		}
+	}
+
+	if mantlemintConfig.DivergenceCheckBlocks != 0 {
+		if r.divergence, r.divergenceUpstream, err = newDivergenceChecker(mantlemintConfig); err != nil {
+			return nil, err
+		}
+	}
+	if mantlemintConfig.ResultsCheckBlocks != 0 {
+		if r.results, r.resultsUpstream, err = newResultsChecker(mantlemintConfig); err != nil {
+			return nil, err
+		}
+	}
+	broadcast, err := newBroadcastConfig(mantlemintConfig)
+	if err != nil {
+		return nil, err
+	}
+	r.RegisterRoutes(func(router *mux.Router) {
+		r.indexer.RegisterRESTRoute(router, tx.RegisterRESTRoute)
+		r.indexer.RegisterRESTRoute(router, block.RegisterRESTRoute)
+		r.indexer.RegisterRESTRoute(router, richlist.RegisterRESTRoute)
+		mantlemint.RegisterEventRoutes(router, r.events)
+		rpc.RegisterLatestBlockRoute(router, r.LatestBlock)
+		rpc.RegisterBroadcastRoutes(router, broadcast)
+		batchClient, _ := r.newQueryClient()
+		rpc.RegisterBatchQueryRoute(router, batchClient, r.resolveQueryHeight, rpc.BatchQueryConfig{
+			MaxQueries:  mantlemintConfig.WasmBatchMaxQueries,
+			Concurrency: mantlemintConfig.WasmBatchConcurrency,
+		})
+		rpc.RegisterTendermintRoutes(router, r.tendermintRoutes())
+		if mantlemintConfig.WebsocketMaxClients != 0 {
+			rpc.RegisterWebsocketRoute(router, r.websocket)
+		}
+		if mantlemintConfig.MetricsAddress == "" {
+			router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+		}
+		if r.queryLimiter != nil {
+			router.Use(r.queryLimiter.Middleware)
+		}
+		if mantlemintConfig.EnableDebug && mantlemintConfig.DebugAddress == "" {
+			rpc.RegisterDebugRoutes(router, r.wasmCacheLimit())
+		}
+	})
+
+	return r, nil
+}
+
+// newBroadcastConfig parses the upstreams txs broadcast are forwarded to
+func newBroadcastConfig(mantlemintConfig *config.Config) (rpc.BroadcastConfig, error) {
+	parse := func(upstream string) (*url.URL, error) {
+		if upstream == "" {
+			return nil, nil
+		}
+		parsed, err := url.Parse(upstream)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tx broadcast upstream: %w", err)
+		}
+		return parsed, nil
+	}
+
+	broadcast := rpc.BroadcastConfig{Timeout: mantlemintConfig.TxBroadcastTimeout, Commit: mantlemintConfig.TxBroadcastCommit}
+	var err error
+	if broadcast.Upstream, err = parse(mantlemintConfig.TxBroadcastUpstream); err != nil {
+		return broadcast, err
+	}
+	if broadcast.LCDUpstream, err = parse(mantlemintConfig.TxBroadcastLCDUpstream); err != nil {
+		return broadcast, err
+	}
+	return broadcast, nil
+}
+
+// OpenDB opens the leveldb of MANTLEMINT_HOME
+func OpenDB(mantlemintConfig *config.Config) (*heleveldb.Driver, error) {
+	driver, err := heleveldb.NewLevelDBDriver(&heleveldb.DriverConfig{
+		Name: mantlemintConfig.MantlemintDB,
+		Dir:  mantlemintConfig.Home,
+		Mode: heleveldb.DriverModeKeySuffixDesc,
+	})
+	if err != nil {
+		dir := filepath.Join(mantlemintConfig.Home, mantlemintConfig.MantlemintDB+".db")
+		if locked, _ := isDBLocked(dir); locked {
+			return nil, &config.StartupError{Code: config.ExitDBLocked, Err: fmt.Errorf("db %s is locked by another process, i.e. another mantlemint on the same MANTLEMINT_HOME", dir)}
+		}
+		return nil, err
+	}
+	return driver, nil
+}
+
+// OpenReadOnlyDB opens mantlemint's db for reads only, i.e. to verify it
+func OpenReadOnlyDB(mantlemintConfig *config.Config) (*heleveldb.Driver, error) {
+	return heleveldb.NewLevelDBDriver(&heleveldb.DriverConfig{
+		Name:     mantlemintConfig.MantlemintDB,
+		Dir:      mantlemintConfig.Home,
+		Mode:     heleveldb.DriverModeKeySuffixDesc,
+		ReadOnly: true,
+	})
+}
+
+// OpenFollowedDB opens the db of the mantlemint at FOLLOW_HOME, as it writes to it, for a standby to serve queries off
+func OpenFollowedDB(mantlemintConfig *config.Config) (*heleveldb.Driver, error) {
+	return heleveldb.NewLevelDBDriver(&heleveldb.DriverConfig{
+		Name:   mantlemintConfig.MantlemintDB,
+		Dir:    mantlemintConfig.FollowHome,
+		Mode:   heleveldb.DriverModeKeySuffixDesc,
+		Follow: true,
+	})
+}
+
+// Indexer is where indexers are registered, along with their routes; before Start
+func (r *Runner) Indexer() *indexer.Indexer {
+	return r.indexer
+}
+
+// Mantlemint is the block injector, i.e. to add hooks; before Start
+func (r *Runner) Mantlemint() mantlemint.Mantlemint {
+	return r.mm
+}
+
+// App is the app state is synced for, as created by the app provider
+func (r *Runner) App() App {
+	return r.app
+}
+
+// Events streams the events of every block injected, right after it's indexed
+func (r *Runner) Events() *mantlemint.EventStream {
+	return r.events
+}
+
+// RegisterRoutes registers custom routes on the api server once started
+func (r *Runner) RegisterRoutes(register func(router *mux.Router)) {
+	r.routes = append(r.routes, register)
+}
+
+// Router is the router of the api server; nil until started
+func (r *Runner) Router() *mux.Router {
+	if r.rpcServer == nil {
+		return nil
+	}
+	return r.rpcServer.Router()
+}
+
+// Height is the last height injected and flushed, i.e. that queries are served at
+func (r *Runner) Height() int64 {
+	return r.latest.Load().Height
+}
+
+// LatestBlock is the last block injected and flushed, with its time, and the chain id of the genesis
+func (r *Runner) LatestBlock() rpc.LatestBlock {
+	return *r.latest.Load()
+}
+
+// setLatest moves the latest block on to height, returning the height it was at
+func (r *Runner) setLatest(height int64, blockTime time.Time) int64 {
+	previous := r.latest.Swap(&rpc.LatestBlock{ChainID: r.chainID, Height: height, Time: blockTime, FlushedAt: time.Now()})
+	if previous == nil {
+		return 0
+	}
+	return previous.Height
+}
+
+// Simulate runs a tx against the last block committed, returning gas used and events, without writing anything.
+// Simulations run alongside one another and alongside injection, but never while a block is being committed,
+// as the state they branch off is swapped out then
+func (r *Runner) Simulate(txBytes []byte) (sdk.GasInfo, *sdk.Result, error) {
+	// the state simulations branch off is only moved on by committing blocks, which a standby doesn't
+	if r.config.FollowHome != "" {
+		return sdk.GasInfo{}, nil, fmt.Errorf("txs aren't simulated by a standby, as it can't tell the state of the last block apart")
+	}
+	locker := mantlemint.ReadLocker(r.appCreator)
+	locker.Lock()
+	defer locker.Unlock()
+	return r.app.Simulate(txBytes)
+}
+
+// CheckTx checks a tx against the last block committed as CheckTx does, verifying its signatures, sequences and
+// fees, without running its msgs; unlike CheckTx, it runs on a branch of the check state, so nothing is written,
+// and checking a tx again gives the same result. Checks run alongside injection as simulations do.
+func (r *Runner) CheckTx(txBytes []byte) (res abci.ResponseCheckTx, err error) {
+	if r.config.FollowHome != "" {
+		return res, fmt.Errorf("txs aren't checked by a standby, as it can't tell the state of the last block apart")
+	}
+	if r.anteHandler == nil {
+		return res, fmt.Errorf("txs aren't checked, as the app's provider doesn't give its ante handler")
+	}
+	locker := mantlemint.ReadLocker(r.appCreator)
+	locker.Lock()
+	defer locker.Unlock()
+
+	lastState := r.mm.GetCurrentState()
+	ctx, _ := r.app.NewContext(true, tmproto.Header{
+		ChainID: lastState.ChainID,
+		Height:  lastState.LastBlockHeight,
+		Time:    lastState.LastBlockTime,
+		AppHash: lastState.AppHash,
+	}).WithTxBytes(txBytes).CacheContext()
+	ctx = ctx.WithConsensusParams(r.app.GetConsensusParams(ctx))
+
+	// as BaseApp does, the gas meter is set up by the ante handler, and running out of it panics
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			outOfGas, ok := recovered.(sdk.ErrorOutOfGas)
+			if !ok {
+				panic(recovered)
+			}
+			res = sdkerrors.ResponseCheckTxWithEvents(sdkerrors.Wrap(sdkerrors.ErrOutOfGas, outOfGas.Descriptor),
+				ctx.GasMeter().Limit(), ctx.GasMeter().GasConsumed(), nil, false)
+		}
+	}()
+
+	tx, err := r.codec.TxConfig.TxDecoder()(txBytes)
+	if err != nil {
+		return sdkerrors.ResponseCheckTxWithEvents(err, 0, 0, nil, false), nil
+	}
+	if err := tx.ValidateBasic(); err != nil {
+		return sdkerrors.ResponseCheckTxWithEvents(err, 0, 0, nil, false), nil
+	}
+	for _, msg := range tx.GetMsgs() {
+		if err := msg.ValidateBasic(); err != nil {
+			return sdkerrors.ResponseCheckTxWithEvents(err, 0, 0, nil, false), nil
+		}
+	}
+
+	ctx = ctx.WithEventManager(sdk.NewEventManager())
+	newCtx, err := r.anteHandler(ctx, tx, false)
+	if !newCtx.IsZero() {
+		ctx = newCtx
+	}
+	gasWanted, gasUsed := ctx.GasMeter().Limit(), ctx.GasMeter().GasConsumed()
+	if err != nil {
+		return sdkerrors.ResponseCheckTxWithEvents(err, gasWanted, gasUsed, ctx.EventManager().ABCIEvents(), false), nil
+	}
+
+	return abci.ResponseCheckTx{
+		GasWanted: int64(gasWanted),
+		GasUsed:   int64(gasUsed),
+		Events:    ctx.EventManager().ABCIEvents(),
+		Priority:  ctx.Priority(),
+	}, nil
+}
+
+// syncStatus is the sync status of the feed, along with what's known of injection, for health checks
+func (r *Runner) syncStatus() blockFeeder.SyncStatus {
+	syncStatus := r.feed.SyncStatus()
+	syncStatus.Paused = r.pauser.IsPaused()
+	syncStatus.ShuttingDown = r.shuttingDown.Load()
+	latest := r.LatestBlock()
+	syncStatus.ChainID, syncStatus.LatestHeight, syncStatus.LatestBlockTime = latest.ChainID, latest.Height, latest.Time
+	syncStatus.Staleness = latest.Staleness().Seconds()
+	syncStatus.SinceLastFlush = time.Since(latest.FlushedAt).Seconds()
+	// the feed counts blocks it delivered, though they may still be buffered or held, unflushed; queries are served
+	// at the flushed height, so lag is counted from there. A standby's feed counts it from the standby's height already
+	if syncStatus.Following == "" {
+		syncStatus.Lag = 0
+		if syncStatus.UpstreamHeight > latest.Height {
+			syncStatus.Lag = syncStatus.UpstreamHeight - latest.Height
+		}
+		syncStatus.Synced = syncStatus.UpstreamHeight > 0 && syncStatus.Lag <= syncStatus.SyncedThreshold
+	}
+	if poison := r.quarantine.Poison(); poison != nil && poison.Height == r.Height()+1 {
+		syncStatus.Quarantined = poison.Height
+	}
+	if r.divergence != nil {
+		if diverged := r.divergence.Diverged(); diverged != nil {
+			syncStatus.Diverged = diverged.Height
+			syncStatus.Synced = false
+		}
+	}
+	return syncStatus
+}
+
+// serve serves router at address on its own, i.e. away from the LCD, until shut down
+func serve(name, address string, router *mux.Router) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: router, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[v0.34.x/%s] failed to serve %s: %v", name, name, err)
+		}
+	}()
+	log.Printf("[v0.34.x/%s] serving %s at %s", name, name, address)
+	return server, nil
+}
+
+// wasmCacheLimit is the size the wasm vm's contract memory cache may grow to, in bytes
+func (r *Runner) wasmCacheLimit() uint64 {
+	return uint64(r.config.Wasm.ContractMemoryCacheSize) << 20
+}
+
+// checkLive reads the store mode off the db, for liveness probes to tell a process that can't serve anymore
+func (r *Runner) checkLive() error {
+	_, err := r.ldb.Get(storeModeHeight, storeModeKey)
+	return err
+}
+
+// newQueryClient is a client for the api's queries, limited by the query limiter, then run over the query pool if
+// any; grpc queries made with the context of their request are aborted once it's done, see rpc.NewAbortingClient
+func (r *Runner) newQueryClient() (abcicli.Client, error) {
+	client, err := r.appCreator.NewABCIClient()
+	if err != nil {
+		return nil, err
+	}
+	return r.queryLimiter.Client(r.queryPool.Client(rpc.NewAbortingClient(client, r.app, r.cms, r.queryHeader))), nil
+}
+
+// queryHeader is the header queries run with, that of the last block committed, as BaseApp gives them
+func (r *Runner) queryHeader() tmproto.Header {
+	lastState := r.mm.GetCurrentState()
+	return tmproto.Header{
+		ChainID: lastState.ChainID,
+		Height:  lastState.LastBlockHeight,
+		Time:    lastState.LastBlockTime,
+		AppHash: lastState.AppHash,
+	}
+}
+
+// Start starts the api server, then injecting blocks from the feed unless sync is disabled, or following the
+// mantlemint at FOLLOW_HOME. Injection stops once ctx is done, or on Stop, or when the feed is closed; see Done.
+func (r *Runner) Start(ctx context.Context) error {
+	queryClient, _ := r.newQueryClient()
+	rpccli := rpc.NewIndexedRpcClient(queryClient, txIndex{r})
+
+	// start RPC server
+	rpcServer, rpcErr := rpc.StartRPC(
+		r.app,
+		rpccli,
+		r.config.ChainID,
+		r.codec,
+		r.Simulate,
+		r.cacheInvalidate,
+
+		// callback for registering custom routers; primarily for indexers
+		func(router *mux.Router) {
+			for _, register := range r.routes {
+				register(router)
+			}
+
+			if r.config.EnableAdmin {
+				if r.config.AdminToken != "" {
+					router.Use(mantlemint.RequireAdminToken(r.config.AdminToken))
+				}
+				if aggregateFeed, ok := r.feed.(*blockFeeder.AggregateSubscription); ok {
+					blockFeeder.RegisterAdminRoutes(router, aggregateFeed)
+				}
+				mantlemint.RegisterPauseRoutes(router, r.pauser, r.Height)
+				mantlemint.RegisterHaltRoutes(router, r.halter, r.Height)
+				mantlemint.RegisterQuarantineRoutes(router, r.quarantine, r.Height)
+			}
+		},
+
+		// inject sync status of the feed, for health checks
+		r.syncStatus,
+
+		// alive as long as the db can be read
+		r.checkLive,
+
+		// heights queried at must have been flushed, and still be retained
+		r.resolveQueryHeight,
+		r.config,
+	)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	r.rpcServer = rpcServer
+
+	// the services of the app are all registered by now, the tx service included
+	if r.config.GRPCAddress != "" || r.config.EnableGRPCWeb {
+		grpcServer, err := rpc.NewGRPCServer(r.app, queryClient, r.config.ChainID, r.codec, r.resolveQueryHeight, r.config.QueryTimeout)
+		if err != nil {
+			return err
+		}
+		r.grpcServer = grpcServer
+	}
+	if r.config.GRPCAddress != "" {
+		if err := rpc.StartGRPC(r.grpcServer, rpc.GRPCConfig{Address: r.config.GRPCAddress}); err != nil {
+			return err
+		}
+		log.Printf("[v0.34.x/grpc] serving queries over grpc at %s", r.config.GRPCAddress)
+	}
+	if r.config.MetricsAddress != "" {
+		router := mux.NewRouter()
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+		metricsServer, err := serve("metrics", r.config.MetricsAddress, router)
+		if err != nil {
+			return err
+		}
+		r.metricsServer = metricsServer
+	}
+	if r.config.EnableDebug && r.config.DebugAddress != "" {
+		router := mux.NewRouter()
+		rpc.RegisterDebugRoutes(router, r.wasmCacheLimit())
+		debugServer, err := serve("debug", r.config.DebugAddress, router)
+		if err != nil {
+			return err
+		}
+		r.debugServer = debugServer
+	}
+	if r.config.EnableGRPCWeb {
+		rpc.RegisterGRPCWebRoute(rpcServer.Router(), r.grpcServer)
+		log.Printf("[v0.34.x/grpc] serving queries over grpc-web")
+	}
+
+	// start subscribing to block
+	if r.config.DisableSync {
+		fmt.Println("running without sync...")
+		return nil
+	}
+	if r.config.PinHeight != 0 {
+		log.Printf("[v0.34.x/sync] pinned at height %d, serving queries as of then without syncing", r.config.PinHeight)
+		return nil
+	}
+	if standbyFeed, ok := r.feed.(*standbyFeed); ok {
+		log.Printf("[v0.34.x/standby] following %s from height %d, serving queries without syncing", r.config.FollowHome, r.Height())
+		r.run(ctx, func() { r.follow(standbyFeed) })
+		return nil
+	}
+
+	// versions of keys below the retention floor are pruned from now on
+	r.pruner = newPruner(r.ldb, r.config)
+	r.pruner.start(r.Height())
+
+	// the richlist reads the app state as of when it's indexed, which has to be the block's
+	indexerQueueSize := r.config.IndexerQueueSize
+	if r.config.RichlistLength != 0 {
+		indexerQueueSize = 0
+	}
+	r.indexer.Start(indexerQueueSize)
+
+	// blocks that were queued to be indexed when going down are fetched again, to be indexed only
+	fromHeight := r.mm.GetCurrentHeight() + 1
+	if watermark := r.indexer.Watermark(); watermark != 0 && watermark+1 < fromHeight {
+		log.Printf("[v0.34.x/sync] index is behind at height %d, indexing up to height %d again", watermark, fromHeight-1)
+		fromHeight = watermark + 1
+	}
+
+	cBlockFeed, blockFeedErr := r.feed.Subscribe(fromHeight)
+	if blockFeedErr != nil {
+		return blockFeedErr
+	}
+
+	// standbys following learn the heights flushed off the heights file
+	r.flushed = make(chan struct{}, 1)
+	go r.writeHeights()
+
+	r.run(ctx, func() { r.inject(cBlockFeed) })
+	return nil
+}
+
+// run runs loop in the background until it returns, which it's to do once stopping, i.e. once ctx is done
+func (r *Runner) run(ctx context.Context, loop func()) {
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		loop()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.stopInjecting()
+		case <-r.done:
+		}
+	}()
+}
+
+// Done is closed once injection, or following, has stopped, i.e. when the feed is closed; nil if it never started
+func (r *Runner) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Runner) stopInjecting() {
+	r.stopOnce.Do(func() {
+		close(r.stopping)
+	})
+}
+
+// Stop stops injecting after the block in flight, then closes everything: the feed, the api server once
+// requests in flight are drained, and the dbs. Closing is given up on after SHUTDOWN_TIMEOUT, or once ctx is done.
+func (r *Runner) Stop(ctx context.Context) error {
+	// readiness fails right away, for load balancers to route queries elsewhere while the block in flight completes
+	stopping := time.Now()
+	r.shuttingDown.Store(true)
+	if r.rpcServer != nil {
+		r.rpcServer.Drain()
+	}
+
+	r.stopInjecting()
+	if r.done != nil {
+		<-r.done
+	}
+	if wait := r.config.ShutdownDrainDelay - time.Since(stopping); r.rpcServer != nil && wait > 0 {
+		log.Printf("[v0.34.x/shutdown] serving for %s more, for load balancers to route queries elsewhere", wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := r.feed.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close block feed: %w", err))
+	}
+	if r.divergenceUpstream != nil {
+		_ = r.divergenceUpstream.Close(ctx)
+	}
+	if r.resultsUpstream != nil {
+		_ = r.resultsUpstream.Close(ctx)
+	}
+	if r.rpcServer != nil {
+		// websocket clients and long-polls on events would hold the server up otherwise; the former are sent a close frame
+		r.websocket.Close()
+		r.events.Close()
+		if err := r.rpcServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain rpc server: %w", err))
+		}
+	}
+	if r.metricsServer != nil {
+		if err := r.metricsServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close metrics server: %w", err))
+		}
+	}
+	if r.debugServer != nil {
+		if err := r.debugServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close debug server: %w", err))
+		}
+	}
+	if r.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			r.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			r.grpcServer.Stop()
+			errs = append(errs, fmt.Errorf("failed to drain grpc server: %w", ctx.Err()))
+		}
+	}
+
+	// queries are done with, or given up on, by now; blocks queued are indexed before the index is closed
+	// then consumers are notified of them, as much as they take before shutting down
+	r.indexer.Drain()
+	if err := r.notifier.Close(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close notifier: %w", err))
+	}
+	if err := r.indexer.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close indexer db: %w", err))
+	}
+	r.pruner.close()
+	if err := r.ldb.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close db: %w", err))
+	}
+	if r.dbStats != nil {
+		prometheus.Unregister(r.dbStats)
+	}
+
+	return errors.Join(errs...)
+}
+
+// inject injects blocks from the feed until it's closed, or until stopping
+func (r *Runner) inject(cBlockFeed chan *blockFeeder.BlockResult) {
+	var rollbackBatch tmdb.Batch
+
+	// while catching up, blocks are held in the db batch and flushed many at once;
+	// queries, the lcd cache and the checkpoint only move on once they're flushed
+	var heldBlocks int
+	var heldHeight int64
+	var heldTime time.Time
+	var heldIndexJobs []func() error
+	var heldWebsocketEvents []rpc.WebsocketEvent
+
+	// returns how long the flush took, then how long the blocks flushed took to be queued to be indexed
+	flush := func() (time.Duration, time.Duration) {
+		if heldBlocks == 0 {
+			return 0, 0
+		}
+		flushStart := time.Now()
+		flushStats := mantlemint.FlushStats{Height: heldHeight, BlockTime: heldTime, Blocks: heldBlocks, Bytes: r.batchedOrigin.PendingBytes()}
+
+		// returns rollback batch that reverts the blocks flushed
+		if rollback, flushErr := r.batchedOrigin.Flush(); flushErr != nil {
+			debug.PrintStack()
+			panic(flushErr)
+		} else {
+			rollbackBatch = rollback
+		}
+
+		if heldBlocks > 1 {
+			log.Printf("[v0.34.x/sync] flushed %d blocks up to height %d", heldBlocks, heldHeight)
+		}
+		heldBlocks = 0
+		flushed := time.Since(flushStart)
+
+		// blocks are only indexed once flushed, so the index never runs ahead of the state
+		indexerStart := time.Now()
+		for _, enqueue := range heldIndexJobs {
+			if indexerErr := enqueue(); indexerErr != nil {
+				debug.PrintStack()
+				panic(indexerErr)
+			}
+		}
+		heldIndexJobs = nil
+		indexed := time.Since(indexerStart)
+		flushStats.UpstreamHeight, flushStats.IndexedHeight = r.feed.SyncStatus().UpstreamHeight, r.indexer.Watermark()
+		mantlemint.ObserveFlush(flushStats)
+
+		// the blocks just flushed can still be reverted, so versions are only pruned up to the ones before
+		r.pruner.schedule(r.setLatest(heldHeight, heldTime))
+		r.cacheInvalidate <- heldHeight
+		r.websocket.Publish(heldWebsocketEvents...)
+		heldWebsocketEvents = nil
+		select {
+		case r.flushed <- struct{}{}:
+		default:
+		}
+		return flushed, indexed
+	}
+	catchingUp := func(height int64) bool {
+		return r.config.CatchUpLag > 0 &&
+			r.feed.SyncStatus().UpstreamHeight-height > r.config.CatchUpLag
+	}
+
+inject:
+	for {
+		// blocks here while paused; the feed buffers, then backpressures upstream meanwhile
+		if r.pauser.IsPaused() {
+			flush()
+			if !waitUnlessStopping(r.pauser.Wait, r.stopping) {
+				break
+			}
+		}
+
+		// stopping takes precedence over blocks the feed already buffered, which select would pick at random
+		select {
+		case <-r.stopping:
+			break inject
+		default:
+		}
+
+		var feed *blockFeeder.BlockResult
+		var ok bool
+		fetchStart := time.Now()
+		select {
+		case <-r.stopping:
+			break inject
+		case feedErr := <-r.feed.Errors():
+			// the feed keeps retrying on its own; a permanent failure needs an upstream that has the block,
+			// and a quorum conflict needs an operator
+			var conflict *blockFeeder.QuorumConflictError
+			if errors.As(feedErr, &conflict) {
+				log.Printf("[v0.34.x/sync] ALERT: injection halted at height %d, upstreams disagree on block %d; restart once resolved: %v", r.mm.GetCurrentHeight(), conflict.Height, feedErr)
+			} else if blockFeeder.IsPermanent(feedErr) {
+				log.Printf("[v0.34.x/sync] no upstream can serve block %d, waiting for one that can: %v", r.mm.GetCurrentHeight()+1, feedErr)
+			} else {
+				log.Printf("[v0.34.x/sync] block feed failed at height %d, retrying: %v", r.mm.GetCurrentHeight()+1, feedErr)
+			}
+
+			// no telling when the next block comes
+			flush()
+			continue
+		case feed, ok = <-cBlockFeed:
+		}
+
+		// the feed is closed; nothing more to inject
+		if !ok {
+			log.Printf("[v0.34.x/sync] block feed closed at height %d", r.mm.GetCurrentHeight())
+			break
+		}
+
+		// a block injected already is only indexed, i.e. one the index lost on an unclean shutdown
+		if feed.Block.Height <= r.mm.GetCurrentHeight() {
+			evc, loadErr := mantlemint.LoadEventCollector(state.NewStore(r.batched, state.StoreOptions{DiscardABCIResponses: false}), feed.Block)
+			if loadErr != nil {
+				debug.PrintStack()
+				panic(fmt.Errorf("failed to load results of block %d to index it again: %w", feed.Block.Height, loadErr))
+			}
+			appHash, _ := r.cms.CommitHash(feed.Block.Height)
+			if indexerErr := r.indexer.EnqueueThen(feed.Block, feed.BlockID, evc, r.notifyOnceIndexed(feed.Block, feed.BlockID, appHash)); indexerErr != nil {
+				debug.PrintStack()
+				panic(indexerErr)
+			}
+			continue
+		}
+
+		// the prior blocks are flushed first; hold on to this one until the halt height is moved, if ever
+		if r.halter.Halts(feed.Block.Height) {
+			flush()
+			log.Printf("[v0.34.x/sync] HALTED on purpose at height %d (HALT_HEIGHT=%d); still serving queries", r.mm.GetCurrentHeight(), r.halter.HaltHeight())
+			if !waitUnlessStopping(func() { r.halter.Wait(feed.Block.Height) }, r.stopping) {
+				break
+			}
+			log.Printf("[v0.34.x/sync] halt height moved to %d, resuming from height %d", r.halter.HaltHeight(), feed.Block.Height)
+		}
+
+		// a block that keeps failing the same way is not retried until released
+		if r.quarantine.Quarantines(feed.Block.Height) {
+			flush()
+			log.Printf("[v0.34.x/sync] ALERT: QUARANTINED block %d, it failed more than POISON_BLOCK_RETRIES(%d) times; still serving queries at height %d. "+
+				"Release it over /admin/quarantine/release once fixed", feed.Block.Height, r.config.PoisonBlockRetries, r.mm.GetCurrentHeight())
+			if !waitUnlessStopping(func() { r.quarantine.Wait(feed.Block.Height) }, r.stopping) {
+				break
+			}
+			log.Printf("[v0.34.x/sync] block %d released from quarantine, retrying", feed.Block.Height)
+		}
+
+		timings := mantlemint.BlockTimings{Height: feed.Block.Height, FetchWait: time.Since(fetchStart), Txs: len(feed.Block.Txs)}
+		r.timer.Reset()
+
+		// open db batch
+		r.hldb.SetWriteHeight(feed.Block.Height)
+		r.batchedOrigin.Open()
+		var runAfterErr *mantlemint.RunAfterError
+		var upgradeErr *mantlemint.UpgradeNeededError
+		if injectErr := r.injectBlock(feed.Block); errors.As(injectErr, &runAfterErr) {
+			// hooks failed on a block that's applied regardless; it's flushed as usual
+			log.Printf("[v0.34.x/sync] %v", injectErr)
+		} else if errors.As(injectErr, &upgradeErr) {
+			// nothing of the block is applied; the prior blocks are flushed, and a restart with a binary
+			// that has the upgrade resumes from the upgrade height
+			flush()
+			r.hldb.ClearWriteHeight()
+			log.Printf("[v0.34.x/sync] ALERT: HALTED at height %d for an upgrade this binary doesn't have; still serving queries. "+
+				"Restart with the upgraded binary, or set UPGRADE_ALLOW_AT or UPGRADE_SKIP_HEIGHTS: %v", r.mm.GetCurrentHeight(), injectErr)
+			<-r.stopping
+			break
+		} else if injectErr != nil {
+			r.recordFailure(feed.Block.Height, injectErr.Error())
+			r.writeCrashReport(feed.Block, injectErr)
+
+			// rollback last block
+			if rollbackBatch != nil {
+				fmt.Println("rollback previous block")
+				rollbackBatch.WriteSync()
+				rollbackBatch.Close()
+			}
+
+			debug.PrintStack()
+			panic(injectErr)
+		}
+
+		// last block is okay -> dispose rollback batch
+		if rollbackBatch != nil {
+			rollbackBatch.Close()
+			rollbackBatch = nil
+		}
+
+		// indexed once flushed; its events are published, and consumers notified, once it's indexed
+		block, blockID, evc := feed.Block, feed.BlockID, r.mm.GetCurrentEventCollector()
+		notify := r.notifyOnceIndexed(block, blockID, r.mm.GetCurrentState().AppHash)
+		heldIndexJobs = append(heldIndexJobs, func() error {
+			return r.indexer.EnqueueThen(block, blockID, evc, func() {
+				r.events.Publish(mantlemint.NewBlockEvents(block, evc))
+				if notify != nil {
+					notify()
+				}
+			})
+		})
+		heldWebsocketEvents = append(heldWebsocketEvents, newWebsocketEvents(block, evc)...)
+		if r.divergence != nil {
+			r.divergence.Observe(feed.Block.Height, r.mm.GetCurrentState().AppHash)
+		}
+		if r.results != nil {
+			r.results.Observe(evc)
+		}
+
+		// record checkpoint in the same batch, so it's flushed atomically with the block
+		if checkpointErr := blockFeeder.SaveCheckpoint(r.batched, &blockFeeder.Checkpoint{
+			Height:  feed.Block.Height,
+			BlockID: feed.BlockID,
+		}); checkpointErr != nil {
+			debug.PrintStack()
+			panic(checkpointErr)
+		}
+
+		// flush db batch, unless catching up and there's room for more blocks
+		heldBlocks++
+		heldHeight, heldTime = feed.Block.Height, feed.Block.Time
+		r.batchedOrigin.Hold()
+		if !catchingUp(feed.Block.Height) ||
+			heldBlocks >= r.config.CatchUpFlushBlocks ||
+			r.batchedOrigin.PendingBytes() >= r.config.CatchUpFlushBytes {
+			timings.Flush, timings.Indexer = flush()
+		}
+
+		r.hldb.ClearWriteHeight()
+		r.observeTimings(timings)
+	}
+
+	// flush what's held; then nothing to revert
+	flush()
+	if rollbackBatch != nil {
+		rollbackBatch.Close()
+	}
+}
+
+// observeTimings completes the timings of a block with those of the executor, records them, and logs them
+// should the block be slow
+func (r *Runner) observeTimings(timings mantlemint.BlockTimings) {
+	executed := r.timer.Timings()
+	timings.BeginBlock, timings.DeliverTxs, timings.EndBlock, timings.Commit =
+		executed.BeginBlock, executed.DeliverTxs, executed.EndBlock, executed.Commit
+	if evc := r.mm.GetCurrentEventCollector(); evc != nil {
+		for _, result := range evc.ResponseDeliverTxs {
+			timings.GasUsed += result.GasUsed
+		}
+	}
+
+	mantlemint.ObserveBlockTimings(timings)
+	if total := timings.Total(); total >= r.config.SlowBlockThreshold {
+		log.Printf("[v0.34.x/sync] slow block %d took %s: fetch_wait=%s begin_block=%s deliver_tx=%s end_block=%s commit=%s flush=%s indexer=%s txs=%d gas_used=%d",
+			timings.Height, total, timings.FetchWait, timings.BeginBlock, timings.DeliverTxs, timings.EndBlock, timings.Commit,
+			timings.Flush, timings.Indexer, timings.Txs, timings.GasUsed)
+	}
+}
+
+// injectBlock injects block, recording a panic of the app on it as a failure before going down
+func (r *Runner) injectBlock(block *tendermint.Block) error {
+	defer func() {
+		if p := recover(); p != nil {
+			r.recordFailure(block.Height, fmt.Sprint(p))
+			panic(p)
+		}
+	}()
+
+	return r.mm.Inject(block)
+}
+
+// recordFailure records that the block at height failed to inject, for it to be quarantined should it keep failing;
+// failing to do so is only logged
+func (r *Runner) recordFailure(height int64, failure string) {
+	if err := r.quarantine.RecordFailure(height, failure); err != nil {
+		log.Printf("[v0.34.x/sync] failed to record failure of block %d: %v", height, err)
+	}
+}
+
+// waitUnlessStopping blocks on wait, unless stopping comes first; it returns whether wait returned
+func waitUnlessStopping(wait func(), stopping <-chan struct{}) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-stopping:
+		return false
+	}
+}
+
+// writeCrashReport writes what's known of the state around a block that failed to inject to $HOME,
+// before mantlemint goes down; failing to do so is only logged
+func (r *Runner) writeCrashReport(block *tendermint.Block, injectErr error) {
+	report := mantlemint.NewCrashReport(
+		r.mm.GetCurrentState(),
+		state.NewStore(r.batched, state.StoreOptions{DiscardABCIResponses: false}),
+		r.mm.GetCurrentEventCollector(),
+		r.cms.LastCommitStoreHashes(),
+		block,
+		injectErr,
+	)
+	report.Logs = r.logTail.Lines()
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("[v0.34.x/sync] failed to write crash report: %v", err)
+		return
+	}
+	if path, err := report.Write(home); err != nil {
+		log.Printf("[v0.34.x/sync] failed to write crash report: %v", err)
+	} else {
+		log.Printf("[v0.34.x/sync] crash report written to %s", path)
+	}
+}
+
+// LoadGenesisDoc loads the genesis at genesisPath, which must be of chainID; errors are StartupErrors
+func LoadGenesisDoc(genesisPath string, chainID string) (*tendermint.GenesisDoc, error) {
+	jsonBlob, err := os.ReadFile(genesisPath)
+	if err != nil {
+		return nil, &config.StartupError{Code: config.ExitInvalidGenesis, Err: fmt.Errorf("GENESIS_PATH can't be read: %w", err)}
+	}
+	shasum := sha1.New()
+	shasum.Write(jsonBlob)
+	sum := hex.EncodeToString(shasum.Sum(nil))
+
+	log.Printf("[v0.34.x/sync] genesis shasum=%s", sum)
+
+	if genesis, genesisErr := tendermint.GenesisDocFromJSON(jsonBlob); genesisErr != nil {
+		return nil, &config.StartupError{Code: config.ExitInvalidGenesis, Err: fmt.Errorf("GENESIS_PATH(%s) is not a valid genesis: %w", genesisPath, genesisErr)}
+	} else if genesis.ChainID != chainID {
+		return nil, &config.StartupError{Code: config.ExitChainIDMismatch, Err: fmt.Errorf("genesis %s is for chain %s, but CHAIN_ID is %s", genesisPath, genesis.ChainID, chainID)}
+	} else {
+		return genesis, nil
+	}
+}
+
+func newAggregateFeed(checkpoint *blockFeeder.Checkpoint, mantlemintConfig *config.Config) *blockFeeder.AggregateSubscription {
+	return blockFeeder.NewAggregateBlockFeed(
+		checkpoint,
+		mantlemintConfig.RPCEndpoints,
+		mantlemintConfig.WSEndpoints,
+		&blockFeeder.AggregateFeedConfig{
+			ReconnectBaseDelay:  mantlemintConfig.WSReconnectBaseDelay,
+			ReconnectMaxDelay:   mantlemintConfig.WSReconnectMaxDelay,
+			PingInterval:        mantlemintConfig.WSPingInterval,
+			PongTimeout:         mantlemintConfig.WSPongTimeout,
+			EndpointCooldown:    mantlemintConfig.RPCEndpointCooldown,
+			PrefetchWindow:      mantlemintConfig.RPCPrefetchWindow,
+			PrefetchWorkers:     mantlemintConfig.RPCPrefetchWorkers,
+			PollInterval:        mantlemintConfig.RPCPollInterval,
+			RequestTimeout:      mantlemintConfig.RPCRequestTimeout,
+			MaxRetries:          mantlemintConfig.RPCMaxRetries,
+			RetryBackoff:        mantlemintConfig.RPCRetryBackoff,
+			SyncedThreshold:     mantlemintConfig.SyncedThreshold,
+			StallThreshold:      mantlemintConfig.FeedStallThreshold,
+			BufferSize:          mantlemintConfig.FeedBufferSize,
+			Headers:             mantlemintConfig.FeedEndpointHeaders,
+			ProxyURL:            mantlemintConfig.FeedProxyURL,
+			Compression:         mantlemintConfig.RPCCompression,
+			Quorum:              mantlemintConfig.FeedQuorum,
+			QuorumTimeout:       mantlemintConfig.FeedQuorumTimeout,
+			LocalBlockStorePath: mantlemintConfig.LocalBlockStorePath,
+			BlockArchivePath:    mantlemintConfig.BlockArchivePath,
+			ObjectArchive:       objectArchiveConfig(mantlemintConfig),
+			GRPCEndpoint:        mantlemintConfig.GRPCFeedEndpoint,
+			GRPCTLS: blockFeeder.GRPCTLSConfig{
+				Enabled:            mantlemintConfig.GRPCFeedTLS,
+				CAFile:             mantlemintConfig.GRPCFeedTLSCAFile,
+				InsecureSkipVerify: mantlemintConfig.GRPCFeedTLSInsecureSkipVerify,
+			},
+			GRPCStreamMethod: mantlemintConfig.GRPCFeedStreamMethod,
+		},
+	)
+}
+
+// objectArchiveConfig returns the object store block archive to catch up from, or nil if there's none
+func objectArchiveConfig(mantlemintConfig *config.Config) *blockFeeder.ObjectStoreConfig {
+	if mantlemintConfig.BlockArchiveURL == "" {
+		return nil
+	}
+
+	return &blockFeeder.ObjectStoreConfig{
+		URL:                mantlemintConfig.BlockArchiveURL,
+		Concurrency:        mantlemintConfig.BlockArchiveConcurrency,
+		S3Region:           mantlemintConfig.BlockArchiveS3Region,
+		S3Endpoint:         mantlemintConfig.BlockArchiveS3Endpoint,
+		S3AccessKeyID:      mantlemintConfig.BlockArchiveS3AccessKeyID,
+		S3SecretAccessKey:  mantlemintConfig.BlockArchiveS3SecretAccessKey,
+		GCSCredentialsFile: mantlemintConfig.BlockArchiveGCSCredentialsFile,
+	}
+}
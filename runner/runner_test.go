@@ -0,0 +1,398 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	terra "github.com/terra-money/core/v2/app"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/indexer"
+	"github.com/terra-money/mantlemint/mantlemint"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+// fakeFeed delivers the blocks sent to it, with the upstream tip at a fixed height
+type fakeFeed struct {
+	blocks   chan *blockFeeder.BlockResult
+	upstream int64
+}
+
+func (f *fakeFeed) Subscribe(_ int64) (chan *blockFeeder.BlockResult, error) {
+	return f.blocks, nil
+}
+
+func (f *fakeFeed) Close(_ context.Context) error {
+	return nil
+}
+
+func (f *fakeFeed) Errors() <-chan error {
+	return nil
+}
+
+func (f *fakeFeed) SyncStatus() blockFeeder.SyncStatus {
+	return blockFeeder.SyncStatus{UpstreamHeight: f.upstream}
+}
+
+// stubExecutor applies every block, moving the state to its height
+type stubExecutor struct{}
+
+func (stubExecutor) ApplyBlock(lastState state.State, _ tendermint.BlockID, block *tendermint.Block) (state.State, int64, error) {
+	lastState.LastBlockHeight = block.Height
+	return lastState, block.Height, nil
+}
+
+func (stubExecutor) SetEventBus(_ tendermint.BlockEventPublisher) {}
+
+func TestRunnerInject(t *testing.T) {
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+	batched := safe_batch.NewSafeBatchDB(hldb)
+	indexerInstance, err := indexer.NewIndexer("indexer", t.TempDir(), nil)
+	assert.Nil(t, err)
+	quarantine, err := mantlemint.NewQuarantine(ldb, 3)
+	assert.Nil(t, err)
+
+	// far behind the tip, so blocks are flushed 3 at a time
+	feed := &fakeFeed{blocks: make(chan *blockFeeder.BlockResult, 5), upstream: 1000}
+	r := &Runner{
+		config:          &config.Config{CatchUpLag: 100, CatchUpFlushBlocks: 3, CatchUpFlushBytes: 1 << 20, SlowBlockThreshold: time.Second},
+		ldb:             ldb,
+		hldb:            hldb,
+		batched:         batched,
+		batchedOrigin:   batched.(safe_batch.SafeBatchDBCloser),
+		mm:              mantlemint.NewMantlemint(batched, nil, stubExecutor{}, nil, nil),
+		feed:            feed,
+		indexer:         indexerInstance,
+		pauser:          mantlemint.NewPauser(),
+		halter:          mantlemint.NewHalter(0),
+		quarantine:      quarantine,
+		events:          mantlemint.NewEventStream(10),
+		timer:           mantlemint.NewExecutionTimer(),
+		cacheInvalidate: make(chan int64),
+		websocket:       rpc.NewWebsocketHub(rpc.WebsocketConfig{}),
+		stopping:        make(chan struct{}),
+	}
+
+	// the latest block has moved on along with the height by the time the cache is invalidated; blocks after the
+	// first flush are only fed once it's checked, for the runner not to have moved on meanwhile
+	genesisTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	feedBlocks := func(from, to int64) {
+		for height := from; height <= to; height++ {
+			feed.blocks <- &blockFeeder.BlockResult{
+				Block:   &tendermint.Block{Header: tendermint.Header{Height: height, Time: genesisTime.Add(time.Duration(height) * time.Second)}},
+				BlockID: &tendermint.BlockID{},
+			}
+		}
+	}
+	var invalidated []int64
+	var latest []time.Time
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for height := range r.cacheInvalidate {
+			invalidated = append(invalidated, height)
+			assert.Equal(t, height, r.LatestBlock().Height)
+			latest = append(latest, r.LatestBlock().Time)
+			if height == 3 {
+				feedBlocks(4, 5)
+				close(feed.blocks)
+			}
+		}
+	}()
+	feedBlocks(1, 3)
+
+	r.inject(feed.blocks)
+	close(r.cacheInvalidate)
+	<-drained
+
+	// what's held when the feed closes is flushed too
+	assert.Equal(t, []int64{3, 5}, invalidated)
+	assert.Equal(t, []time.Time{genesisTime.Add(3 * time.Second), genesisTime.Add(5 * time.Second)}, latest)
+	assert.Equal(t, int64(5), r.Height())
+	assert.Greater(t, r.syncStatus().Staleness, float64(0))
+
+	checkpoint, err := blockFeeder.LoadCheckpoint(hldb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), checkpoint.Height)
+
+	// every block is written at its own height
+	hldb.SetReadHeight(2)
+	checkpoint, err = blockFeeder.LoadCheckpoint(hldb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), checkpoint.Height)
+}
+
+// upgradeExecutor applies blocks up to an upgrade height, where the app has no handler for the plan
+type upgradeExecutor struct {
+	upgradeHeight int64
+}
+
+func (e upgradeExecutor) ApplyBlock(lastState state.State, blockID tendermint.BlockID, block *tendermint.Block) (state.State, int64, error) {
+	if block.Height == e.upgradeHeight {
+		panic(`UPGRADE "v2.5" NEEDED at height: 3: {}`)
+	}
+	return stubExecutor{}.ApplyBlock(lastState, blockID, block)
+}
+
+func (upgradeExecutor) SetEventBus(_ tendermint.BlockEventPublisher) {}
+
+func TestRunnerInjectHaltsAtUpgrade(t *testing.T) {
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+	batched := safe_batch.NewSafeBatchDB(hldb)
+	indexerInstance, err := indexer.NewIndexer("indexer", t.TempDir(), nil)
+	assert.Nil(t, err)
+	quarantine, err := mantlemint.NewQuarantine(ldb, 3)
+	assert.Nil(t, err)
+
+	feed := &fakeFeed{blocks: make(chan *blockFeeder.BlockResult, 5), upstream: 5}
+	r := &Runner{
+		config:          &config.Config{SlowBlockThreshold: time.Second},
+		ldb:             ldb,
+		hldb:            hldb,
+		batched:         batched,
+		batchedOrigin:   batched.(safe_batch.SafeBatchDBCloser),
+		mm:              mantlemint.NewMantlemint(batched, nil, upgradeExecutor{upgradeHeight: 3}, nil, nil),
+		feed:            feed,
+		indexer:         indexerInstance,
+		pauser:          mantlemint.NewPauser(),
+		halter:          mantlemint.NewHalter(0),
+		quarantine:      quarantine,
+		events:          mantlemint.NewEventStream(10),
+		timer:           mantlemint.NewExecutionTimer(),
+		cacheInvalidate: make(chan int64, 5),
+		websocket:       rpc.NewWebsocketHub(rpc.WebsocketConfig{}),
+		stopping:        make(chan struct{}),
+	}
+
+	for height := int64(1); height <= 5; height++ {
+		feed.blocks <- &blockFeeder.BlockResult{
+			Block:   &tendermint.Block{Header: tendermint.Header{Height: height}},
+			BlockID: &tendermint.BlockID{},
+		}
+	}
+	close(feed.blocks)
+
+	// halted short of the upgrade height until stopped, instead of going down
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.inject(feed.blocks)
+	}()
+	select {
+	case <-done:
+		t.Fatal("injection went on past the upgrade height")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(r.stopping)
+	<-done
+
+	assert.Equal(t, int64(2), r.Height())
+	checkpoint, err := blockFeeder.LoadCheckpoint(hldb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), checkpoint.Height)
+}
+
+func TestRunnerEventsOnceIndexed(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+
+	// subscribers get the events of the block once it's indexed, never before
+	var publishedWhileIndexing *mantlemint.BlockEvents
+	r.indexer.RegisterIndexerService("probe", func(_ safe_batch.SafeBatchDB, _ *tendermint.Block, _ *tendermint.BlockID, _ *mantlemint.EventCollector, _ *terra.TerraApp) error {
+		publishedWhileIndexing = r.Events().Latest()
+		return nil
+	})
+	events, unsubscribe := r.Events().Subscribe(1)
+	defer unsubscribe()
+	injectNextBlock(t, r, privKey)
+	select {
+	case blockEvents := <-events:
+		assert.Equal(t, int64(5_000_001), blockEvents.Height)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no events published")
+	}
+	assert.Nil(t, publishedWhileIndexing)
+}
+
+// gatedExecutor applies blocks as stubExecutor does, each once released, telling the height it's applying
+type gatedExecutor struct {
+	applying chan int64
+	release  chan struct{}
+}
+
+func (e gatedExecutor) ApplyBlock(lastState state.State, blockID tendermint.BlockID, block *tendermint.Block) (state.State, int64, error) {
+	e.applying <- block.Height
+	<-e.release
+	return stubExecutor{}.ApplyBlock(lastState, blockID, block)
+}
+
+func (gatedExecutor) SetEventBus(_ tendermint.BlockEventPublisher) {}
+
+// closeRecordingDB records when it's closed
+type closeRecordingDB struct {
+	hld.HeightLimitEnabledDB
+	record func(string)
+}
+
+func (db closeRecordingDB) Close() error {
+	db.record("closed db")
+	return db.HeightLimitEnabledDB.Close()
+}
+
+func TestRunnerStopInFlight(t *testing.T) {
+	var mtx sync.Mutex
+	var steps []string
+	record := func(step string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		steps = append(steps, step)
+	}
+
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+	batched := safe_batch.NewSafeBatchDB(hldb)
+	indexerInstance, err := indexer.NewIndexer("indexer", t.TempDir(), nil)
+	assert.Nil(t, err)
+	// indexed in the background, slowly enough to still be queued once injection stops
+	indexerInstance.RegisterIndexerService("slow", func(_ safe_batch.SafeBatchDB, block *tendermint.Block, _ *tendermint.BlockID, _ *mantlemint.EventCollector, _ *terra.TerraApp) error {
+		time.Sleep(100 * time.Millisecond)
+		record(fmt.Sprintf("indexed %d", block.Height))
+		return nil
+	})
+	indexerInstance.Start(10)
+	quarantine, err := mantlemint.NewQuarantine(ldb, 3)
+	assert.Nil(t, err)
+
+	executor := gatedExecutor{applying: make(chan int64, 3), release: make(chan struct{})}
+	feed := &fakeFeed{blocks: make(chan *blockFeeder.BlockResult, 3), upstream: 3}
+	r := &Runner{
+		config:          &config.Config{SlowBlockThreshold: time.Second, ShutdownTimeout: 10 * time.Second},
+		ldb:             closeRecordingDB{HeightLimitEnabledDB: ldb, record: record},
+		hldb:            hldb,
+		batched:         batched,
+		batchedOrigin:   batched.(safe_batch.SafeBatchDBCloser),
+		mm:              mantlemint.NewMantlemint(batched, nil, executor, nil, nil),
+		feed:            feed,
+		indexer:         indexerInstance,
+		pauser:          mantlemint.NewPauser(),
+		halter:          mantlemint.NewHalter(0),
+		quarantine:      quarantine,
+		events:          mantlemint.NewEventStream(10),
+		timer:           mantlemint.NewExecutionTimer(),
+		cacheInvalidate: make(chan int64, 3),
+		websocket:       rpc.NewWebsocketHub(rpc.WebsocketConfig{}),
+		stopping:        make(chan struct{}),
+	}
+	for height := int64(1); height <= 3; height++ {
+		feed.blocks <- &blockFeeder.BlockResult{
+			Block:   &tendermint.Block{Header: tendermint.Header{Height: height}},
+			BlockID: &tendermint.BlockID{},
+		}
+	}
+	r.run(context.Background(), func() { r.inject(feed.blocks) })
+
+	// stopped while block 1 is being applied
+	assert.Equal(t, int64(1), <-executor.applying)
+	stopped := make(chan error)
+	go func() { stopped <- r.Stop(context.Background()) }()
+	assert.Eventually(t, r.shuttingDown.Load, time.Second, time.Millisecond)
+	close(executor.release)
+	assert.Nil(t, <-stopped)
+
+	// the block in flight is finished and flushed, the next ones left in the feed, and the indexer drained before
+	// the dbs are closed
+	assert.Equal(t, int64(1), r.Height())
+	assert.Equal(t, int64(1), indexerInstance.Watermark())
+	assert.Equal(t, []string{"indexed 1", "closed db"}, steps)
+	assert.Len(t, feed.blocks, 2)
+}
+
+// deliveredFeed reports every block up to the upstream as delivered, i.e. synced, whether taken or still buffered
+type deliveredFeed struct {
+	*fakeFeed
+	syncedThreshold int64
+}
+
+func (f deliveredFeed) SyncStatus() blockFeeder.SyncStatus {
+	return blockFeeder.SyncStatus{
+		Height:          f.upstream,
+		UpstreamHeight:  f.upstream,
+		Synced:          true,
+		SyncedThreshold: f.syncedThreshold,
+		Buffered:        len(f.blocks),
+	}
+}
+
+func TestRunnerSyncStatusBuffered(t *testing.T) {
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{})
+	batched := safe_batch.NewSafeBatchDB(hldb)
+	indexerInstance, err := indexer.NewIndexer("indexer", t.TempDir(), nil)
+	assert.Nil(t, err)
+	quarantine, err := mantlemint.NewQuarantine(ldb, 3)
+	assert.Nil(t, err)
+
+	executor := gatedExecutor{applying: make(chan int64, 6), release: make(chan struct{})}
+	feed := deliveredFeed{fakeFeed: &fakeFeed{blocks: make(chan *blockFeeder.BlockResult, 6), upstream: 6}, syncedThreshold: 2}
+	r := &Runner{
+		config:          &config.Config{SlowBlockThreshold: time.Second},
+		ldb:             ldb,
+		hldb:            hldb,
+		batched:         batched,
+		batchedOrigin:   batched.(safe_batch.SafeBatchDBCloser),
+		mm:              mantlemint.NewMantlemint(batched, nil, executor, nil, nil),
+		feed:            feed,
+		indexer:         indexerInstance,
+		pauser:          mantlemint.NewPauser(),
+		halter:          mantlemint.NewHalter(0),
+		quarantine:      quarantine,
+		events:          mantlemint.NewEventStream(10),
+		timer:           mantlemint.NewExecutionTimer(),
+		cacheInvalidate: make(chan int64, 6),
+		websocket:       rpc.NewWebsocketHub(rpc.WebsocketConfig{}),
+		stopping:        make(chan struct{}),
+	}
+	r.setLatest(0, time.Time{})
+	for height := int64(1); height <= 6; height++ {
+		feed.blocks <- &blockFeeder.BlockResult{
+			Block:   &tendermint.Block{Header: tendermint.Header{Height: height}},
+			BlockID: &tendermint.BlockID{},
+		}
+	}
+	injected := make(chan struct{})
+	go func() {
+		defer close(injected)
+		r.inject(feed.blocks)
+	}()
+
+	// the feed delivered every block, but while they're buffered behind block 1, none is flushed
+	assert.Equal(t, int64(1), <-executor.applying)
+	syncStatus := r.syncStatus()
+	assert.Equal(t, int64(0), syncStatus.LatestHeight)
+	assert.Equal(t, 5, syncStatus.Buffered)
+	assert.Equal(t, int64(6), syncStatus.Lag)
+	assert.False(t, syncStatus.Synced)
+
+	// synced once flushed
+	close(executor.release)
+	close(feed.blocks)
+	<-injected
+	syncStatus = r.syncStatus()
+	assert.Equal(t, int64(6), syncStatus.LatestHeight)
+	assert.Equal(t, int64(0), syncStatus.Lag)
+	assert.True(t, syncStatus.Synced)
+	assert.Nil(t, indexerInstance.Close())
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/tx/signing"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/stretchr/testify/assert"
+	tmproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	terra "github.com/terra-money/core/v2/app"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestRunnerSimulate(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+
+	// txs with signer infos but no signatures can be simulated
+	address := sdk.AccAddress(privKey.PubKey().Address())
+	encodeTx := func(msg sdk.Msg) []byte {
+		txBuilder := r.codec.TxConfig.NewTxBuilder()
+		assert.Nil(t, txBuilder.SetMsgs(msg))
+		txBuilder.SetGasLimit(1_000_000)
+		assert.Nil(t, txBuilder.SetSignatures(signing.SignatureV2{
+			PubKey: secp256k1.GenPrivKey().PubKey(),
+			Data:   &signing.SingleSignatureData{SignMode: signing.SignMode_SIGN_MODE_DIRECT},
+		}))
+		txBytes, err := r.codec.TxConfig.TxEncoder()(txBuilder.GetTx())
+		assert.Nil(t, err)
+		return txBytes
+	}
+
+	gasInfo, result, err := r.Simulate(encodeTx(distrtypes.NewMsgSetWithdrawAddress(address, address)))
+	assert.Nil(t, err)
+	assert.NotZero(t, gasInfo.GasUsed)
+	assert.NotEmpty(t, result.Events)
+
+	// failures report the gas used up to them
+	gasInfo, _, err = r.Simulate(encodeTx(banktypes.NewMsgSend(address, address, sdk.NewCoins(sdk.NewInt64Coin("uluna", 1_000_000_000_000)))))
+	assert.ErrorContains(t, err, "insufficient funds")
+	assert.NotZero(t, gasInfo.GasUsed)
+
+	// nothing is written, not even to the state simulations branch off
+	app := r.app.(*terra.TerraApp)
+	account := app.AccountKeeper.GetAccount(app.NewContext(true, tmproto.Header{}), address)
+	assert.Equal(t, uint64(0), account.GetSequence())
+	assert.Nil(t, account.GetPubKey())
+	assert.Nil(t, r.indexer.Close())
+}
@@ -0,0 +1,272 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/mantlemint"
+)
+
+const (
+	// heightsFile is written to the home of a mantlemint syncing, for standbys following it (FOLLOW_HOME)
+	// to learn the heights it moves on to
+	heightsFile = "heights.json"
+
+	// heightsInterval is how often the heights file is written, besides on every flush;
+	// a standby tells the mantlemint it follows is gone after heightsStaleAfter without one
+	heightsInterval   = time.Second
+	heightsStaleAfter = 10 * heightsInterval
+)
+
+// heights is what's written to the heights file: the last height flushed, and the sync status as of then
+type heights struct {
+	Height     int64                  `json:"height"`
+	SyncStatus blockFeeder.SyncStatus `json:"sync_status"`
+	WrittenAt  time.Time              `json:"written_at"`
+}
+
+func writeHeights(home string, h heights) error {
+	heightsJSON, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	// renamed over the last one, for standbys never to read one half written
+	tmp := filepath.Join(home, heightsFile+".tmp")
+	if err := os.WriteFile(tmp, heightsJSON, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(home, heightsFile))
+}
+
+func readHeights(home string) (heights, error) {
+	var h heights
+	heightsJSON, err := os.ReadFile(filepath.Join(home, heightsFile))
+	if err != nil {
+		return h, err
+	}
+	return h, json.Unmarshal(heightsJSON, &h)
+}
+
+// writeHeights writes the heights file every heightsInterval, and on every flush, until stopping
+func (r *Runner) writeHeights() {
+	ticker := time.NewTicker(heightsInterval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		if err := writeHeights(r.config.Home, heights{Height: r.Height(), SyncStatus: r.syncStatus(), WrittenAt: time.Now()}); err != nil {
+			if err.Error() != lastErr {
+				log.Printf("[v0.34.x/sync] failed to write the heights file, standbys following won't move on: %v", err)
+			}
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+
+		select {
+		case <-r.stopping:
+			return
+		case <-r.flushed:
+		case <-ticker.C:
+		}
+	}
+}
+
+var _ Feed = (*standbyFeed)(nil)
+
+// standbyFeed stands in for the block feed of a standby (FOLLOW_HOME), which takes no blocks; its sync status
+// is that of the mantlemint followed, as last read off its heights file
+type standbyFeed struct {
+	home   string
+	height func() int64
+
+	mtx      sync.Mutex
+	followed heights
+}
+
+func (f *standbyFeed) Subscribe(_ int64) (chan *blockFeeder.BlockResult, error) {
+	return nil, fmt.Errorf("following %s, no blocks are taken", f.home)
+}
+
+func (f *standbyFeed) Close(_ context.Context) error {
+	return nil
+}
+
+func (f *standbyFeed) Errors() <-chan error {
+	return nil
+}
+
+func (f *standbyFeed) observe(followed heights) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.followed = followed
+}
+
+// SyncStatus is synced while the mantlemint followed is, and the standby has caught up with it
+func (f *standbyFeed) SyncStatus() blockFeeder.SyncStatus {
+	f.mtx.Lock()
+	followed := f.followed
+	f.mtx.Unlock()
+
+	syncStatus := followed.SyncStatus
+	syncStatus.Following = f.home
+	syncStatus.Height = f.height()
+	if syncStatus.UpstreamHeight != 0 {
+		syncStatus.Lag = syncStatus.UpstreamHeight - syncStatus.Height
+	}
+	syncStatus.Synced = syncStatus.Synced && syncStatus.Height >= followed.Height
+	if time.Since(followed.WrittenAt) > heightsStaleAfter {
+		syncStatus.Synced = false
+		syncStatus.Stalled = blockFeeder.StallFollowedGone
+	}
+	return syncStatus
+}
+
+// refreshable is a db followed off another mantlemint, as heleveldb.Driver opened with DriverConfig.Follow is
+type refreshable interface {
+	Refresh() error
+}
+
+// follow moves on to the heights the mantlemint followed flushes, as it tells them in its heights file,
+// until stopping
+func (r *Runner) follow(feed *standbyFeed) {
+	ticker := time.NewTicker(r.config.FollowPollInterval)
+	defer ticker.Stop()
+
+	var lastErr string
+	for {
+		select {
+		case <-r.stopping:
+			return
+		case <-ticker.C:
+		}
+
+		err := func() error {
+			followed, err := readHeights(r.config.FollowHome)
+			if err != nil {
+				return err
+			}
+			feed.observe(followed)
+			if followed.Height == r.Height() {
+				return nil
+			}
+			return r.refresh()
+		}()
+		if err != nil {
+			if err.Error() != lastErr {
+				log.Printf("[v0.34.x/standby] failed to follow %s, still serving queries at height %d: %v", r.config.FollowHome, r.Height(), err)
+			}
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+	}
+}
+
+// refresh moves on to what the mantlemint followed last flushed: the db and the index are read anew,
+// then the app loads its last commit
+func (r *Runner) refresh() error {
+	if err := r.ldb.(refreshable).Refresh(); err != nil {
+		return err
+	}
+	if err := r.indexer.Refresh(); err != nil {
+		return err
+	}
+
+	// the code of contracts stored up to then is in the wasm dir followed by now
+	if err := syncWasmCode(r.config.FollowHome, r.config.Home); err != nil {
+		return err
+	}
+
+	locker := mantlemint.Locker(r.appCreator)
+	locker.Lock()
+	err := r.cms.ReloadLastCommit()
+	locker.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := r.mm.LoadInitialState(); err != nil {
+		return err
+	}
+
+	height := r.cms.LatestVersion()
+	if previous := r.setLatest(height, r.mm.GetCurrentState().LastBlockTime); previous != height {
+		r.cacheInvalidate <- height
+	}
+	return nil
+}
+
+// syncWasmCode copies the code of contracts stored to the wasm dir of the mantlemint followed that's not in that
+// of the standby yet; a standby has a wasm dir of its own, as the wasm vm locks its dir. Code is only stored once,
+// named after its checksum (with a .wasm extension by later wasm vms), which what's copied is checked against
+// for code still being written.
+func syncWasmCode(followHome, home string) error {
+	src, dst := wasmCodeDir(followHome), wasmCodeDir(home)
+	entries, err := os.ReadDir(src)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		checksum, err := hex.DecodeString(strings.TrimSuffix(entry.Name(), ".wasm"))
+		if err != nil || !entry.Type().IsRegular() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dst, entry.Name())); err == nil {
+			continue
+		}
+		if err := copyWasmCode(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyWasmCode(src, dst string, checksum []byte) error {
+	code, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer code.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), code); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if sum := hash.Sum(nil); string(sum) != string(checksum) {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("wasm code %x is still being written", checksum)
+	}
+	return os.Rename(tmp, dst)
+}
+
+// wasmCodeDir is where the wasm vm of the app stores contract code, by checksum
+func wasmCodeDir(home string) string {
+	return filepath.Join(home, "data", "wasm", "state", "wasm")
+}
@@ -0,0 +1,65 @@
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+)
+
+func TestRunnerStandby(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	cfg.MantlemintDB = "mantlemint"
+	ldb, err := OpenDB(cfg)
+	assert.Nil(t, err)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+
+	// the standby follows the dbs of the mantlemint syncing, which holds their locks
+	standbyCfg := *cfg
+	standbyCfg.Home = t.TempDir()
+	standbyCfg.FollowHome = cfg.Home
+	standby, err := New(&standbyCfg, NewTerraAppProvider(&standbyCfg))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_001), standby.Height())
+	assert.Equal(t, int64(5_000_001), standby.app.LastBlockHeight())
+
+	// and moves on once refreshed
+	injectNextBlock(t, r, privKey)
+	assert.Equal(t, int64(5_000_001), standby.Height())
+	invalidated := make(chan int64, 1)
+	go func() {
+		invalidated <- <-standby.cacheInvalidate
+	}()
+	assert.Nil(t, standby.refresh())
+	assert.Equal(t, int64(5_000_002), <-invalidated)
+	assert.Equal(t, int64(5_000_002), standby.Height())
+	assert.Equal(t, int64(5_000_002), standby.app.LastBlockHeight())
+	res := standby.app.Query(abci.RequestQuery{Path: "/cosmos.auth.v1beta1.Query/Params"})
+	assert.Equal(t, uint32(0), res.Code, res.Log)
+	assert.Equal(t, int64(5_000_002), res.Height)
+
+	// it's synced along with the mantlemint it follows, while that one's around
+	feed := standby.feed.(*standbyFeed)
+	feed.observe(heights{Height: 5_000_002, SyncStatus: blockFeeder.SyncStatus{UpstreamHeight: 5_000_003, Synced: true}, WrittenAt: time.Now()})
+	syncStatus := standby.syncStatus()
+	assert.True(t, syncStatus.Synced)
+	assert.Equal(t, int64(1), syncStatus.Lag)
+	assert.Equal(t, cfg.Home, syncStatus.Following)
+	feed.observe(heights{Height: 5_000_003, SyncStatus: blockFeeder.SyncStatus{UpstreamHeight: 5_000_003, Synced: true}, WrittenAt: time.Now()})
+	assert.False(t, standby.syncStatus().Synced)
+	feed.observe(heights{Height: 5_000_002, SyncStatus: blockFeeder.SyncStatus{UpstreamHeight: 5_000_002, Synced: true}, WrittenAt: time.Now().Add(-time.Minute)})
+	assert.False(t, standby.syncStatus().Synced)
+	assert.Equal(t, blockFeeder.StallFollowedGone, standby.syncStatus().Stalled)
+
+	_, _, err = standby.Simulate(nil)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, standby.indexer.Close())
+	assert.Nil(t, standby.ldb.Close())
+	assert.Nil(t, r.indexer.Close())
+	assert.Nil(t, ldb.Close())
+}
@@ -0,0 +1,324 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	snapshots "github.com/cosmos/cosmos-sdk/snapshots"
+	snapshottypes "github.com/cosmos/cosmos-sdk/snapshots/types"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/proxy"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tendermint/version"
+	tmdb "github.com/tendermint/tm-db"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+)
+
+// a restore that did not complete leaves this file in MANTLEMINT_HOME, holding the snapshot height
+const stateSyncMarker = "statesync.height"
+
+// openStateSyncScratch creates the snapshot store the app restores through, i.e. where chunks are staged;
+// what's left of an earlier attempt is discarded
+func openStateSyncScratch(home string) *snapshots.Store {
+	dir := filepath.Join(home, "statesync")
+	if err := os.RemoveAll(dir); err != nil {
+		panic(err)
+	}
+
+	db, err := tmdb.NewGoLevelDB("metadata", dir)
+	if err != nil {
+		panic(err)
+	}
+	store, err := snapshots.NewStore(db, dir)
+	if err != nil {
+		panic(err)
+	}
+	return store
+}
+
+// stateSync bootstraps empty state from a snapshot of terrad's snapshot store, instead of genesis:
+// the app restores it chunk by chunk at the snapshot height, and tendermint state at that height
+// is built from the rpc endpoints, for the feed to go on from the next block.
+//
+// Snapshots are read from a local copy of the store, at STATE_SYNC_SNAPSHOT_DIR, rather than fetched from the rpc
+// endpoints along with the state: tendermint only serves snapshot metadata and chunks to peers over p2p, not over rpc.
+//
+// An interrupted restore is retried on the next start, as long as it's for the same snapshot.
+func stateSync(
+	snapshotConn proxy.AppConnSnapshot,
+	hldb *hld.HeightLimitedDB,
+	db safe_batch.SafeBatchDBCloser,
+	genesisDoc *tendermint.GenesisDoc,
+	mantlemintConfig *config.Config,
+) {
+	stateStore := state.NewStore(db, state.StoreOptions{DiscardABCIResponses: false})
+	if lastState, err := stateStore.Load(); err != nil {
+		panic(err)
+	} else if lastState.LastBlockHeight != 0 {
+		log.Printf("[v0.34.x/statesync] state is at height %d already, not restoring a snapshot", lastState.LastBlockHeight)
+		return
+	}
+
+	source, closeSource := openSnapshotSource(mantlemintConfig.StateSyncSnapshotDir)
+	defer closeSource()
+
+	var snapshot *snapshottypes.Snapshot
+	var err error
+	if mantlemintConfig.StateSyncHeight != 0 {
+		snapshot, err = source.Get(uint64(mantlemintConfig.StateSyncHeight), snapshottypes.CurrentFormat)
+	} else {
+		snapshot, err = source.GetLatest()
+	}
+	if err != nil {
+		panic(err)
+	} else if snapshot == nil {
+		panic(fmt.Errorf("no snapshot to restore in %s", mantlemintConfig.StateSyncSnapshotDir))
+	}
+	height := int64(snapshot.Height)
+
+	// keys of another snapshot would be left over at another height, so only the same one can be retried
+	marker := filepath.Join(mantlemintConfig.Home, stateSyncMarker)
+	if previous, err := os.ReadFile(marker); err == nil && string(previous) != strconv.FormatInt(height, 10) {
+		panic(fmt.Errorf("restoring the snapshot at height %s was interrupted; set STATE_SYNC_HEIGHT=%s to retry it, "+
+			"or start over with an empty MANTLEMINT_DB", previous, previous))
+	}
+	if err := os.WriteFile(marker, []byte(strconv.FormatInt(height, 10)), 0o644); err != nil {
+		panic(err)
+	}
+
+	// fetched first, so that a restore isn't wasted on heights the rpc can't serve
+	lastState, err := fetchStateSyncState(mantlemintConfig.RPCEndpoints, genesisDoc, height)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Printf("[v0.34.x/statesync] restoring snapshot at height %d, %d chunks", height, snapshot.Chunks)
+	hldb.SetWriteHeight(height)
+	db.Open()
+	if err := restoreSnapshot(snapshotConn, source, snapshot, lastState.AppHash); err != nil {
+		panic(fmt.Errorf("failed to restore snapshot at height %d, restart to retry: %v", height, err))
+	}
+
+	if err := stateStore.Bootstrap(lastState); err != nil {
+		panic(err)
+	}
+	if err := blockFeeder.SaveCheckpoint(db, &blockFeeder.Checkpoint{Height: height, BlockID: &lastState.LastBlockID}); err != nil {
+		panic(err)
+	}
+
+	// flush to db; the marker is only removed once it's all in
+	if rollback, err := db.Flush(); err != nil {
+		panic(err)
+	} else if rollback != nil {
+		rollback.Close()
+	}
+	hldb.ClearWriteHeight()
+
+	if err := os.Remove(marker); err != nil {
+		panic(err)
+	}
+	log.Printf("[v0.34.x/statesync] restored snapshot at height %d, app hash %X", height, lastState.AppHash)
+}
+
+// assertNoPartialStateSync refuses to sync from genesis over what's left of a restore that did not complete,
+// as its keys would show through once syncing reaches the snapshot height
+func assertNoPartialStateSync(home string) {
+	if height, err := os.ReadFile(filepath.Join(home, stateSyncMarker)); err == nil {
+		panic(fmt.Errorf("restoring the snapshot at height %s was interrupted; set STATE_SYNC_SNAPSHOT_DIR to retry it, "+
+			"or start over with an empty MANTLEMINT_DB", height))
+	}
+}
+
+// openSnapshotSource opens a snapshot store as terrad writes it, i.e. ${TERRA_HOME}/data/snapshots
+func openSnapshotSource(dir string) (*snapshots.Store, func()) {
+	db, err := tmdb.NewGoLevelDBWithOpts("metadata", dir, &opt.Options{ReadOnly: true})
+	if err != nil {
+		panic(fmt.Errorf("failed to open snapshots at %s: %v", dir, err))
+	}
+	store, err := snapshots.NewStore(db, dir)
+	if err != nil {
+		panic(err)
+	}
+	return store, func() { _ = db.Close() }
+}
+
+// restoreSnapshot feeds snapshot chunks to the app, as tendermint would over state sync
+func restoreSnapshot(snapshotConn proxy.AppConnSnapshot, source *snapshots.Store, snapshot *snapshottypes.Snapshot, appHash []byte) error {
+	abciSnapshot, err := snapshot.ToABCI()
+	if err != nil {
+		return err
+	}
+
+	offer, err := snapshotConn.OfferSnapshotSync(abci.RequestOfferSnapshot{Snapshot: &abciSnapshot, AppHash: appHash})
+	if err != nil {
+		return err
+	} else if offer.Result != abci.ResponseOfferSnapshot_ACCEPT {
+		return fmt.Errorf("snapshot was not accepted: %s", offer.Result)
+	}
+
+	for index := uint32(0); index < snapshot.Chunks; index++ {
+		chunk, err := loadChunk(source, snapshot, index)
+		if err != nil {
+			return err
+		}
+
+		applied, err := snapshotConn.ApplySnapshotChunkSync(abci.RequestApplySnapshotChunk{Index: index, Chunk: chunk, Sender: "local"})
+		if err != nil {
+			return err
+		}
+		switch applied.Result {
+		case abci.ResponseApplySnapshotChunk_ACCEPT:
+		case abci.ResponseApplySnapshotChunk_RETRY:
+			// there's no other peer to refetch it from
+			return fmt.Errorf("chunk %d does not match its hash in the snapshot metadata", index)
+		default:
+			return fmt.Errorf("chunk %d was not applied: %s", index, applied.Result)
+		}
+
+		if (index+1)%100 == 0 {
+			log.Printf("[v0.34.x/statesync] %d/%d chunks applied", index+1, snapshot.Chunks)
+		}
+	}
+
+	return nil
+}
+
+func loadChunk(source *snapshots.Store, snapshot *snapshottypes.Snapshot, index uint32) ([]byte, error) {
+	reader, err := source.LoadChunk(snapshot.Height, snapshot.Format, index)
+	if err != nil {
+		return nil, err
+	} else if reader == nil {
+		return nil, fmt.Errorf("chunk %d of the snapshot is missing", index)
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// fetchStateSyncState builds tendermint state as of height from the first rpc endpoint that can serve it,
+// the way tendermint's state sync does from light blocks
+func fetchStateSyncState(endpoints []string, genesisDoc *tendermint.GenesisDoc, height int64) (state.State, error) {
+	var errs []error
+	for _, endpoint := range endpoints {
+		lastState, err := fetchState(endpoint, genesisDoc, height)
+		if err == nil {
+			return lastState, nil
+		}
+		log.Printf("[v0.34.x/statesync] failed to fetch state at height %d: %v", height, err)
+		errs = append(errs, err)
+	}
+
+	return state.State{}, fmt.Errorf("no rpc endpoint could serve state at height %d: %v", height, errs)
+}
+
+func fetchState(endpoint string, genesisDoc *tendermint.GenesisDoc, height int64) (state.State, error) {
+	client, err := rpchttp.New(endpoint, "/websocket")
+	if err != nil {
+		return state.State{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// state at height takes the next block's header and commit, and the validators of the block after, which the
+	// rpc only serves once that one is in
+	status, err := client.Status(ctx)
+	if err != nil {
+		return state.State{}, err
+	}
+	if latest := status.SyncInfo.LatestBlockHeight; latest < height+2 {
+		return state.State{}, fmt.Errorf("the chain is at height %d, too close to the snapshot: its state takes the validators "+
+			"of height %d; retry once that block is in", latest, height+2)
+	}
+
+	lastCommit, err := client.Commit(ctx, &height)
+	if err != nil {
+		return state.State{}, err
+	}
+	nextHeight := height + 1
+	nextCommit, err := client.Commit(ctx, &nextHeight)
+	if err != nil {
+		return state.State{}, err
+	}
+	lastHeader, nextHeader := lastCommit.Header, nextCommit.Header
+
+	var validatorSets [3]*tendermint.ValidatorSet
+	for i := range validatorSets {
+		if validatorSets[i], err = fetchValidatorSet(ctx, client, height+int64(i)); err != nil {
+			return state.State{}, err
+		}
+	}
+	lastValidators, validators, nextValidators := validatorSets[0], validatorSets[1], validatorSets[2]
+
+	// the rpc is trusted for the state, but it must at least be consistent
+	switch {
+	case !bytes.Equal(lastHeader.ValidatorsHash, lastValidators.Hash()):
+		return state.State{}, fmt.Errorf("validators at height %d don't match the header", height)
+	case !bytes.Equal(nextHeader.ValidatorsHash, validators.Hash()):
+		return state.State{}, fmt.Errorf("validators at height %d don't match the header", nextHeight)
+	case !bytes.Equal(nextHeader.NextValidatorsHash, nextValidators.Hash()):
+		return state.State{}, fmt.Errorf("next validators at height %d don't match the header", nextHeight)
+	}
+	if err := validators.VerifyCommitLight(genesisDoc.ChainID, nextCommit.Commit.BlockID, nextHeight, nextCommit.Commit); err != nil {
+		return state.State{}, fmt.Errorf("commit at height %d: %v", nextHeight, err)
+	}
+
+	consensusParams, err := client.ConsensusParams(ctx, &nextHeight)
+	if err != nil {
+		return state.State{}, err
+	}
+
+	lastState := state.State{
+		ChainID:       genesisDoc.ChainID,
+		InitialHeight: genesisDoc.InitialHeight,
+
+		LastBlockHeight: height,
+		LastBlockID:     nextHeader.LastBlockID,
+		LastBlockTime:   lastHeader.Time,
+
+		NextValidators:              nextValidators,
+		Validators:                  validators,
+		LastValidators:              lastValidators,
+		LastHeightValidatorsChanged: nextHeight,
+
+		ConsensusParams:                  consensusParams.ConsensusParams,
+		LastHeightConsensusParamsChanged: nextHeight,
+
+		// the next header carries the results and app hash of the snapshot height
+		LastResultsHash: nextHeader.LastResultsHash,
+		AppHash:         nextHeader.AppHash,
+	}
+	lastState.Version.Consensus = nextHeader.Version
+	lastState.Version.Software = version.TMCoreSemVer
+
+	return lastState, nil
+}
+
+func fetchValidatorSet(ctx context.Context, client *rpchttp.HTTP, height int64) (*tendermint.ValidatorSet, error) {
+	var validators []*tendermint.Validator
+	perPage := 100
+	for page := 1; ; page++ {
+		result, err := client.Validators(ctx, &height, &page, &perPage)
+		if err != nil {
+			return nil, err
+		}
+		validators = append(validators, result.Validators...)
+		if len(validators) >= result.Total || len(result.Validators) == 0 {
+			break
+		}
+	}
+
+	return tendermint.NewValidatorSet(validators), nil
+}
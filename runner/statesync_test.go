@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	"github.com/cosmos/cosmos-sdk/snapshots"
+	snapshottypes "github.com/cosmos/cosmos-sdk/snapshots/types"
+	sdkrootmulti "github.com/cosmos/cosmos-sdk/store/rootmulti"
+	storetypes "github.com/cosmos/cosmos-sdk/store/types"
+	"github.com/stretchr/testify/assert"
+	abcicli "github.com/tendermint/tendermint/abci/client"
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/proxy"
+	"github.com/tendermint/tendermint/state"
+	tmdb "github.com/tendermint/tm-db"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+)
+
+var snapshotKey = storetypes.NewKVStoreKey("test")
+
+// saveSnapshot takes a snapshot at height into a snapshot store at dir, as terrad does, of a store holding a single
+// key; the path of its only chunk is returned
+func saveSnapshot(t *testing.T, dir string, height int64) (*snapshottypes.Snapshot, string) {
+	cms := sdkrootmulti.NewStore(tmdb.NewMemDB(), tmlog.NewNopLogger())
+	cms.MountStoreWithDB(snapshotKey, storetypes.StoreTypeIAVL, nil)
+	assert.Nil(t, cms.LoadLatestVersion())
+	assert.Nil(t, cms.SetInitialVersion(height))
+	cms.GetKVStore(snapshotKey).Set([]byte("key"), []byte("value"))
+	cms.Commit()
+
+	db, err := tmdb.NewGoLevelDB("metadata", dir)
+	assert.Nil(t, err)
+	defer db.Close()
+	store, err := snapshots.NewStore(db, dir)
+	assert.Nil(t, err)
+	snapshot, err := snapshots.NewManager(store, snapshottypes.NewSnapshotOptions(0, 0), cms, nil, tmlog.NewNopLogger()).Create(uint64(height))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), snapshot.Chunks)
+	return snapshot, filepath.Join(dir, strconv.FormatInt(height, 10), strconv.FormatUint(uint64(snapshot.Format), 10), "0")
+}
+
+// newSnapshotApp is an app restoring snapshots of saveSnapshot, staging chunks under home
+func newSnapshotApp(t *testing.T, home string) (*baseapp.BaseApp, proxy.AppConnSnapshot) {
+	app := baseapp.NewBaseApp("mantlemint", tmlog.NewNopLogger(), tmdb.NewMemDB(), nil,
+		baseapp.SetSnapshot(openStateSyncScratch(home), snapshottypes.NewSnapshotOptions(0, 0)))
+	app.MountStores(snapshotKey)
+	assert.Nil(t, app.LoadLatestVersion())
+	return app, proxy.NewAppConnSnapshot(abcicli.NewLocalClient(nil, app))
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshot, chunkPath := saveSnapshot(t, dir, 10)
+	source, closeSource := openSnapshotSource(dir)
+	defer closeSource()
+
+	// the app restores the store at the snapshot height
+	app, conn := newSnapshotApp(t, t.TempDir())
+	assert.Nil(t, restoreSnapshot(conn, source, snapshot, nil))
+	assert.Equal(t, int64(10), app.LastBlockHeight())
+	assert.Equal(t, []byte("value"), app.CommitMultiStore().GetKVStore(snapshotKey).Get([]byte("key")))
+
+	// a chunk that doesn't match its hash fails the restore, there being no peer to fetch it again from
+	assert.Nil(t, os.WriteFile(chunkPath, []byte("corrupted"), 0o644))
+	_, conn = newSnapshotApp(t, t.TempDir())
+	assert.EqualError(t, restoreSnapshot(conn, source, snapshot, nil), "chunk 0 does not match its hash in the snapshot metadata")
+
+	// as does a missing one
+	assert.Nil(t, os.Remove(chunkPath))
+	_, conn = newSnapshotApp(t, t.TempDir())
+	assert.EqualError(t, restoreSnapshot(conn, source, snapshot, nil), "chunk 0 of the snapshot is missing")
+}
+
+// newUpstream runs a runner on an exported genesis with blocks up to height, serving the Tendermint rpc as a node does
+func newUpstream(t *testing.T, height int64) (*Runner, string) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	for r.Height() < height {
+		injectNextBlock(t, r, privKey)
+	}
+	server := tendermintServer(r)
+	t.Cleanup(func() {
+		server.Close()
+		assert.Nil(t, r.indexer.Close())
+	})
+	return r, server.URL
+}
+
+func TestFetchState(t *testing.T) {
+	upstream, endpoint := newUpstream(t, 5_000_004)
+
+	// state at the height is that tendermint had, the app hash and results of the block being in the next header
+	fetched, err := fetchState(endpoint, upstream.genesisDoc, 5_000_002)
+	assert.Nil(t, err)
+	want, err := upstream.stateStore().Load()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), fetched.LastBlockHeight)
+	assert.Equal(t, upstream.genesisDoc.ChainID, fetched.ChainID)
+	assert.Equal(t, want.Validators.Hash(), fetched.Validators.Hash())
+	assert.Equal(t, want.ConsensusParams, fetched.ConsensusParams)
+	header, err := upstream.header(nil, int64Ptr(5_000_003))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(header.Header.AppHash), fetched.AppHash)
+	assert.Equal(t, header.Header.LastBlockID, fetched.LastBlockID)
+
+	// the next commit must be signed by the validators, for the chain asked for
+	otherChain := *upstream.genesisDoc
+	otherChain.ChainID = "other-1"
+	_, err = fetchState(endpoint, &otherChain, 5_000_002)
+	assert.ErrorContains(t, err, "commit at height 5000003")
+
+	// heights whose validators 2 blocks later aren't in yet are told apart
+	_, err = fetchState(endpoint, upstream.genesisDoc, 5_000_003)
+	assert.EqualError(t, err, "the chain is at height 5000004, too close to the snapshot: its state takes the validators of height 5000005; retry once that block is in")
+}
+
+func TestStateSync(t *testing.T) {
+	upstream, endpoint := newUpstream(t, 5_000_004)
+	dir := t.TempDir()
+	snapshot, chunkPath := saveSnapshot(t, dir, 5_000_002)
+	chunk, err := os.ReadFile(chunkPath)
+	assert.Nil(t, err)
+	cfg := &config.Config{Home: t.TempDir(), StateSyncSnapshotDir: dir, RPCEndpoints: []string{endpoint}}
+	hldb := hld.ApplyHeightLimitedDB(heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc), &hld.HeightLimitedDBConfig{})
+	batched := safe_batch.NewSafeBatchDB(hldb).(safe_batch.SafeBatchDBCloser)
+	marker := filepath.Join(cfg.Home, stateSyncMarker)
+
+	// a corrupted chunk fails the restore, leaving the marker for it to be retried, and nothing else synced over it
+	assert.Nil(t, os.WriteFile(chunkPath, []byte("corrupted"), 0o644))
+	_, conn := newSnapshotApp(t, cfg.Home)
+	assert.PanicsWithError(t, "failed to restore snapshot at height 5000002, restart to retry: chunk 0 does not match its hash in the snapshot metadata", func() {
+		stateSync(conn, hldb, batched, upstream.genesisDoc, cfg)
+	})
+	height, err := os.ReadFile(marker)
+	assert.Nil(t, err)
+	assert.Equal(t, "5000002", string(height))
+	assert.Panics(t, func() { assertNoPartialStateSync(cfg.Home) })
+
+	// retried on restart with the same snapshot, the restore completes, bootstrapping state and the feed at its height
+	assert.Nil(t, os.WriteFile(chunkPath, chunk, 0o644))
+	batched = safe_batch.NewSafeBatchDB(hldb).(safe_batch.SafeBatchDBCloser)
+	app, conn := newSnapshotApp(t, cfg.Home)
+	stateSync(conn, hldb, batched, upstream.genesisDoc, cfg)
+	assert.NoFileExists(t, marker)
+	assert.NotPanics(t, func() { assertNoPartialStateSync(cfg.Home) })
+	assert.Equal(t, int64(snapshot.Height), app.LastBlockHeight())
+	lastState, err := state.NewStore(hldb, state.StoreOptions{}).Load()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), lastState.LastBlockHeight)
+	checkpoint, err := blockFeeder.LoadCheckpoint(hldb)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), checkpoint.Height)
+
+	// another snapshot isn't restored over what's left of an interrupted one
+	cfg = &config.Config{Home: t.TempDir(), StateSyncSnapshotDir: dir, RPCEndpoints: []string{endpoint}}
+	assert.Nil(t, os.WriteFile(filepath.Join(cfg.Home, stateSyncMarker), []byte("5000001"), 0o644))
+	hldb = hld.ApplyHeightLimitedDB(heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc), &hld.HeightLimitedDBConfig{})
+	batched = safe_batch.NewSafeBatchDB(hldb).(safe_batch.SafeBatchDBCloser)
+	_, conn = newSnapshotApp(t, cfg.Home)
+	assert.PanicsWithError(t, "restoring the snapshot at height 5000001 was interrupted; set STATE_SYNC_HEIGHT=5000001 to retry it, "+
+		"or start over with an empty MANTLEMINT_DB", func() {
+		stateSync(conn, hldb, batched, upstream.genesisDoc, cfg)
+	})
+}
+
+func int64Ptr(value int64) *int64 {
+	return &value
+}
@@ -0,0 +1,105 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/cosmos/cosmos-sdk/baseapp"
+	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+)
+
+// StoreMode is how the app's stores are committed: flat in faux merkle mode, as syncing does by default, way faster,
+// or as iavl trees with merkle stores, which compute the chain's app hashes. Stores are laid out differently in
+// the db in either mode, so a db is only ever committed to in the mode it started in.
+type StoreMode string
+
+const (
+	StoreModeFauxMerkle StoreMode = "faux_merkle"
+	StoreModeMerkle     StoreMode = "merkle"
+)
+
+var storeModeKey = []byte("mantlemint/store_mode")
+
+// storeModeHeight is the height the store mode is recorded at, for no rollback to unwind it
+const storeModeHeight = 1
+
+// StoreModeMismatchError is returned by New when the db was committed to in another store mode than configured
+type StoreModeMismatchError struct {
+	Recorded   StoreMode
+	Configured StoreMode
+}
+
+func (e *StoreModeMismatchError) Error() string {
+	return fmt.Sprintf("the db was committed to in %s mode, but is to be in %s mode, and stores are laid out differently in either; "+
+		"run in %s mode (MERKLE_STORES), or sync a fresh MANTLEMINT_HOME in %s mode", e.Recorded, e.Configured, e.Recorded, e.Configured)
+}
+
+// ConfiguredStoreMode is the mode the app commits in: merkle stores for replays, and with MERKLE_STORES
+func ConfiguredStoreMode(mantlemintConfig *config.Config) StoreMode {
+	if mantlemintConfig.MerkleStores || mantlemintConfig.ReplayFrom != 0 {
+		return StoreModeMerkle
+	}
+	return StoreModeFauxMerkle
+}
+
+// LoadStoreMode returns the mode recorded for ldb; none if nothing was committed to it yet, or it was
+// before the mode was recorded
+func LoadStoreMode(ldb hld.HeightLimitEnabledDB) (StoreMode, error) {
+	mode, err := ldb.Get(0, storeModeKey)
+	if err != nil {
+		return "", err
+	}
+	return StoreMode(mode), nil
+}
+
+// Options are the options of the app's BaseApp for its stores to be committed in mode
+func (mode StoreMode) Options() []func(*baseapp.BaseApp) {
+	if mode == StoreModeFauxMerkle {
+		return []func(*baseapp.BaseApp){FauxMerkleModeOpt}
+	}
+	return nil
+}
+
+// resolveStoreMode returns the mode the app is to commit to db in: the one it was committed to in, which must be
+// the one configured, recorded now if it wasn't yet. A db that was committed to before the mode was recorded was in
+// faux merkle mode, unless by a replay. A node that never writes, pinned or standby, reads in the mode recorded.
+func resolveStoreMode(ldb hld.HeightLimitEnabledDB, db tmdb.DB, mantlemintConfig *config.Config, readOnly bool) (StoreMode, error) {
+	configured := ConfiguredStoreMode(mantlemintConfig)
+	recorded, err := LoadStoreMode(ldb)
+	if err != nil {
+		return "", err
+	}
+	if readOnly {
+		if recorded == "" {
+			return configured, nil
+		}
+		return recorded, nil
+	}
+
+	mode := recorded
+	if mode == "" && rootmulti.GetLatestVersion(db) != 0 {
+		mode = StoreModeFauxMerkle
+		if mantlemintConfig.ReplayFrom != 0 {
+			mode = StoreModeMerkle
+		}
+	}
+	if mode != "" && mode != configured {
+		return "", &StoreModeMismatchError{Recorded: mode, Configured: configured}
+	}
+
+	if recorded == "" {
+		batch := ldb.NewBatch(storeModeHeight)
+		defer batch.Close()
+		if err := batch.Set(storeModeKey, []byte(configured)); err != nil {
+			return "", err
+		}
+		if err := batch.WriteSync(); err != nil {
+			return "", err
+		}
+		log.Printf("[v0.34.x/sync] committing in %s mode from now on", configured)
+	}
+	return configured, nil
+}
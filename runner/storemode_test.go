@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestRunnerStoreMode(t *testing.T) {
+	// a db synced in faux merkle mode commits placeholder app hashes
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	fauxAppHash := r.mm.GetCurrentState().AppHash
+	assert.Nil(t, r.indexer.Close())
+
+	mode, err := LoadStoreMode(ldb)
+	assert.Nil(t, err)
+	assert.Equal(t, StoreModeFauxMerkle, mode)
+
+	// and can't be carried on with merkle stores
+	cfg.MerkleStores = true
+	_, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	var mismatch *StoreModeMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, StoreModeFauxMerkle, mismatch.Recorded)
+	assert.Equal(t, StoreModeMerkle, mismatch.Configured)
+
+	// a fresh one synced with merkle stores computes real app hashes, and is queried at every height as usual
+	cfg, privKey = newExportedGenesisConfig(t, 5_000_000)
+	cfg.MerkleStores = true
+	ldb = heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	merkleAppHash := r.mm.GetCurrentState().AppHash
+	assert.NotEqual(t, fauxAppHash, merkleAppHash)
+	injectNextBlock(t, r, privKey)
+	_, err = r.cms.CacheMultiStoreWithVersion(5_000_001)
+	assert.Nil(t, err)
+	assert.Nil(t, r.indexer.Close())
+
+	// and is restarted in merkle mode
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), r.app.LastBlockHeight())
+	hash, err := r.cms.CommitHash(5_000_001)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(merkleAppHash), hash)
+	assert.Nil(t, r.indexer.Close())
+}
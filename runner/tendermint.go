@@ -0,0 +1,583 @@
+package runner
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmbytes "github.com/tendermint/tendermint/libs/bytes"
+	tmmath "github.com/tendermint/tendermint/libs/math"
+	"github.com/tendermint/tendermint/libs/pubsub/query"
+	"github.com/tendermint/tendermint/p2p"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpcserver "github.com/tendermint/tendermint/rpc/jsonrpc/server"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	"github.com/tendermint/tendermint/state"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tendermint/version"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/indexer/tx"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+// as Tendermint's rpc bounds them
+const (
+	defaultPerPage = 30
+	maxPerPage     = 100
+	maxQueryLength = 512
+
+	// the block metas served by /blockchain at most
+	maxBlockchainInfo = 20
+
+	// the size of the chunks /genesis_chunked serves, before base64
+	genesisChunkSize = 16 * 1024 * 1024
+)
+
+// Version and Commit are mantlemint's version and git commit, as /status and /abci_info report them; set at
+// build time, see the Makefile
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// ResultABCIInfo is the response of /abci_info: the app's, as Tendermint serves it, along with mantlemint's
+type ResultABCIInfo struct {
+	Response   abci.ResponseInfo `json:"response"`
+	Mantlemint MantlemintInfo    `json:"mantlemint"`
+}
+
+// MantlemintInfo is what /abci_info tells of mantlemint, for fleets to be inventoried
+type MantlemintInfo struct {
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	StoreMode  StoreMode `json:"store_mode"`
+	FauxMerkle bool      `json:"faux_merkle"`
+}
+
+// ResultHeader is the response of /header and /header_by_hash, as served by later Tendermint versions
+type ResultHeader struct {
+	Header *tendermint.Header `json:"header"`
+}
+
+// tendermintRoutes are the Tendermint rpc methods served off what mantlemint executed and indexed,
+// as a Tendermint node serves them; see rpc.RegisterTendermintRoutes
+func (r *Runner) tendermintRoutes() map[string]*rpcserver.RPCFunc {
+	return map[string]*rpcserver.RPCFunc{
+		"status":           rpcserver.NewRPCFunc(r.status, ""),
+		"abci_info":        rpcserver.NewRPCFunc(r.abciInfo, ""),
+		"abci_query":       rpcserver.NewRPCFunc(r.abciQuery, "path,data,height,prove"),
+		"check_tx":         rpcserver.NewRPCFunc(r.checkTx, "tx"),
+		"genesis":          rpcserver.NewRPCFunc(r.genesis, "", rpcserver.Cacheable()),
+		"genesis_chunked":  rpcserver.NewRPCFunc(r.genesisChunked, "chunk", rpcserver.Cacheable()),
+		"block_results":    rpcserver.NewRPCFunc(r.blockResults, "height", rpcserver.Cacheable("height")),
+		"tx_search":        rpcserver.NewRPCFunc(r.txSearch, "query,prove,page,per_page,order_by"),
+		"block_search":     rpcserver.NewRPCFunc(r.blockSearch, "query,page,per_page,order_by"),
+		"validators":       rpcserver.NewRPCFunc(r.validators, "height,page,per_page", rpcserver.Cacheable("height")),
+		"consensus_params": rpcserver.NewRPCFunc(r.consensusParams, "height", rpcserver.Cacheable("height")),
+		"commit":           rpcserver.NewRPCFunc(r.commit, "height", rpcserver.Cacheable("height")),
+		"blockchain":       rpcserver.NewRPCFunc(r.blockchain, "minHeight,maxHeight", rpcserver.Cacheable()),
+		"header":           rpcserver.NewRPCFunc(r.header, "height", rpcserver.Cacheable("height")),
+		"header_by_hash":   rpcserver.NewRPCFunc(r.headerByHash, "hash", rpcserver.Cacheable()),
+		"block_by_hash":    rpcserver.NewRPCFunc(r.blockByHash, "hash", rpcserver.Cacheable()),
+	}
+}
+
+// stateStore is tendermint's state store in mantlemint's db, where the results of every block executed are saved
+func (r *Runner) stateStore() state.Store {
+	return state.NewStore(r.batched, state.StoreOptions{DiscardABCIResponses: false})
+}
+
+// resolveHeight returns the height asked for, the latest one if none or 0, which must have been flushed
+func (r *Runner) resolveHeight(heightPtr *int64) (int64, error) {
+	latest := r.Height()
+	if heightPtr == nil || *heightPtr == 0 {
+		return latest, nil
+	}
+
+	height := *heightPtr
+	if height < 0 {
+		return 0, fmt.Errorf("height must be greater than 0, but got %d", height)
+	}
+	if height > latest {
+		return 0, fmt.Errorf("height %d must be less than or equal to the current blockchain height %d", height, latest)
+	}
+	return height, nil
+}
+
+// resolveQueryHeight returns the height a query is to be served at, the latest one for 0, which must have been
+// flushed and still be retained
+func (r *Runner) resolveQueryHeight(height int64) (int64, error) {
+	height, err := r.resolveHeight(&height)
+	if err != nil {
+		return 0, err
+	}
+	if prunedHeight := r.hldb.PrunedHeight(); height < prunedHeight {
+		return 0, fmt.Errorf("%w: %d is below the lowest height retained, %d", hld.ErrHeightPruned, height, prunedHeight)
+	}
+	return height, nil
+}
+
+// status serves /status: mantlemint as a node of the chain of its genesis, which is catching up unless healthy
+// as /health tells it, and has no validator
+func (r *Runner) status(_ *rpctypes.Context) (*coretypes.ResultStatus, error) {
+	lastState, err := r.stateStore().Load()
+	if err != nil {
+		return nil, err
+	}
+
+	syncInfo := coretypes.SyncInfo{
+		LatestBlockHash:     lastState.LastBlockID.Hash,
+		LatestAppHash:       lastState.AppHash,
+		LatestBlockHeight:   lastState.LastBlockHeight,
+		LatestBlockTime:     lastState.LastBlockTime,
+		EarliestBlockHeight: lastState.InitialHeight,
+		CatchingUp:          !r.syncStatus().Healthy(true),
+	}
+	if earliest, earliestID, err := block.LoadBlock(r.indexer.DB(), lastState.InitialHeight); err != nil {
+		return nil, err
+	} else if earliest != nil {
+		syncInfo.EarliestBlockHash, syncInfo.EarliestAppHash, syncInfo.EarliestBlockTime = earliestID.Hash, earliest.AppHash, earliest.Time
+	}
+
+	return &coretypes.ResultStatus{
+		NodeInfo: p2p.DefaultNodeInfo{
+			ProtocolVersion: p2p.NewProtocolVersion(version.P2PProtocol, lastState.Version.Consensus.Block, lastState.Version.Consensus.App),
+			Network:         r.chainID,
+			Version:         Version,
+			Moniker:         "mantlemint",
+			Other:           p2p.DefaultNodeInfoOther{TxIndex: "on"},
+		},
+		SyncInfo:      syncInfo,
+		ValidatorInfo: coretypes.ValidatorInfo{},
+	}, nil
+}
+
+// abciInfo serves /abci_info, off the app's Info over the query client, along with mantlemint's version and store mode
+func (r *Runner) abciInfo(_ *rpctypes.Context) (*ResultABCIInfo, error) {
+	client, err := r.appCreator.NewABCIClient()
+	if err != nil {
+		return nil, err
+	}
+	info, err := rpc.NewRpcClient(client).ABCIInfo(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResultABCIInfo{
+		Response: info.Response,
+		Mantlemint: MantlemintInfo{
+			Version:    Version,
+			Commit:     Commit,
+			StoreMode:  r.storeMode,
+			FauxMerkle: r.storeMode == StoreModeFauxMerkle,
+		},
+	}, nil
+}
+
+// checkTx serves /check_tx, checking a tx against the last block committed without writing anything; see CheckTx
+func (r *Runner) checkTx(_ *rpctypes.Context, tx tendermint.Tx) (*coretypes.ResultCheckTx, error) {
+	res, err := r.CheckTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &coretypes.ResultCheckTx{ResponseCheckTx: res}, nil
+}
+
+// abciQuery serves /abci_query, querying the app over the query client at the height given, the latest one for 0.
+// Proofs are only there for merkle stores, faux merkle ones having no tree to prove keys against.
+func (r *Runner) abciQuery(ctx *rpctypes.Context, path string, data tmbytes.HexBytes, height int64, prove bool) (*coretypes.ResultABCIQuery, error) {
+	if prove && r.storeMode == StoreModeFauxMerkle {
+		return nil, errors.New("proofs are unavailable in faux merkle mode, stores having no merkle tree; " +
+			"sync with MERKLE_STORES=true for them")
+	}
+	height, err := r.resolveHeight(&height)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := r.newQueryClient()
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewRpcClient(client).ABCIQueryWithOptions(ctx.Context(), path, data, rpcclient.ABCIQueryOptions{
+		Height: height,
+		Prove:  prove,
+	})
+}
+
+// chunkGenesis splits the genesis file into chunks of genesisChunkSize, base64-encoded, as Tendermint does
+func chunkGenesis(genesisPath string) ([]string, error) {
+	data, err := os.ReadFile(genesisPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []string
+	for start := 0; start < len(data); start += genesisChunkSize {
+		end := tmmath.MinInt(start+genesisChunkSize, len(data))
+		chunks = append(chunks, base64.StdEncoding.EncodeToString(data[start:end]))
+	}
+	return chunks, nil
+}
+
+// genesis serves /genesis, unless the genesis is too large for a response, as Tendermint
+func (r *Runner) genesis(_ *rpctypes.Context) (*coretypes.ResultGenesis, error) {
+	if len(r.genesisChunks) > 1 {
+		return nil, errors.New("genesis response is large, please use the genesis_chunked API instead")
+	}
+	return &coretypes.ResultGenesis{Genesis: r.genesisDoc}, nil
+}
+
+// genesisChunked serves /genesis_chunked, the chunk of the genesis file asked for
+func (r *Runner) genesisChunked(_ *rpctypes.Context, chunk uint) (*coretypes.ResultGenesisChunk, error) {
+	if len(r.genesisChunks) == 0 {
+		return nil, fmt.Errorf("service configuration error, there are no chunks")
+	}
+
+	id := int(chunk)
+	if id > len(r.genesisChunks)-1 {
+		return nil, fmt.Errorf("there are %d chunks, %d is invalid", len(r.genesisChunks)-1, id)
+	}
+	return &coretypes.ResultGenesisChunk{TotalChunks: len(r.genesisChunks), ChunkNumber: id, Data: r.genesisChunks[id]}, nil
+}
+
+// blockResults serves /block_results, from the results saved when the block was executed
+func (r *Runner) blockResults(_ *rpctypes.Context, heightPtr *int64) (*coretypes.ResultBlockResults, error) {
+	height, err := r.resolveHeight(heightPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := r.stateStore().LoadABCIResponses(height)
+	var notFound state.ErrNoABCIResponsesForHeight
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("results of height %d are not available; mantlemint only has those of blocks it executed, "+
+			"not of heights before its genesis or the snapshot it was bootstrapped from", height)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &coretypes.ResultBlockResults{
+		Height:                height,
+		TxsResults:            results.DeliverTxs,
+		BeginBlockEvents:      results.BeginBlock.Events,
+		EndBlockEvents:        results.EndBlock.Events,
+		ValidatorUpdates:      results.EndBlock.ValidatorUpdates,
+		ConsensusParamUpdates: results.EndBlock.ConsensusParamUpdates,
+	}, nil
+}
+
+// validators serves /validators, from the validator sets saved as blocks were executed
+func (r *Runner) validators(_ *rpctypes.Context, heightPtr *int64, pagePtr, perPagePtr *int) (*coretypes.ResultValidators, error) {
+	height, err := r.resolveHeight(heightPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	validators, err := r.stateStore().LoadValidators(height)
+	var notFound state.ErrNoValSetForHeight
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("validators of height %d are not available; mantlemint only has those of heights "+
+			"from its genesis or the snapshot it was bootstrapped from", height)
+	} else if err != nil {
+		return nil, err
+	}
+
+	totalCount := len(validators.Validators)
+	perPage := validatePerPage(perPagePtr)
+	page, err := validatePage(pagePtr, perPage, totalCount)
+	if err != nil {
+		return nil, err
+	}
+	skip := (page - 1) * perPage
+	paginated := validators.Validators[skip:tmmath.MinInt(skip+perPage, totalCount)]
+
+	return &coretypes.ResultValidators{
+		BlockHeight: height,
+		Validators:  paginated,
+		Count:       len(paginated),
+		Total:       totalCount,
+	}, nil
+}
+
+// consensusParams serves /consensus_params, from those saved as blocks were executed: the genesis', then as updated
+// by end block
+func (r *Runner) consensusParams(_ *rpctypes.Context, heightPtr *int64) (*coretypes.ResultConsensusParams, error) {
+	height, err := r.resolveHeight(heightPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	// heights up to the latest have params saved, unless before mantlemint's first block
+	params, err := r.stateStore().LoadConsensusParams(height)
+	if err != nil {
+		return nil, fmt.Errorf("consensus params of height %d are not available; mantlemint only has those of heights "+
+			"from its genesis or the snapshot it was bootstrapped from: %v", height, err)
+	}
+
+	return &coretypes.ResultConsensusParams{BlockHeight: height, ConsensusParams: params}, nil
+}
+
+// loadBlock loads the block indexed at height, which must have been
+func (r *Runner) loadBlock(height int64) (*tendermint.Block, error) {
+	indexed, _, err := block.LoadBlock(r.indexer.DB(), height)
+	if err != nil {
+		return nil, err
+	} else if indexed == nil {
+		return nil, fmt.Errorf("block %d is not available; mantlemint only has the blocks it indexed, "+
+			"from its genesis or the snapshot it was bootstrapped from", height)
+	}
+	return indexed, nil
+}
+
+// commit serves /commit, the header of a block along with its commit, off the last commit of the next block.
+// That of the latest block isn't known until the next is executed, mantlemint seeing no votes, so the commit of
+// the block before is served for height 0, or none.
+func (r *Runner) commit(_ *rpctypes.Context, heightPtr *int64) (*coretypes.ResultCommit, error) {
+	latest := r.Height()
+	height := latest - 1
+	if heightPtr != nil && *heightPtr != 0 {
+		resolved, err := r.resolveHeight(heightPtr)
+		if err != nil {
+			return nil, err
+		} else if resolved == latest {
+			return nil, fmt.Errorf("commit of height %d isn't known until block %d is executed", resolved, resolved+1)
+		}
+		height = resolved
+	}
+
+	committed, err := r.loadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	next, err := r.loadBlock(height + 1)
+	if err != nil {
+		return nil, err
+	}
+	return coretypes.NewResultCommit(&committed.Header, next.LastCommit, true), nil
+}
+
+// blockchain serves /blockchain, the metas of the blocks from minHeight to maxHeight, newest first, off the
+// block index. The range is clamped to what's indexed, and to the maxBlockchainInfo blocks up to maxHeight, as
+// Tendermint does; last_height is the last block indexed.
+func (r *Runner) blockchain(_ *rpctypes.Context, minHeight, maxHeight int64) (*coretypes.ResultBlockchainInfo, error) {
+	if minHeight < 0 || maxHeight < 0 {
+		return nil, errors.New("heights must be non-negative")
+	}
+	lowest, highest, err := block.IndexedRange(r.indexer.DB())
+	if err != nil {
+		return nil, err
+	}
+
+	if minHeight == 0 {
+		minHeight = 1
+	}
+	if maxHeight == 0 {
+		maxHeight = highest
+	}
+	maxHeight = tmmath.MinInt64(highest, maxHeight)
+	minHeight = tmmath.MaxInt64(tmmath.MaxInt64(lowest, minHeight), maxHeight-maxBlockchainInfo+1)
+	if minHeight > maxHeight {
+		return nil, fmt.Errorf("min height %d can't be greater than max height %d", minHeight, maxHeight)
+	}
+
+	metas := make([]*tendermint.BlockMeta, 0, maxHeight-minHeight+1)
+	for height := maxHeight; height >= minHeight; height-- {
+		indexed, blockID, err := block.LoadBlock(r.indexer.DB(), height)
+		if err != nil {
+			return nil, err
+		} else if indexed == nil {
+			continue
+		}
+		metas = append(metas, &tendermint.BlockMeta{
+			BlockID:   *blockID,
+			BlockSize: indexed.Size(),
+			Header:    indexed.Header,
+			NumTxs:    len(indexed.Txs),
+		})
+	}
+
+	return &coretypes.ResultBlockchainInfo{LastHeight: highest, BlockMetas: metas}, nil
+}
+
+// header serves /header, the header of a block, the latest one for height 0 or none
+func (r *Runner) header(_ *rpctypes.Context, heightPtr *int64) (*ResultHeader, error) {
+	height, err := r.resolveHeight(heightPtr)
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, err := r.loadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultHeader{Header: &indexed.Header}, nil
+}
+
+// headerByHash serves /header_by_hash, the header of the block of a hash, if indexed; none otherwise, as Tendermint
+func (r *Runner) headerByHash(_ *rpctypes.Context, hash []byte) (*ResultHeader, error) {
+	height, err := block.LoadHeightByHash(r.indexer.DB(), hash)
+	if err != nil || height == 0 {
+		return &ResultHeader{}, err
+	}
+
+	indexed, err := r.loadBlock(height)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultHeader{Header: &indexed.Header}, nil
+}
+
+// blockByHash serves /block_by_hash, the block of a hash, if indexed; none otherwise, as Tendermint
+func (r *Runner) blockByHash(_ *rpctypes.Context, hash []byte) (*coretypes.ResultBlock, error) {
+	height, err := block.LoadHeightByHash(r.indexer.DB(), hash)
+	if err != nil || height == 0 {
+		return &coretypes.ResultBlock{}, err
+	}
+
+	indexed, blockID, err := block.LoadBlock(r.indexer.DB(), height)
+	if err != nil {
+		return nil, err
+	} else if indexed == nil {
+		return &coretypes.ResultBlock{}, nil
+	}
+	return &coretypes.ResultBlock{BlockID: *blockID, Block: indexed}, nil
+}
+
+// txSearch serves /tx_search off the tx index, with the txs and their results as executed; see tx.SearchTxs
+func (r *Runner) txSearch(_ *rpctypes.Context, q string, prove bool, pagePtr, perPagePtr *int, orderBy string) (*coretypes.ResultTxSearch, error) {
+	if len(q) > maxQueryLength {
+		return nil, errors.New("maximum query length exceeded")
+	}
+	parsed, err := query.New(q)
+	if err != nil {
+		return nil, err
+	}
+	if orderBy != "" && orderBy != "asc" && orderBy != "desc" {
+		return nil, errors.New("expected order_by to be either `asc` or `desc` or empty")
+	}
+
+	positions, err := tx.SearchTxs(r.indexer.DB(), parsed, r.Height())
+	if err != nil {
+		return nil, err
+	}
+	if orderBy == "desc" {
+		for i, j := 0, len(positions)-1; i < j; i, j = i+1, j-1 {
+			positions[i], positions[j] = positions[j], positions[i]
+		}
+	}
+
+	totalCount := len(positions)
+	perPage := validatePerPage(perPagePtr)
+	page, err := validatePage(pagePtr, perPage, totalCount)
+	if err != nil {
+		return nil, err
+	}
+	skip := (page - 1) * perPage
+	positions = positions[skip:tmmath.MinInt(skip+perPage, totalCount)]
+
+	// the txs and their results are read off the block and the results saved when it was executed
+	results := make([]*coretypes.ResultTx, 0, len(positions))
+	for _, position := range positions {
+		indexed, _, err := block.LoadBlock(r.indexer.DB(), position.Height)
+		if err != nil {
+			return nil, err
+		} else if indexed == nil || int(position.Index) >= len(indexed.Txs) {
+			return nil, fmt.Errorf("tx %s is indexed at height %d, but the block isn't", position.Hash, position.Height)
+		}
+		responses, err := r.stateStore().LoadABCIResponses(position.Height)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &coretypes.ResultTx{
+			Hash:     indexed.Txs[position.Index].Hash(),
+			Height:   position.Height,
+			Index:    position.Index,
+			TxResult: *responses.DeliverTxs[position.Index],
+			Tx:       indexed.Txs[position.Index],
+		}
+		if prove {
+			result.Proof = indexed.Txs.Proof(int(position.Index))
+		}
+		results = append(results, result)
+	}
+
+	return &coretypes.ResultTxSearch{Txs: results, TotalCount: totalCount}, nil
+}
+
+// blockSearch serves /block_search off the block index, newest first unless ordered otherwise; see block.SearchBlocks
+func (r *Runner) blockSearch(_ *rpctypes.Context, q string, pagePtr, perPagePtr *int, orderBy string) (*coretypes.ResultBlockSearch, error) {
+	if len(q) > maxQueryLength {
+		return nil, errors.New("maximum query length exceeded")
+	}
+	parsed, err := query.New(q)
+	if err != nil {
+		return nil, err
+	}
+	if orderBy != "" && orderBy != "asc" && orderBy != "desc" {
+		return nil, errors.New("expected order_by to be either `asc` or `desc` or empty")
+	}
+
+	heights, err := block.SearchBlocks(r.indexer.DB(), parsed, r.Height())
+	if err != nil {
+		return nil, err
+	}
+	if orderBy != "asc" {
+		for i, j := 0, len(heights)-1; i < j; i, j = i+1, j-1 {
+			heights[i], heights[j] = heights[j], heights[i]
+		}
+	}
+
+	totalCount := len(heights)
+	perPage := validatePerPage(perPagePtr)
+	page, err := validatePage(pagePtr, perPage, totalCount)
+	if err != nil {
+		return nil, err
+	}
+	skip := (page - 1) * perPage
+	heights = heights[skip:tmmath.MinInt(skip+perPage, totalCount)]
+
+	results := make([]*coretypes.ResultBlock, 0, len(heights))
+	for _, height := range heights {
+		indexed, blockID, err := block.LoadBlock(r.indexer.DB(), height)
+		if err != nil {
+			return nil, err
+		} else if indexed == nil {
+			return nil, fmt.Errorf("block %d is indexed by its events, but isn't", height)
+		}
+		results = append(results, &coretypes.ResultBlock{BlockID: *blockID, Block: indexed})
+	}
+
+	return &coretypes.ResultBlockSearch{Blocks: results, TotalCount: totalCount}, nil
+}
+
+// validatePage returns the page asked for, the first if none, which must be within those of totalCount results
+func validatePage(pagePtr *int, perPage, totalCount int) (int, error) {
+	pages := ((totalCount - 1) / perPage) + 1
+	if pages == 0 {
+		pages = 1 // one page, even if empty
+	}
+	if pagePtr == nil {
+		return 1, nil
+	}
+	if page := *pagePtr; page <= 0 || page > pages {
+		return 1, fmt.Errorf("page should be within [1, %d] range, given %d", pages, page)
+	}
+	return *pagePtr, nil
+}
+
+// validatePerPage returns the results per page asked for, defaultPerPage if none, up to maxPerPage
+func validatePerPage(perPagePtr *int) int {
+	if perPagePtr == nil || *perPagePtr <= 0 {
+		return defaultPerPage
+	} else if *perPagePtr > maxPerPage {
+		return maxPerPage
+	}
+	return *perPagePtr
+}
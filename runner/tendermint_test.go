@@ -0,0 +1,384 @@
+package runner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+// tendermintServer serves the Tendermint rpc methods of r
+func tendermintServer(r *Runner) *httptest.Server {
+	router := mux.NewRouter()
+	rpc.RegisterTendermintRoutes(router, r.tendermintRoutes())
+	return httptest.NewServer(router)
+}
+
+// callTendermint gets path off server, decoding the result of the json-rpc response into result
+func callTendermint(t *testing.T, server *httptest.Server, path string, result interface{}) *rpctypes.RPCError {
+	res, err := http.Get(server.URL + path)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	var response rpctypes.RPCResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&response))
+	if response.Error != nil {
+		return response.Error
+	}
+	assert.Nil(t, tmjson.Unmarshal(response.Result, result))
+	return nil
+}
+
+func TestRunnerBlockResults(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// the results saved when the block was executed are served, the latest ones for height 0
+	var results coretypes.ResultBlockResults
+	assert.Nil(t, callTendermint(t, server, "/block_results?height=5000001", &results))
+	assert.Equal(t, int64(5_000_001), results.Height)
+	assert.NotEmpty(t, results.BeginBlockEvents)
+	assert.Nil(t, callTendermint(t, server, "/block_results?height=0", &results))
+	assert.Equal(t, int64(5_000_002), results.Height)
+
+	// and over json-rpc
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"block_results","params":{"height":"5000001"}}`))
+	assert.Nil(t, err)
+	var response rpctypes.RPCResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&response))
+	_ = res.Body.Close()
+	assert.Nil(t, response.Error)
+	assert.Nil(t, tmjson.Unmarshal(response.Result, &results))
+	assert.Equal(t, int64(5_000_001), results.Height)
+
+	// heights not reached yet, and before mantlemint's genesis, have no results
+	rpcErr := callTendermint(t, server, "/block_results?height=5000003", &results)
+	assert.Contains(t, rpcErr.Data, "must be less than or equal to the current blockchain height 5000002")
+	rpcErr = callTendermint(t, server, "/block_results?height=4999999", &results)
+	assert.Contains(t, rpcErr.Data, "results of height 4999999 are not available")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerTxSearch(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// blocks without txs match nothing, on the one empty page
+	var results coretypes.ResultTxSearch
+	assert.Nil(t, callTendermint(t, server, `/tx_search?query="tx.height>=1"&order_by="desc"`, &results))
+	assert.Equal(t, 0, results.TotalCount)
+	assert.Empty(t, results.Txs)
+
+	rpcErr := callTendermint(t, server, `/tx_search?query="tx.height>=1"&page=2`, &results)
+	assert.Contains(t, rpcErr.Data, "page should be within [1, 1] range, given 2")
+	rpcErr = callTendermint(t, server, `/tx_search?query="tx.height>=1"&order_by="sideways"`, &results)
+	assert.Contains(t, rpcErr.Data, "expected order_by to be either `asc` or `desc` or empty")
+	rpcErr = callTendermint(t, server, `/tx_search?query="transfer.amount>1"`, &results)
+	assert.Contains(t, rpcErr.Data, "only equality is supported on event attributes")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerBlockSearch(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	r.indexer.Drain()
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// blocks are found by the events of begin and end block, newest first
+	var results coretypes.ResultBlockSearch
+	assert.Nil(t, callTendermint(t, server, `/block_search?query="block.height>=1"`, &results))
+	assert.Equal(t, 2, results.TotalCount)
+	assert.Equal(t, int64(5_000_002), results.Blocks[0].Block.Height)
+	assert.Equal(t, results.Blocks[0].Block.Hash(), results.Blocks[0].BlockID.Hash)
+
+	rpcErr := callTendermint(t, server, `/block_search?query="block.height>=1"&order_by="asc"&per_page=1&page=2`, &results)
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, int64(5_000_002), results.Blocks[0].Block.Height)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerValidators(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// the validator set of a height, the latest one for height 0
+	var validators coretypes.ResultValidators
+	assert.Nil(t, callTendermint(t, server, "/validators?height=5000001", &validators))
+	assert.Equal(t, int64(5_000_001), validators.BlockHeight)
+	assert.Equal(t, 1, validators.Total)
+	assert.Equal(t, privKey.PubKey().Address(), validators.Validators[0].Address)
+	assert.Nil(t, callTendermint(t, server, "/validators?height=0&page=1&per_page=100", &validators))
+	assert.Equal(t, int64(5_000_001), validators.BlockHeight)
+
+	rpcErr := callTendermint(t, server, "/validators?height=5000001&page=2", &validators)
+	assert.Contains(t, rpcErr.Data, "page should be within [1, 1] range, given 2")
+	rpcErr = callTendermint(t, server, "/validators?height=4999999", &validators)
+	assert.Contains(t, rpcErr.Data, "validators of height 4999999 are not available")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerStatus(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	r.indexer.Drain()
+	server := tendermintServer(r)
+	defer server.Close()
+
+	var status coretypes.ResultStatus
+	assert.Nil(t, callTendermint(t, server, "/status", &status))
+	assert.Equal(t, "mantlemint", status.NodeInfo.Moniker)
+	assert.Equal(t, r.chainID, status.NodeInfo.Network)
+	assert.Equal(t, int64(5_000_002), status.SyncInfo.LatestBlockHeight)
+	assert.Equal(t, r.LatestBlock().Time, status.SyncInfo.LatestBlockTime)
+	assert.Equal(t, int64(5_000_001), status.SyncInfo.EarliestBlockHeight)
+	assert.NotEmpty(t, status.SyncInfo.EarliestBlockHash)
+
+	// catching up as long as /health tells mantlemint isn't synced, which the fake feed never is
+	assert.True(t, status.SyncInfo.CatchingUp)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerConsensusParams(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// the genesis' params, as no block updated them
+	genesisDoc, err := LoadGenesisDoc(cfg.GenesisPath, cfg.ChainID)
+	assert.Nil(t, err)
+	var params coretypes.ResultConsensusParams
+	assert.Nil(t, callTendermint(t, server, "/consensus_params", &params))
+	assert.Equal(t, int64(5_000_001), params.BlockHeight)
+	assert.Equal(t, genesisDoc.ConsensusParams.Block.MaxGas, params.ConsensusParams.Block.MaxGas)
+	assert.Equal(t, genesisDoc.ConsensusParams.Block.MaxBytes, params.ConsensusParams.Block.MaxBytes)
+
+	rpcErr := callTendermint(t, server, "/consensus_params?height=4999999", &params)
+	assert.Contains(t, rpcErr.Data, "consensus params of height 4999999 are not available")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerCommitAndHeader(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	r.indexer.Drain()
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// a block is committed by the next one's last commit
+	var commit coretypes.ResultCommit
+	assert.Nil(t, callTendermint(t, server, "/commit?height=5000001", &commit))
+	assert.Equal(t, int64(5_000_001), commit.Header.Height)
+	assert.Equal(t, commit.Header.Hash(), commit.Commit.BlockID.Hash)
+	assert.True(t, commit.CanonicalCommit)
+	assert.Nil(t, commit.ValidateBasic(r.chainID))
+
+	// that of the latest block isn't known yet; the one before is served by default
+	assert.Nil(t, callTendermint(t, server, "/commit", &commit))
+	assert.Equal(t, int64(5_000_002), commit.Header.Height)
+	rpcErr := callTendermint(t, server, "/commit?height=5000003", &commit)
+	assert.Contains(t, rpcErr.Data, "commit of height 5000003 isn't known until block 5000004 is executed")
+
+	// headers by height and by hash, in either case
+	var header ResultHeader
+	assert.Nil(t, callTendermint(t, server, "/header?height=5000002", &header))
+	assert.Equal(t, int64(5_000_002), header.Header.Height)
+	hash := header.Header.Hash()
+	assert.Nil(t, callTendermint(t, server, "/header_by_hash?hash=0x"+hash.String(), &header))
+	assert.Equal(t, int64(5_000_002), header.Header.Height)
+	assert.Nil(t, callTendermint(t, server, "/header_by_hash?hash=0x"+strings.ToLower(hash.String()), &header))
+	assert.Equal(t, int64(5_000_002), header.Header.Height)
+
+	assert.Nil(t, callTendermint(t, server, "/header_by_hash?hash=0xABCD", &header))
+	assert.Nil(t, header.Header)
+	rpcErr = callTendermint(t, server, "/header?height=4999999", &header)
+	assert.Contains(t, rpcErr.Data, "block 4999999 is not available")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerBlockchain(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	r.indexer.Drain()
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// newest first, clamped to what's indexed
+	var info coretypes.ResultBlockchainInfo
+	assert.Nil(t, callTendermint(t, server, "/blockchain?minHeight=1&maxHeight=6000000", &info))
+	assert.Equal(t, int64(5_000_003), info.LastHeight)
+	assert.Len(t, info.BlockMetas, 3)
+	assert.Equal(t, int64(5_000_003), info.BlockMetas[0].Header.Height)
+	assert.Equal(t, info.BlockMetas[0].Header.Hash(), info.BlockMetas[0].BlockID.Hash)
+	assert.Equal(t, int64(5_000_001), info.BlockMetas[2].Header.Height)
+
+	assert.Nil(t, callTendermint(t, server, "/blockchain?minHeight=5000002&maxHeight=5000002", &info))
+	assert.Len(t, info.BlockMetas, 1)
+
+	rpcErr := callTendermint(t, server, "/blockchain?minHeight=5000003&maxHeight=5000002", &info)
+	assert.Contains(t, rpcErr.Data, "min height 5000003 can't be greater than max height 5000002")
+	rpcErr = callTendermint(t, server, "/blockchain?minHeight=-1", &info)
+	assert.Contains(t, rpcErr.Data, "heights must be non-negative")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerBlockByHash(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	r.indexer.Drain()
+	server := tendermintServer(r)
+	defer server.Close()
+
+	indexed, err := r.loadBlock(5_000_001)
+	assert.Nil(t, err)
+	hash := indexed.Hash().String()
+
+	// hashes are taken 0x-prefixed or bare, in either case
+	var result coretypes.ResultBlock
+	for _, arg := range []string{"0x" + hash, hash, strings.ToLower(hash), "0x" + strings.ToLower(hash)} {
+		assert.Nil(t, callTendermint(t, server, "/block_by_hash?hash="+arg, &result))
+		assert.Equal(t, int64(5_000_001), result.Block.Height)
+		assert.Equal(t, indexed.Hash(), result.BlockID.Hash)
+	}
+
+	// unknown ones have no block, as Tendermint responds
+	assert.Nil(t, callTendermint(t, server, "/block_by_hash?hash=ABCD", &result))
+	assert.Nil(t, result.Block)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerGenesis(t *testing.T) {
+	cfg, _ := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	var genesis coretypes.ResultGenesis
+	assert.Nil(t, callTendermint(t, server, "/genesis", &genesis))
+	assert.Equal(t, r.chainID, genesis.Genesis.ChainID)
+
+	// the genesis file fits a chunk
+	raw, err := os.ReadFile(cfg.GenesisPath)
+	assert.Nil(t, err)
+	var chunk coretypes.ResultGenesisChunk
+	assert.Nil(t, callTendermint(t, server, "/genesis_chunked?chunk=0", &chunk))
+	assert.Equal(t, 1, chunk.TotalChunks)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(raw), chunk.Data)
+	rpcErr := callTendermint(t, server, "/genesis_chunked?chunk=1", &chunk)
+	assert.Contains(t, rpcErr.Data, "there are 0 chunks, 1 is invalid")
+
+	// one that doesn't is only served chunked
+	r.genesisChunks = append(r.genesisChunks, r.genesisChunks[0])
+	rpcErr = callTendermint(t, server, "/genesis", &genesis)
+	assert.Contains(t, rpcErr.Data, "genesis response is large, please use the genesis_chunked API instead")
+	assert.Nil(t, callTendermint(t, server, "/genesis_chunked?chunk=1", &chunk))
+	assert.Equal(t, 2, chunk.TotalChunks)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerABCIInfo(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// the app's info, as Tendermint clients parse it
+	var info coretypes.ResultABCIInfo
+	assert.Nil(t, callTendermint(t, server, "/abci_info", &info))
+	assert.Equal(t, int64(5_000_001), info.Response.LastBlockHeight)
+	assert.NotEmpty(t, info.Response.LastBlockAppHash)
+
+	// along with mantlemint's
+	var mantlemintInfo ResultABCIInfo
+	assert.Nil(t, callTendermint(t, server, "/abci_info", &mantlemintInfo))
+	assert.Equal(t, info.Response, mantlemintInfo.Response)
+	assert.Equal(t, StoreModeFauxMerkle, mantlemintInfo.Mantlemint.StoreMode)
+	assert.True(t, mantlemintInfo.Mantlemint.FauxMerkle)
+	assert.Equal(t, Version, mantlemintInfo.Mantlemint.Version)
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestRunnerABCIQuery(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey)
+	server := tendermintServer(r)
+	defer server.Close()
+
+	// at the latest height, or the one given
+	var result coretypes.ResultABCIQuery
+	assert.Nil(t, callTendermint(t, server, `/abci_query?path="/cosmos.bank.v1beta1.Query/TotalSupply"`, &result))
+	assert.Equal(t, uint32(0), result.Response.Code)
+	assert.NotEmpty(t, result.Response.Value)
+	assert.Equal(t, int64(5_000_002), result.Response.Height)
+	assert.Nil(t, callTendermint(t, server, `/abci_query?path="/cosmos.bank.v1beta1.Query/TotalSupply"&height=5000001`, &result))
+	assert.Equal(t, int64(5_000_001), result.Response.Height)
+
+	rpcErr := callTendermint(t, server, `/abci_query?path="/cosmos.bank.v1beta1.Query/TotalSupply"&height=5000003`, &result)
+	assert.Contains(t, rpcErr.Data, "must be less than or equal to the current blockchain height")
+
+	// faux merkle stores have nothing to prove keys against
+	rpcErr = callTendermint(t, server, `/abci_query?path="/store/bank/key"&data=0x00&prove=true`, &result)
+	assert.Contains(t, rpcErr.Data, "proofs are unavailable in faux merkle mode")
+	assert.Nil(t, r.indexer.Close())
+}
@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/terra-money/mantlemint/indexer/block"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+var _ rpc.TxIndex = txIndex{}
+
+// txIndex serves the tx service, cosmos.tx.v1beta1.Service, off the block and tx indexes, as the Tendermint rpc
+// methods are served: GetTx and GetTxsEvent read txs as /tx_search finds them, along with the time of their block
+type txIndex struct {
+	r *Runner
+}
+
+func (i txIndex) Block(_ context.Context, heightPtr *int64) (*coretypes.ResultBlock, error) {
+	height, err := i.r.resolveHeight(heightPtr)
+	if err != nil {
+		return nil, err
+	}
+	indexed, blockID, err := block.LoadBlock(i.r.indexer.DB(), height)
+	if err != nil {
+		return nil, err
+	} else if indexed == nil {
+		return nil, fmt.Errorf("block at height %d is not indexed", height)
+	}
+	return &coretypes.ResultBlock{BlockID: *blockID, Block: indexed}, nil
+}
+
+// Tx fails with "not found" for txs that aren't indexed, as Tendermint does, for GetTx to respond NotFound
+func (i txIndex) Tx(_ context.Context, hash []byte, prove bool) (*coretypes.ResultTx, error) {
+	found, err := i.r.txSearch(nil, fmt.Sprintf("tx.hash='%X'", hash), prove, nil, nil, "")
+	if err != nil {
+		return nil, err
+	} else if len(found.Txs) == 0 {
+		return nil, fmt.Errorf("tx (%X) not found", hash)
+	}
+	return found.Txs[0], nil
+}
+
+func (i txIndex) TxSearch(_ context.Context, q string, prove bool, page, perPage *int, orderBy string) (*coretypes.ResultTxSearch, error) {
+	return i.r.txSearch(nil, q, prove, page, perPage, orderBy)
+}
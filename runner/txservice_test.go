@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	txtypes "github.com/cosmos/cosmos-sdk/types/tx"
+	authtx "github.com/cosmos/cosmos-sdk/x/auth/tx"
+	distrtypes "github.com/cosmos/cosmos-sdk/x/distribution/types"
+	"github.com/stretchr/testify/assert"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/rpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunnerTxService(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	address := sdk.AccAddress(accountKey.PubKey().Address())
+	tx := tendermint.Tx(signTx(t, r, 0, distrtypes.NewMsgSetWithdrawAddress(address, address)))
+	injectNextBlock(t, r, privKey)
+	injectNextBlock(t, r, privKey, tx)
+
+	abcicli, err := r.appCreator.NewABCIClient()
+	assert.Nil(t, err)
+	clientCtx := client.Context{}.
+		WithClient(rpc.NewIndexedRpcClient(abcicli, txIndex{r})).
+		WithCodec(r.codec.Codec).
+		WithInterfaceRegistry(r.codec.InterfaceRegistry).
+		WithTxConfig(r.codec.TxConfig)
+	service := authtx.NewTxServer(clientCtx, r.Simulate, r.codec.InterfaceRegistry)
+
+	// txs are read off the index, with their results and the time of their block
+	res, err := service.GetTx(context.Background(), &txtypes.GetTxRequest{Hash: fmt.Sprintf("%X", tx.Hash())})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_002), res.TxResponse.Height)
+	assert.Equal(t, uint32(0), res.TxResponse.Code, res.TxResponse.RawLog)
+	assert.NotEmpty(t, res.TxResponse.Logs)
+	assert.NotEmpty(t, res.TxResponse.Events)
+	assert.NotEmpty(t, res.TxResponse.Timestamp)
+	assert.Len(t, res.Tx.Body.Messages, 1)
+
+	_, err = service.GetTx(context.Background(), &txtypes.GetTxRequest{Hash: fmt.Sprintf("%X", tendermint.Tx("unknown").Hash())})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// as tx_search finds them, a page at a time
+	events, err := service.GetTxsEvent(context.Background(), &txtypes.GetTxsEventRequest{
+		Events: []string{"message.sender='" + address.String() + "'", "tx.height=5000002"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), events.Total)
+	assert.Equal(t, res.TxResponse.TxHash, events.TxResponses[0].TxHash)
+	events, err = service.GetTxsEvent(context.Background(), &txtypes.GetTxsEventRequest{
+		Events: []string{"tx.height=5000001"},
+	})
+	assert.Nil(t, err)
+	assert.Zero(t, events.Total)
+
+	// simulations run on the app as it is
+	simulated, err := service.Simulate(context.Background(), &txtypes.SimulateRequest{TxBytes: signTx(t, r, 1, distrtypes.NewMsgSetWithdrawAddress(address, address))})
+	assert.Nil(t, err)
+	assert.NotZero(t, simulated.GasInfo.GasUsed)
+	assert.Nil(t, r.indexer.Close())
+}
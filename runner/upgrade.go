@@ -0,0 +1,52 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/module"
+	upgradetypes "github.com/cosmos/cosmos-sdk/x/upgrade/types"
+	tendermint "github.com/tendermint/tendermint/types"
+)
+
+// allowUpgrades registers a handler for every plan of UPGRADE_ALLOW_AT the app has none for, applying it as is.
+// Plans already passed need theirs from the start, or the app takes itself for a downgrade; those to come only
+// at their height, or the app takes itself for an early upgrade
+func (r *Runner) allowUpgrades() error {
+	if len(r.config.UpgradeAllowAt) == 0 {
+		return nil
+	}
+	upgradeKeeperProvider, ok := r.appProvider.(UpgradeKeeperProvider)
+	if !ok {
+		return fmt.Errorf("UPGRADE_ALLOW_AT needs the upgrade keeper of the app, which its provider doesn't give")
+	}
+	upgradeKeeper := upgradeKeeperProvider.UpgradeKeeper(r.app)
+
+	allow := func(name string, height int64) {
+		if upgradeKeeper.HasHandler(name) {
+			return
+		}
+		log.Printf("[v0.34.x/sync] allowing upgrade %s at height %d without a handler (UPGRADE_ALLOW_AT)", name, height)
+		upgradeKeeper.SetUpgradeHandler(name, noopUpgradeHandler)
+	}
+
+	for height, name := range r.config.UpgradeAllowAt {
+		if height <= r.mm.GetCurrentHeight() {
+			allow(name, height)
+		}
+	}
+
+	r.mm.AddRunBefore(func(block *tendermint.Block) error {
+		if name, ok := r.config.UpgradeAllowAt[block.Height]; ok {
+			allow(name, block.Height)
+		}
+		return nil
+	})
+	return nil
+}
+
+// noopUpgradeHandler leaves module versions as they are; the binary is meant to have the new logic already
+func noopUpgradeHandler(_ sdk.Context, _ upgradetypes.Plan, fromVM module.VersionMap) (module.VersionMap, error) {
+	return fromVM, nil
+}
@@ -0,0 +1,266 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	tmlog "github.com/tendermint/tendermint/libs/log"
+	"github.com/tendermint/tendermint/proxy"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/db/hld"
+	"github.com/terra-money/mantlemint/db/safe_batch"
+	"github.com/terra-money/mantlemint/mantlemint"
+	"github.com/terra-money/mantlemint/store/rootmulti"
+)
+
+// VerifyReport is the outcome of Verify
+type VerifyReport struct {
+	From     int64 `json:"from"`
+	To       int64 `json:"to"`
+	Verified bool  `json:"verified"`
+
+	// LastVerified is the last height whose app hash matched the chain's; 0 if not even from-1 did
+	LastVerified int64 `json:"last_verified"`
+
+	Mismatch *AppHashMismatch `json:"mismatch,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// AppHashMismatch is the first height whose app hash differs from the one the chain recorded
+type AppHashMismatch struct {
+	Height          int64  `json:"height"`
+	ExpectedAppHash string `json:"expected_app_hash"`
+	ComputedAppHash string `json:"computed_app_hash"`
+
+	// StoreHashes are the hashes of the stores the block at height changed, before and after it; the chain only
+	// records the app hash, so these are where to look rather than a diff against the chain's
+	StoreHashes map[string]StoreHashChange `json:"store_hashes"`
+}
+
+type StoreHashChange struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after"`
+}
+
+// Verify re-executes the blocks from `from` to `to` on top of the state at from-1, checking the app hash committed
+// at every height, from-1 included, against the one the chain recorded in the next block's header. Blocks come from
+// --replay-source, as for Replay, or from RPC_ENDPOINTS if it's not given; `to` defaults to the last one there is
+// the next block of.
+//
+// Nothing is written to ldb, which can be opened read-only: blocks are applied to a view of it where what they write
+// is held in memory, and wasm code they store goes to a scratch copy of the wasm dir. State must have been committed
+// with merkle stores, i.e. by a replay or with MERKLE_STORES, as faux merkle mode commits placeholder app hashes.
+func Verify(mantlemintConfig *config.Config, appProviderName string, ldb *heleveldb.Driver, from, to int64) (report *VerifyReport) {
+	report = &VerifyReport{From: from, To: to}
+	defer func() {
+		if r := recover(); r != nil {
+			report.Verified = false
+			report.Error = fmt.Sprint(r)
+		}
+	}()
+
+	var load func(height int64) (*blockFeeder.BlockResult, error)
+	var tip int64
+	if mantlemintConfig.ReplaySource != "" {
+		var closeSource func()
+		load, tip, closeSource = openReplaySource(mantlemintConfig.ReplaySource)
+		defer closeSource()
+	} else {
+		upstream, err := newRpcFetcher(mantlemintConfig)
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		defer func() { _ = upstream.Close(context.Background()) }()
+
+		load = upstream.FetchBlock
+		if tip, err = upstream.LatestHeight(); err != nil {
+			report.Error = fmt.Sprintf("failed to get the latest height: %v", err)
+			return report
+		}
+	}
+
+	if to == 0 {
+		if tip == 0 {
+			report.Error = "the last height to verify must be given, as the blocks there are don't tell their last"
+			return report
+		}
+		report.To, to = tip-1, tip-1
+	}
+	if to < from {
+		report.Error = fmt.Sprintf("nothing to verify from %d to %d", from, to)
+		return report
+	}
+
+	return verify(mantlemintConfig, appProviderName, ldb, from, to, load)
+}
+
+func verify(mantlemintConfig *config.Config, appProviderName string, ldb *heleveldb.Driver, from, to int64, load func(height int64) (*blockFeeder.BlockResult, error)) *VerifyReport {
+	report := &VerifyReport{From: from, To: to}
+
+	// a state synced in faux merkle mode has no trees to recompute app hashes from
+	if mode, err := LoadStoreMode(ldb); err != nil {
+		report.Error = err.Error()
+		return report
+	} else if mode == StoreModeFauxMerkle {
+		report.Error = "the db was committed to in faux merkle mode, which commits placeholder app hashes; verify one synced with MERKLE_STORES, or by a replay"
+		return report
+	}
+
+	// the app stores wasm code it's given in its home, which is to be left as is
+	scratch, err := os.MkdirTemp("", "mantlemint-verify-")
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+	if err := copyDir(filepath.Join(mantlemintConfig.Home, "data", "wasm"), filepath.Join(scratch, "data", "wasm")); err != nil {
+		report.Error = fmt.Sprintf("failed to copy the wasm dir: %v", err)
+		return report
+	}
+	scratchConfig := *mantlemintConfig
+	scratchConfig.Home = scratch
+	appProvider, err := LookupAppProvider(appProviderName, &scratchConfig)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	// reads see the db as of from-1, and what's written since; the batch is never flushed
+	hldb := hld.ApplyHeightLimitedDB(ldb, &hld.HeightLimitedDBConfig{Debug: true})
+	hldb.SetReadHeight(from - 1)
+	hldb.SetWriteHeight(from)
+	batched := safe_batch.NewSafeBatchDB(hldb)
+	batched.(safe_batch.SafeBatchDBCloser).Open()
+
+	logger := tmlog.NewTMLogger(os.Stderr)
+	cms := rootmulti.NewStore(batched, hldb, logger)
+	app := appProvider.NewApp(logger, batched, nil, SetCMSOpt(cms))
+
+	appConns := proxy.NewAppConns(mantlemint.NewConcurrentQueryClientCreator(app))
+	appConns.SetLogger(logger)
+	if err := appConns.OnStart(); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	mm := mantlemint.NewMantlemint(
+		batched,
+		appConns,
+		mantlemint.NewMantlemintExecutor(batched, appConns.Consensus(), mantlemint.NewExecutionTimer()),
+		nil,
+		nil,
+	)
+	if err := mm.LoadInitialState(); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if lastHeight := mm.GetCurrentState().LastBlockHeight; lastHeight != from-1 {
+		report.Error = fmt.Sprintf("no block injected at height %d to verify from; the last one up to there is at %d", from-1, lastHeight)
+		return report
+	}
+
+	// the app hash of a height is recorded in the header of the block after it
+	var previousStoreHashes map[string][]byte
+	for height := from - 1; height <= to; height++ {
+		next, err := load(height + 1)
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to load block %d: %v", height+1, err)
+			return report
+		} else if next == nil {
+			report.Error = fmt.Sprintf("block %d is not stored", height+1)
+			return report
+		}
+
+		computed, storeHashes := cms.LastCommitID().Hash, cms.LastCommitStoreHashes()
+		if !bytes.Equal(next.Block.AppHash, computed) {
+			report.Mismatch = &AppHashMismatch{
+				Height:          height,
+				ExpectedAppHash: fmt.Sprintf("%X", next.Block.AppHash),
+				ComputedAppHash: fmt.Sprintf("%X", computed),
+				StoreHashes:     diffStoreHashes(previousStoreHashes, storeHashes),
+			}
+			log.Printf("[v0.34.x/verify] app hash at height %d is %X, but the chain recorded %X", height, computed, next.Block.AppHash)
+			return report
+		}
+		report.LastVerified = height
+		log.Printf("[v0.34.x/verify] height=%d, apphash=%X", height, computed)
+
+		if height == to {
+			break
+		}
+		hldb.SetWriteHeight(next.Block.Height)
+		if err := mm.Inject(next.Block); err != nil {
+			report.Error = fmt.Sprintf("failed to inject block %d: %v", next.Block.Height, err)
+			return report
+		}
+		previousStoreHashes = storeHashes
+	}
+
+	report.Verified = true
+	return report
+}
+
+// diffStoreHashes returns the stores whose hash changed from before to after; all of them if before is nil
+func diffStoreHashes(before, after map[string][]byte) map[string]StoreHashChange {
+	changed := make(map[string]StoreHashChange)
+	for name, hash := range after {
+		previous, ok := before[name]
+		if ok && bytes.Equal(previous, hash) {
+			continue
+		}
+		change := StoreHashChange{After: fmt.Sprintf("%X", hash)}
+		if ok {
+			change.Before = fmt.Sprintf("%X", previous)
+		}
+		changed[name] = change
+	}
+	return changed
+}
+
+// copyDir copies the files under src to dst; there's nothing to copy if src doesn't exist
+func copyDir(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		// the lock of the wasm vm owning src is not to be carried over
+		if !entry.Type().IsRegular() || entry.Name() == "exclusive.lock" {
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			_ = out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
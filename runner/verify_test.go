@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+)
+
+func TestVerify(t *testing.T) {
+	// app hashes are only real with merkle stores, as when replaying
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	cfg.ReplayFrom = 5_000_001
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		injectNextBlock(t, r, privKey)
+	}
+	assert.Nil(t, r.indexer.Close())
+
+	load, _, closeSource := openReplaySource(filepath.Join(cfg.Home, "indexer.db"))
+
+	report := verify(cfg, "terra", ldb, 5_000_002, 5_000_003, load)
+	assert.Empty(t, report.Error)
+	assert.True(t, report.Verified)
+	assert.Equal(t, int64(5_000_003), report.LastVerified)
+
+	// the first height that differs is reported, along with the stores its block changed
+	tampered := func(height int64) (*blockFeeder.BlockResult, error) {
+		block, err := load(height)
+		if height == 5_000_004 {
+			block.Block.AppHash = []byte("tampered")
+		}
+		return block, err
+	}
+	report = verify(cfg, "terra", ldb, 5_000_002, 5_000_003, tampered)
+	assert.False(t, report.Verified)
+	assert.Equal(t, int64(5_000_002), report.LastVerified)
+	assert.Equal(t, int64(5_000_003), report.Mismatch.Height)
+	assert.Equal(t, "74616D7065726564", report.Mismatch.ExpectedAppHash)
+	assert.NotEmpty(t, report.Mismatch.StoreHashes)
+	for _, change := range report.Mismatch.StoreHashes {
+		assert.NotEqual(t, change.Before, change.After)
+	}
+
+	// verifying needs the state right before
+	report = verify(cfg, "terra", ldb, 5_000_006, 5_000_006, load)
+	assert.False(t, report.Verified)
+	assert.Contains(t, report.Error, "no block injected at height 5000005")
+	closeSource()
+
+	// state is left as is
+	r, err = New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5_000_004), r.Height())
+	assert.Equal(t, int64(5_000_004), r.app.LastBlockHeight())
+	assert.Nil(t, r.indexer.Close())
+}
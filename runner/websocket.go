@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+
+	abci "github.com/tendermint/tendermint/abci/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/mantlemint"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+// newWebsocketEvents are the events Tendermint's event bus publishes for block, executed as evc collected,
+// for websocket subscriptions: the block, its header, then each of its txs along with their results
+func newWebsocketEvents(block *tendermint.Block, evc *mantlemint.EventCollector) []rpc.WebsocketEvent {
+	var beginBlock abci.ResponseBeginBlock
+	var endBlock abci.ResponseEndBlock
+	if evc.ResponseBeginBlock != nil {
+		beginBlock = *evc.ResponseBeginBlock
+	}
+	if evc.ResponseEndBlock != nil {
+		endBlock = *evc.ResponseEndBlock
+	}
+	blockEvents := append(append([]abci.Event{}, beginBlock.Events...), endBlock.Events...)
+
+	events := []rpc.WebsocketEvent{
+		{
+			Data: tendermint.EventDataNewBlock{
+				Block:            block,
+				ResultBeginBlock: beginBlock,
+				ResultEndBlock:   endBlock,
+			},
+			Events: stringifyEvents(tendermint.EventNewBlock, blockEvents),
+		},
+		{
+			Data: tendermint.EventDataNewBlockHeader{
+				Header:           block.Header,
+				NumTxs:           int64(len(block.Txs)),
+				ResultBeginBlock: beginBlock,
+				ResultEndBlock:   endBlock,
+			},
+			Events: stringifyEvents(tendermint.EventNewBlockHeader, blockEvents),
+		},
+	}
+	for i, tx := range block.Txs {
+		if i >= len(evc.ResponseDeliverTxs) {
+			break
+		}
+		result := *evc.ResponseDeliverTxs[i]
+		txEvents := stringifyEvents(tendermint.EventTx, result.Events)
+		txEvents[tendermint.TxHashKey] = []string{fmt.Sprintf("%X", tx.Hash())}
+		txEvents[tendermint.TxHeightKey] = []string{strconv.FormatInt(block.Height, 10)}
+		events = append(events, rpc.WebsocketEvent{
+			Data: tendermint.EventDataTx{TxResult: abci.TxResult{
+				Height: block.Height,
+				Index:  uint32(i),
+				Tx:     tx,
+				Result: result,
+			}},
+			Events: txEvents,
+		})
+	}
+	return events
+}
+
+// stringifyEvents keys the attributes of events by their composite key, along with tm.event, as Tendermint's
+// event bus does; attributes without a type or a key are left out
+func stringifyEvents(eventType string, events []abci.Event) map[string][]string {
+	stringified := map[string][]string{tendermint.EventTypeKey: {eventType}}
+	for _, event := range events {
+		if event.Type == "" {
+			continue
+		}
+		for _, attribute := range event.Attributes {
+			if len(attribute.Key) == 0 {
+				continue
+			}
+			compositeKey := event.Type + "." + string(attribute.Key)
+			stringified[compositeKey] = append(stringified[compositeKey], string(attribute.Value))
+		}
+	}
+	return stringified
+}
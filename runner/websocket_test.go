@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	abci "github.com/tendermint/tendermint/abci/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tendermint "github.com/tendermint/tendermint/types"
+	"github.com/terra-money/mantlemint/db/heleveldb"
+	"github.com/terra-money/mantlemint/mantlemint"
+	"github.com/terra-money/mantlemint/rpc"
+)
+
+func TestRunnerWebsocket(t *testing.T) {
+	cfg, privKey := newExportedGenesisConfig(t, 5_000_000)
+	cfg.WebsocketMaxClients, cfg.WebsocketBufferSize, cfg.WebsocketMaxSubscriptionsPerClient = 1, 10, 5
+	ldb := heleveldb.NewMemDBDriver(heleveldb.DriverModeKeySuffixDesc)
+	r, err := New(cfg, NewTerraAppProvider(cfg), WithDB(ldb), WithFeed(&fakeFeed{}))
+	assert.Nil(t, err)
+
+	router := mux.NewRouter()
+	rpc.RegisterWebsocketRoute(router, r.websocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+rpc.EndpointWebsocket, nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	for id, q := range []string{"tm.event='NewBlock'", "tm.event='NewBlockHeader'"} {
+		assert.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "subscribe", "params": map[string]string{"query": q}}))
+		var response rpctypes.RPCResponse
+		assert.Nil(t, conn.ReadJSON(&response))
+		assert.Nil(t, response.Error)
+	}
+
+	// blocks are published once flushed, as a block and as a header
+	injectNextBlock(t, r, privKey)
+	for _, expected := range []string{"tm.event='NewBlock'", "tm.event='NewBlockHeader'"} {
+		var response rpctypes.RPCResponse
+		assert.Nil(t, conn.ReadJSON(&response))
+		var event coretypes.ResultEvent
+		assert.Nil(t, tmjson.Unmarshal(response.Result, &event))
+		assert.Equal(t, expected, event.Query)
+		switch data := event.Data.(type) {
+		case tendermint.EventDataNewBlock:
+			assert.Equal(t, int64(5_000_001), data.Block.Height)
+		case tendermint.EventDataNewBlockHeader:
+			assert.Equal(t, int64(5_000_001), data.Header.Height)
+		}
+	}
+
+	// clients are disconnected on stop, rather than holding up the server
+	r.websocket.Close()
+	var response rpctypes.RPCResponse
+	assert.Nil(t, conn.ReadJSON(&response))
+	assert.Contains(t, response.Error.Data, "mantlemint is stopping")
+	assert.Nil(t, r.indexer.Close())
+}
+
+func TestNewWebsocketEvents(t *testing.T) {
+	block := &tendermint.Block{Header: tendermint.Header{Height: 10}, Data: tendermint.Data{Txs: tendermint.Txs{[]byte("tx")}}}
+	evc := &mantlemint.EventCollector{
+		ResponseDeliverTxs: []*abci.ResponseDeliverTx{{
+			Code: 5,
+			Events: []abci.Event{{
+				Type:       "transfer",
+				Attributes: []abci.EventAttribute{{Key: []byte("recipient"), Value: []byte("terra1a")}},
+			}},
+		}},
+	}
+
+	// txs are published after the block and its header, keyed by hash and height as Tendermint does
+	events := newWebsocketEvents(block, evc)
+	assert.Len(t, events, 3)
+	tx := events[2]
+	assert.Equal(t, []string{tendermint.EventTx}, tx.Events[tendermint.EventTypeKey])
+	assert.Equal(t, []string{fmt.Sprintf("%X", tendermint.Tx("tx").Hash())}, tx.Events[tendermint.TxHashKey])
+	assert.Equal(t, []string{"10"}, tx.Events[tendermint.TxHeightKey])
+	assert.Equal(t, []string{"terra1a"}, tx.Events["transfer.recipient"])
+	data := tx.Data.(tendermint.EventDataTx)
+	assert.Equal(t, int64(10), data.Height)
+	assert.Equal(t, uint32(5), data.Result.Code)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyShutdown returns a channel closed on the first SIGINT/SIGTERM; a second one exits right away
+func notifyShutdown() <-chan struct{} {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	shutdown := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("[v0.34.x/shutdown] %s received, shutting down after the block in flight; send it again to force exit", sig)
+		close(shutdown)
+
+		sig = <-signals
+		log.Printf("[v0.34.x/shutdown] %s received again, exiting now", sig)
+		os.Exit(1)
+	}()
+
+	return shutdown
+}
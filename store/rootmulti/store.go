@@ -415,6 +415,40 @@ func (rs *Store) LastCommitID() types.CommitID {
 	return rs.lastCommitInfo.CommitID()
 }
 
+// LastCommitStoreHashes returns the commit hash of every store as of the last commit, by store name;
+// these are what the app hash is computed from.
+func (rs *Store) LastCommitStoreHashes() map[string][]byte {
+	hashes := make(map[string][]byte)
+	if rs.lastCommitInfo == nil {
+		return hashes
+	}
+
+	for _, storeInfo := range rs.lastCommitInfo.StoreInfos {
+		hashes[storeInfo.Name] = storeInfo.CommitId.Hash
+	}
+	return hashes
+}
+
+// ReloadLastCommit (mantlemint) moves on to the last version committed to the db, i.e. by another mantlemint
+// writing to it; stores read through to the db, so only the last commit info is loaded again.
+func (rs *Store) ReloadLastCommit() error {
+	cInfo, err := getCommitInfo(rs.db, GetLatestVersion(rs.db))
+	if err != nil {
+		return err
+	}
+	rs.lastCommitInfo = cInfo
+	return nil
+}
+
+// CommitHash (mantlemint) returns the app hash committed at version, as of the commit info recorded for it
+func (rs *Store) CommitHash(version int64) ([]byte, error) {
+	cInfo, err := getCommitInfo(rs.db, version)
+	if err != nil {
+		return nil, err
+	}
+	return cInfo.Hash(), nil
+}
+
 // Commit implements Committer/CommitStore.
 func (rs *Store) Commit() types.CommitID {
 	var previousHeight, version int64
@@ -492,6 +526,10 @@ func (rs *Store) CacheMultiStore() types.CacheMultiStore {
 // any store cannot be loaded. This should only be used for querying and
 // iterating at past heights.
 func (rs *Store) CacheMultiStoreWithVersion(version int64) (types.CacheMultiStore, error) {
+	// (mantlemint) versions below the retained height are garbage collected
+	if version < rs.hldb.PrunedHeight() {
+		return nil, fmt.Errorf("%w: %d is below the lowest height retained, %d", hld.ErrHeightPruned, version, rs.hldb.PrunedHeight())
+	}
 	var hldb = rs.hldb.BranchHeightLimitedDB(version)
 
 	cachedStores := make(map[types.StoreKey]types.CacheWrapper)
@@ -816,7 +854,10 @@ func (rs *Store) Restore(
 	// Import nodes into stores. The first item is expected to be a SnapshotItem containing
 	// a SnapshotStoreItem, telling us which store to import into. The following items will contain
 	// SnapshotNodeItem (i.e. ExportNode) until we reach the next SnapshotStoreItem or EOF.
+	//
+	// (mantlemint) stores in faux merkle mode have no tree to import into; leaf nodes are written into them as is.
 	var importer *iavltree.Importer
+	var fauxStore types.KVStore
 	var snapshotItem snapshottypes.SnapshotItem
 loop:
 	for {
@@ -836,6 +877,12 @@ loop:
 					return snapshottypes.SnapshotItem{}, sdkerrors.Wrap(err, "IAVL commit failed")
 				}
 				importer.Close()
+				importer = nil
+			}
+			fauxStore = nil
+			if store, ok := rs.GetStoreByName(item.Store.Name).(commitDBStoreAdapter); ok {
+				fauxStore = store
+				continue
 			}
 			store, ok := rs.GetStoreByName(item.Store.Name).(*iavl.Store)
 			if !ok || store == nil {
@@ -848,6 +895,17 @@ loop:
 			defer importer.Close()
 
 		case *snapshottypes.SnapshotItem_IAVL:
+			if fauxStore != nil {
+				// inner nodes only matter to the tree
+				if item.IAVL.Height == 0 {
+					value := item.IAVL.Value
+					if value == nil {
+						value = []byte{}
+					}
+					fauxStore.Set(item.IAVL.Key, value)
+				}
+				continue
+			}
 			if importer == nil {
 				return snapshottypes.SnapshotItem{}, sdkerrors.Wrap(sdkerrors.ErrLogic, "received IAVL node item before store item")
 			}
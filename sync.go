@@ -1,288 +1,117 @@
 package main
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"runtime/debug"
 
-	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
-	"github.com/cosmos/cosmos-sdk/baseapp"
 	sdk "github.com/cosmos/cosmos-sdk/types"
-	"github.com/gorilla/mux"
-	"github.com/spf13/viper"
-	tmlog "github.com/tendermint/tendermint/libs/log"
-	"github.com/tendermint/tendermint/proxy"
-	tendermint "github.com/tendermint/tendermint/types"
-	terra "github.com/terra-money/core/v2/app"
-	coreconfig "github.com/terra-money/core/v2/app/config"
-	wasmconfig "github.com/terra-money/core/v2/app/wasmconfig"
-	blockFeeder "github.com/terra-money/mantlemint/block_feed"
+	"github.com/spf13/pflag"
 
 	"github.com/terra-money/mantlemint/config"
-	"github.com/terra-money/mantlemint/db/heleveldb"
 	"github.com/terra-money/mantlemint/db/hld"
-	"github.com/terra-money/mantlemint/db/safe_batch"
-	"github.com/terra-money/mantlemint/indexer"
-	"github.com/terra-money/mantlemint/indexer/block"
-	"github.com/terra-money/mantlemint/indexer/richlist"
-	"github.com/terra-money/mantlemint/indexer/tx"
-	"github.com/terra-money/mantlemint/mantlemint"
-	"github.com/terra-money/mantlemint/rpc"
-	"github.com/terra-money/mantlemint/store/rootmulti"
-
-	tmdb "github.com/tendermint/tm-db"
+	"github.com/terra-money/mantlemint/runner"
 )
 
+// appProviderName selects the app to run among those registered with runner.RegisterAppProvider, at build time:
+// go build -ldflags "-X main.appProviderName=<name>"
+var appProviderName = "terra"
+
 // initialize mantlemint for v0.34.x
 func main() {
-	mantlemintConfig := config.GetConfig()
-	mantlemintConfig.Print()
-
-	sdkConfig := sdk.GetConfig()
-	sdkConfig.SetCoinType(coreconfig.CoinType)
-	accountPubKeyPrefix := coreconfig.AccountAddressPrefix + "pub"
-	validatorAddressPrefix := coreconfig.AccountAddressPrefix + "valoper"
-	validatorPubKeyPrefix := coreconfig.AccountAddressPrefix + "valoperpub"
-	consNodeAddressPrefix := coreconfig.AccountAddressPrefix + "valcons"
-	consNodePubKeyPrefix := coreconfig.AccountAddressPrefix + "valconspub"
-
-	sdkConfig.SetBech32PrefixForAccount(coreconfig.AccountAddressPrefix, accountPubKeyPrefix)
-	sdkConfig.SetBech32PrefixForValidator(validatorAddressPrefix, validatorPubKeyPrefix)
-	sdkConfig.SetBech32PrefixForConsensusNode(consNodeAddressPrefix, consNodePubKeyPrefix)
-	sdkConfig.SetAddressVerifier(wasmtypes.VerifyAddressLen())
-
-	err := sdk.RegisterDenom(coreconfig.BondDenom, sdk.NewDecWithPrec(1, 6))
+	mantlemintConfig, err := config.Load()
 	if err != nil {
-		panic(err)
+		exitOnError(err)
 	}
 
-	sdkConfig.Seal()
-
-	ldb, ldbErr := heleveldb.NewLevelDBDriver(&heleveldb.DriverConfig{
-		Name: mantlemintConfig.MantlemintDB,
-		Dir:  mantlemintConfig.Home,
-		Mode: heleveldb.DriverModeKeySuffixDesc,
-	})
-	if ldbErr != nil {
-		panic(ldbErr)
+	// export and verify write to stdout; anything else printed meanwhile goes to stderr
+	stdout := os.Stdout
+	if pflag.Arg(0) == "export" || pflag.Arg(0) == "verify" {
+		os.Stdout = os.Stderr
 	}
+	mantlemintConfig.Print()
 
-	var hldb = hld.ApplyHeightLimitedDB(
-		ldb,
-		&hld.HeightLimitedDBConfig{
-			Debug: true,
-		},
-	)
-
-	batched := safe_batch.NewSafeBatchDB(hldb)
-	batchedOrigin := batched.(safe_batch.SafeBatchDBCloser)
-	logger := tmlog.NewTMLogger(os.Stdout)
-	codec := terra.MakeEncodingConfig()
-
-	// customize CMS to limit kv store's read height on query
-	cms := rootmulti.NewStore(batched, hldb, logger)
-	vpr := viper.GetViper()
-
-	var app = terra.NewTerraApp(
-		logger,
-		batched,
-		nil,
-		true, // need this so KVStores are set
-		make(map[int64]bool),
-		mantlemintConfig.Home,
-		0,
-		codec,
-		vpr,
-		wasmconfig.GetConfig(vpr),
-		fauxMerkleModeOpt,
-		func(ba *baseapp.BaseApp) {
-			ba.SetCMS(cms)
-		},
-	)
-
-	// create app...
-	var appCreator = mantlemint.NewConcurrentQueryClientCreator(app)
-	appConns := proxy.NewAppConns(appCreator)
-	appConns.SetLogger(logger)
-	if startErr := appConns.OnStart(); startErr != nil {
-		panic(startErr)
-	}
-
-	go func() {
-		a := <-appConns.Quit()
-		fmt.Println(a)
-	}()
-
-	var executor = mantlemint.NewMantlemintExecutor(batched, appConns.Consensus())
-	var mm = mantlemint.NewMantlemint(
-		batched,
-		appConns,
-		executor,
-
-		// run before
-		nil,
-
-		// RunAfter Inject callback
-		nil,
-	)
-
-	// initialize using provided genesis
-	genesisDoc := getGenesisDoc(mantlemintConfig.GenesisPath)
-	initialHeight := genesisDoc.InitialHeight
-
-	// set target initial write height to genesis.initialHeight;
-	// this is safe as upon Inject it will be set with block.Height
-	hldb.SetWriteHeight(initialHeight)
-	batchedOrigin.Open()
-
-	// initialize state machine with genesis
-	if initErr := mm.Init(genesisDoc); initErr != nil {
-		panic(initErr)
+	appProvider, err := runner.LookupAppProvider(appProviderName, mantlemintConfig)
+	if err != nil {
+		panic(err)
 	}
-
-	// flush to db; panic upon error (can't proceed)
-	if rollback, flushErr := batchedOrigin.Flush(); flushErr != nil {
-		debug.PrintStack()
-		panic(flushErr)
-	} else if rollback != nil {
-		rollback.Close()
+	sdkConfig := sdk.GetConfig()
+	if err := appProvider.ConfigureSDK(sdkConfig); err != nil {
+		panic(err)
 	}
+	sdkConfig.Seal()
 
-	// load initial state to mantlemint
-	if loadErr := mm.LoadInitialState(); loadErr != nil {
-		panic(loadErr)
+	// commands work on the db instead of syncing
+	switch command := pflag.Arg(0); command {
+	case "":
+	case "rollback", "export", "backfill":
+		ldb, ldbErr := runner.OpenDB(mantlemintConfig)
+		if ldbErr != nil {
+			exitOnError(ldbErr)
+		}
+		var hldb = hld.ApplyHeightLimitedDB(
+			ldb,
+			&hld.HeightLimitedDBConfig{
+				Debug: true,
+			},
+		)
+
+		if command == "rollback" {
+			rollback(ldb, hldb, mantlemintConfig, pflag.Args()[1:])
+		} else if command == "backfill" {
+			backfill(hldb, mantlemintConfig, pflag.Args()[1:])
+		} else {
+			exportAppState(ldb, hldb, mantlemintConfig, appProvider, stdout)
+		}
+		_ = ldb.Close()
+		return
+	case "verify":
+		verify(mantlemintConfig, pflag.Args()[1:], stdout)
+		return
+	default:
+		exitOnError(fmt.Errorf("unknown command %s", command))
 	}
 
-	// initialization is done; clear write height
-	hldb.ClearWriteHeight()
-
-	// get blocks over some sort of transport, inject to mantlemint
-	blockFeed := blockFeeder.NewAggregateBlockFeed(
-		mm.GetCurrentHeight(),
-		mantlemintConfig.RPCEndpoints,
-		mantlemintConfig.WSEndpoints,
-	)
-
-	// create indexer service
-	indexerInstance, indexerInstanceErr := indexer.NewIndexer(mantlemintConfig.IndexerDB, mantlemintConfig.Home, app)
-	if indexerInstanceErr != nil {
-		panic(indexerInstanceErr)
+	// misconfigurations are told before anything is opened
+	if err := runner.Preflight(mantlemintConfig); err != nil {
+		exitOnError(err)
 	}
-
-	indexerInstance.RegisterIndexerService("tx", tx.IndexTx)
-	indexerInstance.RegisterIndexerService("block", block.IndexBlock)
-	indexerInstance.RegisterIndexerService("richlist", richlist.IndexRichlist)
-
-	abcicli, _ := appCreator.NewABCIClient()
-	rpccli := rpc.NewRpcClient(abcicli)
-
-	// rest cache invalidate channel
-	cacheInvalidateChan := make(chan int64)
-
-	// start RPC server
-	rpcErr := rpc.StartRPC(
-		app,
-		rpccli,
-		mantlemintConfig.ChainID,
-		codec,
-		cacheInvalidateChan,
-
-		// callback for registering custom routers; primarily for indexers
-		// default: noop,
-		// todo: make this part injectable
-		func(router *mux.Router) {
-			indexerInstance.RegisterRESTRoute(router, tx.RegisterRESTRoute)
-			indexerInstance.RegisterRESTRoute(router, block.RegisterRESTRoute)
-			indexerInstance.RegisterRESTRoute(router, richlist.RegisterRESTRoute)
-		},
-
-		// inject flag checker for synced
-		blockFeed.IsSynced,
-		mantlemintConfig,
-	)
-
-	if rpcErr != nil {
-		panic(rpcErr)
+	r, err := runner.New(mantlemintConfig, appProvider)
+	if err != nil {
+		exitOnError(err)
 	}
 
-	// start subscribing to block
-	if mantlemintConfig.DisableSync {
-		fmt.Println("running without sync...")
-		forever()
-	} else if cBlockFeed, blockFeedErr := blockFeed.Subscribe(0); blockFeedErr != nil {
-		panic(blockFeedErr)
-	} else {
-		var rollbackBatch tmdb.Batch
-		for {
-			feed := <-cBlockFeed
-
-			// open db batch
-			hldb.SetWriteHeight(feed.Block.Height)
-			batchedOrigin.Open()
-			if injectErr := mm.Inject(feed.Block); injectErr != nil {
-				// rollback last block
-				if rollbackBatch != nil {
-					fmt.Println("rollback previous block")
-					rollbackBatch.WriteSync()
-					rollbackBatch.Close()
-				}
-
-				debug.PrintStack()
-				panic(injectErr)
-			}
-
-			// last block is okay -> dispose rollback batch
-			if rollbackBatch != nil {
-				rollbackBatch.Close()
-				rollbackBatch = nil
-			}
-
-			// run indexer BEFORE batch flush
-			if indexerErr := indexerInstance.Run(feed.Block, feed.BlockID, mm.GetCurrentEventCollector()); indexerErr != nil {
-				debug.PrintStack()
-				panic(indexerErr)
-			}
-
-			// flush db batch
-			// returns rollback batch that reverts current block injection
-			if rollback, flushErr := batchedOrigin.Flush(); flushErr != nil {
-				debug.PrintStack()
-				panic(flushErr)
-			} else {
-				rollbackBatch = rollback
-			}
-
-			hldb.ClearWriteHeight()
-
-			cacheInvalidateChan <- feed.Block.Height
+	// replays run through the blocks given, then exit
+	if mantlemintConfig.ReplayFrom != 0 {
+		r.Replay()
+		if err := r.Stop(context.Background()); err != nil {
+			log.Printf("[v0.34.x/replay] %v", err)
 		}
+		return
 	}
-}
 
-// Pass this in as an option to use a dbStoreAdapter instead of an IAVLStore for simulation speed.
-func fauxMerkleModeOpt(app *baseapp.BaseApp) {
-	app.SetFauxMerkleMode()
-}
+	// on SIGINT/SIGTERM, injection stops after the block in flight, then everything is closed in order
+	shutdown := notifyShutdown()
 
-func getGenesisDoc(genesisPath string) *tendermint.GenesisDoc {
-	jsonBlob, _ := ioutil.ReadFile(genesisPath)
-	shasum := sha1.New()
-	shasum.Write(jsonBlob)
-	sum := hex.EncodeToString(shasum.Sum(nil))
+	if err := r.Start(context.Background()); err != nil {
+		panic(err)
+	}
 
-	log.Printf("[v0.34.x/sync] genesis shasum=%s", sum)
+	select {
+	case <-shutdown:
+	case <-r.Done():
+	}
 
-	if genesis, genesisErr := tendermint.GenesisDocFromFile(genesisPath); genesisErr != nil {
-		panic(genesisErr)
-	} else {
-		return genesis
+	// failures are only logged, as there's nothing left to do about them
+	if err := r.Stop(context.Background()); err != nil {
+		log.Printf("[v0.34.x/shutdown] %v", err)
 	}
+	log.Printf("[v0.34.x/shutdown] shut down")
 }
 
-func forever() {
-	<-(chan int)(nil)
+// exitOnError prints err on one line, and exits with its code; see config.ExitCode
+func exitOnError(err error) {
+	fmt.Fprintf(os.Stderr, "mantlemint: %v\n", err)
+	os.Exit(config.ExitCode(err))
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/terra-money/mantlemint/config"
+	"github.com/terra-money/mantlemint/runner"
+)
+
+// verify checks the app hashes of the heights given in args against the chain's, re-executing blocks on a
+// read-only view of the db (see runner.Verify), and writes the report as JSON to stdout. It exits non-zero
+// unless every height was verified.
+func verify(mantlemintConfig *config.Config, args []string, stdout io.Writer) {
+	if len(args) < 1 || len(args) > 2 {
+		panic(fmt.Errorf("usage: verify <from height> [to height]"))
+	}
+	var heights [2]int64
+	for i, arg := range args {
+		height, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || height <= 1 {
+			panic(fmt.Errorf("verify takes heights above 1, got %s", arg))
+		}
+		heights[i] = height
+	}
+
+	// goleveldb still locks the directory read-only; the mantlemint owning it must be stopped
+	ldb, err := runner.OpenReadOnlyDB(mantlemintConfig)
+	if err != nil {
+		panic(err)
+	}
+	report := runner.Verify(mantlemintConfig, appProviderName, ldb, heights[0], heights[1])
+	_ = ldb.Close()
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if _, err := stdout.Write(append(encoded, '\n')); err != nil {
+		panic(err)
+	}
+
+	if !report.Verified {
+		log.Printf("[v0.34.x/verify] verification failed, verified up to height %d", report.LastVerified)
+		os.Exit(1)
+	}
+	log.Printf("[v0.34.x/verify] verified heights %d to %d", report.From-1, report.To)
+}